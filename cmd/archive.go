@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"archive/tar"
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"context"
@@ -9,13 +10,19 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/boring-registry/boring-registry/pkg/core"
 	"github.com/boring-registry/boring-registry/pkg/module"
+	"github.com/boring-registry/boring-registry/pkg/storage"
 
 	"github.com/hashicorp/go-version"
+	"github.com/klauspost/compress/zstd"
 )
 
 const (
@@ -75,48 +82,157 @@ func processModule(path string, storage module.Storage) error {
 	}
 
 	ctx := context.Background()
-	if res, err := storage.GetModule(ctx, spec.Metadata.Namespace, spec.Metadata.Name, spec.Metadata.Provider, spec.Metadata.Version); err == nil {
-		if flagIgnoreExistingModule {
-			slog.Info("module already exists", slog.String("download_url", res.DownloadURL))
-			return nil
-		} else {
-			slog.Error("module already exists", slog.String("download_url", res.DownloadURL))
-			return errors.New("module already exists")
-		}
+	_, err = storage.GetModule(ctx, spec.Metadata.Namespace, spec.Metadata.Name, spec.Metadata.Provider, spec.Metadata.Version)
+	exists := err == nil
+	if exists && flagIgnoreExistingModule {
+		slog.Info("module already exists", slog.String("name", spec.Name()))
+		return nil
 	}
 
-	moduleRoot := filepath.Dir(path)
-
-	buf, err := archiveModule(moduleRoot)
-	if err != nil {
+	// Existing versions are compared to the archive by the storage backend, the upload only fails if the content differs
+	res, err := uploadModuleWithRetries(ctx, storage, spec, filepath.Dir(path), flagUploadRetries, flagUploadRetryDelay)
+	if errors.Is(err, module.ErrModuleContentMismatch) {
+		slog.Error("module already exists with different content", slog.String("name", spec.Name()))
 		return err
-	}
-
-	res, err := storage.UploadModule(ctx, spec.Metadata.Namespace, spec.Metadata.Name, spec.Metadata.Provider, spec.Metadata.Version, buf)
-	if err != nil {
+	} else if err != nil {
 		return err
 	}
 
+	if exists {
+		slog.Info("module already exists with identical content", slog.String("download_url", res.DownloadURL))
+		return nil
+	}
 	slog.Info("module successfully uploaded", slog.String("download_url", res.DownloadURL))
 
 	return nil
 
 }
 
-func archiveModule(root string) (io.Reader, error) {
-	buf := new(bytes.Buffer)
+// uploadModuleWithRetries archives and uploads the module in moduleRoot and retries transient errors with an exponential backoff.
+// Every attempt uploads a new archive, as a failed attempt may have consumed the previous archive partially.
+func uploadModuleWithRetries(ctx context.Context, storage module.Storage, spec *module.Spec, moduleRoot string, retries int, delay time.Duration) (core.Module, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := uploadModuleArchive(ctx, storage, spec, moduleRoot)
+		if err == nil || !isTransientUploadError(err) || attempt >= retries {
+			return res, err
+		}
+
+		backoff := delay << attempt
+		slog.Warn("failed to upload module, retrying", slog.String("name", spec.Name()), slog.Int("attempt", attempt+1), slog.String("backoff", backoff.String()), slog.String("err", err.Error()))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return core.Module{}, ctx.Err()
+		}
+	}
+}
+
+func uploadModuleArchive(ctx context.Context, storage module.Storage, spec *module.Spec, moduleRoot string) (core.Module, error) {
+	archive, err := archiveModule(moduleRoot, flagModuleArchiveFormat, flagReproducibleArchives)
+	if err != nil {
+		return core.Module{}, err
+	}
+	// Closing the archive stops the archiving in case the upload failed before consuming it completely
+	defer archive.Close()
+
+	return storage.UploadModule(ctx, spec.Metadata.Namespace, spec.Metadata.Name, spec.Metadata.Provider, spec.Metadata.Version, archive)
+}
+
+// isTransientUploadError reports whether a failed upload might succeed when it's retried.
+// Only the transient errors of the storage backend are retried, e.g. a module with different content or a canceled upload never is.
+func isTransientUploadError(err error) bool {
+	return !errors.Is(err, module.ErrModuleContentMismatch) &&
+		!errors.Is(err, context.Canceled) &&
+		storage.IsTransientError(err)
+}
+
+// archiveCompression compresses and decompresses the tar stream of a module archive
+type archiveCompression struct {
+	// magic are the first bytes of every compressed stream
+	magic     []byte
+	newWriter func(w io.Writer) (io.WriteCloser, error)
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	gzipCompression = archiveCompression{
+		magic: []byte{0x1f, 0x8b},
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	}
+	zstdCompression = archiveCompression{
+		magic: []byte{0x28, 0xb5, 0x2f, 0xfd},
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			// A single goroutine keeps the compressed bytes identical for identical module contents
+			return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	}
+)
+
+// moduleArchiveCompression returns the compression of the module archive format.
+// Only compressed tar archives can be created and validated, other formats have to be uploaded to the storage backend directly.
+func moduleArchiveCompression(format string) (archiveCompression, error) {
+	switch format {
+	case "tar.gz", "tgz":
+		return gzipCompression, nil
+	case "tar.zst":
+		return zstdCompression, nil
+	default:
+		return archiveCompression{}, fmt.Errorf("module archives can't be created in the %s format", format)
+	}
+}
+
+// archiveModule returns the archive of the module at root in the given archive format.
+// The archive is created while it's read, so that large modules are never held in memory completely.
+// Errors during the archiving are returned by the Read of the archive. The archive must be closed by the caller.
+func archiveModule(root, format string, reproducible bool) (io.ReadCloser, error) {
+	compression, err := moduleArchiveCompression(format)
+	if err != nil {
+		return nil, err
+	}
+
 	// ensure the src actually exists before trying to tar it
 	if _, err := os.Stat(root); err != nil {
-		return buf, fmt.Errorf("unable to tar files - %v", err.Error())
+		return nil, fmt.Errorf("unable to tar files - %v", err.Error())
 	}
 
-	gw := gzip.NewWriter(buf)
-	defer gw.Close()
+	return streamArchive(func(w io.Writer) error {
+		return writeModuleArchive(w, compression, root, reproducible)
+	}), nil
+}
+
+// streamArchive runs write in a goroutine and returns a reader for the bytes it writes.
+// The error returned by write is passed to the reader, and write is stopped when the reader is closed early.
+func streamArchive(write func(w io.Writer) error) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		// CloseWithError(nil) closes the pipe regularly, so that the reader receives io.EOF
+		_ = pw.CloseWithError(write(pw))
+	}()
+	return pr
+}
 
-	tw := tar.NewWriter(gw)
-	defer tw.Close()
+func writeModuleArchive(w io.Writer, compression archiveCompression, root string, reproducible bool) error {
+	cw, err := compression.newWriter(w)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(cw)
 
-	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+	// collect the regular files first, so that they can be added to the archive in a stable order
+	var paths []string
+	err = filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
 		// return on any error
 		if err != nil {
 			return err
@@ -127,36 +243,79 @@ func archiveModule(root string) (io.Reader, error) {
 			return nil
 		}
 
-		// create a new dir/file header
-		header, err := tar.FileInfoHeader(fi, fi.Name())
-		if err != nil {
-			return err
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk module directory %s: %w", root, err)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := addArchiveFile(tw, path, root, reproducible); err != nil {
+			return fmt.Errorf("failed to add %s to the archive: %w", path, err)
 		}
+	}
 
-		// update the name to correctly reflect the desired destination when untaring
-		header.Name = archiveFileHeaderName(path, root)
+	// The writers have to be closed explicitly, as their footers are only complete once Close succeeded
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return cw.Close()
+}
 
-		if err := tw.WriteHeader(header); err != nil {
-			return err
-		}
+func addArchiveFile(tw *tar.Writer, path, root string, reproducible bool) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
 
-		data, err := os.Open(path)
-		if err != nil {
-			return err
-		}
+	// create a new dir/file header
+	header, err := tar.FileInfoHeader(fi, fi.Name())
+	if err != nil {
+		return err
+	}
 
-		if _, err := io.Copy(tw, data); err != nil {
-			return err
-		}
+	// update the name to correctly reflect the desired destination when untaring
+	header.Name = archiveFileHeaderName(path, root)
 
-		// manually close here after each file operation; deferring would cause each file close
-		// to wait until all operations have completed.
-		data.Close()
+	if reproducible {
+		normalizeArchiveHeader(header)
+	}
 
-		return nil
-	})
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	data, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	_, err = io.Copy(tw, data)
+	return err
+}
 
-	return buf, err
+// normalizeArchiveHeader removes all metadata from the header that depends on the local checkout,
+// so that archiving identical files results in identical bytes.
+// The compression headers don't need to be normalized, as neither gzip.Writer nor zstd.Encoder set a name or modification time.
+func normalizeArchiveHeader(header *tar.Header) {
+	header.ModTime = time.Unix(0, 0)
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Uid = 0
+	header.Gid = 0
+	header.Uname = ""
+	header.Gname = ""
+	header.PAXRecords = nil
+
+	// Only keep the executable bit from the file mode
+	if header.Mode&0o111 != 0 {
+		header.Mode = 0o755
+	} else {
+		header.Mode = 0o644
+	}
 }
 
 // meetsSemverConstraints checks whether a module version matches the semver version constraints.
@@ -196,3 +355,107 @@ func archiveFileHeaderName(path, root string) string {
 
 	return path
 }
+
+// processRemoteModule streams the compressed tar archive at sourceURL into the storage, without extracting it locally.
+// The headers are sent with the request to the source, e.g. for authentication.
+func processRemoteModule(ctx context.Context, spec *module.Spec, sourceURL string, headers http.Header, client *http.Client, storage module.Storage) error {
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+
+	_, err := storage.GetModule(ctx, spec.Metadata.Namespace, spec.Metadata.Name, spec.Metadata.Provider, spec.Metadata.Version)
+	exists := err == nil
+	if exists && flagIgnoreExistingModule {
+		slog.Info("module already exists", slog.String("name", spec.Name()))
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download module archive: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download module archive: %s returned status code %d", sourceURL, resp.StatusCode)
+	}
+
+	archive, err := validateArchive(resp.Body, flagModuleArchiveFormat)
+	if err != nil {
+		return fmt.Errorf("invalid module archive at %s: %w", sourceURL, err)
+	}
+	// Closing the archive stops the validation in case the upload failed before consuming it completely
+	defer archive.Close()
+
+	res, err := storage.UploadModule(ctx, spec.Metadata.Namespace, spec.Metadata.Name, spec.Metadata.Provider, spec.Metadata.Version, archive)
+	if errors.Is(err, module.ErrModuleContentMismatch) {
+		slog.Error("module already exists with different content", slog.String("name", spec.Name()))
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	if exists {
+		slog.Info("module already exists with identical content", slog.String("download_url", res.DownloadURL))
+		return nil
+	}
+	slog.Info("module successfully uploaded", slog.String("download_url", res.DownloadURL), slog.String("source", sourceURL))
+	return nil
+}
+
+// validateArchive returns a reader for the bytes of src, which fails instead of returning io.EOF if src isn't a valid archive in the given format.
+// Responses that don't start like a compressed stream, like HTML error pages, are rejected before anything is read by the caller.
+func validateArchive(src io.Reader, format string) (io.ReadCloser, error) {
+	compression, err := moduleArchiveCompression(format)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(src)
+	magic, err := br.Peek(len(compression.magic))
+	if err != nil || !bytes.Equal(magic, compression.magic) {
+		return nil, fmt.Errorf("not a %s archive", format)
+	}
+
+	return streamArchive(func(w io.Writer) error {
+		// The bytes are passed on while they're parsed, so the caller receives the error of an invalid archive before io.EOF
+		tee := io.TeeReader(br, w)
+		cr, err := compression.newReader(tee)
+		if err != nil {
+			return err
+		}
+		defer cr.Close()
+
+		tr := tar.NewReader(cr)
+		entries := 0
+		for {
+			_, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("not a tar archive: %w", err)
+			}
+			if _, err := io.Copy(io.Discard, tr); err != nil {
+				return err
+			}
+			entries++
+		}
+		if entries == 0 {
+			return errors.New("the archive is empty")
+		}
+
+		// Reading the compressed stream to the end verifies its checksum, the remaining bytes are passed on as well
+		if _, err := io.Copy(io.Discard, cr); err != nil {
+			return err
+		}
+		_, err = io.Copy(io.Discard, tee)
+		return err
+	}), nil
+}
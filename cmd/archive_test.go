@@ -1,9 +1,28 @@
 package cmd
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/module"
+
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestArchiveFileHeaderName(t *testing.T) {
@@ -55,3 +74,390 @@ func TestArchiveFileHeaderName(t *testing.T) {
 	}
 
 }
+
+func TestArchiveModuleReproducible(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	files := map[string]string{
+		"main.tf":                `resource "null_resource" "example" {}`,
+		"variables.tf":           `variable "example" {}`,
+		"modules/nested/main.tf": `output "example" { value = "example" }`,
+		moduleSpecFileName:       `metadata { namespace = "acme" }`,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archive := func(reproducible bool) []byte {
+		r, err := archiveModule(root, "tar.gz", reproducible)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	first := archive(true)
+
+	// Touch the files to change their modification times
+	later := time.Now().Add(time.Hour)
+	for name := range files {
+		if err := os.Chtimes(filepath.Join(root, name), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assert.Equal(t, first, archive(true))
+	assert.NotEqual(t, first, archive(false))
+}
+
+func TestArchiveModule_zstd(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "main.tf"), []byte(`resource "null_resource" "example" {}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, moduleSpecFileName), []byte(`metadata { namespace = "acme" }`), 0o644))
+
+	archive := func() []byte {
+		r, err := archiveModule(root, "tar.zst", true)
+		require.NoError(t, err)
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return b
+	}
+	b := archive()
+	assert.Equal(t, b, archive(), "zstd archives must be reproducible")
+
+	// The archive passes the validation of uploads from a URL unchanged
+	validated, err := validateArchive(bytes.NewReader(b), "tar.zst")
+	require.NoError(t, err)
+	defer validated.Close()
+	passed, err := io.ReadAll(validated)
+	require.NoError(t, err)
+	assert.Equal(t, b, passed)
+
+	d, err := zstd.NewReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	defer d.Close()
+	tr := tar.NewReader(d)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+	}
+	assert.Equal(t, []string{moduleSpecFileName, "main.tf"}, names)
+
+	truncated, err := validateArchive(bytes.NewReader(b[:len(b)/2]), "tar.zst")
+	require.NoError(t, err)
+	defer truncated.Close()
+	_, err = io.ReadAll(truncated)
+	assert.Error(t, err)
+
+	// A gzip archive isn't accepted for the zstd format
+	_, err = validateArchive(bytes.NewReader(testModuleTarball(t)), "tar.zst")
+	assert.ErrorContains(t, err, "not a tar.zst archive")
+
+	_, err = archiveModule(root, "zip", true)
+	assert.Error(t, err)
+}
+
+// uploadingStorage consumes the uploaded archives like the storage backends do
+type uploadingStorage struct {
+	module.Storage
+	uploaded map[string][]byte
+}
+
+func (s *uploadingStorage) GetModule(context.Context, string, string, string, string) (core.Module, error) {
+	return core.Module{}, module.ErrModuleNotFound
+}
+
+func (s *uploadingStorage) UploadModule(_ context.Context, namespace, name, provider, version string, body io.Reader) (core.Module, error) {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return core.Module{}, fmt.Errorf("%v: %w", module.ErrModuleUploadFailed, err)
+	}
+	key := fmt.Sprintf("%s/%s/%s/%s", namespace, name, provider, version)
+	s.uploaded[key] = b
+	return core.Module{DownloadURL: key}, nil
+}
+
+func TestProcessModule_largeModule(t *testing.T) {
+	root := t.TempDir()
+	spec := `metadata {
+  namespace = "acme"
+  name      = "monorepo"
+  provider  = "aws"
+  version   = "1.0.0"
+}`
+	require.NoError(t, os.WriteFile(filepath.Join(root, moduleSpecFileName), []byte(spec), 0o644))
+
+	// Random content doesn't compress, so the archive is larger than the pipe buffers by far
+	files := make(map[string][]byte)
+	for i := 0; i < 16; i++ {
+		content := make([]byte, 1024*1024)
+		_, _ = rand.Read(content)
+		name := fmt.Sprintf("modules/m%02d/data.bin", i)
+		files[name] = content
+		require.NoError(t, os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), content, 0o644))
+	}
+
+	storage := &uploadingStorage{uploaded: make(map[string][]byte)}
+	require.NoError(t, processModule(filepath.Join(root, moduleSpecFileName), storage))
+
+	archive, ok := storage.uploaded["acme/monorepo/aws/1.0.0"]
+	require.True(t, ok)
+
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+	found := 0
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		if want, ok := files[header.Name]; ok {
+			assert.Equal(t, want, content, header.Name)
+			found++
+		}
+	}
+	assert.Equal(t, len(files), found)
+}
+
+func TestStreamArchive_error(t *testing.T) {
+	errWalk := errors.New("walk failed")
+	archive := streamArchive(func(w io.Writer) error {
+		if _, err := w.Write(bytes.Repeat([]byte("a"), 64*1024)); err != nil {
+			return err
+		}
+		return errWalk
+	})
+	defer archive.Close()
+
+	storage := &uploadingStorage{uploaded: make(map[string][]byte)}
+	_, err := storage.UploadModule(context.Background(), "acme", "monorepo", "aws", "1.0.0", archive)
+	assert.ErrorIs(t, err, errWalk)
+	assert.Empty(t, storage.uploaded)
+}
+
+func TestStreamArchive_closedEarly(t *testing.T) {
+	done := make(chan error, 1)
+	archive := streamArchive(func(w io.Writer) error {
+		for {
+			if _, err := w.Write(make([]byte, 1024)); err != nil {
+				done <- err
+				return err
+			}
+		}
+	})
+
+	// A failed upload stops reading, closing the archive must unblock the writer
+	_, err := io.ReadFull(archive, make([]byte, 10))
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, io.ErrClosedPipe)
+	case <-time.After(5 * time.Second):
+		t.Fatal("archiving didn't stop after the archive was closed")
+	}
+}
+
+func testModuleTarball(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	content := []byte(`resource "null_resource" "this" {}`)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "main.tf", Mode: 0o644, Size: int64(len(content))}))
+	_, err := tw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestProcessRemoteModule(t *testing.T) {
+	tarball := testModuleTarball(t)
+
+	tests := []struct {
+		name    string
+		body    []byte
+		status  int
+		wantErr bool
+	}{
+		{
+			name:   "tarball",
+			body:   tarball,
+			status: http.StatusOK,
+		},
+		{
+			name:    "not an archive",
+			body:    []byte("<html><body>Sign in</body></html>"),
+			status:  http.StatusOK,
+			wantErr: true,
+		},
+		{
+			name:    "truncated archive",
+			body:    tarball[:len(tarball)/2],
+			status:  http.StatusOK,
+			wantErr: true,
+		},
+		{
+			name:    "unauthorized",
+			status:  http.StatusUnauthorized,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer secret" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write(tt.body)
+			}))
+			defer server.Close()
+
+			headers, err := parseHeaders([]string{"Authorization: Bearer secret"})
+			require.NoError(t, err)
+
+			spec := &module.Spec{Metadata: module.Metadata{Namespace: "acme", Name: "vpc", Provider: "aws", Version: "1.0.0"}}
+			storage := &uploadingStorage{uploaded: make(map[string][]byte)}
+			err = processRemoteModule(context.Background(), spec, server.URL+"/vpc.tar.gz", headers, server.Client(), storage)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Empty(t, storage.uploaded)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tarball, storage.uploaded["acme/vpc/aws/1.0.0"])
+		})
+	}
+}
+
+// failingStorage fails the first uploads with err before it uploads like uploadingStorage
+type failingStorage struct {
+	uploadingStorage
+	err      error
+	failures int
+	attempts int
+}
+
+func (s *failingStorage) UploadModule(ctx context.Context, namespace, name, provider, version string, body io.Reader) (core.Module, error) {
+	s.attempts++
+	if s.attempts <= s.failures {
+		// A failed attempt consumes parts of the archive
+		_, _ = io.CopyN(io.Discard, body, 16)
+		return core.Module{}, s.err
+	}
+	return s.uploadingStorage.UploadModule(ctx, namespace, name, provider, version, body)
+}
+
+func TestProcessModule_retries(t *testing.T) {
+	retries, delay := flagUploadRetries, flagUploadRetryDelay
+	t.Cleanup(func() {
+		flagUploadRetries, flagUploadRetryDelay = retries, delay
+	})
+	flagUploadRetries, flagUploadRetryDelay = 2, time.Millisecond
+
+	root := t.TempDir()
+	spec := `metadata {
+  namespace = "acme"
+  name      = "vpc"
+  provider  = "aws"
+  version   = "1.0.0"
+}`
+	require.NoError(t, os.WriteFile(filepath.Join(root, moduleSpecFileName), []byte(spec), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "main.tf"), []byte(`resource "null_resource" "vpc" {}`), 0o644))
+
+	tests := []struct {
+		name         string
+		err          error
+		failures     int
+		wantAttempts int
+		wantUploaded bool
+		wantErr      error
+	}{
+		{
+			name:         "transient errors",
+			err:          fmt.Errorf("%v: %w", module.ErrModuleUploadFailed, syscall.ECONNRESET),
+			failures:     2,
+			wantAttempts: 3,
+			wantUploaded: true,
+		},
+		{
+			name:         "retries exhausted",
+			err:          fmt.Errorf("%v: %w", module.ErrModuleUploadFailed, core.ErrStorageTimeout),
+			failures:     3,
+			wantAttempts: 3,
+			wantErr:      core.ErrStorageTimeout,
+		},
+		{
+			name:         "permanent error",
+			err:          fmt.Errorf("%v: %w", module.ErrModuleUploadFailed, core.ErrForbidden),
+			failures:     1,
+			wantAttempts: 1,
+			wantErr:      core.ErrForbidden,
+		},
+		{
+			name:         "content mismatch",
+			err:          module.ErrModuleContentMismatch,
+			failures:     1,
+			wantAttempts: 1,
+			wantErr:      module.ErrModuleContentMismatch,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := &failingStorage{
+				uploadingStorage: uploadingStorage{uploaded: make(map[string][]byte)},
+				err:              tc.err,
+				failures:         tc.failures,
+			}
+
+			err := processModule(filepath.Join(root, moduleSpecFileName), storage)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantAttempts, storage.attempts)
+
+			archive, ok := storage.uploaded["acme/vpc/aws/1.0.0"]
+			assert.Equal(t, tc.wantUploaded, ok)
+			if tc.wantUploaded {
+				// The retried upload receives a complete archive
+				gr, err := gzip.NewReader(bytes.NewReader(archive))
+				require.NoError(t, err)
+				_, err = io.ReadAll(gr)
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
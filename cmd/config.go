@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configKeySeparator joins nested keys of the config file to the name of the corresponding flag
+const configKeySeparator = "-"
+
+// readConfigFile reads the YAML config file and returns its settings keyed by flag name.
+// Nested keys are joined with a dash, so that both of the following set the --auth-oidc-issuer flag:
+//
+//	auth:
+//	  oidc:
+//	    issuer: https://example.com
+//
+//	auth-oidc-issuer: https://example.com
+func readConfigFile(path string) (map[string]interface{}, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	settings := make(map[string]interface{})
+	flattenConfig("", v.AllSettings(), settings)
+	return settings, nil
+}
+
+func flattenConfig(prefix string, in map[string]interface{}, out map[string]interface{}) {
+	for key, value := range in {
+		if prefix != "" {
+			key = prefix + configKeySeparator + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenConfig(key, nested, out)
+			continue
+		}
+		out[key] = value
+	}
+}
+
+// applyConfigFile sets the flags to the values of the config file.
+// It must be called after bindFlags, so that flags set on the command line or by environment variables are already marked as changed and take precedence.
+func applyConfigFile(cmd *cobra.Command, settings map[string]interface{}) error {
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		value, ok := settings[f.Name]
+		if !ok || f.Changed || err != nil {
+			return
+		}
+		if setErr := setFlagValue(f, value); setErr != nil {
+			err = fmt.Errorf("invalid value for %s in config file: %w", f.Name, setErr)
+			return
+		}
+		// Setting the value directly doesn't mark the flag as changed like FlagSet.Set, which the effective configuration relies on
+		f.Changed = true
+	})
+	if err != nil {
+		return err
+	}
+
+	for key := range settings {
+		if cmd.Flags().Lookup(key) == nil {
+			slog.Debug("ignoring config file setting without a corresponding flag", slog.String("key", key))
+		}
+	}
+	return nil
+}
+
+func setFlagValue(f *pflag.Flag, value interface{}) error {
+	list, isList := value.([]interface{})
+	if sliceValue, ok := f.Value.(pflag.SliceValue); ok && isList {
+		values := make([]string, 0, len(list))
+		for _, item := range list {
+			values = append(values, fmt.Sprintf("%v", item))
+		}
+		return sliceValue.Replace(values)
+	}
+	if isList {
+		return fmt.Errorf("expected a single value, got a list")
+	}
+	return f.Value.Set(fmt.Sprintf("%v", value))
+}
+
+// redactedValue replaces the values of secretFlags when logging the configuration
+const redactedValue = "***"
+
+// secretFlags are the flags whose values are never logged
+var secretFlags = []string{
+	"auth-static-token",
+	"auth-static-token-hash",
+	"auth-static-token-ro",
+	"module-git-password",
+	"network-mirror-token",
+}
+
+// logEffectiveConfig logs the resolved configuration of the server at startup with the secrets redacted
+func logEffectiveConfig(cmd *cobra.Command) {
+	slog.Info("effective configuration", effectiveConfig(cmd)...)
+}
+
+// effectiveConfig summarizes the storage backend, the enabled features and the auth providers.
+// The flags that are set on the command line, by environment variables or in the config file are included as well.
+func effectiveConfig(cmd *cobra.Command) []any {
+	var bucket, prefix string
+	var signedURLExpiry time.Duration
+	switch storageType() {
+	case "s3":
+		bucket, prefix, signedURLExpiry = flagS3Bucket, flagS3Prefix, flagS3SignedURLExpiry
+	case "gcs":
+		bucket, prefix, signedURLExpiry = flagGCSBucket, flagGCSPrefix, flagGCSSignedURLExpiry
+	case "azure":
+		bucket, prefix, signedURLExpiry = flagAzureStorageAccount+"/"+flagAzureStorageContainer, flagAzureStoragePrefix, flagAzureStorageSignedURLExpiry
+	}
+
+	authProviders := []string{}
+	if len(flagAuthStaticTokens) > 0 || len(flagAuthStaticTokenHashes) > 0 || len(flagAuthStaticTokensRO) > 0 || flagAuthStaticTokenFile != "" {
+		authProviders = append(authProviders, "static")
+	}
+	if flagAuthOidcIssuer != "" {
+		authProviders = append(authProviders, "oidc")
+	}
+	if flagAuthOktaIssuer != "" {
+		authProviders = append(authProviders, "okta")
+	}
+
+	var changed []any
+	visit := func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		value := f.Value.String()
+		if slices.Contains(secretFlags, f.Name) {
+			value = redactedValue
+		}
+		changed = append(changed, slog.String(f.Name, value))
+	}
+	cmd.LocalFlags().VisitAll(visit)
+	cmd.InheritedFlags().VisitAll(visit)
+
+	return []any{
+		slog.Group("storage",
+			slog.String("backend", storageType()),
+			slog.String("bucket", bucket),
+			slog.String("prefix", prefix),
+			slog.String("signed_url_expiry", signedURLExpiry.String()),
+		),
+		slog.Group("features",
+			slog.Bool("modules", !flagDisableModules),
+			slog.Bool("providers", !flagDisableProviders),
+			slog.Bool("download_proxy", flagProxy),
+			slog.Bool("network_mirror", flagProviderNetworkMirrorEnabled),
+			slog.Bool("pull_through_mirror", flagProviderNetworkMirrorEnabled && flagProviderNetworkMirrorPullThroughEnabled),
+			slog.Bool("anonymous_read", flagAllowAnonymousRead),
+		),
+		slog.Any("auth_providers", authProviders),
+		slog.Group("flags", changed...),
+	}
+}
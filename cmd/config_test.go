@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleConfig = `
+debug: true
+storage:
+  s3:
+    bucket: boring-registry
+    region: eu-central-1
+    signedurl-expiry: 10m
+auth:
+  oidc:
+    issuer: https://accounts.example.com
+    clientid: boring-registry
+    scopes:
+      - openid
+      - offline_access
+    required-claim:
+      - groups=platform
+  static-token: [ci-token]
+download-proxy: true
+unknown-setting: ignored
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// resetServerFlags restores the defaults of the flags, which are package-level variables shared between tests
+func resetServerFlags(t *testing.T) {
+	t.Cleanup(func() { resetFlags(serverCmd.Flags()) })
+}
+
+// resetRootFlags restores the defaults of the persistent flags, like the storage flags
+func resetRootFlags(t *testing.T) {
+	t.Cleanup(func() { resetFlags(rootCmd.PersistentFlags()) })
+}
+
+func resetFlags(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			defaults := strings.Trim(f.DefValue, "[]")
+			if defaults == "" {
+				_ = s.Replace([]string{})
+			} else {
+				_ = s.Replace(strings.Split(defaults, ","))
+			}
+		} else {
+			_ = f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+}
+
+func TestReadConfigFile(t *testing.T) {
+	settings, err := readConfigFile(writeConfig(t, sampleConfig))
+	require.NoError(t, err)
+
+	assert.Equal(t, "boring-registry", settings["storage-s3-bucket"])
+	assert.Equal(t, "https://accounts.example.com", settings["auth-oidc-issuer"])
+	assert.Equal(t, []interface{}{"openid", "offline_access"}, settings["auth-oidc-scopes"])
+	assert.Equal(t, true, settings["download-proxy"])
+
+	_, err = readConfigFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestInitializeConfig(t *testing.T) {
+	resetServerFlags(t)
+
+	require.NoError(t, serverCmd.ParseFlags([]string{
+		"--config", writeConfig(t, sampleConfig),
+		"--storage-s3-region", "us-east-1",
+	}))
+	t.Setenv("BORING_REGISTRY_AUTH_OIDC_CLIENTID", "from-env")
+	t.Setenv("BORING_REGISTRY_STORAGE_S3_REGION", "eu-west-1")
+
+	require.NoError(t, initializeConfig(serverCmd))
+
+	assert.True(t, flagDebug)
+	assert.True(t, flagProxy)
+	assert.Equal(t, "boring-registry", flagS3Bucket)
+	assert.Equal(t, 10*time.Minute, flagS3SignedURLExpiry)
+	// Flags take precedence over environment variables, which take precedence over the config file
+	assert.Equal(t, "us-east-1", flagS3Region)
+	assert.Equal(t, "from-env", flagAuthOidcClientId)
+
+	assert.Equal(t, "https://accounts.example.com", flagAuthOidcIssuer)
+	assert.Equal(t, []string{"openid", "offline_access"}, flagAuthOidcScopes)
+	assert.Equal(t, []string{"groups=platform"}, flagAuthOidcRequiredClaims)
+	assert.Equal(t, []string{"ci-token"}, flagAuthStaticTokens)
+}
+
+func TestInitializeConfig_invalidValue(t *testing.T) {
+	resetServerFlags(t)
+
+	require.NoError(t, serverCmd.ParseFlags([]string{
+		"--config", writeConfig(t, "storage-s3-signedurl-expiry: [5m, 10m]\n"),
+	}))
+	assert.ErrorContains(t, initializeConfig(serverCmd), "storage-s3-signedurl-expiry")
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	resetServerFlags(t)
+	resetRootFlags(t)
+
+	require.NoError(t, serverCmd.ParseFlags([]string{
+		"--storage-s3-bucket", "boring-registry",
+		"--storage-s3-prefix", "registry",
+		"--auth-static-token", "very-secret-token",
+		"--module-git-password", "very-secret-password",
+		"--auth-oidc-issuer", "https://accounts.example.com",
+		"--network-mirror",
+	}))
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("effective configuration", effectiveConfig(serverCmd)...)
+	var logged map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+
+	assert.NotContains(t, buf.String(), "very-secret-token")
+	assert.NotContains(t, buf.String(), "very-secret-password")
+	flags := logged["flags"].(map[string]interface{})
+	assert.Equal(t, redactedValue, flags["auth-static-token"])
+	assert.Equal(t, redactedValue, flags["module-git-password"])
+	assert.Equal(t, "https://accounts.example.com", flags["auth-oidc-issuer"])
+	assert.Equal(t, "boring-registry", flags["storage-s3-bucket"])
+	assert.NotContains(t, flags, "storage-gcs-bucket")
+
+	storage := logged["storage"].(map[string]interface{})
+	assert.Equal(t, "s3", storage["backend"])
+	assert.Equal(t, "boring-registry", storage["bucket"])
+	assert.Equal(t, "registry", storage["prefix"])
+	assert.Equal(t, true, logged["features"].(map[string]interface{})["network_mirror"])
+	assert.Equal(t, []interface{}{"static", "oidc"}, logged["auth_providers"])
+}
+
+func TestEffectiveConfig_configFile(t *testing.T) {
+	resetServerFlags(t)
+	resetRootFlags(t)
+
+	require.NoError(t, serverCmd.ParseFlags([]string{"--config", writeConfig(t, sampleConfig)}))
+	require.NoError(t, initializeConfig(serverCmd))
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("effective configuration", effectiveConfig(serverCmd)...)
+	var logged map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+
+	// The values of the config file are logged like flags, including the redaction of secrets
+	assert.NotContains(t, buf.String(), "ci-token")
+	flags := logged["flags"].(map[string]interface{})
+	assert.Equal(t, "boring-registry", flags["storage-s3-bucket"])
+	assert.Equal(t, "https://accounts.example.com", flags["auth-oidc-issuer"])
+	assert.Equal(t, "[openid,offline_access]", flags["auth-oidc-scopes"])
+	assert.Equal(t, redactedValue, flags["auth-static-token"])
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/mirror"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultImportHostname = "registry.terraform.io"
+
+var (
+	// import provider flags
+	flagImportProviderPlatforms []string
+)
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.AddCommand(importProviderCmd)
+
+	importProviderCmd.Flags().StringSliceVar(&flagImportProviderPlatforms, "platforms", nil, "Only import the given platforms in the <os>_<arch> format, e.g. linux_amd64. All platforms are imported by default")
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import artifacts from an upstream registry into the storage backend",
+}
+
+var importProviderCmd = &cobra.Command{
+	Use:   "provider [HOSTNAME/]NAMESPACE/NAME@VERSION",
+	Short: "Import a provider version from an upstream registry into the provider registry",
+	Long: `Import a provider version from an upstream registry into the provider registry.
+The archives, the SHA256SUMS file and its signature are downloaded from the upstream registry and verified with the upstream signing keys.
+The files are stored like uploaded providers under the same namespace and the upstream signing keys are added to the signing keys of the namespace.
+The hostname defaults to registry.terraform.io.`,
+	Example:      "  boring-registry import provider hashicorp/aws@5.0.0 --platforms linux_amd64,darwin_arm64",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         importProvider,
+}
+
+func importProvider(cmd *cobra.Command, args []string) error {
+	if err := validatePlatforms(flagImportProviderPlatforms); err != nil {
+		return err
+	}
+	p, err := parseProviderCoordinate(args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	storageBackend, err := setupStorage(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to set up storage: %w", err)
+	}
+
+	upstreamOpts, err := mirrorUpstreamOptions()
+	if err != nil {
+		return err
+	}
+	importer, err := mirror.NewImporter(storageBackend, flagImportProviderPlatforms, upstreamOpts...)
+	if err != nil {
+		return err
+	}
+	if err := importer.Import(ctx, p); err != nil {
+		return fmt.Errorf("failed to import provider %s: %w", args[0], err)
+	}
+	slog.Info("imported provider", slog.String("hostname", p.Hostname), slog.String("namespace", p.Namespace), slog.String("name", p.Name), slog.String("version", p.Version))
+	return nil
+}
+
+// parseProviderCoordinate parses a provider in the [<hostname>/]<namespace>/<name>@<version> format
+func parseProviderCoordinate(coordinate string) (*core.Provider, error) {
+	source, version, found := strings.Cut(coordinate, "@")
+	if !found || version == "" {
+		return nil, fmt.Errorf("provider %s is invalid, expected the [<hostname>/]<namespace>/<name>@<version> format", coordinate)
+	}
+
+	parts := strings.Split(source, "/")
+	if len(parts) == 2 {
+		parts = append([]string{defaultImportHostname}, parts...)
+	}
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("provider %s is invalid, expected the [<hostname>/]<namespace>/<name>@<version> format", coordinate)
+	}
+
+	return &core.Provider{
+		Hostname:  parts[0],
+		Namespace: parts[1],
+		Name:      parts[2],
+		Version:   strings.TrimPrefix(version, "v"),
+	}, nil
+}
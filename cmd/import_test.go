@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProviderCoordinate(t *testing.T) {
+	tests := []struct {
+		coordinate string
+		want       *core.Provider
+		wantErr    bool
+	}{
+		{
+			coordinate: "hashicorp/aws@5.0.0",
+			want:       &core.Provider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "aws", Version: "5.0.0"},
+		},
+		{
+			coordinate: "terraform.example.com/acme/dummy@v1.2.3",
+			want:       &core.Provider{Hostname: "terraform.example.com", Namespace: "acme", Name: "dummy", Version: "1.2.3"},
+		},
+		{coordinate: "hashicorp/aws", wantErr: true},
+		{coordinate: "hashicorp/aws@", wantErr: true},
+		{coordinate: "aws@5.0.0", wantErr: true},
+		{coordinate: "a/b/c/d@5.0.0", wantErr: true},
+		{coordinate: "hashicorp//aws@5.0.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.coordinate, func(t *testing.T) {
+			got, err := parseProviderCoordinate(tt.coordinate)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+
+	"github.com/boring-registry/boring-registry/pkg/mirror"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// mirror export flags
+	flagMirrorExportPlatforms         []string
+	flagMirrorExportProvidersHostname string
+
+	// mirror seed flags
+	flagMirrorSeedPlatforms []string
+
+	// mirror gc flags
+	flagMirrorGCDryRun bool
+
+	// mirror verify flags
+	flagMirrorVerifyRepair bool
+)
+
+func init() {
+	rootCmd.AddCommand(mirrorCmd)
+	mirrorCmd.AddCommand(mirrorExportCmd)
+	mirrorCmd.AddCommand(mirrorSeedCmd)
+	mirrorCmd.AddCommand(mirrorGCCmd)
+	mirrorCmd.AddCommand(mirrorVerifyCmd)
+
+	mirrorExportCmd.Flags().StringSliceVar(&flagMirrorExportPlatforms, "platforms", nil, "Only export the given platforms in the <os>_<arch> format, e.g. linux_amd64. All platforms are exported by default")
+	mirrorExportCmd.Flags().StringVar(&flagMirrorExportProvidersHostname, "providers-hostname", "", "Also export the internal providers under the hostname of the boring-registry, e.g. registry.example.com")
+	mirrorSeedCmd.Flags().StringSliceVar(&flagMirrorSeedPlatforms, "platforms", nil, "Only copy the given platforms in the <os>_<arch> format, e.g. linux_amd64. All platforms are copied by default")
+	mirrorGCCmd.Flags().BoolVar(&flagMirrorGCDryRun, "dry-run", false, "Only log the orphaned files instead of deleting them")
+	mirrorVerifyCmd.Flags().BoolVar(&flagMirrorVerifyRepair, "repair", false, "Copy the mismatching archives from upstream again")
+}
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Manage the provider network mirror",
+}
+
+var mirrorExportCmd = &cobra.Command{
+	Use:   "export DIR",
+	Short: "Export all mirrored providers into a local filesystem mirror",
+	Long: `Export all mirrored providers into a local filesystem mirror.
+
+The internal providers are exported as well when --providers-hostname is set,
+under the hostname that Terraform uses to install them from the boring-registry.`,
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	RunE:         exportMirror,
+}
+
+var mirrorSeedCmd = &cobra.Command{
+	Use:          "seed LOCK_FILE",
+	Short:        "Copy the providers of a dependency lock file into the provider network mirror",
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	RunE:         seedMirror,
+}
+
+var mirrorGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete orphaned files of incomplete provider releases from the provider network mirror",
+	Long: `Delete orphaned files of incomplete provider releases from the provider network mirror.
+A release is complete if the SHA256SUMS file, its signature and the archives listed in the SHA256SUMS file are present.
+All files of releases without a SHA256SUMS file or signature are deleted, as well as archives that aren't listed in the SHA256SUMS file.`,
+	SilenceUsage: true,
+	Args:         cobra.NoArgs,
+	RunE:         collectMirrorGarbage,
+}
+
+var mirrorVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the mirrored archives against the upstream SHA256SUMS files",
+	Long: `Verify the mirrored archives against the upstream SHA256SUMS files.
+The checksum of every mirrored archive and its entry in the mirrored SHA256SUMS file are compared with the upstream SHA256SUMS file.
+With --repair, mismatching archives are copied from upstream again together with the SHA256SUMS file, its signature and the signing keys.
+The command fails if any mismatch remains.`,
+	SilenceUsage: true,
+	Args:         cobra.NoArgs,
+	RunE:         verifyMirror,
+}
+
+func verifyMirror(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storageBackend, err := setupStorage(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to set up storage: %w", err)
+	}
+
+	upstreamOpts, err := mirrorUpstreamOptions()
+	if err != nil {
+		return err
+	}
+	verifier := mirror.NewVerifier(storageBackend, mirror.NewCopier(ctx, storageBackend, upstreamOpts...), flagMirrorVerifyRepair, upstreamOpts...)
+	mismatches, err := verifier.Verify(ctx)
+	if err != nil {
+		return err
+	}
+
+	unrepaired := 0
+	for _, m := range mismatches {
+		if !m.Repaired {
+			unrepaired++
+		}
+	}
+	slog.Info("finished verification", slog.Int("mismatches", len(mismatches)), slog.Int("repaired", len(mismatches)-unrepaired))
+	if unrepaired > 0 {
+		return fmt.Errorf("%d mirrored archives don't match upstream", unrepaired)
+	}
+	return nil
+}
+
+func collectMirrorGarbage(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	storageBackend, err := setupStorage(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to set up storage: %w", err)
+	}
+
+	orphans, err := mirror.NewGarbageCollector(storageBackend, mirror.WithDryRun(flagMirrorGCDryRun)).Collect(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("finished garbage collection", slog.Int("orphaned_files", len(orphans)), slog.Bool("dry_run", flagMirrorGCDryRun))
+	return nil
+}
+
+func exportMirror(cmd *cobra.Command, args []string) error {
+	if err := validatePlatforms(flagMirrorExportPlatforms); err != nil {
+		return err
+	}
+
+	dir := args[0]
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	ctx := context.Background()
+	storageBackend, err := setupStorage(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to set up storage: %w", err)
+	}
+
+	opts := []mirror.ExporterOption{mirror.WithExportPlatforms(flagMirrorExportPlatforms)}
+	if flagMirrorExportProvidersHostname != "" {
+		opts = append(opts, mirror.WithInternalProviders(storageBackend, flagMirrorExportProvidersHostname))
+	}
+	exporter := mirror.NewExporter(storageBackend, opts...)
+	return exporter.Export(ctx, dir)
+}
+
+func seedMirror(cmd *cobra.Command, args []string) error {
+	if err := validatePlatforms(flagMirrorSeedPlatforms); err != nil {
+		return err
+	}
+
+	src, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read lock file: %w", err)
+	}
+	providers, err := mirror.ParseLockFile(args[0], src)
+	if err != nil {
+		return fmt.Errorf("failed to parse lock file: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storageBackend, err := setupStorage(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to set up storage: %w", err)
+	}
+
+	upstreamOpts, err := mirrorUpstreamOptions()
+	if err != nil {
+		return err
+	}
+	seeder, err := mirror.NewSeeder(storageBackend, mirror.NewCopier(ctx, storageBackend, upstreamOpts...), flagMirrorSeedPlatforms, upstreamOpts...)
+	if err != nil {
+		return err
+	}
+	return seeder.Seed(ctx, providers)
+}
+
+// validatePlatforms checks that platforms are in the <os>_<arch> format
+func validatePlatforms(platforms []string) error {
+	r := regexp.MustCompile("^[a-z0-9]+_[a-z0-9]+$")
+	for _, p := range platforms {
+		if !r.MatchString(p) {
+			return fmt.Errorf("platform %s is invalid, expected the <os>_<arch> format", p)
+		}
+	}
+	return nil
+}
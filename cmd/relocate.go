@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/boring-registry/boring-registry/pkg/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagRelocateDeleteSource bool
+	flagRelocateDryRun       bool
+)
+
+func init() {
+	rootCmd.AddCommand(relocateCmd)
+
+	relocateCmd.Flags().BoolVar(&flagRelocateDeleteSource, "delete-source", false, "Delete every object after it has been copied")
+	relocateCmd.Flags().BoolVar(&flagRelocateDryRun, "dry-run", false, "Only log the objects that would be copied")
+}
+
+var relocateCmd = &cobra.Command{
+	Use:   "relocate TARGET_PREFIX",
+	Short: "Copy all objects under the storage prefix to another prefix of the same bucket",
+	Long: `Copy all objects under the storage prefix to another prefix of the same bucket or container.
+The source is the prefix of the storage backend flags, e.g. --storage-s3-prefix, and an empty TARGET_PREFIX copies the objects to the root of the bucket.
+The objects are copied server-side and every copy is verified by comparing its checksum or ETag with the source object.
+With --delete-source, every object is deleted once its copy has been verified.`,
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		storageBackend, err := setupStorage(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to set up storage: %w", err)
+		}
+
+		relocated, err := storage.Relocate(ctx, storageBackend, args[0], storage.RelocateOptions{
+			DeleteSource: flagRelocateDeleteSource,
+			DryRun:       flagRelocateDryRun,
+		})
+		if err != nil {
+			return err
+		}
+		slog.Info("finished relocation", slog.Int("objects", relocated), slog.String("target_prefix", args[0]), slog.Bool("dry_run", flagRelocateDryRun))
+		return nil
+	},
+}
@@ -7,6 +7,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/requestid"
+	"github.com/boring-registry/boring-registry/pkg/storage"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -18,28 +22,49 @@ const (
 )
 
 var (
-	flagJSON  bool
-	flagDebug bool
+	flagConfig string
+	flagJSON   bool
+	flagDebug  bool
 
 	// S3 options.
-	flagS3Bucket          string
-	flagS3Prefix          string
-	flagS3Region          string
-	flagS3Endpoint        string
-	flagS3PathStyle       bool
-	flagS3SignedURLExpiry time.Duration
+	flagS3Bucket             string
+	flagS3Prefix             string
+	flagS3Region             string
+	flagS3Endpoint           string
+	flagS3PathStyle          bool
+	flagS3PresignConcurrency int
+	flagS3SignedURLExpiry    time.Duration
+	flagS3ObjectACL          string
 
 	// GCS options.
 	flagGCSBucket          string
 	flagGCSPrefix          string
 	flagGCSServiceAccount  string
 	flagGCSSignedURLExpiry time.Duration
+	flagGCSObjectACL       string
 
 	// Azure Storage
 	flagAzureStorageAccount         string
 	flagAzureStorageContainer       string
 	flagAzureStoragePrefix          string
 	flagAzureStorageSignedURLExpiry time.Duration
+	flagStorageExistenceCacheTTL    time.Duration
+	flagStorageRetryMaxAttempts     int
+	flagStorageOperationTimeout     time.Duration
+	flagStorageSignedURLHeadroom    time.Duration
+	flagStorageListPageSize         int
+	flagModuleArchiveFormat         string
+	flagModuleArchiveAllowZstd      bool
+
+	// Provider signing keys
+	flagDefaultSigningKeysNamespace string
+
+	// TLS options of the connections to upstream registries
+	flagTLSCACertFiles        []string
+	flagTLSInsecureSkipVerify bool
+
+	// User-Agent of the requests to upstream registries and other remote servers
+	flagOutboundUserAgent string
 )
 
 var rootCmd = &cobra.Command{
@@ -68,6 +93,7 @@ func Execute() {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&flagConfig, "config", "", "Path to a YAML config file, which provides defaults for all other flags")
 	rootCmd.PersistentFlags().BoolVar(&flagJSON, "json", false, "Enable json logging")
 	rootCmd.PersistentFlags().BoolVar(&flagDebug, "debug", false, "Enable debug logging")
 	rootCmd.PersistentFlags().StringVar(&flagS3Bucket, "storage-s3-bucket", "", "S3 bucket to use for the registry")
@@ -76,16 +102,30 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&flagS3Endpoint, "storage-s3-endpoint", "", "S3 bucket endpoint URL (required for MINIO)")
 	rootCmd.PersistentFlags().BoolVar(&flagS3PathStyle, "storage-s3-pathstyle", false, "S3 use PathStyle (required for MINIO)")
 	rootCmd.PersistentFlags().DurationVar(&flagS3SignedURLExpiry, "storage-s3-signedurl-expiry", 5*time.Minute, "Generate S3 signed URL valid for X seconds.")
+	rootCmd.PersistentFlags().IntVar(&flagS3PresignConcurrency, "storage-s3-presign-concurrency", storage.DefaultPresignConcurrency, "Number of download URLs that are presigned concurrently when listing module and provider versions")
+	rootCmd.PersistentFlags().StringVar(&flagS3ObjectACL, "storage-s3-object-acl", storage.ObjectACLPrivate, "Canned ACL of uploaded objects, either private or public-read. Objects are readable anonymously with public-read, e.g. by a CDN in front of the bucket")
 	rootCmd.PersistentFlags().StringVar(&flagGCSBucket, "storage-gcs-bucket", "", "Bucket to use when using the GCS registry type")
 	rootCmd.PersistentFlags().StringVar(&flagGCSPrefix, "storage-gcs-prefix", "", "Prefix to use when using the GCS registry type")
 	rootCmd.PersistentFlags().StringVar(&flagGCSServiceAccount, "storage-gcs-sa-email", "", `Google service account email to be used for Application Default Credentials (ADC).
 GOOGLE_APPLICATION_CREDENTIALS environment variable might be used as alternative.
 For GCS presigned URLs this SA needs the iam.serviceAccountTokenCreator role.`)
 	rootCmd.PersistentFlags().DurationVar(&flagGCSSignedURLExpiry, "storage-gcs-signedurl-expiry", 30*time.Second, "Generate GCS signed URL valid for X seconds.")
+	rootCmd.PersistentFlags().StringVar(&flagGCSObjectACL, "storage-gcs-object-acl", storage.ObjectACLPrivate, "Predefined ACL of uploaded objects, either private or public-read. Objects are readable anonymously with public-read, e.g. by a CDN in front of the bucket")
 	rootCmd.PersistentFlags().StringVar(&flagAzureStorageAccount, "storage-azure-account", "", "Azure Storage Account to use for the registry")
 	rootCmd.PersistentFlags().StringVar(&flagAzureStorageContainer, "storage-azure-container", "", "Azure Storage Container to use for the registry")
 	rootCmd.PersistentFlags().StringVar(&flagAzureStoragePrefix, "storage-azure-prefix", "", "Azure Storage prefix to use for the registry")
 	rootCmd.PersistentFlags().DurationVar(&flagAzureStorageSignedURLExpiry, "storage-azure-signedurl-expiry", 5*time.Minute, "Generate Azure Storage signed URL valid for X seconds.")
+	rootCmd.PersistentFlags().DurationVar(&flagStorageExistenceCacheTTL, "storage-existence-cache-ttl", storage.DefaultExistenceCacheTTL, "Duration for which the existence of an object in the storage backend is cached. Set to 0 to disable the cache")
+	rootCmd.PersistentFlags().IntVar(&flagStorageRetryMaxAttempts, "storage-retry-max-attempts", storage.DefaultRetryMaxAttempts, "Number of attempts for requests to the storage backend failing with transient errors, including the first attempt")
+	rootCmd.PersistentFlags().StringVar(&flagModuleArchiveFormat, "storage-module-archive-format", storage.DefaultModuleArchiveFormat, fmt.Sprintf("Archive file format for modules, specified without the leading dot. One of: %s. tar.zst requires --storage-module-archive-allow-zstd", strings.Join(storage.ModuleArchiveFormats, ", ")))
+	rootCmd.PersistentFlags().BoolVar(&flagModuleArchiveAllowZstd, "storage-module-archive-allow-zstd", false, "Allow the tar.zst module archive format. Terraform and OpenTofu can't extract tar.zst archives, only clients that use go-getter directly can install these modules")
+	rootCmd.PersistentFlags().DurationVar(&flagStorageSignedURLHeadroom, "storage-signedurl-min-headroom", storage.DefaultSignedURLHeadroom, "Minimum validity of the signed URLs of downloads through the download proxy, which the proxy fetches later than redirected clients")
+	rootCmd.PersistentFlags().DurationVar(&flagStorageOperationTimeout, "storage-operation-timeout", storage.DefaultOperationTimeout, "Maximum duration of an operation against the storage backend, uploads are not limited. Set to 0 to disable the timeout")
+	rootCmd.PersistentFlags().IntVar(&flagStorageListPageSize, "storage-list-page-size", 0, fmt.Sprintf("Number of keys requested per page when listing the storage backend, at most %d. Set to 0 to keep the default page size of the storage backend", storage.MaxListPageSize))
+	rootCmd.PersistentFlags().StringVar(&flagDefaultSigningKeysNamespace, "default-signing-keys-namespace", "", "Namespace whose signing keys are served for providers of namespaces without signing keys, e.g. for a single organization-wide GPG key")
+	rootCmd.PersistentFlags().StringSliceVar(&flagTLSCACertFiles, "tls-ca-cert-file", nil, "PEM file with additional root CA certificates that are trusted for connections to upstream registries, e.g. of a private CA. Can be repeated")
+	rootCmd.PersistentFlags().BoolVar(&flagTLSInsecureSkipVerify, "tls-insecure-skip-verify", false, "Don't verify the certificates of upstream registries. Only use this for development, connections are open to man-in-the-middle attacks")
+	rootCmd.PersistentFlags().StringVar(&flagOutboundUserAgent, "outbound-user-agent", core.DefaultUserAgent(), "User-Agent header of the requests to upstream registries, Git servers, module source URLs and the OIDC issuer. Set to an empty string to send Go's default")
 }
 
 func initializeConfig(cmd *cobra.Command) error {
@@ -93,7 +133,16 @@ func initializeConfig(cmd *cobra.Command) error {
 	v.SetEnvPrefix(envPrefix)
 	v.AutomaticEnv()
 	bindFlags(cmd, v)
-	return nil
+
+	// The path of the config file itself can be set by the flag or the environment variable, so it's only known after binding the flags
+	if flagConfig == "" {
+		return nil
+	}
+	settings, err := readConfigFile(flagConfig)
+	if err != nil {
+		return err
+	}
+	return applyConfigFile(cmd, settings)
 }
 
 func setupLogger() {
@@ -113,7 +162,7 @@ func setupLogger() {
 	if hostname, err := os.Hostname(); err == nil {
 		handler = handler.WithAttrs([]slog.Attr{slog.String("hostname", hostname)})
 	}
-	slog.SetDefault(slog.New(handler))
+	slog.SetDefault(slog.New(requestid.NewLogHandler(handler)))
 }
 
 func bindFlags(cmd *cobra.Command, v *viper.Viper) {
@@ -6,26 +6,43 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	"os"
 	"os/signal"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/boring-registry/boring-registry/pkg/admin"
+	"github.com/boring-registry/boring-registry/pkg/audit"
 	"github.com/boring-registry/boring-registry/pkg/auth"
+	"github.com/boring-registry/boring-registry/pkg/catalog"
+	"github.com/boring-registry/boring-registry/pkg/compression"
 	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/debug"
 	"github.com/boring-registry/boring-registry/pkg/discovery"
+	"github.com/boring-registry/boring-registry/pkg/health"
 	"github.com/boring-registry/boring-registry/pkg/mirror"
 	"github.com/boring-registry/boring-registry/pkg/module"
 	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+	"github.com/boring-registry/boring-registry/pkg/openapi"
 	"github.com/boring-registry/boring-registry/pkg/provider"
 	"github.com/boring-registry/boring-registry/pkg/proxy"
+	"github.com/boring-registry/boring-registry/pkg/ratelimit"
+	"github.com/boring-registry/boring-registry/pkg/requestid"
 	"github.com/boring-registry/boring-registry/pkg/storage"
+	"github.com/boring-registry/boring-registry/version"
 
 	"github.com/go-kit/kit/endpoint"
 	httptransport "github.com/go-kit/kit/transport/http"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
@@ -35,36 +52,94 @@ const (
 	apiVersion = "v1"
 )
 
+// auditLoggerCloseTimeout bounds the final flush of the audit events during the shutdown
+const auditLoggerCloseTimeout = 10 * time.Second
+
 var (
 	prefix          = fmt.Sprintf("/%s", apiVersion)
 	prefixModules   = fmt.Sprintf("%s/modules", prefix)
 	prefixProviders = fmt.Sprintf("%s/providers", prefix)
 	prefixMirror    = fmt.Sprintf("%s/mirror", prefix)
 	prefixProxy     = fmt.Sprintf("%s/proxy", prefix)
+	prefixCatalog   = fmt.Sprintf("%s/catalog", prefix)
+	prefixDebug     = fmt.Sprintf("%s/debug", prefix)
+	prefixAdmin     = fmt.Sprintf("%s/admin", prefix)
 )
 
 var (
 	// Proxy options
-	flagProxy bool
+	flagProxy              bool
+	flagProxyVerify        bool
+	flagProxyMaxConcurrent int
+	flagProxyQueueTimeout  time.Duration
+
+	// Git module options
+	flagModuleGitBaseURL           string
+	flagModuleGitRepositoryPattern string
+	flagModuleGitUsername          string
+	flagModuleGitPassword          string
+	flagModuleGitTimeout           time.Duration
+	flagModuleGitTagCacheTTL       time.Duration
 
 	// General server options
 	flagTLSCertFile         string
 	flagTLSKeyFile          string
 	flagListenAddr          string
 	flagTelemetryListenAddr string
-	flagModuleArchiveFormat string
+	flagHealthCheckTimeout  time.Duration
+	flagCatalogCacheTTL     time.Duration
+	flagEnableStorageDebug  bool
+	flagHTTPReadTimeout     time.Duration
+	flagHTTPWriteTimeout    time.Duration
+	flagHTTPIdleTimeout     time.Duration
+	flagMaxUploadSize       int64
+	flagShutdownGracePeriod time.Duration
+	flagCompressResponses   bool
+	flagCompressMinSize     int
+	flagRateLimitRPS        float64
+	flagRateLimitBurst      int
+	flagTrustedProxies      []string
+	flagAllowedPlatforms    []string
+	flagDefaultOS           string
+	flagDefaultArch         string
+	flagHostStoragePrefixes []string
+	flagAllowAnonymousRead  bool
+	flagDisableModules      bool
+	flagDisableProviders    bool
+
+	// Provider options
+	flagProvidersUnionMirror         bool
+	flagProvidersUnionMirrorHostname string
 
 	// Login options
 	flagLoginGrantTypes []string
 	flagLoginPorts      []int
+	flagLoginDeviceCode bool
+
+	// Audit options
+	flagAuditLogger         string
+	flagAuditFilePath       string
+	flagAuditFileMaxSizeMB  int
+	flagAuditFileMaxBackups int
+	flagAuditGCSBucket      string
+	flagAuditGCSPrefix      string
+	flagAuditBatchSize      int
+	flagAuditFlushInterval  time.Duration
 
 	// Static auth
-	flagAuthStaticTokens []string
+	flagAuthStaticTokens      []string
+	flagAuthStaticTokensRO    []string
+	flagAuthStaticTokenHashes []string
+	flagAuthStaticTokenFile   string
 
 	// OIDC auth
-	flagAuthOidcIssuer   string
-	flagAuthOidcClientId string
-	flagAuthOidcScopes   []string
+	flagAuthOidcIssuer              string
+	flagAuthOidcClientId            string
+	flagAuthOidcScopes              []string
+	flagAuthOidcJWKSRefreshInterval time.Duration
+	flagAuthOidcRequiredClaims      []string
+	flagAuthOidcNamespaceClaims     []string
+	flagNamespaceACLFile            string
 
 	// Okta auth
 	flagAuthOktaIssuer   string
@@ -77,33 +152,66 @@ var (
 	// Provider Network Mirror
 	flagProviderNetworkMirrorEnabled            bool
 	flagProviderNetworkMirrorPullThroughEnabled bool
+	flagProviderNetworkMirrorPrewarm            []string
+	flagProviderNetworkMirrorPrewarmInterval    time.Duration
+	flagProviderNetworkMirrorUpstreamRetries    int
+	flagProviderNetworkMirrorVerifySignatures   bool
+	flagProviderNetworkMirrorTokens             []string
+	flagProviderNetworkMirrorCopyEndpoint       bool
 )
 
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Starts the server component",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		logEffectiveConfig(cmd)
+
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
 		group, ctx := errgroup.WithContext(ctx)
 
-		mux, err := serveMux(ctx)
+		hostPrefixes, err := parseHostStoragePrefixes(flagHostStoragePrefixes)
+		if err != nil {
+			return err
+		}
+
+		auditLogger, err := setupAuditLogger(ctx)
 		if err != nil {
+			return fmt.Errorf("failed to setup audit logger: %w", err)
+		}
+
+		mux, err := serveMux(ctx, auditLogger)
+		if err != nil {
+			_ = auditLogger.Close(context.Background())
 			return fmt.Errorf("failed to setup server: %w", err)
 		}
 
+		var handler http.Handler = mux
+		if flagCompressResponses {
+			handler = compression.Middleware(flagCompressMinSize)(mux)
+		}
+		handler = limitRequestBody(flagMaxUploadSize)(handler)
+		handler = routeHosts(hostPrefixes)(handler)
+		handler = requestid.Middleware(handler)
+		inFlight := &inFlightRequests{}
+		handler = inFlight.middleware(handler)
+		// Proxied downloads of large archives take longer than the write timeout
+		handler = clearWriteDeadline(prefixProxy)(handler)
+
 		server := &http.Server{
 			Addr:         flagListenAddr,
-			ReadTimeout:  5 * time.Second,
-			WriteTimeout: 5 * time.Second,
-			Handler:      mux,
+			ReadTimeout:  flagHTTPReadTimeout,
+			WriteTimeout: flagHTTPWriteTimeout,
+			IdleTimeout:  flagHTTPIdleTimeout,
+			Handler:      handler,
 		}
 
 		telemetryServer := &http.Server{
 			Addr:         flagTelemetryListenAddr,
-			ReadTimeout:  5 * time.Second,
-			WriteTimeout: 5 * time.Second,
+			ReadTimeout:  flagHTTPReadTimeout,
+			WriteTimeout: flagHTTPWriteTimeout,
+			IdleTimeout:  flagHTTPIdleTimeout,
 			Handler:      mux,
 		}
 
@@ -125,16 +233,29 @@ var serverCmd = &cobra.Command{
 		group.Go(func() error {
 			<-ctx.Done()
 
-			if err := server.Shutdown(ctx); err != nil {
-				if err != context.Canceled {
+			// ctx is already cancelled, the servers are shut down with a fresh context to let in-flight requests finish.
+			// Both servers share the grace period, so that the shutdown doesn't take longer than configured
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), flagShutdownGracePeriod)
+			defer cancelShutdown()
+
+			var shutdown errgroup.Group
+			shutdown.Go(func() error {
+				if err := shutdownServer(shutdownCtx, server, inFlight); err != nil {
 					slog.Error("failed to terminate server", slog.String("error", err.Error()))
 				}
-			}
-
-			if err := telemetryServer.Shutdown(ctx); err != nil {
-				if err != context.Canceled {
+				return nil
+			})
+			shutdown.Go(func() error {
+				if err := shutdownServer(shutdownCtx, telemetryServer, nil); err != nil {
 					slog.Error("failed to terminate telemetry server", slog.String("error", err.Error()))
 				}
+				return nil
+			})
+			_ = shutdown.Wait()
+
+			// The audit logger is closed after the servers, so that the events of the last requests are flushed as well
+			if err := closeAuditLogger(auditLogger, auditLoggerCloseTimeout); err != nil {
+				slog.Error("failed to close audit logger", slog.String("error", err.Error()))
 			}
 
 			return nil
@@ -188,13 +309,57 @@ func init() {
 	serverCmd.Flags().StringVar(&flagTLSCertFile, "tls-cert-file", "", "TLS certificate to serve")
 	serverCmd.Flags().StringVar(&flagListenAddr, "listen-address", ":5601", "Address to listen on")
 	serverCmd.Flags().StringVar(&flagTelemetryListenAddr, "listen-telemetry-address", ":7801", "Telemetry address to listen on")
-	serverCmd.Flags().StringVar(&flagModuleArchiveFormat, "storage-module-archive-format", storage.DefaultModuleArchiveFormat, "Archive file format for modules, specified without the leading dot")
+	serverCmd.Flags().StringVar(&flagModuleGitBaseURL, "module-git-base-url", "", "Base URL of the Git repositories of the modules. If set, modules are served from the Git tags instead of the storage backend")
+	serverCmd.Flags().StringVar(&flagModuleGitRepositoryPattern, "module-git-repository-pattern", module.DefaultGitRepositoryPattern, "Path of the module repositories relative to the Git base URL, a double slash separates the subdirectory of the module")
+	serverCmd.Flags().StringVar(&flagModuleGitUsername, "module-git-username", "", "Username for listing the tags of the module repositories")
+	serverCmd.Flags().StringVar(&flagModuleGitPassword, "module-git-password", "", "Password or access token for listing the tags of the module repositories")
+	serverCmd.Flags().DurationVar(&flagModuleGitTimeout, "module-git-timeout", 10*time.Second, "Timeout for listing the tags of a module repository")
+	serverCmd.Flags().DurationVar(&flagModuleGitTagCacheTTL, "module-git-tag-cache-ttl", module.DefaultGitTagCacheTTL, "Duration for which the tags of a module repository are cached. The cache is disabled if 0")
+	serverCmd.Flags().DurationVar(&flagHealthCheckTimeout, "health-check-timeout", 5*time.Second, "Timeout for probing the storage backends on the /healthz endpoint")
+	serverCmd.Flags().DurationVar(&flagCatalogCacheTTL, "catalog-cache-ttl", 30*time.Second, "Duration for which the listing of all modules and providers is cached by the /v1/catalog endpoint")
+	serverCmd.Flags().DurationVar(&flagHTTPReadTimeout, "http-read-timeout", 30*time.Second, "Maximum duration for reading an entire request, including the body")
+	serverCmd.Flags().DurationVar(&flagHTTPWriteTimeout, "http-write-timeout", 30*time.Second, "Maximum duration for writing a response. Doesn't apply to downloads through the proxy")
+	serverCmd.Flags().DurationVar(&flagHTTPIdleTimeout, "http-idle-timeout", 2*time.Minute, "Maximum duration to wait for the next request on a keep-alive connection")
+	serverCmd.Flags().DurationVar(&flagShutdownGracePeriod, "shutdown-grace-period", 30*time.Second, "Maximum duration to wait for in-flight requests, like downloads through the proxy, to finish during the shutdown")
+	serverCmd.Flags().Int64Var(&flagMaxUploadSize, "max-upload-size", 0, "Maximum size of request bodies in bytes, larger requests are rejected with 413 Request Entity Too Large. Unlimited if 0")
+	serverCmd.Flags().BoolVar(&flagEnableStorageDebug, "enable-storage-debug", false, "Enable the /v1/debug/storage endpoint, which lists the raw keys of the storage backend under a prefix")
+	serverCmd.Flags().BoolVar(&flagCompressResponses, "compress-responses", true, "Compress JSON responses with gzip or zstd if the client supports it")
+	serverCmd.Flags().StringSliceVar(&flagAllowedPlatforms, "provider-allowed-platforms", nil, "Platforms in the format <os>_<arch> that are served by the provider registry, e.g. linux_amd64. All platforms are served if empty")
+	serverCmd.Flags().StringVar(&flagDefaultOS, "provider-default-os", "", `OS of provider downloads that omit the platform, e.g. linux. "host" uses the OS of the registry. Requests without a platform are rejected if empty`)
+	serverCmd.Flags().StringVar(&flagDefaultArch, "provider-default-arch", "", `Architecture of provider downloads that omit the platform, e.g. amd64. "host" uses the architecture of the registry. Requests without a platform are rejected if empty`)
+	serverCmd.Flags().Float64Var(&flagRateLimitRPS, "rate-limit-rps", 0, "Requests per second allowed per client on the module, provider, mirror and catalog endpoints. Unlimited if 0")
+	serverCmd.Flags().IntVar(&flagRateLimitBurst, "rate-limit-burst", 20, "Number of requests a client can send in a burst before the rate limit applies")
+	serverCmd.Flags().StringSliceVar(&flagTrustedProxies, "rate-limit-trusted-proxies", nil, "IP addresses or CIDR ranges of proxies, whose X-Forwarded-For header identifies the client. The header is ignored if empty")
+	serverCmd.Flags().IntVar(&flagCompressMinSize, "compress-min-size", compression.DefaultMinSize, "Minimum size in bytes of a JSON response to be compressed")
+	serverCmd.Flags().StringSliceVar(&flagHostStoragePrefixes, "host-storage-prefix", nil, `Mapping in the format <host>=<prefix> that serves requests for the Host header from the prefix in the storage backend.
+Can be specified multiple times to serve multiple virtual registries from one deployment. Requests for other hosts are served from the storage backend as configured`)
+	serverCmd.Flags().BoolVar(&flagDisableModules, "disable-modules", false, "Disable the module registry and omit modules.v1 from the service discovery document")
+	serverCmd.Flags().BoolVar(&flagDisableProviders, "disable-providers", false, "Disable the provider registry and omit providers.v1 from the service discovery document. The provider network mirror isn't affected")
+	serverCmd.Flags().BoolVar(&flagProvidersUnionMirror, "providers-union-mirror", false, "List the versions of the provider network mirror alongside the internal versions of a provider, marked by their source")
+	serverCmd.Flags().StringVar(&flagProvidersUnionMirrorHostname, "providers-union-mirror-hostname", "registry.terraform.io", "Hostname of the mirrored providers that are listed with --providers-union-mirror")
+	serverCmd.Flags().BoolVar(&flagAllowAnonymousRead, "allow-anonymous-read", false, "Serve the module, provider and catalog endpoints to clients without a token. The mirror copy and debug endpoints still require authentication")
 
 	// Proxy options.
 	serverCmd.PersistentFlags().BoolVar(&flagProxy, "download-proxy", false, "Enable proxying download request to remote storage")
+	serverCmd.PersistentFlags().BoolVar(&flagProxyVerify, "download-proxy-verify", false, "Validate zip and tar.gz archives while they are proxied and abort the download of corrupted archives")
+	serverCmd.PersistentFlags().IntVar(&flagProxyMaxConcurrent, "download-proxy-max-concurrent", 0, "Maximum number of concurrently proxied downloads, excess downloads are queued. Unlimited if 0")
+	serverCmd.PersistentFlags().DurationVar(&flagProxyQueueTimeout, "download-proxy-queue-timeout", 10*time.Second, "Time a download waits for a free slot before it's rejected with 503 Service Unavailable. Downloads are rejected right away when all slots are taken if it's 0")
+
+	// Audit options.
+	serverCmd.Flags().StringVar(&flagAuditLogger, "audit-logger", "", "Audit logger that records module and provider downloads. Supported values: slog, file, gcs. Auditing is disabled if empty")
+	serverCmd.Flags().StringVar(&flagAuditFilePath, "audit-file-path", "boring-registry-audit.log", "Path of the file audit logger")
+	serverCmd.Flags().IntVar(&flagAuditFileMaxSizeMB, "audit-file-max-size-mb", 100, "Size in megabytes after which the audit log file is rotated")
+	serverCmd.Flags().IntVar(&flagAuditFileMaxBackups, "audit-file-max-backups", 5, "Number of rotated audit log files to retain")
+	serverCmd.Flags().StringVar(&flagAuditGCSBucket, "audit-gcs-bucket", "", "GCS bucket the audit events are uploaded to")
+	serverCmd.Flags().StringVar(&flagAuditGCSPrefix, "audit-gcs-prefix", "audit", "Prefix of the audit event objects in the GCS bucket")
+	serverCmd.Flags().IntVar(&flagAuditBatchSize, "audit-batch-size", 100, "Number of audit events that are uploaded together to an object storage")
+	serverCmd.Flags().DurationVar(&flagAuditFlushInterval, "audit-flush-interval", time.Minute, "Interval at which buffered audit events are uploaded to an object storage")
 
 	// Static auth options.
-	serverCmd.Flags().StringSliceVar(&flagAuthStaticTokens, "auth-static-token", nil, "Static API token to protect the boring-registry")
+	serverCmd.Flags().StringSliceVar(&flagAuthStaticTokens, "auth-static-token", nil, "Static API token to protect the boring-registry. The tokens have the admin scope, which grants access to all endpoints")
+	serverCmd.Flags().StringSliceVar(&flagAuthStaticTokensRO, "auth-static-token-ro", nil, "Static API token with the read scope, which is rejected by the endpoints that change the registry. bcrypt hashes are accepted as well")
+	serverCmd.Flags().StringSliceVar(&flagAuthStaticTokenHashes, "auth-static-token-hash", nil, "bcrypt hash of a static API token to protect the boring-registry")
+	serverCmd.Flags().StringVar(&flagAuthStaticTokenFile, "auth-static-token-file", "", "File with one static API token per line. The file is reloaded on SIGHUP")
 
 	// Okta auth options.
 	serverCmd.Flags().StringVar(&flagAuthOktaIssuer, "auth-okta-issuer", "", "Okta issuer")
@@ -205,6 +370,11 @@ func init() {
 	serverCmd.Flags().StringVar(&flagAuthOidcIssuer, "auth-oidc-issuer", "", "OIDC issuer URL")
 	serverCmd.Flags().StringVar(&flagAuthOidcClientId, "auth-oidc-clientid", "", "OIDC client identifier")
 	serverCmd.Flags().StringSliceVar(&flagAuthOidcScopes, "auth-oidc-scopes", nil, "List of OAuth2 scopes")
+	serverCmd.Flags().DurationVar(&flagAuthOidcJWKSRefreshInterval, "auth-oidc-jwks-refresh-interval", time.Hour, "Interval at which the OIDC signing keys are refreshed. Tokens signed by unknown keys additionally trigger a refresh")
+	serverCmd.Flags().StringSliceVar(&flagAuthOidcRequiredClaims, "auth-oidc-required-claim", nil, "Claim in the format key=value that OIDC tokens have to contain. Repeating a key accepts either of the values")
+	serverCmd.Flags().StringSliceVar(&flagAuthOidcNamespaceClaims, "auth-oidc-namespace-required-claim", nil, "Claim in the format namespace:key=value that OIDC tokens additionally have to contain to access the namespace")
+	serverCmd.Flags().StringVar(&flagNamespaceACLFile, "namespace-acl-file", "", `YAML or JSON file that maps namespaces to the subjects and groups allowed to read and write them.
+Modules and providers in namespaces without an entry are accessible to every authenticated user`)
 
 	// Terraform Login Protocol options.
 	serverCmd.Flags().StringVar(&flagAuthOktaClientId, "login-client", "", "The client_id value to use when making requests")
@@ -212,14 +382,157 @@ func init() {
 	serverCmd.Flags().StringVar(&flagAuthOktaAuthz, "login-authz", "", "The server's authorization endpoint")
 	serverCmd.Flags().StringVar(&flagAuthOktaToken, "login-token", "", "The server's token endpoint")
 	serverCmd.Flags().IntSliceVar(&flagLoginPorts, "login-ports", []int{10000, 10010}, "Inclusive range of TCP ports that Terraform/OpenTofu CLI may use")
+	serverCmd.Flags().BoolVar(&flagLoginDeviceCode, "login-device-code", false, `Advertise the OAuth 2.0 device authorization grant for custom clients that can't open a browser, like headless CI runners.
+The Terraform and OpenTofu CLIs don't implement the grant and keep using authz_code.
+The device authorization endpoint is discovered from the OIDC issuer, the grant isn't supported with Okta auth`)
 
 	// Provider Network Mirror options
 	serverCmd.Flags().BoolVar(&flagProviderNetworkMirrorEnabled, "network-mirror", true, "Enable the provider network mirror")
 	serverCmd.Flags().BoolVar(&flagProviderNetworkMirrorPullThroughEnabled, "network-mirror-pull-through", false, "Enable the pull-through provider network mirror. This setting takes no effect if network-mirror is disabled")
+	serverCmd.Flags().StringSliceVar(&flagProviderNetworkMirrorPrewarm, "network-mirror-prewarm", nil, `Provider in the format [<hostname>/]<namespace>/<name> that is copied into the pull-through mirror in the background.
+Can be specified multiple times. The hostname defaults to registry.terraform.io. This setting takes no effect if network-mirror-pull-through is disabled`)
+	serverCmd.Flags().DurationVar(&flagProviderNetworkMirrorPrewarmInterval, "network-mirror-prewarm-interval", time.Hour, "Interval at which the pre-warmed providers are copied from upstream")
+	serverCmd.Flags().IntVar(&flagProviderNetworkMirrorUpstreamRetries, "network-mirror-upstream-retries", 2, "Number of retries with exponential backoff for transient upstream errors (429, 502, 503, 504) before the pull-through mirror falls back to the storage backend")
+	serverCmd.Flags().BoolVar(&flagProviderNetworkMirrorVerifySignatures, "network-mirror-verify-signatures", true, "Verify the mirrored SHA256SUMS signature against the mirrored signing keys before serving a provider from the mirror")
+	serverCmd.Flags().StringSliceVar(&flagProviderNetworkMirrorTokens, "network-mirror-token", nil, "Static API token that is only accepted by the provider network mirror, in addition to the tokens of the configured auth providers")
+	serverCmd.Flags().BoolVar(&flagProviderNetworkMirrorCopyEndpoint, "network-mirror-copy-endpoint", false, `Enable POST requests to /v1/mirror/<hostname>/<namespace>/<name>/<version>, which copy all platforms of the provider version from upstream.
+The requests are authenticated by the auth providers, the network-mirror-token is not accepted. This setting takes no effect if network-mirror-pull-through is disabled`)
+}
+
+// storageType returns the type of the storage backend that setupStorage creates
+func storageType() string {
+	switch {
+	case flagS3Bucket != "":
+		return "s3"
+	case flagGCSBucket != "":
+		return "gcs"
+	case flagAzureStorageContainer != "":
+		return "azure"
+	default:
+		return ""
+	}
+}
+
+// storageStartupCheckTimeout limits the time for probing the storage backend before it's used
+const storageStartupCheckTimeout = 10 * time.Second
+
+// validateStorageFlags checks that the flags of the selected storage backend are complete.
+// Flags of other storage backends are ignored and returned as warnings, as they hint at a misconfiguration.
+func validateStorageFlags() ([]string, error) {
+	if flagStorageRetryMaxAttempts < 1 {
+		return nil, errors.New("storage-retry-max-attempts must be at least 1")
+	}
+	if err := storage.ValidateListPageSize(flagStorageListPageSize); err != nil {
+		return nil, fmt.Errorf("invalid storage-list-page-size: %w", err)
+	}
+	if flagS3PresignConcurrency < 1 {
+		return nil, errors.New("storage-s3-presign-concurrency must be at least 1")
+	}
+	if err := storage.ValidateModuleArchiveFormat(flagModuleArchiveFormat, flagModuleArchiveAllowZstd); err != nil {
+		return nil, fmt.Errorf("invalid storage-module-archive-format: %w", err)
+	}
+	if err := storage.ValidateObjectACL(flagS3ObjectACL); err != nil {
+		return nil, fmt.Errorf("invalid storage-s3-object-acl: %w", err)
+	}
+	if err := storage.ValidateObjectACL(flagGCSObjectACL); err != nil {
+		return nil, fmt.Errorf("invalid storage-gcs-object-acl: %w", err)
+	}
+
+	backends := []struct {
+		name  string
+		flags map[string]bool
+	}{
+		{
+			name: "s3",
+			flags: map[string]bool{
+				"storage-s3-bucket":     flagS3Bucket != "",
+				"storage-s3-prefix":     flagS3Prefix != "",
+				"storage-s3-region":     flagS3Region != "",
+				"storage-s3-endpoint":   flagS3Endpoint != "",
+				"storage-s3-pathstyle":  flagS3PathStyle,
+				"storage-s3-object-acl": flagS3ObjectACL != storage.ObjectACLPrivate,
+			},
+		},
+		{
+			name: "gcs",
+			flags: map[string]bool{
+				"storage-gcs-bucket":     flagGCSBucket != "",
+				"storage-gcs-prefix":     flagGCSPrefix != "",
+				"storage-gcs-sa-email":   flagGCSServiceAccount != "",
+				"storage-gcs-object-acl": flagGCSObjectACL != storage.ObjectACLPrivate,
+			},
+		},
+		{
+			name: "azure",
+			flags: map[string]bool{
+				"storage-azure-account":   flagAzureStorageAccount != "",
+				"storage-azure-container": flagAzureStorageContainer != "",
+				"storage-azure-prefix":    flagAzureStoragePrefix != "",
+			},
+		},
+	}
+
+	selected := storageType()
+	switch selected {
+	case "":
+		return nil, errors.New("storage provider is not specified, one of storage-s3-bucket, storage-gcs-bucket, or storage-azure-container is required")
+	case "azure":
+		if flagAzureStorageAccount == "" {
+			return nil, errors.New("storage-azure-account is required for the azure storage backend")
+		}
+	}
+
+	var warnings []string
+	for _, b := range backends {
+		if b.name == selected {
+			continue
+		}
+
+		var ignored []string
+		for name, set := range b.flags {
+			if set {
+				ignored = append(ignored, name)
+			}
+		}
+		if len(ignored) > 0 {
+			slices.Sort(ignored)
+			warnings = append(warnings, fmt.Sprintf("the %s storage backend is used, ignoring the %s flags: %s", selected, b.name, strings.Join(ignored, ", ")))
+		}
+	}
+	return warnings, nil
 }
 
 // TODO(oliviermichaelis): move to root, as the storage flags are defined in root?
-func setupStorage(ctx context.Context) (storage.Storage, error) {
+// setupStorage creates the configured storage backend and fails if it isn't reachable. The metrics are optional and only recorded by the server
+func setupStorage(ctx context.Context, metrics *o11y.StorageMetrics) (storage.Storage, error) {
+	warnings, err := validateStorageFlags()
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range warnings {
+		slog.Warn(w)
+	}
+
+	s, err := newStorage(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+	s = storage.NewTimeoutStorage(s, flagStorageOperationTimeout)
+
+	checkCtx, cancel := context.WithTimeout(ctx, storageStartupCheckTimeout)
+	defer cancel()
+	if err := s.HealthCheck(checkCtx); err != nil {
+		return nil, fmt.Errorf("failed to reach the %s storage backend: %w", storageType(), err)
+	}
+	return s, nil
+}
+
+func newStorage(ctx context.Context, metrics *o11y.StorageMetrics) (storage.Storage, error) {
+	var nearExpiry prometheus.Counter
+	if metrics != nil {
+		nearExpiry = metrics.NearExpiryPresigns.WithLabelValues(storageType())
+	}
+
 	switch {
 	case flagS3Bucket != "":
 		return storage.NewS3Storage(ctx,
@@ -230,13 +543,26 @@ func setupStorage(ctx context.Context) (storage.Storage, error) {
 			storage.WithS3StoragePathStyle(flagS3PathStyle),
 			storage.WithS3ArchiveFormat(flagModuleArchiveFormat),
 			storage.WithS3StorageSignedUrlExpiry(flagS3SignedURLExpiry),
+			storage.WithS3StorageSignedURLHeadroom(flagStorageSignedURLHeadroom, nearExpiry),
+			storage.WithS3StorageExistenceCacheTTL(flagStorageExistenceCacheTTL),
+			storage.WithS3StorageRetryMaxAttempts(flagStorageRetryMaxAttempts),
+			storage.WithS3StoragePresignConcurrency(flagS3PresignConcurrency),
+			storage.WithS3StorageObjectACL(flagS3ObjectACL),
+			storage.WithS3StorageListPageSize(flagStorageListPageSize),
+			storage.WithS3StorageDefaultSigningKeysNamespace(flagDefaultSigningKeysNamespace),
 		)
 	case flagGCSBucket != "":
 		return storage.NewGCSStorage(flagGCSBucket,
 			storage.WithGCSStorageBucketPrefix(flagGCSPrefix),
 			storage.WithGCSServiceAccount(flagGCSServiceAccount),
 			storage.WithGCSSignedUrlExpiry(flagGCSSignedURLExpiry),
+			storage.WithGCSSignedURLHeadroom(flagStorageSignedURLHeadroom, nearExpiry),
 			storage.WithGCSArchiveFormat(flagModuleArchiveFormat),
+			storage.WithGCSExistenceCacheTTL(flagStorageExistenceCacheTTL),
+			storage.WithGCSRetryMaxAttempts(flagStorageRetryMaxAttempts),
+			storage.WithGCSObjectACL(flagGCSObjectACL),
+			storage.WithGCSListPageSize(flagStorageListPageSize),
+			storage.WithGCSDefaultSigningKeysNamespace(flagDefaultSigningKeysNamespace),
 		)
 	case flagAzureStorageContainer != "":
 		return storage.NewAzureStorage(flagAzureStorageAccount,
@@ -244,41 +570,237 @@ func setupStorage(ctx context.Context) (storage.Storage, error) {
 			storage.WithAzureStoragePrefix(flagAzureStoragePrefix),
 			storage.WithAzureStorageArchiveFormat(flagModuleArchiveFormat),
 			storage.WithAzureStorageSignedUrlExpiry(flagAzureStorageSignedURLExpiry),
+			storage.WithAzureStorageSignedURLHeadroom(flagStorageSignedURLHeadroom, nearExpiry),
+			storage.WithAzureStorageExistenceCacheTTL(flagStorageExistenceCacheTTL),
+			storage.WithAzureStorageRetryMaxAttempts(flagStorageRetryMaxAttempts),
+			storage.WithAzureStorageListPageSize(flagStorageListPageSize),
+			storage.WithAzureStorageDefaultSigningKeysNamespace(flagDefaultSigningKeysNamespace),
 		)
 	default:
 		return nil, errors.New("storage provider is not specified")
 	}
 }
 
-func serveMux(ctx context.Context) (*http.ServeMux, error) {
-	mux := http.NewServeMux()
+// closeAuditLogger flushes the buffered audit events, but cancels the flush after the timeout to not block the shutdown
+func closeAuditLogger(logger audit.Logger, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := logger.Close(ctx); err != nil {
+		return fmt.Errorf("timed out after %s while flushing audit events: %w", timeout, err)
+	}
+	return nil
+}
+
+func setupAuditLogger(ctx context.Context) (audit.Logger, error) {
+	switch flagAuditLogger {
+	case "":
+		return audit.NoOpAuditLogger{}, nil
+	case "slog":
+		return audit.NewSlogAuditLogger(slog.Default()), nil
+	case "file":
+		return audit.CreateFileAuditLogger(flagAuditFilePath, flagAuditFileMaxSizeMB, flagAuditFileMaxBackups)
+	case "gcs":
+		if flagAuditGCSBucket == "" {
+			return nil, errors.New("audit-gcs-bucket is required for the gcs audit logger")
+		}
+		return audit.CreateGCSAuditLogger(ctx, flagAuditGCSBucket, flagAuditGCSPrefix, flagAuditBatchSize, flagAuditFlushInterval)
+	default:
+		return nil, fmt.Errorf("unknown audit logger %q", flagAuditLogger)
+	}
+}
+
+// inFlightRequests counts the requests that are currently being served
+type inFlightRequests struct {
+	count atomic.Int64
+}
+
+func (i *inFlightRequests) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i.count.Add(1)
+		defer i.count.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// shutdownServer stops accepting new connections and waits until the deadline of ctx for the in-flight requests to finish
+func shutdownServer(ctx context.Context, server *http.Server, inFlight *inFlightRequests) error {
+	if inFlight != nil {
+		attrs := []any{slog.Int64("requests", inFlight.count.Load())}
+		if deadline, ok := ctx.Deadline(); ok {
+			attrs = append(attrs, slog.String("grace_period", time.Until(deadline).Round(time.Millisecond).String()))
+		}
+		slog.Info("draining in-flight requests", attrs...)
+	}
+	return server.Shutdown(ctx)
+}
+
+// parseHostStoragePrefixes parses the <host>=<prefix> mappings of the virtual registries.
+// The prefixes must not overlap with the top-level directories of the storage layout.
+func parseHostStoragePrefixes(mappings []string) (map[string]string, error) {
+	prefixes := make(map[string]string, len(mappings))
+	for _, m := range mappings {
+		host, prefix, ok := strings.Cut(m, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+		if !ok || host == "" || prefix == "" {
+			return nil, fmt.Errorf("host storage prefix %s is invalid, expected the <host>=<prefix> format", m)
+		}
+		if path.Clean(prefix) != prefix || strings.HasPrefix(prefix, "..") {
+			return nil, fmt.Errorf("host storage prefix %s is invalid, the prefix has to be a relative path", m)
+		}
+		if first, _, _ := strings.Cut(prefix, "/"); slices.Contains([]string{"modules", "providers", "mirror"}, first) {
+			return nil, fmt.Errorf("host storage prefix %s is invalid, the prefix overlaps with the %s directory of the storage backend", m, first)
+		}
+		if _, ok := prefixes[host]; ok {
+			return nil, fmt.Errorf("host %s is mapped to multiple storage prefixes", host)
+		}
+		prefixes[host] = prefix
+	}
+	return prefixes, nil
+}
+
+// routeHosts serves the requests for a host of the prefixes from its prefix in the storage backend.
+// The port of the Host header is ignored.
+func routeHosts(prefixes map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(prefixes) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if prefix, ok := prefixes[strings.ToLower(host)]; ok {
+				r = r.WithContext(core.ContextWithStoragePrefix(r.Context(), prefix))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitRequestBody rejects request bodies that are larger than maxSize, unless maxSize is 0.
+// Requests announcing a larger body are rejected right away, otherwise reading beyond the limit fails with an http.MaxBytesError.
+func limitRequestBody(maxSize int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if maxSize <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxSize {
+				core.EncodeError(fmt.Errorf("%w: the limit is %d bytes", core.ErrRequestTooLarge, maxSize), w)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clearWriteDeadline removes the write timeout of the server for requests under the path prefix
+func clearWriteDeadline(prefix string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, prefix+"/") {
+				if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+					slog.Debug("failed to clear the write deadline", slog.String("err", err.Error()))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func serveMux(ctx context.Context, auditLogger audit.Logger) (*http.ServeMux, error) {
+	mux := newRouteMux()
 
-	authMiddleware, login, err := authMiddleware(ctx)
+	providers, login, err := authProviders(ctx)
 	if err != nil {
 		return nil, err
 	}
+	authMiddleware := auth.Middleware(providers...)
+	readAuthMiddleware := readAuthMiddleware(providers)
+	mirrorAuthMiddleware := mirrorAuthMiddleware(providers)
 
 	metrics := o11y.NewMetrics(nil)
 	instrumentation := o11y.NewMiddleware(metrics.Http)
 
+	if flagRateLimitRPS > 0 {
+		trustedProxies, err := ratelimit.ParseTrustedProxies(flagTrustedProxies)
+		if err != nil {
+			return nil, err
+		}
+		limiter := ratelimit.NewLimiter(flagRateLimitRPS, flagRateLimitBurst, metrics.RateLimit, ratelimit.WithTrustedProxies(trustedProxies))
+		authMiddleware = endpoint.Chain(limiter.AuthFailureMiddleware(), authMiddleware, limiter.Middleware())
+		readAuthMiddleware = endpoint.Chain(limiter.AuthFailureMiddleware(), readAuthMiddleware, limiter.Middleware())
+		mirrorAuthMiddleware = endpoint.Chain(limiter.AuthFailureMiddleware(), mirrorAuthMiddleware, limiter.Middleware())
+	}
+
+	writeAuthMiddleware := writeAuthMiddleware(authMiddleware)
+
+	// Without auth providers, the auth middleware lets every request pass
+	if flagEnableStorageDebug && len(providers) == 0 {
+		return nil, errors.New("enable-storage-debug requires an auth provider, as the storage keys would be listed to anonymous clients")
+	}
+
 	registerMetrics(mux)
 	registerDiscovery(mux, login)
+	if err := registerInfo(mux); err != nil {
+		return nil, err
+	}
 
-	s, err := setupStorage(ctx)
+	s, err := setupStorage(ctx, metrics.Storage)
 	if err != nil {
 		return nil, err
 	}
+	s = storage.NewInstrumentedStorage(s, metrics.Storage)
+
+	registerHealth(mux, s)
+
+	var acl auth.ACL
+	if flagNamespaceACLFile != "" {
+		if acl, err = auth.LoadACL(flagNamespaceACLFile); err != nil {
+			return nil, err
+		}
+	}
 
 	proxyUrlService := core.NewProxyUrlService(flagProxy, prefixProxy)
 
-	if err := registerModule(mux, s, authMiddleware, metrics.Module, instrumentation, proxyUrlService); err != nil {
+	var moduleStorage module.Storage = s
+	moduleProxyUrlService := proxyUrlService
+	if flagModuleGitBaseURL != "" {
+		moduleStorage, err = module.NewGitStorage(flagModuleGitBaseURL,
+			module.WithGitRepositoryPattern(flagModuleGitRepositoryPattern),
+			module.WithGitCredentials(flagModuleGitUsername, flagModuleGitPassword),
+			module.WithGitHTTPClient(&http.Client{Timeout: flagModuleGitTimeout, Transport: core.NewUserAgentTransport(nil, flagOutboundUserAgent)}),
+			module.WithGitTagCacheTTL(flagModuleGitTagCacheTTL),
+		)
+		if err != nil {
+			return nil, err
+		}
+		// Terraform clones the repositories directly, there's no archive to proxy
+		moduleProxyUrlService = core.NewProxyUrlService(false, prefixProxy)
+	}
+
+	if err := registerModule(mux, moduleStorage, readAuthMiddleware, acl, metrics.Module, instrumentation, moduleProxyUrlService, auditLogger); err != nil {
 		return nil, err
 	}
 
-	if err := registerProvider(mux, s, authMiddleware, metrics.Provider, instrumentation, proxyUrlService); err != nil {
+	if err := registerProvider(mux, s, readAuthMiddleware, acl, metrics.Provider, instrumentation, proxyUrlService, auditLogger); err != nil {
 		return nil, err
 	}
 
+	catalogService := catalog.NewService(s, flagCatalogCacheTTL, catalog.WithACL(acl))
+	registerCatalog(mux, catalogService, readAuthMiddleware, instrumentation)
+	registerDebug(mux, s, authMiddleware, acl, instrumentation)
+	// Without auth providers, the auth middleware lets every request pass
+	if len(providers) > 0 {
+		registerAdmin(mux, writeAuthMiddleware, acl, instrumentation, s, catalogService)
+	} else {
+		slog.Warn("the admin endpoints are disabled, as no authentication is configured")
+	}
+
 	if flagProxy {
 		if err := registerProxy(mux, s, metrics.Proxy, instrumentation); err != nil {
 			return nil, err
@@ -287,19 +809,39 @@ func serveMux(ctx context.Context) (*http.ServeMux, error) {
 
 	if flagProviderNetworkMirrorEnabled {
 		var svc mirror.Service
+		verifySignatures := mirror.WithSignatureVerification(flagProviderNetworkMirrorVerifySignatures)
 		if flagProviderNetworkMirrorPullThroughEnabled {
-			copier := mirror.NewCopier(ctx, s)
-			svc = mirror.NewPullThroughMirror(s, copier)
+			upstreamOpts, err := mirrorUpstreamOptions()
+			if err != nil {
+				return nil, err
+			}
+			copier := mirror.NewCopier(ctx, s, upstreamOpts...)
+			svc = mirror.NewPullThroughMirror(s, copier, append(upstreamOpts, mirror.WithUpstreamRetries(flagProviderNetworkMirrorUpstreamRetries), verifySignatures, mirror.WithMetrics(metrics.Mirror))...)
+
+			if len(flagProviderNetworkMirrorPrewarm) > 0 {
+				warmer, err := mirror.NewWarmer(s, copier, flagProviderNetworkMirrorPrewarm, flagProviderNetworkMirrorPrewarmInterval, upstreamOpts...)
+				if err != nil {
+					return nil, fmt.Errorf("failed to set up pre-warming: %w", err)
+				}
+				go warmer.Run(ctx)
+			}
+
+			if err := registerMirrorCopy(mux, s, copier, endpoint.Chain(writeAuthMiddleware, acl.Middleware(auth.PermissionWrite)), instrumentation, upstreamOpts...); err != nil {
+				return nil, err
+			}
 		} else {
-			svc = mirror.NewMirror(s)
+			svc = mirror.NewMirror(s, verifySignatures, mirror.WithMetrics(metrics.Mirror), mirror.WithH1Backfill(mirror.NewCopier(ctx, s)))
 		}
 
-		if err := registerMirror(mux, s, svc, authMiddleware, metrics.Mirror, instrumentation); err != nil {
+		if err := registerMirror(mux, s, svc, mirrorAuthMiddleware, metrics.Mirror, instrumentation); err != nil {
 			return nil, err
 		}
 	}
 
-	return mux, nil
+	if err := registerOpenAPI(mux); err != nil {
+		return nil, err
+	}
+	return mux.ServeMux, nil
 }
 
 func setupOidc(ctx context.Context) (auth.Provider, *discovery.LoginV1, error) {
@@ -312,9 +854,24 @@ func setupOidc(ctx context.Context) (auth.Provider, *discovery.LoginV1, error) {
 		slog.String("client-id", flagAuthOidcClientId),
 		slog.Any("ports", flagLoginPorts),
 		slog.Any("scopes", flagAuthOidcScopes),
+		slog.String("jwks-refresh-interval", flagAuthOidcJWKSRefreshInterval.String()),
 	)
 
-	provider, err := auth.NewOidcProvider(authCtx, flagAuthOidcIssuer, flagAuthOidcClientId)
+	requiredClaims, err := auth.ParseRequiredClaims(flagAuthOidcRequiredClaims)
+	if err != nil {
+		return nil, nil, err
+	}
+	namespaceClaims, err := auth.ParseNamespaceRequiredClaims(flagAuthOidcNamespaceClaims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider, err := auth.NewOidcProvider(authCtx, flagAuthOidcIssuer, flagAuthOidcClientId,
+		auth.WithJWKSRefreshInterval(flagAuthOidcJWKSRefreshInterval),
+		auth.WithHTTPTransport(core.NewUserAgentTransport(nil, flagOutboundUserAgent)),
+		auth.WithRequiredClaims(requiredClaims),
+		auth.WithNamespaceRequiredClaims(namespaceClaims),
+	)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to set up oidc provider: %w", err)
 	}
@@ -327,6 +884,15 @@ func setupOidc(ctx context.Context) (auth.Provider, *discovery.LoginV1, error) {
 		Ports:      flagLoginPorts,
 		Scopes:     flagAuthOidcScopes,
 	}
+	if flagLoginDeviceCode {
+		if provider.DeviceAuthURL() == "" {
+			return nil, nil, fmt.Errorf("login-device-code is enabled, but the OIDC issuer %s doesn't advertise a device_authorization_endpoint", flagAuthOidcIssuer)
+		}
+		login.Device = provider.DeviceAuthURL()
+		if !slices.Contains(login.GrantTypes, discovery.GrantTypeDeviceCode) {
+			login.GrantTypes = append(slices.Clone(login.GrantTypes), discovery.GrantTypeDeviceCode)
+		}
+	}
 
 	return provider, login, nil
 }
@@ -347,11 +913,29 @@ func setupOkta() (auth.Provider, *discovery.LoginV1) {
 	return p, login
 }
 
-func authMiddleware(ctx context.Context) (endpoint.Middleware, *discovery.LoginV1, error) {
+// authProviders returns the configured auth providers. No auth is enforced if the list is empty
+func authProviders(ctx context.Context) ([]auth.Provider, *discovery.LoginV1, error) {
 	providers := []auth.Provider{}
 
-	if flagAuthStaticTokens != nil {
-		providers = append(providers, auth.NewStaticProvider(flagAuthStaticTokens...))
+	for _, hash := range flagAuthStaticTokenHashes {
+		if !auth.IsHashedToken(hash) {
+			return nil, nil, errors.New("auth-static-token-hash only accepts bcrypt hashes")
+		}
+	}
+	staticTokens := slices.Concat(flagAuthStaticTokens, flagAuthStaticTokenHashes)
+
+	if flagAuthStaticTokenFile != "" {
+		p, err := auth.NewStaticProviderFromFile(flagAuthStaticTokenFile, staticTokens...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to set up static auth: %w", err)
+		}
+		go reloadOnSighup(ctx, p)
+		providers = append(providers, p)
+	} else if len(staticTokens) > 0 {
+		providers = append(providers, auth.NewStaticProvider(staticTokens...))
+	}
+	if len(flagAuthStaticTokensRO) > 0 {
+		providers = append(providers, auth.NewReadOnlyStaticProvider(flagAuthStaticTokensRO...))
 	}
 
 	// Check if OIDC or Okta are configured, we only want to allow one at a time.
@@ -372,18 +956,68 @@ func authMiddleware(ctx context.Context) (endpoint.Middleware, *discovery.LoginV
 			return nil, nil, err
 		}
 	} else if flagAuthOktaIssuer != "" {
+		if flagLoginDeviceCode {
+			return nil, nil, errors.New("login-device-code is only supported with OIDC auth")
+		}
 		p, login = setupOkta()
 	}
 
-	if err := login.Validate(); err != nil {
-		return nil, nil, err
+	// The login is only configured for OIDC and Okta
+	if login != nil {
+		if err := login.Validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if p != nil {
+		providers = append(providers, p)
+	}
+	return providers, login, nil
+}
+
+// readAuthMiddleware returns the auth middleware of the read-only module, provider and catalog endpoints.
+// With --allow-anonymous-read, requests without a token are served as well
+func readAuthMiddleware(providers []auth.Provider) endpoint.Middleware {
+	if flagAllowAnonymousRead {
+		return auth.AnonymousReadMiddleware(providers...)
+	}
+	return auth.Middleware(providers...)
+}
+
+// writeAuthMiddleware returns the auth middleware of the endpoints that change the registry, which reject tokens with the read scope
+func writeAuthMiddleware(authMiddleware endpoint.Middleware) endpoint.Middleware {
+	return endpoint.Chain(authMiddleware, auth.RequireScope(auth.ScopeAdmin))
+}
+
+// mirrorAuthMiddleware returns the auth middleware of the provider network mirror.
+// Besides the tokens of the auth providers, it accepts the tokens that are only valid for the mirror.
+// They're verified first, so that the error of the last auth provider, e.g. 403 Forbidden for missing OIDC claims, is returned for other tokens
+func mirrorAuthMiddleware(providers []auth.Provider) endpoint.Middleware {
+	if len(flagProviderNetworkMirrorTokens) == 0 {
+		return auth.Middleware(providers...)
 	}
+	return auth.Middleware(slices.Concat([]auth.Provider{auth.NewStaticProvider(flagProviderNetworkMirrorTokens...)}, providers)...)
+}
 
-	providers = append(providers, p)
-	return auth.Middleware(providers...), login, nil
+// reloadOnSighup reloads the static tokens from the token file whenever the process receives SIGHUP
+func reloadOnSighup(ctx context.Context, p *auth.StaticProvider) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	for {
+		select {
+		case <-sighup:
+			if err := p.Reload(); err != nil {
+				slog.Error("failed to reload static tokens", slog.String("err", err.Error()))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
-func registerMetrics(mux *http.ServeMux) {
+func registerMetrics(mux *routeMux) {
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.HandleFunc("/debug/pprof/", pprof.Index)
 	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
@@ -397,11 +1031,127 @@ func registerMetrics(mux *http.ServeMux) {
 	mux.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate"))
 }
 
-func registerDiscovery(mux *http.ServeMux, login *discovery.LoginV1) error {
-	options := []discovery.Option{
-		discovery.WithModulesV1(fmt.Sprintf("%s/", prefixModules)),
-		discovery.WithProvidersV1(fmt.Sprintf("%s/", prefixProviders)),
-		discovery.WithLoginV1(login),
+func registerHealth(mux *routeMux, s storage.Storage) {
+	handler := health.NewAggregator(
+		health.WithTimeout(flagHealthCheckTimeout),
+		health.WithPrimary(s.String(), s),
+	)
+	mux.document("/healthz", handler, health.Routes...)
+	mux.Handle("/healthz", handler)
+}
+
+// registerOpenAPI serves the OpenAPI document of the registry's own endpoints without authentication.
+// It has to be called after all other endpoints are registered, as the document only describes the registered endpoints.
+func registerOpenAPI(mux *routeMux) error {
+	mux.document("", nil, openapi.Route{
+		Method:    http.MethodGet,
+		Path:      "/openapi.json",
+		Summary:   "Describe the endpoints of the registry",
+		Responses: map[int]string{http.StatusOK: "This document"},
+	})
+	if mux.err != nil {
+		return fmt.Errorf("failed to generate the OpenAPI document: %w", mux.err)
+	}
+	specJSON, err := json.Marshal(mux.doc)
+	if err != nil {
+		return err
+	}
+
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-type", "application/json")
+		w.Write(specJSON)
+	})
+	return nil
+}
+
+// routeMux is the http.ServeMux of the registry, which collects the OpenAPI document of the registered endpoints
+type routeMux struct {
+	*http.ServeMux
+	doc *openapi.Document
+	err error
+}
+
+func newRouteMux() *routeMux {
+	return &routeMux{
+		ServeMux: http.NewServeMux(),
+		doc:      openapi.NewDocument("boring-registry", version.Version),
+	}
+}
+
+// document describes the routes of the handler that is registered under the prefix.
+// The routers of the endpoints are walked, so that stale descriptions fail the startup instead of ending up in the document
+func (m *routeMux) document(prefix string, handler http.Handler, routes ...openapi.Route) {
+	if err := m.doc.AddHandler(prefix, handler, routes...); err != nil {
+		m.err = errors.Join(m.err, err)
+	}
+}
+
+// authTypes returns the types of the configured auth providers
+func authTypes() []string {
+	var types []string
+	if len(flagAuthStaticTokens) > 0 || len(flagAuthStaticTokenHashes) > 0 || flagAuthStaticTokenFile != "" || len(flagAuthStaticTokensRO) > 0 {
+		types = append(types, "static")
+	}
+	if flagAuthOidcIssuer != "" {
+		types = append(types, "oidc")
+	} else if flagAuthOktaIssuer != "" {
+		types = append(types, "okta")
+	}
+	return types
+}
+
+// registerInfo serves the build version and the enabled features, which are derived from the configuration.
+// Only the types of the features are exposed, but never their configuration values
+func registerInfo(mux *routeMux) error {
+	info := discovery.Info{
+		Version:   version.Version,
+		Commit:    version.Commit,
+		BuildDate: version.Date,
+		Storage:   storageType(),
+		ArchiveFormats: discovery.ArchiveFormats{
+			Modules:   flagModuleArchiveFormat,
+			Providers: strings.TrimPrefix(core.ProviderExtension, "."),
+		},
+		Features: discovery.Features{
+			Auth:              authTypes(),
+			DownloadProxy:     flagProxy,
+			NetworkMirror:     flagProviderNetworkMirrorEnabled,
+			PullThroughMirror: flagProviderNetworkMirrorEnabled && flagProviderNetworkMirrorPullThroughEnabled,
+			RateLimit:         flagRateLimitRPS > 0,
+			AuditLog:          flagAuditLogger != "",
+		},
+	}
+	if info.Features.Auth == nil {
+		info.Features.Auth = []string{}
+	}
+
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	mux.document("", nil, openapi.Route{
+		Method:    http.MethodGet,
+		Path:      "/.well-known/boring-registry.json",
+		Summary:   "Describe the build version and the enabled features",
+		Responses: map[int]string{http.StatusOK: "The version and the features of the registry"},
+	})
+	mux.HandleFunc("/.well-known/boring-registry.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-type", "application/json")
+		w.Write(infoJSON)
+	})
+
+	return nil
+}
+
+// registerDiscovery registers the service discovery document, which only advertises the enabled registries
+func registerDiscovery(mux *routeMux, login *discovery.LoginV1) error {
+	options := []discovery.Option{discovery.WithLoginV1(login)}
+	if !flagDisableModules {
+		options = append(options, discovery.WithModulesV1(fmt.Sprintf("%s/", prefixModules)))
+	}
+	if !flagDisableProviders {
+		options = append(options, discovery.WithProvidersV1(fmt.Sprintf("%s/", prefixProviders)))
 	}
 
 	terraformJSON, err := json.Marshal(discovery.New(options...))
@@ -417,71 +1167,126 @@ func registerDiscovery(mux *http.ServeMux, login *discovery.LoginV1) error {
 	return nil
 }
 
-func registerModule(mux *http.ServeMux, s storage.Storage, auth endpoint.Middleware, metrics *o11y.ModuleMetrics, instrumentation o11y.Middleware, proxyUrlService core.ProxyUrlService) error {
+func registerModule(mux *routeMux, s module.Storage, authMiddleware endpoint.Middleware, acl auth.ACL, metrics *o11y.ModuleMetrics, instrumentation o11y.Middleware, proxyUrlService core.ProxyUrlService, auditLogger audit.Logger) error {
+	if flagDisableModules {
+		return nil
+	}
+
 	service := module.NewService(s, proxyUrlService)
 	{
+		service = module.ACLMiddleware(acl)(service)
 		service = module.LoggingMiddleware()(service)
+		service = module.AuditMiddleware(auditLogger)(service)
 	}
 
 	opts := []httptransport.ServerOption{
-		httptransport.ServerErrorEncoder(module.ErrorEncoder),
+		httptransport.ServerErrorEncoder(ratelimit.ErrorEncoder(module.ErrorEncoder)),
 		httptransport.ServerBefore(
 			httptransport.PopulateRequestContext,
 		),
 	}
 
+	handler := module.MakeHandler(
+		service,
+		authMiddleware,
+		metrics,
+		instrumentation,
+		opts...,
+	)
+	mux.document(prefixModules, handler, module.Routes...)
+
 	mux.Handle(
 		fmt.Sprintf(`%s/`, prefixModules),
 		http.StripPrefix(
 			prefixModules,
-			module.MakeHandler(
-				service,
-				auth,
-				metrics,
-				instrumentation,
-				opts...,
-			),
+			handler,
 		),
 	)
 
 	return nil
 }
 
-func registerProvider(mux *http.ServeMux, s storage.Storage, authMiddleware endpoint.Middleware, metrics *o11y.ProviderMetrics, instrumentation o11y.Middleware, proxyUrlService core.ProxyUrlService) error {
-	service := provider.NewService(s, proxyUrlService)
+// providerDefaultPlatform returns the platform of provider downloads without os and arch, "host" resolves to the platform of the registry
+func providerDefaultPlatform(goos, goarch string) (core.Platform, error) {
+	if (goos == "") != (goarch == "") {
+		return core.Platform{}, errors.New("--provider-default-os and --provider-default-arch have to be set together")
+	}
+	if goos == "host" {
+		goos = runtime.GOOS
+	}
+	if goarch == "host" {
+		goarch = runtime.GOARCH
+	}
+	return core.Platform{OS: goos, Arch: goarch}, nil
+}
+
+func registerProvider(mux *routeMux, s storage.Storage, authMiddleware endpoint.Middleware, acl auth.ACL, metrics *o11y.ProviderMetrics, instrumentation o11y.Middleware, proxyUrlService core.ProxyUrlService, auditLogger audit.Logger) error {
+	if flagDisableProviders {
+		return nil
+	}
+
+	allowedPlatforms := make([]core.Platform, 0, len(flagAllowedPlatforms))
+	for _, p := range flagAllowedPlatforms {
+		platform, err := core.ParsePlatform(p)
+		if err != nil {
+			return fmt.Errorf("invalid value for --provider-allowed-platforms: %w", err)
+		}
+		allowedPlatforms = append(allowedPlatforms, platform)
+	}
+
+	defaultPlatform, err := providerDefaultPlatform(flagDefaultOS, flagDefaultArch)
+	if err != nil {
+		return err
+	}
+
+	serviceOpts := []provider.Option{
+		provider.WithAllowedPlatforms(allowedPlatforms),
+		provider.WithDefaultPlatform(defaultPlatform),
+		provider.WithDocsPathPrefix(prefixProviders),
+	}
+	if flagProvidersUnionMirror {
+		serviceOpts = append(serviceOpts, provider.WithMirrorUnion(s, flagProvidersUnionMirrorHostname))
+	}
+
+	service := provider.NewService(s, proxyUrlService, serviceOpts...)
 	{
+		service = provider.ACLMiddleware(acl)(service)
 		service = provider.LoggingMiddleware()(service)
+		service = provider.AuditMiddleware(auditLogger)(service)
 	}
 
 	opts := []httptransport.ServerOption{
-		httptransport.ServerErrorEncoder(provider.ErrorEncoder),
+		httptransport.ServerErrorEncoder(ratelimit.ErrorEncoder(provider.ErrorEncoder)),
 		httptransport.ServerBefore(
 			httptransport.PopulateRequestContext,
 		),
 	}
 
+	handler := provider.MakeHandler(
+		service,
+		authMiddleware,
+		metrics,
+		instrumentation,
+		opts...,
+	)
+	mux.document(prefixProviders, handler, provider.Routes...)
+
 	mux.Handle(
 		fmt.Sprintf(`%s/`, prefixProviders),
 		http.StripPrefix(
 			prefixProviders,
-			provider.MakeHandler(
-				service,
-				authMiddleware,
-				metrics,
-				instrumentation,
-				opts...,
-			),
+			handler,
 		),
 	)
 
 	return nil
 }
 
-func registerMirror(mux *http.ServeMux, s storage.Storage, svc mirror.Service, authMiddleware endpoint.Middleware, metrics *o11y.MirrorMetrics, instrumentation o11y.Middleware) error {
+func registerMirror(mux *routeMux, s storage.Storage, svc mirror.Service, authMiddleware endpoint.Middleware, metrics *o11y.MirrorMetrics, instrumentation o11y.Middleware) error {
 	service := mirror.LoggingMiddleware()(svc)
 
 	opts := []httptransport.ServerOption{
-		httptransport.ServerErrorEncoder(mirror.ErrorEncoder),
+		httptransport.ServerErrorEncoder(ratelimit.ErrorEncoder(mirror.ErrorEncoder)),
 		httptransport.ServerBefore(
 			httptransport.PopulateRequestContext,
 		),
@@ -504,7 +1309,125 @@ func registerMirror(mux *http.ServeMux, s storage.Storage, svc mirror.Service, a
 	return nil
 }
 
-func registerProxy(mux *http.ServeMux, storage storage.Storage, metrics *o11y.ProxyMetrics, instrumentation o11y.Middleware) error {
+// registerMirrorCopy registers the on-demand copy of provider versions into the pull-through mirror
+func registerMirrorCopy(mux *routeMux, s mirror.Storage, copier mirror.Copier, authMiddleware endpoint.Middleware, instrumentation o11y.Middleware, upstreamOpts ...mirror.Option) error {
+	if !flagProviderNetworkMirrorCopyEndpoint {
+		return nil
+	}
+
+	seeder, err := mirror.NewSeeder(s, copier, nil, upstreamOpts...)
+	if err != nil {
+		return err
+	}
+
+	opts := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(ratelimit.ErrorEncoder(mirror.ErrorEncoder)),
+		httptransport.ServerBefore(
+			httptransport.PopulateRequestContext,
+		),
+	}
+
+	handler := mirror.MakeCopyHandler(
+		seeder,
+		authMiddleware,
+		instrumentation,
+		opts...,
+	)
+	mux.document(prefixMirror, handler, mirror.CopyRoutes...)
+
+	// Copying all platforms of a version takes longer than the write timeout of the server
+	mux.Handle(
+		fmt.Sprintf(`POST %s/`, prefixMirror),
+		clearWriteDeadline(prefixMirror)(
+			http.StripPrefix(
+				prefixMirror,
+				handler,
+			),
+		),
+	)
+
+	return nil
+}
+
+func registerCatalog(mux *routeMux, svc catalog.Service, authMiddleware endpoint.Middleware, instrumentation o11y.Middleware) {
+	opts := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(ratelimit.ErrorEncoder(catalog.ErrorEncoder)),
+		httptransport.ServerBefore(
+			httptransport.PopulateRequestContext,
+		),
+	}
+
+	handler := catalog.MakeHandler(
+		svc,
+		authMiddleware,
+		instrumentation,
+		opts...,
+	)
+	mux.document(prefixCatalog, handler, catalog.Routes...)
+
+	mux.Handle(
+		prefixCatalog,
+		handler,
+	)
+}
+
+// registerAdmin registers the administrative endpoints, which invalidate the in-process caches
+func registerAdmin(mux *routeMux, authMiddleware endpoint.Middleware, acl auth.ACL, instrumentation o11y.Middleware, caches ...admin.Cache) {
+	opts := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(ratelimit.ErrorEncoder(admin.ErrorEncoder)),
+		httptransport.ServerBefore(
+			httptransport.PopulateRequestContext,
+		),
+	}
+
+	handler := admin.MakeHandler(
+		admin.ACLMiddleware(acl)(admin.NewService(caches...)),
+		authMiddleware,
+		instrumentation,
+		opts...,
+	)
+	mux.document(prefixAdmin, handler, admin.Routes...)
+
+	mux.Handle(
+		fmt.Sprintf(`%s/`, prefixAdmin),
+		http.StripPrefix(
+			prefixAdmin,
+			handler,
+		),
+	)
+}
+
+// registerDebug registers the debug endpoints, if they're enabled
+func registerDebug(mux *routeMux, s debug.Storage, authMiddleware endpoint.Middleware, acl auth.ACL, instrumentation o11y.Middleware) {
+	if !flagEnableStorageDebug {
+		return
+	}
+
+	opts := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(ratelimit.ErrorEncoder(debug.ErrorEncoder)),
+		httptransport.ServerBefore(
+			httptransport.PopulateRequestContext,
+		),
+	}
+
+	handler := debug.MakeHandler(
+		debug.ACLMiddleware(acl)(debug.NewService(s)),
+		authMiddleware,
+		instrumentation,
+		opts...,
+	)
+	mux.document(prefixDebug, handler, debug.Routes...)
+
+	mux.Handle(
+		fmt.Sprintf(`%s/`, prefixDebug),
+		http.StripPrefix(
+			prefixDebug,
+			handler,
+		),
+	)
+}
+
+func registerProxy(mux *routeMux, storage storage.Storage, metrics *o11y.ProxyMetrics, instrumentation o11y.Middleware) error {
 	opts := []httptransport.ServerOption{
 		httptransport.ServerErrorEncoder(proxy.ErrorEncoder),
 		httptransport.ServerBefore(
@@ -512,15 +1435,20 @@ func registerProxy(mux *http.ServeMux, storage storage.Storage, metrics *o11y.Pr
 		),
 	}
 
+	limitConcurrency := proxy.LimitConcurrency(flagProxyMaxConcurrent, flagProxyQueueTimeout, metrics)
+
 	mux.Handle(
 		fmt.Sprintf(`%s/`, prefixProxy),
-		http.StripPrefix(
-			prefixProxy,
-			proxy.MakeHandler(
-				storage,
-				metrics,
-				instrumentation,
-				opts...,
+		limitConcurrency(
+			http.StripPrefix(
+				prefixProxy,
+				proxy.MakeHandler(
+					storage,
+					metrics,
+					instrumentation,
+					flagProxyVerify,
+					opts...,
+				),
 			),
 		),
 	)
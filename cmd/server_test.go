@@ -1,14 +1,33 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/boring-registry/boring-registry/pkg/audit"
+	"github.com/boring-registry/boring-registry/pkg/auth"
+	"github.com/boring-registry/boring-registry/pkg/catalog"
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/discovery"
+	"github.com/boring-registry/boring-registry/pkg/module"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+	"github.com/boring-registry/boring-registry/pkg/openapi"
+
+	"github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAuthMiddleware(t *testing.T) {
@@ -73,7 +92,7 @@ func TestAuthMiddleware(t *testing.T) {
 		flagAuthOktaAuthz = test.authOktaAuthz
 		flagAuthOktaToken = test.authOktaToken
 
-		mw, login, err := authMiddleware(context.Background())
+		providers, login, err := authProviders(context.Background())
 		if test.wantErr {
 			assert.Error(t, err)
 			assert.ErrorContains(t, err, test.errMessage)
@@ -90,7 +109,792 @@ func TestAuthMiddleware(t *testing.T) {
 				assert.NotEmpty(t, login.GrantTypes)
 				assert.NotEmpty(t, login.Ports)
 			}
-			assert.NotNil(t, mw)
+			assert.Len(t, providers, 1)
+		}
+	}
+}
+
+func TestAuthProviders_deviceCode(t *testing.T) {
+	// TestAuthMiddleware sets the auth flags without restoring them
+	resetFlags(serverCmd.Flags())
+
+	newIdP := func(t *testing.T, deviceEndpoint bool) *httptest.Server {
+		var s *httptest.Server
+		s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/.well-known/openid-configuration" {
+				http.NotFound(w, r)
+				return
+			}
+			config := map[string]interface{}{
+				"issuer":                                s.URL,
+				"authorization_endpoint":                s.URL + "/auth",
+				"token_endpoint":                        s.URL + "/token",
+				"jwks_uri":                              s.URL + "/keys",
+				"id_token_signing_alg_values_supported": []string{"RS256"},
+			}
+			if deviceEndpoint {
+				config["device_authorization_endpoint"] = s.URL + "/device"
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(config)
+		}))
+		t.Cleanup(s.Close)
+		return s
+	}
+
+	t.Run("advertised with OIDC", func(t *testing.T) {
+		resetServerFlags(t)
+		s := newIdP(t, true)
+		require.NoError(t, serverCmd.ParseFlags([]string{"--auth-oidc-issuer", s.URL, "--auth-oidc-clientid", "boring-registry", "--login-device-code"}))
+
+		_, login, err := authProviders(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"authz_code", discovery.GrantTypeDeviceCode}, login.GrantTypes)
+		assert.Equal(t, s.URL+"/device", login.Device)
+		// The default of the grant types flag isn't modified
+		assert.Equal(t, []string{"authz_code"}, flagLoginGrantTypes)
+
+		b, err := json.Marshal(discovery.New(discovery.WithLoginV1(login)))
+		require.NoError(t, err)
+		var document map[string]map[string]interface{}
+		require.NoError(t, json.Unmarshal(b, &document))
+		assert.Equal(t, []interface{}{"authz_code", discovery.GrantTypeDeviceCode}, document["login.v1"]["grant_types"])
+		assert.Equal(t, s.URL+"/device", document["login.v1"]["device"])
+		assert.Equal(t, s.URL+"/token", document["login.v1"]["token"])
+	})
+
+	t.Run("not advertised by default", func(t *testing.T) {
+		resetServerFlags(t)
+		s := newIdP(t, true)
+		require.NoError(t, serverCmd.ParseFlags([]string{"--auth-oidc-issuer", s.URL, "--auth-oidc-clientid", "boring-registry"}))
+
+		_, login, err := authProviders(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"authz_code"}, login.GrantTypes)
+		assert.Empty(t, login.Device)
+	})
+
+	t.Run("IdP without device endpoint", func(t *testing.T) {
+		resetServerFlags(t)
+		s := newIdP(t, false)
+		require.NoError(t, serverCmd.ParseFlags([]string{"--auth-oidc-issuer", s.URL, "--auth-oidc-clientid", "boring-registry", "--login-device-code"}))
+
+		_, _, err := authProviders(context.Background())
+		assert.ErrorContains(t, err, "device_authorization_endpoint")
+	})
+
+	t.Run("Okta", func(t *testing.T) {
+		resetServerFlags(t)
+		require.NoError(t, serverCmd.ParseFlags([]string{"--auth-okta-issuer", "something", "--login-device-code"}))
+
+		_, _, err := authProviders(context.Background())
+		assert.ErrorContains(t, err, "only supported with OIDC auth")
+	})
+}
+
+type slowAuditLogger struct {
+	audit.NoOpAuditLogger
+	delay time.Duration
+}
+
+func (s *slowAuditLogger) Close(ctx context.Context) error {
+	select {
+	case <-time.After(s.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestCloseAuditLogger(t *testing.T) {
+	assert.NoError(t, closeAuditLogger(&slowAuditLogger{}, time.Second))
+	assert.Error(t, closeAuditLogger(&slowAuditLogger{delay: time.Second}, 10*time.Millisecond))
+}
+
+func TestRegisterInfo(t *testing.T) {
+	resetServerFlags(t)
+	bucket, tokens, oidcIssuer, oktaIssuer := flagS3Bucket, flagAuthStaticTokens, flagAuthOidcIssuer, flagAuthOktaIssuer
+	t.Cleanup(func() {
+		flagS3Bucket, flagAuthStaticTokens, flagAuthOidcIssuer, flagAuthOktaIssuer = bucket, tokens, oidcIssuer, oktaIssuer
+	})
+
+	flagS3Bucket = "boring-registry"
+	flagAuthStaticTokens = []string{"very-secret-token"}
+	flagAuthOidcIssuer, flagAuthOktaIssuer = "", ""
+	flagProviderNetworkMirrorEnabled = true
+	flagProviderNetworkMirrorPullThroughEnabled = true
+	flagRateLimitRPS = 10
+	flagProxy = false
+
+	mux := newRouteMux()
+	assert.NoError(t, registerInfo(mux))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/boring-registry.json", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.NotContains(t, rec.Body.String(), "very-secret-token")
+
+	var raw map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &raw))
+	for _, key := range []string{"version", "commit", "build_date", "storage", "archive_formats", "features"} {
+		assert.Contains(t, raw, key)
+	}
+
+	var info discovery.Info
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.Equal(t, "s3", info.Storage)
+	assert.Equal(t, "zip", info.ArchiveFormats.Providers)
+	assert.Equal(t, []string{"static"}, info.Features.Auth)
+	assert.False(t, info.Features.DownloadProxy)
+	assert.True(t, info.Features.NetworkMirror)
+	assert.True(t, info.Features.PullThroughMirror)
+	assert.True(t, info.Features.RateLimit)
+	assert.False(t, info.Features.AuditLog)
+}
+
+func TestMirrorAuthMiddleware(t *testing.T) {
+	staticTokens, mirrorTokens := flagAuthStaticTokens, flagProviderNetworkMirrorTokens
+	oidcIssuer, oktaIssuer := flagAuthOidcIssuer, flagAuthOktaIssuer
+	t.Cleanup(func() {
+		flagAuthStaticTokens, flagProviderNetworkMirrorTokens = staticTokens, mirrorTokens
+		flagAuthOidcIssuer, flagAuthOktaIssuer = oidcIssuer, oktaIssuer
+	})
+
+	flagAuthStaticTokens = []string{"admin-token"}
+	flagProviderNetworkMirrorTokens = []string{"mirror-token"}
+	flagAuthOidcIssuer, flagAuthOktaIssuer = "", ""
+
+	providers, _, err := authProviders(context.Background())
+	assert.NoError(t, err)
+
+	nop := func(ctx context.Context, request interface{}) (interface{}, error) { return nil, nil }
+	call := func(mw endpoint.Middleware, token string) error {
+		_, err := mw(nop)(context.WithValue(context.Background(), jwt.JWTContextKey, token), nil)
+		return err
+	}
+
+	registry := auth.Middleware(providers...)
+	assert.NoError(t, call(registry, "admin-token"))
+	assert.ErrorIs(t, call(registry, "mirror-token"), core.ErrInvalidToken)
+
+	mirror := mirrorAuthMiddleware(providers)
+	assert.NoError(t, call(mirror, "admin-token"))
+	assert.NoError(t, call(mirror, "mirror-token"))
+	assert.ErrorIs(t, call(mirror, "other-token"), core.ErrInvalidToken)
+
+	// The claim errors of the auth providers aren't masked by the mirror tokens
+	mirror = mirrorAuthMiddleware(append(providers, forbiddingProvider{}))
+	assert.NoError(t, call(mirror, "mirror-token"))
+	assert.ErrorIs(t, call(mirror, "other-token"), core.ErrForbidden)
+}
+
+// forbiddingProvider rejects all tokens like an OIDC provider rejects tokens without the required claims
+type forbiddingProvider struct{}
+
+func (forbiddingProvider) Verify(context.Context, string) error { return core.ErrForbidden }
+
+func TestValidateStorageFlags(t *testing.T) {
+	tests := []struct {
+		name         string
+		flags        map[string]string
+		wantErr      string
+		wantWarnings []string
+	}{
+		{
+			name:    "missing bucket",
+			flags:   map[string]string{"storage-s3-region": "eu-central-1"},
+			wantErr: "storage provider is not specified",
+		},
+		{
+			name:  "s3",
+			flags: map[string]string{"storage-s3-bucket": "boring-registry", "storage-s3-region": "eu-central-1"},
+		},
+		{
+			name:  "gcs",
+			flags: map[string]string{"storage-gcs-bucket": "boring-registry", "storage-gcs-prefix": "registry"},
+		},
+		{
+			name:    "azure without account",
+			flags:   map[string]string{"storage-azure-container": "boring-registry"},
+			wantErr: "storage-azure-account is required",
+		},
+		{
+			name:  "azure",
+			flags: map[string]string{"storage-azure-account": "account", "storage-azure-container": "boring-registry"},
+		},
+		{
+			name:         "conflicting buckets",
+			flags:        map[string]string{"storage-s3-bucket": "boring-registry", "storage-gcs-bucket": "boring-registry"},
+			wantWarnings: []string{"the s3 storage backend is used, ignoring the gcs flags: storage-gcs-bucket"},
+		},
+		{
+			name:  "flags of another backend",
+			flags: map[string]string{"storage-gcs-bucket": "boring-registry", "storage-s3-region": "eu-central-1", "storage-s3-pathstyle": "true", "storage-azure-prefix": "registry"},
+			wantWarnings: []string{
+				"the gcs storage backend is used, ignoring the s3 flags: storage-s3-pathstyle, storage-s3-region",
+				"the gcs storage backend is used, ignoring the azure flags: storage-azure-prefix",
+			},
+		},
+		{
+			name:    "invalid retry attempts",
+			flags:   map[string]string{"storage-s3-bucket": "boring-registry", "storage-retry-max-attempts": "0"},
+			wantErr: "storage-retry-max-attempts must be at least 1",
+		},
+		{
+			name:    "list page size out of bounds",
+			flags:   map[string]string{"storage-s3-bucket": "boring-registry", "storage-list-page-size": "5000"},
+			wantErr: "invalid storage-list-page-size",
+		},
+		{
+			name:    "zstd module archives",
+			flags:   map[string]string{"storage-s3-bucket": "boring-registry", "storage-module-archive-format": "tar.zst"},
+			wantErr: "module archives in the tar.zst format can't be extracted by Terraform and OpenTofu",
+		},
+		{
+			name:  "allowed zstd module archives",
+			flags: map[string]string{"storage-s3-bucket": "boring-registry", "storage-module-archive-format": "tar.zst", "storage-module-archive-allow-zstd": "true"},
+		},
+		{
+			name:  "xz module archives",
+			flags: map[string]string{"storage-s3-bucket": "boring-registry", "storage-module-archive-format": "tar.xz"},
+		},
+		{
+			name:    "unsupported module archive format",
+			flags:   map[string]string{"storage-s3-bucket": "boring-registry", "storage-module-archive-format": "rar"},
+			wantErr: "unsupported module archive format",
+		},
+		{
+			name:  "public-read objects",
+			flags: map[string]string{"storage-s3-bucket": "boring-registry", "storage-s3-object-acl": "public-read"},
+		},
+		{
+			name:    "unsupported object ACL",
+			flags:   map[string]string{"storage-gcs-bucket": "boring-registry", "storage-gcs-object-acl": "authenticated-read"},
+			wantErr: "invalid storage-gcs-object-acl",
+		},
+		{
+			name:         "object ACL of another backend",
+			flags:        map[string]string{"storage-gcs-bucket": "boring-registry", "storage-s3-object-acl": "public-read"},
+			wantWarnings: []string{"the gcs storage backend is used, ignoring the s3 flags: storage-s3-object-acl"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetRootFlags(t)
+			for name, value := range tt.flags {
+				require.NoError(t, rootCmd.PersistentFlags().Set(name, value))
+			}
+
+			warnings, err := validateStorageFlags()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantWarnings, warnings)
+		})
+	}
+}
+
+type debugStorage struct {
+	prefix string
+}
+
+func (s *debugStorage) ListKeys(_ context.Context, prefix string, limit int) ([]string, error) {
+	s.prefix = prefix
+	return []string{"providers/acme/dummy/terraform-provider-dummy_1.0.0_linux_amd64.zip"}, nil
+}
+
+type noopInstrumentation struct{}
+
+func (noopInstrumentation) WrapHandler(handler http.Handler) http.HandlerFunc {
+	return handler.ServeHTTP
+}
+
+func TestRegisterDebug(t *testing.T) {
+	resetServerFlags(t)
+	authMiddleware := auth.Middleware(auth.NewStaticProvider("very-secret-token"))
+
+	request := func(token string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/v1/debug/storage?prefix=providers/acme/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return req
+	}
+
+	// The endpoint is disabled by default
+	mux := newRouteMux()
+	registerDebug(mux, &debugStorage{}, authMiddleware, nil, noopInstrumentation{})
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, request("very-secret-token"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	flagEnableStorageDebug = true
+	storage := &debugStorage{}
+	mux = newRouteMux()
+	registerDebug(mux, storage, authMiddleware, nil, noopInstrumentation{})
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, request(""))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, request("very-secret-token"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "providers/acme/", storage.prefix)
+	assert.JSONEq(t, `{
+		"prefix": "providers/acme/",
+		"keys": ["providers/acme/dummy/terraform-provider-dummy_1.0.0_linux_amd64.zip"],
+		"truncated": false
+	}`, rec.Body.String())
+}
+
+// catalogStorage counts the listings of all modules and providers
+type catalogStorage struct {
+	catalog.Storage
+	listings int
+}
+
+func (s *catalogStorage) ListAllModules(_ context.Context) ([]core.Module, error) {
+	s.listings++
+	return []core.Module{{Namespace: "acme", Name: "vpc", Provider: "aws", Version: "1.0.0"}}, nil
+}
+
+func (s *catalogStorage) ListAllProviders(_ context.Context) ([]*core.Provider, error) {
+	return nil, nil
+}
+
+// prefixCache records the invalidated prefix
+type prefixCache struct {
+	prefix string
+}
+
+func (c *prefixCache) InvalidateCache(_ context.Context, prefix string) int {
+	c.prefix = prefix
+	return 0
+}
+
+func TestRegisterAdmin(t *testing.T) {
+	authMiddleware := auth.Middleware(auth.NewStaticProvider("very-secret-token"))
+	storage := &catalogStorage{}
+	catalogService := catalog.NewService(storage, time.Hour)
+	cache := &prefixCache{}
+	mux := newRouteMux()
+	registerAdmin(mux, authMiddleware, nil, noopInstrumentation{}, cache, catalogService)
+
+	invalidate := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/admin/cache/invalidate?prefix=modules/acme/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, invalidate("").Code)
+
+	// Invalidating empty caches is a no-op
+	rec := invalidate("very-secret-token")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"prefix": "modules/acme/", "invalidated": 0}`, rec.Body.String())
+
+	_, err := catalogService.Catalog(context.Background(), "", catalog.DefaultLimit, "")
+	require.NoError(t, err)
+
+	rec = invalidate("very-secret-token")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"prefix": "modules/acme/", "invalidated": 1}`, rec.Body.String())
+	assert.Equal(t, "modules/acme/", cache.prefix)
+
+	// The cached listing was evicted
+	_, err = catalogService.Catalog(context.Background(), "", catalog.DefaultLimit, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, storage.listings)
+}
+
+func TestLimitRequestBody(t *testing.T) {
+	handler := limitRequestBody(1024 * 1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			core.EncodeError(err, w)
+			return
+		}
+		_, _ = fmt.Fprintf(w, "%d", len(b))
+	}))
+
+	tests := []struct {
+		name     string
+		size     int
+		chunked  bool
+		wantCode int
+	}{
+		{
+			name:     "within the limit",
+			size:     1024 * 1024,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "exceeding the limit",
+			size:     1024*1024 + 1,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "exceeding the limit without content length",
+			size:     2 * 1024 * 1024,
+			chunked:  true,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/mirror/copy", bytes.NewReader(make([]byte, tt.size)))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, fmt.Sprintf("%d", tt.size), rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestClearWriteDeadline(t *testing.T) {
+	handler := clearWriteDeadline(prefixProxy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte("archive"))
+	}))
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + prefixProxy + "/archive.zip")
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "archive", string(b))
+
+	// The write timeout still applies to all other requests
+	_, err = server.Client().Get(server.URL + prefixModules + "/acme/vpc/aws/versions")
+	assert.Error(t, err)
+}
+
+func TestShutdownServer(t *testing.T) {
+	started := make(chan struct{})
+	inFlight := &inFlightRequests{}
+	server := &http.Server{
+		Handler: inFlight.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(300 * time.Millisecond)
+			_, _ = w.Write([]byte("archive"))
+		})),
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = server.Serve(listener) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/v1/proxy/archive.zip")
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		done <- result{body: string(b), err: err}
+	}()
+
+	<-started
+	assert.Equal(t, int64(1), inFlight.count.Load())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, shutdownServer(ctx, server, inFlight))
+
+	// The slow request finished during the grace period instead of being cut off
+	res := <-done
+	require.NoError(t, res.err)
+	assert.Equal(t, "archive", res.body)
+	assert.Equal(t, int64(0), inFlight.count.Load())
+}
+
+func TestShutdownServer_gracePeriodExceeded(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}),
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = server.Serve(listener) }()
+	go func() { _, _ = http.Get("http://" + listener.Addr().String() + "/") }()
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, shutdownServer(ctx, server, nil), context.DeadlineExceeded)
+}
+
+func TestRouteHosts(t *testing.T) {
+	prefixes, err := parseHostStoragePrefixes([]string{"registry.example.com=terraform", "Tofu.example.com=/tofu/"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"registry.example.com": "terraform", "tofu.example.com": "tofu"}, prefixes)
+
+	handler := routeHosts(prefixes)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, core.StoragePrefix(r.Context()))
+	}))
+
+	for host, want := range map[string]string{
+		"registry.example.com":      "terraform",
+		"tofu.example.com:443":      "tofu",
+		"TOFU.example.com":          "tofu",
+		"other.example.com":         "",
+		"registry.example.com.evil": "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/terraform.json", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, want, rec.Body.String(), host)
+	}
+
+	for _, invalid := range [][]string{
+		{"registry.example.com"},
+		{"registry.example.com="},
+		{"registry.example.com=../other"},
+		{"registry.example.com=providers"},
+		{"registry.example.com=a", "REGISTRY.example.com=b"},
+	} {
+		_, err := parseHostStoragePrefixes(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+// versionsStorage lists a single version of every module
+type versionsStorage struct {
+	module.Storage
+}
+
+func (versionsStorage) ListModuleVersions(_ context.Context, namespace, name, provider string) ([]core.Module, error) {
+	return []core.Module{{Namespace: namespace, Name: name, Provider: provider, Version: "1.0.0"}}, nil
+}
+
+func TestAllowAnonymousRead(t *testing.T) {
+	resetServerFlags(t)
+	flagAllowAnonymousRead = true
+	flagProviderNetworkMirrorCopyEndpoint = true
+
+	providers := []auth.Provider{auth.NewStaticProvider("very-secret-token")}
+	metrics := &o11y.ModuleMetrics{
+		ListVersions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "list_versions"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel}),
+	}
+
+	mux := newRouteMux()
+	require.NoError(t, registerModule(mux, versionsStorage{}, readAuthMiddleware(providers), nil, metrics, noopInstrumentation{}, core.NewProxyUrlService(false, prefixProxy), audit.NoOpAuditLogger{}))
+	require.NoError(t, registerMirrorCopy(mux, nil, nil, auth.Middleware(providers...), noopInstrumentation{}))
+
+	request := func(method, target, token string) int {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
 		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
 	}
+
+	const versions = "/v1/modules/acme/vpc/aws/versions"
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, versions, ""))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, versions, "very-secret-token"))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, versions, "wrong-token"))
+
+	// Writes still require a token
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "/v1/mirror/registry.terraform.io/hashicorp/random/3.6.0", ""))
+
+	// Reads require a token without the flag
+	flagAllowAnonymousRead = false
+	mux = newRouteMux()
+	require.NoError(t, registerModule(mux, versionsStorage{}, readAuthMiddleware(providers), nil, metrics, noopInstrumentation{}, core.NewProxyUrlService(false, prefixProxy), audit.NoOpAuditLogger{}))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, versions, ""))
+}
+
+func TestStaticTokenScopes(t *testing.T) {
+	resetFlags(serverCmd.Flags())
+	resetServerFlags(t)
+	flagAuthStaticTokens = []string{"admin-token"}
+	flagAuthStaticTokensRO = []string{"ro-token"}
+
+	providers, _, err := authProviders(context.Background())
+	require.NoError(t, err)
+	authMiddleware := auth.Middleware(providers...)
+	metrics := &o11y.ModuleMetrics{
+		ListVersions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "list_versions"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel}),
+	}
+
+	mux := newRouteMux()
+	require.NoError(t, registerModule(mux, versionsStorage{}, authMiddleware, nil, metrics, noopInstrumentation{}, core.NewProxyUrlService(false, prefixProxy), audit.NoOpAuditLogger{}))
+	registerAdmin(mux, writeAuthMiddleware(authMiddleware), nil, noopInstrumentation{}, &prefixCache{})
+
+	request := func(method, target, token string) int {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	const versions = "/v1/modules/acme/vpc/aws/versions"
+	const invalidate = "/v1/admin/cache/invalidate?prefix=modules/acme/"
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, versions, "ro-token"))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, versions, "admin-token"))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, invalidate, "ro-token"))
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, invalidate, "admin-token"))
+}
+
+func TestRegisterOpenAPI(t *testing.T) {
+	resetServerFlags(t)
+	nop := func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	proxyUrlService := core.NewProxyUrlService(false, prefixProxy)
+
+	document := func(t *testing.T, register func(mux *routeMux)) *openapi.Document {
+		mux := newRouteMux()
+		register(mux)
+		require.NoError(t, registerOpenAPI(mux))
+
+		// The document is served without a token
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		var doc openapi.Document
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+		require.NoError(t, doc.Validate())
+		return &doc
+	}
+
+	doc := document(t, func(mux *routeMux) {
+		require.NoError(t, registerModule(mux, versionsStorage{}, nop, nil, nil, noopInstrumentation{}, proxyUrlService, audit.NoOpAuditLogger{}))
+		require.NoError(t, registerProvider(mux, nil, nop, nil, nil, noopInstrumentation{}, proxyUrlService, audit.NoOpAuditLogger{}))
+		registerCatalog(mux, catalog.NewService(&catalogStorage{}, time.Hour), nop, noopInstrumentation{})
+	})
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+	assert.Contains(t, doc.Paths["/openapi.json"], "get")
+	assert.Contains(t, doc.Paths["/v1/catalog"], "get")
+	assert.Contains(t, doc.Paths["/v1/modules/"], "get")
+	assert.Contains(t, doc.Paths["/v1/providers/batch"], "post")
+	assert.NotContains(t, doc.Paths, "/v1/admin/cache/invalidate")
+	assert.NotContains(t, doc.Paths, "/v1/debug/storage")
+	assert.Contains(t, doc.Components.SecuritySchemes, "bearerAuth")
+	// The routes of the Terraform protocols are registered, but not described
+	assert.NotContains(t, doc.Paths, "/v1/modules/{namespace}/{name}/{provider}/versions")
+	assert.NotContains(t, doc.Paths, "/v1/providers/{namespace}/{name}/versions")
+
+	flagEnableStorageDebug = true
+	flagProviderNetworkMirrorCopyEndpoint = true
+	doc = document(t, func(mux *routeMux) {
+		registerAdmin(mux, nop, nil, noopInstrumentation{}, &prefixCache{})
+		registerDebug(mux, &debugStorage{}, nop, nil, noopInstrumentation{})
+		require.NoError(t, registerMirrorCopy(mux, nil, nil, nop, noopInstrumentation{}))
+	})
+	assert.Contains(t, doc.Paths["/v1/admin/cache/invalidate"], "post")
+	assert.Contains(t, doc.Paths["/v1/debug/storage"], "get")
+	assert.Contains(t, doc.Paths["/v1/mirror/{hostname}/{namespace}/{name}/{version}"], "post")
+	assert.NotContains(t, doc.Paths, "/v1/catalog")
+}
+
+func TestDisableRegistries(t *testing.T) {
+	discoveryDocument := func(t *testing.T, mux http.Handler) map[string]json.RawMessage {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/terraform.json", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var raw map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &raw))
+		return raw
+	}
+	metrics := &o11y.ModuleMetrics{
+		ListVersions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "list_versions"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel}),
+	}
+	nop := func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	const versions = "/v1/modules/acme/vpc/aws/versions"
+
+	t.Run("all registries", func(t *testing.T) {
+		resetServerFlags(t)
+		mux := newRouteMux()
+		require.NoError(t, registerDiscovery(mux, nil))
+		require.NoError(t, registerModule(mux, versionsStorage{}, nop, nil, metrics, noopInstrumentation{}, core.NewProxyUrlService(false, prefixProxy), audit.NoOpAuditLogger{}))
+
+		raw := discoveryDocument(t, mux)
+		assert.Contains(t, raw, "modules.v1")
+		assert.Contains(t, raw, "providers.v1")
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, versions, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("modules disabled", func(t *testing.T) {
+		resetServerFlags(t)
+		flagDisableModules = true
+		mux := newRouteMux()
+		require.NoError(t, registerDiscovery(mux, nil))
+		require.NoError(t, registerModule(mux, versionsStorage{}, nop, nil, metrics, noopInstrumentation{}, core.NewProxyUrlService(false, prefixProxy), audit.NoOpAuditLogger{}))
+
+		raw := discoveryDocument(t, mux)
+		assert.NotContains(t, raw, "modules.v1")
+		assert.Contains(t, raw, "providers.v1")
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, versions, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("providers disabled", func(t *testing.T) {
+		resetServerFlags(t)
+		flagDisableProviders = true
+		mux := newRouteMux()
+		require.NoError(t, registerDiscovery(mux, nil))
+		require.NoError(t, registerProvider(mux, nil, nop, nil, nil, noopInstrumentation{}, core.NewProxyUrlService(false, prefixProxy), audit.NoOpAuditLogger{}))
+
+		raw := discoveryDocument(t, mux)
+		assert.Contains(t, raw, "modules.v1")
+		assert.NotContains(t, raw, "providers.v1")
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/providers/acme/dummy/versions", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestProviderDefaultPlatform(t *testing.T) {
+	p, err := providerDefaultPlatform("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, core.Platform{}, p)
+
+	p, err = providerDefaultPlatform("linux", "arm64")
+	assert.NoError(t, err)
+	assert.Equal(t, core.Platform{OS: "linux", Arch: "arm64"}, p)
+
+	p, err = providerDefaultPlatform("host", "host")
+	assert.NoError(t, err)
+	assert.Equal(t, core.Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}, p)
+
+	_, err = providerDefaultPlatform("linux", "")
+	assert.Error(t, err)
 }
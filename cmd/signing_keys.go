@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/provider"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagSigningKeysNamespace string
+	flagSigningKeySource     string
+	flagSigningKeySourceURL  string
+)
+
+func init() {
+	rootCmd.AddCommand(signingKeysCmd)
+	signingKeysCmd.AddCommand(signingKeysAddCmd, signingKeysRemoveCmd)
+
+	signingKeysCmd.PersistentFlags().StringVar(&flagSigningKeysNamespace, flagProviderNamespaceName, "", "The namespace of the signing keys")
+	if err := signingKeysCmd.MarkPersistentFlagRequired(flagProviderNamespaceName); err != nil {
+		panic(fmt.Errorf("failed to mark flag %s as required: %w", flagProviderNamespaceName, err))
+	}
+
+	signingKeysAddCmd.Flags().StringVar(&flagSigningKeySource, "source", "", "Name of the organization that owns the key, shown by Terraform during the installation")
+	signingKeysAddCmd.Flags().StringVar(&flagSigningKeySourceURL, "source-url", "", "URL with more information about the key")
+}
+
+var signingKeysCmd = &cobra.Command{
+	Use:   "signing-keys",
+	Short: "Manage the GPG public keys that providers of a namespace are verified with",
+}
+
+var signingKeysAddCmd = &cobra.Command{
+	Use:   "add KEY_FILE",
+	Short: "Add an ASCII-armored GPG public key to the signing keys of the namespace",
+	Long: `Add an ASCII-armored GPG public key to the signing keys of the namespace.
+The existing keys are kept, so that providers signed with any of the keys can be installed during a key rotation.
+A key with the same key ID is replaced.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		armored, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read public key: %w", err)
+		}
+		key, err := core.ParseGPGPublicKey(string(armored))
+		if err != nil {
+			return err
+		}
+		key.Source = flagSigningKeySource
+		key.SourceURL = flagSigningKeySourceURL
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		storageBackend, err := setupStorage(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to set up storage: %w", err)
+		}
+		return addSigningKey(ctx, storageBackend, flagSigningKeysNamespace, key)
+	},
+}
+
+var signingKeysRemoveCmd = &cobra.Command{
+	Use:          "remove KEY_ID",
+	Short:        "Remove a revoked GPG public key from the signing keys of the namespace",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		storageBackend, err := setupStorage(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to set up storage: %w", err)
+		}
+		return removeSigningKey(ctx, storageBackend, flagSigningKeysNamespace, args[0])
+	},
+}
+
+// addSigningKey reads the signing keys of the namespace, adds the key and writes them back.
+// The signing keys are created if the namespace doesn't have any yet
+func addSigningKey(ctx context.Context, storage provider.Storage, namespace string, key core.GPGPublicKey) error {
+	signingKeys, err := storage.SigningKeys(ctx, namespace)
+	if errors.Is(err, core.ErrObjectNotFound) {
+		signingKeys = &core.SigningKeys{}
+	} else if err != nil {
+		return err
+	}
+
+	replaced := signingKeys.AddKey(key)
+	if err := storage.UploadSigningKeys(ctx, namespace, signingKeys); err != nil {
+		return fmt.Errorf("failed to upload signing keys for namespace %s: %w", namespace, err)
+	}
+
+	if replaced {
+		slog.Info("replaced signing key", slog.String("namespace", namespace), slog.String("key-id", key.KeyID))
+	} else {
+		slog.Info("added signing key", slog.String("namespace", namespace), slog.String("key-id", key.KeyID), slog.Int("keys", len(signingKeys.GPGPublicKeys)))
+	}
+	return nil
+}
+
+// removeSigningKey reads the signing keys of the namespace, removes the key and writes them back
+func removeSigningKey(ctx context.Context, storage provider.Storage, namespace, keyID string) error {
+	signingKeys, err := storage.SigningKeys(ctx, namespace)
+	if err != nil {
+		return err
+	}
+
+	if !signingKeys.RemoveKey(keyID) {
+		return fmt.Errorf("namespace %s doesn't have a signing key with the ID %s", namespace, keyID)
+	}
+	if len(signingKeys.GPGPublicKeys) == 0 {
+		slog.Warn("removed the last signing key, providers of the namespace can't be installed until a new key is added", slog.String("namespace", namespace))
+	}
+
+	if err := storage.UploadSigningKeys(ctx, namespace, signingKeys); err != nil {
+		return fmt.Errorf("failed to upload signing keys for namespace %s: %w", namespace, err)
+	}
+	slog.Info("removed signing key", slog.String("namespace", namespace), slog.String("key-id", keyID))
+	return nil
+}
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/provider"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signingKeysStorage keeps the serialized signing-keys.json per namespace, like the storage backends do
+type signingKeysStorage struct {
+	provider.Storage
+	files map[string][]byte
+}
+
+func (s *signingKeysStorage) SigningKeys(_ context.Context, namespace string) (*core.SigningKeys, error) {
+	b, ok := s.files[namespace]
+	if !ok {
+		return nil, core.ErrObjectNotFound
+	}
+	var keys core.SigningKeys
+	err := json.Unmarshal(b, &keys)
+	return &keys, err
+}
+
+// ProviderSigningKeys returns the keys of the namespace, as no version or provider has its own keys
+func (s *signingKeysStorage) ProviderSigningKeys(ctx context.Context, namespace, _, _ string) (*core.SigningKeys, error) {
+	return s.SigningKeys(ctx, namespace)
+}
+
+func (s *signingKeysStorage) UploadSigningKeys(_ context.Context, namespace string, signingKeys *core.SigningKeys) error {
+	b, err := json.Marshal(signingKeys)
+	s.files[namespace] = b
+	return err
+}
+
+func newSigningKey(t *testing.T) (*openpgp.Entity, core.GPGPublicKey) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("boring-registry", "", "test@example.com", nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+
+	key, err := core.ParseGPGPublicKey(buf.String())
+	require.NoError(t, err)
+	return entity, key
+}
+
+func TestSigningKeys_addAndRemove(t *testing.T) {
+	ctx := context.Background()
+	storage := &signingKeysStorage{files: make(map[string][]byte)}
+	oldEntity, oldKey := newSigningKey(t)
+	newEntity, newKey := newSigningKey(t)
+
+	require.NoError(t, addSigningKey(ctx, storage, "acme", oldKey))
+	require.NoError(t, addSigningKey(ctx, storage, "acme", newKey))
+	// Adding a key again doesn't duplicate it
+	require.NoError(t, addSigningKey(ctx, storage, "acme", newKey))
+
+	keys, err := storage.SigningKeys(ctx, "acme")
+	require.NoError(t, err)
+	require.Len(t, keys.GPGPublicKeys, 2)
+	assert.Equal(t, oldKey.KeyID, keys.GPGPublicKeys[0].KeyID)
+	assert.Equal(t, newKey.KeyID, keys.GPGPublicKeys[1].KeyID)
+
+	sums := []byte("5f9c7aa76b7c34d722fc9123208e26b22d60440cb47150dd04733b9b94f4541a  terraform-provider-dummy_1.0.0_linux_amd64.zip\n")
+	sign := func(e *openpgp.Entity) []byte {
+		var sig bytes.Buffer
+		require.NoError(t, openpgp.DetachSign(&sig, e, bytes.NewReader(sums), nil))
+		return sig.Bytes()
+	}
+	assert.NoError(t, keys.IsValidSha256Sums(sums, sign(oldEntity)))
+	assert.NoError(t, keys.IsValidSha256Sums(sums, sign(newEntity)))
+
+	require.NoError(t, removeSigningKey(ctx, storage, "acme", oldKey.KeyID))
+	assert.Error(t, removeSigningKey(ctx, storage, "acme", oldKey.KeyID))
+
+	keys, err = storage.SigningKeys(ctx, "acme")
+	require.NoError(t, err)
+	require.Len(t, keys.GPGPublicKeys, 1)
+	assert.Error(t, keys.IsValidSha256Sums(sums, sign(oldEntity)))
+	assert.NoError(t, keys.IsValidSha256Sums(sums, sign(newEntity)))
+
+	// Other namespaces are untouched
+	assert.ErrorIs(t, removeSigningKey(ctx, storage, "other", newKey.KeyID), core.ErrObjectNotFound)
+}
+
+func TestReadSigningKeyFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	_, key := newSigningKey(t)
+	_, armoredKey := newSigningKey(t)
+
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+		return p
+	}
+	signingKeysJSON := func(keys ...core.GPGPublicKey) string {
+		b, err := json.Marshal(core.SigningKeys{GPGPublicKeys: keys})
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	t.Run("new signing keys are uploaded", func(t *testing.T) {
+		key := key
+		key.Source = "ACME Inc."
+		keys, err := readSigningKeyFiles(write("signing-keys.json", signingKeysJSON(key)), write("key.asc", armoredKey.ASCIIArmor))
+		require.NoError(t, err)
+		require.Len(t, keys, 2)
+		assert.Equal(t, "ACME Inc.", keys[0].Source)
+
+		storage := &signingKeysStorage{files: make(map[string][]byte)}
+		signingKeys, releaseKeys, err := mergeSigningKeys(ctx, storage, "acme", "dummy", "0.1.0", keys)
+		require.NoError(t, err)
+		assert.Equal(t, signingKeys, releaseKeys)
+		require.NoError(t, storage.UploadSigningKeys(ctx, "acme", signingKeys))
+
+		stored, err := storage.SigningKeys(ctx, "acme")
+		require.NoError(t, err)
+		require.Len(t, stored.GPGPublicKeys, 2)
+		assert.Equal(t, key.KeyID, stored.GPGPublicKeys[0].KeyID)
+		assert.Equal(t, armoredKey.KeyID, stored.GPGPublicKeys[1].KeyID)
+
+		// Existing keys are kept and the same key isn't added twice
+		signingKeys, _, err = mergeSigningKeys(ctx, storage, "acme", "dummy", "0.1.0", keys[:1])
+		require.NoError(t, err)
+		assert.Len(t, signingKeys.GPGPublicKeys, 2)
+	})
+
+	t.Run("the version has its own signing keys", func(t *testing.T) {
+		_, versionKey := newSigningKey(t)
+		storage := &releaseStorage{
+			signingKeysStorage: &signingKeysStorage{files: make(map[string][]byte)},
+			versionKeys:        &core.SigningKeys{GPGPublicKeys: []core.GPGPublicKey{versionKey}},
+		}
+
+		// The added keys don't apply to the version, so it has to be signed by its own keys
+		signingKeys, releaseKeys, err := mergeSigningKeys(ctx, storage, "acme", "dummy", "0.1.0", []core.GPGPublicKey{key})
+		require.NoError(t, err)
+		assert.Equal(t, []core.GPGPublicKey{key}, signingKeys.GPGPublicKeys)
+		assert.Equal(t, storage.versionKeys, releaseKeys)
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		keys, err := readSigningKeyFiles("", "")
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+
+		// The missing signing keys are still an error if no keys are added
+		storage := &signingKeysStorage{files: make(map[string][]byte)}
+		_, _, err = mergeSigningKeys(ctx, storage, "acme", "dummy", "0.1.0", keys)
+		assert.ErrorIs(t, err, core.ErrObjectNotFound)
+	})
+
+	t.Run("malformed armored key", func(t *testing.T) {
+		malformed := core.GPGPublicKey{KeyID: key.KeyID, ASCIIArmor: "-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nnot a key\n-----END PGP PUBLIC KEY BLOCK-----"}
+		_, err := readSigningKeyFiles(write("malformed.json", signingKeysJSON(malformed)), "")
+		assert.ErrorContains(t, err, "invalid signing key")
+
+		_, err = readSigningKeyFiles("", write("malformed.asc", malformed.ASCIIArmor))
+		assert.ErrorContains(t, err, "invalid public key")
+	})
+
+	t.Run("key ID doesn't match the armored key", func(t *testing.T) {
+		mismatch := core.GPGPublicKey{KeyID: armoredKey.KeyID, ASCIIArmor: key.ASCIIArmor}
+		_, err := readSigningKeyFiles(write("mismatch.json", signingKeysJSON(mismatch)), "")
+		assert.ErrorContains(t, err, "doesn't match")
+	})
+
+	t.Run("empty signing keys", func(t *testing.T) {
+		_, err := readSigningKeyFiles(write("empty.json", `{"gpg_public_keys": []}`), "")
+		assert.Error(t, err)
+	})
+}
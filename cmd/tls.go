@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/boring-registry/boring-registry/pkg/mirror"
+)
+
+// upstreamTLSConfig returns the TLS settings of the connections to upstream registries.
+// The certificates of the CA files are trusted in addition to the system roots, nil is returned if the defaults apply.
+func upstreamTLSConfig(caFiles []string, insecureSkipVerify bool) (*tls.Config, error) {
+	if len(caFiles) == 0 && !insecureSkipVerify {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(caFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			slog.Warn("failed to load the system root CAs, only the configured CAs are trusted", slog.String("err", err.Error()))
+			pool = x509.NewCertPool()
+		}
+
+		for _, f := range caFiles {
+			pem, err := os.ReadFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("CA certificate file %s doesn't contain any PEM encoded certificate", f)
+			}
+		}
+		cfg.RootCAs = pool
+	}
+
+	if insecureSkipVerify {
+		slog.Warn("TLS certificate verification of upstream registries is disabled, this must never be used in production")
+		cfg.InsecureSkipVerify = true
+	}
+	return cfg, nil
+}
+
+// mirrorUpstreamOptions returns the options of the mirror components that connect to upstream registries
+func mirrorUpstreamOptions() ([]mirror.Option, error) {
+	cfg, err := upstreamTLSConfig(flagTLSCACertFiles, flagTLSInsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []mirror.Option{mirror.WithUserAgent(flagOutboundUserAgent)}
+	if cfg != nil {
+		opts = append(opts, mirror.WithUpstreamTLSConfig(cfg))
+	}
+	return opts, nil
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	get := func(t *testing.T, transport *http.Transport) error {
+		t.Helper()
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := upstreamTLSConfig(nil, false)
+		require.NoError(t, err)
+		assert.Nil(t, cfg)
+
+		// The test server's certificate isn't signed by a system root CA
+		assert.ErrorContains(t, get(t, &http.Transport{}), "certificate")
+	})
+
+	t.Run("private CA is trusted", func(t *testing.T) {
+		cfg, err := upstreamTLSConfig([]string{caFile}, false)
+		require.NoError(t, err)
+		assert.False(t, cfg.InsecureSkipVerify)
+		assert.NoError(t, get(t, &http.Transport{TLSClientConfig: cfg}))
+	})
+
+	t.Run("insecure skip verify", func(t *testing.T) {
+		cfg, err := upstreamTLSConfig(nil, true)
+		require.NoError(t, err)
+		assert.NoError(t, get(t, &http.Transport{TLSClientConfig: cfg}))
+	})
+
+	t.Run("invalid CA file", func(t *testing.T) {
+		invalid := filepath.Join(dir, "invalid.pem")
+		require.NoError(t, os.WriteFile(invalid, []byte("not a certificate"), 0o600))
+
+		_, err := upstreamTLSConfig([]string{invalid}, false)
+		assert.ErrorContains(t, err, "doesn't contain any PEM encoded certificate")
+
+		_, err = upstreamTLSConfig([]string{filepath.Join(dir, "missing.pem")}, false)
+		assert.Error(t, err)
+	})
+}
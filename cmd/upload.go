@@ -3,16 +3,24 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/module"
 	"github.com/boring-registry/boring-registry/pkg/provider"
+	"github.com/boring-registry/boring-registry/pkg/signing"
 
 	"github.com/hashicorp/go-version"
 	"github.com/spf13/cobra"
@@ -28,11 +36,27 @@ var (
 	flagIgnoreExistingModule     bool
 	flagVersionConstraintsRegex  string
 	flagVersionConstraintsSemver string
+	flagReproducibleArchives     bool
+	flagUploadRetries            int
+	flagUploadRetryDelay         time.Duration
+
+	// upload module from URL flags
+	flagModuleFromURL        string
+	flagModuleFromURLHeaders []string
+	flagModuleFromURLTimeout time.Duration
+	flagModuleNamespace      string
+	flagModuleName           string
+	flagModuleProvider       string
+	flagModuleVersion        string
 
 	// upload provider flags
-	flagFileSha256Sums       string
-	flagProviderArchivePaths []string
-	flagProviderNamespace    string
+	flagFileSha256Sums         string
+	flagProviderArchivePaths   []string
+	flagProviderNamespace      string
+	flagProviderKMSSigningKey  string
+	flagProviderSigningKeyFile string
+	flagProviderGPGPublicKey   string
+	flagVerifyProviderRelease  bool
 )
 
 var (
@@ -46,15 +70,36 @@ func init() {
 	uploadProviderCmd.Flags().StringVar(&flagFileSha256Sums, flagFileSha256SumsName, "", "The absolute path to the *_SHA256SUMS file")
 	uploadProviderCmd.Flags().StringSliceVar(&flagProviderArchivePaths, "filenames-provider-archives", []string{}, "A list of file paths to provider ZIP archives")
 	uploadProviderCmd.Flags().StringVar(&flagProviderNamespace, flagProviderNamespaceName, "", "The namespace under which the provider will be uploaded")
+	uploadProviderCmd.Flags().StringVar(&flagProviderKMSSigningKey, "provider-kms-signing-key", "", `Sign the SHA256SUMS file with an asymmetric RSA key from a cloud KMS instead of uploading an existing *.sig file.
+The public key is added to the signing keys of the namespace. Accepts an AWS KMS key ARN or alias,
+or a Google Cloud KMS key version resource name (projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*)`)
+	uploadProviderCmd.Flags().StringVar(&flagProviderSigningKeyFile, "signing-key-file", "", `Add the keys of a signing-keys.json file to the signing keys of the namespace.
+Existing keys are kept, a key with the same key ID is replaced`)
+	uploadProviderCmd.Flags().StringVar(&flagProviderGPGPublicKey, "gpg-public-key", "", "Add an ASCII-armored GPG public key file to the signing keys of the namespace")
+	uploadProviderCmd.MarkFlagsMutuallyExclusive("provider-kms-signing-key", "signing-key-file")
+	uploadProviderCmd.MarkFlagsMutuallyExclusive("provider-kms-signing-key", "gpg-public-key")
+	uploadProviderCmd.Flags().BoolVar(&flagVerifyProviderRelease, "verify-release", true, `Download the uploaded archives and verify them against the SHA256SUMS file before the signature is uploaded.
+The upload fails if a checksum doesn't match`)
 	for _, f := range []string{flagFileSha256SumsName, flagProviderNamespaceName} {
 		if err := uploadProviderCmd.MarkFlagRequired(f); err != nil {
 			panic(fmt.Errorf("failed to mark flag %s as required: %w", f, err))
 		}
 	}
+	uploadModuleCmd.Flags().StringVar(&flagModuleFromURL, "from-url", "", `Upload the archive at the URL instead of a local module directory, it has to match the --storage-module-archive-format.
+The archive is streamed into the storage without extracting it, the module address is set with the --module-* flags`)
+	uploadModuleCmd.Flags().StringArrayVar(&flagModuleFromURLHeaders, "from-url-header", []string{}, `Headers in the "Name: value" format that are sent with the request to the --from-url, e.g. for authentication. Can be specified multiple times`)
+	uploadModuleCmd.Flags().DurationVar(&flagModuleFromURLTimeout, "from-url-timeout", 2*time.Minute, "Maximum duration of the download from the --from-url, including reading the archive")
+	uploadModuleCmd.Flags().StringVar(&flagModuleNamespace, "module-namespace", "", "The namespace of the module uploaded with --from-url")
+	uploadModuleCmd.Flags().StringVar(&flagModuleName, "module-name", "", "The name of the module uploaded with --from-url")
+	uploadModuleCmd.Flags().StringVar(&flagModuleProvider, "module-provider", "", "The provider of the module uploaded with --from-url")
+	uploadModuleCmd.Flags().StringVar(&flagModuleVersion, "module-version", "", "The version of the module uploaded with --from-url")
 	uploadCmd.AddCommand(uploadModuleCmd, uploadProviderCmd)
 
 	uploadCmd.PersistentFlags().BoolVar(&flagRecursive, "recursive", true, "Recursively traverse <dir> and upload all modules in subdirectories")
-	uploadCmd.PersistentFlags().BoolVar(&flagIgnoreExistingModule, "ignore-existing", true, "Ignore already existing modules. If set to false upload will fail immediately if a module already exists in that version")
+	uploadCmd.PersistentFlags().BoolVar(&flagIgnoreExistingModule, "ignore-existing", true, "Ignore already existing modules. If set to false, existing versions are compared to the archive and the upload only fails if the content differs")
+	uploadCmd.PersistentFlags().BoolVar(&flagReproducibleArchives, "reproducible-archives", true, "Create module archives with sorted entries and normalized file metadata, so that identical module contents result in identical checksums")
+	uploadCmd.PersistentFlags().IntVar(&flagUploadRetries, "upload-retries", 3, "Number of retries for module uploads that failed with a transient error")
+	uploadCmd.PersistentFlags().DurationVar(&flagUploadRetryDelay, "upload-retry-delay", time.Second, "Delay before the first retry of a module upload, which doubles with every further retry")
 	uploadCmd.PersistentFlags().StringVar(&flagVersionConstraintsRegex, "version-constraints-regex", "", `Limit the module versions that are eligible for upload with a regex that a version has to match.
 Can be combined with the -version-constraints-semver flag`)
 	uploadCmd.PersistentFlags().StringVar(&flagVersionConstraintsSemver, "version-constraints-semver", "", `Limit the module versions that are eligible for upload with version constraints.
@@ -85,11 +130,18 @@ var uploadProviderCmd = &cobra.Command{
 }
 
 func uploadModule(cmd *cobra.Command, args []string) error {
-	storageBackend, err := setupStorage(context.Background())
+	storageBackend, err := setupStorage(context.Background(), nil)
 	if err != nil {
 		return fmt.Errorf("failed to set up storage: %w", err)
 	}
 
+	if flagModuleFromURL != "" {
+		// The download is canceled when the command is interrupted
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return uploadModuleFromURL(ctx, storageBackend)
+	}
+
 	if len(args) == 0 {
 		return fmt.Errorf("missing argument")
 	}
@@ -119,6 +171,38 @@ func uploadModule(cmd *cobra.Command, args []string) error {
 	return archiveModules(args[0], storageBackend)
 }
 
+func uploadModuleFromURL(ctx context.Context, storage module.Storage) error {
+	headers, err := parseHeaders(flagModuleFromURLHeaders)
+	if err != nil {
+		return err
+	}
+
+	spec := &module.Spec{
+		Metadata: module.Metadata{
+			Namespace: flagModuleNamespace,
+			Name:      flagModuleName,
+			Provider:  flagModuleProvider,
+			Version:   flagModuleVersion,
+		},
+	}
+	// The timeout includes reading the archive, so that a stalled server never blocks the upload forever
+	client := &http.Client{Timeout: flagModuleFromURLTimeout, Transport: core.NewUserAgentTransport(nil, flagOutboundUserAgent)}
+	return processRemoteModule(ctx, spec, flagModuleFromURL, headers, client, storage)
+}
+
+// parseHeaders parses headers in the "Name: value" format
+func parseHeaders(raw []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, h := range raw {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected format \"Name: value\"", h)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
 func uploadProvider(cmd *cobra.Command, args []string) error {
 	if !filepath.IsAbs(flagFileSha256Sums) {
 		return fmt.Errorf("file path is not absolute: %s", flagFileSha256Sums)
@@ -139,49 +223,86 @@ func uploadProvider(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	providerName, err := sums.Name()
+	if err != nil {
+		return fmt.Errorf("failed to parse provider name: %v", err)
+	}
+	providerVersion, err := sums.Version()
+	if err != nil {
+		return fmt.Errorf("failed to parse provider version: %v", err)
+	}
+
+	// The keys are parsed before anything is uploaded, so that a malformed key doesn't leave a partial release behind
+	newSigningKeys, err := readSigningKeyFiles(flagProviderSigningKeyFile, flagProviderGPGPublicKey)
+	if err != nil {
+		return err
+	}
+
 	ctx := context.Background()
 	setupCtx, cancelSetupCtx := context.WithTimeout(ctx, 15*time.Second)
 	defer cancelSetupCtx()
-	storageBackend, err := setupStorage(setupCtx)
+	storageBackend, err := setupStorage(setupCtx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to set up storage: %w", err)
 	}
 
-	validateCtx, cancelValidateCtx := context.WithTimeout(ctx, 15*time.Second)
-	defer cancelValidateCtx()
-	signingKeys, err := storageBackend.SigningKeys(validateCtx, flagProviderNamespace)
+	unlock, err := lockProviderVersion(ctx, storageBackend, flagProviderNamespace, providerName, providerVersion)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
 	sumsBytes, err := os.ReadFile(flagFileSha256Sums)
 	if err != nil {
 		return fmt.Errorf("failed to read file at path %s: %w", flagFileSha256Sums, err)
 	}
 
-	// We expect the signature to be suffixed with the .sig extension
-	// https://developer.hashicorp.com/terraform/registry/providers/publishing#manually-preparing-a-release
-	p := fmt.Sprintf("%s.sig", flagFileSha256Sums)
-	sumsSigBytes, err := os.ReadFile(p)
-	if err != nil {
-		return fmt.Errorf("failed to read file at path %s: %w", p, err)
+	validateCtx, cancelValidateCtx := context.WithTimeout(ctx, 15*time.Second)
+	defer cancelValidateCtx()
+	var sumsSigBytes []byte
+	if flagProviderKMSSigningKey != "" {
+		var publicKey core.GPGPublicKey
+		publicKey, sumsSigBytes, err = signSha256SumsWithKMS(validateCtx, sumsBytes)
+		if err != nil {
+			return err
+		}
+		newSigningKeys = []core.GPGPublicKey{publicKey}
+	} else {
+		// We expect the signature to be suffixed with the .sig extension
+		// https://developer.hashicorp.com/terraform/registry/providers/publishing#manually-preparing-a-release
+		p := fmt.Sprintf("%s.sig", flagFileSha256Sums)
+		sumsSigBytes, err = os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to read file at path %s: %w", p, err)
+		}
 	}
 
-	if err := signingKeys.IsValidSha256Sums(sumsBytes, sumsSigBytes); err != nil {
+	namespaceKeys, signingKeys, err := mergeSigningKeys(validateCtx, storageBackend, flagProviderNamespace, providerName, providerVersion, newSigningKeys)
+	if err != nil {
 		return err
 	}
+	if err := signingKeys.IsValidSha256Sums(sumsBytes, sumsSigBytes); err != nil {
+		return fmt.Errorf("the SHA256SUMS file isn't signed by the signing keys of %s/%s/%s: %w", flagProviderNamespace, providerName, providerVersion, err)
+	}
 
-	providerName, err := sums.Name()
-	if err != nil {
-		return fmt.Errorf("failed to parse provider name: %v", err)
+	// The keys are only published once the release is known to be signed by the keys it's served with
+	if len(newSigningKeys) > 0 {
+		if err := storageBackend.UploadSigningKeys(validateCtx, flagProviderNamespace, namespaceKeys); err != nil {
+			return fmt.Errorf("failed to upload signing keys for namespace %s: %w", flagProviderNamespace, err)
+		}
+		slog.Info("published signing keys", slog.String("namespace", flagProviderNamespace), slog.Int("keys", len(namespaceKeys.GPGPublicKeys)))
 	}
 
+	// The files that are deleted again if the release fails its verification
+	var uploaded []string
+
 	// Upload provider binary .zip archives
 	if len(flagProviderArchivePaths) > 0 {
 		for _, archivePath := range flagProviderArchivePaths {
 			if err := uploadProviderReleaseFile(ctx, storageBackend, archivePath, flagProviderNamespace, providerName); err != nil {
 				return err
 			}
+			uploaded = append(uploaded, filepath.Base(archivePath))
 			slog.Info("successfully published provider binary", slog.String("name", filepath.Base(archivePath)))
 		}
 	} else {
@@ -191,6 +312,7 @@ func uploadProvider(cmd *cobra.Command, args []string) error {
 			if err := uploadProviderReleaseFile(ctx, storageBackend, archivePath, flagProviderNamespace, providerName); err != nil {
 				return err
 			}
+			uploaded = append(uploaded, fileName)
 			slog.Info("successfully published provider binary", slog.String("name", fileName))
 		}
 	}
@@ -199,18 +321,162 @@ func uploadProvider(cmd *cobra.Command, args []string) error {
 	if err = uploadProviderReleaseFile(ctx, storageBackend, flagFileSha256Sums, flagProviderNamespace, providerName); err != nil {
 		return err
 	}
+	uploaded = append(uploaded, filepath.Base(flagFileSha256Sums))
 	slog.Info("successfully published provider SHA256SUMS file", slog.String("name", filepath.Base(flagFileSha256Sums)))
 
+	// The release can't be installed without the signature, so a release with mismatching archives is never served
+	if flagVerifyProviderRelease {
+		verifyCtx, verifyCtxCancel := context.WithTimeout(ctx, 120*time.Second)
+		defer verifyCtxCancel()
+		if err := provider.VerifyRelease(verifyCtx, storageBackend, flagProviderNamespace, providerName, filepath.Base(flagFileSha256Sums)); err != nil {
+			// The parent context is used, as the verification context might be the one that expired
+			if deleteErr := provider.DeleteReleaseFiles(ctx, storageBackend, flagProviderNamespace, providerName, uploaded); deleteErr != nil {
+				slog.Error("failed to delete the files of the unverified provider release", slog.String("err", deleteErr.Error()))
+			} else {
+				slog.Info("deleted the files of the unverified provider release", slog.Int("files", len(uploaded)))
+			}
+			return fmt.Errorf("failed to verify the uploaded provider release: %w", err)
+		}
+		slog.Info("verified the checksums of the uploaded provider archives")
+	}
+
+	// Upload the optional *_metadata.json docs, which are located next to the *_SHA256SUMS file
+	docsPath := strings.TrimSuffix(flagFileSha256Sums, "SHA256SUMS") + "metadata.json"
+	if _, err := os.Stat(docsPath); err == nil {
+		if err := uploadProviderReleaseFile(ctx, storageBackend, docsPath, flagProviderNamespace, providerName); err != nil {
+			return err
+		}
+		slog.Info("successfully published provider docs", slog.String("name", filepath.Base(docsPath)))
+	}
+
 	// Upload *_SHA256SUMS.sig file
-	signaturePath := fmt.Sprintf("%s.sig", flagFileSha256Sums)
-	if err = uploadProviderReleaseFile(ctx, storageBackend, signaturePath, flagProviderNamespace, providerName); err != nil {
+	signatureName := fmt.Sprintf("%s.sig", filepath.Base(flagFileSha256Sums))
+	uploadCtx, uploadCtxCancel := context.WithTimeout(ctx, 120*time.Second)
+	defer uploadCtxCancel()
+	if err = storageBackend.UploadProviderReleaseFiles(uploadCtx, flagProviderNamespace, providerName, signatureName, bytes.NewReader(sumsSigBytes)); err != nil {
 		return err
 	}
-	slog.Info("successfully published provider SHA256SUMS.sig file", slog.String("name", filepath.Base(signaturePath)))
+	slog.Info("successfully published provider SHA256SUMS.sig file", slog.String("name", signatureName))
 
 	return nil
 }
 
+// lockProviderVersion acquires the upload lock of the provider version and returns a function that releases it.
+// A concurrent upload of the same version fails with core.ErrUploadInProgress instead of interleaving its files.
+func lockProviderVersion(ctx context.Context, storage provider.Storage, namespace, name, version string) (func(), error) {
+	lockCtx, cancelLockCtx := context.WithTimeout(ctx, 15*time.Second)
+	defer cancelLockCtx()
+	if err := storage.LockProviderVersion(lockCtx, namespace, name, version); err != nil {
+		return nil, fmt.Errorf("failed to lock provider %s/%s version %s: %w", namespace, name, version, err)
+	}
+
+	return func() {
+		unlockCtx, cancelUnlockCtx := context.WithTimeout(context.WithoutCancel(ctx), 15*time.Second)
+		defer cancelUnlockCtx()
+		if err := storage.UnlockProviderVersion(unlockCtx, namespace, name, version); err != nil {
+			slog.Error("failed to release the upload lock, it expires after an hour unless it is deleted from the storage backend",
+				slog.String("namespace", namespace), slog.String("name", name), slog.String("version", version), slog.String("err", err.Error()))
+		}
+	}, nil
+}
+
+// signSha256SumsWithKMS signs the SHA256SUMS file with the configured KMS key and returns the public key of the KMS key with the signature.
+// The public key is added to the signing keys of the namespace like the keys of --gpg-public-key.
+func signSha256SumsWithKMS(ctx context.Context, sums []byte) (core.GPGPublicKey, []byte, error) {
+	kms, err := signing.NewKeyManagementService(ctx, flagProviderKMSSigningKey)
+	if err != nil {
+		return core.GPGPublicKey{}, nil, err
+	}
+	signer, err := signing.NewKMSSigner(ctx, kms)
+	if err != nil {
+		return core.GPGPublicKey{}, nil, err
+	}
+
+	sig, err := signer.Sign(ctx, sums)
+	if err != nil {
+		return core.GPGPublicKey{}, nil, err
+	}
+	return signer.PublicKey(), sig, nil
+}
+
+// readSigningKeyFiles reads the keys of a signing-keys.json file and of an ASCII-armored GPG public key file.
+// Both paths are optional, every key has to parse and its key ID has to match the armored key.
+func readSigningKeyFiles(signingKeyFile, gpgPublicKeyFile string) ([]core.GPGPublicKey, error) {
+	var keys []core.GPGPublicKey
+	if signingKeyFile != "" {
+		b, err := os.ReadFile(signingKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing keys: %w", err)
+		}
+		var signingKeys core.SigningKeys
+		if err := json.Unmarshal(b, &signingKeys); err != nil {
+			return nil, fmt.Errorf("failed to parse signing keys %s: %w", signingKeyFile, err)
+		}
+		if len(signingKeys.GPGPublicKeys) == 0 {
+			return nil, fmt.Errorf("signing keys %s don't contain any gpg_public_keys", signingKeyFile)
+		}
+
+		for _, k := range signingKeys.GPGPublicKeys {
+			parsed, err := core.ParseGPGPublicKey(k.ASCIIArmor)
+			if err != nil {
+				return nil, fmt.Errorf("invalid signing key %s in %s: %w", k.KeyID, signingKeyFile, err)
+			}
+			if !strings.EqualFold(parsed.KeyID, k.KeyID) {
+				return nil, fmt.Errorf("key_id %s in %s doesn't match the key ID %s of the ascii_armor", k.KeyID, signingKeyFile, parsed.KeyID)
+			}
+			parsed.Source = k.Source
+			parsed.SourceURL = k.SourceURL
+			keys = append(keys, parsed)
+		}
+	}
+
+	if gpgPublicKeyFile != "" {
+		armored, err := os.ReadFile(gpgPublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+		key, err := core.ParseGPGPublicKey(string(armored))
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %s: %w", gpgPublicKeyFile, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// mergeSigningKeys returns the signing keys of the namespace with the keys added, and the signing keys that the provider version is served with afterwards.
+// The keys are only added to the namespace, which doesn't change the keys of a version that has its own keys or keys of its provider,
+// so the keys the version is served with are looked up with ProviderSigningKeys like the registry does.
+// The signing keys of the namespace are created if the namespace doesn't have any yet and keys are added.
+func mergeSigningKeys(ctx context.Context, storage provider.Storage, namespace, name, version string, keys []core.GPGPublicKey) (*core.SigningKeys, *core.SigningKeys, error) {
+	namespaceKeys, err := storage.SigningKeys(ctx, namespace)
+	if errors.Is(err, core.ErrObjectNotFound) {
+		namespaceKeys = nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	releaseKeys, err := storage.ProviderSigningKeys(ctx, namespace, name, version)
+	if errors.Is(err, core.ErrObjectNotFound) && len(keys) > 0 {
+		releaseKeys = nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	// ProviderSigningKeys falls back to the keys of the namespace, which are replaced by the merged keys
+	servedByNamespace := releaseKeys == nil || reflect.DeepEqual(releaseKeys, namespaceKeys)
+	if namespaceKeys == nil {
+		namespaceKeys = &core.SigningKeys{}
+	}
+	for _, k := range keys {
+		namespaceKeys.AddKey(k)
+	}
+	if servedByNamespace {
+		releaseKeys = namespaceKeys
+	}
+	return namespaceKeys, releaseKeys, nil
+}
+
 func validateShaSums(sums *core.Sha256Sums) error {
 	// Check whether the user has given archive paths to upload on the command line as flags.
 	// If not, we try to determine the locations of the provider zip archives based on the path of the *_SHA256SUMS file and the filenames in that file
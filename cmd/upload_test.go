@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/provider"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lockingStorage holds the upload locks of provider versions
+type lockingStorage struct {
+	provider.Storage
+	mu    sync.Mutex
+	locks map[string]bool
+}
+
+func (s *lockingStorage) LockProviderVersion(_ context.Context, namespace, name, version string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := namespace + "/" + name + "/" + version
+	if s.locks[key] {
+		return core.ErrUploadInProgress
+	}
+	s.locks[key] = true
+	return nil
+}
+
+func (s *lockingStorage) UnlockProviderVersion(_ context.Context, namespace, name, version string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.locks, namespace+"/"+name+"/"+version)
+	return nil
+}
+
+func TestLockProviderVersion(t *testing.T) {
+	ctx := context.Background()
+	s := &lockingStorage{locks: make(map[string]bool)}
+
+	unlock, err := lockProviderVersion(ctx, s, "acme", "dummy", "1.0.0")
+	require.NoError(t, err)
+
+	// A second upload of the same version fails while the first one holds the lock
+	_, err = lockProviderVersion(ctx, s, "acme", "dummy", "1.0.0")
+	assert.ErrorIs(t, err, core.ErrUploadInProgress)
+
+	// Uploads of other versions aren't blocked
+	unlockOther, err := lockProviderVersion(ctx, s, "acme", "dummy", "1.1.0")
+	require.NoError(t, err)
+	unlockOther()
+
+	unlock()
+	unlock, err = lockProviderVersion(ctx, s, "acme", "dummy", "1.0.0")
+	require.NoError(t, err)
+	unlock()
+	assert.Empty(t, s.locks)
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/provider"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.AddCommand(validateProviderCmd)
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check that artifacts in the storage backend can be served",
+}
+
+var validateProviderCmd = &cobra.Command{
+	Use:   "provider NAMESPACE/NAME/VERSION",
+	Short: "Check that every platform of a provider version can be installed by Terraform",
+	Long: `Check that every platform of a provider version can be installed by Terraform.
+The archives, the SHA256SUMS file and its signature are looked up in the storage backend and the signature is verified
+with the signing keys of the namespace. The command fails if any of the checks fails.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		parts := strings.Split(args[0], "/")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return fmt.Errorf("provider %s is invalid, expected the <namespace>/<name>/<version> format", args[0])
+		}
+
+		ctx := context.Background()
+		storageBackend, err := setupStorage(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to set up storage: %w", err)
+		}
+
+		report, err := validateProvider(ctx, storageBackend, parts[0], parts[1], parts[2], flagDefaultSigningKeysNamespace)
+		if err != nil {
+			return err
+		}
+		report.print(cmd.OutOrStdout())
+		if failed := report.failed(); failed > 0 {
+			return fmt.Errorf("provider %s can't be served, %d of %d checks failed", args[0], failed, len(report.checks))
+		}
+		return nil
+	},
+}
+
+// validationCheck is the result of a single check, the check passed if err is nil
+type validationCheck struct {
+	name string
+	err  error
+}
+
+type validationReport struct {
+	checks []validationCheck
+}
+
+func (r *validationReport) add(name string, err error) {
+	r.checks = append(r.checks, validationCheck{name: name, err: err})
+}
+
+func (r *validationReport) failed() int {
+	failed := 0
+	for _, c := range r.checks {
+		if c.err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+func (r *validationReport) print(w io.Writer) {
+	for _, c := range r.checks {
+		if c.err != nil {
+			fmt.Fprintf(w, "FAIL %s: %v\n", c.name, c.err)
+		} else {
+			fmt.Fprintf(w, "ok   %s\n", c.name)
+		}
+	}
+}
+
+// validateProvider runs the same lookups as the provider registry protocol for every stored platform of the version
+// and verifies the signature of the SHA256SUMS file with the most specific signing keys of the version.
+// The signing keys of the default namespace are used if it's set and neither the version, the provider nor the namespace have any.
+// An error is only returned if the version doesn't exist, failed checks are recorded in the report.
+func validateProvider(ctx context.Context, storage provider.Storage, namespace, name, version, defaultNamespace string) (*validationReport, error) {
+	platforms, err := storage.ListProviderPlatforms(ctx, namespace, name, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the platforms of provider %s/%s version %s: %w", namespace, name, version, err)
+	}
+
+	report := &validationReport{}
+	for _, p := range platforms {
+		_, err := storage.GetProvider(ctx, namespace, name, version, p.OS, p.Arch)
+		report.add(fmt.Sprintf("platform %s_%s", p.OS, p.Arch), err)
+	}
+
+	release := &core.Provider{Name: name, Version: version}
+	sums, sumsErr := storage.DownloadProviderReleaseFile(ctx, namespace, name, release.ShasumFileName())
+	report.add(release.ShasumFileName(), sumsErr)
+	sig, sigErr := storage.DownloadProviderReleaseFile(ctx, namespace, name, release.ShasumSignatureFileName())
+	report.add(release.ShasumSignatureFileName(), sigErr)
+
+	keysName := fmt.Sprintf("signing keys of provider %s/%s/%s", namespace, name, version)
+	signingKeys, err := storage.ProviderSigningKeys(ctx, namespace, name, version)
+	if errors.Is(err, core.ErrObjectNotFound) && defaultNamespace != "" && defaultNamespace != namespace {
+		keysName = fmt.Sprintf("signing keys of namespace %s", defaultNamespace)
+		signingKeys, err = storage.SigningKeys(ctx, defaultNamespace)
+	}
+	if err == nil && len(signingKeys.GPGPublicKeys) == 0 {
+		err = errors.New("there aren't any signing keys")
+	}
+	report.add(keysName, err)
+
+	if sumsErr == nil && sigErr == nil && err == nil {
+		report.add("signature", signingKeys.IsValidSha256Sums(sums, sig))
+	} else {
+		report.add("signature", errors.New("skipped, the SHA256SUMS file, its signature or the signing keys are missing"))
+	}
+	return report, nil
+}
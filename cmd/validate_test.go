@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// releaseStorage keeps the release files of a single provider in addition to the signing keys
+type releaseStorage struct {
+	*signingKeysStorage
+	releases map[string][]byte
+	// versionKeys are the signing keys stored for the provider version, if any
+	versionKeys *core.SigningKeys
+}
+
+func (s *releaseStorage) ProviderSigningKeys(ctx context.Context, namespace, _, _ string) (*core.SigningKeys, error) {
+	if s.versionKeys != nil {
+		return s.versionKeys, nil
+	}
+	return s.SigningKeys(ctx, namespace)
+}
+
+func (s *releaseStorage) ListProviderPlatforms(_ context.Context, _, _, version string) ([]core.Platform, error) {
+	var platforms []core.Platform
+	for fileName := range s.releases {
+		p, err := core.NewProviderFromArchive(fileName)
+		if err != nil || p.Version != version {
+			continue
+		}
+		platforms = append(platforms, core.Platform{OS: p.OS, Arch: p.Arch})
+	}
+	if len(platforms) == 0 {
+		return nil, core.ErrObjectNotFound
+	}
+	return platforms, nil
+}
+
+func (s *releaseStorage) GetProvider(_ context.Context, namespace, name, version, os, arch string) (*core.Provider, error) {
+	p := &core.Provider{Namespace: namespace, Name: name, Version: version, OS: os, Arch: arch}
+	if _, ok := s.releases[p.ArchiveFileName()]; !ok {
+		return nil, core.ErrObjectNotFound
+	}
+	if _, ok := s.releases[p.ShasumFileName()]; !ok {
+		return nil, fmt.Errorf("failed to download %s: %w", p.ShasumFileName(), core.ErrObjectNotFound)
+	}
+	return p, nil
+}
+
+func (s *releaseStorage) DownloadProviderReleaseFile(_ context.Context, _, _, filename string) ([]byte, error) {
+	b, ok := s.releases[filename]
+	if !ok {
+		return nil, core.ErrObjectNotFound
+	}
+	return b, nil
+}
+
+func TestValidateProvider(t *testing.T) {
+	ctx := context.Background()
+	entity, key := newSigningKey(t)
+	sums := []byte("5f9c7aa76b7c34d722fc9123208e26b22d60440cb47150dd04733b9b94f4541a  terraform-provider-dummy_1.0.0_linux_amd64.zip\n")
+	var sig bytes.Buffer
+	require.NoError(t, openpgp.DetachSign(&sig, entity, bytes.NewReader(sums), nil))
+
+	newStorage := func() *releaseStorage {
+		s := &releaseStorage{
+			signingKeysStorage: &signingKeysStorage{files: make(map[string][]byte)},
+			releases: map[string][]byte{
+				"terraform-provider-dummy_1.0.0_linux_amd64.zip": []byte("archive"),
+				"terraform-provider-dummy_1.0.0_SHA256SUMS":      sums,
+				"terraform-provider-dummy_1.0.0_SHA256SUMS.sig":  sig.Bytes(),
+			},
+		}
+		require.NoError(t, addSigningKey(ctx, s, "acme", key))
+		return s
+	}
+
+	t.Run("valid provider", func(t *testing.T) {
+		report, err := validateProvider(ctx, newStorage(), "acme", "dummy", "1.0.0", "")
+		require.NoError(t, err)
+		assert.Zero(t, report.failed())
+		assert.Len(t, report.checks, 5)
+
+		var out bytes.Buffer
+		report.print(&out)
+		assert.Equal(t, `ok   platform linux_amd64
+ok   terraform-provider-dummy_1.0.0_SHA256SUMS
+ok   terraform-provider-dummy_1.0.0_SHA256SUMS.sig
+ok   signing keys of provider acme/dummy/1.0.0
+ok   signature
+`, out.String())
+	})
+
+	t.Run("missing signature", func(t *testing.T) {
+		s := newStorage()
+		delete(s.releases, "terraform-provider-dummy_1.0.0_SHA256SUMS.sig")
+
+		report, err := validateProvider(ctx, s, "acme", "dummy", "1.0.0", "")
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.failed())
+		assert.ErrorIs(t, report.checks[2].err, core.ErrObjectNotFound)
+
+		var out bytes.Buffer
+		report.print(&out)
+		assert.Contains(t, out.String(), "FAIL terraform-provider-dummy_1.0.0_SHA256SUMS.sig")
+		assert.Contains(t, out.String(), "FAIL signature: skipped")
+	})
+
+	t.Run("signature of another key", func(t *testing.T) {
+		s := newStorage()
+		_, otherKey := newSigningKey(t)
+		require.NoError(t, removeSigningKey(ctx, s, "acme", key.KeyID))
+		require.NoError(t, addSigningKey(ctx, s, "acme", otherKey))
+
+		report, err := validateProvider(ctx, s, "acme", "dummy", "1.0.0", "")
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.failed())
+		assert.Error(t, report.checks[4].err)
+	})
+
+	t.Run("version keys override the namespace keys", func(t *testing.T) {
+		s := newStorage()
+		_, otherKey := newSigningKey(t)
+		s.versionKeys = &core.SigningKeys{GPGPublicKeys: []core.GPGPublicKey{otherKey}}
+
+		// The release is signed with the namespace key, which doesn't apply to the version
+		report, err := validateProvider(ctx, s, "acme", "dummy", "1.0.0", "")
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.failed())
+		assert.Error(t, report.checks[4].err)
+
+		s.versionKeys = &core.SigningKeys{GPGPublicKeys: []core.GPGPublicKey{key}}
+		require.NoError(t, removeSigningKey(ctx, s, "acme", key.KeyID))
+		report, err = validateProvider(ctx, s, "acme", "dummy", "1.0.0", "")
+		require.NoError(t, err)
+		assert.Zero(t, report.failed())
+	})
+
+	t.Run("signing keys of the default namespace", func(t *testing.T) {
+		s := newStorage()
+		delete(s.files, "acme")
+		require.NoError(t, addSigningKey(ctx, s, "org", key))
+
+		report, err := validateProvider(ctx, s, "acme", "dummy", "1.0.0", "org")
+		require.NoError(t, err)
+		assert.Zero(t, report.failed())
+		assert.Equal(t, "signing keys of namespace org", report.checks[3].name)
+
+		report, err = validateProvider(ctx, s, "acme", "dummy", "1.0.0", "")
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.failed())
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		_, err := validateProvider(ctx, newStorage(), "acme", "dummy", "2.0.0", "")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,12 @@
+package admin
+
+import (
+	"context"
+)
+
+// Cache is an in-process cache that can be invalidated after out-of-band changes to the storage backend
+type Cache interface {
+	// InvalidateCache removes the entries of keys starting with the prefix, relative to the storage prefix.
+	// An empty prefix removes all entries. It returns the number of removed entries.
+	InvalidateCache(ctx context.Context, prefix string) int
+}
@@ -0,0 +1,18 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type invalidateCachesRequest struct {
+	prefix string
+}
+
+func invalidateCachesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(invalidateCachesRequest)
+		return svc.InvalidateCaches(ctx, req.prefix)
+	}
+}
@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/boring-registry/boring-registry/pkg/auth"
+)
+
+// Middleware is a Service middleware.
+type Middleware func(Service) Service
+
+type aclMiddleware struct {
+	next Service
+	acl  auth.ACL
+}
+
+// ACLMiddleware is a Service middleware that denies invalidating the caches of namespaces, which the user isn't allowed to write
+func ACLMiddleware(acl auth.ACL) Middleware {
+	return func(next Service) Service {
+		return &aclMiddleware{
+			next: next,
+			acl:  acl,
+		}
+	}
+}
+
+func (mw aclMiddleware) InvalidateCaches(ctx context.Context, prefix string) (*Invalidation, error) {
+	if err := mw.acl.AuthorizePrefix(ctx, prefix, auth.PermissionWrite); err != nil {
+		return nil, err
+	}
+	return mw.next.InvalidateCaches(ctx, prefix)
+}
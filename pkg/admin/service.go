@@ -0,0 +1,37 @@
+package admin
+
+import (
+	"context"
+)
+
+// Invalidation is the result of invalidating the caches
+type Invalidation struct {
+	Prefix string `json:"prefix"`
+	// Invalidated is the number of removed cache entries, which is 0 if caching is disabled
+	Invalidated int `json:"invalidated"`
+}
+
+// Service provides the administrative operations of the registry
+type Service interface {
+	// InvalidateCaches removes the cached entries of keys starting with the prefix from all caches
+	InvalidateCaches(ctx context.Context, prefix string) (*Invalidation, error)
+}
+
+type service struct {
+	caches []Cache
+}
+
+func (s *service) InvalidateCaches(ctx context.Context, prefix string) (*Invalidation, error) {
+	i := &Invalidation{Prefix: prefix}
+	for _, c := range s.caches {
+		i.Invalidated += c.InvalidateCache(ctx, prefix)
+	}
+	return i, nil
+}
+
+// NewService returns an admin Service, which invalidates the caches
+func NewService(caches ...Cache) Service {
+	return &service{
+		caches: caches,
+	}
+}
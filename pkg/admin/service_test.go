@@ -0,0 +1,42 @@
+package admin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockedCache struct {
+	entries  int
+	prefixes []string
+}
+
+func (m *mockedCache) InvalidateCache(_ context.Context, prefix string) int {
+	m.prefixes = append(m.prefixes, prefix)
+	removed := m.entries
+	m.entries = 0
+	return removed
+}
+
+func TestService_InvalidateCaches(t *testing.T) {
+	existence := &mockedCache{entries: 3}
+	listing := &mockedCache{entries: 1}
+	svc := NewService(existence, listing)
+
+	i, err := svc.InvalidateCaches(context.Background(), "providers/acme/")
+	require.NoError(t, err)
+	assert.Equal(t, &Invalidation{Prefix: "providers/acme/", Invalidated: 4}, i)
+	assert.Equal(t, []string{"providers/acme/"}, existence.prefixes)
+	assert.Equal(t, []string{"providers/acme/"}, listing.prefixes)
+
+	i, err = svc.InvalidateCaches(context.Background(), "")
+	require.NoError(t, err)
+	assert.Zero(t, i.Invalidated)
+
+	// Without caches the invalidation is a no-op
+	i, err = NewService().InvalidateCaches(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, &Invalidation{}, i)
+}
@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+	"github.com/boring-registry/boring-registry/pkg/openapi"
+
+	"github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+// Routes describes the endpoints of MakeHandler for the OpenAPI document
+var Routes = []openapi.Route{
+	{
+		Method:  http.MethodPost,
+		Path:    "/cache/invalidate",
+		Summary: "Invalidate the cached entries of the in-process caches",
+		Parameters: []openapi.Parameter{
+			openapi.QueryParameter("prefix", "string", "Only invalidate the entries under the storage prefix"),
+		},
+		Responses: map[int]string{
+			http.StatusOK:        "The number of invalidated entries",
+			http.StatusForbidden: "The token has the read scope",
+		},
+		Authenticated: true,
+	},
+}
+
+// MakeHandler returns a fully initialized http.Handler.
+func MakeHandler(svc Service, authMiddleware endpoint.Middleware, instrumentation o11y.Middleware, options ...httptransport.ServerOption) http.Handler {
+	r := mux.NewRouter().StrictSlash(true)
+
+	r.Methods("POST").Path(`/cache/invalidate`).Handler(
+		instrumentation.WrapHandler(
+			httptransport.NewServer(
+				authMiddleware(invalidateCachesEndpoint(svc)),
+				decodeInvalidateCachesRequest,
+				httptransport.EncodeJSONResponse,
+				append(
+					options,
+					httptransport.ServerBefore(jwt.HTTPToContext()),
+				)...,
+			),
+		),
+	)
+
+	return r
+}
+
+func decodeInvalidateCachesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return invalidateCachesRequest{
+		prefix: r.URL.Query().Get("prefix"),
+	}, nil
+}
+
+// ErrorEncoder translates domain specific errors to HTTP status codes
+func ErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
+	core.EncodeError(err, w)
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/requestid"
+)
+
+type EventType string
+
+const (
+	EventRegistryModuleAccess   EventType = "registry.module.access"
+	EventRegistryProviderAccess EventType = "registry.provider.access"
+)
+
+type Action string
+
+const (
+	ActionDownload Action = "download"
+)
+
+// User identifies who accessed the registry
+type User struct {
+	// Provider is the auth provider that verified the token, e.g. static or oidc
+	Provider string `json:"provider,omitempty"`
+	// Subject is the sub claim of JWTs and is empty for static tokens
+	Subject string `json:"subject,omitempty"`
+	// Groups is the groups claim of JWTs
+	Groups []string `json:"groups,omitempty"`
+}
+
+// Event is a single audit record
+type Event struct {
+	Timestamp  time.Time         `json:"timestamp"`
+	Type       EventType         `json:"type"`
+	Action     Action            `json:"action"`
+	Resource   string            `json:"resource"`
+	User       *User             `json:"user,omitempty"`
+	DurationMs int64             `json:"duration_ms"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	// RequestID ties the event to the logs of the request and the X-Request-ID header of the response
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Logger records audit events
+type Logger interface {
+	LogEvent(ctx context.Context, event *Event)
+
+	// Close flushes buffered events and releases the resources of the Logger.
+	// Flushing is canceled when ctx is done
+	Close(ctx context.Context) error
+}
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// ContextWithUser returns a copy of ctx that carries the user
+func ContextWithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// GetUserFromContext returns the user of the request, or nil for unauthenticated requests
+func GetUserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(userContextKey).(*User)
+	return user
+}
+
+// LogRegistryAccess records the access of a module or provider, which took since begin
+func LogRegistryAccess(ctx context.Context, logger Logger, eventType EventType, action Action, resource string, begin time.Time, metadata map[string]string) {
+	logger.LogEvent(ctx, &Event{
+		Timestamp:  begin.UTC(),
+		Type:       eventType,
+		Action:     action,
+		Resource:   resource,
+		User:       GetUserFromContext(ctx),
+		DurationMs: time.Since(begin).Milliseconds(),
+		Metadata:   metadata,
+		RequestID:  requestid.FromContext(ctx),
+	})
+}
@@ -0,0 +1,38 @@
+package audit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/audit"
+	"github.com/boring-registry/boring-registry/pkg/audit/audittest"
+	"github.com/boring-registry/boring-registry/pkg/requestid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogRegistryAccess(t *testing.T) {
+	logger := &audittest.Logger{}
+	user := &audit.User{Provider: "oidc", Subject: "jane"}
+	ctx := audit.ContextWithUser(requestid.NewContext(context.Background(), "abc-123"), user)
+
+	begin := time.Now().Add(-50 * time.Millisecond)
+	audit.LogRegistryAccess(ctx, logger, audit.EventRegistryModuleAccess, audit.ActionDownload, "example/s3/aws/1.0.0", begin, nil)
+
+	assert.Len(t, logger.Events, 1)
+	event := logger.Events[0]
+	assert.Equal(t, audit.EventRegistryModuleAccess, event.Type)
+	assert.Equal(t, audit.ActionDownload, event.Action)
+	assert.Equal(t, "example/s3/aws/1.0.0", event.Resource)
+	assert.Equal(t, user, event.User)
+	assert.Equal(t, "abc-123", event.RequestID)
+	assert.GreaterOrEqual(t, event.DurationMs, int64(50))
+}
+
+func TestGetUserFromContext(t *testing.T) {
+	assert.Nil(t, audit.GetUserFromContext(context.Background()))
+
+	user := &audit.User{Provider: "static"}
+	assert.Equal(t, user, audit.GetUserFromContext(audit.ContextWithUser(context.Background(), user)))
+}
@@ -0,0 +1,19 @@
+// Package audittest provides an audit.Logger for the tests of the audited services
+package audittest
+
+import (
+	"context"
+
+	"github.com/boring-registry/boring-registry/pkg/audit"
+)
+
+// Logger records the logged events in Events
+type Logger struct {
+	Events []*audit.Event
+}
+
+func (l *Logger) LogEvent(_ context.Context, event *audit.Event) {
+	l.Events = append(l.Events, event)
+}
+
+func (l *Logger) Close(context.Context) error { return nil }
@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Minute
+
+	// queuedBatches is the number of batches that can be queued while an upload is in progress
+	queuedBatches = 10
+
+	// eventCountMetadataKey is the object metadata key holding the number of events in a batch
+	eventCountMetadataKey = "event-count"
+)
+
+// objectWriter uploads a batch of newline-delimited JSON events to an object storage
+type objectWriter interface {
+	writeObject(ctx context.Context, key string, body []byte, metadata map[string]string) error
+}
+
+// batchingLogger buffers the events and uploads them as a single object once batchSize events are buffered
+// or every flushInterval, whichever happens first.
+// LogEvent never blocks the request handling: events are passed through a bounded queue,
+// and events are dropped if the queue is full because the uploads stalled.
+type batchingLogger struct {
+	writer        objectWriter
+	prefix        string
+	batchSize     int
+	flushInterval time.Duration
+	logger        *slog.Logger
+	now           func() time.Time
+
+	queue   chan *Event
+	dropped atomic.Int64
+	closed  atomic.Bool
+
+	// ctx is the context of the uploads, which is canceled once the context passed to Close is done
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+func (l *batchingLogger) LogEvent(_ context.Context, event *Event) {
+	if l.closed.Load() {
+		l.logger.Warn("dropping audit event, logger is closed", slog.String("resource", event.Resource))
+		return
+	}
+
+	select {
+	case l.queue <- event:
+	default:
+		dropped := l.dropped.Add(1)
+		l.logger.Warn("dropping audit event, queue is full", slog.String("resource", event.Resource), slog.Int64("dropped", dropped))
+	}
+}
+
+func (l *batchingLogger) run() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Event, 0, l.batchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			l.upload(l.ctx, batch)
+			batch = make([]*Event, 0, l.batchSize)
+		}
+	}
+
+	for {
+		select {
+		case event := <-l.queue:
+			batch = append(batch, event)
+			if len(batch) >= l.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-l.done:
+			// Drain the events that were queued before Close was called
+			for {
+				select {
+				case event := <-l.queue:
+					batch = append(batch, event)
+					if len(batch) >= l.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *batchingLogger) upload(ctx context.Context, batch []*Event) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, e := range batch {
+		if err := encoder.Encode(e); err != nil {
+			l.logger.Error("failed to encode audit event", slog.String("err", err.Error()))
+		}
+	}
+
+	key := partitionKey(l.prefix, l.now())
+	metadata := batchMetadata(batch)
+	if err := l.writer.writeObject(ctx, key, body.Bytes(), metadata); err != nil {
+		l.logger.Error("failed to upload audit events", slog.String("key", key), slog.Int("events", len(batch)), slog.String("err", err.Error()))
+		return
+	}
+	l.logger.Debug("uploaded audit events", slog.String("key", key), slog.Int("events", len(batch)))
+}
+
+// Close uploads the queued events and stops the logger.
+// It blocks until the final upload finished, the upload in progress and the remaining uploads are canceled when ctx is done
+func (l *batchingLogger) Close(ctx context.Context) error {
+	l.closeOnce.Do(func() {
+		l.closed.Store(true)
+		close(l.done)
+	})
+
+	stop := context.AfterFunc(ctx, l.cancel)
+	defer stop()
+	l.wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to flush the audit events: %w", err)
+	}
+	return nil
+}
+
+// partitionKey returns an object key that is partitioned by date, so that the audit events can be queried efficiently,
+// for example with Athena or BigQuery:
+//
+//	<prefix>/year=2024/month=01/day=02/20240102T150405Z-<random>.jsonl
+func partitionKey(prefix string, t time.Time) string {
+	t = t.UTC()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	return path.Join(
+		prefix,
+		fmt.Sprintf("year=%04d", t.Year()),
+		fmt.Sprintf("month=%02d", t.Month()),
+		fmt.Sprintf("day=%02d", t.Day()),
+		fmt.Sprintf("%s-%s.jsonl", t.Format("20060102T150405Z"), hex.EncodeToString(suffix)),
+	)
+}
+
+func batchMetadata(batch []*Event) map[string]string {
+	return map[string]string{
+		eventCountMetadataKey: strconv.Itoa(len(batch)),
+	}
+}
+
+func newBatchingLogger(writer objectWriter, prefix string, batchSize int, flushInterval time.Duration) *batchingLogger {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+
+	l := &batchingLogger{
+		writer:        writer,
+		prefix:        prefix,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		logger:        slog.Default().With(slog.String("component", "audit")),
+		now:           time.Now,
+		queue:         make(chan *Event, batchSize*queuedBatches),
+		done:          make(chan struct{}),
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	l.wg.Add(1)
+	go l.run()
+	return l
+}
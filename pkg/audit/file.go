@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// FileAuditLogger appends the audit events as newline-delimited JSON to a file.
+// Once the file exceeds maxSize, it's rotated to <path>.1, while previous backups are shifted up to <path>.<maxBackups>
+type FileAuditLogger struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	logger     *slog.Logger
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func (l *FileAuditLogger) LogEvent(ctx context.Context, event *Event) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		l.logger.Error("failed to encode audit event", slog.String("err", err.Error()))
+		return
+	}
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		l.logger.Error("failed to write audit event, logger is closed", slog.String("resource", event.Resource))
+		return
+	}
+
+	// A file is never rotated while empty, so that events larger than maxSize are still written
+	if l.size > 0 && l.size+int64(len(b)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			l.logger.Error("failed to rotate audit log", slog.String("err", err.Error()))
+
+			// Keep appending to the current file instead of losing events
+			if l.file == nil {
+				if err := l.open(); err != nil {
+					l.logger.Error("failed to reopen audit log", slog.String("err", err.Error()))
+					return
+				}
+			}
+		}
+	}
+
+	n, err := l.file.Write(b)
+	l.size += int64(n)
+	if err != nil {
+		l.logger.Error("failed to write audit event", slog.String("err", err.Error()))
+	}
+}
+
+// rotate closes the current file, shifts the backups and opens a new file
+func (l *FileAuditLogger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	if l.maxBackups > 0 {
+		for i := l.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(l.backupPath(i), l.backupPath(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		if err := os.Rename(l.path, l.backupPath(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+
+	return l.open()
+}
+
+func (l *FileAuditLogger) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
+
+func (l *FileAuditLogger) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+// Close syncs the written events to disk and closes the file
+func (l *FileAuditLogger) Close(context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := errors.Join(l.file.Sync(), l.file.Close())
+	l.file = nil
+	return err
+}
+
+// CreateFileAuditLogger returns a FileAuditLogger that appends to the file at path.
+// The file is rotated once it exceeds maxSizeMB megabytes and at most maxBackups rotated files are retained
+func CreateFileAuditLogger(path string, maxSizeMB, maxBackups int) (*FileAuditLogger, error) {
+	if maxSizeMB <= 0 {
+		return nil, errors.New("the maximum size of the audit log has to be positive")
+	}
+	if maxBackups < 0 {
+		return nil, errors.New("the number of audit log backups can't be negative")
+	}
+
+	l := &FileAuditLogger{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+		logger:     slog.Default().With(slog.String("component", "audit")),
+	}
+	if err := l.open(); err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return l, nil
+}
@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readEvents(t *testing.T, path string) []Event {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e Event
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		events = append(events, e)
+	}
+	assert.NoError(t, scanner.Err())
+	return events
+}
+
+func TestFileAuditLogger_LogEvent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := CreateFileAuditLogger(path, 1, 1)
+	assert.NoError(t, err)
+
+	l.LogEvent(context.Background(), &Event{Type: EventRegistryModuleAccess, Action: ActionDownload, Resource: "example/s3/aws/1.0.0"})
+	l.LogEvent(context.Background(), &Event{Type: EventRegistryProviderAccess, Action: ActionDownload, Resource: "hashicorp/random/3.6.0"})
+	assert.NoError(t, l.Close(context.Background()))
+
+	events := readEvents(t, path)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "example/s3/aws/1.0.0", events[0].Resource)
+	assert.Equal(t, EventRegistryProviderAccess, events[1].Type)
+
+	// Reopening appends to the existing file
+	l, err = CreateFileAuditLogger(path, 1, 1)
+	assert.NoError(t, err)
+	l.LogEvent(context.Background(), &Event{Resource: "example/vpc/aws/2.0.0"})
+	assert.NoError(t, l.Close(context.Background()))
+	assert.Len(t, readEvents(t, path), 3)
+}
+
+func TestFileAuditLogger_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	l, err := CreateFileAuditLogger(path, 1, 2)
+	assert.NoError(t, err)
+
+	// Each event is about 100KiB, so that a file holds at most 10 events
+	resource := strings.Repeat("a", 100*1024)
+	for i := 0; i < 35; i++ {
+		l.LogEvent(context.Background(), &Event{Resource: resource})
+	}
+	assert.NoError(t, l.Close(context.Background()))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+
+		info, err := e.Info()
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(1024*1024))
+	}
+
+	// The oldest rotated file was removed, as only two backups are retained
+	assert.ElementsMatch(t, []string{"audit.log", "audit.log.1", "audit.log.2"}, names)
+	assert.Len(t, readEvents(t, path), 5)
+	assert.Len(t, readEvents(t, path+".1"), 10)
+	assert.Len(t, readEvents(t, path+".2"), 10)
+}
+
+func TestFileAuditLogger_RotationWithoutBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	l, err := CreateFileAuditLogger(path, 1, 0)
+	assert.NoError(t, err)
+
+	resource := strings.Repeat("a", 600*1024)
+	l.LogEvent(context.Background(), &Event{Resource: resource})
+	l.LogEvent(context.Background(), &Event{Resource: resource})
+	assert.NoError(t, l.Close(context.Background()))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Len(t, readEvents(t, path), 1)
+}
+
+func TestCreateFileAuditLogger_InvalidOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	_, err := CreateFileAuditLogger(path, 0, 1)
+	assert.Error(t, err)
+	_, err = CreateFileAuditLogger(path, 1, -1)
+	assert.Error(t, err)
+}
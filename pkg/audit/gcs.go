@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+type gcsObjectWriter struct {
+	client *storage.Client
+	bucket string
+}
+
+func (w *gcsObjectWriter) writeObject(ctx context.Context, key string, body []byte, metadata map[string]string) error {
+	writer := w.client.Bucket(w.bucket).Object(key).NewWriter(ctx)
+	writer.ContentType = "application/x-ndjson"
+	writer.Metadata = metadata
+
+	if _, err := writer.Write(body); err != nil {
+		_ = writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// GCSAuditLogger uploads batches of audit events as newline-delimited JSON objects to a GCS bucket
+type GCSAuditLogger struct {
+	*batchingLogger
+	client *storage.Client
+}
+
+// Close uploads the remaining events and closes the GCS client
+func (l *GCSAuditLogger) Close(ctx context.Context) error {
+	if err := l.batchingLogger.Close(ctx); err != nil {
+		return err
+	}
+	return l.client.Close()
+}
+
+// CreateGCSAuditLogger returns a GCSAuditLogger that uploads the events below prefix in the bucket.
+// Events are uploaded once batchSize events are buffered or every flushInterval
+func CreateGCSAuditLogger(ctx context.Context, bucket, prefix string, batchSize int, flushInterval time.Duration) (*GCSAuditLogger, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	return &GCSAuditLogger{
+		batchingLogger: newBatchingLogger(&gcsObjectWriter{client: client, bucket: bucket}, prefix, batchSize, flushInterval),
+		client:         client,
+	}, nil
+}
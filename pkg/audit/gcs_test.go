@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type uploadedObject struct {
+	key      string
+	events   []Event
+	metadata map[string]string
+}
+
+// mockedObjectWriter stands in for the GCS bucket
+type mockedObjectWriter struct {
+	mu      sync.Mutex
+	objects []uploadedObject
+
+	// stall blocks the uploads until it's closed
+	stall chan struct{}
+}
+
+func (m *mockedObjectWriter) writeObject(ctx context.Context, key string, body []byte, metadata map[string]string) error {
+	if m.stall != nil {
+		select {
+		case <-m.stall:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	var events []Event
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return err
+		}
+		events = append(events, e)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects = append(m.objects, uploadedObject{key: key, events: events, metadata: metadata})
+	return nil
+}
+
+func (m *mockedObjectWriter) uploaded() []uploadedObject {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]uploadedObject(nil), m.objects...)
+}
+
+func TestGCSAuditLogger_Batching(t *testing.T) {
+	writer := &mockedObjectWriter{}
+	l := &GCSAuditLogger{batchingLogger: newBatchingLogger(writer, "audit", 3, time.Hour)}
+
+	for i := 0; i < 7; i++ {
+		l.LogEvent(context.Background(), &Event{Type: EventRegistryModuleAccess, Action: ActionDownload, Resource: "example/s3/aws/1.0.0"})
+	}
+
+	// Only full batches are uploaded before Close
+	assert.Eventually(t, func() bool { return len(writer.uploaded()) == 2 }, time.Second, 10*time.Millisecond)
+	objects := writer.uploaded()
+	for _, o := range objects {
+		assert.Len(t, o.events, 3)
+		assert.Equal(t, "3", o.metadata[eventCountMetadataKey])
+		assert.Equal(t, ActionDownload, o.events[0].Action)
+	}
+
+	// Close flushes the remaining event
+	assert.NoError(t, l.batchingLogger.Close(context.Background()))
+	objects = writer.uploaded()
+	assert.Len(t, objects, 3)
+	assert.Len(t, objects[2].events, 1)
+	assert.Equal(t, "1", objects[2].metadata[eventCountMetadataKey])
+}
+
+func TestGCSAuditLogger_FlushInterval(t *testing.T) {
+	writer := &mockedObjectWriter{}
+	l := &GCSAuditLogger{batchingLogger: newBatchingLogger(writer, "audit", 100, 20*time.Millisecond)}
+	defer l.batchingLogger.Close(context.Background())
+
+	l.LogEvent(context.Background(), &Event{Resource: "hashicorp/random/3.6.0"})
+	assert.Eventually(t, func() bool { return len(writer.uploaded()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "hashicorp/random/3.6.0", writer.uploaded()[0].events[0].Resource)
+}
+
+func Test_partitionKey(t *testing.T) {
+	key := partitionKey("audit/events", time.Date(2024, time.January, 2, 15, 4, 5, 0, time.UTC))
+	assert.Regexp(t, regexp.MustCompile(`^audit/events/year=2024/month=01/day=02/20240102T150405Z-[0-9a-f]{8}\.jsonl$`), key)
+
+	// Keys are unique within the same second
+	assert.NotEqual(t, key, partitionKey("audit/events", time.Date(2024, time.January, 2, 15, 4, 5, 0, time.UTC)))
+}
+
+func TestBatchingLogger_Shutdown(t *testing.T) {
+	writer := &mockedObjectWriter{}
+	l := newBatchingLogger(writer, "audit", 100, time.Hour)
+
+	for i := 0; i < 42; i++ {
+		l.LogEvent(context.Background(), &Event{Resource: "example/s3/aws/1.0.0"})
+	}
+	assert.Empty(t, writer.uploaded())
+
+	// The buffered events are uploaded before Close returns
+	assert.NoError(t, l.Close(context.Background()))
+	objects := writer.uploaded()
+	assert.Len(t, objects, 1)
+	assert.Len(t, objects[0].events, 42)
+
+	// Events after Close are dropped instead of panicking, and closing again is a no-op
+	l.LogEvent(context.Background(), &Event{Resource: "example/s3/aws/1.0.0"})
+	assert.NoError(t, l.Close(context.Background()))
+	assert.Len(t, writer.uploaded(), 1)
+}
+
+func TestBatchingLogger_CloseCancelsUpload(t *testing.T) {
+	writer := &mockedObjectWriter{stall: make(chan struct{})}
+	l := newBatchingLogger(writer, "audit", 1, time.Hour)
+	l.LogEvent(context.Background(), &Event{Resource: "example/s3/aws/1.0.0"})
+
+	// The stalled upload is canceled instead of outliving Close
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Close(ctx), context.DeadlineExceeded)
+	assert.Empty(t, writer.uploaded())
+}
+
+func TestBatchingLogger_StalledUploadDoesNotBlock(t *testing.T) {
+	writer := &mockedObjectWriter{stall: make(chan struct{})}
+	l := newBatchingLogger(writer, "audit", 1, time.Hour)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			l.LogEvent(context.Background(), &Event{Resource: "example/s3/aws/1.0.0"})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("LogEvent blocked while the upload stalled")
+	}
+	assert.Positive(t, l.dropped.Load())
+
+	close(writer.stall)
+	assert.NoError(t, l.Close(context.Background()))
+
+	// At most the queued events and the stalled batch are uploaded
+	var uploaded int
+	for _, o := range writer.uploaded() {
+		uploaded += len(o.events)
+	}
+	assert.Equal(t, int64(100), int64(uploaded)+l.dropped.Load())
+}
@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogAuditLogger writes the audit events as structured log records
+type SlogAuditLogger struct {
+	logger *slog.Logger
+}
+
+func (l *SlogAuditLogger) LogEvent(ctx context.Context, event *Event) {
+	attrs := []slog.Attr{
+		slog.String("type", string(event.Type)),
+		slog.String("action", string(event.Action)),
+		slog.String("resource", event.Resource),
+		slog.Int64("duration_ms", event.DurationMs),
+	}
+	if event.User != nil {
+		attrs = append(attrs, slog.Group("user",
+			slog.String("provider", event.User.Provider),
+			slog.String("subject", event.User.Subject),
+		))
+	}
+	for k, v := range event.Metadata {
+		attrs = append(attrs, slog.String(k, v))
+	}
+	l.logger.LogAttrs(ctx, slog.LevelInfo, "audit event", attrs...)
+}
+
+func (l *SlogAuditLogger) Close(context.Context) error { return nil }
+
+func NewSlogAuditLogger(logger *slog.Logger) *SlogAuditLogger {
+	return &SlogAuditLogger{
+		logger: logger.With(slog.String("component", "audit")),
+	}
+}
+
+// NoOpAuditLogger discards all events and is used when auditing is disabled
+type NoOpAuditLogger struct{}
+
+func (NoOpAuditLogger) LogEvent(context.Context, *Event) {}
+
+func (NoOpAuditLogger) Close(context.Context) error { return nil }
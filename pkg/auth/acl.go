@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/boring-registry/boring-registry/pkg/audit"
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/go-kit/kit/endpoint"
+	"gopkg.in/yaml.v3"
+)
+
+// Permission is an operation that is granted by an ACL
+type Permission string
+
+const (
+	PermissionRead  Permission = "read"
+	PermissionWrite Permission = "write"
+)
+
+// groupPrefix marks ACL entries that match a group instead of a subject
+const groupPrefix = "group:"
+
+// NamespaceACL lists the subjects and groups that are allowed to access a namespace.
+// Groups are prefixed with "group:", all other entries match the subject of the token.
+type NamespaceACL struct {
+	Read  []string `yaml:"read" json:"read"`
+	Write []string `yaml:"write" json:"write"`
+}
+
+// ACL maps namespaces to their access control lists.
+// Namespaces without an entry are accessible to every authenticated user.
+type ACL map[string]NamespaceACL
+
+// Authorize checks that the user of the request is granted the permission for the namespace.
+// Write access implies read access, as publishers usually verify what they published.
+func (a ACL) Authorize(ctx context.Context, namespace string, permission Permission) error {
+	acl, ok := a[namespace]
+	if !ok {
+		return nil
+	}
+
+	entries := acl.Write
+	if permission == PermissionRead {
+		entries = slices.Concat(acl.Read, acl.Write)
+	}
+
+	if user := audit.GetUserFromContext(ctx); user != nil && slices.ContainsFunc(entries, func(entry string) bool {
+		if group, ok := strings.CutPrefix(entry, groupPrefix); ok {
+			return slices.Contains(user.Groups, group)
+		}
+		return user.Subject != "" && entry == user.Subject
+	}) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s access to namespace %s is denied", core.ErrForbidden, permission, namespace)
+}
+
+// AuthorizePrefix checks that the user of the request is granted the permission for the namespaces stored under the storage prefix.
+// A prefix that spans several namespaces, like the empty prefix, requires the permission for every namespace of the ACL.
+func (a ACL) AuthorizePrefix(ctx context.Context, prefix string, permission Permission) error {
+	if namespace, ok := prefixNamespace(prefix); ok {
+		return a.Authorize(ctx, namespace, permission)
+	}
+	for _, namespace := range slices.Sorted(maps.Keys(a)) {
+		if err := a.Authorize(ctx, namespace, permission); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prefixNamespace returns the namespace of a storage prefix within a single namespace of the storage layout,
+// which are modules/<namespace>/, providers/<namespace>/ and mirror/providers/<hostname>/<namespace>/
+func prefixNamespace(prefix string) (string, bool) {
+	parts := strings.Split(strings.TrimPrefix(prefix, "/"), "/")
+	switch {
+	case len(parts) >= 3 && (parts[0] == "modules" || parts[0] == "providers"):
+		return parts[1], parts[1] != ""
+	case len(parts) >= 5 && parts[0] == "mirror" && parts[1] == "providers":
+		return parts[3], parts[3] != ""
+	}
+	return "", false
+}
+
+// Middleware is an endpoint.Middleware that checks the permission for the namespace of the request path.
+// It has to be chained after the auth.Middleware, which puts the verified user into the context.
+func (a ACL) Middleware(permission Permission) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if err := a.Authorize(ctx, namespaceFromContext(ctx), permission); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// LoadACL reads an ACL from a YAML or JSON file
+func LoadACL(path string) (ACL, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, so a single decoder handles both formats
+	var acl ACL
+	if err := yaml.Unmarshal(b, &acl); err != nil {
+		return nil, fmt.Errorf("failed to parse the ACL file %s: %w", path, err)
+	}
+	for namespace, entries := range acl {
+		if slices.Contains(slices.Concat(entries.Read, entries.Write), "") {
+			return nil, fmt.Errorf("the ACL of namespace %s contains an empty entry", namespace)
+		}
+	}
+	return acl, nil
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/audit"
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACL_Authorize(t *testing.T) {
+	acl := ACL{
+		"platform": NamespaceACL{
+			Read:  []string{"reader@example.com", "group:developers"},
+			Write: []string{"publisher@example.com", "group:platform-team"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		user       *audit.User
+		namespace  string
+		permission Permission
+		wantErr    bool
+	}{
+		{
+			name:       "subject allowed to read",
+			user:       &audit.User{Subject: "reader@example.com"},
+			namespace:  "platform",
+			permission: PermissionRead,
+		},
+		{
+			name:       "subject denied write but allowed read",
+			user:       &audit.User{Subject: "reader@example.com"},
+			namespace:  "platform",
+			permission: PermissionWrite,
+			wantErr:    true,
+		},
+		{
+			name:       "group allowed to read",
+			user:       &audit.User{Subject: "someone@example.com", Groups: []string{"developers"}},
+			namespace:  "platform",
+			permission: PermissionRead,
+		},
+		{
+			name:       "group allowed to write",
+			user:       &audit.User{Subject: "someone@example.com", Groups: []string{"platform-team"}},
+			namespace:  "platform",
+			permission: PermissionWrite,
+		},
+		{
+			name:       "write implies read",
+			user:       &audit.User{Subject: "publisher@example.com"},
+			namespace:  "platform",
+			permission: PermissionRead,
+		},
+		{
+			name:       "subject doesn't match a group",
+			user:       &audit.User{Subject: "developers"},
+			namespace:  "platform",
+			permission: PermissionRead,
+			wantErr:    true,
+		},
+		{
+			name:       "static token without subject",
+			user:       &audit.User{Provider: "static"},
+			namespace:  "platform",
+			permission: PermissionRead,
+			wantErr:    true,
+		},
+		{
+			name:       "unauthenticated",
+			namespace:  "platform",
+			permission: PermissionRead,
+			wantErr:    true,
+		},
+		{
+			name:       "unlisted namespace",
+			user:       &audit.User{Subject: "someone@example.com"},
+			namespace:  "other",
+			permission: PermissionWrite,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.user != nil {
+				ctx = audit.ContextWithUser(ctx, tc.user)
+			}
+
+			err := acl.Authorize(ctx, tc.namespace, tc.permission)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, core.ErrForbidden)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestACL_AuthorizePrefix(t *testing.T) {
+	acl := ACL{
+		"platform": NamespaceACL{Write: []string{"publisher@example.com"}},
+		"security": NamespaceACL{Write: []string{"auditor@example.com"}},
+	}
+	ctx := audit.ContextWithUser(context.Background(), &audit.User{Subject: "publisher@example.com"})
+
+	tests := []struct {
+		name    string
+		prefix  string
+		wantErr bool
+	}{
+		{
+			name:   "module namespace",
+			prefix: "modules/platform/",
+		},
+		{
+			name:   "provider version",
+			prefix: "providers/platform/aws/1.0.0",
+		},
+		{
+			name:    "mirrored namespace",
+			prefix:  "mirror/providers/registry.terraform.io/security/",
+			wantErr: true,
+		},
+		{
+			name:    "denied namespace",
+			prefix:  "modules/security/vpc",
+			wantErr: true,
+		},
+		{
+			name:    "incomplete namespace",
+			prefix:  "modules/plat",
+			wantErr: true,
+		},
+		{
+			name:    "all namespaces",
+			prefix:  "",
+			wantErr: true,
+		},
+		{
+			name:   "unlisted namespace",
+			prefix: "providers/other/",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := acl.AuthorizePrefix(ctx, tc.prefix, PermissionWrite)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, core.ErrForbidden)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestACL_Middleware(t *testing.T) {
+	acl := ACL{"platform": NamespaceACL{Read: []string{"reader@example.com"}}}
+	ctx := audit.ContextWithUser(ContextWithNamespace(context.Background(), "platform"), &audit.User{Subject: "reader@example.com"})
+	next := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+
+	resp, err := acl.Middleware(PermissionRead)(next)(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	_, err = acl.Middleware(PermissionWrite)(next)(ctx, nil)
+	assert.ErrorIs(t, err, core.ErrForbidden)
+}
+
+func TestLoadACL(t *testing.T) {
+	want := ACL{
+		"platform": NamespaceACL{
+			Read:  []string{"group:developers"},
+			Write: []string{"publisher@example.com"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name: "yaml",
+			content: `platform:
+  read: ["group:developers"]
+  write:
+    - publisher@example.com
+`,
+		},
+		{
+			name:    "json",
+			content: `{"platform": {"read": ["group:developers"], "write": ["publisher@example.com"]}}`,
+		},
+		{
+			name:    "empty entry",
+			content: `{"platform": {"read": [""]}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid",
+			content: `platform: [`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "acl")
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0o644))
+
+			got, err := LoadACL(path)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
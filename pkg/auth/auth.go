@@ -2,9 +2,13 @@ package auth
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strings"
 
+	"github.com/boring-registry/boring-registry/pkg/audit"
 	"github.com/boring-registry/boring-registry/pkg/core"
 
 	"github.com/go-kit/kit/auth/jwt"
@@ -21,22 +25,84 @@ func Middleware(providers ...Provider) endpoint.Middleware {
 				return next(ctx, request)
 			}
 
-			if token, ok := tokenValue.(string); ok {
-				for _, provider := range providers {
-					err := provider.Verify(ctx, token)
-					if err != nil {
-						slog.Debug("failed to verify token", slog.String("err", err.Error()))
-						return nil, fmt.Errorf("failed to verify token: %w", err)
-					} else {
-						slog.Debug("successfully verified token")
-						return next(ctx, request)
+			token, ok := tokenValue.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: request does not contain a token", core.ErrUnauthorized)
+			}
+
+			// The token is accepted if any of the providers is able to verify it
+			var err error
+			for _, provider := range providers {
+				if err = provider.Verify(ctx, token); err == nil {
+					slog.Debug("successfully verified token")
+					ctx = ContextWithScope(audit.ContextWithUser(ctx, verifiedUser(provider, token)), providerScope(provider))
+					ctx = contextWithNamespaceAuthorizer(ctx, verifiedNamespaceAuthorizer(ctx, provider, token))
+					return next(ctx, request)
+				}
+				slog.Debug("failed to verify token", slog.String("err", err.Error()))
+			}
+
+			return nil, fmt.Errorf("failed to verify token: %w", err)
+		}
+	}
+}
+
+// AnonymousReadMiddleware is the Middleware of read-only endpoints that are open to anonymous clients.
+// Requests without a token are passed on without a user, tokens that are sent are still verified,
+// so that the ACL and the audit log know the user.
+// Namespaces with namespace-specific claim requirements are never served to anonymous clients.
+func AnonymousReadMiddleware(providers ...Provider) endpoint.Middleware {
+	authenticated := Middleware(providers...)
+	authorize := anonymousNamespaceAuthorizer(providers)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		verify := authenticated(next)
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if token, ok := ctx.Value(jwt.JWTContextKey).(string); !ok || token == "" {
+				if namespace := namespaceFromContext(ctx); namespace != "" {
+					if err := authorize(namespace); err != nil {
+						return nil, err
 					}
 				}
-			} else {
-				return nil, fmt.Errorf("%w: request does not contain a token", core.ErrUnauthorized)
+				return next(contextWithNamespaceAuthorizer(ctx, authorize), request)
 			}
+			return verify(ctx, request)
+		}
+	}
+}
+
+// verifiedUser returns the audit.User of a verified token.
+// The subject and groups are only known for JWTs, as static tokens don't carry any claims
+func verifiedUser(provider Provider, token string) *audit.User {
+	user := &audit.User{}
+	if s, ok := provider.(fmt.Stringer); ok {
+		user.Provider = s.String()
+	}
 
-			return nil, core.ErrUnauthorized
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return user
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return user
+	}
+	var claims struct {
+		Subject string      `json:"sub"`
+		Groups  interface{} `json:"groups"`
+	}
+	if err := json.Unmarshal(payload, &claims); err == nil {
+		user.Subject = claims.Subject
+		// The groups claim is either a single string or an array of strings
+		switch g := claims.Groups.(type) {
+		case string:
+			user.Groups = []string{g}
+		case []interface{}:
+			for _, item := range g {
+				if s, ok := item.(string); ok {
+					user.Groups = append(user.Groups, s)
+				}
+			}
 		}
 	}
+	return user
 }
@@ -2,8 +2,12 @@ package auth
 
 import (
 	"context"
+	"encoding/base64"
 	"testing"
 
+	"github.com/boring-registry/boring-registry/pkg/audit"
+	"github.com/boring-registry/boring-registry/pkg/core"
+
 	"github.com/go-kit/kit/auth/jwt"
 	"github.com/stretchr/testify/assert"
 )
@@ -52,3 +56,78 @@ func TestAuthMiddleware(t *testing.T) {
 func nopEndpoint(ctx context.Context, request interface{}) (interface{}, error) {
 	return true, nil
 }
+
+func TestAuthMiddleware_UserContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), jwt.JWTContextKey, "foo")
+	res, err := Middleware(NewStaticProvider("foo"))(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return audit.GetUserFromContext(ctx), nil
+	})(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &audit.User{Provider: "static"}, res)
+}
+
+func TestAuthMiddleware_multipleProviders(t *testing.T) {
+	mw := Middleware(NewStaticProvider("foo"), NewStaticProvider("bar"))
+	for _, token := range []string{"foo", "bar"} {
+		_, err := mw(nopEndpoint)(context.WithValue(context.Background(), jwt.JWTContextKey, token), nil)
+		assert.NoError(t, err, token)
+	}
+
+	_, err := mw(nopEndpoint)(context.WithValue(context.Background(), jwt.JWTContextKey, "baz"), nil)
+	assert.ErrorIs(t, err, core.ErrInvalidToken)
+}
+
+func TestAnonymousReadMiddleware(t *testing.T) {
+	mw := AnonymousReadMiddleware(NewStaticProvider("foo"))(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return audit.GetUserFromContext(ctx), nil
+	})
+
+	// Anonymous requests are passed on without a user
+	res, err := mw(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	res, err = mw(context.WithValue(context.Background(), jwt.JWTContextKey, "foo"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &audit.User{Provider: "static"}, res)
+
+	_, err = mw(context.WithValue(context.Background(), jwt.JWTContextKey, "bar"), nil)
+	assert.ErrorIs(t, err, core.ErrInvalidToken)
+}
+
+func TestVerifiedUser(t *testing.T) {
+	jwtWithClaims := func(claims string) string {
+		return "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2ln"
+	}
+
+	provider := NewStaticProvider("foo")
+	assert.Equal(t,
+		&audit.User{Provider: "static", Subject: "someone", Groups: []string{"developers", "sre"}},
+		verifiedUser(provider, jwtWithClaims(`{"sub": "someone", "groups": ["developers", "sre"]}`)),
+	)
+	assert.Equal(t,
+		&audit.User{Provider: "static", Subject: "someone", Groups: []string{"developers"}},
+		verifiedUser(provider, jwtWithClaims(`{"sub": "someone", "groups": "developers"}`)),
+	)
+	assert.Equal(t, &audit.User{Provider: "static"}, verifiedUser(provider, "foo"))
+}
+
+func TestRequireScope(t *testing.T) {
+	providers := []Provider{NewStaticProvider("admin"), NewReadOnlyStaticProvider("ro")}
+	read := Middleware(providers...)(nopEndpoint)
+	write := Middleware(providers...)(RequireScope(ScopeAdmin)(nopEndpoint))
+
+	for _, token := range []string{"admin", "ro"} {
+		_, err := read(context.WithValue(context.Background(), jwt.JWTContextKey, token), nil)
+		assert.NoError(t, err, token)
+	}
+
+	_, err := write(context.WithValue(context.Background(), jwt.JWTContextKey, "admin"), nil)
+	assert.NoError(t, err)
+	_, err = write(context.WithValue(context.Background(), jwt.JWTContextKey, "ro"), nil)
+	assert.ErrorIs(t, err, core.ErrForbidden)
+
+	// Requests without a scope are only possible without auth providers
+	_, err = RequireScope(ScopeAdmin)(nopEndpoint)(context.Background(), nil)
+	assert.NoError(t, err)
+}
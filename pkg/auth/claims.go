@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+type contextKey string
+
+const (
+	namespaceContextKey           contextKey = "namespace"
+	namespaceAuthorizerContextKey contextKey = "namespaceAuthorizer"
+)
+
+// NamespaceToContext moves the namespace of the request path into the context,
+// so that the providers can enforce namespace-specific claim requirements
+func NamespaceToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if namespace, ok := mux.Vars(r)["namespace"]; ok {
+			ctx = ContextWithNamespace(ctx, namespace)
+		}
+		return ctx
+	}
+}
+
+// ContextWithNamespace returns a copy of ctx that carries the namespace for endpoints without a namespace path variable
+func ContextWithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceContextKey, namespace)
+}
+
+func namespaceFromContext(ctx context.Context) string {
+	namespace, _ := ctx.Value(namespaceContextKey).(string)
+	return namespace
+}
+
+// namespaceClaimsProvider is implemented by the providers that support namespace-specific claim requirements
+type namespaceClaimsProvider interface {
+	requiresNamespaceClaims(namespace string) bool
+}
+
+// namespaceAuthorizer checks the namespace-specific claim requirements for the token of a request
+type namespaceAuthorizer func(namespace string) error
+
+// verifiedNamespaceAuthorizer checks the claim requirements of other namespaces than the one of the request path with the verified token.
+// The results are remembered, as requests that list several namespaces check the same namespace repeatedly.
+func verifiedNamespaceAuthorizer(ctx context.Context, provider Provider, token string) namespaceAuthorizer {
+	p, ok := provider.(namespaceClaimsProvider)
+	if !ok {
+		return nil
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]error)
+	return func(namespace string) error {
+		if !p.requiresNamespaceClaims(namespace) {
+			return nil
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err, ok := results[namespace]; ok {
+			return err
+		}
+		err := provider.Verify(ContextWithNamespace(ctx, namespace), token)
+		results[namespace] = err
+		return err
+	}
+}
+
+// anonymousNamespaceAuthorizer rejects the namespaces that any of the providers has claim requirements for, as requests without a token can't satisfy them
+func anonymousNamespaceAuthorizer(providers []Provider) namespaceAuthorizer {
+	return func(namespace string) error {
+		for _, provider := range providers {
+			if p, ok := provider.(namespaceClaimsProvider); ok && p.requiresNamespaceClaims(namespace) {
+				return fmt.Errorf("%w: namespace %s requires a token", core.ErrUnauthorized, namespace)
+			}
+		}
+		return nil
+	}
+}
+
+func contextWithNamespaceAuthorizer(ctx context.Context, authorize namespaceAuthorizer) context.Context {
+	if authorize == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, namespaceAuthorizerContextKey, authorize)
+}
+
+// AuthorizeNamespace checks that the token of the request satisfies the namespace-specific claim requirements of the namespace.
+// It's meant for endpoints that return the modules and providers of several namespaces, which can't be checked when the token is verified.
+func AuthorizeNamespace(ctx context.Context, namespace string) error {
+	authorize, ok := ctx.Value(namespaceAuthorizerContextKey).(namespaceAuthorizer)
+	if !ok {
+		return nil
+	}
+	return authorize(namespace)
+}
+
+// RequiredClaims maps a claim to the accepted values.
+// A token satisfies the requirements if it contains at least one of the accepted values of every claim.
+type RequiredClaims map[string][]string
+
+// verify checks that the token claims satisfy the requirements.
+// Claims can either be strings or arrays of strings, like the commonly used groups claim
+func (r RequiredClaims) verify(claims map[string]interface{}) error {
+	for key, accepted := range r {
+		var values []string
+		switch v := claims[key].(type) {
+		case string:
+			values = []string{v}
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					values = append(values, s)
+				}
+			}
+		}
+
+		if !slices.ContainsFunc(values, func(value string) bool { return slices.Contains(accepted, value) }) {
+			return fmt.Errorf("%w: token is missing the required %s claim", core.ErrForbidden, key)
+		}
+	}
+	return nil
+}
+
+// ParseRequiredClaims parses claim requirements in the format key=value.
+// The same key can be repeated to accept multiple values
+func ParseRequiredClaims(requirements []string) (RequiredClaims, error) {
+	claims := make(RequiredClaims)
+	for _, requirement := range requirements {
+		key, value, ok := strings.Cut(requirement, "=")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid claim requirement %q, expected the format key=value", requirement)
+		}
+		claims[key] = append(claims[key], value)
+	}
+	return claims, nil
+}
+
+// ParseNamespaceRequiredClaims parses namespace-specific claim requirements in the format namespace:key=value
+func ParseNamespaceRequiredClaims(requirements []string) (map[string]RequiredClaims, error) {
+	namespaces := make(map[string]RequiredClaims)
+	for _, requirement := range requirements {
+		namespace, claim, ok := strings.Cut(requirement, ":")
+		if !ok || namespace == "" {
+			return nil, fmt.Errorf("invalid claim requirement %q, expected the format namespace:key=value", requirement)
+		}
+
+		parsed, err := ParseRequiredClaims([]string{claim})
+		if err != nil {
+			return nil, err
+		}
+
+		if namespaces[namespace] == nil {
+			namespaces[namespace] = make(RequiredClaims)
+		}
+		for key, values := range parsed {
+			namespaces[namespace][key] = append(namespaces[namespace][key], values...)
+		}
+	}
+	return namespaces, nil
+}
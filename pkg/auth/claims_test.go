@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRequiredClaims(t *testing.T) {
+	tests := []struct {
+		name         string
+		requirements []string
+		want         RequiredClaims
+		wantErr      bool
+	}{
+		{
+			name:         "repeated keys",
+			requirements: []string{"groups=platform-team", "groups=sre", "email_verified=true"},
+			want:         RequiredClaims{"groups": {"platform-team", "sre"}, "email_verified": {"true"}},
+		},
+		{
+			name:         "value contains a separator",
+			requirements: []string{"role=a=b"},
+			want:         RequiredClaims{"role": {"a=b"}},
+		},
+		{
+			name:         "missing value",
+			requirements: []string{"groups="},
+			wantErr:      true,
+		},
+		{
+			name:         "missing separator",
+			requirements: []string{"groups"},
+			wantErr:      true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseRequiredClaims(tc.requirements)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseNamespaceRequiredClaims(t *testing.T) {
+	got, err := ParseNamespaceRequiredClaims([]string{"acme:groups=acme-devs", "acme:groups=acme-ops", "example:role=admin"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]RequiredClaims{
+		"acme":    {"groups": {"acme-devs", "acme-ops"}},
+		"example": {"role": {"admin"}},
+	}, got)
+
+	_, err = ParseNamespaceRequiredClaims([]string{"groups=acme-devs"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+const (
+	defaultJWKSRefreshInterval    = time.Hour
+	defaultJWKSMinRefreshInterval = time.Minute
+
+	// maxJWKSKeys bounds the number of cached keys in case the IdP serves an unreasonably large key set
+	maxJWKSKeys = 32
+)
+
+// jwksKeySet implements oidc.KeySet and caches the keys of the jwks_uri.
+// The keys are refreshed every refreshInterval and whenever a token can't be verified with the cached keys,
+// which happens after the IdP rotated its signing keys.
+// Refreshes are rate-limited by minRefreshInterval to not hammer the IdP with tokens signed by unknown keys.
+// The same interval applies after a failed fetch, during which the cached keys continue to be served.
+type jwksKeySet struct {
+	jwksURL            string
+	client             *http.Client
+	algorithms         []jose.SignatureAlgorithm
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	logger             *slog.Logger
+	now                func() time.Time
+
+	// refreshMu serializes refreshes, so that concurrent verifications trigger only a single request to the IdP
+	refreshMu sync.Mutex
+	// lastAttempt and lastErr are guarded by refreshMu
+	lastAttempt time.Time
+	lastErr     error
+
+	mu          sync.RWMutex
+	keys        []jose.JSONWebKey
+	lastRefresh time.Time
+}
+
+func (k *jwksKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	jws, err := jose.ParseSigned(jwt, k.algorithms)
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt: %w", err)
+	}
+
+	keys, lastRefresh := k.cached()
+	if k.refreshInterval > 0 && k.now().Sub(lastRefresh) >= k.refreshInterval {
+		keys, err = k.refresh(ctx, k.refreshInterval)
+		if err != nil && len(keys) == 0 {
+			return nil, err
+		} else if err != nil {
+			k.logger.Warn("failed to refresh JWKS, continuing with cached keys", slog.String("err", err.Error()))
+		}
+	}
+
+	if payload, ok := verifyWithKeys(jws, keys); ok {
+		return payload, nil
+	}
+
+	// The token might be signed by a key that was rotated in after the last refresh
+	keys, err = k.refresh(ctx, k.minRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	if payload, ok := verifyWithKeys(jws, keys); ok {
+		return payload, nil
+	}
+	return nil, errors.New("failed to verify token signature")
+}
+
+func (k *jwksKeySet) cached() ([]jose.JSONWebKey, time.Time) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys, k.lastRefresh
+}
+
+// refresh fetches the keys from the jwks_uri, unless the cached keys are younger than minAge
+func (k *jwksKeySet) refresh(ctx context.Context, minAge time.Duration) ([]jose.JSONWebKey, error) {
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+
+	// Another verification might have refreshed the keys while waiting for the lock
+	keys, lastRefresh := k.cached()
+	if !lastRefresh.IsZero() && k.now().Sub(lastRefresh) < minAge {
+		return keys, nil
+	}
+
+	// Back off after a failed fetch instead of querying the IdP again for every request
+	if k.lastErr != nil && k.now().Sub(k.lastAttempt) < k.minRefreshInterval {
+		if len(keys) > 0 {
+			return keys, nil
+		}
+		return nil, k.lastErr
+	}
+
+	k.lastAttempt = k.now()
+	fetched, err := k.fetch(ctx)
+	if err != nil {
+		k.lastErr = fmt.Errorf("failed to fetch JWKS: %w", err)
+		return keys, k.lastErr
+	}
+	k.lastErr = nil
+	if len(fetched) > maxJWKSKeys {
+		k.logger.Warn("JWKS contains too many keys, ignoring the remaining keys", slog.Int("keys", len(fetched)), slog.Int("max", maxJWKSKeys))
+		fetched = fetched[:maxJWKSKeys]
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = fetched
+	k.lastRefresh = k.now()
+	k.logger.Debug("refreshed JWKS", slog.Int("keys", len(fetched)))
+	return fetched, nil
+}
+
+func (k *jwksKeySet) fetch(ctx context.Context) ([]jose.JSONWebKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code is %d instead of 200", resp.StatusCode)
+	}
+
+	var keySet jose.JSONWebKeySet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&keySet); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+	return keySet.Keys, nil
+}
+
+func verifyWithKeys(jws *jose.JSONWebSignature, keys []jose.JSONWebKey) ([]byte, bool) {
+	// Tokens with multiple signatures aren't supported
+	keyID := ""
+	if len(jws.Signatures) > 0 {
+		keyID = jws.Signatures[0].Header.KeyID
+	}
+
+	for _, key := range keys {
+		if keyID != "" && key.KeyID != keyID {
+			continue
+		}
+		if payload, err := jws.Verify(&key); err == nil {
+			return payload, true
+		}
+	}
+	return nil, false
+}
+
+func newJWKSKeySet(jwksURL string, algorithms []string, refreshInterval time.Duration, transport http.RoundTripper) *jwksKeySet {
+	algs := make([]jose.SignatureAlgorithm, 0, len(algorithms))
+	for _, a := range algorithms {
+		algs = append(algs, jose.SignatureAlgorithm(a))
+	}
+	if len(algs) == 0 {
+		// RS256 is the default according to the OpenID Connect Discovery specification
+		algs = append(algs, jose.RS256)
+	}
+
+	return &jwksKeySet{
+		jwksURL:            jwksURL,
+		client:             &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		algorithms:         algs,
+		refreshInterval:    refreshInterval,
+		minRefreshInterval: defaultJWKSMinRefreshInterval,
+		logger:             slog.Default().With(slog.String("component", "jwks")),
+		now:                time.Now,
+	}
+}
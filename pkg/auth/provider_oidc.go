@@ -2,7 +2,9 @@ package auth
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"net/http"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
@@ -13,20 +15,46 @@ type OidcProvider struct {
 	issuer           string
 	clientIdentifier string
 	provider         *oidc.Provider
+	algorithms       []string
+	keySet           *jwksKeySet
+
+	requiredClaims          RequiredClaims
+	namespaceRequiredClaims map[string]RequiredClaims
 }
 
-// Unfortunately, it's difficult to write tests for this method, as we would need an OIDC Authorization Server
-// to generate valid signed JWTs
+func (o *OidcProvider) String() string { return "oidc" }
+
 func (o *OidcProvider) Verify(ctx context.Context, token string) error {
 	oidcConfig := &oidc.Config{
-		ClientID: o.clientIdentifier,
+		ClientID:             o.clientIdentifier,
+		SupportedSigningAlgs: o.algorithms,
 	}
-	verifier := o.provider.VerifierContext(ctx, oidcConfig)
+	verifier := oidc.NewVerifier(o.issuer, o.keySet, oidcConfig)
 
 	// Check method documentation to see what is verified and what not.
 	// The returned IdToken can be used to verify claims.
-	_, err := verifier.Verify(ctx, token)
-	return err
+	idToken, err := verifier.Verify(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	namespaceClaims := o.namespaceRequiredClaims[namespaceFromContext(ctx)]
+	if len(o.requiredClaims) == 0 && len(namespaceClaims) == 0 {
+		return nil
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return fmt.Errorf("failed to decode token claims: %w", err)
+	}
+	if err := o.requiredClaims.verify(claims); err != nil {
+		return err
+	}
+	return namespaceClaims.verify(claims)
+}
+
+func (o *OidcProvider) requiresNamespaceClaims(namespace string) bool {
+	return len(o.namespaceRequiredClaims[namespace]) > 0
 }
 
 func (o *OidcProvider) AuthURL() string {
@@ -37,14 +65,75 @@ func (o *OidcProvider) TokenURL() string {
 	return o.provider.Endpoint().TokenURL
 }
 
-func NewOidcProvider(ctx context.Context, issuer, clientIdentifier string) (*OidcProvider, error) {
+// DeviceAuthURL returns the device authorization endpoint, which is empty if the IdP doesn't support the device authorization grant
+func (o *OidcProvider) DeviceAuthURL() string {
+	return o.provider.Endpoint().DeviceAuthURL
+}
+
+type oidcOptions struct {
+	jwksRefreshInterval     time.Duration
+	transport               http.RoundTripper
+	requiredClaims          RequiredClaims
+	namespaceRequiredClaims map[string]RequiredClaims
+}
+
+// OidcOption provides additional options for the OidcProvider
+type OidcOption func(*oidcOptions)
+
+// WithJWKSRefreshInterval configures the interval at which the signing keys are fetched from the jwks_uri.
+// Independent of the interval, the keys are fetched when a token is signed by an unknown key.
+// A zero interval disables the scheduled refresh.
+func WithJWKSRefreshInterval(interval time.Duration) OidcOption {
+	return func(o *oidcOptions) {
+		o.jwksRefreshInterval = interval
+	}
+}
+
+// WithHTTPTransport configures the transport of the discovery and JWKS requests to the issuer,
+// e.g. to send the outbound User-Agent. Go's default transport is used otherwise
+func WithHTTPTransport(transport http.RoundTripper) OidcOption {
+	return func(o *oidcOptions) {
+		o.transport = transport
+	}
+}
+
+// WithRequiredClaims configures claims that every token has to contain.
+// Tokens without the required claims are rejected with 403 Forbidden
+func WithRequiredClaims(claims RequiredClaims) OidcOption {
+	return func(o *oidcOptions) {
+		o.requiredClaims = claims
+	}
+}
+
+// WithNamespaceRequiredClaims configures claims that are required in addition to the global ones
+// when accessing modules and providers of a namespace
+func WithNamespaceRequiredClaims(claims map[string]RequiredClaims) OidcOption {
+	return func(o *oidcOptions) {
+		o.namespaceRequiredClaims = claims
+	}
+}
+
+func NewOidcProvider(ctx context.Context, issuer, clientIdentifier string, opts ...OidcOption) (*OidcProvider, error) {
+	o := &oidcOptions{
+		jwksRefreshInterval: defaultJWKSRefreshInterval,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	logger := slog.Default()
 	start := time.Now()
-	provider, err := oidc.NewProvider(ctx, issuer)
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, &http.Client{Transport: o.transport}), issuer)
 	if err != nil {
 		return nil, err
 	}
 
+	var config oidc.ProviderConfig
+	if err := provider.Claims(&config); err != nil {
+		return nil, fmt.Errorf("failed to decode provider metadata: %w", err)
+	}
+	algorithms := supportedSigningAlgorithms(config.Algorithms)
+
 	logger.Info("finished initializing OIDC provider", slog.String("took", time.Since(start).String()))
 
 	return &OidcProvider{
@@ -52,5 +141,22 @@ func NewOidcProvider(ctx context.Context, issuer, clientIdentifier string) (*Oid
 		issuer:           issuer,
 		clientIdentifier: clientIdentifier,
 		provider:         provider,
+		algorithms:       algorithms,
+		keySet:           newJWKSKeySet(config.JWKSURL, algorithms, o.jwksRefreshInterval, o.transport),
+
+		requiredClaims:          o.requiredClaims,
+		namespaceRequiredClaims: o.namespaceRequiredClaims,
 	}, nil
 }
+
+// supportedSigningAlgorithms filters out the algorithms advertised by the IdP that aren't supported by go-oidc, like HS256 or none
+func supportedSigningAlgorithms(algorithms []string) []string {
+	var supported []string
+	for _, a := range algorithms {
+		switch a {
+		case oidc.RS256, oidc.RS384, oidc.RS512, oidc.ES256, oidc.ES384, oidc.ES512, oidc.PS256, oidc.PS384, oidc.PS512, oidc.EdDSA:
+			supported = append(supported, a)
+		}
+	}
+	return supported
+}
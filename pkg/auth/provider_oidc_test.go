@@ -2,12 +2,22 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-kit/kit/auth/jwt"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -38,3 +48,316 @@ func TestOidcProviderDiscovery(t *testing.T) {
 	assert.NotEmpty(t, provider.AuthURL())
 	assert.NotEmpty(t, provider.TokenURL())
 }
+
+// testIdP serves the discovery document and the JWKS of an OIDC provider, whose signing key can be rotated
+type testIdP struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	key     *rsa.PrivateKey
+	keyID   string
+	fetches atomic.Int32
+	failing atomic.Bool
+
+	// userAgents are the User-Agent headers of the requests by path, guarded by mu
+	userAgents map[string]string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	idp := &testIdP{userAgents: make(map[string]string)}
+	idp.rotate(t, "key-1")
+	idp.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		idp.userAgents[r.URL.Path] = r.UserAgent()
+		idp.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"issuer":                                idp.server.URL,
+				"authorization_endpoint":                idp.server.URL + "/auth",
+				"token_endpoint":                        idp.server.URL + "/token",
+				"jwks_uri":                              idp.server.URL + "/keys",
+				"id_token_signing_alg_values_supported": []string{"RS256"},
+			})
+		case "/keys":
+			idp.fetches.Add(1)
+			if idp.failing.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			idp.mu.Lock()
+			defer idp.mu.Unlock()
+			_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+				{Key: idp.key.Public(), KeyID: idp.keyID, Algorithm: string(jose.RS256), Use: "sig"},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// rotate replaces the signing key of the IdP
+func (i *testIdP) rotate(t *testing.T, keyID string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.key = key
+	i.keyID = keyID
+}
+
+// token returns a token signed with the current signing key of the IdP, which contains the additional claims
+func (i *testIdP) token(t *testing.T, additionalClaims ...map[string]interface{}) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.RS256,
+		Key:       jose.JSONWebKey{Key: i.key, KeyID: i.keyID},
+	}, (&jose.SignerOptions{}).WithType("JWT"))
+	assert.NoError(t, err)
+
+	claims := map[string]interface{}{
+		"iss": i.server.URL,
+		"aud": "boring-registry",
+		"sub": "user",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for _, c := range additionalClaims {
+		for k, v := range c {
+			claims[k] = v
+		}
+	}
+	payload, err := json.Marshal(claims)
+	assert.NoError(t, err)
+
+	jws, err := signer.Sign(payload)
+	assert.NoError(t, err)
+	token, err := jws.CompactSerialize()
+	assert.NoError(t, err)
+	return token
+}
+
+func TestOidcProvider_KeyRotation(t *testing.T) {
+	idp := newTestIdP(t)
+	provider, err := NewOidcProvider(context.Background(), idp.server.URL, "boring-registry")
+	assert.NoError(t, err)
+	provider.keySet.minRefreshInterval = 0
+
+	oldToken := idp.token(t)
+	assert.NoError(t, provider.Verify(context.Background(), oldToken))
+	assert.Equal(t, int32(1), idp.fetches.Load())
+
+	// Cached keys are used for subsequent verifications
+	assert.NoError(t, provider.Verify(context.Background(), oldToken))
+	assert.Equal(t, int32(1), idp.fetches.Load())
+
+	// A token signed by the new key triggers a refresh
+	idp.rotate(t, "key-2")
+	assert.NoError(t, provider.Verify(context.Background(), idp.token(t)))
+	assert.Equal(t, int32(2), idp.fetches.Load())
+
+	// The old key is no longer part of the key set
+	assert.Error(t, provider.Verify(context.Background(), oldToken))
+}
+
+func TestOidcProvider_HTTPTransport(t *testing.T) {
+	idp := newTestIdP(t)
+	provider, err := NewOidcProvider(context.Background(), idp.server.URL, "boring-registry",
+		WithHTTPTransport(core.NewUserAgentTransport(nil, "boring-registry/test")),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, provider.Verify(context.Background(), idp.token(t)))
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	assert.Equal(t, map[string]string{
+		"/.well-known/openid-configuration": "boring-registry/test",
+		"/keys":                             "boring-registry/test",
+	}, idp.userAgents)
+}
+
+func TestOidcProvider_MinRefreshInterval(t *testing.T) {
+	idp := newTestIdP(t)
+	provider, err := NewOidcProvider(context.Background(), idp.server.URL, "boring-registry")
+	assert.NoError(t, err)
+
+	now := time.Now()
+	provider.keySet.now = func() time.Time { return now }
+	assert.NoError(t, provider.Verify(context.Background(), idp.token(t)))
+
+	// Tokens signed by unknown keys don't trigger a refresh within the minimum refresh interval
+	idp.rotate(t, "key-2")
+	rotated := idp.token(t)
+	for i := 0; i < 5; i++ {
+		assert.Error(t, provider.Verify(context.Background(), rotated))
+	}
+	assert.Equal(t, int32(1), idp.fetches.Load())
+
+	// After the minimum refresh interval, the rotated key is picked up
+	now = now.Add(defaultJWKSMinRefreshInterval)
+	assert.NoError(t, provider.Verify(context.Background(), rotated))
+	assert.Equal(t, int32(2), idp.fetches.Load())
+}
+
+func TestOidcProvider_ScheduledRefresh(t *testing.T) {
+	idp := newTestIdP(t)
+	provider, err := NewOidcProvider(context.Background(), idp.server.URL, "boring-registry", WithJWKSRefreshInterval(10*time.Minute))
+	assert.NoError(t, err)
+
+	now := time.Now()
+	provider.keySet.now = func() time.Time { return now }
+	token := idp.token(t)
+	assert.NoError(t, provider.Verify(context.Background(), token))
+
+	now = now.Add(5 * time.Minute)
+	assert.NoError(t, provider.Verify(context.Background(), token))
+	assert.Equal(t, int32(1), idp.fetches.Load())
+
+	now = now.Add(5 * time.Minute)
+	assert.NoError(t, provider.Verify(context.Background(), token))
+	assert.Equal(t, int32(2), idp.fetches.Load())
+}
+
+func TestOidcProvider_FailedRefresh(t *testing.T) {
+	idp := newTestIdP(t)
+	provider, err := NewOidcProvider(context.Background(), idp.server.URL, "boring-registry", WithJWKSRefreshInterval(10*time.Minute))
+	assert.NoError(t, err)
+
+	now := time.Now()
+	provider.keySet.now = func() time.Time { return now }
+	token := idp.token(t)
+	assert.NoError(t, provider.Verify(context.Background(), token))
+
+	// The cached keys are served while the IdP is unavailable, and the IdP isn't queried on every request
+	idp.failing.Store(true)
+	now = now.Add(10 * time.Minute)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, provider.Verify(context.Background(), token))
+	}
+	assert.Equal(t, int32(2), idp.fetches.Load())
+
+	// The fetch is retried after the minimum refresh interval
+	idp.failing.Store(false)
+	now = now.Add(defaultJWKSMinRefreshInterval)
+	assert.NoError(t, provider.Verify(context.Background(), token))
+	assert.Equal(t, int32(3), idp.fetches.Load())
+}
+
+func TestOidcProvider_RequiredClaims(t *testing.T) {
+	idp := newTestIdP(t)
+	provider, err := NewOidcProvider(context.Background(), idp.server.URL, "boring-registry",
+		WithRequiredClaims(RequiredClaims{"groups": {"platform-team", "sre"}}),
+		WithNamespaceRequiredClaims(map[string]RequiredClaims{"restricted": {"department": {"security"}}}),
+	)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		namespace string
+		claims    map[string]interface{}
+		wantErr   error
+	}{
+		{
+			name:   "token contains one of the required groups",
+			claims: map[string]interface{}{"groups": []string{"developers", "sre"}},
+		},
+		{
+			name:   "string claim",
+			claims: map[string]interface{}{"groups": "platform-team"},
+		},
+		{
+			name:    "token is missing the required group",
+			claims:  map[string]interface{}{"groups": []string{"developers"}},
+			wantErr: core.ErrForbidden,
+		},
+		{
+			name:    "token is missing the claim",
+			wantErr: core.ErrForbidden,
+		},
+		{
+			name:      "namespace without additional requirements",
+			namespace: "example",
+			claims:    map[string]interface{}{"groups": []string{"sre"}},
+		},
+		{
+			name:      "token satisfies the namespace requirements",
+			namespace: "restricted",
+			claims:    map[string]interface{}{"groups": []string{"sre"}, "department": "security"},
+		},
+		{
+			name:      "token is missing the namespace claim",
+			namespace: "restricted",
+			claims:    map[string]interface{}{"groups": []string{"sre"}},
+			wantErr:   core.ErrForbidden,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.namespace != "" {
+				ctx = context.WithValue(ctx, namespaceContextKey, tc.namespace)
+			}
+
+			err := provider.Verify(ctx, idp.token(t, tc.claims))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthorizeNamespace(t *testing.T) {
+	idp := newTestIdP(t)
+	provider, err := NewOidcProvider(context.Background(), idp.server.URL, "boring-registry",
+		WithNamespaceRequiredClaims(map[string]RequiredClaims{"restricted": {"department": {"security"}}}),
+	)
+	assert.NoError(t, err)
+
+	authorizeNamespaces := Middleware(provider)(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return []error{AuthorizeNamespace(ctx, "public"), AuthorizeNamespace(ctx, "restricted")}, nil
+	})
+
+	// The namespace-specific claims apply to namespaces that aren't part of the request path
+	res, err := authorizeNamespaces(context.WithValue(context.Background(), jwt.JWTContextKey, idp.token(t)), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, res.([]error)[0])
+	assert.ErrorIs(t, res.([]error)[1], core.ErrForbidden)
+
+	res, err = authorizeNamespaces(context.WithValue(context.Background(), jwt.JWTContextKey, idp.token(t, map[string]interface{}{"department": "security"})), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []error{nil, nil}, res)
+}
+
+func TestAnonymousReadMiddleware_namespaceClaims(t *testing.T) {
+	idp := newTestIdP(t)
+	provider, err := NewOidcProvider(context.Background(), idp.server.URL, "boring-registry",
+		WithNamespaceRequiredClaims(map[string]RequiredClaims{"restricted": {"department": {"security"}}}),
+	)
+	assert.NoError(t, err)
+
+	authorizeNamespaces := AnonymousReadMiddleware(provider)(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return []error{AuthorizeNamespace(ctx, "public"), AuthorizeNamespace(ctx, "restricted")}, nil
+	})
+
+	// Anonymous requests to the path of a namespace with claim requirements are rejected
+	_, err = authorizeNamespaces(ContextWithNamespace(context.Background(), "restricted"), nil)
+	assert.ErrorIs(t, err, core.ErrUnauthorized)
+
+	// Listings of several namespaces leave out the namespaces with claim requirements
+	res, err := authorizeNamespaces(ContextWithNamespace(context.Background(), "public"), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, res.([]error)[0])
+	assert.ErrorIs(t, res.([]error)[1], core.ErrUnauthorized)
+
+	res, err = authorizeNamespaces(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, res.([]error)[1], core.ErrUnauthorized)
+}
@@ -1,28 +1,215 @@
 package auth
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
+// maxVerifiedHashedTokens bounds the caches of tokens that were verified or rejected against the bcrypt hashes
+const maxVerifiedHashedTokens = 1024
+
+// compareHashAndPassword is replaced in tests to count the bcrypt comparisons
+var compareHashAndPassword = bcrypt.CompareHashAndPassword
+
 type StaticProvider struct {
+	// tokens and hashes are passed in with flags or environment variables and are immutable
 	tokens []string
+	hashes [][]byte
+
+	// tokenFile is read on startup and whenever Reload is called
+	tokenFile  string
+	mu         sync.RWMutex
+	fileTokens []string
+	fileHashes [][]byte
+
+	// verified and rejected cache the SHA-256 digests of tokens that matched or didn't match the bcrypt hashes,
+	// as bcrypt is deliberately too slow to run for every request.
+	// generation is incremented by Reload, so that results for the previous hashes aren't cached anymore
+	verifiedMu sync.Mutex
+	verified   map[[sha256.Size]byte]struct{}
+	rejected   map[[sha256.Size]byte]struct{}
+	generation uint64
+
+	scope Scope
 }
 
 func (p *StaticProvider) String() string { return "static" }
 
+// Scope returns the scope of all tokens of the provider
+func (p *StaticProvider) Scope() Scope { return p.scope }
+
 func (p *StaticProvider) Verify(ctx context.Context, token string) error {
+	p.mu.RLock()
+	// All tokens are compared in constant time to not leak information about the valid tokens through timing
+	valid := 0
 	for _, validToken := range p.tokens {
-		if token == validToken {
-			return nil
-		}
+		valid |= subtle.ConstantTimeCompare([]byte(token), []byte(validToken))
+	}
+	for _, validToken := range p.fileTokens {
+		valid |= subtle.ConstantTimeCompare([]byte(token), []byte(validToken))
+	}
+	// The hashes are copied to not block Reload during the bcrypt comparisons
+	hashes := slices.Concat(p.hashes, p.fileHashes)
+	generation := p.generation
+	p.mu.RUnlock()
+
+	if valid == 1 {
+		return nil
+	}
+
+	if p.verifyHashed(token, hashes, generation) {
+		return nil
 	}
 
 	return core.ErrInvalidToken
 }
 
+// verifyHashed compares the token against the bcrypt hashes of the given generation
+func (p *StaticProvider) verifyHashed(token string, hashes [][]byte, generation uint64) bool {
+	// JWTs of the OIDC provider are never static tokens, so they're rejected without running bcrypt
+	if len(hashes) == 0 || isJWT(token) {
+		return false
+	}
+
+	digest := sha256.Sum256([]byte(token))
+	p.verifiedMu.Lock()
+	_, verified := p.verified[digest]
+	_, rejected := p.rejected[digest]
+	p.verifiedMu.Unlock()
+	if verified || rejected {
+		return verified
+	}
+
+	ok := false
+	for _, hash := range hashes {
+		if compareHashAndPassword(hash, []byte(token)) == nil {
+			ok = true
+			break
+		}
+	}
+
+	p.verifiedMu.Lock()
+	defer p.verifiedMu.Unlock()
+	if generation != p.generation {
+		return ok
+	}
+	cache := p.rejected
+	if ok {
+		cache = p.verified
+	}
+	if len(cache) >= maxVerifiedHashedTokens {
+		clear(cache)
+	}
+	cache[digest] = struct{}{}
+	return ok
+}
+
+// isJWT reports whether the token consists of three dot-separated base64url segments like a JWT
+func isJWT(token string) bool {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return false
+	}
+	for _, segment := range segments {
+		if segment == "" {
+			return false
+		}
+		if _, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "=")); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Reload reads the tokens from the token file again.
+// The previous tokens are kept in case the file can't be read
+func (p *StaticProvider) Reload() error {
+	if p.tokenFile == "" {
+		return nil
+	}
+
+	f, err := os.Open(p.tokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to open token file: %w", err)
+	}
+	defer f.Close()
+
+	tokens, err := parseTokenFile(f)
+	if err != nil {
+		return fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fileTokens, p.fileHashes = splitHashedTokens(tokens)
+
+	// Previously verified tokens might belong to hashes that were removed from the file,
+	// and previously rejected tokens might match hashes that were added
+	p.verifiedMu.Lock()
+	clear(p.verified)
+	clear(p.rejected)
+	p.generation++
+	p.verifiedMu.Unlock()
+
+	slog.Info("loaded static tokens from file", slog.String("file", p.tokenFile), slog.Int("tokens", len(tokens)))
+	return nil
+}
+
+// parseTokenFile reads one token per line.
+// Blank lines and lines starting with # are ignored
+func parseTokenFile(r io.Reader) ([]string, error) {
+	var tokens []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	return tokens, scanner.Err()
+}
+
+// IsHashedToken reports whether the token is a bcrypt hash instead of a plaintext token
+func IsHashedToken(token string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(token, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitHashedTokens separates plaintext tokens from bcrypt hashes
+func splitHashedTokens(tokens []string) ([]string, [][]byte) {
+	var plaintext []string
+	var hashes [][]byte
+	for _, t := range tokens {
+		if IsHashedToken(t) {
+			hashes = append(hashes, []byte(t))
+		} else {
+			plaintext = append(plaintext, t)
+		}
+	}
+	return plaintext, hashes
+}
+
+// NewStaticProvider returns a Provider that accepts the passed tokens with the ScopeAdmin scope.
+// Tokens with a bcrypt prefix like $2a$ or $2b$ are treated as hashes, which the presented tokens are compared against
 func NewStaticProvider(tokens ...string) Provider {
 	// spf13/viper and spf13/pflag currently do not support reading multiple values from environment variables and
 	// extracting them into a StringSlice/StringArray.
@@ -45,7 +232,30 @@ func NewStaticProvider(tokens ...string) Provider {
 		}
 	}
 
+	plaintext, hashes := splitHashedTokens(parsed)
 	return &StaticProvider{
-		tokens: parsed,
+		tokens:   plaintext,
+		hashes:   hashes,
+		verified: make(map[[sha256.Size]byte]struct{}),
+		rejected: make(map[[sha256.Size]byte]struct{}),
+		scope:    ScopeAdmin,
+	}
+}
+
+// NewReadOnlyStaticProvider returns a Provider like NewStaticProvider, whose tokens have the ScopeRead scope
+func NewReadOnlyStaticProvider(tokens ...string) Provider {
+	p := NewStaticProvider(tokens...).(*StaticProvider)
+	p.scope = ScopeRead
+	return p
+}
+
+// NewStaticProviderFromFile returns a StaticProvider that accepts the tokens of the token file in addition to the passed tokens.
+// Call Reload to pick up changes of the token file
+func NewStaticProviderFromFile(tokenFile string, tokens ...string) (*StaticProvider, error) {
+	p := NewStaticProvider(tokens...).(*StaticProvider)
+	p.tokenFile = tokenFile
+	if err := p.Reload(); err != nil {
+		return nil, err
 	}
+	return p, nil
 }
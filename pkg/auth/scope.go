@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Scope restricts the endpoints that a token grants access to
+type Scope string
+
+const (
+	// ScopeRead grants access to the endpoints that only read from the registry
+	ScopeRead Scope = "read"
+	// ScopeAdmin grants access to all endpoints, including the ones that change the registry
+	ScopeAdmin Scope = "admin"
+)
+
+const scopeContextKey contextKey = "scope"
+
+// scopedProvider is implemented by providers whose tokens carry a scope.
+// The tokens of other providers have the ScopeAdmin scope.
+type scopedProvider interface {
+	Scope() Scope
+}
+
+func providerScope(provider Provider) Scope {
+	if p, ok := provider.(scopedProvider); ok {
+		return p.Scope()
+	}
+	return ScopeAdmin
+}
+
+// ContextWithScope stores the scope of the verified token in the context
+func ContextWithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeContextKey, scope)
+}
+
+// ScopeFromContext returns the scope of the verified token, which is missing for unauthenticated requests
+func ScopeFromContext(ctx context.Context) (Scope, bool) {
+	scope, ok := ctx.Value(scopeContextKey).(Scope)
+	return scope, ok
+}
+
+// RequireScope is the Middleware of endpoints that change the registry, it has to be chained after the auth Middleware.
+// Requests with a token of another scope than the required one or ScopeAdmin are rejected with core.ErrForbidden.
+// Requests without a scope are passed on, as they're only possible if no auth providers are configured.
+func RequireScope(scope Scope) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if granted, ok := ScopeFromContext(ctx); ok && granted != scope && granted != ScopeAdmin {
+				return nil, fmt.Errorf("%w: the token has the %s scope, but %s is required", core.ErrForbidden, granted, scope)
+			}
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package catalog
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type catalogRequest struct {
+	namespace string
+	limit     int
+	cursor    string
+
+	// providerName selects the versions of the provider in the namespace instead of the catalog entries
+	providerName string
+}
+
+func catalogEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(catalogRequest)
+		if req.providerName != "" {
+			return svc.ProviderVersions(ctx, req.namespace, req.providerName, req.limit, req.cursor)
+		}
+		return svc.Catalog(ctx, req.namespace, req.limit, req.cursor)
+	}
+}
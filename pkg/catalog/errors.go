@@ -0,0 +1,10 @@
+package catalog
+
+import "errors"
+
+var (
+	// Catalog errors
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrInvalidLimit    = errors.New("invalid limit")
+	ErrInvalidProvider = errors.New("invalid provider, expected <namespace>/<name>")
+)
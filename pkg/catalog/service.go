@@ -0,0 +1,301 @@
+package catalog
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/auth"
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/hashicorp/go-version"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+
+	EntryTypeModule   = "module"
+	EntryTypeProvider = "provider"
+)
+
+// Entry is a module or provider with all its versions
+type Entry struct {
+	Type      string `json:"type"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Provider is the provider of a module and empty for providers
+	Provider string `json:"provider,omitempty"`
+	// LatestVersion is the highest version that isn't a pre-release, unless only pre-releases exist
+	LatestVersion string   `json:"latest_version"`
+	Versions      []string `json:"versions"`
+}
+
+// key identifies the entry and defines the order of the catalog
+func (e *Entry) key() string {
+	return strings.Join([]string{e.Type, e.Namespace, e.Name, e.Provider}, "/")
+}
+
+// Catalog is a page of the entries
+type Catalog struct {
+	Entries []Entry `json:"entries"`
+	// NextCursor is passed as the cursor to retrieve the next page and empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ProviderVersions is a page of the versions of a provider with their platforms
+type ProviderVersions struct {
+	Namespace string                 `json:"namespace"`
+	Name      string                 `json:"name"`
+	Versions  []core.ProviderVersion `json:"versions"`
+	// NextCursor is passed as the cursor to retrieve the next page and empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Service implements the catalog of all modules and providers
+type Service interface {
+	// Catalog returns up to limit entries following the cursor, optionally filtered by namespace
+	Catalog(ctx context.Context, namespace string, limit int, cursor string) (*Catalog, error)
+
+	// ProviderVersions returns up to limit versions of a provider following the cursor.
+	// The versions are paginated by the storage backend, so providers with many versions are never listed completely.
+	ProviderVersions(ctx context.Context, namespace, name string, limit int, cursor string) (*ProviderVersions, error)
+
+	// InvalidateCache drops the cached listing of the storage prefix, so that the next request lists the storage again.
+	// The listing aggregates all modules and providers, so it's dropped for any prefix that overlaps with them,
+	// but kept for other prefixes like the mirror. It returns the number of dropped listings.
+	InvalidateCache(ctx context.Context, prefix string) int
+}
+
+// listedPrefixes are the storage prefixes of the modules and providers in the listing
+var listedPrefixes = []string{"modules/", "providers/"}
+
+type service struct {
+	storage  Storage
+	cacheTTL time.Duration
+	acl      auth.ACL
+	now      func() time.Time
+
+	mu sync.Mutex
+	// cache holds the entries per storage prefix, so that virtual registries don't share their catalog
+	cache map[string]cachedEntries
+}
+
+type cachedEntries struct {
+	entries []Entry
+	expires time.Time
+}
+
+func validateLimit(limit int) error {
+	if limit <= 0 || limit > MaxLimit {
+		return fmt.Errorf("%w: has to be between 1 and %d", ErrInvalidLimit, MaxLimit)
+	}
+	return nil
+}
+
+func (s *service) Catalog(ctx context.Context, namespace string, limit int, cursor string) (*Catalog, error) {
+	if err := validateLimit(limit); err != nil {
+		return nil, err
+	}
+
+	after := ""
+	if cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		after = string(b)
+	}
+
+	entries, err := s.aggregate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cursor is the key of the last entry of the previous page, which stays valid if entries are added or removed
+	start, _ := slices.BinarySearchFunc(entries, after, func(e Entry, key string) int {
+		return cmp.Compare(e.key(), key)
+	})
+	if start < len(entries) && entries[start].key() == after {
+		start++
+	}
+
+	// The entries of namespaces that the user isn't allowed to read are skipped, so that they don't shorten the page
+	authorized := make(map[string]bool)
+	c := &Catalog{Entries: []Entry{}}
+	for _, e := range entries[start:] {
+		if namespace != "" && e.Namespace != namespace {
+			continue
+		}
+		if _, ok := authorized[e.Namespace]; !ok {
+			authorized[e.Namespace] = s.authorize(ctx, e.Namespace) == nil
+		}
+		if !authorized[e.Namespace] {
+			continue
+		}
+		if len(c.Entries) == limit {
+			c.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(c.Entries[len(c.Entries)-1].key()))
+			break
+		}
+		c.Entries = append(c.Entries, e)
+	}
+
+	return c, nil
+}
+
+// ProviderVersions bypasses the cache, as the pages are resumed with the continuation token of the storage backend
+func (s *service) ProviderVersions(ctx context.Context, namespace, name string, limit int, cursor string) (*ProviderVersions, error) {
+	if err := validateLimit(limit); err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, namespace); err != nil {
+		return nil, err
+	}
+
+	versions, next, err := s.storage.ListProviderVersionsPage(ctx, namespace, name, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProviderVersions{
+		Namespace:  namespace,
+		Name:       name,
+		Versions:   versions.Versions,
+		NextCursor: next,
+	}, nil
+}
+
+// authorize checks the ACL and the namespace-specific claim requirements of the namespace,
+// as the catalog isn't bound to the namespace of the request path
+func (s *service) authorize(ctx context.Context, namespace string) error {
+	if err := s.acl.Authorize(ctx, namespace, auth.PermissionRead); err != nil {
+		return err
+	}
+	return auth.AuthorizeNamespace(ctx, namespace)
+}
+
+// aggregate returns the sorted entries, which are cached for the cacheTTL.
+// Concurrent requests wait for a single refresh instead of listing the storage multiple times.
+func (s *service) aggregate(ctx context.Context) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := core.StoragePrefix(ctx)
+	if cached, ok := s.cache[prefix]; ok && s.now().Before(cached.expires) {
+		return cached.entries, nil
+	}
+
+	modules, err := s.storage.ListAllModules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list modules: %w", err)
+	}
+	providers, err := s.storage.ListAllProviders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list providers: %w", err)
+	}
+
+	versions := make(map[string]*Entry)
+	add := func(e Entry, v string) {
+		k := e.key()
+		if _, ok := versions[k]; !ok {
+			versions[k] = &e
+		}
+		if !slices.Contains(versions[k].Versions, v) {
+			versions[k].Versions = append(versions[k].Versions, v)
+		}
+	}
+	for _, m := range modules {
+		add(Entry{Type: EntryTypeModule, Namespace: m.Namespace, Name: m.Name, Provider: m.Provider}, m.Version)
+	}
+	for _, p := range providers {
+		add(Entry{Type: EntryTypeProvider, Namespace: p.Namespace, Name: p.Name}, p.Version)
+	}
+
+	entries := make([]Entry, 0, len(versions))
+	for _, e := range versions {
+		e.Versions, e.LatestVersion = sortVersions(e.Versions)
+		entries = append(entries, *e)
+	}
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return cmp.Compare(a.key(), b.key())
+	})
+
+	s.cache[prefix] = cachedEntries{entries: entries, expires: s.now().Add(s.cacheTTL)}
+	return entries, nil
+}
+
+func (s *service) InvalidateCache(ctx context.Context, prefix string) int {
+	if !slices.ContainsFunc(listedPrefixes, func(p string) bool {
+		return strings.HasPrefix(p, prefix) || strings.HasPrefix(prefix, p)
+	}) {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	storagePrefix := core.StoragePrefix(ctx)
+	if _, ok := s.cache[storagePrefix]; !ok {
+		return 0
+	}
+	delete(s.cache, storagePrefix)
+	return 1
+}
+
+// sortVersions sorts the versions in ascending order and returns the latest version.
+// Versions that aren't valid semantic versions are appended at the end and never considered the latest version.
+func sortVersions(raw []string) ([]string, string) {
+	var parsed []*version.Version
+	var invalid []string
+	for _, r := range raw {
+		v, err := version.NewVersion(r)
+		if err != nil {
+			invalid = append(invalid, r)
+			continue
+		}
+		parsed = append(parsed, v)
+	}
+	slices.SortFunc(parsed, func(a, b *version.Version) int { return a.Compare(b) })
+	slices.Sort(invalid)
+
+	sorted := make([]string, 0, len(raw))
+	for _, v := range parsed {
+		sorted = append(sorted, v.Original())
+	}
+
+	latest, ok := core.LatestVersion(sorted, false)
+	if !ok {
+		latest, _ = core.LatestVersion(sorted, true)
+	}
+
+	return append(sorted, invalid...), latest
+}
+
+// NewService returns a catalog Service, which caches the listing of the storage for the cacheTTL
+// Option configures the catalog Service
+type Option func(*service)
+
+// WithACL omits the entries of namespaces, which the user isn't allowed to read
+func WithACL(acl auth.ACL) Option {
+	return func(s *service) {
+		s.acl = acl
+	}
+}
+
+func NewService(storage Storage, cacheTTL time.Duration, opts ...Option) Service {
+	s := &service{
+		storage:  storage,
+		cacheTTL: cacheTTL,
+		now:      time.Now,
+		cache:    make(map[string]cachedEntries),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
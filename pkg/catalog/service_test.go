@@ -0,0 +1,274 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/audit"
+	"github.com/boring-registry/boring-registry/pkg/auth"
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockedStorage struct {
+	modules   []core.Module
+	providers []*core.Provider
+	err       error
+	listings  int
+}
+
+func (m *mockedStorage) ListAllModules(_ context.Context) ([]core.Module, error) {
+	m.listings++
+	return m.modules, m.err
+}
+
+func (m *mockedStorage) ListAllProviders(_ context.Context) ([]*core.Provider, error) {
+	return m.providers, m.err
+}
+
+// ListProviderVersionsPage pages the versions of the providers, the cursor is the index of the next version
+func (m *mockedStorage) ListProviderVersionsPage(_ context.Context, namespace, name string, limit int, token string) (*core.ProviderVersions, string, error) {
+	collected := &core.ProviderVersions{}
+	for _, p := range m.providers {
+		if p.Namespace != namespace || p.Name != name {
+			continue
+		}
+		if n := len(collected.Versions); n == 0 || collected.Versions[n-1].Version != p.Version {
+			collected.Versions = append(collected.Versions, core.ProviderVersion{Namespace: namespace, Name: name, Version: p.Version})
+		}
+		v := &collected.Versions[len(collected.Versions)-1]
+		v.Platforms = append(v.Platforms, core.Platform{OS: p.OS, Arch: p.Arch})
+	}
+
+	start := 0
+	if token != "" {
+		var err error
+		if start, err = strconv.Atoi(token); err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+	end := min(start+limit, len(collected.Versions))
+	next := ""
+	if end < len(collected.Versions) {
+		next = strconv.Itoa(end)
+	}
+	return &core.ProviderVersions{Versions: collected.Versions[start:end]}, next, m.err
+}
+
+func testStorage() *mockedStorage {
+	return &mockedStorage{
+		modules: []core.Module{
+			{Namespace: "acme", Name: "vpc", Provider: "aws", Version: "1.0.0"},
+			{Namespace: "acme", Name: "vpc", Provider: "aws", Version: "1.10.0"},
+			{Namespace: "acme", Name: "vpc", Provider: "aws", Version: "1.2.0"},
+			{Namespace: "acme", Name: "vpc", Provider: "aws", Version: "2.0.0-rc1"},
+			{Namespace: "acme", Name: "vpc", Provider: "google", Version: "0.1.0"},
+			{Namespace: "tools", Name: "bucket", Provider: "aws", Version: "3.0.0"},
+		},
+		providers: []*core.Provider{
+			{Namespace: "acme", Name: "dummy", Version: "0.1.0", OS: "linux", Arch: "amd64"},
+			{Namespace: "acme", Name: "dummy", Version: "0.1.0", OS: "darwin", Arch: "arm64"},
+			{Namespace: "acme", Name: "dummy", Version: "0.2.0-beta", OS: "linux", Arch: "amd64"},
+			{Namespace: "tools", Name: "preview", Version: "1.0.0-alpha", OS: "linux", Arch: "amd64"},
+		},
+	}
+}
+
+func TestService_Catalog(t *testing.T) {
+	svc := NewService(testStorage(), time.Minute)
+
+	c, err := svc.Catalog(context.Background(), "", DefaultLimit, "")
+	require.NoError(t, err)
+	assert.Empty(t, c.NextCursor)
+	assert.Equal(t, []Entry{
+		{Type: EntryTypeModule, Namespace: "acme", Name: "vpc", Provider: "aws", LatestVersion: "1.10.0", Versions: []string{"1.0.0", "1.2.0", "1.10.0", "2.0.0-rc1"}},
+		{Type: EntryTypeModule, Namespace: "acme", Name: "vpc", Provider: "google", LatestVersion: "0.1.0", Versions: []string{"0.1.0"}},
+		{Type: EntryTypeModule, Namespace: "tools", Name: "bucket", Provider: "aws", LatestVersion: "3.0.0", Versions: []string{"3.0.0"}},
+		{Type: EntryTypeProvider, Namespace: "acme", Name: "dummy", LatestVersion: "0.1.0", Versions: []string{"0.1.0", "0.2.0-beta"}},
+		{Type: EntryTypeProvider, Namespace: "tools", Name: "preview", LatestVersion: "1.0.0-alpha", Versions: []string{"1.0.0-alpha"}},
+	}, c.Entries)
+}
+
+func TestService_Catalog_pagination(t *testing.T) {
+	svc := NewService(testStorage(), time.Minute)
+
+	var names []string
+	cursor := ""
+	pages := 0
+	for {
+		c, err := svc.Catalog(context.Background(), "", 2, cursor)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(c.Entries), 2)
+		for _, e := range c.Entries {
+			names = append(names, e.key())
+		}
+		pages++
+		if c.NextCursor == "" {
+			break
+		}
+		cursor = c.NextCursor
+	}
+
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, []string{
+		"module/acme/vpc/aws",
+		"module/acme/vpc/google",
+		"module/tools/bucket/aws",
+		"provider/acme/dummy/",
+		"provider/tools/preview/",
+	}, names)
+}
+
+func TestService_Catalog_cursorSurvivesRemovedEntry(t *testing.T) {
+	storage := testStorage()
+	s := NewService(storage, 0).(*service)
+
+	first, err := s.Catalog(context.Background(), "", 2, "")
+	require.NoError(t, err)
+
+	// The last entry of the first page is deleted before the second page is requested
+	storage.modules = append(storage.modules[:4], storage.modules[5])
+	second, err := s.Catalog(context.Background(), "", 2, first.NextCursor)
+	require.NoError(t, err)
+	require.NotEmpty(t, second.Entries)
+	assert.Equal(t, "module/tools/bucket/aws", second.Entries[0].key())
+}
+
+func TestService_Catalog_namespace(t *testing.T) {
+	svc := NewService(testStorage(), time.Minute)
+
+	first, err := svc.Catalog(context.Background(), "tools", 1, "")
+	require.NoError(t, err)
+	require.Len(t, first.Entries, 1)
+	assert.Equal(t, "module/tools/bucket/aws", first.Entries[0].key())
+	assert.NotEmpty(t, first.NextCursor)
+
+	second, err := svc.Catalog(context.Background(), "tools", 1, first.NextCursor)
+	require.NoError(t, err)
+	require.Len(t, second.Entries, 1)
+	assert.Equal(t, "provider/tools/preview/", second.Entries[0].key())
+	assert.Empty(t, second.NextCursor)
+
+	none, err := svc.Catalog(context.Background(), "unknown", DefaultLimit, "")
+	require.NoError(t, err)
+	assert.Empty(t, none.Entries)
+}
+
+func TestService_Catalog_acl(t *testing.T) {
+	svc := NewService(testStorage(), time.Minute, WithACL(auth.ACL{"tools": {Read: []string{"alice"}}}))
+
+	c, err := svc.Catalog(context.Background(), "", 2, "")
+	require.NoError(t, err)
+	require.Len(t, c.Entries, 2)
+	assert.Equal(t, "module/acme/vpc/aws", c.Entries[0].key())
+	assert.Equal(t, "module/acme/vpc/google", c.Entries[1].key())
+
+	// The entries of the tools namespace don't count towards the limit of the page
+	c, err = svc.Catalog(context.Background(), "", 2, c.NextCursor)
+	require.NoError(t, err)
+	require.Len(t, c.Entries, 1)
+	assert.Equal(t, "provider/acme/dummy/", c.Entries[0].key())
+	assert.Empty(t, c.NextCursor)
+
+	_, err = svc.ProviderVersions(context.Background(), "tools", "preview", DefaultLimit, "")
+	assert.ErrorIs(t, err, core.ErrForbidden)
+
+	ctx := audit.ContextWithUser(context.Background(), &audit.User{Subject: "alice"})
+	c, err = svc.Catalog(ctx, "", DefaultLimit, "")
+	require.NoError(t, err)
+	assert.Len(t, c.Entries, 5)
+}
+
+func TestService_Catalog_invalidRequests(t *testing.T) {
+	svc := NewService(testStorage(), time.Minute)
+
+	_, err := svc.Catalog(context.Background(), "", 0, "")
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+
+	_, err = svc.Catalog(context.Background(), "", MaxLimit+1, "")
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+
+	_, err = svc.Catalog(context.Background(), "", DefaultLimit, "not base64!")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestService_Catalog_cache(t *testing.T) {
+	storage := testStorage()
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	s := NewService(storage, time.Minute).(*service)
+	s.now = func() time.Time { return now }
+
+	for range 3 {
+		_, err := s.Catalog(context.Background(), "", DefaultLimit, "")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, storage.listings)
+
+	now = now.Add(time.Minute)
+	_, err := s.Catalog(context.Background(), "", DefaultLimit, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, storage.listings)
+
+	// Failed listings aren't cached
+	now = now.Add(time.Minute)
+	storage.err = errors.New("storage is unavailable")
+	_, err = s.Catalog(context.Background(), "", DefaultLimit, "")
+	assert.Error(t, err)
+	storage.err = nil
+	_, err = s.Catalog(context.Background(), "", DefaultLimit, "")
+	require.NoError(t, err)
+	assert.Equal(t, 4, storage.listings)
+
+	// Virtual registries with another storage prefix are cached separately
+	_, err = s.Catalog(core.ContextWithStoragePrefix(context.Background(), "tofu"), "", DefaultLimit, "")
+	require.NoError(t, err)
+	assert.Equal(t, 5, storage.listings)
+}
+
+func TestService_InvalidateCache(t *testing.T) {
+	storage := testStorage()
+	s := NewService(storage, time.Hour)
+
+	_, err := s.Catalog(context.Background(), "", DefaultLimit, "")
+	require.NoError(t, err)
+	assert.Zero(t, s.InvalidateCache(context.Background(), "mirror/providers/"))
+	assert.Equal(t, 1, s.InvalidateCache(context.Background(), "providers/acme/"))
+	assert.Zero(t, s.InvalidateCache(context.Background(), ""))
+
+	_, err = s.Catalog(context.Background(), "", DefaultLimit, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, storage.listings)
+
+	// The listings of other virtual registries are kept
+	assert.Zero(t, s.InvalidateCache(core.ContextWithStoragePrefix(context.Background(), "tofu"), ""))
+	_, err = s.Catalog(context.Background(), "", DefaultLimit, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, storage.listings)
+}
+
+func TestService_ProviderVersions(t *testing.T) {
+	svc := NewService(testStorage(), time.Minute)
+
+	first, err := svc.ProviderVersions(context.Background(), "acme", "dummy", 1, "")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", first.Namespace)
+	assert.Equal(t, "dummy", first.Name)
+	require.Len(t, first.Versions, 1)
+	assert.Equal(t, "0.1.0", first.Versions[0].Version)
+	assert.Len(t, first.Versions[0].Platforms, 2)
+	require.NotEmpty(t, first.NextCursor)
+
+	second, err := svc.ProviderVersions(context.Background(), "acme", "dummy", 1, first.NextCursor)
+	require.NoError(t, err)
+	require.Len(t, second.Versions, 1)
+	assert.Equal(t, "0.2.0-beta", second.Versions[0].Version)
+	assert.Empty(t, second.NextCursor)
+
+	_, err = svc.ProviderVersions(context.Background(), "acme", "dummy", MaxLimit+1, "")
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+}
@@ -0,0 +1,20 @@
+package catalog
+
+import (
+	"context"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+)
+
+// Storage lists all modules and providers of the registry
+type Storage interface {
+	// ListAllModules returns all versions of all modules
+	ListAllModules(ctx context.Context) ([]core.Module, error)
+
+	// ListAllProviders returns all platforms of all versions of the internal providers
+	ListAllProviders(ctx context.Context) ([]*core.Provider, error)
+
+	// ListProviderVersionsPage returns up to limit versions of an internal provider in the order of the storage backend.
+	// The returned token resumes the listing with the next page and is empty on the last page.
+	ListProviderVersionsPage(ctx context.Context, namespace, name string, limit int, token string) (*core.ProviderVersions, string, error)
+}
@@ -0,0 +1,106 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/boring-registry/boring-registry/pkg/auth"
+	"github.com/boring-registry/boring-registry/pkg/core"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+	"github.com/boring-registry/boring-registry/pkg/openapi"
+
+	"github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// Routes describes the endpoints of MakeHandler for the OpenAPI document
+var Routes = []openapi.Route{
+	{
+		Method:  http.MethodGet,
+		Summary: "List the modules and providers of the registry",
+		Parameters: []openapi.Parameter{
+			openapi.QueryParameter("namespace", "string", "Only list the modules and providers of the namespace"),
+			openapi.QueryParameter("provider", "string", "Return the versions of the provider in the <namespace>/<name> format instead"),
+			openapi.QueryParameter("limit", "integer", "The maximum number of entries per page"),
+			openapi.QueryParameter("cursor", "string", "The cursor of the next page from the previous response"),
+		},
+		Responses: map[int]string{
+			http.StatusOK:         "A page of the catalog",
+			http.StatusBadRequest: "The limit, cursor or provider is invalid",
+		},
+		Authenticated: true,
+	},
+}
+
+// MakeHandler returns a fully initialized http.Handler.
+func MakeHandler(svc Service, authMiddleware endpoint.Middleware, instrumentation o11y.Middleware, options ...httptransport.ServerOption) http.Handler {
+	return instrumentation.WrapHandler(
+		httptransport.NewServer(
+			authMiddleware(catalogEndpoint(svc)),
+			decodeCatalogRequest,
+			httptransport.EncodeJSONResponse,
+			append(
+				options,
+				httptransport.ServerBefore(jwt.HTTPToContext()),
+				httptransport.ServerBefore(namespaceToContext),
+			)...,
+		),
+	)
+}
+
+// namespaceToContext applies the namespace-specific claim requirements, if the catalog is filtered by namespace or provider
+func namespaceToContext(ctx context.Context, r *http.Request) context.Context {
+	namespace := r.URL.Query().Get("namespace")
+	if provider := r.URL.Query().Get("provider"); provider != "" {
+		namespace, _, _ = strings.Cut(provider, "/")
+	}
+	if namespace != "" {
+		return auth.ContextWithNamespace(ctx, namespace)
+	}
+	return ctx
+}
+
+func decodeCatalogRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+
+	limit := DefaultLimit
+	if l := query.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidLimit, l)
+		}
+	}
+
+	req := catalogRequest{
+		namespace: query.Get("namespace"),
+		limit:     limit,
+		cursor:    query.Get("cursor"),
+	}
+
+	if provider := query.Get("provider"); provider != "" {
+		namespace, name, ok := strings.Cut(provider, "/")
+		if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidProvider, provider)
+		}
+		if req.namespace != "" && req.namespace != namespace {
+			return nil, fmt.Errorf("%w: %s is not in the namespace %s", ErrInvalidProvider, provider, req.namespace)
+		}
+		req.namespace = namespace
+		req.providerName = name
+	}
+	return req, nil
+}
+
+// ErrorEncoder translates domain specific errors to HTTP status codes
+func ErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
+	core.EncodeError(err, w,
+		core.ErrorStatus{Err: ErrInvalidCursor, StatusCode: http.StatusBadRequest},
+		core.ErrorStatus{Err: ErrInvalidLimit, StatusCode: http.StatusBadRequest},
+		core.ErrorStatus{Err: ErrInvalidProvider, StatusCode: http.StatusBadRequest},
+	)
+}
@@ -0,0 +1,248 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// DefaultMinSize is the size below which the compression overhead outweighs the savings
+	DefaultMinSize = 1024
+
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+)
+
+// supportedEncodings is ordered by preference
+var supportedEncodings = []string{encodingZstd, encodingGzip}
+
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	zstdWriters = sync.Pool{New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return w
+	}}
+)
+
+// Middleware compresses JSON responses larger than minSize with zstd or gzip, depending on the Accept-Encoding of the request.
+// Other responses, like the archives served by the download proxy, are passed through unmodified,
+// as they're compressed already and can be streamed without buffering.
+func Middleware(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := negotiate(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &responseWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				minSize:        minSize,
+			}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiate returns the preferred encoding that's accepted by the client, or an empty string
+func negotiate(acceptEncoding string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[name] = q > 0
+	}
+
+	for _, e := range supportedEncodings {
+		if enabled, ok := accepted[e]; ok {
+			if enabled {
+				return e
+			}
+			continue
+		}
+		if accepted["*"] {
+			return e
+		}
+	}
+	return ""
+}
+
+type mode int
+
+const (
+	// undecided responses are buffered until they exceed the minSize or the handler returns
+	undecided mode = iota
+	passthrough
+	compressing
+)
+
+// responseWriter defers the decision whether to compress until the response headers and the first bytes are known
+type responseWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	mode        mode
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+	encoder     io.WriteCloser
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+
+	if !w.compressible() {
+		w.mode = passthrough
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	// The response differs depending on the Accept-Encoding, even if it turns out to be too small to be compressed
+	w.Header().Add("Vary", "Accept-Encoding")
+	if cl, err := strconv.Atoi(w.Header().Get("Content-Length")); err == nil && cl < w.minSize {
+		w.mode = passthrough
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+// compressible reports whether the response is eligible for compression based on its status and headers
+func (w *responseWriter) compressible() bool {
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		// Go's response writer sniffs the content type at this point, but the middleware only compresses JSON, which is always declared
+		w.WriteHeader(http.StatusOK)
+	}
+
+	switch w.mode {
+	case passthrough:
+		return w.ResponseWriter.Write(p)
+	case compressing:
+		return w.encoder.Write(p)
+	}
+
+	w.buf.Write(p)
+	if w.buf.Len() >= w.minSize {
+		if err := w.startCompression(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *responseWriter) startCompression() error {
+	w.mode = compressing
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", w.encoding)
+	w.ResponseWriter.WriteHeader(w.status)
+
+	switch w.encoding {
+	case encodingZstd:
+		enc := zstdWriters.Get().(*zstd.Encoder)
+		enc.Reset(w.ResponseWriter)
+		w.encoder = enc
+	default:
+		enc := gzipWriters.Get().(*gzip.Writer)
+		enc.Reset(w.ResponseWriter)
+		w.encoder = enc
+	}
+
+	_, err := w.encoder.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// close flushes the compressed stream, or writes the buffered response uncompressed if it stayed below the minSize
+func (w *responseWriter) close() {
+	switch w.mode {
+	case undecided:
+		if !w.wroteHeader {
+			return
+		}
+		w.ResponseWriter.WriteHeader(w.status)
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+	case compressing:
+		_ = w.encoder.Close()
+		switch enc := w.encoder.(type) {
+		case *zstd.Encoder:
+			zstdWriters.Put(enc)
+		case *gzip.Writer:
+			gzipWriters.Put(enc)
+		}
+	}
+}
+
+func (w *responseWriter) Flush() {
+	switch w.mode {
+	case undecided:
+		if w.wroteHeader {
+			if err := w.startCompression(); err != nil {
+				return
+			}
+		}
+	case compressing:
+		if f, ok := w.encoder.(interface{ Flush() error }); ok {
+			_ = f.Flush()
+		}
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("the response writer doesn't support hijacking")
+}
+
+// Unwrap allows http.ResponseController to access the underlying http.ResponseWriter
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,211 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case encodingGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		r = gz
+	case encodingZstd:
+		dec, err := zstd.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		defer dec.Close()
+		r = dec
+	default:
+		return body
+	}
+	decoded, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return decoded
+}
+
+func TestMiddleware(t *testing.T) {
+	largeJSON := []byte(`{"modules":[` + strings.Repeat(`{"namespace":"hashicorp","name":"consul","provider":"aws"},`, 100) + `{}]}`)
+	smallJSON := []byte(`{"versions":[]}`)
+	archive := make([]byte, 64*1024)
+	_, _ = rand.Read(archive)
+
+	tests := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		contentType    string
+		contentLength  bool
+		status         int
+		body           []byte
+		wantEncoding   string
+		wantVary       bool
+	}{
+		{
+			name:           "gzip",
+			acceptEncoding: "gzip, deflate",
+			contentType:    "application/json; charset=utf-8",
+			body:           largeJSON,
+			wantEncoding:   encodingGzip,
+			wantVary:       true,
+		},
+		{
+			name:           "zstd is preferred",
+			acceptEncoding: "gzip, zstd",
+			contentType:    "application/json",
+			body:           largeJSON,
+			wantEncoding:   encodingZstd,
+			wantVary:       true,
+		},
+		{
+			name:           "rejected encoding",
+			acceptEncoding: "zstd;q=0, gzip;q=0.5",
+			contentType:    "application/json",
+			body:           largeJSON,
+			wantEncoding:   encodingGzip,
+			wantVary:       true,
+		},
+		{
+			name:           "wildcard",
+			acceptEncoding: "*",
+			contentType:    "application/problem+json",
+			status:         http.StatusNotFound,
+			body:           largeJSON,
+			wantEncoding:   encodingZstd,
+			wantVary:       true,
+		},
+		{
+			name:        "no Accept-Encoding",
+			contentType: "application/json",
+			body:        largeJSON,
+		},
+		{
+			name:           "unsupported encoding",
+			acceptEncoding: "br",
+			contentType:    "application/json",
+			body:           largeJSON,
+		},
+		{
+			name:           "below the minimum size",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			body:           smallJSON,
+			wantVary:       true,
+		},
+		{
+			name:           "below the minimum size with Content-Length",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			contentLength:  true,
+			body:           smallJSON,
+			wantVary:       true,
+		},
+		{
+			name:           "Content-Length is dropped",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			contentLength:  true,
+			body:           largeJSON,
+			wantEncoding:   encodingGzip,
+			wantVary:       true,
+		},
+		{
+			name:           "proxied zip archive",
+			acceptEncoding: "gzip, zstd",
+			contentType:    "application/zip",
+			contentLength:  true,
+			body:           archive,
+		},
+		{
+			name:           "proxied archive without content type",
+			acceptEncoding: "gzip",
+			body:           archive,
+		},
+		{
+			name:           "HEAD request",
+			method:         http.MethodHead,
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := Middleware(DefaultMinSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.contentType != "" {
+					w.Header().Set("Content-Type", tc.contentType)
+				}
+				if tc.contentLength {
+					w.Header().Set("Content-Length", strconv.Itoa(len(tc.body)))
+				}
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+				}
+				// Write in chunks to cover buffering across writes
+				for b := tc.body; len(b) > 0; {
+					n := min(len(b), 100)
+					_, _ = w.Write(b[:n])
+					b = b[n:]
+				}
+			}))
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/v1/modules", nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			wantStatus := tc.status
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			assert.Equal(t, wantStatus, rec.Code)
+			assert.Equal(t, tc.wantEncoding, rec.Header().Get("Content-Encoding"))
+			assert.Equal(t, tc.wantVary, rec.Header().Get("Vary") == "Accept-Encoding")
+			if tc.wantEncoding != "" {
+				assert.Empty(t, rec.Header().Get("Content-Length"))
+				assert.Less(t, rec.Body.Len(), len(tc.body))
+			}
+			assert.Equal(t, tc.body, decode(t, tc.wantEncoding, rec.Body.Bytes()))
+		})
+	}
+}
+
+func TestMiddleware_alreadyEncoded(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write([]byte(strings.Repeat(`{"key":"value"}`, 200)))
+	require.NoError(t, gz.Close())
+
+	// An upstream response that's forwarded with its encoding must not be compressed twice
+	handler := Middleware(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(compressed.Bytes())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, compressed.Bytes(), rec.Body.Bytes())
+}
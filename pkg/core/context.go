@@ -0,0 +1,17 @@
+package core
+
+import "context"
+
+type storagePrefixKey struct{}
+
+// ContextWithStoragePrefix returns a context, in which the storage backends additionally prefix all keys with the prefix.
+// It's used to serve multiple virtual registries with distinct contents from a single deployment.
+func ContextWithStoragePrefix(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, storagePrefixKey{}, prefix)
+}
+
+// StoragePrefix returns the prefix set with ContextWithStoragePrefix, or an empty string
+func StoragePrefix(ctx context.Context) string {
+	prefix, _ := ctx.Value(storagePrefixKey{}).(string)
+	return prefix
+}
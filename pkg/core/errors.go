@@ -12,14 +12,24 @@ var (
 	// Transport errors
 	ErrVarMissing = errors.New("variable missing")
 	ErrVarType    = errors.New("invalid variable type")
+	// ErrRequestTooLarge is returned for request bodies exceeding the maximum upload size
+	ErrRequestTooLarge = errors.New("request body too large")
 
 	// Auth errors
 	ErrUnauthorized = errors.New("unauthorized")           // Middleware error
 	ErrInvalidToken = errors.New("failed to verify token") // Provider error
+	ErrForbidden    = errors.New("forbidden")              // Provider error
+
+	// Rate limit errors
+	ErrTooManyRequests = errors.New("too many requests")
 
 	// Storage errors
 	ErrObjectNotFound      = errors.New("failed to locate object")
 	ErrObjectAlreadyExists = errors.New("object already exists")
+	// ErrStorageTimeout is returned for operations against the storage backend that didn't complete in time
+	ErrStorageTimeout = errors.New("storage operation timed out")
+	// ErrUploadInProgress is returned if the upload lock of a provider version is held by another upload
+	ErrUploadInProgress = errors.New("another upload of the provider version is in progress")
 )
 
 type ProviderError struct {
@@ -56,27 +66,85 @@ func (p ProviderError) Error() string {
 
 // GenericError returns the HTTP status code for module-agnostic boring-registry errors
 func GenericError(err error) int {
+	var maxBytesError *http.MaxBytesError
 	if errors.Is(err, ErrVarMissing) {
 		return http.StatusBadRequest
+	} else if errors.Is(err, ErrRequestTooLarge) || errors.As(err, &maxBytesError) {
+		return http.StatusRequestEntityTooLarge
 	} else if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrUnauthorized) {
 		return http.StatusUnauthorized
+	} else if errors.Is(err, ErrForbidden) {
+		return http.StatusForbidden
+	} else if errors.Is(err, ErrObjectNotFound) {
+		return http.StatusNotFound
 	} else if errors.Is(err, ErrObjectAlreadyExists) {
 		return http.StatusConflict
+	} else if errors.Is(err, ErrTooManyRequests) {
+		return http.StatusTooManyRequests
+	} else if errors.Is(err, ErrStorageTimeout) {
+		return http.StatusGatewayTimeout
 	}
 
 	// Default error
 	return http.StatusInternalServerError
 }
 
-// HandleErrorResponse handles the HTTP response for errors
-func HandleErrorResponse(err error, w http.ResponseWriter) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+// ErrorStatus maps a domain specific sentinel error to an HTTP status code
+type ErrorStatus struct {
+	Err        error
+	StatusCode int
+}
+
+// StatusCode returns the HTTP status code of the first sentinel error that matches.
+// A ProviderError carries its own status code, all other errors are mapped by GenericError.
+func StatusCode(err error, statuses ...ErrorStatus) int {
+	for _, s := range statuses {
+		if errors.Is(err, s.Err) {
+			return s.StatusCode
+		}
+	}
+
+	var providerError *ProviderError
+	if errors.As(err, &providerError) {
+		return providerError.StatusCode
+	}
+
+	return GenericError(err)
+}
 
-	_ = json.NewEncoder(w).Encode(struct {
-		Errors []string `json:"errors"`
-	}{
+// Problem is an RFC 7807 problem details object.
+// Errors contains the detail in the error format of the Terraform registry API, which existing clients rely on.
+type Problem struct {
+	Type   string   `json:"type"`
+	Title  string   `json:"title"`
+	Status int      `json:"status"`
+	Detail string   `json:"detail"`
+	Errors []string `json:"errors"`
+}
+
+// EncodeError writes an application/problem+json response with the status code of the error
+func EncodeError(err error, w http.ResponseWriter, statuses ...ErrorStatus) {
+	HandleErrorResponse(err, StatusCode(err, statuses...), w)
+}
+
+// HandleErrorResponse writes an application/problem+json response for the error with the given status code
+func HandleErrorResponse(err error, statusCode int, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(statusCode)
+
+	_ = json.NewEncoder(w).Encode(NewProblem(err, statusCode))
+}
+
+// NewProblem returns the Problem of the error with the given status code
+func NewProblem(err error, statusCode int) Problem {
+	return Problem{
+		// There are no problem types specific to boring-registry, the title is therefore the status text
+		Type:   "about:blank",
+		Title:  http.StatusText(statusCode),
+		Status: statusCode,
+		Detail: err.Error(),
 		Errors: []string{
 			err.Error(),
 		},
-	})
+	}
 }
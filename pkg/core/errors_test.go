@@ -1,9 +1,15 @@
 package core
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestProviderError_Error(t *testing.T) {
@@ -56,3 +62,93 @@ func TestProviderError_Error(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeError(t *testing.T) {
+	errDomain := errors.New("domain error")
+	tests := []struct {
+		name       string
+		err        error
+		statuses   []ErrorStatus
+		wantStatus int
+	}{
+		{
+			name:       "missing variable",
+			err:        ErrVarMissing,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid token",
+			err:        fmt.Errorf("%w: expired", ErrInvalidToken),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unauthorized",
+			err:        ErrUnauthorized,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "forbidden",
+			err:        ErrForbidden,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "object not found",
+			err:        ErrObjectNotFound,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "object already exists",
+			err:        ErrObjectAlreadyExists,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "too many requests",
+			err:        ErrTooManyRequests,
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:       "storage timeout",
+			err:        fmt.Errorf("%w: GetModule didn't complete within 1s", ErrStorageTimeout),
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name: "provider error",
+			err: &ProviderError{
+				Reason:     "failed to locate provider",
+				Provider:   &Provider{Namespace: "hashicorp", Name: "random"},
+				StatusCode: http.StatusNotFound,
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "domain error",
+			err:        fmt.Errorf("wrapped: %w", errDomain),
+			statuses:   []ErrorStatus{{Err: errDomain, StatusCode: http.StatusBadGateway}},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "unknown error",
+			err:        errors.New("unknown"),
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			EncodeError(tt.err, rec, tt.statuses...)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+
+			var problem Problem
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+			assert.Equal(t, Problem{
+				Type:   "about:blank",
+				Title:  http.StatusText(tt.wantStatus),
+				Status: tt.wantStatus,
+				Detail: tt.err.Error(),
+				Errors: []string{tt.err.Error()},
+			}, problem)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type ifNoneMatchContextKey struct{}
+
+// IfNoneMatchToContext moves the If-None-Match header of the request into the context.
+// It's meant to be used as a ServerBefore function of the go-kit HTTP transport.
+func IfNoneMatchToContext(ctx context.Context, r *http.Request) context.Context {
+	if v := r.Header.Get("If-None-Match"); v != "" {
+		return context.WithValue(ctx, ifNoneMatchContextKey{}, v)
+	}
+	return ctx
+}
+
+// NewETag returns a weak ETag of the entries, which doesn't depend on their order.
+// The ETag is weak, as the compression of the response changes its bytes.
+func NewETag(entries []string) string {
+	sorted := slices.Clone(entries)
+	slices.Sort(sorted)
+
+	h := sha256.New()
+	for _, e := range sorted {
+		h.Write([]byte(e))
+		h.Write([]byte{'\n'})
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:16])
+}
+
+// NotModified sets the ETag header and reports whether the If-None-Match header in the context matches it.
+// The caller must not write a body and is responsible for the 304 Not Modified status in that case.
+func NotModified(ctx context.Context, w http.ResponseWriter, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	ifNoneMatch, _ := ctx.Value(ifNoneMatchContextKey{}).(string)
+	if ifNoneMatch == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	// If-None-Match uses the weak comparison, which ignores the W/ prefix
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
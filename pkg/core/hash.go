@@ -0,0 +1,66 @@
+package core
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	// HashSchemeZh identifies the SHA256 checksum of a provider archive, as listed in the SHA256SUMS file
+	HashSchemeZh = "zh:"
+	// HashSchemeH1 identifies the hash of the contents of a provider archive, which is independent of the archive format
+	HashSchemeH1 = "h1:"
+)
+
+// HashZh returns the zh: hash of a provider archive
+func HashZh(archive io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, archive); err != nil {
+		return "", err
+	}
+	return HashSchemeZh + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashH1 returns the h1: hash of a provider zip archive.
+// It's the base64 encoded SHA256 checksum of a summary, which lists the SHA256 checksum and the name of each file in lexical order.
+// This is the same hash as computed by Terraform with the Hash1 function of golang.org/x/mod/sumdb/dirhash.
+func HashH1(archive io.ReaderAt, size int64) (string, error) {
+	r, err := zip.NewReader(archive, size)
+	if err != nil {
+		return "", err
+	}
+
+	files := make(map[string]*zip.File, len(r.File))
+	names := make([]string, 0, len(r.File))
+	for _, f := range r.File {
+		if strings.Contains(f.Name, "\n") {
+			return "", fmt.Errorf("file name %q contains a newline", f.Name)
+		}
+		files[f.Name] = f
+		names = append(names, f.Name)
+	}
+	slices.Sort(names)
+
+	summary := sha256.New()
+	for _, name := range names {
+		rc, err := files[name].Open()
+		if err != nil {
+			return "", err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(summary, "%x  %s\n", h.Sum(nil), name)
+	}
+
+	return HashSchemeH1 + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashes(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, name := range []string{"terraform-provider-dummy_v1.0.0", "LICENSE", "docs/"} {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		if name != "docs/" {
+			_, err = fw.Write([]byte("content of " + name))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, w.Close())
+
+	// The expected hash was computed with dirhash.HashZip of golang.org/x/mod
+	h1, err := HashH1(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	assert.Equal(t, "h1:WCc++mitRkqD/VbDgF65LFbIhS73mDSN2kyBXQHwwLY=", h1)
+
+	zh, err := HashZh(bytes.NewReader([]byte("test")))
+	assert.NoError(t, err)
+	assert.Equal(t, "zh:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", zh)
+
+	_, err = HashH1(bytes.NewReader([]byte("no zip")), 6)
+	assert.Error(t, err)
+}
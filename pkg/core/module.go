@@ -9,6 +9,9 @@ type Module struct {
 	Provider    string `json:"provider"`
 	Version     string `json:"version"`
 	DownloadURL string `json:"download_url"`
+	// Checksum is the hex-encoded SHA-256 checksum of the archive, which is computed while the archive is uploaded.
+	// It's empty for archives that were uploaded before checksums were stored.
+	Checksum string `json:"checksum,omitempty"`
 }
 
 // ID returns the module metadata in a compact format.
@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
 	openpgpErrors "github.com/ProtonMail/go-crypto/openpgp/errors"
 )
 
@@ -37,6 +38,7 @@ type Provider struct {
 	SHASumsSignatureURL string      `json:"shasums_signature_url,omitempty"`
 	SigningKeys         SigningKeys `json:"signing_keys,omitempty"`
 	Platforms           []Platform  `json:"platforms,omitempty"`
+	DocsURL             string      `json:"docs_url,omitempty"`
 }
 
 func (p *Provider) ArchiveFileName() string {
@@ -74,6 +76,22 @@ func (p *Provider) ShasumSignatureFileName() string {
 	return fmt.Sprintf("%s%s_%s_SHA256SUMS.sig", ProviderPrefix, p.Name, p.Version)
 }
 
+// DocsFileName returns the name of the metadata.json document of a provider version
+func (p *Provider) DocsFileName() string {
+	if p.Name == "" {
+		panic("provider Name is empty")
+	} else if p.Version == "" {
+		panic("provider Version is empty")
+	}
+
+	return fmt.Sprintf("%s%s_%s_metadata.json", ProviderPrefix, p.Name, p.Version)
+}
+
+// H1HashFileName returns the name of the file, which holds the h1: hash of the archive
+func (p *Provider) H1HashFileName() string {
+	return p.ArchiveFileName() + ".h1"
+}
+
 // Clone returns a deep copy of the struct
 func (p *Provider) Clone() *Provider {
 	r := &Provider{
@@ -88,6 +106,7 @@ func (p *Provider) Clone() *Provider {
 		Shasum:              p.Shasum,
 		SHASumsURL:          p.SHASumsURL,
 		SHASumsSignatureURL: p.SHASumsSignatureURL,
+		DocsURL:             p.DocsURL,
 	}
 	if p.Platforms != nil {
 		r.Platforms = make([]Platform, len(p.Platforms))
@@ -104,6 +123,9 @@ func NewProviderFromArchive(filename string) (Provider, error) {
 	// Criterias for terraform archives:
 	// https://www.terraform.io/docs/registry/providers/publishing.html#manually-preparing-a-release
 	f := filepath.Base(filename) // This is just a precaution
+	if !strings.HasSuffix(f, ProviderExtension) {
+		return Provider{}, fmt.Errorf("couldn't parse provider file name: %s", filename)
+	}
 	trimmed := strings.TrimPrefix(f, ProviderPrefix)
 	trimmed = strings.TrimSuffix(trimmed, ProviderExtension)
 	tokens := strings.Split(trimmed, "_")
@@ -127,31 +149,97 @@ type SigningKeys struct {
 }
 
 // IsValidSha256Sums verifies whether the GPG signature of to the SHA256SUMS file was created with a private key
-// corresponding to one of the public keys in SigningKeys
+// corresponding to one of the public keys in SigningKeys.
+// The signature can be binary or ASCII-armored and may consist of the signatures of several keys.
 func (s *SigningKeys) IsValidSha256Sums(sha256Sums, sha256SumsSig []byte) error {
+	signature, err := dearmorSignature(sha256SumsSig)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
 	for _, key := range s.GPGPublicKeys {
 		keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.ASCIIArmor))
 		if err != nil {
-			return fmt.Errorf("error reading signing key: %w", err)
-		}
-
-		_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(sha256Sums), bytes.NewReader(sha256SumsSig), nil)
-
-		// If the signature issuer does not match the key, keep trying the rest of the provided keys.
-		if errors.Is(err, openpgpErrors.ErrUnknownIssuer) {
+			errs = append(errs, fmt.Errorf("error reading signing key: %w", err))
 			continue
-		} else if err != nil {
-			return err
 		}
 
+		_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(sha256Sums), bytes.NewReader(signature), nil)
 		if err == nil {
 			return nil
 		}
+
+		// If the signature issuer does not match the key, keep trying the rest of the provided keys.
+		if !errors.Is(err, openpgpErrors.ErrUnknownIssuer) {
+			errs = append(errs, err)
+		}
 	}
 
+	if len(errs) > 0 {
+		return fmt.Errorf("no valid key found for signature: %w", errors.Join(errs...))
+	}
 	return errors.New("no valid key found for signature")
 }
 
+const armoredSignatureHeader = "-----BEGIN PGP SIGNATURE-----"
+
+// dearmorSignature returns the binary packets of an ASCII-armored signature, binary signatures are returned unchanged.
+// Concatenated armored blocks, for example of signatures by different keys, are joined into a single packet sequence.
+func dearmorSignature(sig []byte) ([]byte, error) {
+	rest := bytes.TrimSpace(sig)
+	if !bytes.HasPrefix(rest, []byte(armoredSignatureHeader)) {
+		return sig, nil
+	}
+
+	var packets []byte
+	for len(rest) > 0 {
+		block, err := armor.Decode(bytes.NewReader(rest))
+		if err != nil {
+			return nil, fmt.Errorf("error reading armored signature: %w", err)
+		}
+		if block.Type != openpgp.SignatureType {
+			return nil, fmt.Errorf("armored block of type %q isn't a signature", block.Type)
+		}
+		b, err := io.ReadAll(block.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error reading armored signature: %w", err)
+		}
+		packets = append(packets, b...)
+
+		next := bytes.Index(rest[len(armoredSignatureHeader):], []byte(armoredSignatureHeader))
+		if next < 0 {
+			break
+		}
+		rest = rest[len(armoredSignatureHeader)+next:]
+	}
+	return packets, nil
+}
+
+// AddKey adds the key to the signing keys. A key with the same ID is replaced, for example to publish an extended expiry date.
+// It returns true if an existing key was replaced
+func (s *SigningKeys) AddKey(key GPGPublicKey) bool {
+	for i, k := range s.GPGPublicKeys {
+		if strings.EqualFold(k.KeyID, key.KeyID) {
+			s.GPGPublicKeys[i] = key
+			return true
+		}
+	}
+	s.GPGPublicKeys = append(s.GPGPublicKeys, key)
+	return false
+}
+
+// RemoveKey removes the key with the ID from the signing keys and returns false if no such key exists
+func (s *SigningKeys) RemoveKey(keyID string) bool {
+	for i, k := range s.GPGPublicKeys {
+		if strings.EqualFold(k.KeyID, keyID) {
+			s.GPGPublicKeys = append(s.GPGPublicKeys[:i], s.GPGPublicKeys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 type GPGPublicKey struct {
 	KeyID      string `json:"key_id,omitempty"`
 	ASCIIArmor string `json:"ascii_armor,omitempty"`
@@ -159,6 +247,23 @@ type GPGPublicKey struct {
 	SourceURL  string `json:"source_url,omitempty"`
 }
 
+// ParseGPGPublicKey returns the GPGPublicKey of an ASCII-armored public key.
+// The key ID is derived from the primary key, in the same format as the Terraform registry uses it
+func ParseGPGPublicKey(asciiArmor string) (GPGPublicKey, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(asciiArmor))
+	if err != nil {
+		return GPGPublicKey{}, fmt.Errorf("error reading signing key: %w", err)
+	}
+	if len(keyring) != 1 {
+		return GPGPublicKey{}, fmt.Errorf("expected exactly one public key, got %d", len(keyring))
+	}
+
+	return GPGPublicKey{
+		KeyID:      fmt.Sprintf("%016X", keyring[0].PrimaryKey.KeyId),
+		ASCIIArmor: asciiArmor,
+	}, nil
+}
+
 type ProviderVersions struct {
 	Versions []ProviderVersion `json:"versions,omitempty"`
 }
@@ -170,8 +275,15 @@ type ProviderVersion struct {
 	Version   string     `json:"version,omitempty"`
 	Protocols []string   `json:"protocols,omitempty"`
 	Platforms []Platform `json:"platforms,omitempty"`
+	// Source is only set if the versions of the network mirror are listed alongside the internal versions
+	Source string `json:"source,omitempty"`
 }
 
+const (
+	ProviderSourceInternal = "internal"
+	ProviderSourceMirror   = "mirror"
+)
+
 // Platform is a copy from provider.Platform
 type Platform struct {
 	OS   string `json:"os,omitempty"`
@@ -212,13 +324,30 @@ type Sha256Sums struct {
 
 // Name returns the name of the provider of the SHA256SUMS file
 func (s *Sha256Sums) Name() (string, error) {
+	matches, err := s.parseFilename()
+	if err != nil {
+		return "", err
+	}
+	return matches[1], nil
+}
+
+// Version returns the version of the provider of the SHA256SUMS file
+func (s *Sha256Sums) Version() (string, error) {
+	matches, err := s.parseFilename()
+	if err != nil {
+		return "", err
+	}
+	return matches[2], nil
+}
+
+func (s *Sha256Sums) parseFilename() ([]string, error) {
 	// RegEx could fail in rare cases as the first capture group doesn't try to match as much as possible
 	r := regexp.MustCompile("^terraform-provider-(?P<name>.+)_(?P<version>.+)_SHA256SUMS$")
 	matches := r.FindStringSubmatch(s.Filename)
 	if len(matches) != 3 {
-		return "", fmt.Errorf("regex for %s matched %d times instead of 3 times", s.Filename, len(matches))
+		return nil, fmt.Errorf("regex for %s matched %d times instead of 3 times", s.Filename, len(matches))
 	}
-	return matches[1], nil
+	return matches, nil
 }
 
 // Checksum returns the corresponding stringified checksum for the archive file name parameter
@@ -266,3 +395,43 @@ func Sha256Checksum(r io.Reader) ([]byte, error) {
 
 	return h.Sum(nil), nil
 }
+
+func (p Platform) String() string {
+	return p.OS + "_" + p.Arch
+}
+
+// ParsePlatform parses a platform in the format <os>_<arch>, e.g. linux_amd64
+func ParsePlatform(s string) (Platform, error) {
+	os, arch, ok := strings.Cut(s, "_")
+	if !ok || os == "" || arch == "" || strings.Contains(arch, "_") {
+		return Platform{}, fmt.Errorf("invalid platform %q, expected the format <os>_<arch>", s)
+	}
+	return Platform{OS: os, Arch: arch}, nil
+}
+
+// osAliases and archAliases map alternative names to the GOOS and GOARCH values of the archive names.
+// Only names that are unambiguous are listed, arm is for example never resolved to arm64 as these are different binaries.
+var (
+	osAliases = map[string]string{
+		"macos": "darwin",
+		"osx":   "darwin",
+	}
+	archAliases = map[string]string{
+		"i386":    "386",
+		"i686":    "386",
+		"x86_64":  "amd64",
+		"x64":     "amd64",
+		"aarch64": "arm64",
+	}
+)
+
+// ResolvePlatformAlias returns the canonical platform, unknown operating systems and architectures are returned unchanged
+func ResolvePlatformAlias(p Platform) Platform {
+	if os, ok := osAliases[p.OS]; ok {
+		p.OS = os
+	}
+	if arch, ok := archAliases[p.Arch]; ok {
+		p.Arch = arch
+	}
+	return p
+}
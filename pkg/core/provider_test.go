@@ -221,6 +221,11 @@ func TestNewProviderFromArchive(t *testing.T) {
 			name:        "invalid filename",
 			expectError: true,
 		},
+		{
+			name:        "h1 hash of an archive",
+			fileName:    "terraform-provider-random_2.0.0_linux_amd64.zip.h1",
+			expectError: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -269,6 +274,32 @@ func TestSigningKeys_IsValidSha256Sums(t *testing.T) {
 		panic(err)
 	}
 
+	// other is a second key that signs the same document, its public key isn't part of the SigningKeys
+	other, err := openpgp.NewEntity("boring-registry", "other", "other@example.com", c)
+	if err != nil {
+		panic(err)
+	}
+	otherSignature := new(bytes.Buffer)
+	if err := openpgp.DetachSign(otherSignature, other, bytes.NewReader(b), nil); err != nil {
+		panic(err)
+	}
+
+	armored := func(signatures ...*bytes.Buffer) []byte {
+		out := new(bytes.Buffer)
+		for _, sig := range signatures {
+			w, err := armor.Encode(out, openpgp.SignatureType, nil)
+			if err != nil {
+				panic(err)
+			}
+			if _, err := w.Write(sig.Bytes()); err != nil {
+				panic(err)
+			}
+			w.Close()
+			out.WriteString("\n")
+		}
+		return out.Bytes()
+	}
+
 	testCases := []struct {
 		name        string
 		signingKeys SigningKeys
@@ -384,6 +415,87 @@ Fyw/Va0=
 			sig:         signatureBuffer.Bytes(),
 			expectError: false,
 		},
+		{
+			name: "valid ASCII-armored signature",
+			signingKeys: SigningKeys{
+				GPGPublicKeys: []GPGPublicKey{
+					{
+						ASCIIArmor: buf.String(),
+					},
+				},
+			},
+			sums:        b,
+			sig:         armored(signatureBuffer),
+			expectError: false,
+		},
+		{
+			name: "signatures of several keys",
+			signingKeys: SigningKeys{
+				GPGPublicKeys: []GPGPublicKey{
+					{
+						ASCIIArmor: buf.String(),
+					},
+				},
+			},
+			sums:        b,
+			sig:         append(bytes.Clone(otherSignature.Bytes()), signatureBuffer.Bytes()...),
+			expectError: false,
+		},
+		{
+			name: "ASCII-armored signatures of several keys",
+			signingKeys: SigningKeys{
+				GPGPublicKeys: []GPGPublicKey{
+					{
+						ASCIIArmor: buf.String(),
+					},
+				},
+			},
+			sums:        b,
+			sig:         armored(otherSignature, signatureBuffer),
+			expectError: false,
+		},
+		{
+			name: "signature of another key only",
+			signingKeys: SigningKeys{
+				GPGPublicKeys: []GPGPublicKey{
+					{
+						ASCIIArmor: buf.String(),
+					},
+				},
+			},
+			sums:        b,
+			sig:         armored(otherSignature),
+			expectError: true,
+		},
+		{
+			name: "broken keyring before the matching key",
+			signingKeys: SigningKeys{
+				GPGPublicKeys: []GPGPublicKey{
+					{
+						ASCIIArmor: "--- test ---",
+					},
+					{
+						ASCIIArmor: buf.String(),
+					},
+				},
+			},
+			sums:        b,
+			sig:         signatureBuffer.Bytes(),
+			expectError: false,
+		},
+		{
+			name: "broken ASCII-armored signature",
+			signingKeys: SigningKeys{
+				GPGPublicKeys: []GPGPublicKey{
+					{
+						ASCIIArmor: buf.String(),
+					},
+				},
+			},
+			sums:        b,
+			sig:         []byte("-----BEGIN PGP SIGNATURE-----\n\nnot base64\n"),
+			expectError: true,
+		},
 	}
 
 	assert := assertion.New(t)
@@ -714,3 +826,100 @@ func TestSha256Checksum(t *testing.T) {
 		})
 	}
 }
+
+func armoredTestKey(t *testing.T, seed int64) (*openpgp.Entity, string) {
+	t.Helper()
+	c := &packet.Config{
+		Rand:    rand.New(rand.NewSource(seed)),
+		RSABits: 2048,
+	}
+	e, err := openpgp.NewEntity("boring-registry", "test", "boring-registry@example.com", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return e, buf.String()
+}
+
+func TestSigningKeys_rotation(t *testing.T) {
+	t.Parallel()
+	assert := assertion.New(t)
+
+	oldEntity, oldArmor := armoredTestKey(t, 1)
+	newEntity, newArmor := armoredTestKey(t, 2)
+
+	oldKey, err := ParseGPGPublicKey(oldArmor)
+	assert.NoError(err)
+	assert.Equal(fmt.Sprintf("%016X", oldEntity.PrimaryKey.KeyId), oldKey.KeyID)
+	newKey, err := ParseGPGPublicKey(newArmor)
+	assert.NoError(err)
+
+	sums := []byte("{\"boring\":\"registry\"}")
+	sign := func(e *openpgp.Entity) []byte {
+		sig := new(bytes.Buffer)
+		if err := openpgp.DetachSign(sig, e, bytes.NewReader(sums), nil); err != nil {
+			t.Fatal(err)
+		}
+		return sig.Bytes()
+	}
+	oldSig, newSig := sign(oldEntity), sign(newEntity)
+
+	keys := &SigningKeys{}
+	assert.False(keys.AddKey(oldKey))
+	assert.False(keys.AddKey(newKey))
+	// Adding a key again replaces it instead of duplicating it
+	assert.True(keys.AddKey(GPGPublicKey{KeyID: strings.ToLower(newKey.KeyID), ASCIIArmor: newArmor, Source: "ACME"}))
+	assert.Len(keys.GPGPublicKeys, 2)
+	assert.Equal("ACME", keys.GPGPublicKeys[1].Source)
+
+	// During the rotation, releases signed with either key are accepted
+	assert.NoError(keys.IsValidSha256Sums(sums, oldSig))
+	assert.NoError(keys.IsValidSha256Sums(sums, newSig))
+
+	assert.True(keys.RemoveKey(oldKey.KeyID))
+	assert.False(keys.RemoveKey(oldKey.KeyID))
+	assert.Error(keys.IsValidSha256Sums(sums, oldSig))
+	assert.NoError(keys.IsValidSha256Sums(sums, newSig))
+}
+
+func TestParseGPGPublicKey_invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParseGPGPublicKey("not a key")
+	assertion.Error(t, err)
+}
+
+func TestResolvePlatformAlias(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		platform Platform
+		want     Platform
+	}{
+		{platform: Platform{OS: "linux", Arch: "i386"}, want: Platform{OS: "linux", Arch: "386"}},
+		{platform: Platform{OS: "linux", Arch: "i686"}, want: Platform{OS: "linux", Arch: "386"}},
+		{platform: Platform{OS: "linux", Arch: "x86_64"}, want: Platform{OS: "linux", Arch: "amd64"}},
+		{platform: Platform{OS: "windows", Arch: "x64"}, want: Platform{OS: "windows", Arch: "amd64"}},
+		{platform: Platform{OS: "linux", Arch: "aarch64"}, want: Platform{OS: "linux", Arch: "arm64"}},
+		{platform: Platform{OS: "macos", Arch: "aarch64"}, want: Platform{OS: "darwin", Arch: "arm64"}},
+		{platform: Platform{OS: "osx", Arch: "amd64"}, want: Platform{OS: "darwin", Arch: "amd64"}},
+		// arm and arm64 are different architectures and must not be resolved to each other
+		{platform: Platform{OS: "linux", Arch: "arm"}, want: Platform{OS: "linux", Arch: "arm"}},
+		{platform: Platform{OS: "linux", Arch: "arm64"}, want: Platform{OS: "linux", Arch: "arm64"}},
+		{platform: Platform{OS: "plan9", Arch: "mips"}, want: Platform{OS: "plan9", Arch: "mips"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.platform.String(), func(t *testing.T) {
+			assertion.Equal(t, tc.want, ResolvePlatformAlias(tc.platform))
+		})
+	}
+}
@@ -3,13 +3,72 @@ package core
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
 )
 
+// proxyChecksumPrefix marks the path segment of a proxy URL that carries the SHA256 checksum of the proxied file
+const proxyChecksumPrefix = "sha256:"
+
+var proxyChecksumRegexp = regexp.MustCompile(`^` + proxyChecksumPrefix + `([0-9a-f]{64})/`)
+
+const (
+	// DownloadModeDirect requests the download URL of the storage backend instead of the proxy URL
+	DownloadModeDirect = "direct"
+	// DownloadModeHeader selects the download mode of a single request
+	DownloadModeHeader = "X-BR-Download-Mode"
+	// DownloadModeQueryParam selects the download mode of a single request, it takes precedence over the header
+	DownloadModeQueryParam = "download"
+)
+
+type downloadModeContextKey struct{}
+
+// DownloadModeToContext moves the download mode of the request into the context.
+// It's meant to be used as a ServerBefore function of the go-kit HTTP transport.
+func DownloadModeToContext(ctx context.Context, r *http.Request) context.Context {
+	mode := r.URL.Query().Get(DownloadModeQueryParam)
+	if mode == "" {
+		mode = r.Header.Get(DownloadModeHeader)
+	}
+	if strings.EqualFold(mode, DownloadModeDirect) {
+		return ContextWithDirectDownload(ctx)
+	}
+	return ctx
+}
+
+// ContextWithDirectDownload returns a copy of ctx for which the proxy is skipped
+func ContextWithDirectDownload(ctx context.Context) context.Context {
+	return context.WithValue(ctx, downloadModeContextKey{}, DownloadModeDirect)
+}
+
+func isDirectDownload(ctx context.Context) bool {
+	mode, _ := ctx.Value(downloadModeContextKey{}).(string)
+	return mode == DownloadModeDirect
+}
+
+type proxiedDownloadContextKey struct{}
+
+// ContextWithProxiedDownload returns a copy of ctx for generating download URLs that are fetched by the proxy.
+// The proxy fetches them later than clients that are redirected to the storage backend.
+func ContextWithProxiedDownload(ctx context.Context) context.Context {
+	return context.WithValue(ctx, proxiedDownloadContextKey{}, true)
+}
+
+// IsProxiedDownload reports whether the download URLs generated with ctx are fetched by the proxy
+func IsProxiedDownload(ctx context.Context) bool {
+	proxied, _ := ctx.Value(proxiedDownloadContextKey{}).(bool)
+	return proxied
+}
+
 // ProxyUrlService represents Boring tool to manage proxyfied downloads.
 type ProxyUrlService interface {
 	IsProxyEnabled(ctx context.Context) bool
 	GetProxyUrl(ctx context.Context, downloadUrl string) (string, error)
+	// GetChecksumProxyUrl returns a proxy URL that carries the SHA256 checksum of the file,
+	// which allows the proxy to serve conditional requests without contacting the storage backend.
+	GetChecksumProxyUrl(ctx context.Context, downloadUrl, sha256 string) (string, error)
 }
 
 type proxyUrlService struct {
@@ -25,8 +84,9 @@ func NewProxyUrlService(isEnabled bool, proxyPath string) ProxyUrlService {
 	}
 }
 
+// IsProxyEnabled reports whether downloads are proxied, unless the request opted out with DownloadModeDirect
 func (p *proxyUrlService) IsProxyEnabled(ctx context.Context) bool {
-	return p.IsEnabled
+	return p.IsEnabled && !isDirectDownload(ctx)
 }
 
 func (p *proxyUrlService) GetProxyUrl(ctx context.Context, downloadUrl string) (string, error) {
@@ -41,3 +101,28 @@ func (p *proxyUrlService) GetProxyUrl(ctx context.Context, downloadUrl string) (
 
 	return finalUrl, nil
 }
+
+func (p *proxyUrlService) GetChecksumProxyUrl(ctx context.Context, downloadUrl, sha256 string) (string, error) {
+	proxyUrl, err := p.GetProxyUrl(ctx, downloadUrl)
+	if err != nil {
+		return "", err
+	}
+
+	// The checksum is omitted if it couldn't be recognized by the proxy
+	checksumSegment := proxyChecksumPrefix + strings.ToLower(sha256) + "/"
+	if !proxyChecksumRegexp.MatchString(checksumSegment) {
+		return proxyUrl, nil
+	}
+
+	return fmt.Sprintf("%s/%s%s", p.ProxyPath, checksumSegment, proxyUrl[len(p.ProxyPath)+1:]), nil
+}
+
+// SplitProxyChecksum separates the checksum embedded by GetChecksumProxyUrl from the path of a proxied file.
+// The checksum is empty if the path doesn't carry one.
+func SplitProxyChecksum(path string) (checksum string, rest string) {
+	m := proxyChecksumRegexp.FindStringSubmatch(path)
+	if m == nil {
+		return "", path
+	}
+	return m[1], path[len(m[0]):]
+}
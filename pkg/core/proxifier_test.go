@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	assertion "github.com/stretchr/testify/assert"
@@ -65,6 +66,7 @@ func TestProxifier_IsEnabled(t *testing.T) {
 	testCases := []struct {
 		name    string
 		service ProxyUrlService
+		direct  bool
 		expect  bool
 	}{
 		{
@@ -77,14 +79,73 @@ func TestProxifier_IsEnabled(t *testing.T) {
 			service: NewProxyUrlService(false, prefixProxy),
 			expect:  false,
 		},
+		{
+			name:    "proxy is skipped for direct downloads",
+			service: NewProxyUrlService(true, prefixProxy),
+			direct:  true,
+			expect:  false,
+		},
 	}
 
 	for _, tc := range testCases {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
 			ctx := context.Background()
+			if tc.direct {
+				ctx = ContextWithDirectDownload(ctx)
+			}
 			isEnabled := tc.service.IsProxyEnabled(ctx)
 			assert.Equal(tc.expect, isEnabled)
 		})
 	}
 }
+
+func TestProxifier_GetChecksumProxyUrl(t *testing.T) {
+	t.Parallel()
+	assert := assertion.New(t)
+
+	checksum := "5f9c7aa76b7c34d722fc9123208e26b22d60440cb47150dd04733b9b94f4541a"
+	testCases := []struct {
+		name        string
+		sha256      string
+		expectedUrl string
+	}{
+		{
+			name:        "checksum is embedded",
+			sha256:      checksum,
+			expectedUrl: prefixProxy + "/sha256:" + checksum + "/" + downloadUrlPath,
+		},
+		{
+			name:        "uppercase checksum is normalized",
+			sha256:      strings.ToUpper(checksum),
+			expectedUrl: prefixProxy + "/sha256:" + checksum + "/" + downloadUrlPath,
+		},
+		{
+			name:        "missing checksum",
+			sha256:      "",
+			expectedUrl: prefixProxy + "/" + downloadUrlPath,
+		},
+		{
+			name:        "invalid checksum",
+			sha256:      "not-a-checksum",
+			expectedUrl: prefixProxy + "/" + downloadUrlPath,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			url, err := NewProxyUrlService(true, prefixProxy).GetChecksumProxyUrl(context.Background(), downloadUrl, tc.sha256)
+			assert.NoError(err)
+			assert.Equal(tc.expectedUrl, url)
+
+			checksum, rest := SplitProxyChecksum(strings.TrimPrefix(url, prefixProxy+"/"))
+			if tc.expectedUrl != prefixProxy+"/"+downloadUrlPath {
+				assert.Equal(strings.ToLower(tc.sha256), checksum)
+			} else {
+				assert.Empty(checksum)
+			}
+			assert.Equal(downloadUrlPath, rest)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/boring-registry/boring-registry/version"
+)
+
+// DefaultUserAgent returns the User-Agent of outbound requests, e.g. boring-registry/v0.16.0
+func DefaultUserAgent() string {
+	return "boring-registry/" + version.Version
+}
+
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request
+	clone := req.Clone(req.Context())
+	clone.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(clone)
+}
+
+// NewUserAgentTransport returns a RoundTripper that sets the User-Agent header of requests without one.
+// The next RoundTripper is returned unchanged if the User-Agent is empty, so that Go's default applies.
+func NewUserAgentTransport(next http.RoundTripper, userAgent string) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if userAgent == "" {
+		return next
+	}
+	return &userAgentTransport{next: next, userAgent: userAgent}
+}
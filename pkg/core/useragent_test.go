@@ -0,0 +1,58 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUserAgentTransport(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		userAgent string
+		header    string
+		want      string
+	}{
+		{
+			name:      "sets the user agent",
+			userAgent: "boring-registry/v1.0.0",
+			want:      "boring-registry/v1.0.0",
+		},
+		{
+			name:      "keeps the user agent of the request",
+			userAgent: "boring-registry/v1.0.0",
+			header:    "terraform/1.9.0",
+			want:      "terraform/1.9.0",
+		},
+		{
+			name: "empty user agent keeps the default",
+			want: "Go-http-client/1.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			require.NoError(t, err)
+			if tt.header != "" {
+				req.Header.Set("User-Agent", tt.header)
+			}
+
+			client := &http.Client{Transport: NewUserAgentTransport(nil, tt.userAgent)}
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.header, req.Header.Get("User-Agent"))
+		})
+	}
+}
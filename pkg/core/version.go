@@ -0,0 +1,29 @@
+package core
+
+import (
+	"github.com/hashicorp/go-version"
+)
+
+// LatestVersion returns the highest of the semantic versions, ordered according to the semver precedence rules.
+// Pre-releases are only considered if includePrerelease is set, and versions that can't be parsed are ignored.
+// It returns false if none of the versions is eligible.
+func LatestVersion(versions []string, includePrerelease bool) (string, bool) {
+	var latest *version.Version
+	for _, raw := range versions {
+		v, err := version.NewVersion(raw)
+		if err != nil {
+			continue
+		}
+		if v.Prerelease() != "" && !includePrerelease {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+		}
+	}
+
+	if latest == nil {
+		return "", false
+	}
+	return latest.Original(), true
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatestVersion(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name              string
+		versions          []string
+		includePrerelease bool
+		expected          string
+		expectedOk        bool
+	}{
+		{
+			name:       "numeric ordering",
+			versions:   []string{"1.9.0", "1.10.0", "1.2.0"},
+			expected:   "1.10.0",
+			expectedOk: true,
+		},
+		{
+			name:       "pre-releases are excluded",
+			versions:   []string{"1.9.0", "2.0.0-rc1", "1.10.0-beta"},
+			expected:   "1.9.0",
+			expectedOk: true,
+		},
+		{
+			name:              "pre-releases are included",
+			versions:          []string{"1.9.0", "2.0.0-rc1", "2.0.0-beta"},
+			includePrerelease: true,
+			expected:          "2.0.0-rc1",
+			expectedOk:        true,
+		},
+		{
+			name:              "release precedes its pre-release",
+			versions:          []string{"2.0.0-rc1", "2.0.0"},
+			includePrerelease: true,
+			expected:          "2.0.0",
+			expectedOk:        true,
+		},
+		{
+			name:       "original format is preserved",
+			versions:   []string{"v1.0", "0.9.0"},
+			expected:   "v1.0",
+			expectedOk: true,
+		},
+		{
+			name:       "invalid versions are ignored",
+			versions:   []string{"latest", "0.1.0"},
+			expected:   "0.1.0",
+			expectedOk: true,
+		},
+		{
+			name:     "only pre-releases",
+			versions: []string{"1.0.0-alpha"},
+		},
+		{
+			name: "no versions",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			latest, ok := LatestVersion(tc.versions, tc.includePrerelease)
+			assert.Equal(t, tc.expectedOk, ok)
+			assert.Equal(t, tc.expected, latest)
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package debug
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type listStorageKeysRequest struct {
+	prefix string
+	limit  int
+}
+
+func listStorageKeysEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listStorageKeysRequest)
+		return svc.ListStorageKeys(ctx, req.prefix, req.limit)
+	}
+}
@@ -0,0 +1,8 @@
+package debug
+
+import "errors"
+
+var (
+	// Debug errors
+	ErrInvalidLimit = errors.New("invalid limit")
+)
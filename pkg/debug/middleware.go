@@ -0,0 +1,32 @@
+package debug
+
+import (
+	"context"
+
+	"github.com/boring-registry/boring-registry/pkg/auth"
+)
+
+// Middleware is a Service middleware.
+type Middleware func(Service) Service
+
+type aclMiddleware struct {
+	next Service
+	acl  auth.ACL
+}
+
+// ACLMiddleware is a Service middleware that denies listing the keys of namespaces, which the user isn't allowed to read
+func ACLMiddleware(acl auth.ACL) Middleware {
+	return func(next Service) Service {
+		return &aclMiddleware{
+			next: next,
+			acl:  acl,
+		}
+	}
+}
+
+func (mw aclMiddleware) ListStorageKeys(ctx context.Context, prefix string, limit int) (*Listing, error) {
+	if err := mw.acl.AuthorizePrefix(ctx, prefix, auth.PermissionRead); err != nil {
+		return nil, err
+	}
+	return mw.next.ListStorageKeys(ctx, prefix, limit)
+}
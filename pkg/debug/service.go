@@ -0,0 +1,59 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Listing is the result of listing the storage keys under a prefix
+type Listing struct {
+	Prefix string   `json:"prefix"`
+	Keys   []string `json:"keys"`
+	// Truncated is set if more keys than the limit exist under the prefix
+	Truncated bool `json:"truncated"`
+}
+
+// Service helps diagnosing the contents of the storage backend.
+// Only keys are returned, never any object contents or download URLs.
+type Service interface {
+	// ListStorageKeys returns up to limit keys under the prefix
+	ListStorageKeys(ctx context.Context, prefix string, limit int) (*Listing, error)
+}
+
+type service struct {
+	storage Storage
+}
+
+func (s *service) ListStorageKeys(ctx context.Context, prefix string, limit int) (*Listing, error) {
+	if limit <= 0 || limit > MaxLimit {
+		return nil, fmt.Errorf("%w: has to be between 1 and %d", ErrInvalidLimit, MaxLimit)
+	}
+
+	// One more key than requested tells whether the listing is truncated
+	keys, err := s.storage.ListKeys(ctx, prefix, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+
+	l := &Listing{Prefix: prefix, Keys: keys}
+	if len(keys) > limit {
+		l.Keys = keys[:limit]
+		l.Truncated = true
+	}
+	if l.Keys == nil {
+		l.Keys = []string{}
+	}
+	return l, nil
+}
+
+// NewService returns a debug Service for the storage
+func NewService(storage Storage) Service {
+	return &service{
+		storage: storage,
+	}
+}
@@ -0,0 +1,61 @@
+package debug
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockedStorage struct {
+	keys []string
+	err  error
+}
+
+func (m *mockedStorage) ListKeys(_ context.Context, prefix string, limit int) ([]string, error) {
+	var keys []string
+	for _, k := range m.keys {
+		if strings.HasPrefix(k, prefix) && len(keys) < limit {
+			keys = append(keys, k)
+		}
+	}
+	return keys, m.err
+}
+
+func TestService_ListStorageKeys(t *testing.T) {
+	svc := NewService(&mockedStorage{
+		keys: []string{
+			"modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz",
+			"providers/acme/dummy/terraform-provider-dummy_1.0.0_SHA256SUMS",
+			"providers/acme/dummy/terraform-provider-dummy_1.0.0_linux_amd64.zip",
+			"providers/acme/dummy/terraform-provider-dummy_1.0.0_darwin_arm64.zip",
+		},
+	})
+
+	l, err := svc.ListStorageKeys(context.Background(), "providers/acme/", 10)
+	require.NoError(t, err)
+	assert.Len(t, l.Keys, 3)
+	assert.False(t, l.Truncated)
+
+	l, err = svc.ListStorageKeys(context.Background(), "providers/acme/", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"providers/acme/dummy/terraform-provider-dummy_1.0.0_SHA256SUMS",
+		"providers/acme/dummy/terraform-provider-dummy_1.0.0_linux_amd64.zip",
+	}, l.Keys)
+	assert.True(t, l.Truncated)
+
+	l, err = svc.ListStorageKeys(context.Background(), "mirror/", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, l.Keys)
+
+	_, err = svc.ListStorageKeys(context.Background(), "", MaxLimit+1)
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+
+	errList := errors.New("access denied")
+	_, err = NewService(&mockedStorage{err: errList}).ListStorageKeys(context.Background(), "", 10)
+	assert.ErrorIs(t, err, errList)
+}
@@ -0,0 +1,12 @@
+package debug
+
+import (
+	"context"
+)
+
+// Storage lists the raw keys of the storage backend
+type Storage interface {
+	// ListKeys returns up to limit keys starting with the prefix, relative to the configured bucket prefix.
+	// The keys are returned as they're stored, including the bucket prefix.
+	ListKeys(ctx context.Context, prefix string, limit int) ([]string, error)
+}
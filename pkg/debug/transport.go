@@ -0,0 +1,81 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+	"github.com/boring-registry/boring-registry/pkg/openapi"
+
+	"github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+// Routes describes the endpoints of MakeHandler for the OpenAPI document
+var Routes = []openapi.Route{
+	{
+		Method:  http.MethodGet,
+		Path:    "/storage",
+		Summary: "List the keys of the storage backend",
+		Parameters: []openapi.Parameter{
+			openapi.QueryParameter("prefix", "string", "Only list the keys under the prefix"),
+			openapi.QueryParameter("limit", "integer", "The maximum number of keys"),
+		},
+		Responses: map[int]string{
+			http.StatusOK:         "The keys of the storage backend",
+			http.StatusBadRequest: "The limit is invalid",
+		},
+		Authenticated: true,
+	},
+}
+
+// MakeHandler returns a fully initialized http.Handler.
+func MakeHandler(svc Service, authMiddleware endpoint.Middleware, instrumentation o11y.Middleware, options ...httptransport.ServerOption) http.Handler {
+	r := mux.NewRouter().StrictSlash(true)
+
+	r.Methods("GET").Path(`/storage`).Handler(
+		instrumentation.WrapHandler(
+			httptransport.NewServer(
+				authMiddleware(listStorageKeysEndpoint(svc)),
+				decodeListStorageKeysRequest,
+				httptransport.EncodeJSONResponse,
+				append(
+					options,
+					httptransport.ServerBefore(jwt.HTTPToContext()),
+				)...,
+			),
+		),
+	)
+
+	return r
+}
+
+func decodeListStorageKeysRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+
+	limit := DefaultLimit
+	if l := query.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidLimit, l)
+		}
+	}
+
+	return listStorageKeysRequest{
+		prefix: query.Get("prefix"),
+		limit:  limit,
+	}, nil
+}
+
+// ErrorEncoder translates domain specific errors to HTTP status codes
+func ErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
+	core.EncodeError(err, w,
+		core.ErrorStatus{Err: ErrInvalidLimit, StatusCode: http.StatusBadRequest},
+	)
+}
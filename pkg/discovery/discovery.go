@@ -3,6 +3,7 @@ package discovery
 import (
 	"errors"
 	"fmt"
+	"slices"
 )
 
 // See:
@@ -14,6 +15,9 @@ type Discovery struct {
 	ProvidersV1 string   `json:"providers.v1,omitempty"`
 }
 
+// GrantTypeDeviceCode is the grant type of the OAuth 2.0 device authorization grant, see RFC 8628
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
 // See: https://opentofu.org/docs/internals/login-protocol/
 type LoginV1 struct {
 	Client     string   `json:"client,omitempty"`
@@ -22,6 +26,10 @@ type LoginV1 struct {
 	Token      string   `json:"token,omitempty"`
 	Ports      []int    `json:"ports,omitempty"`
 	Scopes     []string `json:"scopes,omitempty"`
+	// Device is the device authorization endpoint, which is required for the GrantTypeDeviceCode grant type.
+	// It's an extension of the login protocol for custom clients that can't open a browser,
+	// the Terraform and OpenTofu CLIs don't implement the device authorization grant and ignore it.
+	Device string `json:"device,omitempty"`
 }
 
 func (l *LoginV1) Validate() error {
@@ -51,6 +59,10 @@ func (l *LoginV1) Validate() error {
 		}
 	}
 
+	if slices.Contains(l.GrantTypes, GrantTypeDeviceCode) && l.Device == "" {
+		err = errors.Join(err, fmt.Errorf("device: is required for the %s grant type but not configured", GrantTypeDeviceCode))
+	}
+
 	for _, scope := range l.Scopes {
 		if scope == "" {
 			err = errors.Join(err, fmt.Errorf("scopes: an array element is empty"))
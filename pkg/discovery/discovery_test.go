@@ -98,6 +98,28 @@ func TestLoginV1Validate(t *testing.T) {
 			wantErr:     true,
 			errContains: "scopes: an array element is empty",
 		},
+		{
+			name: "device code grant without device endpoint",
+			login: LoginV1{
+				Client:     "boring-registry",
+				GrantTypes: []string{"authz_code", GrantTypeDeviceCode},
+				Authz:      "/oauth2/authorization",
+				Token:      "/oauth2/token",
+			},
+			wantErr:     true,
+			errContains: "device: is required for the urn:ietf:params:oauth:grant-type:device_code grant type",
+		},
+		{
+			name: "valid device code grant",
+			login: LoginV1{
+				Client:     "boring-registry",
+				GrantTypes: []string{"authz_code", GrantTypeDeviceCode},
+				Authz:      "/oauth2/authorization",
+				Token:      "/oauth2/token",
+				Device:     "/oauth2/device",
+			},
+			wantErr: false,
+		},
 		{
 			name: "valid",
 			login: LoginV1{
@@ -0,0 +1,31 @@
+package discovery
+
+// Info describes the build and the configuration of the boring-registry for tooling and support diagnostics.
+// It must never contain secrets, as it's served without authentication.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	// Storage is the type of the storage backend, e.g. s3, gcs or azure
+	Storage        string         `json:"storage"`
+	ArchiveFormats ArchiveFormats `json:"archive_formats"`
+	Features       Features       `json:"features"`
+}
+
+// ArchiveFormats are the file extensions of the archives in the storage backend
+type ArchiveFormats struct {
+	Modules   string `json:"modules"`
+	Providers string `json:"providers"`
+}
+
+// Features lists which optional features are enabled on the server
+type Features struct {
+	// Auth is the list of auth providers that are configured, e.g. static and oidc.
+	// Authentication is disabled if it's empty
+	Auth              []string `json:"auth"`
+	DownloadProxy     bool     `json:"download_proxy"`
+	NetworkMirror     bool     `json:"network_mirror"`
+	PullThroughMirror bool     `json:"pull_through_mirror"`
+	RateLimit         bool     `json:"rate_limit"`
+	AuditLog          bool     `json:"audit_log"`
+}
@@ -0,0 +1,172 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/openapi"
+)
+
+type Status string
+
+const (
+	StatusHealthy   Status = "healthy"
+	StatusDegraded  Status = "degraded"
+	StatusUnhealthy Status = "unhealthy"
+)
+
+const defaultTimeout = 5 * time.Second
+
+// Checker is implemented by components whose health can be probed, like the storage backends
+type Checker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+type backend struct {
+	name    string
+	primary bool
+	checker Checker
+}
+
+// BackendReport is the result of the health check of a single backend
+type BackendReport struct {
+	Name     string `json:"name"`
+	Primary  bool   `json:"primary"`
+	Status   Status `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the aggregated health of all backends
+type Report struct {
+	Status   Status          `json:"status"`
+	Backends []BackendReport `json:"backends"`
+}
+
+// Aggregator probes all backends concurrently and aggregates the results into a Report.
+// The overall status is unhealthy if a primary backend is down, and degraded if only replicas are down.
+type Aggregator struct {
+	backends []backend
+	timeout  time.Duration
+}
+
+func (a *Aggregator) Check(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	reports := make([]BackendReport, len(a.backends))
+	var wg sync.WaitGroup
+	for i, b := range a.backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reports[i] = check(ctx, b)
+		}()
+	}
+	wg.Wait()
+
+	report := &Report{
+		Status:   StatusHealthy,
+		Backends: reports,
+	}
+	for _, r := range reports {
+		if r.Status == StatusHealthy {
+			continue
+		}
+		if r.Primary {
+			report.Status = StatusUnhealthy
+			break
+		}
+		report.Status = StatusDegraded
+	}
+	return report
+}
+
+func check(ctx context.Context, b backend) BackendReport {
+	begin := time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- b.checker.HealthCheck(ctx)
+	}()
+
+	// Checkers that don't respect the context are abandoned once the timeout is reached
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	r := BackendReport{
+		Name:     b.name,
+		Primary:  b.primary,
+		Status:   StatusHealthy,
+		Duration: time.Since(begin).String(),
+	}
+	if err != nil {
+		r.Status = StatusUnhealthy
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// Routes describes the endpoint of the Aggregator for the OpenAPI document
+var Routes = []openapi.Route{
+	{
+		Method:  http.MethodGet,
+		Summary: "Report the health of the storage backends",
+		Responses: map[int]string{
+			http.StatusOK:                 "The registry is healthy or degraded",
+			http.StatusServiceUnavailable: "A primary storage backend is unhealthy",
+		},
+	},
+}
+
+// ServeHTTP responds with the JSON encoded Report.
+// The status code is 503 Service Unavailable if the overall status is unhealthy.
+func (a *Aggregator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := a.Check(r.Context())
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if report.Status == StatusUnhealthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// Option provides additional options for the Aggregator
+type Option func(*Aggregator)
+
+// WithTimeout configures the timeout for probing all backends
+func WithTimeout(timeout time.Duration) Option {
+	return func(a *Aggregator) {
+		a.timeout = timeout
+	}
+}
+
+// WithPrimary adds a backend that has to be healthy for the registry to be healthy
+func WithPrimary(name string, c Checker) Option {
+	return func(a *Aggregator) {
+		a.backends = append(a.backends, backend{name: name, primary: true, checker: c})
+	}
+}
+
+// WithReplica adds a backend that only degrades the overall health when it's down
+func WithReplica(name string, c Checker) Option {
+	return func(a *Aggregator) {
+		a.backends = append(a.backends, backend{name: name, checker: c})
+	}
+}
+
+func NewAggregator(opts ...Option) *Aggregator {
+	a := &Aggregator{
+		timeout: defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockedChecker struct {
+	err   error
+	delay time.Duration
+}
+
+func (m *mockedChecker) HealthCheck(ctx context.Context) error {
+	select {
+	case <-time.After(m.delay):
+		return m.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestAggregator_Check(t *testing.T) {
+	healthy := &mockedChecker{}
+	failing := &mockedChecker{err: errors.New("connection refused")}
+	slow := &mockedChecker{delay: time.Minute}
+
+	tests := []struct {
+		name           string
+		opts           []Option
+		wantStatus     Status
+		wantStatusCode int
+		wantBackends   map[string]Status
+	}{
+		{
+			name:           "all backends healthy",
+			opts:           []Option{WithPrimary("s3", healthy), WithReplica("gcs", healthy)},
+			wantStatus:     StatusHealthy,
+			wantStatusCode: http.StatusOK,
+			wantBackends:   map[string]Status{"s3": StatusHealthy, "gcs": StatusHealthy},
+		},
+		{
+			name:           "replica down",
+			opts:           []Option{WithPrimary("s3", healthy), WithReplica("gcs", failing), WithReplica("azure", healthy)},
+			wantStatus:     StatusDegraded,
+			wantStatusCode: http.StatusOK,
+			wantBackends:   map[string]Status{"s3": StatusHealthy, "gcs": StatusUnhealthy, "azure": StatusHealthy},
+		},
+		{
+			name:           "primary down",
+			opts:           []Option{WithPrimary("s3", failing), WithReplica("gcs", healthy)},
+			wantStatus:     StatusUnhealthy,
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantBackends:   map[string]Status{"s3": StatusUnhealthy, "gcs": StatusHealthy},
+		},
+		{
+			name:           "replica times out",
+			opts:           []Option{WithTimeout(50 * time.Millisecond), WithPrimary("s3", healthy), WithReplica("gcs", slow)},
+			wantStatus:     StatusDegraded,
+			wantStatusCode: http.StatusOK,
+			wantBackends:   map[string]Status{"s3": StatusHealthy, "gcs": StatusUnhealthy},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewAggregator(tc.opts...)
+
+			rec := httptest.NewRecorder()
+			a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			assert.Equal(t, tc.wantStatusCode, rec.Code)
+
+			var report Report
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+			assert.Equal(t, tc.wantStatus, report.Status)
+
+			got := make(map[string]Status)
+			for _, b := range report.Backends {
+				got[b.Name] = b.Status
+				if b.Status == StatusUnhealthy {
+					assert.NotEmpty(t, b.Error)
+				}
+			}
+			assert.Equal(t, tc.wantBackends, got)
+		})
+	}
+}
+
+func TestAggregator_ChecksConcurrently(t *testing.T) {
+	delayed := &mockedChecker{delay: 200 * time.Millisecond}
+	a := NewAggregator(WithPrimary("first", delayed), WithReplica("second", delayed), WithReplica("third", delayed))
+
+	begin := time.Now()
+	report := a.Check(context.Background())
+	assert.Equal(t, StatusHealthy, report.Status)
+	assert.Less(t, time.Since(begin), 500*time.Millisecond)
+}
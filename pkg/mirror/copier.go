@@ -1,19 +1,33 @@
 package mirror
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
 )
 
 type Copier interface {
-	// copy copies the artifacts of a provider to the pull-through cache/mirror
-	copy(provider *core.Provider)
+	// copy copies the artifacts of a provider to the pull-through cache/mirror.
+	// Only the values of the context are used, the copy outlives the request that started it
+	copy(ctx context.Context, provider *core.Provider)
+	// copyVerified copies the artifacts of a provider synchronously,
+	// but only if the archive matches one of the zh: or h1: hashes
+	copyVerified(ctx context.Context, provider *core.Provider, hashes []string) error
+	// backfillH1 stores the h1: hash of an archive that was mirrored before the h1: hashes were stored.
+	// Like copy, it outlives the request that started it
+	backfillH1(ctx context.Context, provider *core.Provider)
 }
 
 // copier implements Copier and ensures that requested providers are replicated to the internal storage asynchronously
@@ -24,13 +38,15 @@ type copier struct {
 	storage Storage
 	client  *http.Client
 	logger  *slog.Logger
+
+	mu sync.Mutex
+	// backfilling holds the archives whose h1: hash is being computed, so that concurrent requests don't hash them again
+	backfilling map[string]struct{}
 }
 
-// copy should be started in a separate goroutine
-func (c *copier) copy(provider *core.Provider) {
-	begin := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
-	defer cancel()
+// detach returns a context with the values of ctx, which is canceled after the timeout or when the application is shutting down
+func (c *copier) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Minute)
 
 	// A goroutine that terminates all pending downloads in case the application is shutting down
 	go func() {
@@ -42,41 +58,175 @@ func (c *copier) copy(provider *core.Provider) {
 			// or the operation timed out. In both cases, we just want to terminate the goroutine
 		}
 	}()
+	return ctx, cancel
+}
+
+// copy should be started in a separate goroutine
+func (c *copier) copy(ctx context.Context, provider *core.Provider) {
+	begin := time.Now()
+	ctx, cancel := c.detach(ctx)
+	defer cancel()
 
 	// We download the files from upstream and mirror them to our storage
-	if err := c.signingKeys(ctx, provider); err != nil {
-		c.logger.Error("failed to copy signing keys", logKeyValues(provider), slog.String("err", err.Error()))
+	if err := c.metadata(ctx, provider); err != nil {
+		c.logger.Error("failed to copy provider metadata", logKeyValues(provider), slog.String("err", err.Error()))
 		return
 	}
 
-	if err := c.sha256Sums(ctx, provider); err != nil {
-		c.logger.Error("failed to copy SHA256SUMS", logKeyValues(provider), slog.String("err", err.Error()))
+	f, size, err := c.downloadArchive(ctx, provider)
+	if err != nil {
+		c.logger.Error("failed to download provider", logKeyValues(provider), slog.String("err", err.Error()))
 		return
 	}
+	defer os.Remove(f.Name())
+	defer f.Close()
 
-	if err := c.sha256SumsSignature(ctx, provider); err != nil {
-		c.logger.Error("failed to copy SHA256SUMS.sig", logKeyValues(provider), slog.String("err", err.Error()))
+	if err := c.uploadArchive(ctx, provider, f, size); err != nil {
+		c.logger.Error("failed to upload provider to mirror", logKeyValues(provider), slog.String("err", err.Error()))
 		return
 	}
+	c.logger.Info("successfully copied provider", logKeyValues(provider), slog.String("took", time.Since(begin).String()))
+}
 
-	// Request the provider archive
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.DownloadURL, nil)
+func (c *copier) copyVerified(ctx context.Context, provider *core.Provider, hashes []string) error {
+	// The archive is only stored after its hash has been verified
+	f, size, err := c.downloadArchive(ctx, provider)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := verifyArchiveHashes(f, size, hashes); err != nil {
+		return fmt.Errorf("failed to verify %s: %w", provider.ArchiveFileName(), err)
+	}
+
+	if err := c.metadata(ctx, provider); err != nil {
+		return err
+	}
+	return c.uploadArchive(ctx, provider, f, size)
+}
+
+// backfillH1 should be started in a separate goroutine
+func (c *copier) backfillH1(ctx context.Context, provider *core.Provider) {
+	key := path.Join(provider.Hostname, provider.Namespace, provider.Name, provider.ArchiveFileName())
+	c.mu.Lock()
+	if _, ok := c.backfilling[key]; ok {
+		c.mu.Unlock()
+		return
+	}
+	c.backfilling[key] = struct{}{}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.backfilling, key)
+		c.mu.Unlock()
+	}()
+
+	ctx, cancel := c.detach(ctx)
+	defer cancel()
+
+	archive, err := c.storage.DownloadMirroredFile(ctx, provider, provider.ArchiveFileName())
 	if err != nil {
-		c.logger.Error("failed to create provider download request", logKeyValues(provider), slog.String("err", err.Error()))
+		c.logger.Warn("failed to download archive for the h1: hash", logKeyValues(provider), slog.String("err", err.Error()))
 		return
 	}
-	resp, err := c.client.Do(req)
+	h1, err := core.HashH1(bytes.NewReader(archive), int64(len(archive)))
 	if err != nil {
-		c.logger.Error("failed to download provider", logKeyValues(provider), slog.String("err", err.Error()))
+		c.logger.Warn("failed to compute the h1: hash", logKeyValues(provider), slog.String("err", err.Error()))
 		return
 	}
+	if err := c.storage.UploadMirroredFile(ctx, provider, provider.H1HashFileName(), strings.NewReader(h1)); err != nil {
+		c.logger.Warn("failed to store the h1: hash", logKeyValues(provider), slog.String("err", err.Error()))
+	}
+}
+
+// downloadArchive buffers the upstream archive in a temporary file, which has to be removed by the caller.
+// The h1: hash is computed over the contents of the zip archive, which requires random access.
+func (c *copier) downloadArchive(ctx context.Context, provider *core.Provider) (*os.File, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.DownloadURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("failed to download %s, statuscode is %v", provider.ArchiveFileName(), resp.StatusCode)
+	}
 
-	fileName := provider.ArchiveFileName()
-	if err = c.storage.UploadMirroredFile(ctx, provider, fileName, resp.Body); err != nil {
-		c.logger.Error("failed to upload provider to mirror", logKeyValues(provider), slog.String("err", err.Error()))
+	f, err := os.CreateTemp("", "boring-registry-*.zip")
+	if err != nil {
+		return nil, 0, err
 	}
-	c.logger.Info("successfully copied provider", logKeyValues(provider), slog.String("took", time.Since(begin).String()))
+	size, err := io.Copy(f, resp.Body)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, err
+	}
+	return f, size, nil
+}
+
+// uploadArchive uploads the archive and its h1: hash to the mirror
+func (c *copier) uploadArchive(ctx context.Context, provider *core.Provider, f *os.File, size int64) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := c.storage.UploadMirroredFile(ctx, provider, provider.ArchiveFileName(), f); err != nil {
+		return err
+	}
+
+	h1, err := core.HashH1(f, size)
+	if err != nil {
+		return fmt.Errorf("failed to compute the h1: hash of %s: %w", provider.ArchiveFileName(), err)
+	}
+	return c.storage.UploadMirroredFile(ctx, provider, provider.H1HashFileName(), strings.NewReader(h1))
+}
+
+// verifyArchiveHashes checks that the zh: or the h1: hash of the archive is one of the hashes
+func verifyArchiveHashes(archive io.ReadSeeker, size int64, hashes []string) error {
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	zh, err := core.HashZh(archive)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(hashes, zh) {
+		return nil
+	}
+
+	if ra, ok := archive.(io.ReaderAt); ok {
+		h1, err := core.HashH1(ra, size)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(hashes, h1) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: the archive doesn't match any of the hashes", ErrHashMismatch)
+}
+
+// metadata copies the signing keys, the SHA256SUMS and its signature of a provider
+func (c *copier) metadata(ctx context.Context, provider *core.Provider) error {
+	if err := c.signingKeys(ctx, provider); err != nil {
+		return fmt.Errorf("failed to copy signing keys: %w", err)
+	}
+
+	if err := c.sha256Sums(ctx, provider); err != nil {
+		return fmt.Errorf("failed to copy SHA256SUMS: %w", err)
+	}
+
+	if err := c.sha256SumsSignature(ctx, provider); err != nil {
+		return fmt.Errorf("failed to copy SHA256SUMS.sig: %w", err)
+	}
+
+	return nil
 }
 
 // check if the signing keys exist, if not add it
@@ -142,16 +292,18 @@ func (c *copier) shutdown(ctx context.Context) {
 	close(c.done)
 }
 
-func NewCopier(ctx context.Context, storage Storage) Copier {
+func NewCopier(ctx context.Context, storage Storage, opts ...Option) Copier {
 	logger := slog.Default().With(slog.String("component", "copier"))
 	m := &copier{
 		done:   make(chan struct{}),
 		logger: logger,
 		client: &http.Client{
+			Transport: newOptions(opts...).upstreamTransport(),
 			// This is also the timeout for reading the response body
 			Timeout: 2 * time.Minute,
 		},
-		storage: storage,
+		storage:     storage,
+		backfilling: map[string]struct{}{},
 	}
 	go m.shutdown(ctx)
 	return m
@@ -152,3 +152,36 @@ func retrieveProviderArchiveEndpoint(svc Service, metrics *o11y.MirrorMetrics) e
 		return svc.RetrieveProviderArchive(ctx, provider)
 	}
 }
+
+type copyProviderVersionRequest struct {
+	Hostname  string
+	Namespace string
+	Name      string
+	Version   string
+}
+
+func copyProviderVersionEndpoint(seeder *Seeder) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(copyProviderVersionRequest)
+		if !ok {
+			return nil, fmt.Errorf("type assertion failed for copyProviderVersionRequest")
+		}
+
+		provider := &core.Provider{
+			Hostname:  req.Hostname,
+			Namespace: req.Namespace,
+			Name:      req.Name,
+			Version:   req.Version,
+		}
+		if provider.Hostname == "" || provider.Namespace == "" || provider.Name == "" || provider.Version == "" {
+			return nil, core.ErrVarMissing
+		}
+
+		// The copied files of a partial copy are returned, so that the client knows which platforms to retry
+		result, err := seeder.CopyVersion(ctx, provider)
+		if err != nil && (result == nil || len(result.Files) == 0) {
+			return nil, err
+		}
+		return result, nil
+	}
+}
@@ -4,4 +4,13 @@ import "errors"
 
 var (
 	ErrUpstreamNotFound = errors.New("not found upstream")
+
+	// ErrUpstreamUnavailable is returned for transient upstream errors which are worth retrying
+	ErrUpstreamUnavailable = errors.New("upstream temporarily unavailable")
+
+	// ErrInvalidSignature is returned if the mirrored SHA256SUMS isn't signed by any of the mirrored signing keys
+	ErrInvalidSignature = errors.New("invalid SHA256SUMS signature")
+
+	// ErrHashMismatch is returned if a provider archive doesn't match the hashes of a dependency lock file
+	ErrHashMismatch = errors.New("provider archive hash mismatch")
 )
@@ -0,0 +1,351 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+)
+
+// Exporter writes the mirrored providers from storage into a local directory.
+// The directory uses the layout of `terraform providers mirror`, so that it can be used as a filesystem mirror
+// or served as a static network mirror:
+//
+//	<hostname>/<namespace>/<name>/index.json
+//	<hostname>/<namespace>/<name>/<version>.json
+//	<hostname>/<namespace>/<name>/terraform-provider-<name>_<version>_<os>_<arch>.zip
+//	<hostname>/<namespace>/<name>/terraform-provider-<name>_<version>_SHA256SUMS
+//	<hostname>/<namespace>/<name>/terraform-provider-<name>_<version>_SHA256SUMS.sig
+type Exporter struct {
+	storage Storage
+	client  *http.Client
+	logger  *slog.Logger
+
+	// platforms restricts the export to the given platforms in the <os>_<arch> format.
+	// All platforms are exported if it's empty
+	platforms map[string]struct{}
+
+	// internal are the internal providers, which are exported under the internalHostname
+	internal         InternalStorage
+	internalHostname string
+}
+
+// InternalStorage is the storage of the internal providers, which are exported next to the mirrored providers
+type InternalStorage interface {
+	// ListAllProviders returns all platforms of all versions of the internal providers
+	ListAllProviders(ctx context.Context) ([]*core.Provider, error)
+
+	GetProvider(ctx context.Context, namespace, name, version, os, arch string) (*core.Provider, error)
+
+	// ProviderSha256Sums returns the SHA256SUMS file of a provider version
+	ProviderSha256Sums(ctx context.Context, namespace, name, version string) ([]byte, error)
+}
+
+// exportSource looks up the release of an exported provider, either in the mirror or in the internal providers
+type exportSource struct {
+	sha256Sums  func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error)
+	getProvider func(ctx context.Context, provider *core.Provider) (*core.Provider, error)
+}
+
+func (e *Exporter) Export(ctx context.Context, dir string) error {
+	providers, err := e.storage.ListAllMirroredProviders(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list mirrored providers: %w", err)
+	}
+
+	mirrored := exportSource{
+		sha256Sums:  e.storage.MirroredSha256Sum,
+		getProvider: e.storage.GetMirroredProvider,
+	}
+	exported := make(map[string]struct{})
+	for _, group := range groupProviders(e.filterPlatforms(providers)) {
+		if err := e.exportProvider(ctx, dir, group, mirrored); err != nil {
+			return err
+		}
+		exported[providerDirName(group[0])] = struct{}{}
+	}
+
+	if e.internal == nil {
+		return nil
+	}
+	providers, err = e.internal.ListAllProviders(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list internal providers: %w", err)
+	}
+	for _, p := range providers {
+		p.Hostname = e.internalHostname
+	}
+	for _, group := range groupProviders(e.filterPlatforms(providers)) {
+		// The index documents of a mirrored provider would be overwritten
+		if _, ok := exported[providerDirName(group[0])]; ok {
+			return fmt.Errorf("the internal provider %s is also mirrored from %s", providerDirName(group[0]), e.internalHostname)
+		}
+		if err := e.exportProvider(ctx, dir, group, e.internalSource()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// internalSource looks up the releases of the internal providers, which are exported under the internalHostname
+func (e *Exporter) internalSource() exportSource {
+	return exportSource{
+		sha256Sums: func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
+			b, err := e.internal.ProviderSha256Sums(ctx, provider.Namespace, provider.Name, provider.Version)
+			if err != nil {
+				return nil, err
+			}
+			return core.NewSha256Sums(provider.ShasumFileName(), bytes.NewReader(b))
+		},
+		getProvider: func(ctx context.Context, provider *core.Provider) (*core.Provider, error) {
+			p, err := e.internal.GetProvider(ctx, provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
+			if err != nil {
+				return nil, err
+			}
+			p.Hostname = e.internalHostname
+			return p, nil
+		},
+	}
+}
+
+// providerDirName returns the <hostname>/<namespace>/<name> directory of the provider
+func providerDirName(p *core.Provider) string {
+	return fmt.Sprintf("%s/%s/%s", p.Hostname, p.Namespace, p.Name)
+}
+
+// exportProvider writes all versions and platforms of a single provider, which are passed in as providers
+func (e *Exporter) exportProvider(ctx context.Context, dir string, providers []*core.Provider, source exportSource) error {
+	first := providers[0]
+	providerDir := filepath.Join(dir, first.Hostname, first.Namespace, first.Name)
+	if err := os.MkdirAll(providerDir, 0o755); err != nil {
+		return err
+	}
+
+	versions := make(map[string][]*core.Provider)
+	for _, p := range providers {
+		versions[p.Version] = append(versions[p.Version], p)
+	}
+
+	for version, platforms := range versions {
+		sha256Sums, err := source.sha256Sums(ctx, platforms[0].Clone())
+		if err != nil {
+			return fmt.Errorf("failed to retrieve SHA256SUMS of %s/%s/%s %s: %w", first.Hostname, first.Namespace, first.Name, version, err)
+		}
+
+		h1Hashes := make(map[string]string, len(platforms))
+		for i, p := range platforms {
+			mirrored, err := source.getProvider(ctx, p.Clone())
+			if err != nil {
+				return err
+			}
+
+			archivePath := filepath.Join(providerDir, mirrored.ArchiveFileName())
+			if err := e.download(ctx, mirrored.DownloadURL, archivePath); err != nil {
+				return err
+			}
+
+			// The h1: hashes complete the lock file entries for other platforms than the one running Terraform,
+			// an archive without one would fail the installation from the mirror wherever the lock file has it
+			h1, err := archiveH1Hash(archivePath)
+			if err != nil {
+				return fmt.Errorf("failed to compute the h1: hash of %s: %w", mirrored.ArchiveFileName(), err)
+			}
+			h1Hashes[fmt.Sprintf("%s_%s", mirrored.OS, mirrored.Arch)] = h1
+
+			// The SHA256SUMS and signature files are shared by all platforms of a version
+			if i == 0 {
+				if err := e.download(ctx, mirrored.SHASumsURL, filepath.Join(providerDir, mirrored.ShasumFileName())); err != nil {
+					return err
+				}
+				if err := e.download(ctx, mirrored.SHASumsSignatureURL, filepath.Join(providerDir, mirrored.ShasumSignatureFileName())); err != nil {
+					return err
+				}
+			}
+			e.logger.Info("exported provider", logKeyValues(mirrored))
+		}
+
+		installation, err := exportVersionIndex(platforms, sha256Sums, h1Hashes)
+		if err != nil {
+			return err
+		}
+		if err := writeJSON(filepath.Join(providerDir, fmt.Sprintf("%s.json", version)), installation); err != nil {
+			return err
+		}
+	}
+
+	return writeJSON(filepath.Join(providerDir, "index.json"), exportIndex(providers))
+}
+
+// download streams the file from the URL to the path
+func (e *Exporter) download(ctx context.Context, url, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s, statuscode is %v", filepath.Base(path), resp.StatusCode)
+	}
+
+	// Write into a temporary file first to not leave partial files behind
+	tmp := fmt.Sprintf("%s.tmp", path)
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (e *Exporter) filterPlatforms(providers []*core.Provider) []*core.Provider {
+	if len(e.platforms) == 0 {
+		return providers
+	}
+
+	var filtered []*core.Provider
+	for _, p := range providers {
+		if _, ok := e.platforms[fmt.Sprintf("%s_%s", p.OS, p.Arch)]; ok {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// groupProviders groups the providers by hostname, namespace, and name.
+// The groups are sorted to make the export order deterministic
+func groupProviders(providers []*core.Provider) [][]*core.Provider {
+	groups := make(map[string][]*core.Provider)
+	for _, p := range providers {
+		key := providerDirName(p)
+		groups[key] = append(groups[key], p)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([][]*core.Provider, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, groups[k])
+	}
+	return result
+}
+
+// exportIndex returns the index.json document listing all versions of a provider
+func exportIndex(providers []*core.Provider) *ListProviderVersionsResponse {
+	index := &ListProviderVersionsResponse{
+		Versions: map[string]EmptyObject{},
+	}
+	for _, p := range providers {
+		index.Versions[p.Version] = EmptyObject{}
+	}
+	return index
+}
+
+// exportVersionIndex returns the <version>.json document, which references the archives relative to the document.
+// The h1: hashes are keyed by the <os>_<arch> platform and added next to the zh: hashes of the SHA256SUMS file.
+func exportVersionIndex(providers []*core.Provider, sha256Sums *core.Sha256Sums, h1Hashes map[string]string) (*ListProviderInstallationResponse, error) {
+	relative := make([]*core.Provider, 0, len(providers))
+	for _, p := range providers {
+		clone := p.Clone()
+		clone.DownloadURL = clone.ArchiveFileName()
+		relative = append(relative, clone)
+	}
+	response, err := toListProviderInstallationResponse(relative, sha256Sums)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, h1 := range h1Hashes {
+		archive, ok := response.Archives[key]
+		if !ok {
+			continue
+		}
+		archive.Hashes = append(archive.Hashes, h1)
+		response.Archives[key] = archive
+	}
+	return response, nil
+}
+
+// archiveH1Hash returns the h1: hash of an exported archive
+func archiveH1Hash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return core.HashH1(f, info.Size())
+}
+
+func writeJSON(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// ExporterOption provides additional options for the Exporter
+type ExporterOption func(*Exporter)
+
+// WithExportPlatforms restricts the export to platforms in the <os>_<arch> format, e.g. linux_amd64
+func WithExportPlatforms(platforms []string) ExporterOption {
+	return func(e *Exporter) {
+		for _, p := range platforms {
+			e.platforms[p] = struct{}{}
+		}
+	}
+}
+
+// WithInternalProviders exports the internal providers next to the mirrored providers.
+// They're exported under the hostname that Terraform uses to install them from the registry, e.g. registry.example.com
+func WithInternalProviders(s InternalStorage, hostname string) ExporterOption {
+	return func(e *Exporter) {
+		e.internal = s
+		e.internalHostname = hostname
+	}
+}
+
+func NewExporter(s Storage, opts ...ExporterOption) *Exporter {
+	e := &Exporter{
+		storage: s,
+		client: &http.Client{
+			// This is also the timeout for reading the response body
+			Timeout: 5 * time.Minute,
+		},
+		logger:    slog.Default().With(slog.String("component", "exporter")),
+		platforms: make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
@@ -0,0 +1,351 @@
+package mirror
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const exportSha256Sums = `1111111111111111111111111111111111111111111111111111111111111111  terraform-provider-random_3.6.0_linux_amd64.zip
+2222222222222222222222222222222222222222222222222222222222222222  terraform-provider-random_3.6.0_darwin_arm64.zip
+`
+
+func exportProviders() []*core.Provider {
+	return []*core.Provider{
+		{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "3.6.0", OS: "linux", Arch: "amd64"},
+		{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "3.6.0", OS: "darwin", Arch: "arm64"},
+	}
+}
+
+func TestExportIndex(t *testing.T) {
+	providers := append(exportProviders(), &core.Provider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "3.5.1", OS: "linux", Arch: "amd64"})
+
+	b, err := json.Marshal(exportIndex(providers))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"versions":{"3.5.1":{},"3.6.0":{}}}`, string(b))
+}
+
+func TestExportVersionIndex(t *testing.T) {
+	sums, err := core.NewSha256Sums("terraform-provider-random_3.6.0_SHA256SUMS", strings.NewReader(exportSha256Sums))
+	assert.NoError(t, err)
+
+	got, err := exportVersionIndex(exportProviders(), sums, map[string]string{"linux_amd64": "h1:c2VjcmV0"})
+	assert.NoError(t, err)
+
+	b, err := json.Marshal(got)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"archives": {
+			"linux_amd64": {
+				"url": "terraform-provider-random_3.6.0_linux_amd64.zip",
+				"hashes": ["zh:1111111111111111111111111111111111111111111111111111111111111111", "h1:c2VjcmV0"]
+			},
+			"darwin_arm64": {
+				"url": "terraform-provider-random_3.6.0_darwin_arm64.zip",
+				"hashes": ["zh:2222222222222222222222222222222222222222222222222222222222222222"]
+			}
+		}
+	}`, string(b))
+
+	// A provider without a checksum in the SHA256SUMS fails the export
+	_, err = exportVersionIndex([]*core.Provider{{Name: "random", Version: "3.6.0", OS: "windows", Arch: "amd64"}}, sums, nil)
+	assert.Error(t, err)
+}
+
+// exportArchive returns a zip archive with a single file, whose content is the name of the archive
+func exportArchive(t *testing.T, name string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("terraform-provider")
+	require.NoError(t, err)
+	_, err = f.Write([]byte(name))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// newExportServer serves the release files, the archives are zip archives and the other files contain their name
+func newExportServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Base(r.URL.Path)
+		if strings.HasSuffix(name, ".zip") {
+			_, _ = w.Write(exportArchive(t, name))
+			return
+		}
+		_, _ = w.Write([]byte(name))
+	}))
+}
+
+func TestExporter_Export(t *testing.T) {
+	server := newExportServer(t)
+	defer server.Close()
+
+	s := &mockedStorage{
+		listAllMirroredProviders: func(ctx context.Context) ([]*core.Provider, error) {
+			return exportProviders(), nil
+		},
+		mirroredSha256Sum: func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
+			return core.NewSha256Sums(provider.ShasumFileName(), strings.NewReader(exportSha256Sums))
+		},
+		getMirroredProvider: func(ctx context.Context, provider *core.Provider) (*core.Provider, error) {
+			provider.DownloadURL = server.URL + "/" + provider.ArchiveFileName()
+			provider.SHASumsURL = server.URL + "/" + provider.ShasumFileName()
+			provider.SHASumsSignatureURL = server.URL + "/" + provider.ShasumSignatureFileName()
+			return provider, nil
+		},
+	}
+
+	dir := t.TempDir()
+	e := NewExporter(s, WithExportPlatforms([]string{"linux_amd64"}))
+	assert.NoError(t, e.Export(context.Background(), dir))
+
+	providerDir := filepath.Join(dir, "registry.terraform.io", "hashicorp", "random")
+	entries, err := os.ReadDir(providerDir)
+	assert.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{
+		"3.6.0.json",
+		"index.json",
+		"terraform-provider-random_3.6.0_SHA256SUMS",
+		"terraform-provider-random_3.6.0_SHA256SUMS.sig",
+		"terraform-provider-random_3.6.0_linux_amd64.zip",
+	}, names)
+
+	archive, err := os.ReadFile(filepath.Join(providerDir, "terraform-provider-random_3.6.0_linux_amd64.zip"))
+	assert.NoError(t, err)
+	assert.Equal(t, exportArchive(t, "terraform-provider-random_3.6.0_linux_amd64.zip"), archive)
+	h1, err := core.HashH1(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+
+	index, err := os.ReadFile(filepath.Join(providerDir, "index.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"versions":{"3.6.0":{}}}`, string(index))
+
+	version, err := os.ReadFile(filepath.Join(providerDir, "3.6.0.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{
+		"archives": {
+			"linux_amd64": {
+				"url": "terraform-provider-random_3.6.0_linux_amd64.zip",
+				"hashes": ["zh:1111111111111111111111111111111111111111111111111111111111111111", %q]
+			}
+		}
+	}`, h1), string(version))
+}
+
+// TestExporter_Export_schema validates the exported documents of several providers against the schema of the provider network mirror protocol
+// https://developer.hashicorp.com/terraform/internals/provider-network-mirror-protocol
+func TestExporter_Export_schema(t *testing.T) {
+	server := newExportServer(t)
+	defer server.Close()
+
+	providers := append(exportProviders(),
+		&core.Provider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "3.5.1", OS: "linux", Arch: "amd64"},
+		&core.Provider{Hostname: "registry.opentofu.org", Namespace: "hashicorp", Name: "aws", Version: "5.0.0", OS: "linux", Arch: "arm64"},
+	)
+	s := &mockedStorage{
+		listAllMirroredProviders: func(ctx context.Context) ([]*core.Provider, error) {
+			return providers, nil
+		},
+		mirroredSha256Sum: func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
+			var sums strings.Builder
+			for _, p := range providers {
+				if p.Name == provider.Name && p.Version == provider.Version {
+					fmt.Fprintf(&sums, "%s  %s\n", strings.Repeat("a", 64), p.ArchiveFileName())
+				}
+			}
+			return core.NewSha256Sums(provider.ShasumFileName(), strings.NewReader(sums.String()))
+		},
+		getMirroredProvider: func(ctx context.Context, provider *core.Provider) (*core.Provider, error) {
+			provider.DownloadURL = server.URL + "/" + provider.ArchiveFileName()
+			provider.SHASumsURL = server.URL + "/" + provider.ShasumFileName()
+			provider.SHASumsSignatureURL = server.URL + "/" + provider.ShasumSignatureFileName()
+			return provider, nil
+		},
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, NewExporter(s).Export(context.Background(), dir))
+
+	wantVersions := map[string][]string{
+		"registry.terraform.io/hashicorp/random": {"3.5.1", "3.6.0"},
+		"registry.opentofu.org/hashicorp/aws":    {"5.0.0"},
+	}
+	for provider, versions := range wantVersions {
+		providerDir := filepath.Join(dir, filepath.FromSlash(provider))
+
+		// index.json only contains the versions, which map to empty objects
+		var index map[string]map[string]map[string]any
+		b, err := os.ReadFile(filepath.Join(providerDir, "index.json"))
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, &index))
+		assert.Len(t, index, 1, "index.json of %s has other keys than versions", provider)
+		gotVersions := make([]string, 0, len(index["versions"]))
+		for v, obj := range index["versions"] {
+			assert.Empty(t, obj)
+			gotVersions = append(gotVersions, v)
+		}
+		assert.ElementsMatch(t, versions, gotVersions)
+
+		// <version>.json maps the <os>_<arch> platforms to the url and the hashes of the archives
+		for _, v := range versions {
+			var installation map[string]map[string]map[string]any
+			b, err := os.ReadFile(filepath.Join(providerDir, v+".json"))
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(b, &installation))
+			assert.Len(t, installation, 1, "%s.json of %s has other keys than archives", v, provider)
+			require.NotEmpty(t, installation["archives"])
+
+			for platform, archive := range installation["archives"] {
+				_, err := core.ParsePlatform(platform)
+				assert.NoError(t, err)
+				assert.ElementsMatch(t, []string{"url", "hashes"}, slices.Collect(maps.Keys(archive)))
+
+				url, ok := archive["url"].(string)
+				assert.True(t, ok)
+				assert.FileExists(t, filepath.Join(providerDir, url), "the url is relative to the document")
+
+				hashes, ok := archive["hashes"].([]any)
+				require.True(t, ok)
+				require.Len(t, hashes, 2)
+				assert.True(t, strings.HasPrefix(hashes[0].(string), core.HashSchemeZh))
+				assert.True(t, strings.HasPrefix(hashes[1].(string), core.HashSchemeH1))
+			}
+		}
+	}
+}
+
+type mockedInternalStorage struct {
+	providers  []*core.Provider
+	serverURL  string
+	sha256Sums string
+}
+
+func (m *mockedInternalStorage) ListAllProviders(ctx context.Context) ([]*core.Provider, error) {
+	return m.providers, nil
+}
+
+func (m *mockedInternalStorage) GetProvider(ctx context.Context, namespace, name, version, os, arch string) (*core.Provider, error) {
+	p := &core.Provider{Namespace: namespace, Name: name, Version: version, OS: os, Arch: arch}
+	p.DownloadURL = m.serverURL + "/" + p.ArchiveFileName()
+	p.SHASumsURL = m.serverURL + "/" + p.ShasumFileName()
+	p.SHASumsSignatureURL = m.serverURL + "/" + p.ShasumSignatureFileName()
+	return p, nil
+}
+
+func (m *mockedInternalStorage) ProviderSha256Sums(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	return []byte(m.sha256Sums), nil
+}
+
+func TestExporter_Export_internalProviders(t *testing.T) {
+	server := newExportServer(t)
+	defer server.Close()
+
+	mirrored := &mockedStorage{
+		listAllMirroredProviders: func(ctx context.Context) ([]*core.Provider, error) {
+			return nil, nil
+		},
+	}
+	internal := &mockedInternalStorage{
+		providers: []*core.Provider{
+			{Namespace: "hashicorp", Name: "random", Version: "3.6.0", OS: "linux", Arch: "amd64"},
+		},
+		serverURL:  server.URL,
+		sha256Sums: exportSha256Sums,
+	}
+
+	dir := t.TempDir()
+	e := NewExporter(mirrored, WithInternalProviders(internal, "registry.example.com"))
+	require.NoError(t, e.Export(context.Background(), dir))
+
+	providerDir := filepath.Join(dir, "registry.example.com", "hashicorp", "random")
+	archive, err := os.ReadFile(filepath.Join(providerDir, "terraform-provider-random_3.6.0_linux_amd64.zip"))
+	require.NoError(t, err)
+	h1, err := core.HashH1(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+
+	version, err := os.ReadFile(filepath.Join(providerDir, "3.6.0.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{
+		"archives": {
+			"linux_amd64": {
+				"url": "terraform-provider-random_3.6.0_linux_amd64.zip",
+				"hashes": ["zh:1111111111111111111111111111111111111111111111111111111111111111", %q]
+			}
+		}
+	}`, h1), string(version))
+}
+
+func TestExporter_Export_internalProviderIsMirrored(t *testing.T) {
+	server := newExportServer(t)
+	defer server.Close()
+
+	mirrored := &mockedStorage{
+		listAllMirroredProviders: func(ctx context.Context) ([]*core.Provider, error) {
+			return exportProviders()[:1], nil
+		},
+		mirroredSha256Sum: func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
+			return core.NewSha256Sums(provider.ShasumFileName(), strings.NewReader(exportSha256Sums))
+		},
+		getMirroredProvider: func(ctx context.Context, provider *core.Provider) (*core.Provider, error) {
+			provider.DownloadURL = server.URL + "/" + provider.ArchiveFileName()
+			provider.SHASumsURL = server.URL + "/" + provider.ShasumFileName()
+			provider.SHASumsSignatureURL = server.URL + "/" + provider.ShasumSignatureFileName()
+			return provider, nil
+		},
+	}
+	internal := &mockedInternalStorage{
+		providers: []*core.Provider{
+			{Namespace: "hashicorp", Name: "random", Version: "3.6.0", OS: "linux", Arch: "amd64"},
+		},
+		serverURL:  server.URL,
+		sha256Sums: exportSha256Sums,
+	}
+
+	e := NewExporter(mirrored, WithInternalProviders(internal, "registry.terraform.io"))
+	assert.Error(t, e.Export(context.Background(), t.TempDir()))
+}
+
+func TestExporter_Export_invalidArchive(t *testing.T) {
+	// The archives aren't zip archives, so their h1: hash can't be computed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(filepath.Base(r.URL.Path)))
+	}))
+	defer server.Close()
+
+	s := &mockedStorage{
+		listAllMirroredProviders: func(ctx context.Context) ([]*core.Provider, error) {
+			return exportProviders()[:1], nil
+		},
+		mirroredSha256Sum: func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
+			return core.NewSha256Sums(provider.ShasumFileName(), strings.NewReader(exportSha256Sums))
+		},
+		getMirroredProvider: func(ctx context.Context, provider *core.Provider) (*core.Provider, error) {
+			provider.DownloadURL = server.URL + "/" + provider.ArchiveFileName()
+			provider.SHASumsURL = server.URL + "/" + provider.ShasumFileName()
+			provider.SHASumsSignatureURL = server.URL + "/" + provider.ShasumSignatureFileName()
+			return provider, nil
+		},
+	}
+
+	err := NewExporter(s).Export(context.Background(), t.TempDir())
+	assert.ErrorContains(t, err, "h1: hash")
+}
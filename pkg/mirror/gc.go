@@ -0,0 +1,226 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+)
+
+// GCStorage is the Storage of the GarbageCollector, which additionally lists and deletes the files of the mirror
+type GCStorage interface {
+	Storage
+
+	// ListMirroredFiles returns the keys of all files of the mirror relative to the mirror prefix,
+	// e.g. registry.terraform.io/hashicorp/random/terraform-provider-random_3.6.0_SHA256SUMS
+	ListMirroredFiles(ctx context.Context) ([]string, error)
+
+	// DeleteMirroredFile deletes a file that belongs to a provider release
+	DeleteMirroredFile(ctx context.Context, provider *core.Provider, fileName string) error
+}
+
+// OrphanedFile is a file of the mirror that doesn't belong to a complete provider release
+type OrphanedFile struct {
+	// Provider is the provider version the file belongs to, without OS and Arch
+	Provider *core.Provider
+	FileName string
+	Reason   string
+}
+
+// GarbageCollector deletes orphaned files of partially copied or incompletely deleted provider releases from the mirror.
+// A release is complete if the SHA256SUMS file, its signature and the archives listed in it are present.
+type GarbageCollector struct {
+	storage GCStorage
+	logger  *slog.Logger
+	dryRun  bool
+}
+
+// releaseFiles are the files of a single mirrored provider version
+type releaseFiles struct {
+	provider  *core.Provider
+	sha256Sum bool
+	signature bool
+	// archives and hashes hold the archive file names, hashes are the archives with an .h1 sidecar file
+	archives []string
+	hashes   []string
+}
+
+// Collect deletes the orphaned files and returns them. Nothing is deleted in dry-run mode.
+// Copies by the pull-through mirror that are in progress while the garbage collection runs might be deleted,
+// they're completed by the next request for the provider.
+func (g *GarbageCollector) Collect(ctx context.Context) ([]OrphanedFile, error) {
+	keys, err := g.storage.ListMirroredFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mirrored files: %w", err)
+	}
+
+	var orphans []OrphanedFile
+	for _, release := range groupReleaseFiles(keys) {
+		o, err := g.orphans(ctx, release)
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, o...)
+	}
+
+	for _, o := range orphans {
+		logger := g.logger.With(logKeyValues(o.Provider), slog.String("file", o.FileName), slog.String("reason", o.Reason))
+		if g.dryRun {
+			logger.Info("found orphaned file")
+			continue
+		}
+		if err := g.storage.DeleteMirroredFile(ctx, o.Provider, o.FileName); err != nil {
+			return nil, fmt.Errorf("failed to delete %s: %w", o.FileName, err)
+		}
+		logger.Info("deleted orphaned file")
+	}
+	return orphans, nil
+}
+
+// orphans returns the files of the release that aren't part of a complete release
+func (g *GarbageCollector) orphans(ctx context.Context, release *releaseFiles) ([]OrphanedFile, error) {
+	p := release.provider
+	all := func(reason string) []OrphanedFile {
+		var orphans []OrphanedFile
+		if release.sha256Sum {
+			orphans = append(orphans, OrphanedFile{Provider: p, FileName: p.ShasumFileName(), Reason: reason})
+		}
+		if release.signature {
+			orphans = append(orphans, OrphanedFile{Provider: p, FileName: p.ShasumSignatureFileName(), Reason: reason})
+		}
+		for _, a := range release.archives {
+			orphans = append(orphans, OrphanedFile{Provider: p, FileName: a, Reason: reason})
+		}
+		for _, a := range release.hashes {
+			orphans = append(orphans, OrphanedFile{Provider: p, FileName: a + ".h1", Reason: reason})
+		}
+		return orphans
+	}
+
+	if !release.sha256Sum {
+		return all("the release doesn't have a SHA256SUMS file"), nil
+	}
+	if !release.signature {
+		return all("the release doesn't have a SHA256SUMS signature"), nil
+	}
+
+	b, err := g.storage.DownloadMirroredFile(ctx, p, p.ShasumFileName())
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", p.ShasumFileName(), err)
+	}
+	sums, err := core.NewSha256Sums(p.ShasumFileName(), bytes.NewReader(b))
+	if err != nil {
+		return all(fmt.Sprintf("the SHA256SUMS file is invalid: %v", err)), nil
+	}
+
+	var orphans []OrphanedFile
+	for _, a := range release.archives {
+		if _, ok := sums.Entries[a]; !ok {
+			orphans = append(orphans, OrphanedFile{Provider: p, FileName: a, Reason: "the archive isn't listed in the SHA256SUMS file"})
+		}
+	}
+	for _, a := range release.hashes {
+		if _, ok := sums.Entries[a]; !ok || !slices.Contains(release.archives, a) {
+			orphans = append(orphans, OrphanedFile{Provider: p, FileName: a + ".h1", Reason: "the archive of the hash is orphaned or missing"})
+		}
+	}
+	return orphans, nil
+}
+
+// groupReleaseFiles groups the keys in the <hostname>/<namespace>/<name>/<file> format by provider version.
+// Other keys, like the signing keys of a namespace, and files with unknown names are skipped.
+func groupReleaseFiles(keys []string) []*releaseFiles {
+	releases := make(map[string]*releaseFiles)
+	var order []string
+	for _, key := range keys {
+		parts := strings.Split(key, "/")
+		if len(parts) != 4 {
+			continue
+		}
+		hostname, namespace, name, file := parts[0], parts[1], parts[2], parts[3]
+
+		version, kind, ok := parseReleaseFileName(name, file)
+		if !ok {
+			continue
+		}
+
+		id := strings.Join([]string{hostname, namespace, name, version}, "/")
+		r, ok := releases[id]
+		if !ok {
+			r = &releaseFiles{provider: &core.Provider{Hostname: hostname, Namespace: namespace, Name: name, Version: version}}
+			releases[id] = r
+			order = append(order, id)
+		}
+		switch kind {
+		case releaseFileSha256Sums:
+			r.sha256Sum = true
+		case releaseFileSignature:
+			r.signature = true
+		case releaseFileArchive:
+			r.archives = append(r.archives, file)
+		case releaseFileHash:
+			r.hashes = append(r.hashes, strings.TrimSuffix(file, ".h1"))
+		}
+	}
+
+	slices.Sort(order)
+	grouped := make([]*releaseFiles, 0, len(order))
+	for _, id := range order {
+		grouped = append(grouped, releases[id])
+	}
+	return grouped
+}
+
+const (
+	releaseFileSha256Sums = iota
+	releaseFileSignature
+	releaseFileArchive
+	releaseFileHash
+)
+
+// parseReleaseFileName returns the version and the kind of a file of the provider release
+func parseReleaseFileName(name, file string) (string, int, bool) {
+	prefix := fmt.Sprintf("%s%s_", core.ProviderPrefix, name)
+	if !strings.HasPrefix(file, prefix) {
+		return "", 0, false
+	}
+
+	switch {
+	case strings.HasSuffix(file, "_SHA256SUMS"):
+		return strings.TrimSuffix(strings.TrimPrefix(file, prefix), "_SHA256SUMS"), releaseFileSha256Sums, true
+	case strings.HasSuffix(file, "_SHA256SUMS.sig"):
+		return strings.TrimSuffix(strings.TrimPrefix(file, prefix), "_SHA256SUMS.sig"), releaseFileSignature, true
+	case strings.HasSuffix(file, core.ProviderExtension+".h1"):
+		p, err := core.NewProviderFromArchive(strings.TrimSuffix(file, ".h1"))
+		return p.Version, releaseFileHash, err == nil && p.Name == name
+	case strings.HasSuffix(file, core.ProviderExtension):
+		p, err := core.NewProviderFromArchive(file)
+		return p.Version, releaseFileArchive, err == nil && p.Name == name
+	}
+	return "", 0, false
+}
+
+// GarbageCollectorOption provides additional options for the GarbageCollector
+type GarbageCollectorOption func(*GarbageCollector)
+
+// WithDryRun only reports the orphaned files instead of deleting them
+func WithDryRun(dryRun bool) GarbageCollectorOption {
+	return func(g *GarbageCollector) {
+		g.dryRun = dryRun
+	}
+}
+
+func NewGarbageCollector(s GCStorage, opts ...GarbageCollectorOption) *GarbageCollector {
+	g := &GarbageCollector{
+		storage: s,
+		logger:  slog.Default().With(slog.String("component", "gc")),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
@@ -0,0 +1,139 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gcStorage holds a synthetic listing of the mirror, the files are keyed by <hostname>/<namespace>/<name>/<file>
+type gcStorage struct {
+	mockedStorage
+	files   map[string][]byte
+	deleted []string
+}
+
+func (s *gcStorage) ListMirroredFiles(_ context.Context) ([]string, error) {
+	var keys []string
+	for k := range s.files {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (s *gcStorage) DownloadMirroredFile(_ context.Context, provider *core.Provider, fileName string) ([]byte, error) {
+	b, ok := s.files[path.Join(provider.Hostname, provider.Namespace, provider.Name, fileName)]
+	if !ok {
+		return nil, core.ErrObjectNotFound
+	}
+	return b, nil
+}
+
+func (s *gcStorage) DeleteMirroredFile(_ context.Context, provider *core.Provider, fileName string) error {
+	key := path.Join(provider.Hostname, provider.Namespace, provider.Name, fileName)
+	delete(s.files, key)
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func testGCStorage() *gcStorage {
+	const dir = "registry.terraform.io/hashicorp/random/"
+	sums := func(version string, platforms ...string) []byte {
+		var b []byte
+		for _, p := range platforms {
+			b = fmt.Appendf(b, "5f9c7aa76b7c34d722fc9123208e26b22d60440cb47150dd04733b9b94f4541a  terraform-provider-random_%s_%s.zip\n", version, p)
+		}
+		return b
+	}
+	return &gcStorage{files: map[string][]byte{
+		"registry.terraform.io/hashicorp/signing-keys.json": []byte("{}"),
+
+		// A complete release
+		dir + "terraform-provider-random_1.0.0_SHA256SUMS":            sums("1.0.0", "linux_amd64"),
+		dir + "terraform-provider-random_1.0.0_SHA256SUMS.sig":        []byte("sig"),
+		dir + "terraform-provider-random_1.0.0_linux_amd64.zip":       []byte("zip"),
+		dir + "terraform-provider-random_1.0.0_linux_amd64.zip.h1":    []byte("h1:"),
+		dir + "terraform-provider-random_1.0.0_darwin_arm64.zip.h1":   []byte("h1:"),
+		dir + "terraform-provider-random_1.0.0_windows_amd64.zip":     []byte("zip"),
+		dir + "terraform-provider-random_1.0.0_windows_amd64.zip.h1":  []byte("h1:"),
+		dir + "terraform-provider-random_1.0.0_metadata.json.unknown": []byte("{}"),
+
+		// A signature without the SHA256SUMS file
+		dir + "terraform-provider-random_2.0.0_SHA256SUMS.sig":  []byte("sig"),
+		dir + "terraform-provider-random_2.0.0_linux_amd64.zip": []byte("zip"),
+
+		// A partial copy without the signature
+		dir + "terraform-provider-random_3.0.0_SHA256SUMS": sums("3.0.0", "linux_amd64"),
+	}}
+}
+
+func TestGarbageCollector_Collect(t *testing.T) {
+	const dir = "registry.terraform.io/hashicorp/random/"
+	wantOrphans := []string{
+		dir + "terraform-provider-random_1.0.0_windows_amd64.zip",
+		dir + "terraform-provider-random_1.0.0_darwin_arm64.zip.h1",
+		dir + "terraform-provider-random_1.0.0_windows_amd64.zip.h1",
+		dir + "terraform-provider-random_2.0.0_SHA256SUMS.sig",
+		dir + "terraform-provider-random_2.0.0_linux_amd64.zip",
+		dir + "terraform-provider-random_3.0.0_SHA256SUMS",
+	}
+	key := func(o OrphanedFile) string {
+		return path.Join(o.Provider.Hostname, o.Provider.Namespace, o.Provider.Name, o.FileName)
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		storage := testGCStorage()
+		orphans, err := NewGarbageCollector(storage, WithDryRun(true)).Collect(context.Background())
+		require.NoError(t, err)
+
+		var got []string
+		for _, o := range orphans {
+			got = append(got, key(o))
+			assert.NotEmpty(t, o.Reason)
+		}
+		assert.Equal(t, wantOrphans, got)
+		assert.Empty(t, storage.deleted)
+		assert.Equal(t, "the release doesn't have a SHA256SUMS file", orphans[3].Reason)
+		assert.Equal(t, "the release doesn't have a SHA256SUMS signature", orphans[5].Reason)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		storage := testGCStorage()
+		_, err := NewGarbageCollector(storage).Collect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, wantOrphans, storage.deleted)
+
+		// The complete release and unrelated files are kept
+		remaining, _ := storage.ListMirroredFiles(context.Background())
+		assert.Equal(t, []string{
+			dir + "terraform-provider-random_1.0.0_SHA256SUMS",
+			dir + "terraform-provider-random_1.0.0_SHA256SUMS.sig",
+			dir + "terraform-provider-random_1.0.0_linux_amd64.zip",
+			dir + "terraform-provider-random_1.0.0_linux_amd64.zip.h1",
+			dir + "terraform-provider-random_1.0.0_metadata.json.unknown",
+			"registry.terraform.io/hashicorp/signing-keys.json",
+		}, remaining)
+
+		// A second run doesn't find any orphans
+		orphans, err := NewGarbageCollector(storage).Collect(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, orphans)
+	})
+
+	t.Run("invalid SHA256SUMS file", func(t *testing.T) {
+		storage := testGCStorage()
+		storage.files[dir+"terraform-provider-random_1.0.0_SHA256SUMS"] = []byte("not a checksum")
+		orphans, err := NewGarbageCollector(storage, WithDryRun(true)).Collect(context.Background())
+		require.NoError(t, err)
+		// All 7 known files of the release are orphaned in addition to the 2.0.0 and 3.0.0 files
+		assert.Len(t, orphans, 10)
+	})
+}
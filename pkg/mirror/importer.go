@@ -0,0 +1,209 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/provider"
+)
+
+// Importer copies provider releases from an upstream registry into the internal provider storage.
+// Unlike the Copier, the imported providers are served by the provider registry instead of the network mirror.
+type Importer struct {
+	platforms []core.Platform
+
+	upstream upstreamProvider
+	client   *http.Client
+	storage  provider.Storage
+	logger   *slog.Logger
+}
+
+// Import copies the archives of the configured platforms, the SHA256SUMS file, its signature and the signing keys of a provider version.
+// The signature is verified with the upstream signing keys and the archives with the SHA256SUMS file before anything is stored.
+// The signature is uploaded last, so that an interrupted import is never served.
+func (i *Importer) Import(ctx context.Context, p *core.Provider) error {
+	platforms, err := i.selectPlatforms(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	releases := make([]*core.Provider, 0, len(platforms))
+	for _, platform := range platforms {
+		release, err := i.upstream.getProvider(ctx, &core.Provider{
+			Hostname:  p.Hostname,
+			Namespace: p.Namespace,
+			Name:      p.Name,
+			Version:   p.Version,
+			OS:        platform.OS,
+			Arch:      platform.Arch,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get %s_%s from upstream: %w", platform.OS, platform.Arch, err)
+		}
+		releases = append(releases, release)
+	}
+	release := releases[0]
+
+	sums, err := i.download(ctx, release.SHASumsURL)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", release.ShasumFileName(), err)
+	}
+	sig, err := i.download(ctx, release.SHASumsSignatureURL)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", release.ShasumSignatureFileName(), err)
+	}
+	if err := release.SigningKeys.IsValidSha256Sums(sums, sig); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	parsed, err := core.NewSha256Sums(release.ShasumFileName(), bytes.NewReader(sums))
+	if err != nil {
+		return err
+	}
+
+	if err := i.storage.LockProviderVersion(ctx, p.Namespace, p.Name, p.Version); err != nil {
+		return err
+	}
+	defer func() {
+		if err := i.storage.UnlockProviderVersion(context.WithoutCancel(ctx), p.Namespace, p.Name, p.Version); err != nil {
+			i.logger.Error("failed to release the upload lock", logKeyValues(p), slog.String("err", err.Error()))
+		}
+	}()
+
+	for _, r := range releases {
+		if err := i.importArchive(ctx, r, parsed); err != nil {
+			return err
+		}
+		i.logger.Info("imported provider archive", logKeyValues(r))
+	}
+
+	if err := i.storage.UploadProviderReleaseFiles(ctx, p.Namespace, p.Name, release.ShasumFileName(), bytes.NewReader(sums)); err != nil {
+		return err
+	}
+	if err := i.signingKeys(ctx, p.Namespace, release.SigningKeys.GPGPublicKeys); err != nil {
+		return fmt.Errorf("failed to import signing keys: %w", err)
+	}
+	return i.storage.UploadProviderReleaseFiles(ctx, p.Namespace, p.Name, release.ShasumSignatureFileName(), bytes.NewReader(sig))
+}
+
+// selectPlatforms returns the configured platforms or all upstream platforms of the version
+func (i *Importer) selectPlatforms(ctx context.Context, p *core.Provider) ([]core.Platform, error) {
+	if len(i.platforms) > 0 {
+		return i.platforms, nil
+	}
+
+	versions, err := i.upstream.listProviderVersions(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upstream versions: %w", err)
+	}
+	for _, v := range versions.Versions {
+		if v.Version == p.Version && len(v.Platforms) > 0 {
+			return v.Platforms, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s/%s/%s version %s", ErrUpstreamNotFound, p.Hostname, p.Namespace, p.Name, p.Version)
+}
+
+// importArchive downloads the archive into a temporary file and uploads it if its checksum matches the SHA256SUMS file
+func (i *Importer) importArchive(ctx context.Context, release *core.Provider, sums *core.Sha256Sums) error {
+	want, ok := sums.Entries[release.ArchiveFileName()]
+	if !ok {
+		return fmt.Errorf("%s isn't listed in %s", release.ArchiveFileName(), sums.Filename)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, release.DownloadURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s, statuscode is %v", release.ArchiveFileName(), resp.StatusCode)
+	}
+
+	f, err := os.CreateTemp("", "boring-registry-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	checksum, err := core.Sha256Checksum(io.TeeReader(resp.Body, f))
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", release.ArchiveFileName(), err)
+	}
+	if !bytes.Equal(checksum, want) {
+		return fmt.Errorf("%w: %s", provider.ErrChecksumMismatch, release.ArchiveFileName())
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return i.storage.UploadProviderReleaseFiles(ctx, release.Namespace, release.Name, release.ArchiveFileName(), f)
+}
+
+// signingKeys adds the upstream keys to the internal signing keys of the namespace
+func (i *Importer) signingKeys(ctx context.Context, namespace string, keys []core.GPGPublicKey) error {
+	signingKeys, err := i.storage.SigningKeys(ctx, namespace)
+	if errors.Is(err, core.ErrObjectNotFound) {
+		signingKeys = &core.SigningKeys{}
+	} else if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		signingKeys.AddKey(k)
+	}
+	return i.storage.UploadSigningKeys(ctx, namespace, signingKeys)
+}
+
+func (i *Importer) download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("statuscode is %v", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// NewImporter creates an Importer for the platforms in the <os>_<arch> format, all platforms are imported if it's empty
+func NewImporter(s provider.Storage, platforms []string, opts ...Option) (*Importer, error) {
+	parsed := make([]core.Platform, 0, len(platforms))
+	for _, p := range platforms {
+		platform, err := core.ParsePlatform(p)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, platform)
+	}
+
+	o := newOptions(opts...)
+	return &Importer{
+		platforms: parsed,
+		upstream:  o.upstreamRegistry(),
+		client: &http.Client{
+			Transport: o.upstreamTransport(),
+			// This is also the timeout for reading the response body
+			Timeout: 2 * time.Minute,
+		},
+		storage: s,
+		logger:  slog.Default().With(slog.String("component", "importer")),
+	}, nil
+}
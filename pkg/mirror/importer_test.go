@@ -0,0 +1,234 @@
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/discovery"
+	"github.com/boring-registry/boring-registry/pkg/provider"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importStorage keeps the internal provider files keyed by <namespace>/<name>/<file>
+type importStorage struct {
+	provider.Storage
+	files       map[string][]byte
+	signingKeys map[string]*core.SigningKeys
+	locked      bool
+}
+
+func (s *importStorage) LockProviderVersion(_ context.Context, _, _, _ string) error {
+	if s.locked {
+		return core.ErrUploadInProgress
+	}
+	s.locked = true
+	return nil
+}
+
+func (s *importStorage) UnlockProviderVersion(_ context.Context, _, _, _ string) error {
+	s.locked = false
+	return nil
+}
+
+func (s *importStorage) UploadProviderReleaseFiles(_ context.Context, namespace, name, filename string, file io.Reader) error {
+	b, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	s.files[path.Join(namespace, name, filename)] = b
+	return nil
+}
+
+func (s *importStorage) SigningKeys(_ context.Context, namespace string) (*core.SigningKeys, error) {
+	k, ok := s.signingKeys[namespace]
+	if !ok {
+		return nil, core.ErrObjectNotFound
+	}
+	return k, nil
+}
+
+func (s *importStorage) UploadSigningKeys(_ context.Context, namespace string, signingKeys *core.SigningKeys) error {
+	s.signingKeys[namespace] = signingKeys
+	return nil
+}
+
+// newImportUpstream serves the hashicorp/random 2.0.0 release for linux_amd64 and darwin_arm64
+func newImportUpstream(t *testing.T, archives map[string][]byte) (*httptest.Server, *core.SigningKeys) {
+	t.Helper()
+	var sums []byte
+	for _, p := range []string{"darwin_arm64", "linux_amd64"} {
+		checksum := sha256.Sum256([]byte("archive " + p))
+		sums = fmt.Appendf(sums, "%x  terraform-provider-random_2.0.0_%s.zip\n", checksum, p)
+	}
+	signingKeys, sig := signedSha256Sums(t, sums)
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/providers/hashicorp/random/versions", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"versions":[{"version":"2.0.0","platforms":[{"os":"linux","arch":"amd64"},{"os":"darwin","arch":"arm64"}]}]}`))
+	})
+	mux.HandleFunc("GET /v1/providers/hashicorp/random/2.0.0/download/{os}/{arch}", func(w http.ResponseWriter, r *http.Request) {
+		platform := r.PathValue("os") + "_" + r.PathValue("arch")
+		_ = json.NewEncoder(w).Encode(core.Provider{
+			OS:                  r.PathValue("os"),
+			Arch:                r.PathValue("arch"),
+			Filename:            fmt.Sprintf("terraform-provider-random_2.0.0_%s.zip", platform),
+			DownloadURL:         fmt.Sprintf("%s/files/terraform-provider-random_2.0.0_%s.zip", server.URL, platform),
+			SHASumsURL:          server.URL + "/files/terraform-provider-random_2.0.0_SHA256SUMS",
+			SHASumsSignatureURL: server.URL + "/files/terraform-provider-random_2.0.0_SHA256SUMS.sig",
+			SigningKeys:         *signingKeys,
+		})
+	})
+	mux.HandleFunc("GET /files/terraform-provider-random_2.0.0_SHA256SUMS", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(sums)
+	})
+	mux.HandleFunc("GET /files/terraform-provider-random_2.0.0_SHA256SUMS.sig", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(sig)
+	})
+	mux.HandleFunc("GET /files/{file}", func(w http.ResponseWriter, r *http.Request) {
+		b, ok := archives[r.PathValue("file")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(b)
+	})
+	server = httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	return server, signingKeys
+}
+
+// newImportUpstreamRegistry discovers the providers.v1 service of the server with a trailing slash like registry.terraform.io
+func newImportUpstreamRegistry(server *httptest.Server) *upstreamProviderRegistry {
+	d := newMockedServiceDiscovery(server)
+	return &upstreamProviderRegistry{
+		client: server.Client(),
+		remoteServiceDiscovery: &mockedRemoteServiceDiscovery{
+			resolve: func(ctx context.Context, host string) (*discovery.DiscoveredRemoteService, error) {
+				discovered, err := d.Resolve(ctx, host)
+				if err != nil {
+					return nil, err
+				}
+				discovered.ProvidersV1 = "/v1/providers/"
+				return discovered, nil
+			},
+		},
+	}
+}
+
+func TestImporter_Import(t *testing.T) {
+	archives := func() map[string][]byte {
+		return map[string][]byte{
+			"terraform-provider-random_2.0.0_linux_amd64.zip":  []byte("archive linux_amd64"),
+			"terraform-provider-random_2.0.0_darwin_arm64.zip": []byte("archive darwin_arm64"),
+		}
+	}
+	random := &core.Provider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "2.0.0"}
+
+	newImporter := func(t *testing.T, server *httptest.Server, platforms ...string) (*Importer, *importStorage) {
+		storage := &importStorage{files: make(map[string][]byte), signingKeys: make(map[string]*core.SigningKeys)}
+		i, err := NewImporter(storage, platforms)
+		require.NoError(t, err)
+		i.client = server.Client()
+		i.upstream = newImportUpstreamRegistry(server)
+		return i, storage
+	}
+
+	t.Run("selected platforms", func(t *testing.T) {
+		server, signingKeys := newImportUpstream(t, archives())
+		i, storage := newImporter(t, server, "linux_amd64")
+		require.NoError(t, i.Import(context.Background(), random))
+
+		assert.Len(t, storage.files, 3)
+		assert.Equal(t, []byte("archive linux_amd64"), storage.files["hashicorp/random/terraform-provider-random_2.0.0_linux_amd64.zip"])
+		assert.Contains(t, storage.files, "hashicorp/random/terraform-provider-random_2.0.0_SHA256SUMS")
+		assert.Contains(t, storage.files, "hashicorp/random/terraform-provider-random_2.0.0_SHA256SUMS.sig")
+		assert.Equal(t, signingKeys.GPGPublicKeys, storage.signingKeys["hashicorp"].GPGPublicKeys)
+		assert.False(t, storage.locked)
+	})
+
+	t.Run("all upstream platforms", func(t *testing.T) {
+		server, _ := newImportUpstream(t, archives())
+		i, storage := newImporter(t, server)
+		require.NoError(t, i.Import(context.Background(), random))
+
+		assert.Len(t, storage.files, 4)
+		assert.Contains(t, storage.files, "hashicorp/random/terraform-provider-random_2.0.0_darwin_arm64.zip")
+	})
+
+	t.Run("existing signing keys are kept", func(t *testing.T) {
+		server, signingKeys := newImportUpstream(t, archives())
+		i, storage := newImporter(t, server, "linux_amd64")
+		existing := core.GPGPublicKey{KeyID: "0000000000000000"}
+		storage.signingKeys["hashicorp"] = &core.SigningKeys{GPGPublicKeys: []core.GPGPublicKey{existing}}
+		require.NoError(t, i.Import(context.Background(), random))
+
+		assert.Equal(t, append([]core.GPGPublicKey{existing}, signingKeys.GPGPublicKeys...), storage.signingKeys["hashicorp"].GPGPublicKeys)
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		tampered := archives()
+		tampered["terraform-provider-random_2.0.0_linux_amd64.zip"] = []byte("tampered")
+		server, _ := newImportUpstream(t, tampered)
+		i, storage := newImporter(t, server, "linux_amd64")
+
+		err := i.Import(context.Background(), random)
+		assert.ErrorIs(t, err, provider.ErrChecksumMismatch)
+		assert.Empty(t, storage.files)
+		assert.Empty(t, storage.signingKeys)
+		assert.False(t, storage.locked)
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		server, _ := newImportUpstream(t, archives())
+		i, storage := newImporter(t, server, "linux_amd64")
+		i.upstream = &mockedUpstreamProvider{
+			customGetProvider: func(ctx context.Context, p *core.Provider) (*core.Provider, error) {
+				release, err := newImportUpstreamRegistry(server).getProvider(ctx, p)
+				if err != nil {
+					return nil, err
+				}
+				otherKeys, _ := signedSha256Sums(t, []byte("other"))
+				release.SigningKeys = *otherKeys
+				return release, nil
+			},
+		}
+
+		err := i.Import(context.Background(), random)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+		assert.Empty(t, storage.files)
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		server, _ := newImportUpstream(t, archives())
+		i, _ := newImporter(t, server)
+
+		err := i.Import(context.Background(), &core.Provider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "3.0.0"})
+		assert.ErrorIs(t, err, ErrUpstreamNotFound)
+	})
+
+	t.Run("upload in progress", func(t *testing.T) {
+		server, _ := newImportUpstream(t, archives())
+		i, storage := newImporter(t, server, "linux_amd64")
+		storage.locked = true
+
+		err := i.Import(context.Background(), random)
+		assert.ErrorIs(t, err, core.ErrUploadInProgress)
+		assert.Empty(t, storage.files)
+	})
+
+	t.Run("invalid platform", func(t *testing.T) {
+		_, err := NewImporter(&importStorage{}, []string{"linux"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,254 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// LockedProvider is a provider version selected by a dependency lock file
+type LockedProvider struct {
+	Hostname  string
+	Namespace string
+	Name      string
+	Version   string
+	// Hashes contains the zh: and h1: hashes of the acceptable archives
+	Hashes []string
+}
+
+type lockFile struct {
+	Providers []lockFileProvider `hcl:"provider,block"`
+}
+
+type lockFileProvider struct {
+	Source  string   `hcl:"source,label"`
+	Version string   `hcl:"version"`
+	Hashes  []string `hcl:"hashes,optional"`
+	// Remain holds attributes like the constraints, which aren't needed to mirror the provider
+	Remain hcl.Body `hcl:",remain"`
+}
+
+// ParseLockFile parses the provider blocks of a .terraform.lock.hcl file
+func ParseLockFile(filename string, src []byte) ([]LockedProvider, error) {
+	f, diags := hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var lf lockFile
+	if diags := gohcl.DecodeBody(f.Body, nil, &lf); diags.HasErrors() {
+		return nil, diags
+	}
+
+	providers := make([]LockedProvider, 0, len(lf.Providers))
+	for _, p := range lf.Providers {
+		parts := strings.Split(p.Source, "/")
+		if len(parts) != 3 || slices.Contains(parts, "") {
+			return nil, fmt.Errorf("invalid provider source %q, expected format <hostname>/<namespace>/<name>", p.Source)
+		}
+
+		providers = append(providers, LockedProvider{
+			Hostname:  parts[0],
+			Namespace: parts[1],
+			Name:      parts[2],
+			Version:   p.Version,
+			Hashes:    p.Hashes,
+		})
+	}
+	return providers, nil
+}
+
+// Seeder copies provider versions from upstream into the mirror, like the providers of a dependency lock file
+type Seeder struct {
+	platforms []core.Platform
+
+	upstream upstreamProvider
+	storage  Storage
+	copier   Copier
+	logger   *slog.Logger
+}
+
+// Seed copies the locked provider versions for the configured platforms, which are missing in the mirror.
+// Archives that don't match the hashes of the lock file are rejected.
+func (s *Seeder) Seed(ctx context.Context, locked []LockedProvider) error {
+	var errs []error
+	for _, l := range locked {
+		providers, err := s.selectProviders(ctx, l)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to select %s/%s/%s %s: %w", l.Hostname, l.Namespace, l.Name, l.Version, err))
+			continue
+		}
+
+		for _, p := range providers {
+			if err := s.copy(ctx, p, l.Hashes); err != nil {
+				errs = append(errs, fmt.Errorf("failed to copy %s/%s/%s: %w", p.Hostname, p.Namespace, p.ArchiveFileName(), err))
+				continue
+			}
+			s.logger.Info("copied provider", logKeyValues(p))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Seeder) copy(ctx context.Context, provider *core.Provider, hashes []string) error {
+	upstreamCtx, cancelUpstreamCtx := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelUpstreamCtx()
+	upstream, err := s.upstream.getProvider(upstreamCtx, provider)
+	if err != nil {
+		return err
+	}
+
+	copyCtx, cancelCopyCtx := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancelCopyCtx()
+	return s.copier.copyVerified(copyCtx, upstream, hashes)
+}
+
+// CopyResult summarizes the files that were copied into the mirror for a provider version
+type CopyResult struct {
+	Hostname  string   `json:"hostname"`
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Version   string   `json:"version"`
+	Files     []string `json:"files"`
+	// Errors describes the platforms that failed to copy
+	Errors []string `json:"errors,omitempty"`
+}
+
+// StatusCode reports a partial copy as 502 Bad Gateway, the copied files are still part of the response
+func (r *CopyResult) StatusCode() int {
+	if len(r.Errors) > 0 {
+		return http.StatusBadGateway
+	}
+	return http.StatusOK
+}
+
+// CopyVersion synchronously copies the platforms of a provider version, which are missing in the mirror.
+// The archives are verified against the checksums advertised by upstream.
+// Platforms that fail to copy don't abort the copy of the other platforms, the errors are returned together with the result.
+func (s *Seeder) CopyVersion(ctx context.Context, provider *core.Provider) (*CopyResult, error) {
+	providers, err := s.selectProviders(ctx, LockedProvider{
+		Hostname:  provider.Hostname,
+		Namespace: provider.Namespace,
+		Name:      provider.Name,
+		Version:   provider.Version,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CopyResult{
+		Hostname:  provider.Hostname,
+		Namespace: provider.Namespace,
+		Name:      provider.Name,
+		Version:   provider.Version,
+		Files:     []string{},
+	}
+	var errs []error
+	for _, p := range providers {
+		if err := s.copyFromUpstream(ctx, p); err != nil {
+			err = fmt.Errorf("failed to copy %s/%s/%s: %w", p.Hostname, p.Namespace, p.ArchiveFileName(), err)
+			errs = append(errs, err)
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		s.logger.Info("copied provider", logKeyValues(p))
+
+		for _, f := range []string{p.ShasumFileName(), p.ShasumSignatureFileName(), p.ArchiveFileName(), p.H1HashFileName()} {
+			if !slices.Contains(result.Files, f) {
+				result.Files = append(result.Files, f)
+			}
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+func (s *Seeder) copyFromUpstream(ctx context.Context, provider *core.Provider) error {
+	upstreamCtx, cancelUpstreamCtx := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelUpstreamCtx()
+	upstream, err := s.upstream.getProvider(upstreamCtx, provider)
+	if err != nil {
+		return err
+	}
+
+	copyCtx, cancelCopyCtx := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancelCopyCtx()
+	return s.copier.copyVerified(copyCtx, upstream, []string{core.HashSchemeZh + upstream.Shasum})
+}
+
+// selectProviders returns the platforms of the locked version that are requested and not mirrored yet.
+// All platforms that are available upstream are selected if no platforms are configured.
+func (s *Seeder) selectProviders(ctx context.Context, locked LockedProvider) ([]*core.Provider, error) {
+	provider := &core.Provider{
+		Hostname:  locked.Hostname,
+		Namespace: locked.Namespace,
+		Name:      locked.Name,
+	}
+
+	upstreamCtx, cancelUpstreamCtx := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelUpstreamCtx()
+	versions, err := s.upstream.listProviderVersions(upstreamCtx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := &core.ProviderVersions{}
+	for _, v := range versions.Versions {
+		if v.Version != locked.Version {
+			continue
+		}
+
+		platforms := v.Platforms
+		if len(s.platforms) > 0 {
+			platforms = slices.DeleteFunc(slices.Clone(v.Platforms), func(p core.Platform) bool {
+				return !slices.Contains(s.platforms, p)
+			})
+		}
+		selected.Versions = append(selected.Versions, core.ProviderVersion{Version: v.Version, Platforms: platforms})
+	}
+	if len(selected.Versions) == 0 {
+		return nil, fmt.Errorf("%w: version %s", ErrUpstreamNotFound, locked.Version)
+	}
+
+	mirrored, err := s.storage.ListMirroredProviders(ctx, provider)
+	if err != nil {
+		var providerError *core.ProviderError
+		if !errors.As(err, &providerError) {
+			return nil, err
+		}
+		// Nothing has been mirrored for this provider yet
+		mirrored = nil
+	}
+
+	return missingPlatforms(provider, selected, mirrored), nil
+}
+
+// NewSeeder creates a Seeder for the platforms in the <os>_<arch> format
+func NewSeeder(s Storage, c Copier, platforms []string, opts ...Option) (*Seeder, error) {
+	parsed := make([]core.Platform, 0, len(platforms))
+	for _, p := range platforms {
+		platform, err := core.ParsePlatform(p)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, platform)
+	}
+
+	return &Seeder{
+		platforms: parsed,
+		upstream:  newOptions(opts...).upstreamRegistry(),
+		storage:   s,
+		copier:    c,
+		logger:    slog.Default().With(slog.String("component", "seeder")),
+	}, nil
+}
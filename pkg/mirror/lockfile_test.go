@@ -0,0 +1,145 @@
+package mirror
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleLockFile = `# This file is maintained automatically by "terraform init".
+# Manual edits may be lost in future updates.
+
+provider "registry.terraform.io/hashicorp/random" {
+  version     = "3.6.0"
+  constraints = "~> 3.6"
+  hashes = [
+    "h1:R5Ucn26riKIEijcsiOMBR3uOAjuOMfI1x7XvH4P6B1w=",
+    "zh:03360ed3ecd31e8c5dac9c95fe0858be50f3e9a0d0c654b5e504109c2159287d",
+  ]
+}
+
+provider "terraform.example.com/acme/dummy" {
+  version = "1.0.0"
+}
+`
+
+func TestParseLockFile(t *testing.T) {
+	providers, err := ParseLockFile(".terraform.lock.hcl", []byte(sampleLockFile))
+	require.NoError(t, err)
+	assert.Equal(t, []LockedProvider{
+		{
+			Hostname:  "registry.terraform.io",
+			Namespace: "hashicorp",
+			Name:      "random",
+			Version:   "3.6.0",
+			Hashes: []string{
+				"h1:R5Ucn26riKIEijcsiOMBR3uOAjuOMfI1x7XvH4P6B1w=",
+				"zh:03360ed3ecd31e8c5dac9c95fe0858be50f3e9a0d0c654b5e504109c2159287d",
+			},
+		},
+		{
+			Hostname:  "terraform.example.com",
+			Namespace: "acme",
+			Name:      "dummy",
+			Version:   "1.0.0",
+		},
+	}, providers)
+
+	_, err = ParseLockFile(".terraform.lock.hcl", []byte(`provider "hashicorp/random" { version = "3.6.0" }`))
+	assert.Error(t, err)
+
+	_, err = ParseLockFile(".terraform.lock.hcl", []byte(`provider "registry.terraform.io/hashicorp/random" {}`))
+	assert.Error(t, err)
+}
+
+func TestSeeder_selectProviders(t *testing.T) {
+	upstream := &mockedUpstreamProvider{
+		customListProviderVersions: func(_ context.Context, _ *core.Provider) (*core.ProviderVersions, error) {
+			return &core.ProviderVersions{
+				Versions: []core.ProviderVersion{
+					{
+						Version: "3.5.1",
+						Platforms: []core.Platform{
+							{OS: "linux", Arch: "amd64"},
+						},
+					},
+					{
+						Version: "3.6.0",
+						Platforms: []core.Platform{
+							{OS: "linux", Arch: "amd64"},
+							{OS: "linux", Arch: "arm64"},
+							{OS: "darwin", Arch: "arm64"},
+						},
+					},
+				},
+			}, nil
+		},
+	}
+	storage := &mockedStorage{
+		listMirrorProviders: func(_ context.Context, _ *core.Provider) ([]*core.Provider, error) {
+			return []*core.Provider{
+				{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "3.6.0", OS: "linux", Arch: "arm64"},
+			}, nil
+		},
+	}
+	locked := LockedProvider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+
+	tests := []struct {
+		name      string
+		platforms []core.Platform
+		locked    LockedProvider
+		want      []string
+		wantErr   assert.ErrorAssertionFunc
+	}{
+		{
+			name:   "all platforms",
+			locked: locked,
+			want: []string{
+				"terraform-provider-random_3.6.0_linux_amd64.zip",
+				"terraform-provider-random_3.6.0_darwin_arm64.zip",
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name:      "configured platforms",
+			platforms: []core.Platform{{OS: "linux", Arch: "amd64"}, {OS: "linux", Arch: "arm64"}, {OS: "windows", Arch: "amd64"}},
+			locked:    locked,
+			want: []string{
+				"terraform-provider-random_3.6.0_linux_amd64.zip",
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name:   "version not found upstream",
+			locked: LockedProvider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "3.7.0"},
+			wantErr: func(t assert.TestingT, err error, _ ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrUpstreamNotFound)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Seeder{
+				platforms: tt.platforms,
+				upstream:  upstream,
+				storage:   storage,
+				logger:    slog.Default(),
+			}
+			providers, err := s.selectProviders(context.Background(), tt.locked)
+			if !tt.wantErr(t, err) {
+				return
+			}
+
+			var got []string
+			for _, p := range providers {
+				got = append(got, p.ArchiveFileName())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
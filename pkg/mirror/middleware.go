@@ -35,11 +35,11 @@ func (mw loggingMiddleware) ListProviderVersions(ctx context.Context, provider *
 		)
 
 		if err != nil {
-			logger.Error("failed to list provider versions", slog.String("err", err.Error()))
+			logger.ErrorContext(ctx, "failed to list provider versions", slog.String("err", err.Error()))
 			return
 		}
 
-		logger.Info("list provider version", slog.String("took", time.Since(begin).String()), slog.Bool("mirror", providerVersions.fromMirror()))
+		logger.InfoContext(ctx, "list provider version", slog.String("took", time.Since(begin).String()), slog.Bool("mirror", providerVersions.fromMirror()))
 	}(time.Now())
 
 	return mw.next.ListProviderVersions(ctx, provider)
@@ -57,11 +57,11 @@ func (mw loggingMiddleware) ListProviderInstallation(ctx context.Context, provid
 		)
 
 		if err != nil {
-			logger.Error("failed to list provider installation", slog.String("err", err.Error()))
+			logger.ErrorContext(ctx, "failed to list provider installation", slog.String("err", err.Error()))
 			return
 		}
 
-		logger.Info("list provider installation", slog.String("took", time.Since(begin).String()), slog.Bool("mirror", archives.fromMirror()))
+		logger.InfoContext(ctx, "list provider installation", slog.String("took", time.Since(begin).String()), slog.Bool("mirror", archives.fromMirror()))
 	}(time.Now())
 
 	return mw.next.ListProviderInstallation(ctx, provider)
@@ -82,11 +82,11 @@ func (mw loggingMiddleware) RetrieveProviderArchive(ctx context.Context, provide
 		)
 
 		if err != nil {
-			logger.Error("failed to retrieve provider archive", slog.String("err", err.Error()))
+			logger.ErrorContext(ctx, "failed to retrieve provider archive", slog.String("err", err.Error()))
 			return
 		}
 
-		logger.Info("retrieve provider archive", slog.String("took", time.Since(begin).String()), slog.Bool("mirror", response.fromMirror()))
+		logger.InfoContext(ctx, "retrieve provider archive", slog.String("took", time.Since(begin).String()), slog.Bool("mirror", response.fromMirror()))
 	}(time.Now())
 
 	return mw.next.RetrieveProviderArchive(ctx, provider)
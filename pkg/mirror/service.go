@@ -2,14 +2,19 @@ package mirror
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
 	"github.com/boring-registry/boring-registry/pkg/discovery"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
 )
 
 // Service implements the Provider Network Mirror Protocol.
@@ -29,6 +34,13 @@ type Service interface {
 
 type mirror struct {
 	storage Storage
+
+	// verifySignatures enables the verification of the mirrored SHA256SUMS signature before serving an archive
+	verifySignatures bool
+	// metrics counts the failed signature verifications, it's optional
+	metrics *o11y.MirrorMetrics
+	// copier backfills the missing h1: hashes, they're omitted without it
+	copier Copier
 }
 
 func (m *mirror) ListProviderVersions(ctx context.Context, provider *core.Provider) (*ListProviderVersionsResponse, error) {
@@ -57,7 +69,38 @@ func (m *mirror) ListProviderInstallation(ctx context.Context, provider *core.Pr
 	if err != nil {
 		return nil, err
 	}
-	return toListProviderInstallationResponse(providers, sha256Sums)
+	response, err := toListProviderInstallationResponse(providers, sha256Sums)
+	if err != nil {
+		return nil, err
+	}
+
+	// The h1: hashes complete the lock file entries, which Terraform creates from the response
+	for _, p := range providers {
+		h1, ok := m.h1Hash(ctx, p)
+		if !ok {
+			continue
+		}
+		key := fmt.Sprintf("%s_%s", p.OS, p.Arch)
+		archive := response.Archives[key]
+		archive.Hashes = append(archive.Hashes, h1)
+		response.Archives[key] = archive
+	}
+	return response, nil
+}
+
+// h1Hash returns the stored h1: hash of a mirrored archive.
+// Archives that were mirrored before the h1: hashes were stored are hashed in the background by the copier,
+// so that the response isn't delayed by downloading the archive. Until then, only the zh: hash is returned.
+func (m *mirror) h1Hash(ctx context.Context, provider *core.Provider) (string, bool) {
+	stored, err := m.storage.DownloadMirroredFile(ctx, provider, provider.H1HashFileName())
+	if err == nil && strings.HasPrefix(string(stored), core.HashSchemeH1) {
+		return string(stored), true
+	}
+
+	if m.copier != nil {
+		go m.copier.backfillH1(ctx, provider)
+	}
+	return "", false
 }
 
 func (m *mirror) RetrieveProviderArchive(ctx context.Context, provider *core.Provider) (*retrieveProviderArchiveResponse, error) {
@@ -66,53 +109,126 @@ func (m *mirror) RetrieveProviderArchive(ctx context.Context, provider *core.Pro
 		return nil, err
 	}
 
+	if m.verifySignatures {
+		if err := m.verifySha256Sums(ctx, mirrored); err != nil {
+			return nil, err
+		}
+	}
+
 	return &retrieveProviderArchiveResponse{
 		location:     mirrored.DownloadURL,
 		mirrorSource: mirrorSource{isMirror: true},
 	}, nil
 }
 
-func NewMirror(s Storage) Service {
+// verifySha256Sums verifies that the mirrored SHA256SUMS file was signed with one of the mirrored signing keys
+func (m *mirror) verifySha256Sums(ctx context.Context, provider *core.Provider) error {
+	sha256Sums, err := m.storage.DownloadMirroredFile(ctx, provider, provider.ShasumFileName())
+	if err != nil {
+		return fmt.Errorf("failed to download mirrored SHA256SUMS: %w", err)
+	}
+
+	signature, err := m.storage.DownloadMirroredFile(ctx, provider, provider.ShasumSignatureFileName())
+	if err != nil {
+		return fmt.Errorf("failed to download mirrored SHA256SUMS.sig: %w", err)
+	}
+
+	signingKeys, err := m.storage.MirroredSigningKeys(ctx, provider.Hostname, provider.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve mirrored signing keys: %w", err)
+	}
+
+	if err := signingKeys.IsValidSha256Sums(sha256Sums, signature); err != nil {
+		slog.ErrorContext(ctx, "mirrored SHA256SUMS isn't signed by any of the mirrored signing keys", logKeyValues(provider), slog.String("err", err.Error()))
+		if m.metrics != nil {
+			m.metrics.SignatureVerificationFailures.WithLabelValues(provider.Hostname, provider.Namespace, provider.Name).Inc()
+		}
+		return fmt.Errorf("%w for %s: %v", ErrInvalidSignature, provider.ShasumFileName(), err)
+	}
+	return nil
+}
+
+func NewMirror(s Storage, opts ...Option) Service {
+	o := newOptions(opts...)
 	return &mirror{
-		storage: s,
+		storage:          s,
+		verifySignatures: o.verifySignatures,
+		metrics:          o.metrics,
+		copier:           o.h1Backfill,
 	}
 }
 
+const (
+	defaultUpstreamRetries      = 2
+	defaultUpstreamRetryBackoff = 250 * time.Millisecond
+)
+
 type pullThroughMirror struct {
 	upstream upstreamProvider
 	mirror   Service
 	copier   Copier
+
+	// upstreamRetries is the number of retries for transient upstream errors
+	upstreamRetries int
+	// upstreamRetryBackoff is the delay before the first retry, which doubles with every further retry
+	upstreamRetryBackoff time.Duration
+
+	// metrics records whether the responses were served from upstream or from the mirror, it's optional
+	metrics *o11y.MirrorMetrics
+}
+
+// observeListing records the source of a listing, which is only served from the mirror if upstream couldn't serve it
+func (p *pullThroughMirror) observeListing(provider *core.Provider, source mirrorSource) {
+	if p.metrics == nil {
+		return
+	}
+	if source.fromMirror() {
+		p.metrics.UpstreamFallback.WithLabelValues(provider.Hostname).Inc()
+		return
+	}
+	p.metrics.UpstreamHit.WithLabelValues(provider.Hostname).Inc()
+}
+
+// observeArchive records the source of an archive, which is served from the mirror whenever it has been mirrored
+func (p *pullThroughMirror) observeArchive(provider *core.Provider, source mirrorSource) {
+	if p.metrics == nil {
+		return
+	}
+	if source.fromMirror() {
+		p.metrics.MirrorHit.WithLabelValues(provider.Hostname).Inc()
+		return
+	}
+	p.metrics.UpstreamHit.WithLabelValues(provider.Hostname).Inc()
 }
 
 func (p *pullThroughMirror) ListProviderVersions(ctx context.Context, provider *core.Provider) (*ListProviderVersionsResponse, error) {
-	upstreamCtx, cancelUpstreamCtx := context.WithTimeout(ctx, 10*time.Second)
-	defer cancelUpstreamCtx()
-	providerVersionsResponse, err := p.upstream.listProviderVersions(upstreamCtx, provider)
+	providerVersionsResponse, err := p.upstreamProviderVersions(ctx, provider)
 	if err == nil {
 		// The request to the upstream registry was successful, we can transform and return the response
-		return toListProviderVersionsResponse(providerVersionsResponse), nil
+		response := toListProviderVersionsResponse(providerVersionsResponse)
+		p.observeListing(provider, response.mirrorSource)
+		return response, nil
 	}
 
-	var urlError *url.Error
-	if isUrlError := errors.As(err, &urlError); !isUrlError {
-		// It's not a network-related error
+	if !isUpstreamUnavailable(err) {
+		// It's neither a network-related nor a transient error
 		return nil, err
 	}
 
 	// We try to return a response based on the mirror
-	return p.mirror.ListProviderVersions(ctx, provider)
+	response, err := p.mirror.ListProviderVersions(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	p.observeListing(provider, response.mirrorSource)
+	return response, nil
 }
 
 func (p *pullThroughMirror) ListProviderInstallation(ctx context.Context, provider *core.Provider) (*ListProviderInstallationResponse, error) {
-	upstreamCtx, cancelUpstreamCtx := context.WithTimeout(ctx, 10*time.Second)
-	defer cancelUpstreamCtx()
-	response, err := p.upstream.listProviderVersions(upstreamCtx, provider)
-	if err != nil {
-		var urlError *url.Error
-		if isUrlError := errors.As(err, &urlError); !isUrlError {
-			// It's not a network-related error, therefore we abort the attempt
-			return nil, err
-		}
+	response, err := p.upstreamProviderVersions(ctx, provider)
+	if err != nil && !isUpstreamUnavailable(err) {
+		// It's neither a network-related nor a transient error, therefore we abort the attempt
+		return nil, err
 	}
 
 	if err == nil && versionExists(provider.Version, response) {
@@ -125,18 +241,71 @@ func (p *pullThroughMirror) ListProviderInstallation(ctx context.Context, provid
 			if version.Version != provider.Version {
 				continue
 			}
-			return mergePlatforms(provider, version.Platforms, sha256Sums)
+			response, err := mergePlatforms(provider, version.Platforms, sha256Sums)
+			if err != nil {
+				return nil, err
+			}
+			p.mergeMirroredPlatforms(ctx, provider, response)
+			p.observeListing(provider, response.mirrorSource)
+			return response, nil
 		}
 	}
 
 	// Try to retrieve the information from the mirror
-	return p.mirror.ListProviderInstallation(ctx, provider)
+	mirrored, err := p.mirror.ListProviderInstallation(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	p.observeListing(provider, mirrored.mirrorSource)
+	return mirrored, nil
+}
+
+// mergeMirroredPlatforms resolves every platform of the upstream response independently from the mirror.
+// The platforms that are only mirrored, e.g. because they have been removed upstream, are added with their mirrored archive.
+// The upstream registry only returns the zh: hashes, the h1: hash of a mirrored archive is only added if it has the same zh: hash.
+func (p *pullThroughMirror) mergeMirroredPlatforms(ctx context.Context, provider *core.Provider, response *ListProviderInstallationResponse) {
+	mirrored, err := p.mirror.ListProviderInstallation(ctx, &core.Provider{
+		Hostname:  provider.Hostname,
+		Namespace: provider.Namespace,
+		Name:      provider.Name,
+		Version:   provider.Version,
+	})
+	if err != nil {
+		// Nothing has been mirrored for this version yet
+		return
+	}
+
+	for key, m := range mirrored.Archives {
+		archive, ok := response.Archives[key]
+		if !ok {
+			slog.Debug("serving a platform that isn't available upstream from the mirror",
+				slog.String("hostname", provider.Hostname),
+				slog.String("namespace", provider.Namespace),
+				slog.String("name", provider.Name),
+				slog.String("version", provider.Version),
+				slog.String("platform", key),
+			)
+			response.Archives[key] = m
+			continue
+		}
+
+		if !slices.ContainsFunc(archive.Hashes, func(h string) bool { return slices.Contains(m.Hashes, h) }) {
+			continue
+		}
+		for _, h := range m.Hashes {
+			if strings.HasPrefix(h, core.HashSchemeH1) {
+				archive.Hashes = append(archive.Hashes, h)
+			}
+		}
+		response.Archives[key] = archive
+	}
 }
 
 func (p *pullThroughMirror) RetrieveProviderArchive(ctx context.Context, provider *core.Provider) (*retrieveProviderArchiveResponse, error) {
 	// If it's in the cache, then redirect to storage
 	mirrored, err := p.mirror.RetrieveProviderArchive(ctx, provider)
 	if err == nil {
+		p.observeArchive(provider, mirrored.mirrorSource)
 		return mirrored, nil
 	}
 	var providerError *core.ProviderError
@@ -152,12 +321,32 @@ func (p *pullThroughMirror) RetrieveProviderArchive(ctx context.Context, provide
 	}
 
 	// Download the provider from upstream and upload to the mirror
-	go p.copier.copy(upstream)
+	go p.copier.copy(ctx, upstream)
 
-	return &retrieveProviderArchiveResponse{
+	response := &retrieveProviderArchiveResponse{
 		location:     upstream.DownloadURL,
 		mirrorSource: mirrorSource{isMirror: false},
-	}, nil
+	}
+	p.observeArchive(provider, response.mirrorSource)
+	return response, nil
+}
+
+// upstreamProviderVersions lists the provider versions from upstream and retries transient errors with an exponential backoff
+func (p *pullThroughMirror) upstreamProviderVersions(ctx context.Context, provider *core.Provider) (*core.ProviderVersions, error) {
+	for attempt := 0; ; attempt++ {
+		upstreamCtx, cancelUpstreamCtx := context.WithTimeout(ctx, 10*time.Second)
+		versions, err := p.upstream.listProviderVersions(upstreamCtx, provider)
+		cancelUpstreamCtx()
+		if err == nil || !errors.Is(err, ErrUpstreamUnavailable) || attempt >= p.upstreamRetries {
+			return versions, err
+		}
+
+		select {
+		case <-time.After(p.upstreamRetryBackoff << attempt):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
 }
 
 func (p *pullThroughMirror) upstreamSha256Sums(ctx context.Context, provider *core.Provider, versions *core.ProviderVersions) (*core.Sha256Sums, error) {
@@ -190,19 +379,126 @@ func (p *pullThroughMirror) upstreamSha256Sums(ctx context.Context, provider *co
 	return p.upstream.shaSums(ctx, providerUpstream)
 }
 
-func NewPullThroughMirror(s Storage, c Copier) Service {
-	remoteServiceDiscovery := discovery.NewRemoteServiceDiscovery(http.DefaultClient)
+type options struct {
+	upstreamRetries  int
+	verifySignatures bool
+	tlsConfig        *tls.Config
+	userAgent        string
+	metrics          *o11y.MirrorMetrics
+	h1Backfill       Copier
+}
+
+// Option provides additional options for the mirror, the pull-through mirror and the components copying from upstream
+type Option func(*options)
+
+// WithUpstreamRetries configures how often transient upstream errors are retried before falling back to the mirror.
+// This option only applies to the pull-through mirror
+func WithUpstreamRetries(retries int) Option {
+	return func(o *options) {
+		o.upstreamRetries = retries
+	}
+}
+
+// WithSignatureVerification configures whether the signature of the mirrored SHA256SUMS is verified before serving an archive
+func WithSignatureVerification(enabled bool) Option {
+	return func(o *options) {
+		o.verifySignatures = enabled
+	}
+}
+
+// WithUpstreamTLSConfig configures the TLS settings of the connections to the upstream registries,
+// e.g. to trust the certificates of a private CA
+func WithUpstreamTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithUserAgent configures the User-Agent header of the requests to the upstream registries
+func WithUserAgent(userAgent string) Option {
+	return func(o *options) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithMetrics configures the metrics of the mirror, which count the failed signature verifications
+// and, for the pull-through mirror, whether the responses were served from upstream or from the mirror
+func WithMetrics(metrics *o11y.MirrorMetrics) Option {
+	return func(o *options) {
+		o.metrics = metrics
+	}
+}
+
+// WithH1Backfill configures the copier that computes the missing h1: hashes of archives, which were mirrored before the h1: hashes were stored.
+// This option only applies to the mirror, the pull-through mirror backfills them with its own copier
+func WithH1Backfill(c Copier) Option {
+	return func(o *options) {
+		o.h1Backfill = c
+	}
+}
+
+// tlsTransport returns a clone of the default transport with the TLS settings of the upstream registries
+func (o *options) tlsTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.tlsConfig != nil {
+		transport.TLSClientConfig = o.tlsConfig.Clone()
+	}
+	return transport
+}
+
+// upstreamTransport returns the transport of the requests to the upstream registries, which sets the configured User-Agent
+func (o *options) upstreamTransport() http.RoundTripper {
+	return core.NewUserAgentTransport(o.tlsTransport(), o.userAgent)
+}
+
+// upstreamRegistry returns the client of the upstream registries, which discovers the services with the same transport settings
+func (o *options) upstreamRegistry() *upstreamProviderRegistry {
+	transport := o.tlsTransport()
+	transport.MaxIdleConnsPerHost = 100
+	return newUpstreamProviderRegistry(
+		discovery.NewRemoteServiceDiscovery(&http.Client{Transport: o.upstreamTransport()}),
+		core.NewUserAgentTransport(transport, o.userAgent),
+	)
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		upstreamRetries:  defaultUpstreamRetries,
+		verifySignatures: true,
+		userAgent:        core.DefaultUserAgent(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func NewPullThroughMirror(s Storage, c Copier, opts ...Option) Service {
+	o := newOptions(opts...)
 	svc := &pullThroughMirror{
-		upstream: newUpstreamProviderRegistry(remoteServiceDiscovery),
+		upstream: o.upstreamRegistry(),
 		mirror: &mirror{
-			storage: s,
+			storage:          s,
+			verifySignatures: o.verifySignatures,
+			metrics:          o.metrics,
+			copier:           c,
 		},
-		copier: c,
+		copier:               c,
+		upstreamRetries:      o.upstreamRetries,
+		upstreamRetryBackoff: defaultUpstreamRetryBackoff,
+		metrics:              o.metrics,
 	}
 
 	return svc
 }
 
+// isUpstreamUnavailable returns true for network-related errors and transient upstream errors,
+// in which case the response can be served from the mirror instead
+func isUpstreamUnavailable(err error) bool {
+	var urlError *url.Error
+	return errors.As(err, &urlError) || errors.Is(err, ErrUpstreamUnavailable)
+}
+
 func mergePlatforms(provider *core.Provider, platforms []core.Platform, sha256Sums *core.Sha256Sums) (*ListProviderInstallationResponse, error) {
 	archives := &ListProviderInstallationResponse{
 		Archives:     map[string]Archive{},
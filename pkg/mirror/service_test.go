@@ -1,22 +1,38 @@
 package mirror
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockedUpstreamProvider struct {
 	customListProviderVersions func(ctx context.Context, provider *core.Provider) (*core.ProviderVersions, error)
 	customGetProvider          func(ctx context.Context, provider *core.Provider) (*core.Provider, error)
 	customShaSums              func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error)
+	customVerifiedShaSums      func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error)
 }
 
 func (m *mockedUpstreamProvider) listProviderVersions(ctx context.Context, provider *core.Provider) (*core.ProviderVersions, error) {
@@ -31,10 +47,16 @@ func (m *mockedUpstreamProvider) shaSums(ctx context.Context, provider *core.Pro
 	return m.customShaSums(ctx, provider)
 }
 
+func (m *mockedUpstreamProvider) verifiedShaSums(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
+	return m.customVerifiedShaSums(ctx, provider)
+}
+
 type mockedStorage struct {
 	listMirrorProviders       func(ctx context.Context, provider *core.Provider) ([]*core.Provider, error)
+	listAllMirroredProviders  func(ctx context.Context) ([]*core.Provider, error)
 	getMirroredProvider       func(ctx context.Context, provider *core.Provider) (*core.Provider, error)
 	mirroredSha256Sum         func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error)
+	downloadMirroredFile      func(ctx context.Context, provider *core.Provider, fileName string) ([]byte, error)
 	uploadMirroredFile        func(ctx context.Context, provider *core.Provider, filename string, reader io.Reader) error
 	mirroredSigningKeys       func(ctx context.Context, hostname, namespace string) (*core.SigningKeys, error)
 	uploadMirroredSigningKeys func(ctx context.Context, hostname, namespace string, signingKeys *core.SigningKeys) error
@@ -44,6 +66,10 @@ func (m *mockedStorage) ListMirroredProviders(ctx context.Context, provider *cor
 	return m.listMirrorProviders(ctx, provider)
 }
 
+func (m *mockedStorage) ListAllMirroredProviders(ctx context.Context) ([]*core.Provider, error) {
+	return m.listAllMirroredProviders(ctx)
+}
+
 func (m *mockedStorage) GetMirroredProvider(ctx context.Context, provider *core.Provider) (*core.Provider, error) {
 	return m.getMirroredProvider(ctx, provider)
 }
@@ -52,6 +78,13 @@ func (m *mockedStorage) UploadMirroredFile(ctx context.Context, provider *core.P
 	return m.uploadMirroredFile(ctx, provider, fileName, reader)
 }
 
+func (m *mockedStorage) DownloadMirroredFile(ctx context.Context, provider *core.Provider, fileName string) ([]byte, error) {
+	if m.downloadMirroredFile == nil {
+		return nil, core.ErrObjectNotFound
+	}
+	return m.downloadMirroredFile(ctx, provider, fileName)
+}
+
 func (m *mockedStorage) MirroredSigningKeys(ctx context.Context, hostname, namespace string) (*core.SigningKeys, error) {
 	return m.mirroredSigningKeys(ctx, hostname, namespace)
 }
@@ -64,6 +97,17 @@ func (m *mockedStorage) MirroredSha256Sum(ctx context.Context, provider *core.Pr
 	return m.mirroredSha256Sum(ctx, provider)
 }
 
+// notMirrored returns a mirror that doesn't contain any providers
+func notMirrored() *mirror {
+	return &mirror{
+		storage: &mockedStorage{
+			listMirrorProviders: func(ctx context.Context, provider *core.Provider) ([]*core.Provider, error) {
+				return nil, core.ErrObjectNotFound
+			},
+		},
+	}
+}
+
 func Test_pullThroughMirror_ListProviderVersions(t *testing.T) {
 	type args struct {
 		ctx      context.Context
@@ -149,6 +193,85 @@ func Test_pullThroughMirror_ListProviderVersions(t *testing.T) {
 				mirrorSource: mirrorSource{isMirror: false},
 			},
 		},
+		{
+			name: "transient upstream errors are retried",
+			svc: func() Service {
+				attempts := 0
+				return &pullThroughMirror{
+					upstream: &mockedUpstreamProvider{
+						customListProviderVersions: func(ctx context.Context, provider *core.Provider) (*core.ProviderVersions, error) {
+							attempts++
+							if attempts <= 2 {
+								return nil, upstreamStatusError(http.StatusServiceUnavailable)
+							}
+							return &core.ProviderVersions{
+								Versions: []core.ProviderVersion{{Version: "0.1.2"}},
+							}, nil
+						},
+					},
+					mirror: &mirror{
+						storage: &mockedStorage{
+							listMirrorProviders: func(ctx context.Context, provider *core.Provider) ([]*core.Provider, error) {
+								return nil, errors.New("the mirror must not be queried")
+							},
+						},
+					},
+					upstreamRetries:      2,
+					upstreamRetryBackoff: time.Millisecond,
+				}
+			}(),
+			want: &ListProviderVersionsResponse{
+				Versions: map[string]EmptyObject{
+					"0.1.2": {},
+				},
+				mirrorSource: mirrorSource{isMirror: false},
+			},
+		},
+		{
+			name: "retries exhausted, response from mirror",
+			svc: &pullThroughMirror{
+				upstream: &mockedUpstreamProvider{
+					customListProviderVersions: func(ctx context.Context, provider *core.Provider) (*core.ProviderVersions, error) {
+						return nil, upstreamStatusError(http.StatusBadGateway)
+					},
+				},
+				mirror: &mirror{
+					storage: &mockedStorage{
+						listMirrorProviders: func(ctx context.Context, provider *core.Provider) ([]*core.Provider, error) {
+							return []*core.Provider{{Namespace: "hashicorp", Name: "random", Version: "1.2.3", OS: "linux", Arch: "amd64"}}, nil
+						},
+					},
+				},
+				upstreamRetries:      2,
+				upstreamRetryBackoff: time.Millisecond,
+			},
+			want: &ListProviderVersionsResponse{
+				Versions: map[string]EmptyObject{
+					"1.2.3": {},
+				},
+				mirrorSource: mirrorSource{isMirror: true},
+			},
+		},
+		{
+			name: "permanent upstream error is not retried",
+			svc: func() Service {
+				attempts := 0
+				return &pullThroughMirror{
+					upstream: &mockedUpstreamProvider{
+						customListProviderVersions: func(ctx context.Context, provider *core.Provider) (*core.ProviderVersions, error) {
+							attempts++
+							if attempts > 1 {
+								return &core.ProviderVersions{}, nil
+							}
+							return nil, upstreamStatusError(http.StatusNotFound)
+						},
+					},
+					upstreamRetries:      2,
+					upstreamRetryBackoff: time.Millisecond,
+				}
+			}(),
+			wantErr: true,
+		},
 		{
 			name: "upstream unavailable, response from mirror",
 			svc: &pullThroughMirror{
@@ -264,6 +387,7 @@ func Test_pullThroughMirror_ListProviderInstallation(t *testing.T) {
 			// This test case replicates the condition under which this bug occurred:
 			// https://github.com/boring-registry/boring-registry/pull/143#discussion_r1335798065
 			svc: &pullThroughMirror{
+				mirror: notMirrored(),
 				upstream: &mockedUpstreamProvider{
 					customListProviderVersions: func(ctx context.Context, provider *core.Provider) (*core.ProviderVersions, error) {
 						return &core.ProviderVersions{
@@ -429,6 +553,7 @@ func Test_pullThroughMirror_ListProviderInstallation(t *testing.T) {
 		{
 			name: "successfully retrieve response from upstream",
 			svc: &pullThroughMirror{
+				mirror: notMirrored(),
 				upstream: &mockedUpstreamProvider{
 					customListProviderVersions: func(ctx context.Context, provider *core.Provider) (*core.ProviderVersions, error) {
 						return &core.ProviderVersions{
@@ -501,6 +626,75 @@ func Test_pullThroughMirror_ListProviderInstallation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "version split across upstream and mirror per platform",
+			svc: &pullThroughMirror{
+				upstream: &mockedUpstreamProvider{
+					customListProviderVersions: func(ctx context.Context, provider *core.Provider) (*core.ProviderVersions, error) {
+						return &core.ProviderVersions{
+							Versions: []core.ProviderVersion{
+								{Version: "2.0.0", Platforms: []core.Platform{{OS: "linux", Arch: "amd64"}}},
+							},
+						}, nil
+					},
+					customGetProvider: func(ctx context.Context, provider *core.Provider) (*core.Provider, error) {
+						return provider, nil
+					},
+					customShaSums: func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
+						return &core.Sha256Sums{
+							Entries: map[string][]byte{
+								"terraform-provider-random_2.0.0_linux_amd64.zip": []byte("123456789"),
+							},
+						}, nil
+					},
+				},
+				mirror: &mirror{
+					storage: &mockedStorage{
+						listMirrorProviders: func(ctx context.Context, provider *core.Provider) ([]*core.Provider, error) {
+							return []*core.Provider{
+								{
+									Namespace:   "hashicorp",
+									Name:        "random",
+									Version:     "2.0.0",
+									OS:          "linux",
+									Arch:        "arm64",
+									DownloadURL: "https://terraform.example.com/pre-signed-url",
+								},
+							}, nil
+						},
+						mirroredSha256Sum: func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
+							return &core.Sha256Sums{
+								Entries: map[string][]byte{
+									"terraform-provider-random_2.0.0_linux_arm64.zip": []byte("987654321"),
+								},
+							}, nil
+						},
+					},
+				},
+			},
+			args: args{
+				ctx: context.Background(),
+				provider: &core.Provider{
+					Hostname:  "registry.example.com",
+					Namespace: "hashicorp",
+					Name:      "random",
+					Version:   "2.0.0",
+				},
+			},
+			want: &ListProviderInstallationResponse{
+				Archives: map[string]Archive{
+					"linux_amd64": {
+						Url:    "terraform-provider-random_2.0.0_linux_amd64.zip",
+						Hashes: []string{fmt.Sprintf("zh:%x", []byte("123456789"))},
+					},
+					"linux_arm64": {
+						Url:    "https://terraform.example.com/pre-signed-url",
+						Hashes: []string{fmt.Sprintf("zh:%x", []byte("987654321"))},
+					},
+				},
+				mirrorSource: mirrorSource{isMirror: false},
+			},
+		},
 		{
 			name: "upstream fails but mirror succeeds",
 			svc: &pullThroughMirror{
@@ -685,3 +879,324 @@ func Test_pullThroughCache_RetrieveProviderArchive(t *testing.T) {
 		})
 	}
 }
+
+// signedSha256Sums returns the signing keys of a newly generated key pair and the detached signature of sha256Sums
+func testMirrorMetrics() *o11y.MirrorMetrics {
+	labels := []string{o11y.HostnameLabel}
+	return &o11y.MirrorMetrics{
+		UpstreamHit:      prometheus.NewCounterVec(prometheus.CounterOpts{Name: "upstream_hit_total"}, labels),
+		MirrorHit:        prometheus.NewCounterVec(prometheus.CounterOpts{Name: "mirror_hit_total"}, labels),
+		UpstreamFallback: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "upstream_fallback_total"}, labels),
+		SignatureVerificationFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{Name: "provider_signature_verification_failures_total"},
+			[]string{o11y.HostnameLabel, o11y.NamespaceLabel, o11y.NameLabel},
+		),
+	}
+}
+
+func Test_pullThroughMirror_metrics(t *testing.T) {
+	provider := &core.Provider{
+		Hostname:  "registry.terraform.io",
+		Namespace: "hashicorp",
+		Name:      "random",
+		Version:   "2.0.0",
+		OS:        "linux",
+		Arch:      "amd64",
+	}
+	mirrored := &mirror{
+		storage: &mockedStorage{
+			listMirrorProviders: func(_ context.Context, _ *core.Provider) ([]*core.Provider, error) {
+				return []*core.Provider{provider.Clone()}, nil
+			},
+			getMirroredProvider: func(_ context.Context, p *core.Provider) (*core.Provider, error) {
+				return p, nil
+			},
+		},
+	}
+	upstreamAvailable := &mockedUpstreamProvider{
+		customListProviderVersions: func(_ context.Context, _ *core.Provider) (*core.ProviderVersions, error) {
+			return &core.ProviderVersions{Versions: []core.ProviderVersion{{Version: "2.0.0"}}}, nil
+		},
+		customGetProvider: func(_ context.Context, p *core.Provider) (*core.Provider, error) {
+			return p.Clone(), nil
+		},
+	}
+	upstreamUnavailable := &mockedUpstreamProvider{
+		customListProviderVersions: func(_ context.Context, _ *core.Provider) (*core.ProviderVersions, error) {
+			return nil, &url.Error{}
+		},
+	}
+	copier := &mockedCopier{release: make(chan struct{})}
+	close(copier.release)
+
+	tests := []struct {
+		name         string
+		svc          *pullThroughMirror
+		call         func(svc Service) error
+		wantUpstream float64
+		wantMirror   float64
+		wantFallback float64
+	}{
+		{
+			name: "upstream success",
+			svc:  &pullThroughMirror{upstream: upstreamAvailable, mirror: mirrored},
+			call: func(svc Service) error {
+				_, err := svc.ListProviderVersions(context.Background(), provider)
+				return err
+			},
+			wantUpstream: 1,
+		},
+		{
+			name: "mirror fallback",
+			svc:  &pullThroughMirror{upstream: upstreamUnavailable, mirror: mirrored},
+			call: func(svc Service) error {
+				_, err := svc.ListProviderVersions(context.Background(), provider)
+				return err
+			},
+			wantFallback: 1,
+		},
+		{
+			name: "archive served from the mirror",
+			svc:  &pullThroughMirror{upstream: upstreamAvailable, mirror: mirrored},
+			call: func(svc Service) error {
+				_, err := svc.RetrieveProviderArchive(context.Background(), provider.Clone())
+				return err
+			},
+			wantMirror: 1,
+		},
+		{
+			name: "archive served from upstream",
+			svc: &pullThroughMirror{
+				upstream: upstreamAvailable,
+				mirror: &mirror{
+					storage: &mockedStorage{
+						getMirroredProvider: func(_ context.Context, _ *core.Provider) (*core.Provider, error) {
+							return nil, &core.ProviderError{}
+						},
+					},
+				},
+				copier: copier,
+			},
+			call: func(svc Service) error {
+				_, err := svc.RetrieveProviderArchive(context.Background(), provider.Clone())
+				return err
+			},
+			wantUpstream: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := testMirrorMetrics()
+			tt.svc.metrics = metrics
+
+			require.NoError(t, tt.call(tt.svc))
+			assert.Equal(t, tt.wantUpstream, testutil.ToFloat64(metrics.UpstreamHit.WithLabelValues(provider.Hostname)))
+			assert.Equal(t, tt.wantMirror, testutil.ToFloat64(metrics.MirrorHit.WithLabelValues(provider.Hostname)))
+			assert.Equal(t, tt.wantFallback, testutil.ToFloat64(metrics.UpstreamFallback.WithLabelValues(provider.Hostname)))
+		})
+	}
+}
+
+func signedSha256Sums(t *testing.T, sha256Sums []byte) (*core.SigningKeys, []byte) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("boring-registry", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var publicKey bytes.Buffer
+	w, err := armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	var signature bytes.Buffer
+	if err := openpgp.DetachSign(&signature, entity, bytes.NewReader(sha256Sums), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return &core.SigningKeys{
+		GPGPublicKeys: []core.GPGPublicKey{{KeyID: entity.PrimaryKey.KeyIdString(), ASCIIArmor: publicKey.String()}},
+	}, signature.Bytes()
+}
+
+func Test_mirror_RetrieveProviderArchive_verifySignatures(t *testing.T) {
+	sha256Sums := []byte("1111111111111111111111111111111111111111111111111111111111111111  terraform-provider-random_2.0.0_linux_amd64.zip\n")
+	signingKeys, signature := signedSha256Sums(t, sha256Sums)
+
+	tests := []struct {
+		name         string
+		sha256Sums   []byte
+		wantErr      error
+		wantFailures float64
+	}{
+		{
+			name:       "valid signature",
+			sha256Sums: sha256Sums,
+		},
+		{
+			name:         "tampered SHA256SUMS",
+			sha256Sums:   []byte("2222222222222222222222222222222222222222222222222222222222222222  terraform-provider-random_2.0.0_linux_amd64.zip\n"),
+			wantErr:      ErrInvalidSignature,
+			wantFailures: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := testMirrorMetrics()
+			m := &mirror{
+				verifySignatures: true,
+				metrics:          metrics,
+				storage: &mockedStorage{
+					getMirroredProvider: func(ctx context.Context, provider *core.Provider) (*core.Provider, error) {
+						provider.DownloadURL = provider.ArchiveFileName()
+						return provider, nil
+					},
+					downloadMirroredFile: func(ctx context.Context, provider *core.Provider, fileName string) ([]byte, error) {
+						if fileName == provider.ShasumSignatureFileName() {
+							return signature, nil
+						}
+						return tt.sha256Sums, nil
+					},
+					mirroredSigningKeys: func(ctx context.Context, hostname, namespace string) (*core.SigningKeys, error) {
+						return signingKeys, nil
+					},
+				},
+			}
+
+			provider := &core.Provider{
+				Hostname:  "terraform.example.com",
+				Namespace: "hashicorp",
+				Name:      "random",
+				Version:   "2.0.0",
+				OS:        "linux",
+				Arch:      "amd64",
+			}
+			got, err := m.RetrieveProviderArchive(context.Background(), provider)
+			assert.Equal(t, tt.wantFailures, testutil.ToFloat64(metrics.SignatureVerificationFailures.WithLabelValues(provider.Hostname, provider.Namespace, provider.Name)))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "terraform-provider-random_2.0.0_linux_amd64.zip", got.location)
+		})
+	}
+}
+
+func testZipArchive(t *testing.T) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	fw, err := w.Create("terraform-provider-random_v2.0.0")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("binary"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func Test_mirror_ListProviderInstallation_hashes(t *testing.T) {
+	archive := testZipArchive(t)
+	h1, err := core.HashH1(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+	zh, err := core.HashZh(bytes.NewReader(archive))
+	require.NoError(t, err)
+	checksum, err := hex.DecodeString(strings.TrimPrefix(zh, core.HashSchemeZh))
+	require.NoError(t, err)
+
+	provider := &core.Provider{Hostname: "registry.example.com", Namespace: "hashicorp", Name: "random", Version: "2.0.0"}
+	var mu sync.Mutex
+	newStorage := func(files map[string][]byte) *mockedStorage {
+		return &mockedStorage{
+			listMirrorProviders: func(ctx context.Context, provider *core.Provider) ([]*core.Provider, error) {
+				return []*core.Provider{
+					{Hostname: "registry.example.com", Namespace: "hashicorp", Name: "random", Version: "2.0.0", OS: "linux", Arch: "amd64", DownloadURL: "https://storage.example.com/archive.zip"},
+				}, nil
+			},
+			mirroredSha256Sum: func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
+				return &core.Sha256Sums{Entries: map[string][]byte{"terraform-provider-random_2.0.0_linux_amd64.zip": checksum}}, nil
+			},
+			downloadMirroredFile: func(ctx context.Context, provider *core.Provider, fileName string) ([]byte, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if b, ok := files[fileName]; ok {
+					return b, nil
+				}
+				return nil, core.ErrObjectNotFound
+			},
+			uploadMirroredFile: func(ctx context.Context, provider *core.Provider, fileName string, reader io.Reader) error {
+				b, err := io.ReadAll(reader)
+				mu.Lock()
+				defer mu.Unlock()
+				files[fileName] = b
+				return err
+			},
+		}
+	}
+
+	t.Run("stored h1 hash", func(t *testing.T) {
+		m := &mirror{storage: newStorage(map[string][]byte{"terraform-provider-random_2.0.0_linux_amd64.zip.h1": []byte(h1)})}
+		got, err := m.ListProviderInstallation(context.Background(), provider.Clone())
+		require.NoError(t, err)
+		assert.Equal(t, []string{zh, h1}, got.Archives["linux_amd64"].Hashes)
+	})
+
+	t.Run("h1 hash is backfilled in the background", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		storage := newStorage(map[string][]byte{"terraform-provider-random_2.0.0_linux_amd64.zip": archive})
+		m := &mirror{storage: storage, copier: NewCopier(ctx, storage)}
+
+		// The response isn't delayed by hashing the archive
+		got, err := m.ListProviderInstallation(ctx, provider.Clone())
+		require.NoError(t, err)
+		assert.Contains(t, got.Archives["linux_amd64"].Hashes, zh)
+
+		assert.Eventually(t, func() bool {
+			got, err := m.ListProviderInstallation(ctx, provider.Clone())
+			return err == nil && slices.Equal([]string{zh, h1}, got.Archives["linux_amd64"].Hashes)
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("h1 hash is omitted without copier", func(t *testing.T) {
+		m := &mirror{storage: newStorage(map[string][]byte{"terraform-provider-random_2.0.0_linux_amd64.zip": archive})}
+		got, err := m.ListProviderInstallation(context.Background(), provider.Clone())
+		require.NoError(t, err)
+		assert.Equal(t, []string{zh}, got.Archives["linux_amd64"].Hashes)
+	})
+
+	t.Run("upstream response with mirrored h1 hash", func(t *testing.T) {
+		p := &pullThroughMirror{
+			upstream: &mockedUpstreamProvider{
+				customListProviderVersions: func(ctx context.Context, provider *core.Provider) (*core.ProviderVersions, error) {
+					return &core.ProviderVersions{
+						Versions: []core.ProviderVersion{
+							{Version: "2.0.0", Platforms: []core.Platform{{OS: "linux", Arch: "amd64"}, {OS: "darwin", Arch: "arm64"}}},
+						},
+					}, nil
+				},
+				customGetProvider: func(ctx context.Context, provider *core.Provider) (*core.Provider, error) {
+					return provider, nil
+				},
+				customShaSums: func(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
+					return &core.Sha256Sums{Entries: map[string][]byte{
+						"terraform-provider-random_2.0.0_linux_amd64.zip":  checksum,
+						"terraform-provider-random_2.0.0_darwin_arm64.zip": []byte("123456789"),
+					}}, nil
+				},
+			},
+			mirror: &mirror{storage: newStorage(map[string][]byte{"terraform-provider-random_2.0.0_linux_amd64.zip.h1": []byte(h1)})},
+		}
+		got, err := p.ListProviderInstallation(context.Background(), provider.Clone())
+		require.NoError(t, err)
+		assert.Equal(t, []string{zh, h1}, got.Archives["linux_amd64"].Hashes)
+		assert.Equal(t, []string{fmt.Sprintf("zh:%x", []byte("123456789"))}, got.Archives["darwin_arm64"].Hashes)
+	})
+}
@@ -12,12 +12,19 @@ type Storage interface {
 	// The provider version can be set to narrow-down the search and return only a single provider
 	ListMirroredProviders(ctx context.Context, provider *core.Provider) ([]*core.Provider, error)
 
+	// ListAllMirroredProviders returns the mirrored providers across all hostnames and namespaces.
+	// The returned providers don't have a DownloadURL set
+	ListAllMirroredProviders(ctx context.Context) ([]*core.Provider, error)
+
 	// GetMirroredProvider returns the mirrored provider or a core.ProviderError in case it cannot be located
 	GetMirroredProvider(ctx context.Context, provider *core.Provider) (*core.Provider, error)
 
 	// UploadMirroredFile uploads a file that belongs to a provider release
 	UploadMirroredFile(ctx context.Context, provider *core.Provider, fileName string, reader io.Reader) error
 
+	// DownloadMirroredFile downloads a file that belongs to a provider release
+	DownloadMirroredFile(ctx context.Context, provider *core.Provider, fileName string) ([]byte, error)
+
 	// MirroredSigningKeys retrieves the signing keys for mirrored providers
 	MirroredSigningKeys(ctx context.Context, hostname, namespace string) (*core.SigningKeys, error)
 
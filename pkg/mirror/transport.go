@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/boring-registry/boring-registry/pkg/auth"
 	"github.com/boring-registry/boring-registry/pkg/core"
 	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+	"github.com/boring-registry/boring-registry/pkg/openapi"
 
 	"github.com/go-kit/kit/auth/jwt"
 	"github.com/go-kit/kit/endpoint"
@@ -29,19 +31,20 @@ const (
 )
 
 // MakeHandler returns a fully initialized http.Handler.
-func MakeHandler(svc Service, auth endpoint.Middleware, metrics *o11y.MirrorMetrics, instrumentation o11y.Middleware, options ...httptransport.ServerOption) http.Handler {
+func MakeHandler(svc Service, authMiddleware endpoint.Middleware, metrics *o11y.MirrorMetrics, instrumentation o11y.Middleware, options ...httptransport.ServerOption) http.Handler {
 	r := mux.NewRouter().StrictSlash(true)
 
 	r.Methods("GET").Path(`/{hostname}/{namespace}/{name}/index.json`).Handler(
 		instrumentation.WrapHandler(
 			httptransport.NewServer(
-				auth(listProviderVersionsEndpoint(svc, metrics)),
+				authMiddleware(listProviderVersionsEndpoint(svc, metrics)),
 				decodeListVersionsRequest,
 				httptransport.EncodeJSONResponse,
 				append(
 					options,
 					httptransport.ServerBefore(extractMuxVars(varHostname, varNamespace, varName)),
 					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
 				)...,
 			),
 		),
@@ -50,13 +53,14 @@ func MakeHandler(svc Service, auth endpoint.Middleware, metrics *o11y.MirrorMetr
 	r.Methods("GET").Path(`/{hostname}/{namespace}/{name}/{version}.json`).Handler(
 		instrumentation.WrapHandler(
 			httptransport.NewServer(
-				auth(listProviderInstallationEndpoint(svc, metrics)),
+				authMiddleware(listProviderInstallationEndpoint(svc, metrics)),
 				decodeListInstallationRequest,
 				addAuthToken,
 				append(
 					options,
 					httptransport.ServerBefore(extractMuxVars(varHostname, varNamespace, varName, varVersion)),
 					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
 				)...,
 			),
 		),
@@ -66,13 +70,59 @@ func MakeHandler(svc Service, auth endpoint.Middleware, metrics *o11y.MirrorMetr
 	r.Methods("GET").Path(`/{hostname}/{namespace}/{name}/terraform-provider-{nameplaceholder}_{version}_{os}_{architecture}.zip`).Handler(
 		instrumentation.WrapHandler(
 			httptransport.NewServer(
-				auth(retrieveProviderArchiveEndpoint(svc, metrics)),
+				authMiddleware(retrieveProviderArchiveEndpoint(svc, metrics)),
 				decodeRetrieveProviderArchiveRequest,
 				encodeMirroredResponse,
 				append(
 					options,
 					httptransport.ServerBefore(extractMuxVars(varHostname, varNamespace, varName, varVersion, varOS, varArchitecture)),
 					httptransport.ServerBefore(tokenQueryParamToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
+				)...,
+			),
+		),
+	)
+	return r
+}
+
+// CopyRoutes describes the endpoints of MakeCopyHandler for the OpenAPI document
+var CopyRoutes = []openapi.Route{
+	{
+		Method:  http.MethodPost,
+		Path:    "/{hostname}/{namespace}/{name}/{version}",
+		Summary: "Copy a provider version from upstream into the pull-through mirror",
+		Parameters: []openapi.Parameter{
+			openapi.PathParameter("hostname", "The hostname of the upstream registry"),
+			openapi.PathParameter("namespace", "The namespace of the provider"),
+			openapi.PathParameter("name", "The name of the provider"),
+			openapi.PathParameter("version", "The version of the provider"),
+		},
+		Responses: map[int]string{
+			http.StatusOK:         "The copied files",
+			http.StatusForbidden:  "The token has the read scope",
+			http.StatusBadGateway: "Some of the platforms couldn't be copied, the copied files are listed with the errors",
+			http.StatusNotFound:   "The provider version doesn't exist upstream",
+		},
+		Authenticated: true,
+	},
+}
+
+// MakeCopyHandler returns an http.Handler, which copies provider versions from upstream into the mirror on request.
+// The copy is synchronous and responds with the copied files once all platforms have been copied.
+func MakeCopyHandler(seeder *Seeder, authMiddleware endpoint.Middleware, instrumentation o11y.Middleware, options ...httptransport.ServerOption) http.Handler {
+	r := mux.NewRouter().StrictSlash(true)
+
+	r.Methods("POST").Path(`/{hostname}/{namespace}/{name}/{version}`).Handler(
+		instrumentation.WrapHandler(
+			httptransport.NewServer(
+				authMiddleware(copyProviderVersionEndpoint(seeder)),
+				decodeCopyProviderVersionRequest,
+				httptransport.EncodeJSONResponse,
+				append(
+					options,
+					httptransport.ServerBefore(extractMuxVars(varHostname, varNamespace, varName, varVersion)),
+					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
 				)...,
 			),
 		),
@@ -127,6 +177,25 @@ func decodeListInstallationRequest(ctx context.Context, _ *http.Request) (interf
 	}, nil
 }
 
+func decodeCopyProviderVersionRequest(ctx context.Context, _ *http.Request) (interface{}, error) {
+	hostname, namespace, name, err := pathPortions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	version, ok := ctx.Value(varVersion).(string)
+	if !ok {
+		return nil, fmt.Errorf("%s path portion missing", string(varVersion))
+	}
+
+	return copyProviderVersionRequest{
+		Hostname:  hostname,
+		Namespace: namespace,
+		Name:      name,
+		Version:   version,
+	}, nil
+}
+
 func decodeRetrieveProviderArchiveRequest(ctx context.Context, _ *http.Request) (interface{}, error) {
 	hostname, namespace, name, err := pathPortions(ctx)
 	if err != nil {
@@ -215,16 +284,11 @@ func encodeMirroredResponse(ctx context.Context, w http.ResponseWriter, response
 
 // ErrorEncoder translates domain specific errors to HTTP status codes
 func ErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
-	var providerErr *core.ProviderError
-	if errors.As(err, &providerErr) {
-		w.WriteHeader(providerErr.StatusCode)
-	} else if errors.Is(err, ErrUpstreamNotFound) {
-		w.WriteHeader(http.StatusNotFound)
-	} else {
-		w.WriteHeader(core.GenericError(err))
-	}
-
-	core.HandleErrorResponse(err, w)
+	core.EncodeError(err, w,
+		core.ErrorStatus{Err: ErrUpstreamNotFound, StatusCode: http.StatusNotFound},
+		core.ErrorStatus{Err: ErrUpstreamUnavailable, StatusCode: http.StatusBadGateway},
+		core.ErrorStatus{Err: ErrHashMismatch, StatusCode: http.StatusBadGateway},
+	)
 }
 
 func extractMuxVars(keys ...muxVar) httptransport.RequestFunc {
@@ -240,8 +304,8 @@ func extractMuxVars(keys ...muxVar) httptransport.RequestFunc {
 }
 
 func decodeUpstreamProviderResponse(r *http.Response) (*core.Provider, error) {
-	if r.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%w: status code is %d instead of 200", ErrUpstreamNotFound, r.StatusCode)
+	if err := upstreamStatusError(r.StatusCode); err != nil {
+		return nil, err
 	}
 
 	var response core.Provider
@@ -252,8 +316,8 @@ func decodeUpstreamProviderResponse(r *http.Response) (*core.Provider, error) {
 }
 
 func decodeUpstreamListProviderVersionsResponse(r *http.Response) (*core.ProviderVersions, error) {
-	if r.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%w: status code is %d instead of 200", ErrUpstreamNotFound, r.StatusCode)
+	if err := upstreamStatusError(r.StatusCode); err != nil {
+		return nil, err
 	}
 
 	var response core.ProviderVersions
@@ -262,3 +326,15 @@ func decodeUpstreamListProviderVersionsResponse(r *http.Response) (*core.Provide
 	}
 	return &response, nil
 }
+
+// upstreamStatusError classifies unsuccessful upstream responses into transient errors that can be retried and permanent errors
+func upstreamStatusError(statusCode int) error {
+	switch statusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Errorf("%w: status code is %d instead of 200", ErrUpstreamUnavailable, statusCode)
+	default:
+		return fmt.Errorf("%w: status code is %d instead of 200", ErrUpstreamNotFound, statusCode)
+	}
+}
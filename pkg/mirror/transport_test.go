@@ -0,0 +1,188 @@
+package mirror
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorEncoder(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+	}{
+		{err: ErrUpstreamNotFound, wantStatus: http.StatusNotFound},
+		{err: ErrUpstreamUnavailable, wantStatus: http.StatusBadGateway},
+		{err: &core.ProviderError{Reason: "failed to locate provider", Provider: &core.Provider{Name: "random"}, StatusCode: http.StatusNotFound}, wantStatus: http.StatusNotFound},
+		{err: core.ErrTooManyRequests, wantStatus: http.StatusTooManyRequests},
+		{err: ErrInvalidSignature, wantStatus: http.StatusInternalServerError},
+		{err: ErrHashMismatch, wantStatus: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ErrorEncoder(context.Background(), fmt.Errorf("wrapped: %w", tt.err), rec)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+type noopInstrumentation struct{}
+
+func (noopInstrumentation) WrapHandler(handler http.Handler) http.HandlerFunc {
+	return handler.ServeHTTP
+}
+
+func TestMakeCopyHandler(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	w, err := zw.Create("terraform-provider-random_v3.6.0")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("binary"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	checksum := sha256.Sum256(archive.Bytes())
+
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, ".zip"):
+			_, _ = w.Write(archive.Bytes())
+		default:
+			_, _ = w.Write([]byte(r.URL.Path))
+		}
+	}))
+	defer upstreamServer.Close()
+
+	upstream := &mockedUpstreamProvider{
+		customListProviderVersions: func(_ context.Context, _ *core.Provider) (*core.ProviderVersions, error) {
+			return &core.ProviderVersions{
+				Versions: []core.ProviderVersion{
+					{Version: "3.6.0", Platforms: []core.Platform{{OS: "linux", Arch: "amd64"}, {OS: "darwin", Arch: "arm64"}, {OS: "windows", Arch: "amd64"}}},
+				},
+			}, nil
+		},
+		customGetProvider: func(_ context.Context, p *core.Provider) (*core.Provider, error) {
+			u := p.Clone()
+			u.DownloadURL = upstreamServer.URL + "/" + p.ArchiveFileName()
+			u.SHASumsURL = upstreamServer.URL + "/" + p.ShasumFileName()
+			u.SHASumsSignatureURL = upstreamServer.URL + "/" + p.ShasumSignatureFileName()
+			u.Shasum = hex.EncodeToString(checksum[:])
+			return u, nil
+		},
+	}
+
+	var uploaded []string
+	storage := &mockedStorage{
+		listMirrorProviders: func(_ context.Context, _ *core.Provider) ([]*core.Provider, error) {
+			return []*core.Provider{
+				{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "3.6.0", OS: "windows", Arch: "amd64"},
+			}, nil
+		},
+		mirroredSigningKeys: func(_ context.Context, _, _ string) (*core.SigningKeys, error) {
+			return &core.SigningKeys{}, nil
+		},
+		uploadMirroredFile: func(_ context.Context, _ *core.Provider, fileName string, reader io.Reader) error {
+			_, err := io.Copy(io.Discard, reader)
+			uploaded = append(uploaded, fileName)
+			return err
+		},
+	}
+
+	seeder := &Seeder{
+		upstream: upstream,
+		storage:  storage,
+		copier: &copier{
+			done:    make(chan struct{}),
+			storage: storage,
+			client:  upstreamServer.Client(),
+			logger:  slog.Default(),
+		},
+		logger: slog.Default(),
+	}
+	passthrough := func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	handler := MakeCopyHandler(seeder, passthrough, noopInstrumentation{}, httptransport.ServerErrorEncoder(ErrorEncoder))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/registry.terraform.io/hashicorp/random/3.6.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var result CopyResult
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	wantFiles := []string{
+		"terraform-provider-random_3.6.0_SHA256SUMS",
+		"terraform-provider-random_3.6.0_SHA256SUMS.sig",
+		"terraform-provider-random_3.6.0_linux_amd64.zip",
+		"terraform-provider-random_3.6.0_linux_amd64.zip.h1",
+		"terraform-provider-random_3.6.0_darwin_arm64.zip",
+		"terraform-provider-random_3.6.0_darwin_arm64.zip.h1",
+	}
+	assert.Equal(t, CopyResult{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "3.6.0", Files: wantFiles}, result)
+	// The already mirrored windows archive isn't copied again, the metadata is uploaded for every platform
+	assert.ElementsMatch(t, append(wantFiles, "terraform-provider-random_3.6.0_SHA256SUMS", "terraform-provider-random_3.6.0_SHA256SUMS.sig"), uploaded)
+
+	t.Run("version not found upstream", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/registry.terraform.io/hashicorp/random/9.9.9", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("partial copy", func(t *testing.T) {
+		uploaded = nil
+		defer func(listMirrorProviders func(context.Context, *core.Provider) ([]*core.Provider, error)) {
+			storage.listMirrorProviders = listMirrorProviders
+		}(storage.listMirrorProviders)
+		storage.listMirrorProviders = func(_ context.Context, p *core.Provider) ([]*core.Provider, error) {
+			return nil, &core.ProviderError{Reason: "not mirrored", Provider: p, StatusCode: http.StatusNotFound}
+		}
+		defer func(getProvider func(context.Context, *core.Provider) (*core.Provider, error)) {
+			upstream.customGetProvider = getProvider
+		}(upstream.customGetProvider)
+		getProvider := upstream.customGetProvider
+		upstream.customGetProvider = func(ctx context.Context, p *core.Provider) (*core.Provider, error) {
+			if p.OS == "windows" {
+				return nil, &core.ProviderError{Reason: "upstream failed", Provider: p, StatusCode: http.StatusBadGateway}
+			}
+			return getProvider(ctx, p)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/registry.terraform.io/hashicorp/random/3.6.0", nil))
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+
+		var result CopyResult
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+		assert.Equal(t, wantFiles, result.Files)
+		require.Len(t, result.Errors, 1)
+		assert.Contains(t, result.Errors[0], "terraform-provider-random_3.6.0_windows_amd64.zip")
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		checksum = sha256.Sum256([]byte("something else"))
+		uploaded = nil
+		storage.listMirrorProviders = func(_ context.Context, p *core.Provider) ([]*core.Provider, error) {
+			return nil, &core.ProviderError{Reason: "not mirrored", Provider: p, StatusCode: http.StatusNotFound}
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/registry.terraform.io/hashicorp/random/3.6.0", nil))
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+		assert.Empty(t, uploaded)
+	})
+}
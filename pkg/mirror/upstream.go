@@ -1,8 +1,10 @@
 package mirror
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 
@@ -14,6 +16,7 @@ type upstreamProvider interface {
 	listProviderVersions(ctx context.Context, provider *core.Provider) (*core.ProviderVersions, error)
 	getProvider(ctx context.Context, provider *core.Provider) (*core.Provider, error)
 	shaSums(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error)
+	verifiedShaSums(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error)
 }
 
 type upstreamProviderRegistry struct {
@@ -73,26 +76,56 @@ func (u *upstreamProviderRegistry) getProvider(ctx context.Context, provider *co
 }
 
 func (u *upstreamProviderRegistry) shaSums(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.SHASumsURL, nil)
+	sums, err := u.download(ctx, provider.SHASumsURL, provider.ShasumFileName())
 	if err != nil {
 		return nil, err
 	}
-	resp, err := u.client.Do(req)
+
+	sha256Sums, err := core.NewSha256Sums(provider.ShasumFileName(), bytes.NewReader(sums))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SHA256SUM: %w", err)
+	}
+	return sha256Sums, nil
+}
+
+// verifiedShaSums returns the SHA256SUMS file of the provider after verifying its signature with the upstream signing keys of the provider
+func (u *upstreamProviderRegistry) verifiedShaSums(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
+	sums, err := u.download(ctx, provider.SHASumsURL, provider.ShasumFileName())
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	sig, err := u.download(ctx, provider.SHASumsSignatureURL, provider.ShasumSignatureFileName())
+	if err != nil {
+		return nil, err
+	}
+	if err := provider.SigningKeys.IsValidSha256Sums(sums, sig); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
 
-	sha256Sums, err := core.NewSha256Sums(provider.ShasumFileName(), resp.Body)
+	sha256Sums, err := core.NewSha256Sums(provider.ShasumFileName(), bytes.NewReader(sums))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse SHA256SUM: %w", err)
 	}
 	return sha256Sums, nil
 }
 
-func newUpstreamProviderRegistry(remoteServiceDiscovery discovery.ServiceDiscoveryResolver) *upstreamProviderRegistry {
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.MaxIdleConnsPerHost = 100
+func (u *upstreamProviderRegistry) download(ctx context.Context, url, fileName string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := upstreamStatusError(resp.StatusCode); err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", fileName, err)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func newUpstreamProviderRegistry(remoteServiceDiscovery discovery.ServiceDiscoveryResolver, transport http.RoundTripper) *upstreamProviderRegistry {
 	return &upstreamProviderRegistry{
 		client: &http.Client{
 			Transport: transport,
@@ -3,6 +3,7 @@ package mirror
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -271,3 +272,114 @@ func Test_upstreamProviderRegistry_shaSums(t *testing.T) {
 		})
 	}
 }
+
+func Test_upstreamProviderRegistry_verifiedShaSums(t *testing.T) {
+	sha256Sums := []byte("5f9c7aa76b7c34d722fc9123208e26b22d60440cb47150dd04733b9b94f4541a  terraform-provider-random_2.0.0_linux_amd64.zip\n")
+	signingKeys, signature := signedSha256Sums(t, sha256Sums)
+	_, otherSignature := signedSha256Sums(t, sha256Sums)
+
+	tests := []struct {
+		name      string
+		signature []byte
+		sumsCode  int
+		wantErr   error
+	}{
+		{
+			name:      "valid signature",
+			signature: signature,
+			sumsCode:  http.StatusOK,
+		},
+		{
+			name:      "signed by another key",
+			signature: otherSignature,
+			sumsCode:  http.StatusOK,
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "missing SHA256SUMS file",
+			signature: signature,
+			sumsCode:  http.StatusNotFound,
+			wantErr:   ErrUpstreamNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if strings.HasSuffix(request.URL.Path, ".sig") {
+					_, _ = writer.Write(tt.signature)
+					return
+				}
+				writer.WriteHeader(tt.sumsCode)
+				_, _ = writer.Write(sha256Sums)
+			}))
+			defer server.Close()
+			u := &upstreamProviderRegistry{
+				client:                 server.Client(),
+				remoteServiceDiscovery: newMockedServiceDiscovery(server),
+			}
+			provider := &core.Provider{
+				Namespace:           "hashicorp",
+				Name:                "random",
+				Version:             "2.0.0",
+				SHASumsURL:          server.URL + "/SHA256SUMS",
+				SHASumsSignatureURL: server.URL + "/SHA256SUMS.sig",
+				SigningKeys:         *signingKeys,
+			}
+
+			got, err := u.verifiedShaSums(context.Background(), provider)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("upstreamProviderRegistry.verifiedShaSums() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("upstreamProviderRegistry.verifiedShaSums() error = %v", err)
+			}
+			if _, ok := got.Entries["terraform-provider-random_2.0.0_linux_amd64.zip"]; !ok {
+				t.Errorf("upstreamProviderRegistry.verifiedShaSums() = %v, missing the archive", got)
+			}
+		})
+	}
+}
+
+func Test_upstreamProviderRegistry_userAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{
+			name: "default user agent",
+			want: core.DefaultUserAgent(),
+		},
+		{
+			name: "configured user agent",
+			opts: []Option{WithUserAgent("acme-mirror/1.0")},
+			want: "acme-mirror/1.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				got = request.Header.Get("User-Agent")
+				if _, err := writer.Write([]byte(`{"versions": []}`)); err != nil {
+					panic(err)
+				}
+			}))
+			defer server.Close()
+
+			opts := append([]Option{WithUpstreamTLSConfig(server.Client().Transport.(*http.Transport).TLSClientConfig)}, tt.opts...)
+			u := newOptions(opts...).upstreamRegistry()
+			u.remoteServiceDiscovery = newMockedServiceDiscovery(server)
+
+			if _, err := u.listProviderVersions(context.Background(), &core.Provider{Hostname: "terraform.example.com", Namespace: "hashicorp", Name: "random"}); err != nil {
+				t.Fatalf("upstreamProviderRegistry.listProviderVersions() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("User-Agent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+)
+
+// Mismatch is a mirrored archive that doesn't match its upstream release
+type Mismatch struct {
+	Provider *core.Provider
+	Reason   string
+	// Repaired is set if the archive and the metadata of the release have been copied from upstream again
+	Repaired bool
+
+	// checksum is the upstream checksum of the archive, if the release still exists upstream
+	checksum []byte
+}
+
+// Verifier compares the mirrored archives with the SHA256SUMS files of upstream,
+// for example to detect releases that have been re-published upstream after they were mirrored.
+type Verifier struct {
+	upstream upstreamProvider
+	storage  Storage
+	copier   Copier
+	logger   *slog.Logger
+	repair   bool
+}
+
+// Verify checks every mirrored archive against the upstream SHA256SUMS file and returns the mismatches.
+// The mismatching archives are copied from upstream again if repairing is enabled.
+func (v *Verifier) Verify(ctx context.Context) ([]Mismatch, error) {
+	providers, err := v.storage.ListAllMirroredProviders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mirrored providers: %w", err)
+	}
+
+	var mismatches []Mismatch
+	for _, p := range providers {
+		m, err := v.verify(ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify %s/%s/%s: %w", p.Hostname, p.Namespace, p.ArchiveFileName(), err)
+		}
+		if m == nil {
+			continue
+		}
+
+		logger := v.logger.With(logKeyValues(p), slog.String("reason", m.Reason))
+		if v.repair && m.checksum != nil {
+			// A failed repair is reported as a remaining mismatch, so that the other archives are still verified and repaired
+			if err := v.copy(ctx, m.Provider, m.checksum); err != nil {
+				logger.Error("failed to repair mirrored archive", slog.String("err", err.Error()))
+			} else {
+				m.Repaired = true
+				logger.Info("repaired mirrored archive")
+			}
+		} else {
+			logger.Warn("mirrored archive doesn't match upstream")
+		}
+		mismatches = append(mismatches, *m)
+	}
+	return mismatches, nil
+}
+
+// verify returns a Mismatch if the mirrored archive or its entry in the mirrored SHA256SUMS file differ from upstream.
+// The Provider of the Mismatch is the upstream provider if the archive can be copied from upstream again,
+// which requires the upstream SHA256SUMS file to be signed by the upstream signing keys.
+// Releases that can't be retrieved from upstream are reported as a Mismatch that can't be repaired, only storage errors are returned.
+func (v *Verifier) verify(ctx context.Context, provider *core.Provider) (*Mismatch, error) {
+	upstreamCtx, cancelUpstreamCtx := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelUpstreamCtx()
+	upstream, err := v.upstream.getProvider(upstreamCtx, provider)
+	if errors.Is(err, ErrUpstreamNotFound) {
+		return &Mismatch{Provider: provider, Reason: "the release doesn't exist upstream anymore"}, nil
+	} else if err != nil {
+		return &Mismatch{Provider: provider, Reason: fmt.Sprintf("the upstream release can't be retrieved: %v", err)}, nil
+	}
+	upstreamSums, err := v.upstream.verifiedShaSums(upstreamCtx, upstream)
+	if errors.Is(err, ErrInvalidSignature) {
+		return &Mismatch{Provider: provider, Reason: "the upstream SHA256SUMS file isn't signed by the upstream signing keys"}, nil
+	} else if err != nil {
+		return &Mismatch{Provider: provider, Reason: fmt.Sprintf("the upstream SHA256SUMS file can't be retrieved: %v", err)}, nil
+	}
+
+	want, ok := upstreamSums.Entries[provider.ArchiveFileName()]
+	if !ok {
+		return &Mismatch{Provider: provider, Reason: "the archive isn't listed in the upstream SHA256SUMS file"}, nil
+	}
+
+	archive, err := v.storage.DownloadMirroredFile(ctx, provider, provider.ArchiveFileName())
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := core.Sha256Checksum(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(checksum, want) {
+		return &Mismatch{Provider: upstream, Reason: "the archive doesn't match the upstream SHA256SUMS file", checksum: want}, nil
+	}
+
+	storedSums, err := v.storage.MirroredSha256Sum(ctx, provider)
+	if err != nil {
+		return &Mismatch{Provider: upstream, Reason: "the mirrored SHA256SUMS file can't be read", checksum: want}, nil
+	}
+	if !bytes.Equal(storedSums.Entries[provider.ArchiveFileName()], want) {
+		return &Mismatch{Provider: upstream, Reason: "the mirrored SHA256SUMS file doesn't match upstream", checksum: want}, nil
+	}
+	return nil, nil
+}
+
+// copy replaces the mirrored archive and the metadata with the upstream release, if the upstream archive matches the checksum
+func (v *Verifier) copy(ctx context.Context, upstream *core.Provider, checksum []byte) error {
+	copyCtx, cancelCopyCtx := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancelCopyCtx()
+	return v.copier.copyVerified(copyCtx, upstream, []string{core.HashSchemeZh + hex.EncodeToString(checksum)})
+}
+
+// NewVerifier returns a Verifier, which copies mismatching archives from upstream again with the Copier if repair is set
+func NewVerifier(s Storage, c Copier, repair bool, opts ...Option) *Verifier {
+	return &Verifier{
+		upstream: newOptions(opts...).upstreamRegistry(),
+		storage:  s,
+		copier:   c,
+		logger:   slog.Default().With(slog.String("component", "verifier")),
+		repair:   repair,
+	}
+}
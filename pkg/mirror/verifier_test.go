@@ -0,0 +1,185 @@
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// verifierCopier replaces the mirrored archive with the upstream archive
+type verifierCopier struct {
+	storage  *gcStorage
+	upstream map[string][]byte
+	hashes   []string
+}
+
+func (c *verifierCopier) copy(_ context.Context, _ *core.Provider) {}
+
+func (c *verifierCopier) backfillH1(_ context.Context, _ *core.Provider) {}
+
+func (c *verifierCopier) copyVerified(_ context.Context, provider *core.Provider, hashes []string) error {
+	c.hashes = append(c.hashes, hashes...)
+	key := path.Join(provider.Hostname, provider.Namespace, provider.Name, provider.ArchiveFileName())
+	c.storage.files[key] = c.upstream[provider.ArchiveFileName()]
+	return nil
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	const dir = "registry.terraform.io/hashicorp/random/"
+	upstreamArchives := map[string][]byte{
+		"terraform-provider-random_2.0.0_linux_amd64.zip":  []byte("archive linux_amd64"),
+		"terraform-provider-random_2.0.0_darwin_arm64.zip": []byte("archive darwin_arm64"),
+	}
+	var sums []byte
+	for _, name := range []string{"terraform-provider-random_2.0.0_darwin_arm64.zip", "terraform-provider-random_2.0.0_linux_amd64.zip"} {
+		sums = fmt.Appendf(sums, "%x  %s\n", sha256.Sum256(upstreamArchives[name]), name)
+	}
+	upstreamSums, err := core.NewSha256Sums("terraform-provider-random_2.0.0_SHA256SUMS", strings.NewReader(string(sums)))
+	require.NoError(t, err)
+
+	var invalidSignature bool
+	newVerifier := func(t *testing.T, repair bool) (*Verifier, *gcStorage, *verifierCopier) {
+		t.Helper()
+		invalidSignature = false
+		storage := &gcStorage{files: map[string][]byte{
+			dir + "terraform-provider-random_2.0.0_SHA256SUMS":       sums,
+			dir + "terraform-provider-random_2.0.0_linux_amd64.zip":  []byte("archive linux_amd64"),
+			dir + "terraform-provider-random_2.0.0_darwin_arm64.zip": []byte("drifted"),
+		}}
+		storage.listAllMirroredProviders = func(_ context.Context) ([]*core.Provider, error) {
+			var providers []*core.Provider
+			for _, platform := range []string{"darwin_arm64", "linux_amd64"} {
+				os, arch, _ := strings.Cut(platform, "_")
+				providers = append(providers, &core.Provider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "2.0.0", OS: os, Arch: arch})
+			}
+			return providers, nil
+		}
+		storage.mirroredSha256Sum = func(_ context.Context, p *core.Provider) (*core.Sha256Sums, error) {
+			b, ok := storage.files[path.Join(p.Hostname, p.Namespace, p.Name, p.ShasumFileName())]
+			if !ok {
+				return nil, core.ErrObjectNotFound
+			}
+			return core.NewSha256Sums(p.ShasumFileName(), strings.NewReader(string(b)))
+		}
+
+		c := &verifierCopier{storage: storage, upstream: upstreamArchives}
+		v := NewVerifier(storage, c, repair)
+		v.upstream = &mockedUpstreamProvider{
+			customGetProvider: func(_ context.Context, p *core.Provider) (*core.Provider, error) {
+				if p.Version != "2.0.0" {
+					return nil, ErrUpstreamNotFound
+				}
+				upstream := p.Clone()
+				upstream.DownloadURL = "https://releases.example.com/" + p.ArchiveFileName()
+				return upstream, nil
+			},
+			customVerifiedShaSums: func(_ context.Context, p *core.Provider) (*core.Sha256Sums, error) {
+				if p.Arch == "arm64" && invalidSignature {
+					return nil, ErrInvalidSignature
+				}
+				return upstreamSums, nil
+			},
+		}
+		return v, storage, c
+	}
+
+	t.Run("drifted archive", func(t *testing.T) {
+		v, storage, c := newVerifier(t, false)
+		mismatches, err := v.Verify(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, mismatches, 1)
+		assert.Equal(t, "darwin", mismatches[0].Provider.OS)
+		assert.Equal(t, "arm64", mismatches[0].Provider.Arch)
+		assert.False(t, mismatches[0].Repaired)
+		assert.Empty(t, c.hashes)
+		assert.Equal(t, []byte("drifted"), storage.files[dir+"terraform-provider-random_2.0.0_darwin_arm64.zip"])
+	})
+
+	t.Run("repair drifted archive", func(t *testing.T) {
+		v, storage, c := newVerifier(t, true)
+		mismatches, err := v.Verify(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, mismatches, 1)
+		assert.True(t, mismatches[0].Repaired)
+		zh, err := core.HashZh(strings.NewReader("archive darwin_arm64"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{zh}, c.hashes)
+		assert.Equal(t, []byte("archive darwin_arm64"), storage.files[dir+"terraform-provider-random_2.0.0_darwin_arm64.zip"])
+
+		mismatches, err = v.Verify(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, mismatches)
+	})
+
+	t.Run("drifted SHA256SUMS file", func(t *testing.T) {
+		v, storage, _ := newVerifier(t, false)
+		storage.files[dir+"terraform-provider-random_2.0.0_darwin_arm64.zip"] = []byte("archive darwin_arm64")
+		storage.files[dir+"terraform-provider-random_2.0.0_SHA256SUMS"] = []byte(strings.Replace(string(sums), "darwin_arm64", "darwin_amd64", 1))
+		mismatches, err := v.Verify(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, mismatches, 1)
+		assert.Equal(t, "the mirrored SHA256SUMS file doesn't match upstream", mismatches[0].Reason)
+	})
+
+	t.Run("release removed upstream", func(t *testing.T) {
+		v, storage, c := newVerifier(t, true)
+		storage.files[dir+"terraform-provider-random_2.0.0_darwin_arm64.zip"] = []byte("archive darwin_arm64")
+		listAll := storage.listAllMirroredProviders
+		storage.listAllMirroredProviders = func(ctx context.Context) ([]*core.Provider, error) {
+			providers, err := listAll(ctx)
+			for _, p := range providers {
+				p.Version = "1.0.0"
+			}
+			return providers, err
+		}
+		mismatches, err := v.Verify(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, mismatches, 2)
+		assert.False(t, mismatches[0].Repaired)
+		assert.Empty(t, c.hashes)
+	})
+
+	t.Run("invalid upstream signature", func(t *testing.T) {
+		v, storage, c := newVerifier(t, true)
+		invalidSignature = true
+		mismatches, err := v.Verify(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, mismatches, 1)
+		assert.Equal(t, "the upstream SHA256SUMS file isn't signed by the upstream signing keys", mismatches[0].Reason)
+		assert.False(t, mismatches[0].Repaired)
+		assert.Empty(t, c.hashes)
+		assert.Equal(t, []byte("drifted"), storage.files[dir+"terraform-provider-random_2.0.0_darwin_arm64.zip"])
+	})
+
+	t.Run("upstream errors don't abort the verification", func(t *testing.T) {
+		v, storage, _ := newVerifier(t, false)
+		storage.files[dir+"terraform-provider-random_2.0.0_darwin_arm64.zip"] = []byte("archive darwin_arm64")
+		v.upstream.(*mockedUpstreamProvider).customGetProvider = func(_ context.Context, p *core.Provider) (*core.Provider, error) {
+			if p.Arch == "arm64" {
+				return nil, ErrUpstreamUnavailable
+			}
+			upstream := p.Clone()
+			upstream.DownloadURL = "https://releases.example.com/" + p.ArchiveFileName()
+			return upstream, nil
+		}
+		mismatches, err := v.Verify(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, mismatches, 1)
+		assert.Equal(t, "arm64", mismatches[0].Provider.Arch)
+		assert.Contains(t, mismatches[0].Reason, "the upstream release can't be retrieved")
+	})
+}
@@ -0,0 +1,219 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+)
+
+const (
+	// defaultUpstreamHostname is used for pre-warmed providers that are referenced without a hostname
+	defaultUpstreamHostname = "registry.terraform.io"
+
+	// maxConcurrentWarmerCopies limits the number of provider archives that are copied at the same time
+	maxConcurrentWarmerCopies = 4
+)
+
+// Warmer periodically copies missing provider releases from upstream into the mirror,
+// so that the first request for a new version can already be served from storage.
+type Warmer struct {
+	providers []*core.Provider
+	interval  time.Duration
+
+	upstream upstreamProvider
+	storage  Storage
+	copier   Copier
+	logger   *slog.Logger
+
+	// inFlight contains the keys of the providers which are currently copied
+	inFlight  map[string]struct{}
+	mu        sync.Mutex
+	semaphore chan struct{}
+	wg        sync.WaitGroup
+}
+
+// Run pre-warms the mirror immediately and then on every interval until the context is cancelled.
+// It blocks until all copies started by the Warmer have finished.
+func (w *Warmer) Run(ctx context.Context) {
+	defer w.wg.Wait()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.warm(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Warmer) warm(ctx context.Context) {
+	for _, provider := range w.providers {
+		if ctx.Err() != nil {
+			return
+		}
+
+		missing, err := w.missingProviders(ctx, provider)
+		if err != nil {
+			w.logger.Error("failed to determine missing provider versions", logKeyValues(provider), slog.String("err", err.Error()))
+			continue
+		}
+
+		for _, m := range missing {
+			if err := w.startCopy(ctx, m); err != nil {
+				w.logger.Error("failed to pre-warm provider", logKeyValues(m), slog.String("err", err.Error()))
+			}
+		}
+	}
+}
+
+// missingProviders returns all platforms of the upstream provider versions that don't exist in the mirror yet
+func (w *Warmer) missingProviders(ctx context.Context, provider *core.Provider) ([]*core.Provider, error) {
+	upstreamCtx, cancelUpstreamCtx := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelUpstreamCtx()
+	versions, err := w.upstream.listProviderVersions(upstreamCtx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	mirrored, err := w.storage.ListMirroredProviders(ctx, provider)
+	if err != nil {
+		var providerError *core.ProviderError
+		if !errors.As(err, &providerError) {
+			return nil, err
+		}
+		// Nothing has been mirrored for this provider yet
+		mirrored = nil
+	}
+
+	return missingPlatforms(provider, versions, mirrored), nil
+}
+
+// startCopy resolves the upstream download location of the provider and copies it asynchronously.
+// Providers that are already being copied are skipped.
+func (w *Warmer) startCopy(ctx context.Context, provider *core.Provider) error {
+	key := fmt.Sprintf("%s/%s/%s", provider.Hostname, provider.Namespace, provider.ArchiveFileName())
+	if !w.acquire(key) {
+		return nil
+	}
+
+	upstreamCtx, cancelUpstreamCtx := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelUpstreamCtx()
+	upstream, err := w.upstream.getProvider(upstreamCtx, provider)
+	if err != nil {
+		w.release(key)
+		return err
+	}
+
+	select {
+	case w.semaphore <- struct{}{}:
+	case <-ctx.Done():
+		w.release(key)
+		return ctx.Err()
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() { <-w.semaphore }()
+		defer w.release(key)
+		w.copier.copy(ctx, upstream)
+	}()
+	return nil
+}
+
+// acquire marks a copy as in-flight and returns false if it's already in-flight
+func (w *Warmer) acquire(key string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, exists := w.inFlight[key]; exists {
+		return false
+	}
+	w.inFlight[key] = struct{}{}
+	return true
+}
+
+func (w *Warmer) release(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.inFlight, key)
+}
+
+// missingPlatforms compares the upstream versions with the mirrored providers and returns the platforms which aren't mirrored yet
+func missingPlatforms(provider *core.Provider, versions *core.ProviderVersions, mirrored []*core.Provider) []*core.Provider {
+	existing := make(map[string]struct{}, len(mirrored))
+	for _, m := range mirrored {
+		existing[m.ArchiveFileName()] = struct{}{}
+	}
+
+	var missing []*core.Provider
+	for _, v := range versions.Versions {
+		for _, platform := range v.Platforms {
+			p := provider.Clone()
+			p.Version = v.Version
+			p.OS = platform.OS
+			p.Arch = platform.Arch
+			if _, ok := existing[p.ArchiveFileName()]; ok {
+				continue
+			}
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
+
+// parsePrewarmProvider parses providers in the format [<hostname>/]<namespace>/<name>
+func parsePrewarmProvider(s string) (*core.Provider, error) {
+	parts := strings.Split(s, "/")
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("invalid provider %q, expected format [<hostname>/]<namespace>/<name>", s)
+		}
+	}
+
+	switch len(parts) {
+	case 2:
+		return &core.Provider{Hostname: defaultUpstreamHostname, Namespace: parts[0], Name: parts[1]}, nil
+	case 3:
+		return &core.Provider{Hostname: parts[0], Namespace: parts[1], Name: parts[2]}, nil
+	default:
+		return nil, fmt.Errorf("invalid provider %q, expected format [<hostname>/]<namespace>/<name>", s)
+	}
+}
+
+// NewWarmer creates a Warmer for providers in the format [<hostname>/]<namespace>/<name>.
+// The hostname defaults to registry.terraform.io.
+func NewWarmer(s Storage, c Copier, providers []string, interval time.Duration, opts ...Option) (*Warmer, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("pre-warm interval has to be positive, got %s", interval)
+	}
+
+	var parsed []*core.Provider
+	for _, p := range providers {
+		provider, err := parsePrewarmProvider(p)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, provider)
+	}
+
+	return &Warmer{
+		providers: parsed,
+		interval:  interval,
+		upstream:  newOptions(opts...).upstreamRegistry(),
+		storage:   s,
+		copier:    c,
+		logger:    slog.Default().With(slog.String("component", "warmer")),
+		inFlight:  make(map[string]struct{}),
+		semaphore: make(chan struct{}, maxConcurrentWarmerCopies),
+	}, nil
+}
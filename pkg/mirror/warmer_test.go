@@ -0,0 +1,160 @@
+package mirror
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockedCopier struct {
+	copies  atomic.Int32
+	release chan struct{}
+}
+
+func (m *mockedCopier) copy(_ context.Context, _ *core.Provider) {
+	m.copies.Add(1)
+	<-m.release
+}
+
+func (m *mockedCopier) copyVerified(_ context.Context, _ *core.Provider, _ []string) error {
+	m.copies.Add(1)
+	return nil
+}
+
+func (m *mockedCopier) backfillH1(_ context.Context, _ *core.Provider) {}
+
+func Test_missingPlatforms(t *testing.T) {
+	provider := &core.Provider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random"}
+	versions := &core.ProviderVersions{
+		Versions: []core.ProviderVersion{
+			{
+				Version: "3.6.0",
+				Platforms: []core.Platform{
+					{OS: "linux", Arch: "amd64"},
+					{OS: "darwin", Arch: "arm64"},
+				},
+			},
+			{
+				Version: "3.6.1",
+				Platforms: []core.Platform{
+					{OS: "linux", Arch: "amd64"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		mirrored []*core.Provider
+		want     []string
+	}{
+		{
+			name: "nothing mirrored",
+			want: []string{
+				"terraform-provider-random_3.6.0_linux_amd64.zip",
+				"terraform-provider-random_3.6.0_darwin_arm64.zip",
+				"terraform-provider-random_3.6.1_linux_amd64.zip",
+			},
+		},
+		{
+			name: "single platform missing",
+			mirrored: []*core.Provider{
+				{Name: "random", Version: "3.6.0", OS: "linux", Arch: "amd64"},
+				{Name: "random", Version: "3.6.1", OS: "linux", Arch: "amd64"},
+			},
+			want: []string{"terraform-provider-random_3.6.0_darwin_arm64.zip"},
+		},
+		{
+			name: "everything mirrored",
+			mirrored: []*core.Provider{
+				{Name: "random", Version: "3.6.0", OS: "linux", Arch: "amd64"},
+				{Name: "random", Version: "3.6.0", OS: "darwin", Arch: "arm64"},
+				{Name: "random", Version: "3.6.1", OS: "linux", Arch: "amd64"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, p := range missingPlatforms(provider, versions, tc.mirrored) {
+				assert.Equal(t, provider.Hostname, p.Hostname)
+				assert.Equal(t, provider.Namespace, p.Namespace)
+				got = append(got, p.ArchiveFileName())
+			}
+			assert.ElementsMatch(t, tc.want, got)
+		})
+	}
+}
+
+func TestWarmer_deduplicatesInFlightCopies(t *testing.T) {
+	c := &mockedCopier{release: make(chan struct{})}
+	w := &Warmer{
+		upstream: &mockedUpstreamProvider{
+			customGetProvider: func(ctx context.Context, provider *core.Provider) (*core.Provider, error) {
+				return provider, nil
+			},
+		},
+		copier:    c,
+		inFlight:  make(map[string]struct{}),
+		semaphore: make(chan struct{}, maxConcurrentWarmerCopies),
+	}
+
+	provider := &core.Provider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "3.6.0", OS: "linux", Arch: "amd64"}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, w.startCopy(context.Background(), provider.Clone()))
+		}()
+	}
+	wg.Wait()
+
+	// A different namespace is not deduplicated
+	other := provider.Clone()
+	other.Namespace = "example"
+	assert.NoError(t, w.startCopy(context.Background(), other))
+
+	assert.Eventually(t, func() bool { return c.copies.Load() == 2 }, time.Second, 10*time.Millisecond)
+	close(c.release)
+	w.wg.Wait()
+
+	// After the copy finished, the same provider can be copied again
+	assert.NoError(t, w.startCopy(context.Background(), provider))
+	w.wg.Wait()
+	assert.Equal(t, int32(3), c.copies.Load())
+	assert.Empty(t, w.inFlight)
+}
+
+func Test_parsePrewarmProvider(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    *core.Provider
+		wantErr bool
+	}{
+		{input: "hashicorp/random", want: &core.Provider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random"}},
+		{input: "terraform.example.com/acme/dummy", want: &core.Provider{Hostname: "terraform.example.com", Namespace: "acme", Name: "dummy"}},
+		{input: "random", wantErr: true},
+		{input: "hashicorp/", wantErr: true},
+		{input: "a/b/c/d", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := parsePrewarmProvider(tc.input)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
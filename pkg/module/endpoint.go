@@ -2,6 +2,7 @@ package module
 
 import (
 	"context"
+	"fmt"
 
 	o11y "github.com/boring-registry/boring-registry/pkg/observability"
 
@@ -67,7 +68,10 @@ type downloadRequest struct {
 	version   string
 }
 
-type downloadResponse struct{ url string }
+type downloadResponse struct {
+	url      string
+	checksum string
+}
 
 func downloadEndpoint(svc Service, metrics *o11y.ModuleMetrics) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
@@ -86,7 +90,97 @@ func downloadEndpoint(svc Service, metrics *o11y.ModuleMetrics) endpoint.Endpoin
 		}
 
 		return downloadResponse{
-			url: res.DownloadURL,
+			url:      res.DownloadURL,
+			checksum: res.Checksum,
+		}, nil
+	}
+}
+
+func existsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(downloadRequest)
+
+		exists, err := svc.ModuleExists(ctx, req.namespace, req.name, req.provider, req.version)
+		if err != nil {
+			return nil, err
+		} else if !exists {
+			return nil, fmt.Errorf("%w: %s/%s/%s/%s", ErrModuleNotFound, req.namespace, req.name, req.provider, req.version)
+		}
+		return struct{}{}, nil
+	}
+}
+
+type latestRequest struct {
+	namespace         string
+	name              string
+	provider          string
+	includePrerelease bool
+}
+
+type latestResponse struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Provider  string `json:"provider"`
+	Version   string `json:"version"`
+}
+
+func latestEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(latestRequest)
+
+		res, err := svc.GetLatestModuleVersion(ctx, req.namespace, req.name, req.provider, req.includePrerelease)
+		if err != nil {
+			return nil, err
+		}
+
+		return latestResponse{
+			Namespace: res.Namespace,
+			Name:      res.Name,
+			Provider:  res.Provider,
+			Version:   res.Version,
+		}, nil
+	}
+}
+
+type providerModulesRequest struct {
+	provider string
+	limit    int
+	cursor   string
+}
+
+type providerModule struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Provider  string `json:"provider"`
+}
+
+type providerModulesResponse struct {
+	Modules []providerModule `json:"modules"`
+	// NextCursor is passed as the cursor to retrieve the next page and empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func providerModulesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(providerModulesRequest)
+
+		res, next, err := svc.ListModulesByProvider(ctx, req.provider, req.limit, req.cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		modules := make([]providerModule, 0, len(res))
+		for _, m := range res {
+			modules = append(modules, providerModule{
+				Namespace: m.Namespace,
+				Name:      m.Name,
+				Provider:  m.Provider,
+			})
+		}
+
+		return providerModulesResponse{
+			Modules:    modules,
+			NextCursor: next,
 		}, nil
 	}
 }
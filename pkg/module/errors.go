@@ -4,8 +4,11 @@ import "errors"
 
 var (
 	// Module errors
-	ErrModuleNotFound      = errors.New("failed to locate module")
-	ErrModuleUploadFailed  = errors.New("failed to upload module")
-	ErrModuleAlreadyExists = errors.New("module already exists")
-	ErrModuleListFailed    = errors.New("failed to list module versions")
+	ErrModuleNotFound        = errors.New("failed to locate module")
+	ErrModuleUploadFailed    = errors.New("failed to upload module")
+	ErrModuleAlreadyExists   = errors.New("module already exists")
+	ErrModuleContentMismatch = errors.New("module version already exists with different content")
+	ErrModuleListFailed      = errors.New("failed to list module versions")
+	ErrInvalidQuery          = errors.New("invalid query parameter")
+	ErrInvalidModule         = errors.New("invalid module address")
 )
@@ -5,6 +5,8 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/boring-registry/boring-registry/pkg/audit"
+	"github.com/boring-registry/boring-registry/pkg/auth"
 	"github.com/boring-registry/boring-registry/pkg/core"
 )
 
@@ -35,11 +37,11 @@ func (mw loggingMiddleware) ListModuleVersions(ctx context.Context, namespace, n
 			),
 		)
 		if err != nil {
-			logger.Error("failed to list module", slog.String("err", err.Error()))
+			logger.ErrorContext(ctx, "failed to list module", slog.String("err", err.Error()))
 			return
 		}
 
-		logger.Info("list module version", slog.String("took", time.Since(begin).String()))
+		logger.InfoContext(ctx, "list module version", slog.String("took", time.Since(begin).String()))
 	}(time.Now())
 
 	return mw.next.ListModuleVersions(ctx, namespace, name, provider)
@@ -61,12 +63,175 @@ func (mw loggingMiddleware) GetModule(ctx context.Context, namespace, name, prov
 		)
 
 		if err != nil {
-			logger.Error("failed to get module", slog.String("err", err.Error()))
+			logger.ErrorContext(ctx, "failed to get module", slog.String("err", err.Error()))
 			return
 		}
 
-		logger.Info("get module", slog.String("took", time.Since(begin).String()), slog.String("module", module.ID(true)))
+		logger.InfoContext(ctx, "get module", slog.String("took", time.Since(begin).String()), slog.String("module", module.ID(true)))
 	}(time.Now())
 
 	return mw.next.GetModule(ctx, namespace, name, provider, version)
 }
+
+func (mw loggingMiddleware) GetLatestModuleVersion(ctx context.Context, namespace, name, provider string, includePrerelease bool) (module core.Module, err error) {
+	defer func(begin time.Time) {
+		logger := slog.Default().With(
+			slog.String("op", "GetLatestModuleVersion"),
+			slog.Group("module",
+				slog.String("namespace", namespace),
+				slog.String("name", name),
+				slog.String("provider", provider),
+			),
+		)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to get latest module version", slog.String("err", err.Error()))
+			return
+		}
+
+		logger.InfoContext(ctx, "get latest module version", slog.String("took", time.Since(begin).String()), slog.String("module", module.ID(true)))
+	}(time.Now())
+
+	return mw.next.GetLatestModuleVersion(ctx, namespace, name, provider, includePrerelease)
+}
+
+func (mw loggingMiddleware) ModuleExists(ctx context.Context, namespace, name, provider, version string) (exists bool, err error) {
+	defer func(begin time.Time) {
+		logger := slog.Default().With(
+			slog.String("op", "ModuleExists"),
+			slog.Group("module",
+				slog.String("namespace", namespace),
+				slog.String("name", name),
+				slog.String("provider", provider),
+				slog.String("version", version),
+			),
+		)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to check module existence", slog.String("err", err.Error()))
+			return
+		}
+
+		logger.InfoContext(ctx, "check module existence", slog.String("took", time.Since(begin).String()), slog.Bool("exists", exists))
+	}(time.Now())
+
+	return mw.next.ModuleExists(ctx, namespace, name, provider, version)
+}
+
+func (mw loggingMiddleware) ListModulesByProvider(ctx context.Context, provider string, limit int, cursor string) (modules []core.Module, next string, err error) {
+	defer func(begin time.Time) {
+		logger := slog.Default().With(
+			slog.String("op", "ListModulesByProvider"),
+			slog.String("provider", provider),
+		)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to list modules of provider", slog.String("err", err.Error()))
+			return
+		}
+
+		logger.InfoContext(ctx, "list modules of provider", slog.String("took", time.Since(begin).String()), slog.Int("modules", len(modules)))
+	}(time.Now())
+
+	return mw.next.ListModulesByProvider(ctx, provider, limit, cursor)
+}
+
+type auditMiddleware struct {
+	next   Service
+	logger audit.Logger
+}
+
+// AuditMiddleware is a Service middleware that records successful module downloads with the audit.Logger
+func AuditMiddleware(logger audit.Logger) Middleware {
+	return func(next Service) Service {
+		return &auditMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+func (mw auditMiddleware) ListModuleVersions(ctx context.Context, namespace, name, provider string) ([]core.Module, error) {
+	return mw.next.ListModuleVersions(ctx, namespace, name, provider)
+}
+
+func (mw auditMiddleware) GetLatestModuleVersion(ctx context.Context, namespace, name, provider string, includePrerelease bool) (core.Module, error) {
+	return mw.next.GetLatestModuleVersion(ctx, namespace, name, provider, includePrerelease)
+}
+
+func (mw auditMiddleware) ModuleExists(ctx context.Context, namespace, name, provider, version string) (bool, error) {
+	return mw.next.ModuleExists(ctx, namespace, name, provider, version)
+}
+
+func (mw auditMiddleware) ListModulesByProvider(ctx context.Context, provider string, limit int, cursor string) ([]core.Module, string, error) {
+	return mw.next.ListModulesByProvider(ctx, provider, limit, cursor)
+}
+
+func (mw auditMiddleware) GetModule(ctx context.Context, namespace, name, provider, version string) (module core.Module, err error) {
+	defer func(begin time.Time) {
+		if err != nil {
+			return
+		}
+		audit.LogRegistryAccess(ctx, mw.logger, audit.EventRegistryModuleAccess, audit.ActionDownload, module.ID(true), begin, nil)
+	}(time.Now())
+
+	return mw.next.GetModule(ctx, namespace, name, provider, version)
+}
+
+type aclMiddleware struct {
+	next Service
+	acl  auth.ACL
+}
+
+// ACLMiddleware is a Service middleware that denies the access to namespaces, which the user isn't allowed to read
+func ACLMiddleware(acl auth.ACL) Middleware {
+	return func(next Service) Service {
+		return &aclMiddleware{
+			next: next,
+			acl:  acl,
+		}
+	}
+}
+
+func (mw aclMiddleware) ListModuleVersions(ctx context.Context, namespace, name, provider string) ([]core.Module, error) {
+	if err := mw.acl.Authorize(ctx, namespace, auth.PermissionRead); err != nil {
+		return nil, err
+	}
+	return mw.next.ListModuleVersions(ctx, namespace, name, provider)
+}
+
+func (mw aclMiddleware) GetLatestModuleVersion(ctx context.Context, namespace, name, provider string, includePrerelease bool) (core.Module, error) {
+	if err := mw.acl.Authorize(ctx, namespace, auth.PermissionRead); err != nil {
+		return core.Module{}, err
+	}
+	return mw.next.GetLatestModuleVersion(ctx, namespace, name, provider, includePrerelease)
+}
+
+func (mw aclMiddleware) GetModule(ctx context.Context, namespace, name, provider, version string) (core.Module, error) {
+	if err := mw.acl.Authorize(ctx, namespace, auth.PermissionRead); err != nil {
+		return core.Module{}, err
+	}
+	return mw.next.GetModule(ctx, namespace, name, provider, version)
+}
+
+func (mw aclMiddleware) ModuleExists(ctx context.Context, namespace, name, provider, version string) (bool, error) {
+	if err := mw.acl.Authorize(ctx, namespace, auth.PermissionRead); err != nil {
+		return false, err
+	}
+	return mw.next.ModuleExists(ctx, namespace, name, provider, version)
+}
+
+// ListModulesByProvider omits the modules of namespaces, which the user isn't allowed to read,
+// or whose namespace-specific claim requirements the token doesn't satisfy, as the listing isn't bound to the namespace of the request path.
+// Pages can therefore contain fewer modules than the limit, even if they aren't the last page.
+func (mw aclMiddleware) ListModulesByProvider(ctx context.Context, provider string, limit int, cursor string) ([]core.Module, string, error) {
+	modules, next, err := mw.next.ListModulesByProvider(ctx, provider, limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	allowed := make([]core.Module, 0, len(modules))
+	for _, m := range modules {
+		if mw.acl.Authorize(ctx, m.Namespace, auth.PermissionRead) == nil && auth.AuthorizeNamespace(ctx, m.Namespace) == nil {
+			allowed = append(allowed, m)
+		}
+	}
+	return allowed, next, nil
+}
@@ -0,0 +1,57 @@
+package module
+
+import (
+	"context"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/audit"
+	"github.com/boring-registry/boring-registry/pkg/audit/audittest"
+	"github.com/boring-registry/boring-registry/pkg/auth"
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditMiddleware_GetModule(t *testing.T) {
+	ctx := audit.ContextWithUser(context.Background(), &audit.User{Provider: "static"})
+	storage := NewInmemStorage()
+	_, err := storage.UploadModule(ctx, "example", "s3", "aws", "1.0.0", testModuleData(map[string]string{"main.tf": `name = "foo"`}))
+	assert.NoError(t, err)
+
+	logger := &audittest.Logger{}
+	svc := AuditMiddleware(logger)(NewService(storage, core.NewProxyUrlService(false, "/proxy")))
+
+	_, err = svc.GetModule(ctx, "example", "s3", "aws", "1.0.0")
+	assert.NoError(t, err)
+	assert.Len(t, logger.Events, 1)
+	assert.Equal(t, audit.EventRegistryModuleAccess, logger.Events[0].Type)
+	assert.Equal(t, audit.ActionDownload, logger.Events[0].Action)
+	assert.Equal(t, "example/s3/aws/1.0.0", logger.Events[0].Resource)
+	assert.Equal(t, "static", logger.Events[0].User.Provider)
+
+	// Failed downloads and listing versions aren't audited
+	_, err = svc.GetModule(ctx, "example", "s3", "aws", "2.0.0")
+	assert.Error(t, err)
+	_, err = svc.ListModuleVersions(ctx, "example", "s3", "aws")
+	assert.NoError(t, err)
+	assert.Len(t, logger.Events, 1)
+}
+
+func TestACLMiddleware(t *testing.T) {
+	storage := NewInmemStorage()
+	_, err := storage.UploadModule(context.Background(), "example", "s3", "aws", "1.0.0", testModuleData(map[string]string{"main.tf": `name = "foo"`}))
+	assert.NoError(t, err)
+
+	acl := auth.ACL{"example": auth.NamespaceACL{Read: []string{"group:developers"}}}
+	svc := ACLMiddleware(acl)(NewService(storage, core.NewProxyUrlService(false, "/proxy")))
+
+	ctx := audit.ContextWithUser(context.Background(), &audit.User{Subject: "someone", Groups: []string{"developers"}})
+	_, err = svc.GetModule(ctx, "example", "s3", "aws", "1.0.0")
+	assert.NoError(t, err)
+
+	ctx = audit.ContextWithUser(context.Background(), &audit.User{Subject: "someone", Groups: []string{"sre"}})
+	_, err = svc.GetModule(ctx, "example", "s3", "aws", "1.0.0")
+	assert.ErrorIs(t, err, core.ErrForbidden)
+	_, err = svc.ListModuleVersions(ctx, "example", "s3", "aws")
+	assert.ErrorIs(t, err, core.ErrForbidden)
+}
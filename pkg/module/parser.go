@@ -4,10 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"slices"
 
 	"github.com/hashicorp/go-version"
-	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
 )
 
 // Spec represents a module spec with metadata.
@@ -66,6 +71,7 @@ func ParseFile(path string) (*Spec, error) {
 }
 
 // Parse parses a module spec.
+// Attributes can reference environment variables with ${env.NAME}, for example to set the version from a CI pipeline.
 func Parse(r io.Reader) (*Spec, error) {
 	spec := &Spec{}
 
@@ -74,13 +80,74 @@ func Parse(r io.Reader) (*Spec, error) {
 		return nil, err
 	}
 
-	if err := hclsimple.Decode("boring-registry.hcl", b, nil, spec); err != nil {
+	file, diags := hclsyntax.ParseConfig(b, specFileName, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	evalCtx, err := envEvalContext(file.Body.(*hclsyntax.Body))
+	if err != nil {
 		return nil, err
 	}
 
+	if diags := gohcl.DecodeBody(file.Body, evalCtx, spec); diags.HasErrors() {
+		return nil, diags
+	}
+
 	if err := spec.Validate(); err != nil {
 		return nil, err
 	}
 
 	return spec, nil
 }
+
+const (
+	specFileName = "boring-registry.hcl"
+
+	// envVariable is the name of the object that holds the environment variables in the spec
+	envVariable = "env"
+)
+
+// envEvalContext returns the context with the environment variables that are referenced by the attributes of the body.
+// Only the referenced variables are exposed, a referenced variable that isn't set is an error.
+func envEvalContext(body *hclsyntax.Body) (*hcl.EvalContext, error) {
+	env := make(map[string]cty.Value)
+	var errs []error
+
+	var walk func(body *hclsyntax.Body, path string)
+	walk = func(body *hclsyntax.Body, path string) {
+		for _, name := range slices.Sorted(maps.Keys(body.Attributes)) {
+			for _, traversal := range body.Attributes[name].Expr.Variables() {
+				if traversal.RootName() != envVariable {
+					continue
+				}
+				if len(traversal) < 2 {
+					errs = append(errs, fmt.Errorf("%s%s references %s without the name of an environment variable", path, name, envVariable))
+					continue
+				}
+				variable, ok := traversal[1].(hcl.TraverseAttr)
+				if !ok {
+					errs = append(errs, fmt.Errorf("%s%s must reference environment variables as %s.NAME", path, name, envVariable))
+					continue
+				}
+				value, ok := os.LookupEnv(variable.Name)
+				if !ok {
+					errs = append(errs, fmt.Errorf("environment variable %s referenced by %s%s is not set", variable.Name, path, name))
+					continue
+				}
+				env[variable.Name] = cty.StringVal(value)
+			}
+		}
+		for _, block := range body.Blocks {
+			walk(block.Body, path+block.Type+".")
+		}
+	}
+	walk(body, "")
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &hcl.EvalContext{
+		Variables: map[string]cty.Value{envVariable: cty.ObjectVal(env)},
+	}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParser(t *testing.T) {
@@ -86,3 +87,53 @@ func TestParser(t *testing.T) {
 		})
 	}
 }
+
+func TestParser_env(t *testing.T) {
+	t.Setenv("BUILD_VERSION", "1.2.3")
+	t.Setenv("MODULE_NAMESPACE", "example")
+
+	spec, err := Parse(strings.NewReader(`
+	metadata {
+	  name      = "s3"
+	  namespace = env.MODULE_NAMESPACE
+	  version   = "${env.BUILD_VERSION}"
+	  provider  = "aws"
+	}
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, Metadata{Name: "s3", Namespace: "example", Version: "1.2.3", Provider: "aws"}, spec.Metadata)
+
+	// Interpolation works within literal values
+	spec, err = Parse(strings.NewReader(`
+	metadata {
+	  name      = "s3"
+	  namespace = "example"
+	  version   = "${env.BUILD_VERSION}-rc.1"
+	  provider  = "aws"
+	}
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3-rc.1", spec.Metadata.Version)
+
+	_, err = Parse(strings.NewReader(`
+	metadata {
+	  name      = "s3"
+	  namespace = "example"
+	  version   = "${env.MISSING_VERSION}"
+	  provider  = "${env.MISSING_PROVIDER}"
+	}
+	`))
+	assert.EqualError(t, err, "environment variable MISSING_PROVIDER referenced by metadata.provider is not set\n"+
+		"environment variable MISSING_VERSION referenced by metadata.version is not set")
+
+	// Other variables aren't available
+	_, err = Parse(strings.NewReader(`
+	metadata {
+	  name      = "s3"
+	  namespace = "example"
+	  version   = "${var.version}"
+	  provider  = "aws"
+	}
+	`))
+	assert.ErrorContains(t, err, "Unknown variable")
+}
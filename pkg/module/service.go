@@ -2,15 +2,31 @@ package module
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
 )
 
+const (
+	// DefaultProviderModulesLimit is the page size of the modules of a provider, unless the request sets a limit
+	DefaultProviderModulesLimit = 100
+	// MaxProviderModulesLimit caps the page size of the modules of a provider, as every module is looked up in the storage
+	MaxProviderModulesLimit = 1000
+)
+
 // Service implements the Module Registry Protocol.
 // For more information see: https://www.terraform.io/docs/internals/module-registry-protocol.html.
 type Service interface {
 	GetModule(ctx context.Context, namespace, name, provider, version string) (core.Module, error)
 	ListModuleVersions(ctx context.Context, namespace, name, provider string) ([]core.Module, error)
+	// GetLatestModuleVersion returns the highest version of a module, which is a pre-release only if includePrerelease is set
+	GetLatestModuleVersion(ctx context.Context, namespace, name, provider string, includePrerelease bool) (core.Module, error)
+	// ModuleExists reports whether a module version exists, without generating a download URL
+	ModuleExists(ctx context.Context, namespace, name, provider, version string) (bool, error)
+	// ListModulesByProvider returns up to limit modules for the provider across all namespaces following the cursor.
+	// The returned cursor retrieves the next page and is empty on the last page.
+	ListModulesByProvider(ctx context.Context, provider string, limit int, cursor string) ([]core.Module, string, error)
 }
 
 type service struct {
@@ -27,12 +43,17 @@ func NewService(storage Storage, proxy core.ProxyUrlService) Service {
 }
 
 func (s *service) GetModule(ctx context.Context, namespace, name, provider, version string) (core.Module, error) {
+	proxied := s.proxy.IsProxyEnabled(ctx)
+	if proxied {
+		ctx = core.ContextWithProxiedDownload(ctx)
+	}
+
 	res, err := s.storage.GetModule(ctx, namespace, name, provider, version)
 	if err != nil {
 		return core.Module{}, err
 	}
 
-	if s.proxy.IsProxyEnabled(ctx) {
+	if proxied {
 		downloadUrl, err := s.proxy.GetProxyUrl(ctx, res.DownloadURL)
 		if err != nil {
 			return core.Module{}, err
@@ -44,6 +65,10 @@ func (s *service) GetModule(ctx context.Context, namespace, name, provider, vers
 	return res, err
 }
 
+func (s *service) ModuleExists(ctx context.Context, namespace, name, provider, version string) (bool, error) {
+	return s.storage.ModuleExists(ctx, namespace, name, provider, version)
+}
+
 func (s *service) ListModuleVersions(ctx context.Context, namespace, name, provider string) ([]core.Module, error) {
 	res, err := s.storage.ListModuleVersions(ctx, namespace, name, provider)
 	if err != nil {
@@ -52,3 +77,37 @@ func (s *service) ListModuleVersions(ctx context.Context, namespace, name, provi
 
 	return res, nil
 }
+
+func (s *service) ListModulesByProvider(ctx context.Context, provider string, limit int, cursor string) ([]core.Module, string, error) {
+	if provider == "" || strings.Contains(provider, "/") {
+		return nil, "", fmt.Errorf("%w: provider", ErrInvalidQuery)
+	}
+	if limit <= 0 || limit > MaxProviderModulesLimit {
+		return nil, "", fmt.Errorf("%w: limit has to be between 1 and %d", ErrInvalidQuery, MaxProviderModulesLimit)
+	}
+	return s.storage.ListModulesByProvider(ctx, provider, limit, cursor)
+}
+
+func (s *service) GetLatestModuleVersion(ctx context.Context, namespace, name, provider string, includePrerelease bool) (core.Module, error) {
+	modules, err := s.storage.ListModuleVersions(ctx, namespace, name, provider)
+	if err != nil {
+		return core.Module{}, err
+	}
+
+	versions := make([]string, 0, len(modules))
+	for _, m := range modules {
+		versions = append(versions, m.Version)
+	}
+
+	latest, ok := core.LatestVersion(versions, includePrerelease)
+	if !ok {
+		return core.Module{}, ErrModuleNotFound
+	}
+
+	return core.Module{
+		Namespace: namespace,
+		Name:      name,
+		Provider:  provider,
+		Version:   latest,
+	}, nil
+}
@@ -196,3 +196,63 @@ func TestService_ListModuleVersions(t *testing.T) {
 		})
 	}
 }
+
+func TestService_GetLatestModuleVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	testCases := []struct {
+		name              string
+		versions          []string
+		includePrerelease bool
+		expectedVersion   string
+		expectedErr       error
+	}{
+		{
+			name:            "numeric ordering",
+			versions:        []string{"1.9.0", "1.10.0", "1.2.0"},
+			expectedVersion: "1.10.0",
+		},
+		{
+			name:            "pre-releases are excluded by default",
+			versions:        []string{"1.9.0", "1.10.0-rc1", "2.0.0-beta"},
+			expectedVersion: "1.9.0",
+		},
+		{
+			name:              "pre-releases are included",
+			versions:          []string{"1.9.0", "1.10.0-rc1", "1.10.0-beta"},
+			includePrerelease: true,
+			expectedVersion:   "1.10.0-rc1",
+		},
+		{
+			name:        "only pre-releases",
+			versions:    []string{"0.1.0-alpha"},
+			expectedErr: ErrModuleNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				ctx     = context.Background()
+				storage = NewInmemStorage()
+				proxy   = core.NewProxyUrlService(false, "/proxy")
+				svc     = NewService(storage, proxy)
+			)
+
+			for _, v := range tc.versions {
+				_, err := storage.UploadModule(ctx, "example", "s3", "aws", v, testModuleData(map[string]string{"main.tf": `name = "foo"`}))
+				assert.NoError(err)
+			}
+
+			module, err := svc.GetLatestModuleVersion(ctx, "example", "s3", "aws", tc.includePrerelease)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(core.Module{Namespace: "example", Name: "s3", Provider: "aws", Version: tc.expectedVersion}, module)
+		})
+	}
+}
@@ -12,5 +12,10 @@ type Storage interface {
 	// GetModule should return an ErrModuleNotFound error if the requested module version cannot be found
 	GetModule(ctx context.Context, namespace, name, provider, version string) (core.Module, error)
 	ListModuleVersions(ctx context.Context, namespace, name, provider string) ([]core.Module, error)
+	// ModuleExists reports whether the archive of a module version exists, without generating a download URL
+	ModuleExists(ctx context.Context, namespace, name, provider, version string) (bool, error)
 	UploadModule(ctx context.Context, namespace, name, provider, version string, body io.Reader) (core.Module, error)
+	// ListModulesByProvider returns up to limit modules for the provider across all namespaces, ordered by namespace and name.
+	// The modules have no version, and the returned token resumes the listing with the next page and is empty on the last page.
+	ListModulesByProvider(ctx context.Context, provider string, limit int, token string) ([]core.Module, string, error)
 }
@@ -0,0 +1,324 @@
+package module
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/hashicorp/go-version"
+)
+
+const (
+	// DefaultGitRepositoryPattern follows the naming convention of the public Terraform registry for module repositories
+	DefaultGitRepositoryPattern = "{namespace}/terraform-{provider}-{name}"
+
+	// DefaultGitTagCacheTTL is the duration for which the tags of a repository are reused
+	DefaultGitTagCacheTTL = 30 * time.Second
+
+	// defaultGitTimeout bounds the listing of the tags, so that an unresponsive Git server doesn't block requests
+	defaultGitTimeout = 10 * time.Second
+)
+
+// GitStorage is a Storage implementation that serves modules from Git repositories.
+// No archives are stored, the versions are read from the tags of the repository and the download URL points to the tag.
+type GitStorage struct {
+	baseURL  string
+	pattern  string
+	username string
+	password string
+	client   *http.Client
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu sync.Mutex
+	// tags caches the tags per repository, as Terraform requests the versions and the download of a module in quick succession
+	tags map[string]cachedTags
+}
+
+type cachedTags struct {
+	tags    []string
+	expires time.Time
+}
+
+// GetModule returns the download URL of the tag matching the version
+func (s *GitStorage) GetModule(ctx context.Context, namespace, name, provider, version string) (core.Module, error) {
+	modules, err := s.ListModuleVersions(ctx, namespace, name, provider)
+	if err != nil {
+		return core.Module{}, err
+	}
+
+	for _, m := range modules {
+		if m.Version == version {
+			return m, nil
+		}
+	}
+
+	return core.Module{}, ErrModuleNotFound
+}
+
+// ModuleExists reports whether the repository has a tag matching the version
+func (s *GitStorage) ModuleExists(ctx context.Context, namespace, name, provider, version string) (bool, error) {
+	_, err := s.GetModule(ctx, namespace, name, provider, version)
+	if errors.Is(err, ErrModuleNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ListModulesByProvider isn't supported, as the repositories of a Git server can't be enumerated through the Git protocol
+func (s *GitStorage) ListModulesByProvider(_ context.Context, _ string, _ int, _ string) ([]core.Module, string, error) {
+	return nil, "", fmt.Errorf("the Git storage can't list the modules of a provider: %w", errors.ErrUnsupported)
+}
+
+// ListModuleVersions lists the tags of the repository that are valid semantic versions, optionally prefixed with a "v"
+func (s *GitStorage) ListModuleVersions(ctx context.Context, namespace, name, provider string) ([]core.Module, error) {
+	repository, subdir, err := s.repository(namespace, name, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := s.cachedListTags(ctx, repository)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", ErrModuleListFailed, err)
+	}
+
+	var modules []core.Module
+	// The tags v1.0.0 and 1.0.0 are the same version, the tag with the prefix is preferred by convention
+	indices := make(map[string]int)
+	for _, tag := range tags {
+		v, ok := versionFromTag(tag)
+		if !ok {
+			continue
+		}
+
+		m := core.Module{
+			Namespace:   namespace,
+			Name:        name,
+			Provider:    provider,
+			Version:     v,
+			DownloadURL: gitDownloadURL(repository, subdir, tag),
+		}
+		if i, ok := indices[v]; ok {
+			if strings.HasPrefix(tag, "v") {
+				modules[i] = m
+			}
+			continue
+		}
+		indices[v] = len(modules)
+		modules = append(modules, m)
+	}
+
+	if len(modules) == 0 {
+		return nil, ErrModuleNotFound
+	}
+
+	return modules, nil
+}
+
+// UploadModule is not supported, new versions are published by pushing a tag to the repository
+func (s *GitStorage) UploadModule(ctx context.Context, namespace, name, provider, version string, body io.Reader) (core.Module, error) {
+	return core.Module{}, fmt.Errorf("%w: modules are published by pushing a tag to the Git repository", ErrModuleUploadFailed)
+}
+
+// gitAddressSegment matches the namespace, name and provider that are substituted into the repository pattern.
+// Other characters could change the path, query or subdirectory of the Git source address handed to clients
+var gitAddressSegment = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// repository returns the URL of the repository and the optional subdirectory of the module, which is separated by a double slash
+func (s *GitStorage) repository(namespace, name, provider string) (string, string, error) {
+	for _, segment := range []string{namespace, name, provider} {
+		if !gitAddressSegment.MatchString(segment) {
+			return "", "", fmt.Errorf("%w: %q may only contain letters, digits, dashes and underscores", ErrInvalidModule, segment)
+		}
+	}
+
+	p := strings.NewReplacer("{namespace}", namespace, "{name}", name, "{provider}", provider).Replace(s.pattern)
+	repository, subdir, _ := strings.Cut(p, "//")
+	return strings.TrimSuffix(s.baseURL, "/") + "/" + strings.Trim(repository, "/"), strings.Trim(subdir, "/"), nil
+}
+
+// gitDownloadURL formats the download URL of a tag with the Git source address syntax of Terraform
+func gitDownloadURL(repository, subdir, tag string) string {
+	return fmt.Sprintf("git::%s//%s?ref=%s", repository, subdir, tag)
+}
+
+// versionFromTag returns the module version of a tag, tags which aren't semantic versions are skipped
+func versionFromTag(tag string) (string, bool) {
+	raw := strings.TrimPrefix(tag, "v")
+	if _, err := version.NewSemver(raw); err != nil {
+		return "", false
+	}
+	return raw, true
+}
+
+// cachedListTags returns the cached tags of the repository, or lists them if they expired.
+// Failed listings aren't cached, so that a repository becomes available as soon as the Git server recovers.
+func (s *GitStorage) cachedListTags(ctx context.Context, repository string) ([]string, error) {
+	s.mu.Lock()
+	cached, ok := s.tags[repository]
+	s.mu.Unlock()
+	if ok && s.now().Before(cached.expires) {
+		return cached.tags, nil
+	}
+
+	tags, err := s.listTags(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+	if s.cacheTTL > 0 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// Expired entries of other repositories are removed, so that the cache doesn't grow with every requested module
+		now := s.now()
+		for r, c := range s.tags {
+			if !now.Before(c.expires) {
+				delete(s.tags, r)
+			}
+		}
+		s.tags[repository] = cachedTags{tags: tags, expires: now.Add(s.cacheTTL)}
+	}
+	return tags, nil
+}
+
+// listTags retrieves the tags from the ref advertisement of the Git smart HTTP protocol, which is what `git ls-remote` does
+func (s *GitStorage) listTags(ctx context.Context, repository string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, repository+"/info/refs?service=git-upload-pack", nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.username != "" || s.password != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("%w: repository %s returned status code %d", ErrModuleNotFound, repository, resp.StatusCode)
+	default:
+		return nil, fmt.Errorf("repository %s returned status code %d", repository, resp.StatusCode)
+	}
+
+	return parseTagAdvertisement(resp.Body)
+}
+
+// parseTagAdvertisement parses the pkt-line encoded refs and returns the names of the tags.
+// Peeled refs of annotated tags point to the same tag and are skipped.
+func parseTagAdvertisement(r io.Reader) ([]string, error) {
+	br := bufio.NewReader(r)
+
+	var tags []string
+	for {
+		line, err := readPktLine(br)
+		if errors.Is(err, io.EOF) {
+			return tags, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		// The first ref carries the capabilities after a NUL byte
+		line, _, _ = strings.Cut(strings.TrimSuffix(line, "\n"), "\x00")
+		_, ref, ok := strings.Cut(line, " ")
+		if !ok || !strings.HasPrefix(ref, "refs/tags/") || strings.HasSuffix(ref, "^{}") {
+			continue
+		}
+		tags = append(tags, strings.TrimPrefix(ref, "refs/tags/"))
+	}
+}
+
+// readPktLine reads a single pkt-line, flush packets are returned as empty lines
+func readPktLine(r *bufio.Reader) (string, error) {
+	prefix := make([]byte, 4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return "", err
+	}
+
+	length, err := strconv.ParseUint(string(prefix), 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid pkt-line length %q", prefix)
+	}
+	if length == 0 {
+		return "", nil
+	}
+	if length < 4 {
+		return "", fmt.Errorf("invalid pkt-line length %d", length)
+	}
+
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+// GitStorageOption provides additional options for the GitStorage.
+type GitStorageOption func(*GitStorage)
+
+// WithGitRepositoryPattern configures the path of the repositories relative to the base URL.
+// The placeholders {namespace}, {name} and {provider} are replaced with the module address,
+// a double slash separates the subdirectory of the module within the repository.
+func WithGitRepositoryPattern(pattern string) GitStorageOption {
+	return func(s *GitStorage) {
+		s.pattern = pattern
+	}
+}
+
+// WithGitCredentials configures the basic auth credentials for listing the tags.
+// The credentials are never part of the download URLs, Terraform uses its own Git credentials to clone the repository.
+func WithGitCredentials(username, password string) GitStorageOption {
+	return func(s *GitStorage) {
+		s.username = username
+		s.password = password
+	}
+}
+
+// WithGitHTTPClient configures the HTTP client for listing the tags
+func WithGitHTTPClient(client *http.Client) GitStorageOption {
+	return func(s *GitStorage) {
+		s.client = client
+	}
+}
+
+// WithGitTagCacheTTL configures the duration for which the tags of a repository are cached, the cache is disabled if it's not positive
+func WithGitTagCacheTTL(ttl time.Duration) GitStorageOption {
+	return func(s *GitStorage) {
+		s.cacheTTL = ttl
+	}
+}
+
+// NewGitStorage returns a GitStorage for the repositories located under the base URL.
+func NewGitStorage(baseURL string, options ...GitStorageOption) (*GitStorage, error) {
+	if !strings.HasPrefix(baseURL, "https://") && !strings.HasPrefix(baseURL, "http://") {
+		return nil, fmt.Errorf("git base URL %s must use http or https", baseURL)
+	}
+
+	s := &GitStorage{
+		baseURL:  baseURL,
+		pattern:  DefaultGitRepositoryPattern,
+		client:   &http.Client{Timeout: defaultGitTimeout},
+		cacheTTL: DefaultGitTagCacheTTL,
+		now:      time.Now,
+		tags:     make(map[string]cachedTags),
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,170 @@
+package module
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pktLine encodes a line of the Git smart HTTP protocol
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
+
+func refAdvertisement(refs ...string) string {
+	var b strings.Builder
+	b.WriteString(pktLine("# service=git-upload-pack\n"))
+	b.WriteString("0000")
+	for i, ref := range refs {
+		line := "0123456789abcdef0123456789abcdef01234567 " + ref
+		if i == 0 {
+			line += "\x00multi_ack side-band-64k"
+		}
+		b.WriteString(pktLine(line + "\n"))
+	}
+	b.WriteString("0000")
+	return b.String()
+}
+
+func TestGitDownloadURL(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		want    string
+	}{
+		{
+			pattern: DefaultGitRepositoryPattern,
+			want:    "git::https://git.example.com/acme/terraform-aws-vpc//?ref=v1.0.0",
+		},
+		{
+			pattern: "platform/modules.git//{provider}/{name}",
+			want:    "git::https://git.example.com/platform/modules.git//aws/vpc?ref=v1.0.0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			s, err := NewGitStorage("https://git.example.com/", WithGitRepositoryPattern(tc.pattern))
+			require.NoError(t, err)
+
+			repository, subdir, err := s.repository("acme", "vpc", "aws")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, gitDownloadURL(repository, subdir, "v1.0.0"))
+		})
+	}
+
+	_, err := NewGitStorage("git@git.example.com:acme")
+	assert.Error(t, err)
+}
+
+func TestVersionFromTag(t *testing.T) {
+	testCases := []struct {
+		tag     string
+		version string
+		ok      bool
+	}{
+		{tag: "v1.2.3", version: "1.2.3", ok: true},
+		{tag: "1.2.3", version: "1.2.3", ok: true},
+		{tag: "v2.0.0-rc.1", version: "2.0.0-rc.1", ok: true},
+		{tag: "latest"},
+		{tag: "release-1.2.3"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			v, ok := versionFromTag(tc.tag)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.version, v)
+		})
+	}
+}
+
+func TestGitStorage_ListModuleVersions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/acme/terraform-aws-vpc/info/refs" || r.URL.Query().Get("service") != "git-upload-pack" {
+			http.NotFound(w, r)
+			return
+		}
+		if user, password, _ := r.BasicAuth(); user != "registry" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		fmt.Fprint(w, refAdvertisement("HEAD", "refs/heads/main", "refs/tags/latest", "refs/tags/v1.0.0", "refs/tags/v1.0.0^{}", "refs/tags/1.1.0"))
+	}))
+	defer srv.Close()
+
+	s, err := NewGitStorage(srv.URL, WithGitCredentials("registry", "secret"))
+	require.NoError(t, err)
+
+	modules, err := s.ListModuleVersions(context.Background(), "acme", "vpc", "aws")
+	require.NoError(t, err)
+	require.Len(t, modules, 2)
+	assert.Equal(t, "1.0.0", modules[0].Version)
+	assert.Equal(t, "git::"+srv.URL+"/acme/terraform-aws-vpc//?ref=v1.0.0", modules[0].DownloadURL)
+	assert.Equal(t, "1.1.0", modules[1].Version)
+	assert.Equal(t, "git::"+srv.URL+"/acme/terraform-aws-vpc//?ref=1.1.0", modules[1].DownloadURL)
+
+	m, err := s.GetModule(context.Background(), "acme", "vpc", "aws", "1.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, modules[1], m)
+
+	_, err = s.GetModule(context.Background(), "acme", "vpc", "aws", "2.0.0")
+	assert.ErrorIs(t, err, ErrModuleNotFound)
+
+	_, err = s.ListModuleVersions(context.Background(), "acme", "subnet", "aws")
+	assert.ErrorIs(t, err, ErrModuleNotFound)
+
+	_, err = s.UploadModule(context.Background(), "acme", "vpc", "aws", "1.2.0", strings.NewReader(""))
+	assert.ErrorIs(t, err, ErrModuleUploadFailed)
+}
+
+func TestGitStorage_invalidModule(t *testing.T) {
+	s, err := NewGitStorage("https://git.example.com")
+	require.NoError(t, err)
+
+	for _, name := range []string{"vpc?ref=main", "vpc//modules", "vpc#main", "..", "vpc/../subnet"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.ListModuleVersions(context.Background(), "acme", name, "aws")
+			assert.ErrorIs(t, err, ErrInvalidModule)
+		})
+	}
+}
+
+func TestGitStorage_tags(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, refAdvertisement("refs/tags/1.0.0", "refs/tags/v1.0.0", "refs/tags/v1.1.0"))
+	}))
+	defer srv.Close()
+
+	s, err := NewGitStorage(srv.URL)
+	require.NoError(t, err)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	// The prefixed tag of a duplicate version is preferred
+	modules, err := s.ListModuleVersions(context.Background(), "acme", "vpc", "aws")
+	require.NoError(t, err)
+	require.Len(t, modules, 2)
+	assert.Equal(t, "1.0.0", modules[0].Version)
+	assert.Equal(t, "git::"+srv.URL+"/acme/terraform-aws-vpc//?ref=v1.0.0", modules[0].DownloadURL)
+	assert.Equal(t, "1.1.0", modules[1].Version)
+
+	// The tags are reused until the TTL expires
+	_, err = s.GetModule(context.Background(), "acme", "vpc", "aws", "1.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+
+	now = now.Add(DefaultGitTagCacheTTL)
+	_, err = s.GetModule(context.Background(), "acme", "vpc", "aws", "1.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+}
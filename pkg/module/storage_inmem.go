@@ -1,11 +1,14 @@
 package module
 
 import (
+	"cmp"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"path"
+	"slices"
 	"sync"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
@@ -40,6 +43,21 @@ func (s *InmemStorage) GetModule(_ context.Context, namespace, name, provider, v
 	return module, nil
 }
 
+// ModuleExists reports whether a module version has been uploaded to the in-memory storage
+func (s *InmemStorage) ModuleExists(_ context.Context, namespace, name, provider, version string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m := core.Module{
+		Namespace: namespace,
+		Name:      name,
+		Provider:  provider,
+		Version:   version,
+	}
+	_, ok := s.modules[m.ID(true)]
+	return ok, nil
+}
+
 func (s *InmemStorage) ListModuleVersions(ctx context.Context, namespace, name, provider string) ([]core.Module, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -100,6 +118,37 @@ func (s *InmemStorage) UploadModule(ctx context.Context, namespace, name, provid
 	return s.GetModule(ctx, namespace, name, provider, version)
 }
 
+// ListModulesByProvider pages through the modules with the base64 encoded <namespace>/<name> of the last module of the previous page as token
+func (s *InmemStorage) ListModulesByProvider(_ context.Context, provider string, limit int, token string) ([]core.Module, string, error) {
+	after, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: cursor", ErrInvalidQuery)
+	}
+
+	s.mu.RLock()
+	seen := make(map[string]core.Module)
+	for _, m := range s.modules {
+		if m.Provider == provider && m.Namespace+"/"+m.Name > string(after) {
+			seen[m.Namespace+"/"+m.Name] = core.Module{Namespace: m.Namespace, Name: m.Name, Provider: m.Provider}
+		}
+	}
+	s.mu.RUnlock()
+
+	var modules []core.Module
+	for _, m := range seen {
+		modules = append(modules, m)
+	}
+	slices.SortFunc(modules, func(a, b core.Module) int {
+		return cmp.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+
+	if len(modules) > limit {
+		last := modules[limit-1]
+		return modules[:limit], base64.RawURLEncoding.EncodeToString([]byte(last.Namespace + "/" + last.Name)), nil
+	}
+	return modules, "", nil
+}
+
 func (s *InmemStorage) MigrateModules(ctx context.Context, dryRun bool) error {
 	panic("MigrateModules should not be called for InmemStorage")
 }
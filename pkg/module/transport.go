@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/boring-registry/boring-registry/pkg/auth"
 	"github.com/boring-registry/boring-registry/pkg/core"
 	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+	"github.com/boring-registry/boring-registry/pkg/openapi"
 
 	"github.com/go-kit/kit/auth/jwt"
 	"github.com/go-kit/kit/endpoint"
@@ -24,20 +27,104 @@ const (
 	varVersion   muxVar = "version"
 )
 
+// Routes describes the endpoints of MakeHandler that aren't part of the module registry protocol for the OpenAPI document
+var Routes = []openapi.Route{
+	{
+		Method:  http.MethodGet,
+		Path:    "/",
+		Summary: "List the modules for a provider",
+		Parameters: []openapi.Parameter{
+			openapi.QueryParameter("provider", "string", "The provider of the modules"),
+			openapi.QueryParameter("limit", "integer", "The maximum number of modules per page"),
+			openapi.QueryParameter("cursor", "string", "The cursor of the next page from the previous response"),
+		},
+		Responses: map[int]string{
+			http.StatusOK:         "A page of the modules",
+			http.StatusBadRequest: "The limit, cursor or provider is invalid",
+		},
+		Authenticated: true,
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/{namespace}/{name}/{provider}/latest",
+		Summary: "Get the latest version of a module",
+		Parameters: []openapi.Parameter{
+			openapi.PathParameter("namespace", "The namespace of the module"),
+			openapi.PathParameter("name", "The name of the module"),
+			openapi.PathParameter("provider", "The provider of the module"),
+			openapi.QueryParameter("include_prerelease", "boolean", "Consider pre-release versions"),
+		},
+		Responses: map[int]string{
+			http.StatusOK:       "The latest version",
+			http.StatusNotFound: "The module doesn't exist",
+		},
+		Authenticated: true,
+	},
+	{
+		Method:  http.MethodHead,
+		Path:    "/{namespace}/{name}/{provider}/{version}",
+		Summary: "Check that a module version exists",
+		Parameters: []openapi.Parameter{
+			openapi.PathParameter("namespace", "The namespace of the module"),
+			openapi.PathParameter("name", "The name of the module"),
+			openapi.PathParameter("provider", "The provider of the module"),
+			openapi.PathParameter("version", "The version of the module"),
+		},
+		Responses: map[int]string{
+			http.StatusOK:       "The module version exists",
+			http.StatusNotFound: "The module version doesn't exist",
+		},
+		Authenticated: true,
+	},
+}
+
 // MakeHandler returns a fully initialized http.Handler.
-func MakeHandler(svc Service, auth endpoint.Middleware, metrics *o11y.ModuleMetrics, instrumentation o11y.Middleware, options ...httptransport.ServerOption) http.Handler {
+func MakeHandler(svc Service, authMiddleware endpoint.Middleware, metrics *o11y.ModuleMetrics, instrumentation o11y.Middleware, options ...httptransport.ServerOption) http.Handler {
 	r := mux.NewRouter().StrictSlash(true)
+	r.Methods("GET").Path(`/`).Handler(
+		instrumentation.WrapHandler(
+			httptransport.NewServer(
+				authMiddleware(providerModulesEndpoint(svc)),
+				decodeProviderModulesRequest,
+				httptransport.EncodeJSONResponse,
+				append(
+					options,
+					httptransport.ServerBefore(jwt.HTTPToContext()),
+				)...,
+			),
+		),
+	)
 
 	r.Methods("GET").Path(`/{namespace}/{name}/{provider}/versions`).Handler(
 		instrumentation.WrapHandler(
 			httptransport.NewServer(
-				auth(listEndpoint(svc, metrics)),
+				authMiddleware(listEndpoint(svc, metrics)),
 				decodeListRequest,
+				encodeListResponse,
+				append(
+					options,
+					httptransport.ServerBefore(extractMuxVars(varNamespace, varName, varProvider)),
+					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
+					httptransport.ServerBefore(core.DownloadModeToContext),
+					httptransport.ServerBefore(core.IfNoneMatchToContext),
+				)...,
+			),
+		),
+	)
+
+	r.Methods("GET").Path(`/{namespace}/{name}/{provider}/latest`).Handler(
+		instrumentation.WrapHandler(
+			httptransport.NewServer(
+				authMiddleware(latestEndpoint(svc)),
+				decodeLatestRequest,
 				httptransport.EncodeJSONResponse,
 				append(
 					options,
 					httptransport.ServerBefore(extractMuxVars(varNamespace, varName, varProvider)),
 					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
+					httptransport.ServerBefore(core.DownloadModeToContext),
 				)...,
 			),
 		),
@@ -46,13 +133,31 @@ func MakeHandler(svc Service, auth endpoint.Middleware, metrics *o11y.ModuleMetr
 	r.Methods("GET").Path(`/{namespace}/{name}/{provider}/{version}/download`).Handler(
 		instrumentation.WrapHandler(
 			httptransport.NewServer(
-				auth(downloadEndpoint(svc, metrics)),
+				authMiddleware(downloadEndpoint(svc, metrics)),
 				decodeDownloadRequest,
 				encodeDownloadResponse,
 				append(
 					options,
 					httptransport.ServerBefore(extractMuxVars(varNamespace, varName, varProvider, varVersion)),
 					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
+					httptransport.ServerBefore(core.DownloadModeToContext),
+				)...,
+			),
+		),
+	)
+
+	r.Methods("HEAD").Path(`/{namespace}/{name}/{provider}/{version}`).Handler(
+		instrumentation.WrapHandler(
+			httptransport.NewServer(
+				authMiddleware(existsEndpoint(svc)),
+				decodeDownloadRequest,
+				encodeExistsResponse,
+				append(
+					options,
+					httptransport.ServerBefore(extractMuxVars(varNamespace, varName, varProvider, varVersion)),
+					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
 				)...,
 			),
 		),
@@ -84,6 +189,48 @@ func decodeListRequest(ctx context.Context, r *http.Request) (interface{}, error
 	}, nil
 }
 
+func decodeLatestRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	list, err := decodeListRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	req := list.(listRequest)
+
+	includePrerelease := false
+	if v := r.URL.Query().Get("include_prerelease"); v != "" {
+		includePrerelease, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: include_prerelease", ErrInvalidQuery)
+		}
+	}
+
+	return latestRequest{
+		namespace:         req.namespace,
+		name:              req.name,
+		provider:          req.provider,
+		includePrerelease: includePrerelease,
+	}, nil
+}
+
+func decodeProviderModulesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+
+	limit := DefaultProviderModulesLimit
+	if l := query.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			return nil, fmt.Errorf("%w: limit", ErrInvalidQuery)
+		}
+	}
+
+	return providerModulesRequest{
+		provider: query.Get("provider"),
+		limit:    limit,
+		cursor:   query.Get("cursor"),
+	}, nil
+}
+
 func decodeDownloadRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	namespace, ok := ctx.Value(varNamespace).(string)
 	if !ok {
@@ -115,14 +262,12 @@ func decodeDownloadRequest(ctx context.Context, r *http.Request) (interface{}, e
 
 // ErrorEncoder translates domain specific errors to HTTP status codes
 func ErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
-
-	if errors.Is(err, ErrModuleNotFound) {
-		w.WriteHeader(http.StatusNotFound)
-	} else {
-		w.WriteHeader(core.GenericError(err))
-	}
-
-	core.HandleErrorResponse(err, w)
+	core.EncodeError(err, w,
+		core.ErrorStatus{Err: ErrModuleNotFound, StatusCode: http.StatusNotFound},
+		core.ErrorStatus{Err: ErrInvalidQuery, StatusCode: http.StatusBadRequest},
+		core.ErrorStatus{Err: ErrInvalidModule, StatusCode: http.StatusBadRequest},
+		core.ErrorStatus{Err: errors.ErrUnsupported, StatusCode: http.StatusNotImplemented},
+	)
 }
 
 func extractMuxVars(keys ...muxVar) httptransport.RequestFunc {
@@ -137,9 +282,34 @@ func extractMuxVars(keys ...muxVar) httptransport.RequestFunc {
 	}
 }
 
+// encodeListResponse sends the ETag of the version set, so that unchanged listings are answered with 304 Not Modified
+func encodeListResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	var versions []string
+	for _, m := range response.(listResponse).Modules {
+		for _, v := range m.Versions {
+			versions = append(versions, v.Version)
+		}
+	}
+
+	if core.NotModified(ctx, w, core.NewETag(versions)) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	return httptransport.EncodeJSONResponse(ctx, w, response)
+}
+
 func encodeDownloadResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	res := response.(downloadResponse)
 	w.Header().Set("X-Terraform-Get", res.url)
+	if res.checksum != "" {
+		w.Header().Set("X-Checksum-Sha256", res.checksum)
+	}
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
+
+// encodeExistsResponse responds to HEAD requests without a body
+func encodeExistsResponse(_ context.Context, w http.ResponseWriter, _ interface{}) error {
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
@@ -0,0 +1,311 @@
+package module
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/auth"
+	"github.com/boring-registry/boring-registry/pkg/core"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorEncoder(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+	}{
+		{err: ErrModuleNotFound, wantStatus: http.StatusNotFound},
+		{err: ErrInvalidQuery, wantStatus: http.StatusBadRequest},
+		{err: core.ErrObjectNotFound, wantStatus: http.StatusNotFound},
+		{err: core.ErrUnauthorized, wantStatus: http.StatusUnauthorized},
+		{err: ErrModuleUploadFailed, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ErrorEncoder(context.Background(), fmt.Errorf("wrapped: %w", tt.err), rec)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+type downloadStorage struct {
+	Storage
+	url      string
+	checksum string
+}
+
+func (d *downloadStorage) GetModule(_ context.Context, namespace, name, provider, version string) (core.Module, error) {
+	return core.Module{Namespace: namespace, Name: name, Provider: provider, Version: version, DownloadURL: d.url, Checksum: d.checksum}, nil
+}
+
+type noopInstrumentation struct{}
+
+func (noopInstrumentation) WrapHandler(handler http.Handler) http.HandlerFunc {
+	return handler.ServeHTTP
+}
+
+func TestMakeHandler_downloadMode(t *testing.T) {
+	storage := &downloadStorage{
+		url:      "https://bucket.s3.eu-central-1.amazonaws.com/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz?X-Amz-Signature=abc",
+		checksum: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	}
+
+	metrics := &o11y.ModuleMetrics{
+		ListVersions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "list_versions"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel}),
+		Download:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "download"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel, o11y.VersionLabel}),
+	}
+	svc := NewService(storage, core.NewProxyUrlService(true, "/v1/proxy"))
+	handler := MakeHandler(svc, func(next endpoint.Endpoint) endpoint.Endpoint { return next }, metrics, noopInstrumentation{}, httptransport.ServerErrorEncoder(ErrorEncoder))
+
+	tests := []struct {
+		name   string
+		target string
+		header map[string]string
+		direct bool
+	}{
+		{
+			name:   "proxy by default",
+			target: "/acme/vpc/aws/1.0.0/download",
+		},
+		{
+			name:   "direct with query parameter",
+			target: "/acme/vpc/aws/1.0.0/download?download=direct",
+			direct: true,
+		},
+		{
+			name:   "direct with header",
+			target: "/acme/vpc/aws/1.0.0/download",
+			header: map[string]string{core.DownloadModeHeader: core.DownloadModeDirect},
+			direct: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusNoContent, rec.Code)
+			assert.Equal(t, storage.checksum, rec.Header().Get("X-Checksum-Sha256"))
+			if tt.direct {
+				assert.Equal(t, storage.url, rec.Header().Get("X-Terraform-Get"))
+			} else {
+				assert.Equal(t, "/v1/proxy/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz?X-Amz-Signature=abc", rec.Header().Get("X-Terraform-Get"))
+			}
+		})
+	}
+}
+
+func TestMakeHandler_terraformGet(t *testing.T) {
+	metrics := &o11y.ModuleMetrics{
+		ListVersions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "list_versions"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel}),
+		Download:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "download"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel, o11y.VersionLabel}),
+	}
+
+	tests := []struct {
+		name      string
+		url       string
+		wantProxy string
+	}{
+		{
+			name:      "s3 tar.gz",
+			url:       "https://bucket.s3.eu-central-1.amazonaws.com/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz?X-Amz-Signature=abc",
+			wantProxy: "/v1/proxy/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz?X-Amz-Signature=abc",
+		},
+		{
+			name:      "gcs zip",
+			url:       "https://storage.googleapis.com/bucket/registry/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.zip?X-Goog-Signature=abc",
+			wantProxy: "/v1/proxy/bucket/registry/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.zip?X-Goog-Signature=abc",
+		},
+		{
+			name:      "azure tar.zst",
+			url:       "https://account.blob.core.windows.net/container/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.zst?sig=abc",
+			wantProxy: "/v1/proxy/container/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.zst?sig=abc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terraformGet := func(proxyEnabled bool) string {
+				t.Helper()
+				svc := NewService(&downloadStorage{url: tt.url}, core.NewProxyUrlService(proxyEnabled, "/v1/proxy"))
+				handler := MakeHandler(svc, func(next endpoint.Endpoint) endpoint.Endpoint { return next }, metrics, noopInstrumentation{}, httptransport.ServerErrorEncoder(ErrorEncoder))
+
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/acme/vpc/aws/1.0.0/download", nil))
+				require.Equal(t, http.StatusNoContent, rec.Code)
+				assert.Empty(t, rec.Body.Bytes())
+				return rec.Header().Get("X-Terraform-Get")
+			}
+
+			direct := terraformGet(false)
+			proxied := terraformGet(true)
+			assert.Equal(t, tt.url, direct)
+			assert.Equal(t, tt.wantProxy, proxied)
+			assert.NotEqual(t, direct, proxied)
+
+			// Terraform derives the decompression from the file extension in the path of the URL
+			u, err := url.Parse(proxied)
+			require.NoError(t, err)
+			assert.Equal(t, path.Base(strings.SplitN(tt.url, "?", 2)[0]), path.Base(u.Path))
+		})
+	}
+}
+
+func TestMakeHandler_exists(t *testing.T) {
+	metrics := &o11y.ModuleMetrics{
+		ListVersions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "list_versions"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel}),
+		Download:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "download"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel, o11y.VersionLabel}),
+	}
+	storage := NewInmemStorage()
+	_, err := storage.UploadModule(context.Background(), "acme", "vpc", "aws", "1.0.0", strings.NewReader("archive"))
+	require.NoError(t, err)
+	svc := NewService(storage, core.NewProxyUrlService(false, "/v1/proxy"))
+
+	tests := []struct {
+		name           string
+		target         string
+		authMiddleware endpoint.Middleware
+		wantStatus     int
+	}{
+		{
+			name:       "existing version",
+			target:     "/acme/vpc/aws/1.0.0",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unknown version",
+			target:     "/acme/vpc/aws/2.0.0",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   "unauthorized",
+			target: "/acme/vpc/aws/1.0.0",
+			authMiddleware: func(endpoint.Endpoint) endpoint.Endpoint {
+				return func(context.Context, interface{}) (interface{}, error) { return nil, core.ErrUnauthorized }
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authMiddleware := tt.authMiddleware
+			if authMiddleware == nil {
+				authMiddleware = func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+			}
+			handler := MakeHandler(svc, authMiddleware, metrics, noopInstrumentation{}, httptransport.ServerErrorEncoder(ErrorEncoder))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, tt.target, nil))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Empty(t, rec.Header().Get("X-Terraform-Get"))
+		})
+	}
+}
+
+func TestMakeHandler_listETag(t *testing.T) {
+	ctx := context.Background()
+	storage := NewInmemStorage()
+	_, err := storage.UploadModule(ctx, "acme", "vpc", "aws", "1.0.0", strings.NewReader(""))
+	require.NoError(t, err)
+
+	metrics := &o11y.ModuleMetrics{
+		ListVersions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "list_versions"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel}),
+		Download:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "download"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel, o11y.VersionLabel}),
+	}
+	svc := NewService(storage, core.NewProxyUrlService(false, ""))
+	handler := MakeHandler(svc, func(next endpoint.Endpoint) endpoint.Endpoint { return next }, metrics, noopInstrumentation{}, httptransport.ServerErrorEncoder(ErrorEncoder))
+
+	list := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/acme/vpc/aws/versions", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := list("")
+	require.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	rec = list(etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.Bytes())
+	assert.Equal(t, etag, rec.Header().Get("ETag"))
+
+	_, err = storage.UploadModule(ctx, "acme", "vpc", "aws", "1.1.0", strings.NewReader(""))
+	require.NoError(t, err)
+
+	rec = list(etag)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+	assert.Contains(t, rec.Body.String(), "1.1.0")
+}
+
+func TestMakeHandler_providerModules(t *testing.T) {
+	ctx := context.Background()
+	storage := NewInmemStorage()
+	for _, m := range []core.Module{
+		{Namespace: "acme", Name: "vpc", Provider: "aws", Version: "1.0.0"},
+		{Namespace: "acme", Name: "vpc", Provider: "aws", Version: "1.1.0"},
+		{Namespace: "acme", Name: "vpc", Provider: "google", Version: "1.0.0"},
+		{Namespace: "beta", Name: "network", Provider: "aws", Version: "0.1.0"},
+		{Namespace: "internal", Name: "secrets", Provider: "aws", Version: "1.0.0"},
+		{Namespace: "zeta", Name: "eks", Provider: "aws", Version: "2.0.0"},
+	} {
+		_, err := storage.UploadModule(ctx, m.Namespace, m.Name, m.Provider, m.Version, strings.NewReader(""))
+		require.NoError(t, err)
+	}
+
+	metrics := &o11y.ModuleMetrics{
+		ListVersions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "list_versions"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel}),
+		Download:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "download"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.ProviderLabel, o11y.VersionLabel}),
+	}
+	svc := ACLMiddleware(auth.ACL{"internal": {Read: []string{"platform-team"}}})(NewService(storage, core.NewProxyUrlService(false, "")))
+	handler := MakeHandler(svc, func(next endpoint.Endpoint) endpoint.Endpoint { return next }, metrics, noopInstrumentation{}, httptransport.ServerErrorEncoder(ErrorEncoder))
+
+	list := func(query string) (*httptest.ResponseRecorder, providerModulesResponse) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?"+query, nil))
+		var res providerModulesResponse
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		}
+		return rec, res
+	}
+
+	rec, res := list("provider=aws&limit=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []providerModule{{Namespace: "acme", Name: "vpc", Provider: "aws"}, {Namespace: "beta", Name: "network", Provider: "aws"}}, res.Modules)
+	require.NotEmpty(t, res.NextCursor)
+
+	// The modules of the internal namespace are omitted, as the caller isn't allowed to read it
+	rec, res = list("provider=aws&limit=2&cursor=" + url.QueryEscape(res.NextCursor))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []providerModule{{Namespace: "zeta", Name: "eks", Provider: "aws"}}, res.Modules)
+	assert.Empty(t, res.NextCursor)
+
+	for _, query := range []string{"", "provider=aws/acme", "provider=aws&limit=0", "provider=aws&limit=1001", "provider=aws&limit=abc", "provider=aws&cursor=%25"} {
+		rec, _ := list(query)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
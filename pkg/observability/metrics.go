@@ -14,23 +14,48 @@ const (
 	OsLabel           = "os"
 	ArchLabel         = "arch"
 	ProxyFailureLabel = "failure"
+	RateLimitKeyLabel = "key"
+	BackendLabel      = "backend"
+	OperationLabel    = "operation"
+	OutcomeLabel      = "outcome"
 
-	ProxyFailureUrl      = "bad-url"
-	ProxyFailureRequest  = "invalid-request"
-	ProxyFailureDownload = "download"
+	ProxyFailureUrl       = "bad-url"
+	ProxyFailureRequest   = "invalid-request"
+	ProxyFailureDownload  = "download"
+	ProxyFailureIntegrity = "integrity"
+	ProxyFailureSaturated = "saturated"
+
+	RateLimitKeySubject     = "subject"
+	RateLimitKeyToken       = "token"
+	RateLimitKeyIP          = "ip"
+	RateLimitKeyAuthFailure = "auth_failure"
+
+	OutcomeSuccess  = "success"
+	OutcomeNotFound = "not_found"
+	OutcomeError    = "error"
 )
 
 type ServerMetrics struct {
-	Mirror   *MirrorMetrics
-	Module   *ModuleMetrics
-	Provider *ProviderMetrics
-	Proxy    *ProxyMetrics
-	Http     *HttpMetrics
+	Mirror    *MirrorMetrics
+	Module    *ModuleMetrics
+	Provider  *ProviderMetrics
+	Proxy     *ProxyMetrics
+	RateLimit *RateLimitMetrics
+	Storage   *StorageMetrics
+	Http      *HttpMetrics
 }
 type MirrorMetrics struct {
 	ListProviderVersions     *prometheus.CounterVec
 	ListProviderInstallation *prometheus.CounterVec
 	RetrieveProviderArchive  *prometheus.CounterVec
+
+	// UpstreamHit, MirrorHit and UpstreamFallback count the responses of the pull-through mirror by their source
+	UpstreamHit      *prometheus.CounterVec
+	MirrorHit        *prometheus.CounterVec
+	UpstreamFallback *prometheus.CounterVec
+
+	// SignatureVerificationFailures counts the mirrored SHA256SUMS files that aren't signed by any of the mirrored signing keys
+	SignatureVerificationFailures *prometheus.CounterVec
 }
 type ModuleMetrics struct {
 	ListVersions *prometheus.CounterVec
@@ -43,7 +68,19 @@ type ProviderMetrics struct {
 type ProxyMetrics struct {
 	Download *prometheus.CounterVec
 	Failure  *prometheus.CounterVec
+	InFlight prometheus.Gauge
+}
+type RateLimitMetrics struct {
+	Throttled *prometheus.CounterVec
+}
+type StorageMetrics struct {
+	Operations *prometheus.CounterVec
+	Duration   *prometheus.HistogramVec
+
+	// NearExpiryPresigns counts the presigned URLs of proxied downloads whose expiry was extended to the minimum headroom
+	NearExpiryPresigns *prometheus.CounterVec
 }
+
 type HttpMetrics struct {
 	RequestsTotal   *prometheus.CounterVec
 	RequestDuration *prometheus.HistogramVec
@@ -59,6 +96,8 @@ func NewMetrics(buckets []float64) *ServerMetrics {
 	providersSubsystem := "providers"
 	proxySubsystem := "proxy"
 	modulesSubsystem := "modules"
+	rateLimitSubsystem := "rate_limit"
+	storageSubsystem := "storage"
 	requestSubsystem := "request"
 	responseSubsystem := "response"
 
@@ -95,6 +134,41 @@ func NewMetrics(buckets []float64) *ServerMetrics {
 				},
 				[]string{HostnameLabel, NamespaceLabel, NameLabel, VersionLabel, OsLabel, ArchLabel},
 			),
+			UpstreamHit: promauto.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: boringNamespace,
+					Subsystem: mirrorsSubsystem,
+					Name:      "upstream_hit_total",
+					Help:      "The total number of pull-through mirror responses served from the upstream registry",
+				},
+				[]string{HostnameLabel},
+			),
+			MirrorHit: promauto.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: boringNamespace,
+					Subsystem: mirrorsSubsystem,
+					Name:      "mirror_hit_total",
+					Help:      "The total number of pull-through mirror archives served from the storage backend",
+				},
+				[]string{HostnameLabel},
+			),
+			UpstreamFallback: promauto.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: boringNamespace,
+					Subsystem: mirrorsSubsystem,
+					Name:      "upstream_fallback_total",
+					Help:      "The total number of pull-through mirror responses served from the storage backend instead of the upstream registry",
+				},
+				[]string{HostnameLabel},
+			),
+			SignatureVerificationFailures: promauto.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: boringNamespace,
+					Name:      "provider_signature_verification_failures_total",
+					Help:      "The total number of mirrored providers whose SHA256SUMS signature failed the verification",
+				},
+				[]string{HostnameLabel, NamespaceLabel, NameLabel},
+			),
 		},
 		Provider: &ProviderMetrics{
 			ListVersions: promauto.NewCounterVec(
@@ -155,6 +229,55 @@ func NewMetrics(buckets []float64) *ServerMetrics {
 				},
 				[]string{ProxyFailureLabel},
 			),
+			InFlight: promauto.NewGauge(
+				prometheus.GaugeOpts{
+					Namespace: boringNamespace,
+					Subsystem: proxySubsystem,
+					Name:      "downloads_in_flight",
+					Help:      "The number of downloads that are currently proxied",
+				},
+			),
+		},
+		RateLimit: &RateLimitMetrics{
+			Throttled: promauto.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: boringNamespace,
+					Subsystem: rateLimitSubsystem,
+					Name:      "throttled_total",
+					Help:      "The total number of requests rejected because the rate limit was exceeded",
+				},
+				[]string{RateLimitKeyLabel},
+			),
+		},
+		Storage: &StorageMetrics{
+			Operations: promauto.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: boringNamespace,
+					Subsystem: storageSubsystem,
+					Name:      "operations_total",
+					Help:      "The total number of storage backend operations",
+				},
+				[]string{BackendLabel, OperationLabel, OutcomeLabel},
+			),
+			Duration: promauto.NewHistogramVec(
+				prometheus.HistogramOpts{
+					Namespace: boringNamespace,
+					Subsystem: storageSubsystem,
+					Name:      "operation_duration_seconds",
+					Help:      "The storage backend operation latencies in seconds",
+					Buckets:   buckets,
+				},
+				[]string{BackendLabel, OperationLabel, OutcomeLabel},
+			),
+			NearExpiryPresigns: promauto.NewCounterVec(
+				prometheus.CounterOpts{
+					Namespace: boringNamespace,
+					Subsystem: storageSubsystem,
+					Name:      "near_expiry_presigns_total",
+					Help:      "The total number of presigned URLs of proxied downloads whose expiry was extended to the minimum headroom",
+				},
+				[]string{BackendLabel},
+			),
 		},
 		Http: &HttpMetrics{
 			RequestsTotal: promauto.NewCounterVec(
@@ -0,0 +1,229 @@
+// Package openapi describes the registry's own HTTP endpoints as an OpenAPI 3 document.
+// The Terraform protocols are standardized and not part of the document.
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Version is the version of the OpenAPI specification the documents conform to
+	Version = "3.0.3"
+
+	bearerAuth = "bearerAuth"
+)
+
+var pathParameter = regexp.MustCompile(`{([^}]+)}`)
+
+// Route describes an endpoint, its Path is relative to the prefix the handler is mounted under
+type Route struct {
+	Method     string
+	Path       string
+	Summary    string
+	Parameters []Parameter
+	// Responses maps the status codes to their descriptions
+	Responses map[int]string
+	// Authenticated routes require a bearer token
+	Authenticated bool
+}
+
+// Parameter is a path or query parameter of a Route
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Schema      Schema `json:"schema"`
+}
+
+// PathParameter returns a required path parameter of the string type
+func PathParameter(name, description string) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: Schema{Type: "string"}}
+}
+
+// QueryParameter returns an optional query parameter of the given type
+func QueryParameter(name, schemaType, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: Schema{Type: schemaType}}
+}
+
+type Schema struct {
+	Type string `json:"type"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Response struct {
+	Description string `json:"description"`
+}
+
+type Operation struct {
+	Summary    string                `json:"summary,omitempty"`
+	Parameters []Parameter           `json:"parameters,omitempty"`
+	Responses  map[string]Response   `json:"responses"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+// PathItem maps the lowercase HTTP methods to their operations
+type PathItem map[string]*Operation
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+type Components struct {
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// Document is an OpenAPI 3 document
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Add adds the routes of a handler mounted under prefix to the document
+func (d *Document) Add(prefix string, routes ...Route) {
+	for _, r := range routes {
+		op := &Operation{
+			Summary:    r.Summary,
+			Parameters: r.Parameters,
+			Responses:  make(map[string]Response, len(r.Responses)),
+		}
+		for status, description := range r.Responses {
+			op.Responses[strconv.Itoa(status)] = Response{Description: description}
+		}
+		if r.Authenticated {
+			op.Security = []map[string][]string{{bearerAuth: {}}}
+			op.Responses[strconv.Itoa(http.StatusUnauthorized)] = Response{Description: "The token is missing or invalid"}
+			d.Components.SecuritySchemes[bearerAuth] = SecurityScheme{Type: "http", Scheme: "bearer"}
+		}
+
+		p := prefix + r.Path
+		if d.Paths[p] == nil {
+			d.Paths[p] = make(PathItem)
+		}
+		d.Paths[p][strings.ToLower(r.Method)] = op
+	}
+}
+
+// AddHandler adds the routes of a handler mounted under prefix to the document.
+// Handlers that are a mux.Router are walked, so that only the registered routes are described: routes without a description,
+// like the ones of the Terraform protocols, are left out, and descriptions of routes that aren't registered are an error.
+// The routes of other handlers are added as they are.
+func (d *Document) AddHandler(prefix string, handler http.Handler, routes ...Route) error {
+	router, ok := handler.(*mux.Router)
+	if !ok {
+		d.Add(prefix, routes...)
+		return nil
+	}
+
+	registered := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			registered[method+" "+template] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range routes {
+		if !registered[r.Method+" "+r.Path] {
+			return fmt.Errorf("the route %s %s%s is described, but not registered", r.Method, prefix, r.Path)
+		}
+	}
+	d.Add(prefix, routes...)
+	return nil
+}
+
+// Validate checks the structural requirements of the OpenAPI specification, which client generators rely on
+func (d *Document) Validate() error {
+	if !strings.HasPrefix(d.OpenAPI, "3.") {
+		return fmt.Errorf("unsupported OpenAPI version %q", d.OpenAPI)
+	}
+	if d.Info.Title == "" || d.Info.Version == "" {
+		return errors.New("the info object requires a title and a version")
+	}
+	if len(d.Paths) == 0 {
+		return errors.New("the document has no paths")
+	}
+
+	for p, item := range d.Paths {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("path %s must start with a slash", p)
+		}
+		var templated []string
+		for _, m := range pathParameter.FindAllStringSubmatch(p, -1) {
+			templated = append(templated, m[1])
+		}
+
+		for method, op := range item {
+			if !slices.Contains([]string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}, method) {
+				return fmt.Errorf("%s has the unknown method %s", p, method)
+			}
+			if len(op.Responses) == 0 {
+				return fmt.Errorf("%s %s has no responses", method, p)
+			}
+			for _, requirement := range op.Security {
+				for scheme := range requirement {
+					if _, ok := d.Components.SecuritySchemes[scheme]; !ok {
+						return fmt.Errorf("%s %s references the undefined security scheme %s", method, p, scheme)
+					}
+				}
+			}
+
+			var declared []string
+			for _, param := range op.Parameters {
+				switch param.In {
+				case "path":
+					if !param.Required {
+						return fmt.Errorf("path parameter %s of %s %s must be required", param.Name, method, p)
+					}
+					declared = append(declared, param.Name)
+				case "query", "header", "cookie":
+				default:
+					return fmt.Errorf("parameter %s of %s %s has the unknown location %s", param.Name, method, p, param.In)
+				}
+			}
+			slices.Sort(declared)
+			if !slices.Equal(declared, slices.Sorted(slices.Values(templated))) {
+				return fmt.Errorf("the path parameters of %s %s don't match the path template", method, p)
+			}
+		}
+	}
+	return nil
+}
+
+// NewDocument returns an empty Document
+func NewDocument(title, version string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			SecuritySchemes: make(map[string]SecurityScheme),
+		},
+	}
+}
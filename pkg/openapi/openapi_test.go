@@ -0,0 +1,98 @@
+package openapi
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocument_Validate(t *testing.T) {
+	route := Route{
+		Method:        http.MethodPost,
+		Path:          "/{hostname}/{name}",
+		Parameters:    []Parameter{PathParameter("hostname", ""), PathParameter("name", "")},
+		Responses:     map[int]string{http.StatusOK: "ok"},
+		Authenticated: true,
+	}
+
+	tests := []struct {
+		name    string
+		prefix  string
+		route   func(r Route) Route
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			route: func(r Route) Route { return r },
+		},
+		{
+			name:    "relative path",
+			prefix:  "v1",
+			route:   func(r Route) Route { return r },
+			wantErr: true,
+		},
+		{
+			name: "undeclared path parameter",
+			route: func(r Route) Route {
+				r.Parameters = r.Parameters[:1]
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown method",
+			route: func(r Route) Route {
+				r.Method = "COPY"
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			name: "no responses",
+			route: func(r Route) Route {
+				r.Responses = nil
+				r.Authenticated = false
+				return r
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := NewDocument("boring-registry", "dev")
+			doc.Add(tt.prefix, tt.route(route))
+			err := doc.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			op := doc.Paths["/{hostname}/{name}"]["post"]
+			assert.Contains(t, op.Responses, "401")
+			assert.Equal(t, []map[string][]string{{bearerAuth: {}}}, op.Security)
+		})
+	}
+
+	assert.Error(t, NewDocument("boring-registry", "dev").Validate())
+}
+
+func TestDocument_AddHandler(t *testing.T) {
+	router := mux.NewRouter()
+	router.Methods(http.MethodGet).Path("/{namespace}/versions").HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	router.Methods(http.MethodPost).Path("/batch").HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	batch := Route{Method: http.MethodPost, Path: "/batch", Responses: map[int]string{http.StatusOK: "ok"}}
+	doc := NewDocument("boring-registry", "dev")
+	assert.NoError(t, doc.AddHandler("/v1/providers", router, batch))
+
+	// Registered routes without a description are left out
+	assert.Equal(t, []string{"/v1/providers/batch"}, slices.Collect(maps.Keys(doc.Paths)))
+
+	// Described routes have to be registered
+	missing := Route{Method: http.MethodGet, Path: "/batch", Responses: map[int]string{http.StatusOK: "ok"}}
+	assert.ErrorContains(t, doc.AddHandler("/v1/providers", router, missing), "GET /v1/providers/batch")
+}
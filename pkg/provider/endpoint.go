@@ -2,12 +2,15 @@ package provider
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/boring-registry/boring-registry/pkg/auth"
 	"github.com/boring-registry/boring-registry/pkg/core"
 	o11y "github.com/boring-registry/boring-registry/pkg/observability"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
 )
 
 type listRequest struct {
@@ -28,6 +31,19 @@ func listEndpoint(svc Service, metrics *o11y.ProviderMetrics) endpoint.Endpoint
 	}
 }
 
+type latestRequest struct {
+	namespace         string
+	name              string
+	includePrerelease bool
+}
+
+func latestEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(latestRequest)
+		return svc.GetLatestProviderVersion(ctx, req.namespace, req.name, req.includePrerelease)
+	}
+}
+
 type downloadRequest struct {
 	namespace string
 	name      string
@@ -36,6 +52,9 @@ type downloadRequest struct {
 	arch      string
 }
 
+// downloadResponse is the download metadata of the provider registry protocol.
+// The shasum is the checksum of the archive in the signed SHA256SUMS file, which Terraform verifies.
+// The checksum that the storage backend computed during the upload isn't returned, as uploads are verified against the SHA256SUMS file.
 type downloadResponse struct {
 	OS                  string           `json:"os"`
 	Arch                string           `json:"arch"`
@@ -45,6 +64,7 @@ type downloadResponse struct {
 	ShasumsURL          string           `json:"shasums_url"`
 	ShasumsSignatureURL string           `json:"shasums_signature_url"`
 	SigningKeys         core.SigningKeys `json:"signing_keys"`
+	DocsURL             string           `json:"docs_url,omitempty"`
 }
 
 func downloadEndpoint(svc Service, metrics *o11y.ProviderMetrics) endpoint.Endpoint {
@@ -63,16 +83,138 @@ func downloadEndpoint(svc Service, metrics *o11y.ProviderMetrics) endpoint.Endpo
 		if err != nil {
 			return nil, err
 		}
+		return newDownloadResponse(res), nil
+	}
+}
+
+func newDownloadResponse(p *core.Provider) downloadResponse {
+	return downloadResponse{
+		OS:                  p.OS,
+		Arch:                p.Arch,
+		DownloadURL:         p.DownloadURL,
+		Filename:            p.Filename,
+		Shasum:              p.Shasum,
+		SigningKeys:         p.SigningKeys,
+		ShasumsURL:          p.SHASumsURL,
+		ShasumsSignatureURL: p.SHASumsSignatureURL,
+		DocsURL:             p.DocsURL,
+	}
+}
+
+func existsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(downloadRequest)
+
+		exists, err := svc.ProviderExists(ctx, req.namespace, req.name, req.version, req.os, req.arch)
+		if err != nil {
+			return nil, err
+		} else if !exists {
+			return nil, fmt.Errorf("%w: %s/%s/%s/%s/%s", ErrProviderNotFound, req.namespace, req.name, req.version, req.os, req.arch)
+		}
+		return struct{}{}, nil
+	}
+}
+
+const (
+	// maxBatchSize is the maximum number of providers of a batch request
+	maxBatchSize = 100
+	// batchConcurrency is the number of providers of a batch request that are resolved concurrently
+	batchConcurrency = 8
+	// maxBatchBodySize is the maximum size of the body of a batch request in bytes
+	maxBatchBodySize = 64 << 10
+)
 
-		return downloadResponse{
-			OS:                  res.OS,
-			Arch:                res.Arch,
-			DownloadURL:         res.DownloadURL,
-			Filename:            res.Filename,
-			Shasum:              res.Shasum,
-			SigningKeys:         res.SigningKeys,
-			ShasumsURL:          res.SHASumsURL,
-			ShasumsSignatureURL: res.SHASumsSignatureURL,
-		}, nil
+type batchItem struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+type batchRequest []batchItem
+
+// batchResult contains either the download response of the item or its error
+type batchResult struct {
+	batchItem
+	Provider *downloadResponse `json:"provider,omitempty"`
+	Error    *core.Problem     `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Providers []batchResult `json:"providers"`
+}
+
+// batchEndpoint resolves the items of a batch like the download endpoint.
+// The batch is authenticated once, the namespace-specific claim requirements are checked for every item.
+// The lookups aren't counted as downloads, as clients resolve providers in batches without downloading them.
+// The results are in the order of the request, the errors of single items don't fail the batch.
+func batchEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(batchRequest)
+
+		results := make([]batchResult, len(req))
+		var group errgroup.Group
+		group.SetLimit(batchConcurrency)
+		for i, item := range req {
+			group.Go(func() error {
+				results[i].batchItem = item
+				provider, err := batchProvider(auth.ContextWithNamespace(ctx, item.Namespace), svc, item)
+				if err != nil {
+					problem := core.NewProblem(err, core.StatusCode(err, errorStatuses...))
+					results[i].Error = &problem
+					return nil
+				}
+				res := newDownloadResponse(provider)
+				results[i].Provider = &res
+				return nil
+			})
+		}
+		_ = group.Wait()
+
+		return batchResponse{Providers: results}, nil
+	}
+}
+
+func batchProvider(ctx context.Context, svc Service, item batchItem) (*core.Provider, error) {
+	if err := auth.AuthorizeNamespace(ctx, item.Namespace); err != nil {
+		return nil, err
+	}
+	return svc.GetProvider(ctx, item.Namespace, item.Name, item.Version, item.OS, item.Arch)
+}
+
+type docsRequest struct {
+	namespace string
+	name      string
+	version   string
+}
+
+// docsResponse is the metadata.json document, which is served as is
+type docsResponse []byte
+
+func docsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(docsRequest)
+
+		docs, err := svc.GetProviderDocs(ctx, req.namespace, req.name, req.version)
+		if err != nil {
+			return nil, err
+		}
+		return docsResponse(docs), nil
+	}
+}
+
+// sha256SumsResponse is the SHA256SUMS file, which is served as is
+type sha256SumsResponse []byte
+
+func sha256SumsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(docsRequest)
+
+		sums, err := svc.GetProviderSha256Sums(ctx, req.namespace, req.name, req.version)
+		if err != nil {
+			return nil, err
+		}
+		return sha256SumsResponse(sums), nil
 	}
 }
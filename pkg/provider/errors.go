@@ -4,5 +4,11 @@ import "errors"
 
 var (
 	// Provider errors
-	ErrProviderNotFound = errors.New("failed to locate provider")
+	ErrProviderNotFound   = errors.New("failed to locate provider")
+	ErrPlatformNotAllowed = errors.New("platform is not served by this registry")
+	ErrPlatformRequired   = errors.New("os and arch are required, as this registry has no default platform")
+	ErrChecksumMismatch   = errors.New("checksum of the uploaded archive doesn't match SHA256SUMS")
+	ErrInvalidQuery       = errors.New("invalid query parameter")
+	ErrInvalidBatch       = errors.New("invalid batch request")
+	ErrInvalidFileName    = errors.New("invalid file name of a provider release")
 )
@@ -2,9 +2,12 @@ package provider
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"time"
 
+	"github.com/boring-registry/boring-registry/pkg/audit"
+	"github.com/boring-registry/boring-registry/pkg/auth"
 	"github.com/boring-registry/boring-registry/pkg/core"
 )
 
@@ -35,16 +38,37 @@ func (mw loggingMiddleware) ListProviderVersions(ctx context.Context, namespace,
 		)
 
 		if err != nil {
-			logger.Error("failed to list provider versions", slog.String("err", err.Error()))
+			logger.ErrorContext(ctx, "failed to list provider versions", slog.String("err", err.Error()))
 			return
 		}
 
-		logger.Info("list provider version", slog.String("took", time.Since(begin).String()))
+		logger.InfoContext(ctx, "list provider version", slog.String("took", time.Since(begin).String()))
 	}(time.Now())
 
 	return mw.next.ListProviderVersions(ctx, namespace, name)
 }
 
+func (mw loggingMiddleware) GetLatestProviderVersion(ctx context.Context, namespace, name string, includePrerelease bool) (version *core.ProviderVersion, err error) {
+	defer func(begin time.Time) {
+		logger := slog.Default().With(
+			slog.String("op", "GetLatestProviderVersion"),
+			slog.Group("provider",
+				slog.String("namespace", namespace),
+				slog.String("name", name),
+			),
+		)
+
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to get latest provider version", slog.String("err", err.Error()))
+			return
+		}
+
+		logger.InfoContext(ctx, "get latest provider version", slog.String("took", time.Since(begin).String()), slog.String("version", version.Version))
+	}(time.Now())
+
+	return mw.next.GetLatestProviderVersion(ctx, namespace, name, includePrerelease)
+}
+
 func (mw loggingMiddleware) GetProvider(ctx context.Context, namespace, name, version, os, arch string) (provider *core.Provider, err error) {
 	defer func(begin time.Time) {
 		logger := slog.Default().With(
@@ -59,12 +83,185 @@ func (mw loggingMiddleware) GetProvider(ctx context.Context, namespace, name, ve
 		)
 
 		if err != nil {
-			logger.Error("failed to get provider", slog.String("err", err.Error()))
+			logger.ErrorContext(ctx, "failed to get provider", slog.String("err", err.Error()))
 			return
 		}
 
-		logger.Info("get provider", slog.String("took", time.Since(begin).String()))
+		logger.InfoContext(ctx, "get provider", slog.String("took", time.Since(begin).String()))
 	}(time.Now())
 
 	return mw.next.GetProvider(ctx, namespace, name, version, os, arch)
 }
+
+func (mw loggingMiddleware) ProviderExists(ctx context.Context, namespace, name, version, os, arch string) (exists bool, err error) {
+	defer func(begin time.Time) {
+		logger := slog.Default().With(
+			slog.String("op", "ProviderExists"),
+			slog.Group("provider",
+				slog.String("namespace", namespace),
+				slog.String("name", name),
+				slog.String("version", version),
+				slog.String("os", os),
+				slog.String("arch", arch),
+			),
+		)
+
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to check provider existence", slog.String("err", err.Error()))
+			return
+		}
+
+		logger.InfoContext(ctx, "check provider existence", slog.String("took", time.Since(begin).String()), slog.Bool("exists", exists))
+	}(time.Now())
+
+	return mw.next.ProviderExists(ctx, namespace, name, version, os, arch)
+}
+
+func (mw loggingMiddleware) GetProviderDocs(ctx context.Context, namespace, name, version string) (docs []byte, err error) {
+	defer func(begin time.Time) {
+		logger := slog.Default().With(
+			slog.String("op", "GetProviderDocs"),
+			slog.Group("provider",
+				slog.String("namespace", namespace),
+				slog.String("name", name),
+				slog.String("version", version),
+			),
+		)
+
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to get provider docs", slog.String("err", err.Error()))
+			return
+		}
+
+		logger.InfoContext(ctx, "get provider docs", slog.String("took", time.Since(begin).String()))
+	}(time.Now())
+
+	return mw.next.GetProviderDocs(ctx, namespace, name, version)
+}
+
+func (mw loggingMiddleware) GetProviderSha256Sums(ctx context.Context, namespace, name, version string) (sums []byte, err error) {
+	defer func(begin time.Time) {
+		logger := slog.Default().With(
+			slog.String("op", "GetProviderSha256Sums"),
+			slog.Group("provider",
+				slog.String("namespace", namespace),
+				slog.String("name", name),
+				slog.String("version", version),
+			),
+		)
+
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to get provider SHA256SUMS", slog.String("err", err.Error()))
+			return
+		}
+
+		logger.InfoContext(ctx, "get provider SHA256SUMS", slog.String("took", time.Since(begin).String()))
+	}(time.Now())
+
+	return mw.next.GetProviderSha256Sums(ctx, namespace, name, version)
+}
+
+type auditMiddleware struct {
+	next   Service
+	logger audit.Logger
+}
+
+// AuditMiddleware is a Service middleware that records successful provider downloads with the audit.Logger
+func AuditMiddleware(logger audit.Logger) Middleware {
+	return func(next Service) Service {
+		return &auditMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+func (mw auditMiddleware) ListProviderVersions(ctx context.Context, namespace, name string) (*core.ProviderVersions, error) {
+	return mw.next.ListProviderVersions(ctx, namespace, name)
+}
+
+func (mw auditMiddleware) GetLatestProviderVersion(ctx context.Context, namespace, name string, includePrerelease bool) (*core.ProviderVersion, error) {
+	return mw.next.GetLatestProviderVersion(ctx, namespace, name, includePrerelease)
+}
+
+func (mw auditMiddleware) GetProvider(ctx context.Context, namespace, name, version, os, arch string) (provider *core.Provider, err error) {
+	defer func(begin time.Time) {
+		if err != nil {
+			return
+		}
+		resource := fmt.Sprintf("%s/%s/%s", namespace, name, version)
+		metadata := map[string]string{"os": os, "arch": arch}
+		audit.LogRegistryAccess(ctx, mw.logger, audit.EventRegistryProviderAccess, audit.ActionDownload, resource, begin, metadata)
+	}(time.Now())
+
+	return mw.next.GetProvider(ctx, namespace, name, version, os, arch)
+}
+
+func (mw auditMiddleware) ProviderExists(ctx context.Context, namespace, name, version, os, arch string) (bool, error) {
+	return mw.next.ProviderExists(ctx, namespace, name, version, os, arch)
+}
+
+func (mw auditMiddleware) GetProviderDocs(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	return mw.next.GetProviderDocs(ctx, namespace, name, version)
+}
+
+func (mw auditMiddleware) GetProviderSha256Sums(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	return mw.next.GetProviderSha256Sums(ctx, namespace, name, version)
+}
+
+type aclMiddleware struct {
+	next Service
+	acl  auth.ACL
+}
+
+// ACLMiddleware is a Service middleware that denies the access to namespaces, which the user isn't allowed to read
+func ACLMiddleware(acl auth.ACL) Middleware {
+	return func(next Service) Service {
+		return &aclMiddleware{
+			next: next,
+			acl:  acl,
+		}
+	}
+}
+
+func (mw aclMiddleware) ListProviderVersions(ctx context.Context, namespace, name string) (*core.ProviderVersions, error) {
+	if err := mw.acl.Authorize(ctx, namespace, auth.PermissionRead); err != nil {
+		return nil, err
+	}
+	return mw.next.ListProviderVersions(ctx, namespace, name)
+}
+
+func (mw aclMiddleware) GetLatestProviderVersion(ctx context.Context, namespace, name string, includePrerelease bool) (*core.ProviderVersion, error) {
+	if err := mw.acl.Authorize(ctx, namespace, auth.PermissionRead); err != nil {
+		return nil, err
+	}
+	return mw.next.GetLatestProviderVersion(ctx, namespace, name, includePrerelease)
+}
+
+func (mw aclMiddleware) GetProvider(ctx context.Context, namespace, name, version, os, arch string) (*core.Provider, error) {
+	if err := mw.acl.Authorize(ctx, namespace, auth.PermissionRead); err != nil {
+		return nil, err
+	}
+	return mw.next.GetProvider(ctx, namespace, name, version, os, arch)
+}
+
+func (mw aclMiddleware) ProviderExists(ctx context.Context, namespace, name, version, os, arch string) (bool, error) {
+	if err := mw.acl.Authorize(ctx, namespace, auth.PermissionRead); err != nil {
+		return false, err
+	}
+	return mw.next.ProviderExists(ctx, namespace, name, version, os, arch)
+}
+
+func (mw aclMiddleware) GetProviderDocs(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	if err := mw.acl.Authorize(ctx, namespace, auth.PermissionRead); err != nil {
+		return nil, err
+	}
+	return mw.next.GetProviderDocs(ctx, namespace, name, version)
+}
+
+func (mw aclMiddleware) GetProviderSha256Sums(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	if err := mw.acl.Authorize(ctx, namespace, auth.PermissionRead); err != nil {
+		return nil, err
+	}
+	return mw.next.GetProviderSha256Sums(ctx, namespace, name, version)
+}
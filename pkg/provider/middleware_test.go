@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/audit"
+	"github.com/boring-registry/boring-registry/pkg/audit/audittest"
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockedService struct {
+	getProvider func(ctx context.Context, namespace, name, version, os, arch string) (*core.Provider, error)
+}
+
+func (m *mockedService) GetProvider(ctx context.Context, namespace, name, version, os, arch string) (*core.Provider, error) {
+	return m.getProvider(ctx, namespace, name, version, os, arch)
+}
+
+func (m *mockedService) ProviderExists(ctx context.Context, namespace, name, version, os, arch string) (bool, error) {
+	return false, nil
+}
+
+func (m *mockedService) ListProviderVersions(ctx context.Context, namespace, name string) (*core.ProviderVersions, error) {
+	return &core.ProviderVersions{}, nil
+}
+
+func (m *mockedService) GetLatestProviderVersion(ctx context.Context, namespace, name string, includePrerelease bool) (*core.ProviderVersion, error) {
+	return nil, ErrProviderNotFound
+}
+
+func (m *mockedService) GetProviderDocs(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	return nil, core.ErrObjectNotFound
+}
+
+func (m *mockedService) GetProviderSha256Sums(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	return nil, core.ErrObjectNotFound
+}
+
+func TestAuditMiddleware_GetProvider(t *testing.T) {
+	logger := &audittest.Logger{}
+	svc := AuditMiddleware(logger)(&mockedService{
+		getProvider: func(ctx context.Context, namespace, name, version, os, arch string) (*core.Provider, error) {
+			if version != "1.0.0" {
+				return nil, errors.New("provider not found")
+			}
+			return &core.Provider{Namespace: namespace, Name: name, Version: version, OS: os, Arch: arch}, nil
+		},
+	})
+	ctx := audit.ContextWithUser(context.Background(), &audit.User{Provider: "oidc", Subject: "jane"})
+
+	_, err := svc.GetProvider(ctx, "hashicorp", "random", "1.0.0", "linux", "amd64")
+	assert.NoError(t, err)
+	assert.Len(t, logger.Events, 1)
+	assert.Equal(t, audit.EventRegistryProviderAccess, logger.Events[0].Type)
+	assert.Equal(t, audit.ActionDownload, logger.Events[0].Action)
+	assert.Equal(t, "hashicorp/random/1.0.0", logger.Events[0].Resource)
+	assert.Equal(t, map[string]string{"os": "linux", "arch": "amd64"}, logger.Events[0].Metadata)
+	assert.Equal(t, "jane", logger.Events[0].User.Subject)
+
+	// Failed downloads aren't audited
+	_, err = svc.GetProvider(ctx, "hashicorp", "random", "2.0.0", "linux", "amd64")
+	assert.Error(t, err)
+	assert.Len(t, logger.Events, 1)
+}
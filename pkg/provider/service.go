@@ -2,6 +2,14 @@ package provider
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
 )
@@ -10,30 +18,157 @@ import (
 // For more information see: https://www.terraform.io/docs/internals/provider-registry-protocol.html.
 type Service interface {
 	GetProvider(ctx context.Context, namespace, name, version, os, arch string) (*core.Provider, error)
+	// ProviderExists reports whether a provider version exists for the platform, without generating download URLs
+	ProviderExists(ctx context.Context, namespace, name, version, os, arch string) (bool, error)
 	ListProviderVersions(ctx context.Context, namespace, name string) (*core.ProviderVersions, error)
+	// GetLatestProviderVersion returns the highest version of a provider, which is a pre-release only if includePrerelease is set
+	GetLatestProviderVersion(ctx context.Context, namespace, name string, includePrerelease bool) (*core.ProviderVersion, error)
+	// GetProviderDocs returns the metadata.json document of a provider version
+	GetProviderDocs(ctx context.Context, namespace, name, version string) ([]byte, error)
+	// GetProviderSha256Sums returns the SHA256SUMS file of a provider version
+	GetProviderSha256Sums(ctx context.Context, namespace, name, version string) ([]byte, error)
 }
 
+const (
+	// docsCacheTTL is the duration for which the service remembers whether a provider version has docs
+	docsCacheTTL = 30 * time.Second
+
+	// docsCacheSweepSize is the number of entries after which expired entries are removed on insertion
+	docsCacheSweepSize = 1024
+)
+
 type service struct {
-	storage Storage
-	proxy   core.ProxyUrlService
+	storage          Storage
+	proxy            core.ProxyUrlService
+	allowedPlatforms map[core.Platform]struct{}
+	defaultPlatform  core.Platform
+	docsPathPrefix   string
+	mirror           MirrorStorage
+	mirrorHostname   string
+	docs             *docsCache
+}
+
+// MirrorStorage lists and resolves the providers of the provider network mirror
+type MirrorStorage interface {
+	ListMirroredProviders(ctx context.Context, provider *core.Provider) ([]*core.Provider, error)
+	GetMirroredProvider(ctx context.Context, provider *core.Provider) (*core.Provider, error)
+}
+
+// Option provides additional options for the Service
+type Option func(*service)
+
+// WithAllowedPlatforms restricts the platforms that are served to the allowlist.
+// All platforms found in the storage backend are served if the allowlist is empty.
+func WithAllowedPlatforms(platforms []core.Platform) Option {
+	return func(s *service) {
+		if len(platforms) == 0 {
+			return
+		}
+		s.allowedPlatforms = make(map[core.Platform]struct{}, len(platforms))
+		for _, p := range platforms {
+			s.allowedPlatforms[p] = struct{}{}
+		}
+	}
+}
+
+// WithDefaultPlatform configures the platform of download requests that omit the os or arch.
+// Requests without a platform are rejected with ErrPlatformRequired if no default platform is configured.
+func WithDefaultPlatform(platform core.Platform) Option {
+	return func(s *service) {
+		s.defaultPlatform = platform
+	}
+}
+
+// WithDocsPathPrefix sets the path under which the provider endpoints are served,
+// which is the base of the docs_url in the GetProvider responses
+func WithDocsPathPrefix(prefix string) Option {
+	return func(s *service) {
+		s.docsPathPrefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithMirrorUnion adds the versions of the provider network mirror for the hostname to the listed versions.
+// Versions that are stored internally and in the mirror are listed once with the internal platforms,
+// downloads of versions that aren't stored internally are served from the mirror.
+func WithMirrorUnion(mirror MirrorStorage, hostname string) Option {
+	return func(s *service) {
+		s.mirror = mirror
+		s.mirrorHostname = hostname
+	}
 }
 
 // NewService returns a fully initialized Service.
-func NewService(storage Storage, proxy core.ProxyUrlService) Service {
-	return &service{
+func NewService(storage Storage, proxy core.ProxyUrlService, opts ...Option) Service {
+	s := &service{
 		storage: storage,
 		proxy:   proxy,
+		docs:    newDocsCache(docsCacheTTL),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *service) isAllowed(platform core.Platform) bool {
+	if s.allowedPlatforms == nil {
+		return true
+	}
+	_, ok := s.allowedPlatforms[platform]
+	return ok
+}
+
+// withDefaultPlatform fills in the os and arch that the request omitted with the default platform
+func (s *service) withDefaultPlatform(os, arch string) (core.Platform, error) {
+	platform := core.Platform{OS: os, Arch: arch}
+	if platform.OS == "" {
+		platform.OS = s.defaultPlatform.OS
+	}
+	if platform.Arch == "" {
+		platform.Arch = s.defaultPlatform.Arch
+	}
+	if platform.OS == "" || platform.Arch == "" {
+		return platform, ErrPlatformRequired
+	}
+	return platform, nil
 }
 
 func (s *service) GetProvider(ctx context.Context, namespace, name, version, os, arch string) (*core.Provider, error) {
-	p, err := s.storage.GetProvider(ctx, namespace, name, version, os, arch)
+	platform, err := s.withDefaultPlatform(os, arch)
+	if err != nil {
+		return nil, err
+	}
+	// Aliases like x86_64 are resolved to the platform the archives are stored under
+	platform = core.ResolvePlatformAlias(platform)
+	if !s.isAllowed(platform) {
+		return nil, fmt.Errorf("%w: %s", ErrPlatformNotAllowed, platform)
+	}
+
+	proxied := s.proxy.IsProxyEnabled(ctx)
+	if proxied {
+		ctx = core.ContextWithProxiedDownload(ctx)
+	}
+
+	p, err := s.storage.GetProvider(ctx, namespace, name, version, platform.OS, platform.Arch)
+	mirrored := false
+	if err != nil && s.mirror != nil && isNotFound(err) {
+		// The versions of the mirror are listed alongside the internal ones, so they have to be downloadable as well
+		p, err = s.mirror.GetMirroredProvider(ctx, &core.Provider{
+			Hostname:  s.mirrorHostname,
+			Namespace: namespace,
+			Name:      name,
+			Version:   version,
+			OS:        platform.OS,
+			Arch:      platform.Arch,
+		})
+		mirrored = err == nil
+	}
 	if err != nil {
 		return p, err
 	}
 
-	if s.proxy.IsProxyEnabled(ctx) {
-		downloadUrl, err := s.proxy.GetProxyUrl(ctx, p.DownloadURL)
+	if proxied {
+		downloadUrl, err := s.proxy.GetChecksumProxyUrl(ctx, p.DownloadURL, p.Shasum)
 		if err != nil {
 			return p, err
 		}
@@ -52,9 +187,199 @@ func (s *service) GetProvider(ctx context.Context, namespace, name, version, os,
 		p.SHASumsSignatureURL = shaSumsSignatureURL
 	}
 
-	return p, err
+	if !mirrored && s.docsExist(ctx, namespace, name, version) {
+		p.DocsURL = fmt.Sprintf("%s/%s/%s/%s/docs", s.docsPathPrefix, namespace, name, version)
+	}
+
+	return p, nil
+}
+
+// docsExist reports whether the provider version has docs. The result is cached, as Terraform requests every platform of a version.
+// The docs_url is optional, so a failed lookup only omits it instead of failing the download.
+func (s *service) docsExist(ctx context.Context, namespace, name, version string) bool {
+	key := path.Join(core.StoragePrefix(ctx), namespace, name, version)
+	if exists, ok := s.docs.lookup(key); ok {
+		return exists
+	}
+
+	exists, err := s.storage.ProviderDocsExist(ctx, namespace, name, version)
+	if err != nil {
+		slog.Warn("failed to look up the provider docs, omitting the docs_url", slog.String("provider", namespace+"/"+name), slog.String("version", version), slog.String("err", err.Error()))
+		return false
+	}
+	s.docs.add(key, exists)
+	return exists
+}
+
+// docsCache remembers whether provider versions have docs, including versions without docs
+type docsCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]docsEntry
+}
+
+type docsEntry struct {
+	exists  bool
+	expires time.Time
+}
+
+func newDocsCache(ttl time.Duration) *docsCache {
+	return &docsCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]docsEntry),
+	}
+}
+
+func (c *docsCache) lookup(key string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !c.now().Before(entry.expires) {
+		return false, false
+	}
+	return entry.exists, true
+}
+
+func (c *docsCache) add(key string, exists bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= docsCacheSweepSize {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = docsEntry{exists: exists, expires: now.Add(c.ttl)}
+}
+
+func (s *service) ProviderExists(ctx context.Context, namespace, name, version, os, arch string) (bool, error) {
+	platform := core.ResolvePlatformAlias(core.Platform{OS: os, Arch: arch})
+	if !s.isAllowed(platform) {
+		return false, nil
+	}
+	return s.storage.ProviderExists(ctx, namespace, name, version, platform.OS, platform.Arch)
+}
+
+func (s *service) GetProviderDocs(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	return s.storage.ProviderDocs(ctx, namespace, name, version)
+}
+
+func (s *service) GetProviderSha256Sums(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	return s.storage.ProviderSha256Sums(ctx, namespace, name, version)
 }
 
 func (s *service) ListProviderVersions(ctx context.Context, namespace, name string) (*core.ProviderVersions, error) {
-	return s.storage.ListProviderVersions(ctx, namespace, name)
+	versions, err := s.storage.ListProviderVersions(ctx, namespace, name)
+	if s.mirror != nil {
+		versions, err = s.unionMirror(ctx, namespace, name, versions, err)
+	}
+	if err != nil || s.allowedPlatforms == nil {
+		return versions, err
+	}
+
+	filtered := &core.ProviderVersions{}
+	for _, v := range versions.Versions {
+		platforms := make([]core.Platform, 0, len(v.Platforms))
+		for _, p := range v.Platforms {
+			if s.isAllowed(p) {
+				platforms = append(platforms, p)
+			}
+		}
+
+		// Versions without any allowed platform can't be installed
+		if len(platforms) == 0 {
+			continue
+		}
+		v.Platforms = platforms
+		filtered.Versions = append(filtered.Versions, v)
+	}
+
+	if len(filtered.Versions) == 0 {
+		return nil, fmt.Errorf("%w: no versions of %s/%s for the allowed platforms", ErrProviderNotFound, namespace, name)
+	}
+	return filtered, nil
+}
+
+func (s *service) GetLatestProviderVersion(ctx context.Context, namespace, name string, includePrerelease bool) (*core.ProviderVersion, error) {
+	versions, err := s.ListProviderVersions(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]string, 0, len(versions.Versions))
+	for _, v := range versions.Versions {
+		raw = append(raw, v.Version)
+	}
+
+	latest, ok := core.LatestVersion(raw, includePrerelease)
+	if !ok {
+		return nil, fmt.Errorf("%w: no eligible version of %s/%s", ErrProviderNotFound, namespace, name)
+	}
+	for _, v := range versions.Versions {
+		if v.Version == latest {
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s/%s version %s", ErrProviderNotFound, namespace, name, latest)
+}
+
+// unionMirror adds the mirrored versions that aren't stored internally to the internal versions and marks the source of every version.
+// The provider is only reported as missing if it's neither stored internally nor in the mirror.
+func (s *service) unionMirror(ctx context.Context, namespace, name string, internal *core.ProviderVersions, internalErr error) (*core.ProviderVersions, error) {
+	if internalErr != nil && !isNotFound(internalErr) {
+		return nil, internalErr
+	}
+
+	mirrored, err := s.mirror.ListMirroredProviders(ctx, &core.Provider{Hostname: s.mirrorHostname, Namespace: namespace, Name: name})
+	if err != nil && !isNotFound(err) {
+		return nil, fmt.Errorf("failed to list the mirrored versions of %s/%s/%s: %w", s.mirrorHostname, namespace, name, err)
+	}
+	if internalErr != nil && len(mirrored) == 0 {
+		return nil, internalErr
+	}
+
+	union := &core.ProviderVersions{}
+	stored := make(map[string]bool)
+	if internalErr == nil {
+		for _, v := range internal.Versions {
+			v.Source = core.ProviderSourceInternal
+			stored[v.Version] = true
+			union.Versions = append(union.Versions, v)
+		}
+	}
+
+	// The platforms of internally stored versions take precedence over the mirrored ones
+	indices := make(map[string]int)
+	for _, p := range mirrored {
+		if stored[p.Version] {
+			continue
+		}
+		i, ok := indices[p.Version]
+		if !ok {
+			i = len(union.Versions)
+			indices[p.Version] = i
+			union.Versions = append(union.Versions, core.ProviderVersion{
+				Namespace: namespace,
+				Name:      name,
+				Version:   p.Version,
+				Source:    core.ProviderSourceMirror,
+			})
+		}
+		union.Versions[i].Platforms = append(union.Versions[i].Platforms, core.Platform{OS: p.OS, Arch: p.Arch})
+	}
+	return union, nil
+}
+
+func isNotFound(err error) bool {
+	var providerError *core.ProviderError
+	return errors.Is(err, ErrProviderNotFound) ||
+		errors.Is(err, core.ErrObjectNotFound) ||
+		(errors.As(err, &providerError) && providerError.StatusCode == http.StatusNotFound)
 }
@@ -0,0 +1,427 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type platformStorage struct {
+	Storage
+	versions *core.ProviderVersions
+	// stored restricts the platforms returned by GetProvider, all platforms are found if it's empty
+	stored []core.Platform
+}
+
+func (p *platformStorage) ListProviderVersions(_ context.Context, _, _ string) (*core.ProviderVersions, error) {
+	return p.versions, nil
+}
+
+func (p *platformStorage) GetProvider(_ context.Context, namespace, name, version, os, arch string) (*core.Provider, error) {
+	if len(p.stored) > 0 && !slices.Contains(p.stored, core.Platform{OS: os, Arch: arch}) {
+		return nil, ErrProviderNotFound
+	}
+	return &core.Provider{Namespace: namespace, Name: name, Version: version, OS: os, Arch: arch}, nil
+}
+
+func (p *platformStorage) ProviderDocsExist(_ context.Context, _, _, _ string) (bool, error) {
+	return false, nil
+}
+
+var (
+	linuxAmd64  = core.Platform{OS: "linux", Arch: "amd64"}
+	linuxArm64  = core.Platform{OS: "linux", Arch: "arm64"}
+	darwinArm64 = core.Platform{OS: "darwin", Arch: "arm64"}
+)
+
+func TestService_ListProviderVersions_allowedPlatforms(t *testing.T) {
+	versions := &core.ProviderVersions{
+		Versions: []core.ProviderVersion{
+			{Namespace: "hashicorp", Name: "dummy", Version: "1.0.0", Platforms: []core.Platform{linuxAmd64, darwinArm64, linuxArm64}},
+			{Namespace: "hashicorp", Name: "dummy", Version: "1.1.0", Platforms: []core.Platform{darwinArm64}},
+			{Namespace: "hashicorp", Name: "dummy", Version: "1.2.0", Platforms: []core.Platform{linuxArm64}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		allowed []core.Platform
+		want    *core.ProviderVersions
+		wantErr error
+	}{
+		{
+			name: "no allowlist",
+			want: versions,
+		},
+		{
+			name:    "platforms are filtered",
+			allowed: []core.Platform{linuxAmd64, linuxArm64},
+			want: &core.ProviderVersions{
+				Versions: []core.ProviderVersion{
+					{Namespace: "hashicorp", Name: "dummy", Version: "1.0.0", Platforms: []core.Platform{linuxAmd64, linuxArm64}},
+					{Namespace: "hashicorp", Name: "dummy", Version: "1.2.0", Platforms: []core.Platform{linuxArm64}},
+				},
+			},
+		},
+		{
+			name:    "no allowed platform",
+			allowed: []core.Platform{{OS: "windows", Arch: "amd64"}},
+			wantErr: ErrProviderNotFound,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewService(&platformStorage{versions: versions}, core.NewProxyUrlService(false, ""), WithAllowedPlatforms(tc.allowed))
+
+			got, err := svc.ListProviderVersions(context.Background(), "hashicorp", "dummy")
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	// The storage response must not be modified, as it may be cached
+	assert.Equal(t, []core.Platform{linuxAmd64, darwinArm64, linuxArm64}, versions.Versions[0].Platforms)
+}
+
+func TestService_GetProvider_allowedPlatforms(t *testing.T) {
+	svc := NewService(&platformStorage{}, core.NewProxyUrlService(false, ""), WithAllowedPlatforms([]core.Platform{linuxAmd64}))
+
+	p, err := svc.GetProvider(context.Background(), "hashicorp", "dummy", "1.0.0", "linux", "amd64")
+	require.NoError(t, err)
+	assert.Equal(t, "amd64", p.Arch)
+
+	_, err = svc.GetProvider(context.Background(), "hashicorp", "dummy", "1.0.0", "darwin", "arm64")
+	assert.ErrorIs(t, err, ErrPlatformNotAllowed)
+	assert.ErrorContains(t, err, "darwin_arm64")
+}
+
+func TestService_GetProvider_platformAliases(t *testing.T) {
+	storage := &platformStorage{stored: []core.Platform{linuxAmd64, {OS: "linux", Arch: "386"}, darwinArm64}}
+	svc := NewService(storage, core.NewProxyUrlService(false, ""))
+
+	tests := []struct {
+		os, arch string
+		want     core.Platform
+		wantErr  error
+	}{
+		{os: "linux", arch: "amd64", want: linuxAmd64},
+		{os: "linux", arch: "x86_64", want: linuxAmd64},
+		{os: "linux", arch: "i386", want: core.Platform{OS: "linux", Arch: "386"}},
+		{os: "macos", arch: "aarch64", want: darwinArm64},
+		{os: "linux", arch: "arm64", wantErr: ErrProviderNotFound},
+		{os: "linux", arch: "arm", wantErr: ErrProviderNotFound},
+		{os: "plan9", arch: "amd64", wantErr: ErrProviderNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.os+"_"+tc.arch, func(t *testing.T) {
+			p, err := svc.GetProvider(context.Background(), "hashicorp", "dummy", "1.0.0", tc.os, tc.arch)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, core.Platform{OS: p.OS, Arch: p.Arch})
+		})
+	}
+}
+
+func TestService_GetProvider_allowedPlatformAlias(t *testing.T) {
+	svc := NewService(&platformStorage{}, core.NewProxyUrlService(false, ""), WithAllowedPlatforms([]core.Platform{linuxAmd64}))
+
+	p, err := svc.GetProvider(context.Background(), "hashicorp", "dummy", "1.0.0", "linux", "x86_64")
+	require.NoError(t, err)
+	assert.Equal(t, "amd64", p.Arch)
+}
+
+func TestService_GetProvider_defaultPlatform(t *testing.T) {
+	storage := &platformStorage{stored: []core.Platform{linuxAmd64, darwinArm64}}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		os, arch string
+		want     core.Platform
+		wantErr  error
+	}{
+		{
+			name: "default applied",
+			opts: []Option{WithDefaultPlatform(linuxAmd64)},
+			want: linuxAmd64,
+		},
+		{
+			name: "requested platform takes precedence",
+			opts: []Option{WithDefaultPlatform(linuxAmd64)},
+			os:   "darwin",
+			arch: "arm64",
+			want: darwinArm64,
+		},
+		{
+			name: "default alias resolved",
+			opts: []Option{WithDefaultPlatform(core.Platform{OS: "linux", Arch: "x86_64"})},
+			want: linuxAmd64,
+		},
+		{
+			name:    "default not allowed",
+			opts:    []Option{WithDefaultPlatform(darwinArm64), WithAllowedPlatforms([]core.Platform{linuxAmd64})},
+			wantErr: ErrPlatformNotAllowed,
+		},
+		{
+			name:    "no default configured",
+			wantErr: ErrPlatformRequired,
+		},
+		{
+			name:    "only os requested without default",
+			os:      "linux",
+			wantErr: ErrPlatformRequired,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewService(storage, core.NewProxyUrlService(false, ""), tc.opts...)
+			p, err := svc.GetProvider(context.Background(), "hashicorp", "dummy", "1.0.0", tc.os, tc.arch)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, core.Platform{OS: p.OS, Arch: p.Arch})
+		})
+	}
+}
+
+type unionStorage struct {
+	Storage
+	versions *core.ProviderVersions
+}
+
+func (u *unionStorage) ListProviderVersions(_ context.Context, namespace, name string) (*core.ProviderVersions, error) {
+	if u.versions == nil {
+		return nil, &core.ProviderError{Reason: "failed to find matching providers", Provider: &core.Provider{Namespace: namespace, Name: name}, StatusCode: http.StatusNotFound}
+	}
+	return u.versions, nil
+}
+
+type unionMirrorStorage struct {
+	hostname  string
+	providers []*core.Provider
+}
+
+func (u *unionMirrorStorage) ListMirroredProviders(_ context.Context, provider *core.Provider) ([]*core.Provider, error) {
+	u.hostname = provider.Hostname
+	if len(u.providers) == 0 {
+		return nil, core.ErrObjectNotFound
+	}
+	return u.providers, nil
+}
+
+func (u *unionStorage) GetProvider(_ context.Context, namespace, name, version, os, arch string) (*core.Provider, error) {
+	return nil, &core.ProviderError{Reason: "failed to find matching providers", Provider: &core.Provider{Namespace: namespace, Name: name, Version: version}, StatusCode: http.StatusNotFound}
+}
+
+func (u *unionMirrorStorage) GetMirroredProvider(_ context.Context, provider *core.Provider) (*core.Provider, error) {
+	for _, p := range u.providers {
+		if p.Hostname == provider.Hostname && p.Version == provider.Version && p.OS == provider.OS && p.Arch == provider.Arch {
+			return &core.Provider{Hostname: p.Hostname, Namespace: p.Namespace, Name: p.Name, Version: p.Version, OS: p.OS, Arch: p.Arch, DownloadURL: "https://mirror.example.com/archive.zip"}, nil
+		}
+	}
+	return nil, &core.ProviderError{Reason: "failed to find matching providers", Provider: provider, StatusCode: http.StatusNotFound}
+}
+
+func TestService_GetProvider_mirrorUnion(t *testing.T) {
+	m := &unionMirrorStorage{providers: []*core.Provider{
+		{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "dummy", Version: "2.0.0", OS: "linux", Arch: "amd64"},
+	}}
+	svc := NewService(&unionStorage{}, core.NewProxyUrlService(false, ""), WithMirrorUnion(m, "registry.terraform.io"))
+
+	// Versions that are only listed from the mirror are downloaded from the mirror
+	p, err := svc.GetProvider(context.Background(), "hashicorp", "dummy", "2.0.0", "linux", "amd64")
+	require.NoError(t, err)
+	assert.Equal(t, "https://mirror.example.com/archive.zip", p.DownloadURL)
+	assert.Empty(t, p.DocsURL)
+
+	_, err = svc.GetProvider(context.Background(), "hashicorp", "dummy", "2.0.0", "darwin", "arm64")
+	var providerError *core.ProviderError
+	require.ErrorAs(t, err, &providerError)
+	assert.Equal(t, http.StatusNotFound, providerError.StatusCode)
+}
+
+func TestService_ListProviderVersions_mirrorUnion(t *testing.T) {
+	internal := func(versions ...string) *core.ProviderVersions {
+		out := &core.ProviderVersions{}
+		for _, v := range versions {
+			out.Versions = append(out.Versions, core.ProviderVersion{Namespace: "hashicorp", Name: "dummy", Version: v, Platforms: []core.Platform{linuxAmd64}})
+		}
+		return out
+	}
+	mirrored := func(version string, platforms ...core.Platform) []*core.Provider {
+		var out []*core.Provider
+		for _, p := range platforms {
+			out = append(out, &core.Provider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "dummy", Version: version, OS: p.OS, Arch: p.Arch})
+		}
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		internal *core.ProviderVersions
+		mirrored []*core.Provider
+		want     []core.ProviderVersion
+		wantErr  bool
+	}{
+		{
+			name:     "disjoint versions",
+			internal: internal("1.0.0"),
+			mirrored: append(mirrored("2.0.0", linuxAmd64), mirrored("2.1.0", linuxArm64, darwinArm64)...),
+			want: []core.ProviderVersion{
+				{Namespace: "hashicorp", Name: "dummy", Version: "1.0.0", Platforms: []core.Platform{linuxAmd64}, Source: core.ProviderSourceInternal},
+				{Namespace: "hashicorp", Name: "dummy", Version: "2.0.0", Platforms: []core.Platform{linuxAmd64}, Source: core.ProviderSourceMirror},
+				{Namespace: "hashicorp", Name: "dummy", Version: "2.1.0", Platforms: []core.Platform{linuxArm64, darwinArm64}, Source: core.ProviderSourceMirror},
+			},
+		},
+		{
+			name:     "overlapping versions",
+			internal: internal("1.0.0", "2.0.0"),
+			mirrored: append(mirrored("2.0.0", linuxArm64, darwinArm64), mirrored("3.0.0", linuxAmd64)...),
+			want: []core.ProviderVersion{
+				{Namespace: "hashicorp", Name: "dummy", Version: "1.0.0", Platforms: []core.Platform{linuxAmd64}, Source: core.ProviderSourceInternal},
+				{Namespace: "hashicorp", Name: "dummy", Version: "2.0.0", Platforms: []core.Platform{linuxAmd64}, Source: core.ProviderSourceInternal},
+				{Namespace: "hashicorp", Name: "dummy", Version: "3.0.0", Platforms: []core.Platform{linuxAmd64}, Source: core.ProviderSourceMirror},
+			},
+		},
+		{
+			name:     "only mirrored",
+			mirrored: mirrored("2.0.0", linuxAmd64),
+			want: []core.ProviderVersion{
+				{Namespace: "hashicorp", Name: "dummy", Version: "2.0.0", Platforms: []core.Platform{linuxAmd64}, Source: core.ProviderSourceMirror},
+			},
+		},
+		{
+			name:     "only internal",
+			internal: internal("1.0.0"),
+			want: []core.ProviderVersion{
+				{Namespace: "hashicorp", Name: "dummy", Version: "1.0.0", Platforms: []core.Platform{linuxAmd64}, Source: core.ProviderSourceInternal},
+			},
+		},
+		{
+			name:    "neither",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &unionMirrorStorage{providers: tc.mirrored}
+			svc := NewService(&unionStorage{versions: tc.internal}, core.NewProxyUrlService(false, ""), WithMirrorUnion(m, "registry.terraform.io"))
+
+			got, err := svc.ListProviderVersions(context.Background(), "hashicorp", "dummy")
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got.Versions)
+			assert.Equal(t, "registry.terraform.io", m.hostname)
+		})
+	}
+}
+
+func TestService_GetLatestProviderVersion(t *testing.T) {
+	versions := func(raw ...string) *core.ProviderVersions {
+		out := &core.ProviderVersions{}
+		for _, v := range raw {
+			out.Versions = append(out.Versions, core.ProviderVersion{Namespace: "hashicorp", Name: "dummy", Version: v, Platforms: []core.Platform{linuxAmd64}})
+		}
+		return out
+	}
+
+	tests := []struct {
+		name              string
+		versions          *core.ProviderVersions
+		includePrerelease bool
+		want              string
+		wantErr           error
+	}{
+		{
+			name:     "numeric ordering",
+			versions: versions("1.9.0", "1.10.0", "1.2.0"),
+			want:     "1.10.0",
+		},
+		{
+			name:     "pre-releases are excluded by default",
+			versions: versions("1.9.0", "1.10.0-rc1", "2.0.0-beta"),
+			want:     "1.9.0",
+		},
+		{
+			name:              "pre-releases are included",
+			versions:          versions("1.9.0", "1.10.0-rc1", "1.10.0-beta"),
+			includePrerelease: true,
+			want:              "1.10.0-rc1",
+		},
+		{
+			name:     "only pre-releases",
+			versions: versions("0.1.0-alpha"),
+			wantErr:  ErrProviderNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewService(&platformStorage{versions: tc.versions}, core.NewProxyUrlService(false, ""))
+
+			got, err := svc.GetLatestProviderVersion(context.Background(), "hashicorp", "dummy", tc.includePrerelease)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got.Version)
+			assert.Equal(t, []core.Platform{linuxAmd64}, got.Platforms)
+		})
+	}
+}
+
+// docsStorage counts the lookups of the provider docs
+type docsStorage struct {
+	platformStorage
+	exists  bool
+	err     error
+	lookups int
+}
+
+func (d *docsStorage) ProviderDocsExist(_ context.Context, _, _, _ string) (bool, error) {
+	d.lookups++
+	return d.exists, d.err
+}
+
+func TestService_GetProvider_docs(t *testing.T) {
+	storage := &docsStorage{exists: true}
+	svc := NewService(storage, core.NewProxyUrlService(false, ""), WithDocsPathPrefix("/v1/providers"))
+
+	// The docs are only looked up once for all platforms of the version
+	for _, platform := range []core.Platform{linuxAmd64, darwinArm64} {
+		p, err := svc.GetProvider(context.Background(), "hashicorp", "dummy", "1.0.0", platform.OS, platform.Arch)
+		require.NoError(t, err)
+		assert.Equal(t, "/v1/providers/hashicorp/dummy/1.0.0/docs", p.DocsURL)
+	}
+	assert.Equal(t, 1, storage.lookups)
+
+	// A failed lookup omits the docs_url and isn't cached
+	storage.err = errors.New("storage unavailable")
+	p, err := svc.GetProvider(context.Background(), "hashicorp", "dummy", "1.1.0", "linux", "amd64")
+	require.NoError(t, err)
+	assert.Empty(t, p.DocsURL)
+	_, err = svc.GetProvider(context.Background(), "hashicorp", "dummy", "1.1.0", "linux", "amd64")
+	require.NoError(t, err)
+	assert.Equal(t, 3, storage.lookups)
+}
@@ -12,10 +12,55 @@ type Storage interface {
 	GetProvider(ctx context.Context, namespace, name, version, os, arch string) (*core.Provider, error)
 	ListProviderVersions(ctx context.Context, namespace, name string) (*core.ProviderVersions, error)
 
+	// ProviderExists reports whether the archive of a provider version exists for the platform, without generating download URLs
+	ProviderExists(ctx context.Context, namespace, name, version, os, arch string) (bool, error)
+
+	// ListProviderPlatforms returns the platforms of the archives of a single provider version
+	ListProviderPlatforms(ctx context.Context, namespace, name, version string) ([]core.Platform, error)
+
 	// UploadProviderReleaseFiles is used to upload all artifacts which make up a provider release
 	// https://developer.hashicorp.com/terraform/registry/providers/publishing#manually-preparing-a-release
 	UploadProviderReleaseFiles(ctx context.Context, namespace, name, filename string, file io.Reader) error
 
+	// LockProviderVersion acquires the upload lock of a provider version, so that concurrent uploads of the same version
+	// can't interleave. It should return core.ErrUploadInProgress if the lock is already held.
+	LockProviderVersion(ctx context.Context, namespace, name, version string) error
+
+	// UnlockProviderVersion releases the upload lock of a provider version
+	UnlockProviderVersion(ctx context.Context, namespace, name, version string) error
+
+	// DownloadProviderReleaseFile returns a file that was uploaded with UploadProviderReleaseFiles
+	DownloadProviderReleaseFile(ctx context.Context, namespace, name, filename string) ([]byte, error)
+
+	// StreamProviderReleaseFile writes a file that was uploaded with UploadProviderReleaseFiles to w, without buffering it in memory
+	StreamProviderReleaseFile(ctx context.Context, namespace, name, filename string, w io.Writer) error
+
+	// DeleteProviderReleaseFile deletes a file that was uploaded with UploadProviderReleaseFiles
+	DeleteProviderReleaseFile(ctx context.Context, namespace, name, filename string) error
+
+	// ProviderReleaseFileChecksum returns the SHA-256 checksum of a file, which was computed while it was uploaded with UploadProviderReleaseFiles.
+	// It should return core.ErrObjectNotFound if the file doesn't exist, and a nil checksum if the file was uploaded without one.
+	ProviderReleaseFileChecksum(ctx context.Context, namespace, name, filename string) ([]byte, error)
+
+	// ProviderSha256Sums returns the SHA256SUMS file of a provider version.
+	// It should return core.ErrObjectNotFound if the provider version doesn't exist.
+	ProviderSha256Sums(ctx context.Context, namespace, name, version string) ([]byte, error)
+
+	// ProviderDocs returns the metadata.json document of a provider version, which was uploaded with UploadProviderReleaseFiles.
+	// It should return core.ErrObjectNotFound if the provider version has no docs.
+	ProviderDocs(ctx context.Context, namespace, name, version string) ([]byte, error)
+
+	// ProviderDocsExist reports whether a metadata.json document was uploaded for the provider version
+	ProviderDocsExist(ctx context.Context, namespace, name, version string) (bool, error)
+
 	// SigningKeys downloads and returns the keys for a given namespace from the configured storage backend
 	SigningKeys(ctx context.Context, namespace string) (*core.SigningKeys, error)
+
+	// ProviderSigningKeys returns the signing keys that apply to a provider version.
+	// Keys stored for the version take precedence over keys stored for the provider, which take precedence over the keys of the namespace.
+	// It should return core.ErrObjectNotFound if none of them exist.
+	ProviderSigningKeys(ctx context.Context, namespace, name, version string) (*core.SigningKeys, error)
+
+	// UploadSigningKeys stores the keys for a given namespace in the configured storage backend
+	UploadSigningKeys(ctx context.Context, namespace string, signingKeys *core.SigningKeys) error
 }
@@ -2,12 +2,18 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/boring-registry/boring-registry/pkg/auth"
 	"github.com/boring-registry/boring-registry/pkg/core"
 	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+	"github.com/boring-registry/boring-registry/pkg/openapi"
 
 	"github.com/go-kit/kit/auth/jwt"
 	"github.com/go-kit/kit/endpoint"
@@ -25,20 +31,124 @@ const (
 	varVersion   muxVar = "version"
 )
 
+// Routes describes the endpoints of MakeHandler that aren't part of the provider registry protocol for the OpenAPI document
+var Routes = []openapi.Route{
+	{
+		Method:     http.MethodGet,
+		Path:       "/{namespace}/{name}/latest",
+		Summary:    "Get the latest version of a provider",
+		Parameters: append(versionParameters(false), openapi.QueryParameter("include_prerelease", "boolean", "Consider pre-release versions")),
+		Responses: map[int]string{
+			http.StatusOK:       "The latest version",
+			http.StatusNotFound: "The provider doesn't exist",
+		},
+		Authenticated: true,
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/{namespace}/{name}/{version}/download",
+		Summary:    "Download a provider version for the default platform of the registry",
+		Parameters: versionParameters(true),
+		Responses: map[int]string{
+			http.StatusOK:         "The download of the provider",
+			http.StatusBadRequest: "The registry has no default platform",
+			http.StatusNotFound:   "The provider version doesn't exist for the platform",
+		},
+		Authenticated: true,
+	},
+	{
+		Method:  http.MethodHead,
+		Path:    "/{namespace}/{name}/{version}/{os}/{arch}",
+		Summary: "Check that a provider version exists for a platform",
+		Parameters: append(versionParameters(true),
+			openapi.PathParameter("os", "The operating system of the platform"),
+			openapi.PathParameter("arch", "The architecture of the platform"),
+		),
+		Responses: map[int]string{
+			http.StatusOK:       "The provider version exists",
+			http.StatusNotFound: "The provider version doesn't exist for the platform",
+		},
+		Authenticated: true,
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/batch",
+		Summary: "Resolve the downloads of several provider versions",
+		Responses: map[int]string{
+			http.StatusOK:         "The download or the error of every provider in the order of the request",
+			http.StatusBadRequest: "The batch is malformed or too large",
+		},
+		Authenticated: true,
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/{namespace}/{name}/{version}/docs",
+		Summary:    "Get the docs of a provider version",
+		Parameters: versionParameters(true),
+		Responses: map[int]string{
+			http.StatusOK:       "The docs of the provider version",
+			http.StatusNotFound: "The provider version has no docs",
+		},
+		Authenticated: true,
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/{namespace}/{name}/{version}/shasums",
+		Summary:    "Get the SHA256SUMS file of a provider version",
+		Parameters: versionParameters(true),
+		Responses: map[int]string{
+			http.StatusOK:       "The SHA256SUMS file",
+			http.StatusNotFound: "The provider version doesn't exist",
+		},
+		Authenticated: true,
+	},
+}
+
+func versionParameters(withVersion bool) []openapi.Parameter {
+	params := []openapi.Parameter{
+		openapi.PathParameter("namespace", "The namespace of the provider"),
+		openapi.PathParameter("name", "The name of the provider"),
+	}
+	if withVersion {
+		params = append(params, openapi.PathParameter("version", "The version of the provider"))
+	}
+	return params
+}
+
 // MakeHandler returns a fully initialized http.Handler.
-func MakeHandler(svc Service, auth endpoint.Middleware, metrics *o11y.ProviderMetrics, instrumentation o11y.Middleware, options ...httptransport.ServerOption) http.Handler {
+func MakeHandler(svc Service, authMiddleware endpoint.Middleware, metrics *o11y.ProviderMetrics, instrumentation o11y.Middleware, options ...httptransport.ServerOption) http.Handler {
 	r := mux.NewRouter().StrictSlash(true)
 
 	r.Methods("GET").Path(`/{namespace}/{name}/versions`).Handler(
 		instrumentation.WrapHandler(
 			httptransport.NewServer(
-				auth(listEndpoint(svc, metrics)),
+				authMiddleware(listEndpoint(svc, metrics)),
 				decodeListRequest,
+				encodeListResponse,
+				append(
+					options,
+					httptransport.ServerBefore(extractMuxVars(varNamespace, varName)),
+					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
+					httptransport.ServerBefore(core.DownloadModeToContext),
+					httptransport.ServerBefore(core.IfNoneMatchToContext),
+				)...,
+			),
+		),
+	)
+
+	r.Methods("GET").Path(`/{namespace}/{name}/latest`).Handler(
+		instrumentation.WrapHandler(
+			httptransport.NewServer(
+				authMiddleware(latestEndpoint(svc)),
+				decodeLatestRequest,
 				httptransport.EncodeJSONResponse,
 				append(
 					options,
 					httptransport.ServerBefore(extractMuxVars(varNamespace, varName)),
 					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
+					httptransport.ServerBefore(core.DownloadModeToContext),
 				)...,
 			),
 		),
@@ -47,13 +157,97 @@ func MakeHandler(svc Service, auth endpoint.Middleware, metrics *o11y.ProviderMe
 	r.Methods("GET").Path(`/{namespace}/{name}/{version}/download/{os}/{arch}`).Handler(
 		instrumentation.WrapHandler(
 			httptransport.NewServer(
-				auth(downloadEndpoint(svc, metrics)),
+				authMiddleware(downloadEndpoint(svc, metrics)),
 				decodeDownloadRequest,
 				httptransport.EncodeJSONResponse,
 				append(
 					options,
 					httptransport.ServerBefore(extractMuxVars(varNamespace, varName, varOS, varArch, varVersion)),
 					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
+					httptransport.ServerBefore(core.DownloadModeToContext),
+				)...,
+			),
+		),
+	)
+
+	// Clients that omit the platform are served the default platform of the registry
+	r.Methods("GET").Path(`/{namespace}/{name}/{version}/download`).Handler(
+		instrumentation.WrapHandler(
+			httptransport.NewServer(
+				authMiddleware(downloadEndpoint(svc, metrics)),
+				decodeDefaultPlatformDownloadRequest,
+				httptransport.EncodeJSONResponse,
+				append(
+					options,
+					httptransport.ServerBefore(extractMuxVars(varNamespace, varName, varVersion)),
+					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
+					httptransport.ServerBefore(core.DownloadModeToContext),
+				)...,
+			),
+		),
+	)
+
+	r.Methods("HEAD").Path(`/{namespace}/{name}/{version}/{os}/{arch}`).Handler(
+		instrumentation.WrapHandler(
+			httptransport.NewServer(
+				authMiddleware(existsEndpoint(svc)),
+				decodeDownloadRequest,
+				encodeExistsResponse,
+				append(
+					options,
+					httptransport.ServerBefore(extractMuxVars(varNamespace, varName, varOS, varArch, varVersion)),
+					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
+				)...,
+			),
+		),
+	)
+
+	// The batch is authenticated once, the namespace-specific claim requirements of the items are checked by the endpoint
+	r.Methods("POST").Path(`/batch`).Handler(
+		instrumentation.WrapHandler(
+			httptransport.NewServer(
+				authMiddleware(batchEndpoint(svc)),
+				decodeBatchRequest,
+				httptransport.EncodeJSONResponse,
+				append(
+					options,
+					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(core.DownloadModeToContext),
+				)...,
+			),
+		),
+	)
+
+	r.Methods("GET").Path(`/{namespace}/{name}/{version}/docs`).Handler(
+		instrumentation.WrapHandler(
+			httptransport.NewServer(
+				authMiddleware(docsEndpoint(svc)),
+				decodeDocsRequest,
+				encodeDocsResponse,
+				append(
+					options,
+					httptransport.ServerBefore(extractMuxVars(varNamespace, varName, varVersion)),
+					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
+				)...,
+			),
+		),
+	)
+
+	r.Methods("GET").Path(`/{namespace}/{name}/{version}/shasums`).Handler(
+		instrumentation.WrapHandler(
+			httptransport.NewServer(
+				authMiddleware(sha256SumsEndpoint(svc)),
+				decodeDocsRequest,
+				encodeSha256SumsResponse,
+				append(
+					options,
+					httptransport.ServerBefore(extractMuxVars(varNamespace, varName, varVersion)),
+					httptransport.ServerBefore(jwt.HTTPToContext()),
+					httptransport.ServerBefore(auth.NamespaceToContext()),
 				)...,
 			),
 		),
@@ -79,6 +273,28 @@ func decodeListRequest(ctx context.Context, r *http.Request) (interface{}, error
 	}, nil
 }
 
+func decodeLatestRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	list, err := decodeListRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	req := list.(listRequest)
+
+	includePrerelease := false
+	if v := r.URL.Query().Get("include_prerelease"); v != "" {
+		includePrerelease, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: include_prerelease", ErrInvalidQuery)
+		}
+	}
+
+	return latestRequest{
+		namespace:         req.namespace,
+		name:              req.name,
+		includePrerelease: includePrerelease,
+	}, nil
+}
+
 func decodeDownloadRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	namespace, ok := ctx.Value(varNamespace).(string)
 	if !ok {
@@ -114,18 +330,124 @@ func decodeDownloadRequest(ctx context.Context, r *http.Request) (interface{}, e
 	}, nil
 }
 
-// ErrorEncoder translates domain specific errors to HTTP status codes
-func ErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
-	var providerError *core.ProviderError
-	if errors.Is(err, ErrProviderNotFound) {
-		w.WriteHeader(http.StatusNotFound)
-	} else if errors.As(err, &providerError) {
-		w.WriteHeader(providerError.StatusCode)
-	} else {
-		w.WriteHeader(core.GenericError(err))
+// decodeDefaultPlatformDownloadRequest decodes a download request without os and arch, which the service fills in with the default platform
+func decodeDefaultPlatformDownloadRequest(ctx context.Context, _ *http.Request) (interface{}, error) {
+	namespace, ok := ctx.Value(varNamespace).(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: namespace", core.ErrVarMissing)
 	}
 
-	core.HandleErrorResponse(err, w)
+	name, ok := ctx.Value(varName).(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: name", core.ErrVarMissing)
+	}
+
+	version, ok := ctx.Value(varVersion).(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: version", core.ErrVarMissing)
+	}
+
+	return downloadRequest{
+		namespace: namespace,
+		name:      name,
+		version:   version,
+	}, nil
+}
+
+func decodeBatchRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req batchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBatchBodySize)).Decode(&req); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, fmt.Errorf("%w: the limit is %d bytes", core.ErrRequestTooLarge, maxBatchBodySize)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBatch, err)
+	}
+	if len(req) == 0 || len(req) > maxBatchSize {
+		return nil, fmt.Errorf("%w: expected between 1 and %d providers, got %d", ErrInvalidBatch, maxBatchSize, len(req))
+	}
+	for i, item := range req {
+		if item.Namespace == "" || item.Name == "" || item.Version == "" || item.OS == "" || item.Arch == "" {
+			return nil, fmt.Errorf("%w: provider %d requires a namespace, name, version, os and arch", ErrInvalidBatch, i)
+		}
+	}
+	return req, nil
+}
+
+func decodeDocsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	namespace, ok := ctx.Value(varNamespace).(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: namespace", core.ErrVarMissing)
+	}
+
+	name, ok := ctx.Value(varName).(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: name", core.ErrVarMissing)
+	}
+
+	version, ok := ctx.Value(varVersion).(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: version", core.ErrVarMissing)
+	}
+
+	return docsRequest{
+		namespace: namespace,
+		name:      name,
+		version:   version,
+	}, nil
+}
+
+// encodeListResponse sends the ETag of the versions and their platforms, so that unchanged listings are answered with 304 Not Modified
+func encodeListResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	var entries []string
+	for _, v := range response.(*core.ProviderVersions).Versions {
+		platforms := make([]string, 0, len(v.Platforms))
+		for _, p := range v.Platforms {
+			platforms = append(platforms, p.OS+"_"+p.Arch)
+		}
+		slices.Sort(platforms)
+		protocols := slices.Clone(v.Protocols)
+		slices.Sort(protocols)
+		entries = append(entries, strings.Join([]string{v.Namespace, v.Name, v.Version, v.Source, strings.Join(protocols, ","), strings.Join(platforms, ",")}, " "))
+	}
+
+	if core.NotModified(ctx, w, core.NewETag(entries)) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	return httptransport.EncodeJSONResponse(ctx, w, response)
+}
+
+func encodeDocsResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, err := w.Write(response.(docsResponse))
+	return err
+}
+
+func encodeSha256SumsResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err := w.Write(response.(sha256SumsResponse))
+	return err
+}
+
+// encodeExistsResponse responds to HEAD requests without a body
+func encodeExistsResponse(_ context.Context, w http.ResponseWriter, _ interface{}) error {
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// errorStatuses maps the domain specific errors to HTTP status codes
+var errorStatuses = []core.ErrorStatus{
+	{Err: ErrProviderNotFound, StatusCode: http.StatusNotFound},
+	{Err: ErrPlatformNotAllowed, StatusCode: http.StatusNotFound},
+	{Err: ErrPlatformRequired, StatusCode: http.StatusBadRequest},
+	{Err: ErrInvalidQuery, StatusCode: http.StatusBadRequest},
+	{Err: ErrInvalidBatch, StatusCode: http.StatusBadRequest},
+}
+
+// ErrorEncoder translates domain specific errors to HTTP status codes
+func ErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
+	core.EncodeError(err, w, errorStatuses...)
 }
 
 func extractMuxVars(keys ...muxVar) httptransport.RequestFunc {
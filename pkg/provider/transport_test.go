@@ -0,0 +1,394 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/auth"
+	"github.com/boring-registry/boring-registry/pkg/core"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorEncoder(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+	}{
+		{err: ErrProviderNotFound, wantStatus: http.StatusNotFound},
+		{err: ErrPlatformNotAllowed, wantStatus: http.StatusNotFound},
+		{err: &core.ProviderError{Reason: "failed to locate provider", Provider: &core.Provider{Name: "random"}, StatusCode: http.StatusNotFound}, wantStatus: http.StatusNotFound},
+		{err: core.ErrObjectAlreadyExists, wantStatus: http.StatusConflict},
+		{err: core.ErrForbidden, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ErrorEncoder(context.Background(), fmt.Errorf("wrapped: %w", tt.err), rec)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+type downloadStorage struct {
+	Storage
+	// docs is the metadata.json document of every version, versions have no docs if it's nil
+	docs []byte
+}
+
+func (d *downloadStorage) ProviderDocs(_ context.Context, _, _, _ string) ([]byte, error) {
+	if d.docs == nil {
+		return nil, core.ErrObjectNotFound
+	}
+	return d.docs, nil
+}
+
+func (d *downloadStorage) ProviderSha256Sums(_ context.Context, _, name, version string) ([]byte, error) {
+	if version != "3.6.0" {
+		return nil, core.ErrObjectNotFound
+	}
+	return fmt.Appendf(nil, "5f9c7aa76b7c34d722fc9123208e26b22d60440cb47150dd04733b9b94f4541a  terraform-provider-%s_%s_linux_amd64.zip\n", name, version), nil
+}
+
+func (d *downloadStorage) ProviderDocsExist(_ context.Context, _, _, _ string) (bool, error) {
+	return d.docs != nil, nil
+}
+
+func (d *downloadStorage) ProviderExists(_ context.Context, _, _, version, os, arch string) (bool, error) {
+	return version == "3.6.0" && os == "linux" && arch == "amd64", nil
+}
+
+func (d *downloadStorage) GetProvider(_ context.Context, namespace, name, version, os, arch string) (*core.Provider, error) {
+	if version == "0.0.0" {
+		return nil, fmt.Errorf("%w: %s/%s/%s", ErrProviderNotFound, namespace, name, version)
+	}
+	base := fmt.Sprintf("https://bucket.s3.eu-central-1.amazonaws.com/providers/%s/%s/terraform-provider-%s_%s", namespace, name, name, version)
+	return &core.Provider{
+		Namespace:           namespace,
+		Name:                name,
+		Version:             version,
+		OS:                  os,
+		Arch:                arch,
+		DownloadURL:         fmt.Sprintf("%s_%s_%s.zip", base, os, arch),
+		SHASumsURL:          base + "_SHA256SUMS",
+		SHASumsSignatureURL: base + "_SHA256SUMS.sig",
+	}, nil
+}
+
+type noopInstrumentation struct{}
+
+func (noopInstrumentation) WrapHandler(handler http.Handler) http.HandlerFunc {
+	return handler.ServeHTTP
+}
+
+func testHandler(svc Service) http.Handler {
+	metrics := &o11y.ProviderMetrics{
+		ListVersions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "list_versions"}, []string{o11y.NamespaceLabel, o11y.NameLabel}),
+		Download:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "download"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.VersionLabel, o11y.OsLabel, o11y.ArchLabel}),
+	}
+	return MakeHandler(svc, func(next endpoint.Endpoint) endpoint.Endpoint { return next }, metrics, noopInstrumentation{}, httptransport.ServerErrorEncoder(ErrorEncoder))
+}
+
+func TestMakeHandler_downloadMode(t *testing.T) {
+	handler := testHandler(NewService(&downloadStorage{}, core.NewProxyUrlService(true, "/v1/proxy")))
+
+	tests := []struct {
+		name   string
+		target string
+		header map[string]string
+		want   string
+	}{
+		{
+			name:   "proxy by default",
+			target: "/hashicorp/random/3.6.0/download/linux/amd64",
+			want:   "/v1/proxy/providers/hashicorp/random/terraform-provider-random_3.6.0_SHA256SUMS",
+		},
+		{
+			name:   "direct with query parameter",
+			target: "/hashicorp/random/3.6.0/download/linux/amd64?download=direct",
+			want:   "https://bucket.s3.eu-central-1.amazonaws.com/providers/hashicorp/random/terraform-provider-random_3.6.0_SHA256SUMS",
+		},
+		{
+			name:   "direct with header",
+			target: "/hashicorp/random/3.6.0/download/linux/amd64",
+			header: map[string]string{core.DownloadModeHeader: core.DownloadModeDirect},
+			want:   "https://bucket.s3.eu-central-1.amazonaws.com/providers/hashicorp/random/terraform-provider-random_3.6.0_SHA256SUMS",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var res downloadResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+			assert.Equal(t, tt.want, res.ShasumsURL)
+			assert.Equal(t, strings.TrimSuffix(tt.want, "SHA256SUMS")+"linux_amd64.zip", res.DownloadURL)
+		})
+	}
+}
+
+func TestMakeHandler_docs(t *testing.T) {
+	docs := []byte(`{"readme":"# random"}`)
+
+	tests := []struct {
+		name        string
+		docs        []byte
+		wantDocsURL string
+		wantStatus  int
+	}{
+		{
+			name:        "docs are present",
+			docs:        docs,
+			wantDocsURL: "/v1/providers/hashicorp/random/3.6.0/docs",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:       "docs are absent",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(&downloadStorage{docs: tt.docs}, core.NewProxyUrlService(false, ""), WithDocsPathPrefix("/v1/providers/"))
+			handler := testHandler(svc)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hashicorp/random/3.6.0/download/linux/amd64", nil))
+			require.Equal(t, http.StatusOK, rec.Code)
+			var res downloadResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+			assert.Equal(t, tt.wantDocsURL, res.DocsURL)
+
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hashicorp/random/3.6.0/docs", nil))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.docs != nil {
+				assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+				assert.Equal(t, tt.docs, rec.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestMakeHandler_sha256Sums(t *testing.T) {
+	storage := &downloadStorage{}
+	handler := testHandler(NewService(storage, core.NewProxyUrlService(false, "")))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hashicorp/random/3.6.0/shasums", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	stored, _ := storage.ProviderSha256Sums(context.Background(), "hashicorp", "random", "3.6.0")
+	assert.Equal(t, stored, rec.Body.Bytes())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hashicorp/random/9.9.9/shasums", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestMakeHandler_latest(t *testing.T) {
+	storage := &platformStorage{versions: &core.ProviderVersions{Versions: []core.ProviderVersion{
+		{Namespace: "hashicorp", Name: "random", Version: "3.6.0", Platforms: []core.Platform{linuxAmd64}},
+		{Namespace: "hashicorp", Name: "random", Version: "3.7.0-rc1", Platforms: []core.Platform{linuxAmd64, darwinArm64}},
+	}}}
+	handler := testHandler(NewService(storage, core.NewProxyUrlService(false, "")))
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		want       string
+	}{
+		{target: "/hashicorp/random/latest", wantStatus: http.StatusOK, want: "3.6.0"},
+		{target: "/hashicorp/random/latest?include_prerelease=true", wantStatus: http.StatusOK, want: "3.7.0-rc1"},
+		{target: "/hashicorp/random/latest?include_prerelease=maybe", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			require.Equal(t, tt.wantStatus, rec.Code)
+			if tt.want == "" {
+				return
+			}
+
+			var got core.ProviderVersion
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, tt.want, got.Version)
+			assert.NotEmpty(t, got.Platforms)
+		})
+	}
+
+	// Providers without an eligible version aren't found
+	storage.versions = &core.ProviderVersions{Versions: []core.ProviderVersion{{Namespace: "hashicorp", Name: "random", Version: "0.1.0-alpha"}}}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hashicorp/random/latest", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestMakeHandler_exists(t *testing.T) {
+	svc := NewService(&downloadStorage{}, core.NewProxyUrlService(false, "/v1/proxy"), WithAllowedPlatforms([]core.Platform{{OS: "linux", Arch: "amd64"}}))
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{name: "existing platform", target: "/hashicorp/random/3.6.0/linux/amd64", wantStatus: http.StatusOK},
+		{name: "platform alias", target: "/hashicorp/random/3.6.0/linux/x86_64", wantStatus: http.StatusOK},
+		{name: "unknown version", target: "/hashicorp/random/3.7.0/linux/amd64", wantStatus: http.StatusNotFound},
+		{name: "unknown platform", target: "/hashicorp/random/3.6.0/linux/arm64", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			testHandler(svc).ServeHTTP(rec, httptest.NewRequest(http.MethodHead, tt.target, nil))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		metrics := &o11y.ProviderMetrics{
+			ListVersions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "list_versions"}, []string{o11y.NamespaceLabel, o11y.NameLabel}),
+			Download:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "download"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.VersionLabel, o11y.OsLabel, o11y.ArchLabel}),
+		}
+		deny := func(endpoint.Endpoint) endpoint.Endpoint {
+			return func(context.Context, interface{}) (interface{}, error) { return nil, core.ErrUnauthorized }
+		}
+		handler := MakeHandler(svc, deny, metrics, noopInstrumentation{}, httptransport.ServerErrorEncoder(ErrorEncoder))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/hashicorp/random/3.6.0/linux/amd64", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestMakeHandler_defaultPlatform(t *testing.T) {
+	req := func() *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/hashicorp/random/3.6.0/download", nil)
+	}
+
+	rec := httptest.NewRecorder()
+	testHandler(NewService(&downloadStorage{}, core.NewProxyUrlService(false, ""), WithDefaultPlatform(core.Platform{OS: "linux", Arch: "amd64"}))).ServeHTTP(rec, req())
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res downloadResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.Equal(t, "linux", res.OS)
+	assert.Equal(t, "amd64", res.Arch)
+
+	rec = httptest.NewRecorder()
+	testHandler(NewService(&downloadStorage{}, core.NewProxyUrlService(false, ""))).ServeHTTP(rec, req())
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrPlatformRequired.Error())
+}
+
+func TestMakeHandler_batch(t *testing.T) {
+	svc := NewService(&downloadStorage{}, core.NewProxyUrlService(false, "/v1/proxy"), WithAllowedPlatforms([]core.Platform{{OS: "linux", Arch: "amd64"}}))
+	// Nobody is granted access to the private namespace
+	svc = ACLMiddleware(auth.ACL{"private": {}})(svc)
+	metrics := &o11y.ProviderMetrics{
+		ListVersions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "list_versions"}, []string{o11y.NamespaceLabel, o11y.NameLabel}),
+		Download:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "download"}, []string{o11y.NamespaceLabel, o11y.NameLabel, o11y.VersionLabel, o11y.OsLabel, o11y.ArchLabel}),
+	}
+	// The batch is authenticated and rate limited once, not per item
+	var authenticated int
+	authMiddleware := func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			authenticated++
+			return next(ctx, request)
+		}
+	}
+	handler := MakeHandler(svc, authMiddleware, metrics, noopInstrumentation{}, httptransport.ServerErrorEncoder(ErrorEncoder))
+
+	batch := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := batch(`[
+		{"namespace": "hashicorp", "name": "random", "version": "3.6.0", "os": "linux", "arch": "amd64"},
+		{"namespace": "hashicorp", "name": "random", "version": "0.0.0", "os": "linux", "arch": "amd64"},
+		{"namespace": "hashicorp", "name": "random", "version": "3.6.0", "os": "darwin", "arch": "arm64"},
+		{"namespace": "private", "name": "random", "version": "3.6.0", "os": "linux", "arch": "amd64"},
+		{"namespace": "hashicorp", "name": "null", "version": "3.2.0", "os": "linux", "arch": "x86_64"}
+	]`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, authenticated)
+	// The lookups aren't counted as downloads
+	assert.Zero(t, testutil.CollectAndCount(metrics.Download))
+
+	var res batchResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	require.Len(t, res.Providers, 5)
+
+	assert.Equal(t, batchItem{Namespace: "hashicorp", Name: "random", Version: "3.6.0", OS: "linux", Arch: "amd64"}, res.Providers[0].batchItem)
+	require.NotNil(t, res.Providers[0].Provider)
+	assert.Equal(t, "https://bucket.s3.eu-central-1.amazonaws.com/providers/hashicorp/random/terraform-provider-random_3.6.0_linux_amd64.zip", res.Providers[0].Provider.DownloadURL)
+	assert.Nil(t, res.Providers[0].Error)
+
+	for i, wantStatus := range map[int]int{1: http.StatusNotFound, 2: http.StatusNotFound, 3: http.StatusForbidden} {
+		assert.Nil(t, res.Providers[i].Provider, i)
+		require.NotNil(t, res.Providers[i].Error, i)
+		assert.Equal(t, wantStatus, res.Providers[i].Error.Status, i)
+	}
+
+	// Platform aliases are resolved like for single downloads
+	require.NotNil(t, res.Providers[4].Provider)
+	assert.Equal(t, "amd64", res.Providers[4].Provider.Arch)
+
+	for _, body := range []string{`[]`, `{}`, `[{"namespace": "hashicorp", "name": "random"}]`} {
+		assert.Equal(t, http.StatusBadRequest, batch(body).Code, body)
+	}
+	assert.Equal(t, http.StatusRequestEntityTooLarge, batch(`[`+strings.Repeat(" ", maxBatchBodySize)+`]`).Code)
+}
+
+func TestMakeHandler_listETag(t *testing.T) {
+	storage := &platformStorage{versions: &core.ProviderVersions{Versions: []core.ProviderVersion{
+		{Namespace: "hashicorp", Name: "random", Version: "3.6.0", Platforms: []core.Platform{{OS: "linux", Arch: "amd64"}, {OS: "darwin", Arch: "arm64"}}},
+	}}}
+	handler := testHandler(NewService(storage, core.NewProxyUrlService(false, "")))
+
+	list := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/hashicorp/random/versions", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := list("")
+	require.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	rec = list(etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.Bytes())
+
+	rec = list(`"other", ` + strings.TrimPrefix(etag, "W/"))
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	storage.versions.Versions[0].Platforms = append(storage.versions.Versions[0].Platforms, core.Platform{OS: "linux", Arch: "arm64"})
+	rec = list(etag)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+}
@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+)
+
+// VerifyRelease downloads the SHA256SUMS file of a provider release and verifies that every archive listed in it
+// was uploaded with the advertised checksum. It's meant to run once all archives and the SHA256SUMS file are present.
+// The checksums that were computed during the upload are compared if the storage has them, otherwise the archives are downloaded.
+func VerifyRelease(ctx context.Context, storage Storage, namespace, name, shaSumsFileName string) error {
+	sumsBytes, err := storage.DownloadProviderReleaseFile(ctx, namespace, name, shaSumsFileName)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", shaSumsFileName, err)
+	}
+
+	sums, err := core.NewSha256Sums(shaSumsFileName, bytes.NewReader(sumsBytes))
+	if err != nil {
+		return err
+	}
+
+	for _, fileName := range slices.Sorted(maps.Keys(sums.Entries)) {
+		checksum, err := archiveChecksum(ctx, storage, namespace, name, fileName)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(sums.Entries[fileName], checksum) {
+			return fmt.Errorf("%w: %s", ErrChecksumMismatch, fileName)
+		}
+	}
+
+	return nil
+}
+
+// archiveChecksum returns the checksum that was computed during the upload of an archive, or streams the archive to compute it
+func archiveChecksum(ctx context.Context, storage Storage, namespace, name, fileName string) ([]byte, error) {
+	checksum, err := storage.ProviderReleaseFileChecksum(ctx, namespace, name, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the checksum of %s: %w", fileName, err)
+	} else if checksum != nil {
+		return checksum, nil
+	}
+
+	h := sha256.New()
+	if err := storage.StreamProviderReleaseFile(ctx, namespace, name, fileName, h); err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", fileName, err)
+	}
+	return h.Sum(nil), nil
+}
+
+// DeleteReleaseFiles deletes the files of a release that failed its verification, so that the release isn't listed with mismatching archives.
+// All files are attempted, the returned error joins the failed deletions.
+func DeleteReleaseFiles(ctx context.Context, storage Storage, namespace, name string, fileNames []string) error {
+	var errs []error
+	for _, fileName := range fileNames {
+		if err := storage.DeleteProviderReleaseFile(ctx, namespace, name, fileName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
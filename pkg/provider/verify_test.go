@@ -0,0 +1,165 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testShaSumsFileName = "terraform-provider-dummy_1.0.0_SHA256SUMS"
+
+// mockedStorage keeps the release files of the hashicorp/dummy provider and the checksums of their uploads in memory
+type mockedStorage struct {
+	Storage
+	files     map[string][]byte
+	checksums map[string][]byte
+	downloads int
+}
+
+func (m *mockedStorage) DownloadProviderReleaseFile(_ context.Context, _, _, filename string) ([]byte, error) {
+	b, ok := m.files[filename]
+	if !ok {
+		return nil, core.ErrObjectNotFound
+	}
+	m.downloads++
+	return b, nil
+}
+
+func (m *mockedStorage) StreamProviderReleaseFile(_ context.Context, _, _, filename string, w io.Writer) error {
+	b, ok := m.files[filename]
+	if !ok {
+		return core.ErrObjectNotFound
+	}
+	m.downloads++
+	_, err := w.Write(b)
+	return err
+}
+
+func (m *mockedStorage) DeleteProviderReleaseFile(_ context.Context, _, _, filename string) error {
+	if _, ok := m.files[filename]; !ok {
+		return core.ErrObjectNotFound
+	}
+	delete(m.files, filename)
+	return nil
+}
+
+func (m *mockedStorage) ProviderReleaseFileChecksum(_ context.Context, _, _, filename string) ([]byte, error) {
+	if _, ok := m.files[filename]; !ok {
+		return nil, core.ErrObjectNotFound
+	}
+	return m.checksums[filename], nil
+}
+
+func sha256Sum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerifyRelease(t *testing.T) {
+	linux := []byte("linux archive")
+	darwin := []byte("darwin archive")
+
+	tests := []struct {
+		name    string
+		files   map[string][]byte
+		wantErr error
+	}{
+		{
+			name: "matching checksums",
+			files: map[string][]byte{
+				"terraform-provider-dummy_1.0.0_linux_amd64.zip":  linux,
+				"terraform-provider-dummy_1.0.0_darwin_arm64.zip": darwin,
+				testShaSumsFileName: []byte(fmt.Sprintf("%s  terraform-provider-dummy_1.0.0_linux_amd64.zip\n%s  terraform-provider-dummy_1.0.0_darwin_arm64.zip\n",
+					sha256Sum(linux), sha256Sum(darwin))),
+			},
+		},
+		{
+			name: "wrong checksum",
+			files: map[string][]byte{
+				"terraform-provider-dummy_1.0.0_linux_amd64.zip":  linux,
+				"terraform-provider-dummy_1.0.0_darwin_arm64.zip": darwin,
+				testShaSumsFileName: []byte(fmt.Sprintf("%s  terraform-provider-dummy_1.0.0_linux_amd64.zip\n%s  terraform-provider-dummy_1.0.0_darwin_arm64.zip\n",
+					sha256Sum(linux), sha256Sum(linux))),
+			},
+			wantErr: ErrChecksumMismatch,
+		},
+		{
+			name: "listed archive is missing",
+			files: map[string][]byte{
+				"terraform-provider-dummy_1.0.0_linux_amd64.zip": linux,
+				testShaSumsFileName: []byte(fmt.Sprintf("%s  terraform-provider-dummy_1.0.0_linux_amd64.zip\n%s  terraform-provider-dummy_1.0.0_darwin_arm64.zip\n",
+					sha256Sum(linux), sha256Sum(darwin))),
+			},
+			wantErr: core.ErrObjectNotFound,
+		},
+		{
+			name: "SHA256SUMS is missing",
+			files: map[string][]byte{
+				"terraform-provider-dummy_1.0.0_linux_amd64.zip": linux,
+			},
+			wantErr: core.ErrObjectNotFound,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := &mockedStorage{files: tc.files}
+
+			err := VerifyRelease(context.Background(), storage, "hashicorp", "dummy", testShaSumsFileName)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestVerifyRelease_storedChecksums(t *testing.T) {
+	linux := []byte("linux archive")
+	linuxSum := sha256.Sum256(linux)
+	sums := []byte(fmt.Sprintf("%s  terraform-provider-dummy_1.0.0_linux_amd64.zip\n", sha256Sum(linux)))
+
+	storage := &mockedStorage{
+		files: map[string][]byte{
+			"terraform-provider-dummy_1.0.0_linux_amd64.zip": linux,
+			testShaSumsFileName: sums,
+		},
+		checksums: map[string][]byte{
+			"terraform-provider-dummy_1.0.0_linux_amd64.zip": linuxSum[:],
+		},
+	}
+	assert.NoError(t, VerifyRelease(context.Background(), storage, "hashicorp", "dummy", testShaSumsFileName))
+	assert.Equal(t, 1, storage.downloads, "only the SHA256SUMS file must be downloaded")
+
+	darwinSum := sha256.Sum256([]byte("darwin archive"))
+	storage.checksums["terraform-provider-dummy_1.0.0_linux_amd64.zip"] = darwinSum[:]
+	assert.ErrorIs(t, VerifyRelease(context.Background(), storage, "hashicorp", "dummy", testShaSumsFileName), ErrChecksumMismatch)
+}
+
+func TestDeleteReleaseFiles(t *testing.T) {
+	storage := &mockedStorage{
+		files: map[string][]byte{
+			"terraform-provider-dummy_1.0.0_linux_amd64.zip": []byte("linux archive"),
+			testShaSumsFileName:                             []byte("sums"),
+			"terraform-provider-dummy_1.0.0_SHA256SUMS.sig": []byte("signature"),
+		},
+	}
+
+	// The remaining files are deleted even if one of them is already gone
+	err := DeleteReleaseFiles(context.Background(), storage, "hashicorp", "dummy", []string{
+		"terraform-provider-dummy_1.0.0_darwin_arm64.zip",
+		"terraform-provider-dummy_1.0.0_linux_amd64.zip",
+		testShaSumsFileName,
+	})
+	assert.ErrorIs(t, err, core.ErrObjectNotFound)
+	assert.Equal(t, []string{"terraform-provider-dummy_1.0.0_SHA256SUMS.sig"}, slices.Collect(maps.Keys(storage.files)))
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	o11y "github.com/boring-registry/boring-registry/pkg/observability"
@@ -14,8 +15,15 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// immutableCacheControl allows caches to reuse the archives, as they never change once they're uploaded
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
 type proxyRequest struct {
 	url string
+	// checksum is the SHA256 checksum of the file, if it's known
+	checksum string
+	// header contains the request headers that are forwarded to the storage backend
+	header http.Header
 }
 
 type proxyResponse struct {
@@ -24,12 +32,28 @@ type proxyResponse struct {
 	Header     http.Header
 }
 
-func proxyEndpoint(storage Storage, metrics *o11y.ProxyMetrics) endpoint.Endpoint {
+func proxyEndpoint(storage Storage, metrics *o11y.ProxyMetrics, verify bool) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		input := request.(proxyRequest)
 
 		metrics.Download.With(prometheus.Labels{}).Inc()
 
+		// The ETag is derived from the checksum, so the storage backend doesn't have to be contacted to revalidate a file
+		etag := ""
+		if input.checksum != "" {
+			etag = `"sha256:` + input.checksum + `"`
+			if etagMatches(input.header.Get("If-None-Match"), etag) {
+				return proxyResponse{
+					StatusCode: http.StatusNotModified,
+					Header: http.Header{
+						"Etag":          []string{etag},
+						"Cache-Control": []string{immutableCacheControl},
+					},
+					Body: http.NoBody,
+				}, nil
+			}
+		}
+
 		downloadUrl, err := storage.GetDownloadUrl(ctx, input.url)
 		if err != nil {
 			metrics.Failure.With(prometheus.Labels{
@@ -46,6 +70,7 @@ func proxyEndpoint(storage Storage, metrics *o11y.ProxyMetrics) endpoint.Endpoin
 			}).Inc()
 			return nil, ErrInvalidRequestUrl
 		}
+		forwardRequestHeaders(req.Header, input.header, etag)
 
 		// Send the HTTP request
 		client := &http.Client{}
@@ -58,14 +83,48 @@ func proxyEndpoint(storage Storage, metrics *o11y.ProxyMetrics) endpoint.Endpoin
 		}
 
 		headers := resp.Header.Clone()
+		body := resp.Body
+
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusPartialContent, http.StatusNotModified:
+			headers.Set("Cache-Control", immutableCacheControl)
+			if etag != "" {
+				headers.Set("ETag", etag)
+			}
+		}
+
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+			fileName, fileNameErr := getFileNameFromURL(downloadUrl)
 
-		if resp.StatusCode == 200 {
 			// Add Content-Disposition header if not there
 			_, ok := headers["Content-Disposition"]
-			if !ok {
-				fileName, err := getFileNameFromURL(downloadUrl)
-				if err == nil {
-					headers.Add("Content-Disposition", `attachment;filename="`+fileName+`"`)
+			if !ok && fileNameErr == nil {
+				headers.Add("Content-Disposition", `attachment;filename="`+fileName+`"`)
+			}
+
+			// Storage backends mostly return a generic content type, as it's not set when the files are uploaded
+			if contentType := contentTypeFromFileName(fileName); contentType != "" && fileNameErr == nil {
+				headers.Set("Content-Type", contentType)
+			}
+
+			if headers.Get("Content-Length") == "" && resp.ContentLength >= 0 {
+				headers.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+			}
+
+			// Presigned URLs of all storage backends support range requests
+			if headers.Get("Accept-Ranges") == "" {
+				headers.Set("Accept-Ranges", "bytes")
+			}
+
+			// Partial content can't be validated, only complete archives are verified
+			if verify && fileNameErr == nil && resp.StatusCode == http.StatusOK {
+				body, err = newVerifyingReader(resp.Body, fileName)
+				if err != nil {
+					resp.Body.Close()
+					metrics.Failure.With(prometheus.Labels{
+						o11y.ProxyFailureLabel: o11y.ProxyFailureIntegrity,
+					}).Inc()
+					return nil, err
 				}
 			}
 		}
@@ -73,13 +132,68 @@ func proxyEndpoint(storage Storage, metrics *o11y.ProxyMetrics) endpoint.Endpoin
 		pResp := proxyResponse{
 			StatusCode: resp.StatusCode,
 			Header:     headers,
-			Body:       resp.Body,
+			Body:       body,
 		}
 
 		return pResp, nil
 	}
 }
 
+// forwardRequestHeaders passes the headers for partial and conditional downloads to the storage backend.
+// The storage backend isn't aware of the checksum-based etag, so conditions on it are resolved by the proxy.
+func forwardRequestHeaders(dst, src http.Header, etag string) {
+	if v := src.Values("Range"); len(v) > 0 {
+		dst["Range"] = v
+	}
+
+	if etag == "" {
+		for _, h := range []string{"If-Range", "If-None-Match"} {
+			if v := src.Values(h); len(v) > 0 {
+				dst[h] = v
+			}
+		}
+		return
+	}
+
+	// The file never changes, so a Range with a matching If-Range can be forwarded unconditionally,
+	// while any other If-Range requires the complete file
+	if ifRange := src.Get("If-Range"); ifRange != "" && ifRange != etag {
+		dst.Del("Range")
+	}
+}
+
+// etagMatches reports whether the If-None-Match header matches the etag, using the weak comparison of RFC 9110
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// contentTypeFromFileName returns the media type of the provider and module files, or an empty string for unknown files
+func contentTypeFromFileName(fileName string) string {
+	switch {
+	case strings.HasSuffix(fileName, ".zip"):
+		return "application/zip"
+	case strings.HasSuffix(fileName, ".tar.gz"), strings.HasSuffix(fileName, ".tgz"):
+		return "application/gzip"
+	case strings.HasSuffix(fileName, ".tar.zst"):
+		return "application/zstd"
+	case strings.HasSuffix(fileName, ".tar.bz2"), strings.HasSuffix(fileName, ".tar.tbz2"):
+		return "application/x-bzip2"
+	case strings.HasSuffix(fileName, ".tar.xz"), strings.HasSuffix(fileName, ".txz"):
+		return "application/x-xz"
+	case strings.HasSuffix(fileName, "_SHA256SUMS"):
+		return "text/plain; charset=utf-8"
+	case strings.HasSuffix(fileName, "_SHA256SUMS.sig"):
+		return "application/pgp-signature"
+	}
+	return ""
+}
+
 // Extract zip filename from the path part of the URL, which should be located at the end of the path
 func getFileNameFromURL(downloadUrl string) (string, error) {
 	parsedUrl, err := url.ParseRequestURI(downloadUrl)
@@ -6,4 +6,6 @@ var (
 	// Proxy errors
 	ErrInvalidRequestUrl  = errors.New("failed to initiate remote URL request")
 	ErrCannotDownloadFile = errors.New("remote file failed to download")
+	ErrInvalidArchive     = errors.New("archive failed validation")
+	ErrTooManyDownloads   = errors.New("too many concurrent downloads")
 )
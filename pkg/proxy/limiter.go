@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LimitConcurrency returns a middleware that proxies at most maxConcurrent downloads at the same time.
+// Excess requests are queued for up to queueTimeout, before they're rejected with 503 Service Unavailable.
+// With a queueTimeout of 0 or less, excess requests are rejected immediately.
+// The slot is held until the response has been streamed completely. A maxConcurrent of 0 disables the limit.
+func LimitConcurrency(maxConcurrent int, queueTimeout time.Duration, metrics *o11y.ProxyMetrics) func(http.Handler) http.Handler {
+	if maxConcurrent <= 0 {
+		return func(next http.Handler) http.Handler {
+			return trackInFlight(next, metrics)
+		}
+	}
+
+	slots := make(chan struct{}, maxConcurrent)
+	retryAfter := strconv.Itoa(int(math.Max(1, math.Ceil(queueTimeout.Seconds()))))
+
+	return func(next http.Handler) http.Handler {
+		next = trackInFlight(next, metrics)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !acquireSlot(r, slots, queueTimeout) {
+				if r.Context().Err() != nil {
+					// The client gave up while the request was queued
+					return
+				}
+				metrics.Failure.With(prometheus.Labels{
+					o11y.ProxyFailureLabel: o11y.ProxyFailureSaturated,
+				}).Inc()
+				w.Header().Set("Retry-After", retryAfter)
+				core.HandleErrorResponse(ErrTooManyDownloads, http.StatusServiceUnavailable, w)
+				return
+			}
+			defer func() { <-slots }()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// acquireSlot takes a free slot right away, or waits for up to queueTimeout until one is released
+func acquireSlot(r *http.Request, slots chan struct{}, queueTimeout time.Duration) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if queueTimeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func trackInFlight(next http.Handler, metrics *o11y.ProxyMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics.InFlight.Inc()
+		defer metrics.InFlight.Dec()
+
+		next.ServeHTTP(w, r)
+	})
+}
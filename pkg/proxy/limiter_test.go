@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingHandler blocks the downloads until release is closed
+type blockingHandler struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	h.entered <- struct{}{}
+	<-h.release
+	w.WriteHeader(http.StatusOK)
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{
+		entered: make(chan struct{}, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func serveAsync(wg *sync.WaitGroup, handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(rec, r)
+	}()
+	return rec
+}
+
+func TestLimitConcurrency_rejectsWhenSaturated(t *testing.T) {
+	metrics := testMetrics()
+	next := newBlockingHandler()
+	handler := LimitConcurrency(2, 50*time.Millisecond, metrics)(next)
+
+	var wg sync.WaitGroup
+	first := serveAsync(&wg, handler, httptest.NewRequest(http.MethodGet, "/archive.zip", nil))
+	second := serveAsync(&wg, handler, httptest.NewRequest(http.MethodGet, "/archive.zip", nil))
+	<-next.entered
+	<-next.entered
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.InFlight))
+
+	rejected := httptest.NewRecorder()
+	handler.ServeHTTP(rejected, httptest.NewRequest(http.MethodGet, "/archive.zip", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rejected.Code)
+	assert.Equal(t, "1", rejected.Header().Get("Retry-After"))
+	assert.Contains(t, rejected.Body.String(), ErrTooManyDownloads.Error())
+
+	close(next.release)
+	wg.Wait()
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.InFlight))
+}
+
+func TestLimitConcurrency_noQueueTimeout(t *testing.T) {
+	metrics := testMetrics()
+	next := newBlockingHandler()
+	handler := LimitConcurrency(2, 0, metrics)(next)
+
+	// Free slots are always taken, even though the queue timeout has expired right away
+	var wg sync.WaitGroup
+	first := serveAsync(&wg, handler, httptest.NewRequest(http.MethodGet, "/archive.zip", nil))
+	second := serveAsync(&wg, handler, httptest.NewRequest(http.MethodGet, "/archive.zip", nil))
+	<-next.entered
+	<-next.entered
+
+	rejected := httptest.NewRecorder()
+	handler.ServeHTTP(rejected, httptest.NewRequest(http.MethodGet, "/archive.zip", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rejected.Code)
+
+	close(next.release)
+	wg.Wait()
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, http.StatusOK, second.Code)
+}
+
+func TestLimitConcurrency_queuesUntilSlotIsReleased(t *testing.T) {
+	metrics := testMetrics()
+	next := newBlockingHandler()
+	handler := LimitConcurrency(1, 5*time.Second, metrics)(next)
+
+	var wg sync.WaitGroup
+	first := serveAsync(&wg, handler, httptest.NewRequest(http.MethodGet, "/archive.zip", nil))
+	<-next.entered
+
+	queued := serveAsync(&wg, handler, httptest.NewRequest(http.MethodGet, "/archive.zip", nil))
+	select {
+	case <-next.entered:
+		t.Fatal("the queued download must not start while the slot is taken")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Releasing the first download frees the slot for the queued one
+	close(next.release)
+	select {
+	case <-next.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the queued download didn't start after the slot was released")
+	}
+
+	wg.Wait()
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, http.StatusOK, queued.Code)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.InFlight))
+}
+
+func TestLimitConcurrency_canceledWhileQueued(t *testing.T) {
+	next := newBlockingHandler()
+	handler := LimitConcurrency(1, 5*time.Second, testMetrics())(next)
+
+	var wg sync.WaitGroup
+	serveAsync(&wg, handler, httptest.NewRequest(http.MethodGet, "/archive.zip", nil))
+	<-next.entered
+
+	var queuedWg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := serveAsync(&queuedWg, handler, httptest.NewRequest(http.MethodGet, "/archive.zip", nil).WithContext(ctx))
+	cancel()
+	queuedWg.Wait()
+
+	close(next.release)
+	wg.Wait()
+	assert.Len(t, next.entered, 0)
+	assert.Empty(t, queued.Body.String())
+}
+
+func TestLimitConcurrency_unlimited(t *testing.T) {
+	next := newBlockingHandler()
+	handler := LimitConcurrency(0, 0, testMetrics())(next)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		serveAsync(&wg, handler, httptest.NewRequest(http.MethodGet, "/archive.zip", nil))
+	}
+	for range 5 {
+		<-next.entered
+	}
+	close(next.release)
+	wg.Wait()
+}
@@ -6,6 +6,9 @@ import (
 
 // Storage represents the Storage of Terraform providers and modules.
 type Storage interface {
-	// Get a valid download URL from proxy link
+	// GetDownloadUrl resolves a proxied URL back to the URL of the object in the storage backend.
+	// The url is the path and query of a pre-signed URL of the storage backend, without the leading slash,
+	// as it's embedded into the proxy URL by core.ProxyUrlService.GetProxyUrl.
+	// URLs that don't point to an object of the storage backend are rejected with an error.
 	GetDownloadUrl(ctx context.Context, url string) (string, error)
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
@@ -13,6 +14,7 @@ import (
 	"github.com/go-kit/kit/auth/jwt"
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type muxVar string
@@ -22,15 +24,16 @@ const (
 )
 
 // MakeHandler returns a fully initialized http.Handler.
-func MakeHandler(storage Storage, metrics *o11y.ProxyMetrics, instrumentation o11y.Middleware, options ...httptransport.ServerOption) http.Handler {
+// If verify is set, zip and tar.gz archives are validated while they're streamed to the client.
+func MakeHandler(storage Storage, metrics *o11y.ProxyMetrics, instrumentation o11y.Middleware, verify bool, options ...httptransport.ServerOption) http.Handler {
 	r := mux.NewRouter().StrictSlash(true)
 
 	r.Methods("GET").Path(`/{url:.*}`).Handler(
 		instrumentation.WrapHandler(
 			httptransport.NewServer(
-				proxyEndpoint(storage, metrics),
+				proxyEndpoint(storage, metrics, verify),
 				decodeProxyRequest,
-				copyHeadersAndBody,
+				encodeProxyResponse(metrics),
 				append(
 					options,
 					httptransport.ServerBefore(extractMuxVars(varUrl)),
@@ -50,13 +53,32 @@ func decodeProxyRequest(ctx context.Context, r *http.Request) (interface{}, erro
 		return nil, fmt.Errorf("%w: url", core.ErrVarMissing)
 	}
 
+	checksum, downloadUrl := core.SplitProxyChecksum(downloadUrl)
 	completeUrl := downloadUrl + "?" + r.URL.RawQuery
 
 	return proxyRequest{
-		url: completeUrl,
+		url:      completeUrl,
+		checksum: checksum,
+		header:   r.Header,
 	}, nil
 }
 
+// encodeProxyResponse aborts the connection if the archive turns out to be corrupted while it's streamed.
+// The status code has already been sent at that point, so the client can only detect the failure by the incomplete body.
+func encodeProxyResponse(metrics *o11y.ProxyMetrics) httptransport.EncodeResponseFunc {
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		err := copyHeadersAndBody(ctx, w, response)
+		if errors.Is(err, ErrInvalidArchive) {
+			metrics.Failure.With(prometheus.Labels{
+				o11y.ProxyFailureLabel: o11y.ProxyFailureIntegrity,
+			}).Inc()
+			slog.Error("aborting download of corrupted archive", slog.String("err", err.Error()))
+			panic(http.ErrAbortHandler)
+		}
+		return err
+	}
+}
+
 // copyHeadersAndBody copy status codes, headers and body from the downloadUrl's HTTP response into the our response
 func copyHeadersAndBody(_ context.Context, w http.ResponseWriter, response interface{}) error {
 	resp := response.(proxyResponse)
@@ -80,15 +102,11 @@ func copyHeadersAndBody(_ context.Context, w http.ResponseWriter, response inter
 
 // ErrorEncoder translates domain specific errors to HTTP status codes
 func ErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
-	if errors.Is(err, ErrInvalidRequestUrl) {
-		w.WriteHeader(http.StatusUnprocessableEntity)
-	} else if errors.Is(err, ErrCannotDownloadFile) {
-		w.WriteHeader(http.StatusBadGateway)
-	} else {
-		w.WriteHeader(core.GenericError(err))
-	}
-
-	core.HandleErrorResponse(err, w)
+	core.EncodeError(err, w,
+		core.ErrorStatus{Err: ErrInvalidRequestUrl, StatusCode: http.StatusUnprocessableEntity},
+		core.ErrorStatus{Err: ErrCannotDownloadFile, StatusCode: http.StatusBadGateway},
+		core.ErrorStatus{Err: ErrInvalidArchive, StatusCode: http.StatusBadGateway},
+	)
 }
 
 func extractMuxVars(keys ...muxVar) httptransport.RequestFunc {
@@ -0,0 +1,283 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeHandler_rangeRequests(t *testing.T) {
+	archive := testZip(t, "")
+	modTime := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		header           http.Header
+		verify           bool
+		wantStatus       int
+		wantContentRange string
+		wantBody         []byte
+	}{
+		{
+			name:       "complete download",
+			wantStatus: http.StatusOK,
+			wantBody:   archive,
+		},
+		{
+			name:             "range",
+			header:           http.Header{"Range": []string{"bytes=100-199"}},
+			wantStatus:       http.StatusPartialContent,
+			wantContentRange: "bytes 100-199/" + strconv.Itoa(len(archive)),
+			wantBody:         archive[100:200],
+		},
+		{
+			name:             "range is not verified",
+			header:           http.Header{"Range": []string{"bytes=1024-"}},
+			verify:           true,
+			wantStatus:       http.StatusPartialContent,
+			wantContentRange: "bytes 1024-" + strconv.Itoa(len(archive)-1) + "/" + strconv.Itoa(len(archive)),
+			wantBody:         archive[1024:],
+		},
+		{
+			name: "matching If-Range",
+			header: http.Header{
+				"Range":    []string{"bytes=0-9"},
+				"If-Range": []string{modTime.Format(http.TimeFormat)},
+			},
+			wantStatus:       http.StatusPartialContent,
+			wantContentRange: "bytes 0-9/" + strconv.Itoa(len(archive)),
+			wantBody:         archive[:10],
+		},
+		{
+			name: "outdated If-Range returns the complete archive",
+			header: http.Header{
+				"Range":    []string{"bytes=0-9"},
+				"If-Range": []string{modTime.Add(-time.Hour).Format(http.TimeFormat)},
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   archive,
+		},
+		{
+			name:             "unsatisfiable range",
+			header:           http.Header{"Range": []string{"bytes=" + strconv.Itoa(len(archive)+1) + "-"}},
+			wantStatus:       http.StatusRequestedRangeNotSatisfiable,
+			wantContentRange: "bytes */" + strconv.Itoa(len(archive)),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.ServeContent(w, r, "", modTime, bytes.NewReader(archive))
+			}))
+			defer upstream.Close()
+
+			storage := &mockedStorage{url: upstream.URL + "/hashicorp/dummy/terraform-provider-dummy_1.0.0_linux_amd64.zip"}
+			server := httptest.NewServer(MakeHandler(storage, testMetrics(), noopInstrumentation{}, tc.verify, httptransport.ServerErrorEncoder(ErrorEncoder)))
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/archive", nil)
+			require.NoError(t, err)
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			assert.Equal(t, tc.wantContentRange, resp.Header.Get("Content-Range"))
+			if tc.wantBody != nil {
+				assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+				got, err := io.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.wantBody, got)
+			}
+		})
+	}
+}
+
+func TestMakeHandler_caching(t *testing.T) {
+	archive := testZip(t, "")
+	checksum := "5f9c7aa76b7c34d722fc9123208e26b22d60440cb47150dd04733b9b94f4541a"
+	checksumETag := `"sha256:` + checksum + `"`
+	upstreamETag := `"0123456789abcdef"`
+
+	tests := []struct {
+		name             string
+		path             string
+		header           http.Header
+		wantStatus       int
+		wantETag         string
+		wantUpstreamCall bool
+	}{
+		{
+			name:             "etag derived from the checksum",
+			path:             "/sha256:" + checksum + "/archive.zip",
+			wantStatus:       http.StatusOK,
+			wantETag:         checksumETag,
+			wantUpstreamCall: true,
+		},
+		{
+			name:       "matching If-None-Match",
+			path:       "/sha256:" + checksum + "/archive.zip",
+			header:     http.Header{"If-None-Match": []string{checksumETag}},
+			wantStatus: http.StatusNotModified,
+			wantETag:   checksumETag,
+		},
+		{
+			name:       "weak If-None-Match in a list",
+			path:       "/sha256:" + checksum + "/archive.zip",
+			header:     http.Header{"If-None-Match": []string{`"other", W/` + checksumETag}},
+			wantStatus: http.StatusNotModified,
+			wantETag:   checksumETag,
+		},
+		{
+			name:             "If-None-Match of a different file",
+			path:             "/sha256:" + checksum + "/archive.zip",
+			header:           http.Header{"If-None-Match": []string{`"sha256:0000"`}},
+			wantStatus:       http.StatusOK,
+			wantETag:         checksumETag,
+			wantUpstreamCall: true,
+		},
+		{
+			name:             "etag of the storage backend without checksum",
+			path:             "/archive.zip",
+			wantStatus:       http.StatusOK,
+			wantETag:         upstreamETag,
+			wantUpstreamCall: true,
+		},
+		{
+			name:             "If-None-Match is forwarded without checksum",
+			path:             "/archive.zip",
+			header:           http.Header{"If-None-Match": []string{upstreamETag}},
+			wantStatus:       http.StatusNotModified,
+			wantETag:         upstreamETag,
+			wantUpstreamCall: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstreamCalled := false
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamCalled = true
+				w.Header().Set("ETag", upstreamETag)
+				w.Header().Set("Cache-Control", "private")
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(archive))
+			}))
+			defer upstream.Close()
+
+			storage := &mockedStorage{url: upstream.URL + "/hashicorp/dummy/terraform-provider-dummy_1.0.0_linux_amd64.zip"}
+			server := httptest.NewServer(MakeHandler(storage, testMetrics(), noopInstrumentation{}, false, httptransport.ServerErrorEncoder(ErrorEncoder)))
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+tc.path, nil)
+			require.NoError(t, err)
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			assert.Equal(t, tc.wantETag, resp.Header.Get("ETag"))
+			assert.Equal(t, "public, max-age=31536000, immutable", resp.Header.Get("Cache-Control"))
+			assert.Equal(t, tc.wantUpstreamCall, upstreamCalled)
+
+			got, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			if tc.wantStatus == http.StatusOK {
+				assert.Equal(t, archive, got)
+			} else {
+				assert.Empty(t, got)
+			}
+		})
+	}
+}
+
+func TestErrorEncoder(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+	}{
+		{err: ErrInvalidRequestUrl, wantStatus: http.StatusUnprocessableEntity},
+		{err: ErrCannotDownloadFile, wantStatus: http.StatusBadGateway},
+		{err: ErrInvalidArchive, wantStatus: http.StatusBadGateway},
+		{err: core.ErrObjectNotFound, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ErrorEncoder(context.Background(), fmt.Errorf("wrapped: %w", tt.err), rec)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+func TestMakeHandler_downloadHeaders(t *testing.T) {
+	archive := testZip(t, "")
+
+	tests := []struct {
+		name                   string
+		fileName               string
+		wantContentType        string
+		wantContentDisposition string
+	}{
+		{
+			name:                   "provider archive",
+			fileName:               "terraform-provider-random_2.0.0_linux_amd64.zip",
+			wantContentType:        "application/zip",
+			wantContentDisposition: `attachment;filename="terraform-provider-random_2.0.0_linux_amd64.zip"`,
+		},
+		{
+			name:                   "module archive",
+			fileName:               "acme-vpc-aws-1.0.0.tar.gz",
+			wantContentType:        "application/gzip",
+			wantContentDisposition: `attachment;filename="acme-vpc-aws-1.0.0.tar.gz"`,
+		},
+		{
+			name:                   "checksums",
+			fileName:               "terraform-provider-random_2.0.0_SHA256SUMS",
+			wantContentType:        "text/plain; charset=utf-8",
+			wantContentDisposition: `attachment;filename="terraform-provider-random_2.0.0_SHA256SUMS"`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// S3 uses this content type for objects that were uploaded without one
+				w.Header().Set("Content-Type", "binary/octet-stream")
+				w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+				_, _ = w.Write(archive)
+			}))
+			defer upstream.Close()
+
+			storage := &mockedStorage{url: upstream.URL + "/hashicorp/random/" + tc.fileName}
+			server := httptest.NewServer(MakeHandler(storage, testMetrics(), noopInstrumentation{}, false, httptransport.ServerErrorEncoder(ErrorEncoder)))
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + "/" + tc.fileName)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tc.wantContentType, resp.Header.Get("Content-Type"))
+			assert.Equal(t, tc.wantContentDisposition, resp.Header.Get("Content-Disposition"))
+			assert.Equal(t, strconv.Itoa(len(archive)), resp.Header.Get("Content-Length"))
+		})
+	}
+}
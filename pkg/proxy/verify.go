@@ -0,0 +1,255 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// zipEOCDLength is the length of the end of central directory record without the trailing comment
+	zipEOCDLength = 22
+	// zipMaxCommentLength is the maximum length of the comment that follows the end of central directory record
+	zipMaxCommentLength = 0xFFFF
+
+	zipEOCDSignature = 0x06054b50
+	// zip64LocatorLength is the length of the zip64 end of central directory locator preceding the EOCD record
+	zip64LocatorLength    = 20
+	zip64LocatorSignature = 0x07064b50
+
+	// gzipFooterLength is the length of the CRC-32 and size trailing every gzip member
+	gzipFooterLength = 8
+
+	verifyBufferSize = 32 * 1024
+)
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	zipEmptyMagic = []byte("PK\x05\x06")
+	gzipMagic     = []byte{0x1f, 0x8b}
+)
+
+// archiveValidator consumes the complete archive and reports whether it's intact once the stream ended
+type archiveValidator interface {
+	io.Writer
+	finish() error
+	abort()
+}
+
+// newArchiveValidator returns the validator for the archive format, which is derived from the file name.
+// It returns nil for files that aren't validated.
+func newArchiveValidator(fileName string) (validator archiveValidator, magic [][]byte, holdback int) {
+	switch {
+	case strings.HasSuffix(fileName, ".zip"):
+		return &zipValidator{}, [][]byte{zipMagic, zipEmptyMagic}, zipEOCDLength + zipMaxCommentLength
+	case strings.HasSuffix(fileName, ".tar.gz"), strings.HasSuffix(fileName, ".tgz"):
+		return newGzipValidator(), [][]byte{gzipMagic}, gzipFooterLength
+	default:
+		return nil, nil, 0
+	}
+}
+
+// verifyingReader passes the archive through, while teeing it into a validator.
+// The last holdback bytes are withheld until the archive has been validated completely,
+// so that a client never receives all bytes of a corrupted archive.
+type verifyingReader struct {
+	src       io.Reader
+	closer    io.Closer
+	validator archiveValidator
+	holdback  int
+
+	buf      []byte
+	pending  []byte
+	eof      bool
+	verified bool
+	err      error
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	for {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		// Bytes beyond the holdback can be released before the archive is validated
+		if releasable := len(r.pending) - r.holdback; releasable > 0 || (r.verified && len(r.pending) > 0) {
+			if r.verified {
+				releasable = len(r.pending)
+			}
+			n := copy(p, r.pending[:min(releasable, len(p))])
+			r.pending = r.pending[n:]
+			return n, nil
+		}
+
+		if r.verified {
+			return 0, io.EOF
+		}
+
+		if r.eof {
+			if err := r.validator.finish(); err != nil {
+				r.err = fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+				return 0, r.err
+			}
+			r.verified = true
+			continue
+		}
+
+		n, err := r.src.Read(r.buf)
+		if n > 0 {
+			r.pending = append(r.pending, r.buf[:n]...)
+			if _, werr := r.validator.Write(r.buf[:n]); werr != nil {
+				r.err = fmt.Errorf("%w: %v", ErrInvalidArchive, werr)
+				return 0, r.err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			r.eof = true
+		} else if err != nil {
+			r.err = err
+			r.validator.abort()
+			return 0, err
+		}
+	}
+}
+
+func (r *verifyingReader) Close() error {
+	if !r.verified {
+		r.validator.abort()
+	}
+	return r.closer.Close()
+}
+
+// newVerifyingReader checks the magic bytes of the archive and returns a reader that validates the archive while it's streamed.
+// The magic bytes are checked before anything is sent to the client, so that a wrong file can still be rejected with an error status.
+func newVerifyingReader(body io.ReadCloser, fileName string) (io.ReadCloser, error) {
+	validator, magic, holdback := newArchiveValidator(fileName)
+	if validator == nil {
+		return body, nil
+	}
+
+	br := bufio.NewReader(body)
+	if !hasMagic(br, magic) {
+		validator.abort()
+		return nil, fmt.Errorf("%w: %s has an unexpected file signature", ErrInvalidArchive, fileName)
+	}
+
+	return &verifyingReader{
+		src:       br,
+		closer:    body,
+		validator: validator,
+		holdback:  holdback,
+		buf:       make([]byte, verifyBufferSize),
+	}, nil
+}
+
+func hasMagic(br *bufio.Reader, magic [][]byte) bool {
+	for _, m := range magic {
+		if b, err := br.Peek(len(m)); err == nil && bytes.Equal(b, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// zipValidator checks that the end of central directory record is present and consistent with the size of the archive.
+// Only the trailing bytes that can contain the record are retained.
+type zipValidator struct {
+	size int64
+	tail []byte
+}
+
+func (v *zipValidator) Write(p []byte) (int, error) {
+	v.size += int64(len(p))
+	v.tail = append(v.tail, p...)
+	if excess := len(v.tail) - (zipEOCDLength + zipMaxCommentLength); excess > 0 {
+		v.tail = v.tail[:copy(v.tail, v.tail[excess:])]
+	}
+	return len(p), nil
+}
+
+func (v *zipValidator) finish() error {
+	// The record is searched backwards, as it's followed by a comment of variable length
+	for i := len(v.tail) - zipEOCDLength; i >= 0; i-- {
+		record := v.tail[i:]
+		if binary.LittleEndian.Uint32(record) != zipEOCDSignature {
+			continue
+		}
+		commentLength := int(binary.LittleEndian.Uint16(record[20:]))
+		if zipEOCDLength+commentLength != len(record) {
+			continue
+		}
+
+		recordOffset := v.size - int64(len(record))
+		directorySize := int64(binary.LittleEndian.Uint32(record[12:]))
+		directoryOffset := int64(binary.LittleEndian.Uint32(record[16:]))
+
+		// The actual values are stored in the zip64 end of central directory record
+		if directorySize == 0xFFFFFFFF || directoryOffset == 0xFFFFFFFF {
+			if i >= zip64LocatorLength && binary.LittleEndian.Uint32(v.tail[i-zip64LocatorLength:]) == zip64LocatorSignature {
+				return nil
+			}
+			return errors.New("zip64 end of central directory locator is missing")
+		}
+
+		if directoryOffset+directorySize != recordOffset {
+			return errors.New("central directory doesn't match the size of the archive")
+		}
+		return nil
+	}
+
+	return errors.New("end of central directory record is missing")
+}
+
+func (v *zipValidator) abort() {}
+
+// gzipValidator decompresses the stream to verify the checksum and size in the footer of every gzip member
+type gzipValidator struct {
+	pw     *io.PipeWriter
+	result chan error
+}
+
+func newGzipValidator() *gzipValidator {
+	pr, pw := io.Pipe()
+	v := &gzipValidator{
+		pw:     pw,
+		result: make(chan error, 1),
+	}
+
+	go func() {
+		err := decompress(pr)
+		// Keep consuming the stream, so that Write doesn't block after the validation failed
+		_, _ = io.Copy(io.Discard, pr)
+		v.result <- err
+	}()
+
+	return v
+}
+
+func decompress(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	_, err = io.Copy(io.Discard, gz)
+	return err
+}
+
+func (v *gzipValidator) Write(p []byte) (int, error) {
+	return v.pw.Write(p)
+}
+
+func (v *gzipValidator) finish() error {
+	_ = v.pw.Close()
+	return <-v.result
+}
+
+func (v *gzipValidator) abort() {
+	_ = v.pw.CloseWithError(io.ErrClosedPipe)
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testZip(t *testing.T, comment string) []byte {
+	t.Helper()
+	content := make([]byte, 256*1024)
+	_, _ = rand.Read(content)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.CreateHeader(&zip.FileHeader{Name: "terraform-provider-dummy", Method: zip.Store})
+	require.NoError(t, err)
+	_, err = f.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.SetComment(comment))
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func testTarGz(t *testing.T) []byte {
+	t.Helper()
+	content := make([]byte, 256*1024)
+	_, _ = rand.Read(content)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "main.tf", Mode: 0o600, Size: int64(len(content))}))
+	_, err := tw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func corrupt(b []byte) []byte {
+	c := bytes.Clone(b)
+	c[len(c)/2] ^= 0xFF
+	return c
+}
+
+func TestVerifyingReader(t *testing.T) {
+	validZip := testZip(t, "")
+	commentedZip := testZip(t, "signed by the release pipeline")
+	validTarGz := testTarGz(t)
+
+	tests := []struct {
+		name          string
+		fileName      string
+		data          []byte
+		wantSignature bool
+		wantErr       bool
+	}{
+		{name: "valid zip", fileName: "provider.zip", data: validZip},
+		{name: "valid zip with comment", fileName: "provider.zip", data: commentedZip},
+		{name: "zip without end of central directory", fileName: "provider.zip", data: validZip[:len(validZip)-10], wantErr: true},
+		{name: "zip truncated in the middle", fileName: "provider.zip", data: validZip[:len(validZip)/2], wantErr: true},
+		{name: "zip with appended bytes", fileName: "provider.zip", data: append(bytes.Clone(validZip), []byte("garbage")...), wantErr: true},
+		{name: "not a zip", fileName: "provider.zip", data: validTarGz, wantSignature: true},
+		{name: "empty zip", fileName: "provider.zip", data: []byte{}, wantSignature: true},
+		{name: "valid tar.gz", fileName: "module.tar.gz", data: validTarGz},
+		{name: "valid tgz", fileName: "module.tgz", data: validTarGz},
+		{name: "tar.gz without footer", fileName: "module.tar.gz", data: validTarGz[:len(validTarGz)-4], wantErr: true},
+		{name: "corrupted tar.gz", fileName: "module.tar.gz", data: corrupt(validTarGz), wantErr: true},
+		{name: "not a tar.gz", fileName: "module.tar.gz", data: validZip, wantSignature: true},
+		{name: "unknown format is passed through", fileName: "SHA256SUMS", data: []byte("not an archive")},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newVerifyingReader(io.NopCloser(bytes.NewReader(tc.data)), tc.fileName)
+			if tc.wantSignature {
+				assert.ErrorIs(t, err, ErrInvalidArchive)
+				return
+			}
+			require.NoError(t, err)
+			defer r.Close()
+
+			got, err := io.ReadAll(r)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidArchive)
+				// The client must never receive all bytes of a corrupted archive
+				assert.Less(t, len(got), len(tc.data))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.data, got)
+		})
+	}
+}
+
+type mockedStorage struct {
+	url string
+}
+
+func (m *mockedStorage) GetDownloadUrl(_ context.Context, _ string) (string, error) {
+	return m.url, nil
+}
+
+type noopInstrumentation struct{}
+
+func (noopInstrumentation) WrapHandler(handler http.Handler) http.HandlerFunc {
+	return handler.ServeHTTP
+}
+
+func testMetrics() *o11y.ProxyMetrics {
+	return &o11y.ProxyMetrics{
+		Download: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "download"}, []string{}),
+		Failure:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "failure"}, []string{o11y.ProxyFailureLabel}),
+		InFlight: prometheus.NewGauge(prometheus.GaugeOpts{Name: "in_flight"}),
+	}
+}
+
+func TestMakeHandler_verify(t *testing.T) {
+	validZip := testZip(t, "")
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantStatus int
+		wantErr    bool
+	}{
+		{name: "valid zip", data: validZip, wantStatus: http.StatusOK},
+		{name: "truncated zip", data: validZip[:len(validZip)-10], wantStatus: http.StatusOK, wantErr: true},
+		{name: "not a zip", data: []byte("<html>Access denied</html>"), wantStatus: http.StatusBadGateway},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", strconv.Itoa(len(tc.data)))
+				_, _ = w.Write(tc.data)
+			}))
+			defer upstream.Close()
+
+			storage := &mockedStorage{url: upstream.URL + "/hashicorp/dummy/terraform-provider-dummy_1.0.0_linux_amd64.zip"}
+			server := httptest.NewServer(MakeHandler(storage, testMetrics(), noopInstrumentation{}, true, httptransport.ServerErrorEncoder(ErrorEncoder)))
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + "/archive")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+
+			got, err := io.ReadAll(resp.Body)
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Less(t, len(got), len(tc.data))
+				return
+			}
+			assert.NoError(t, err)
+			if tc.wantStatus == http.StatusOK {
+				assert.Equal(t, tc.data, got)
+			}
+		})
+	}
+}
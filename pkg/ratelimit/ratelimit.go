@@ -0,0 +1,276 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/audit"
+	"github.com/boring-registry/boring-registry/pkg/core"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+
+	"github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// sweepInterval is the interval in which idle buckets are removed
+const sweepInterval = time.Minute
+
+// Error is returned for requests that exceeded the rate limit
+type Error struct {
+	// RetryAfter is the time until the bucket holds a token again
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: retry after %s", core.ErrTooManyRequests, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *Error) Unwrap() error {
+	return core.ErrTooManyRequests
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter maintains a token bucket per client.
+// Authenticated clients are identified by their subject or their static token, all other clients by their IP address.
+type Limiter struct {
+	rps            rate.Limit
+	burst          int
+	metrics        *o11y.RateLimitMetrics
+	trustedProxies []netip.Prefix
+	now            func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// Option configures a Limiter
+type Option func(*Limiter)
+
+// WithTrustedProxies honours the X-Forwarded-For header of requests that are sent by one of the proxies, e.g. the load balancer in front of the registry.
+// The header is ignored for requests of all other addresses, as clients could otherwise choose their own bucket.
+func WithTrustedProxies(proxies []netip.Prefix) Option {
+	return func(l *Limiter) {
+		l.trustedProxies = proxies
+	}
+}
+
+// ParseTrustedProxies parses the IP addresses and CIDR ranges of trusted proxies
+func ParseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, p := range proxies {
+		if addr, err := netip.ParseAddr(p); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, expected an IP address or CIDR range", p)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// NewLimiter returns a Limiter that allows rps requests per second per client, with bursts of up to burst requests
+func NewLimiter(rps float64, burst int, metrics *o11y.RateLimitMetrics, opts ...Option) *Limiter {
+	l := &Limiter{
+		rps:     rate.Limit(rps),
+		burst:   max(burst, 1),
+		metrics: metrics,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Middleware rejects requests of clients that exhausted their bucket.
+// It has to be chained after the auth.Middleware, which puts the verified user into the context.
+// A Limiter without a positive rps doesn't limit any requests.
+func (l *Limiter) Middleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		if l.rps <= 0 {
+			return next
+		}
+
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			key, keyType := l.clientKey(ctx)
+			if delay := l.reserve(key); delay > 0 {
+				l.metrics.Throttled.With(prometheus.Labels{o11y.RateLimitKeyLabel: keyType}).Inc()
+				return nil, &Error{RetryAfter: delay}
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// AuthFailureMiddleware rejects the requests of IP addresses that exhausted their bucket with failed authentications,
+// so that tokens can't be guessed at an unlimited rate. Only failed authentications take a token from the bucket.
+// It has to be chained before the auth.Middleware, as requests with invalid tokens never reach the Middleware.
+func (l *Limiter) AuthFailureMiddleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		if l.rps <= 0 {
+			return next
+		}
+
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			key := "auth-failure:ip:" + l.sourceIP(ctx)
+			if delay := l.delay(key); delay > 0 {
+				l.metrics.Throttled.With(prometheus.Labels{o11y.RateLimitKeyLabel: o11y.RateLimitKeyAuthFailure}).Inc()
+				return nil, &Error{RetryAfter: delay}
+			}
+
+			response, err := next(ctx, request)
+			if errors.Is(err, core.ErrUnauthorized) || errors.Is(err, core.ErrInvalidToken) {
+				l.reserve(key)
+			}
+			return response, err
+		}
+	}
+}
+
+// delay returns the time until the bucket of the key holds a token again, without taking one
+func (l *Limiter) delay(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+	if tokens := b.limiter.TokensAt(l.now()); tokens < 1 {
+		return time.Duration((1 - tokens) / float64(l.rps) * float64(time.Second))
+	}
+	return 0
+}
+
+// reserve takes a token from the bucket of the key.
+// It returns the time until a token is available if the bucket is empty, and zero otherwise.
+func (l *Limiter) reserve(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	r := b.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		// The request is rejected, so the token must not be consumed
+		r.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// sweep removes the buckets that have been idle long enough to be refilled completely,
+// as a new bucket behaves identically. It must be called with the mutex held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	refill := time.Duration(float64(l.burst) / float64(l.rps) * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientKey returns the key of the bucket of the request and the type of the key for the metrics
+func (l *Limiter) clientKey(ctx context.Context) (key string, keyType string) {
+	if user := audit.GetUserFromContext(ctx); user != nil && user.Subject != "" {
+		return "subject:" + user.Provider + ":" + user.Subject, o11y.RateLimitKeySubject
+	}
+
+	// Static tokens don't carry a subject, the hash prevents keeping the plain tokens in memory
+	if token, ok := ctx.Value(jwt.JWTContextKey).(string); ok && token != "" {
+		sum := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(sum[:]), o11y.RateLimitKeyToken
+	}
+
+	return "ip:" + l.sourceIP(ctx), o11y.RateLimitKeyIP
+}
+
+// sourceIP returns the IP address of the client from the context populated by httptransport.PopulateRequestContext.
+// X-Forwarded-For is only honoured if the connection is from a trusted proxy. Its addresses are walked from the right,
+// as every proxy appends the address it received the request from, and the first address that isn't a trusted proxy is the client.
+func (l *Limiter) sourceIP(ctx context.Context) string {
+	remoteAddr, _ := ctx.Value(httptransport.ContextKeyRequestRemoteAddr).(string)
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+	if !l.trusted(ip) {
+		return ip
+	}
+
+	xff, _ := ctx.Value(httptransport.ContextKeyRequestXForwardedFor).(string)
+	addresses := strings.Split(xff, ",")
+	for i := len(addresses) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(addresses[i])
+		if address == "" {
+			continue
+		}
+		ip = address
+		if !l.trusted(address) {
+			break
+		}
+	}
+	return ip
+}
+
+// trusted reports whether the IP address belongs to one of the trusted proxies
+func (l *Limiter) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range l.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorEncoder wraps the ErrorEncoder of a transport to set the Retry-After header on throttled requests
+func ErrorEncoder(next httptransport.ErrorEncoder) httptransport.ErrorEncoder {
+	return func(ctx context.Context, err error, w http.ResponseWriter) {
+		var rateLimitErr *Error
+		if errors.As(err, &rateLimitErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(rateLimitErr.RetryAfter.Seconds())))))
+		}
+		next(ctx, err, w)
+	}
+}
@@ -0,0 +1,244 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/audit"
+	"github.com/boring-registry/boring-registry/pkg/core"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+
+	"github.com/go-kit/kit/auth/jwt"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMetrics() *o11y.RateLimitMetrics {
+	return &o11y.RateLimitMetrics{
+		Throttled: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "throttled"}, []string{o11y.RateLimitKeyLabel}),
+	}
+}
+
+func noopEndpoint(context.Context, interface{}) (interface{}, error) {
+	return struct{}{}, nil
+}
+
+func withSubject(subject string) context.Context {
+	return audit.ContextWithUser(context.Background(), &audit.User{Provider: "oidc", Subject: subject})
+}
+
+func forwarded(remoteAddr, xff string) context.Context {
+	ctx := context.WithValue(context.Background(), httptransport.ContextKeyRequestRemoteAddr, remoteAddr)
+	return context.WithValue(ctx, httptransport.ContextKeyRequestXForwardedFor, xff)
+}
+
+func TestLimiter_keys(t *testing.T) {
+	tests := []struct {
+		name        string
+		first       context.Context
+		second      context.Context
+		wantShared  bool
+		wantKeyType string
+	}{
+		{
+			name:        "same subject",
+			first:       withSubject("ci-pipeline"),
+			second:      withSubject("ci-pipeline"),
+			wantShared:  true,
+			wantKeyType: o11y.RateLimitKeySubject,
+		},
+		{
+			name:        "different subjects",
+			first:       withSubject("ci-pipeline"),
+			second:      withSubject("jane"),
+			wantKeyType: o11y.RateLimitKeySubject,
+		},
+		{
+			name:        "same static token",
+			first:       context.WithValue(audit.ContextWithUser(context.Background(), &audit.User{Provider: "static"}), jwt.JWTContextKey, "secret"),
+			second:      context.WithValue(audit.ContextWithUser(context.Background(), &audit.User{Provider: "static"}), jwt.JWTContextKey, "secret"),
+			wantShared:  true,
+			wantKeyType: o11y.RateLimitKeyToken,
+		},
+		{
+			name:        "different static tokens",
+			first:       context.WithValue(context.Background(), jwt.JWTContextKey, "secret"),
+			second:      context.WithValue(context.Background(), jwt.JWTContextKey, "other-secret"),
+			wantKeyType: o11y.RateLimitKeyToken,
+		},
+		{
+			name:        "same remote address",
+			first:       context.WithValue(context.Background(), httptransport.ContextKeyRequestRemoteAddr, "10.0.0.1:51234"),
+			second:      context.WithValue(context.Background(), httptransport.ContextKeyRequestRemoteAddr, "10.0.0.1:40000"),
+			wantShared:  true,
+			wantKeyType: o11y.RateLimitKeyIP,
+		},
+		{
+			name:        "forwarded addresses of different clients",
+			first:       forwarded("10.0.0.1:51234", "192.0.2.1, 198.51.100.1"),
+			second:      forwarded("10.0.0.1:51234", "192.0.2.1, 198.51.100.2"),
+			wantKeyType: o11y.RateLimitKeyIP,
+		},
+		{
+			name:        "forwarded by multiple trusted proxies",
+			first:       forwarded("10.0.0.1:51234", "198.51.100.1, 10.0.0.2"),
+			second:      forwarded("10.0.0.3:51234", "198.51.100.1, 10.0.0.4"),
+			wantShared:  true,
+			wantKeyType: o11y.RateLimitKeyIP,
+		},
+		{
+			name:        "spoofed address of an untrusted client",
+			first:       forwarded("192.0.2.10:51234", "198.51.100.1"),
+			second:      forwarded("192.0.2.10:51234", "198.51.100.2"),
+			wantShared:  true,
+			wantKeyType: o11y.RateLimitKeyIP,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := testMetrics()
+			trustedProxies, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+			require.NoError(t, err)
+			limiter := NewLimiter(1, 1, metrics, WithTrustedProxies(trustedProxies))
+			now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+			limiter.now = func() time.Time { return now }
+			e := limiter.Middleware()(noopEndpoint)
+
+			_, err = e(tc.first, nil)
+			require.NoError(t, err)
+
+			_, err = e(tc.second, nil)
+			if !tc.wantShared {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, core.ErrTooManyRequests)
+			assert.Equal(t, 1.0, testutil.ToFloat64(metrics.Throttled.WithLabelValues(tc.wantKeyType)))
+
+			// The bucket is refilled after a second
+			now = now.Add(time.Second)
+			_, err = e(tc.second, nil)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestLimiter_burst(t *testing.T) {
+	limiter := NewLimiter(2, 5, testMetrics())
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	e := limiter.Middleware()(noopEndpoint)
+	ctx := withSubject("ci-pipeline")
+
+	for i := 0; i < 5; i++ {
+		_, err := e(ctx, nil)
+		require.NoError(t, err, "request %d", i)
+	}
+
+	_, err := e(ctx, nil)
+	var rateLimitErr *Error
+	require.ErrorAs(t, err, &rateLimitErr)
+	assert.Equal(t, 500*time.Millisecond, rateLimitErr.RetryAfter)
+
+	// Rejected requests don't consume tokens
+	now = now.Add(500 * time.Millisecond)
+	_, err = e(ctx, nil)
+	assert.NoError(t, err)
+}
+
+func TestLimiter_AuthFailureMiddleware(t *testing.T) {
+	metrics := testMetrics()
+	limiter := NewLimiter(1, 2, metrics)
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	valid := true
+	e := limiter.AuthFailureMiddleware()(func(context.Context, interface{}) (interface{}, error) {
+		if !valid {
+			return nil, core.ErrInvalidToken
+		}
+		return struct{}{}, nil
+	})
+	ctx := context.WithValue(context.Background(), httptransport.ContextKeyRequestRemoteAddr, "192.0.2.1:51234")
+
+	// Successful authentications don't take tokens
+	for i := 0; i < 5; i++ {
+		_, err := e(ctx, nil)
+		require.NoError(t, err)
+	}
+
+	valid = false
+	for i := 0; i < 2; i++ {
+		_, err := e(ctx, nil)
+		require.ErrorIs(t, err, core.ErrInvalidToken)
+	}
+
+	// The IP address is rejected after the burst of failed authentications, even with a valid token
+	valid = true
+	_, err := e(ctx, nil)
+	var rateLimitErr *Error
+	require.ErrorAs(t, err, &rateLimitErr)
+	assert.Equal(t, time.Second, rateLimitErr.RetryAfter)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.Throttled.WithLabelValues(o11y.RateLimitKeyAuthFailure)))
+
+	now = now.Add(time.Second)
+	_, err = e(ctx, nil)
+	assert.NoError(t, err)
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.1", "172.16.0.0/12", "2001:db8::/32"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1/32", "172.16.0.0/12", "2001:db8::/32"}, []string{proxies[0].String(), proxies[1].String(), proxies[2].String()})
+
+	_, err = ParseTrustedProxies([]string{"load-balancer"})
+	assert.Error(t, err)
+}
+
+func TestLimiter_sweep(t *testing.T) {
+	limiter := NewLimiter(1, 10, testMetrics())
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	e := limiter.Middleware()(noopEndpoint)
+
+	_, _ = e(withSubject("jane"), nil)
+	now = now.Add(sweepInterval)
+	_, _ = e(withSubject("ci-pipeline"), nil)
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestErrorEncoder(t *testing.T) {
+	limiter := NewLimiter(0.1, 1, testMetrics())
+	handler := httptransport.NewServer(
+		limiter.Middleware()(noopEndpoint),
+		func(context.Context, *http.Request) (interface{}, error) { return nil, nil },
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+		httptransport.ServerErrorEncoder(ErrorEncoder(func(_ context.Context, err error, w http.ResponseWriter) {
+			core.EncodeError(err, w)
+		})),
+	)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Retry-After"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+
+	var body struct {
+		Errors []string `json:"errors"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Len(t, body.Errors, 1)
+}
@@ -0,0 +1,117 @@
+package requestid
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Header is the header that carries the request ID of requests and responses
+	Header = "X-Request-ID"
+
+	// correlationHeader is accepted as an alternative to the Header, as some proxies only set this one
+	correlationHeader = "X-Correlation-ID"
+
+	// maxLength is the maximum length of an inbound request ID, longer IDs are replaced
+	maxLength = 128
+
+	// LogKey is the key of the request ID in the log records
+	LogKey = "request_id"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries the request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID of the request, or an empty string outside of requests
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Middleware passes the request ID to the handler in the context and echoes it in the Header of the response.
+// The request ID is taken from the X-Request-ID or X-Correlation-ID header of the request, a UUID is generated if neither is set.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if id == "" {
+			id = r.Header.Get(correlationHeader)
+		}
+		if !valid(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// valid rejects empty and overly long IDs, as well as IDs with characters that would break the headers or logs
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// logHandler adds the request ID of the context to the log records.
+// The request ID is kept at the top level of the records, even if the logger has groups.
+type logHandler struct {
+	slog.Handler
+
+	// base is the handler before the first group, grouped replays the groups and attributes that follow it
+	base    slog.Handler
+	grouped []func(slog.Handler) slog.Handler
+}
+
+// NewLogHandler wraps the handler to add the request ID to records that are logged with a context, e.g. with slog.InfoContext
+func NewLogHandler(h slog.Handler) slog.Handler {
+	return &logHandler{Handler: h, base: h}
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	id := FromContext(ctx)
+	if id == "" {
+		return h.Handler.Handle(ctx, r)
+	}
+	if len(h.grouped) == 0 {
+		r.AddAttrs(slog.String(LogKey, id))
+		return h.Handler.Handle(ctx, r)
+	}
+
+	// Attributes of the record would end up in the innermost group, so the request ID is added before the groups
+	next := h.base.WithAttrs([]slog.Attr{slog.String(LogKey, id)})
+	for _, apply := range h.grouped {
+		next = apply(next)
+	}
+	return next.Handle(ctx, r)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(h.grouped) == 0 {
+		next := h.Handler.WithAttrs(attrs)
+		return &logHandler{Handler: next, base: next}
+	}
+	return h.extend(h.Handler.WithAttrs(attrs), func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return h.extend(h.Handler.WithGroup(name), func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *logHandler) extend(next slog.Handler, apply func(slog.Handler) slog.Handler) *logHandler {
+	grouped := make([]func(slog.Handler) slog.Handler, len(h.grouped), len(h.grouped)+1)
+	copy(grouped, h.grouped)
+	return &logHandler{Handler: next, base: h.base, grouped: append(grouped, apply)}
+}
@@ -0,0 +1,112 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name:    "inbound request ID",
+			headers: map[string]string{Header: "abc-123"},
+			want:    "abc-123",
+		},
+		{
+			name:    "inbound correlation ID",
+			headers: map[string]string{correlationHeader: "corr-456"},
+			want:    "corr-456",
+		},
+		{
+			name:    "request ID takes precedence",
+			headers: map[string]string{Header: "abc-123", correlationHeader: "corr-456"},
+			want:    "abc-123",
+		},
+		{
+			name: "missing request ID",
+		},
+		{
+			name:    "request ID with whitespace",
+			headers: map[string]string{Header: "abc 123"},
+		},
+		{
+			name:    "too long request ID",
+			headers: map[string]string{Header: strings.Repeat("a", maxLength+1)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var fromContext string
+			handler := Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				fromContext = FromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/providers/hashicorp/random/versions", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(Header)
+			assert.Equal(t, got, fromContext)
+			if tc.want != "" {
+				assert.Equal(t, tc.want, got)
+				return
+			}
+			_, err := uuid.Parse(got)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(&buf, nil))).With(slog.String("component", "test"))
+
+	logger.InfoContext(NewContext(context.Background(), "abc-123"), "with request ID")
+	logger.InfoContext(context.Background(), "without request ID")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(lines[0], &record))
+	assert.Equal(t, "abc-123", record[LogKey])
+	assert.Equal(t, "test", record["component"])
+
+	record = nil
+	require.NoError(t, json.Unmarshal(lines[1], &record))
+	assert.NotContains(t, record, LogKey)
+}
+
+func TestLogHandler_WithGroup(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(&buf, nil))).
+		With(slog.String("component", "test")).
+		WithGroup("storage").
+		With(slog.String("backend", "s3"))
+
+	logger.InfoContext(NewContext(context.Background(), "abc-123"), "grouped", slog.String("key", "modules/a"))
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &record))
+	assert.Equal(t, "abc-123", record[LogKey])
+	assert.Equal(t, "test", record["component"])
+	assert.Equal(t, map[string]any{"backend": "s3", "key": "modules/a"}, record["storage"])
+}
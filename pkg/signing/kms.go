@@ -0,0 +1,20 @@
+package signing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// NewKeyManagementService returns the KeyManagementService matching the format of the given key reference.
+// AWS KMS keys are referenced by their ARN or alias, Google Cloud KMS keys by the resource name of the key version.
+func NewKeyManagementService(ctx context.Context, key string) (KeyManagementService, error) {
+	switch {
+	case strings.HasPrefix(key, "arn:aws:kms:"), strings.HasPrefix(key, "alias/"):
+		return NewAWSKMS(ctx, key)
+	case strings.HasPrefix(key, "projects/") && strings.Contains(key, "/cryptoKeyVersions/"):
+		return NewGCPKMS(ctx, key)
+	default:
+		return nil, fmt.Errorf("unsupported KMS key reference %s", key)
+	}
+}
@@ -0,0 +1,71 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+type awsKMSClientAPI interface {
+	GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+	Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+}
+
+// AWSKMS is a KeyManagementService backed by an asymmetric AWS KMS key
+type AWSKMS struct {
+	client awsKMSClientAPI
+	keyID  string
+}
+
+func (k *AWSKMS) PublicKey(ctx context.Context) (crypto.PublicKey, error) {
+	out, err := k.client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(k.keyID)})
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKIXPublicKey(out.PublicKey)
+}
+
+func (k *AWSKMS) Sign(ctx context.Context, digest []byte, hash crypto.Hash) ([]byte, error) {
+	var algorithm types.SigningAlgorithmSpec
+	switch hash {
+	case crypto.SHA256:
+		algorithm = types.SigningAlgorithmSpecRsassaPkcs1V15Sha256
+	case crypto.SHA384:
+		algorithm = types.SigningAlgorithmSpecRsassaPkcs1V15Sha384
+	case crypto.SHA512:
+		algorithm = types.SigningAlgorithmSpecRsassaPkcs1V15Sha512
+	default:
+		return nil, fmt.Errorf("unsupported hash function %s", hash)
+	}
+
+	out, err := k.client.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(k.keyID),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: algorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Signature, nil
+}
+
+// NewAWSKMS returns a KeyManagementService for the AWS KMS key with the given ID, ARN or alias.
+// The credentials are resolved from the default AWS configuration chain.
+func NewAWSKMS(ctx context.Context, keyID string) (*AWSKMS, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return &AWSKMS{
+		client: kms.NewFromConfig(cfg),
+		keyID:  keyID,
+	}, nil
+}
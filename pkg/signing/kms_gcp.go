@@ -0,0 +1,70 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// GCPKMS is a KeyManagementService backed by an asymmetric Google Cloud KMS key version
+type GCPKMS struct {
+	service *cloudkms.Service
+
+	// name is the resource name of the key version in the format
+	// projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*
+	name string
+}
+
+func (k *GCPKMS) PublicKey(ctx context.Context) (crypto.PublicKey, error) {
+	out, err := k.service.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.GetPublicKey(k.name).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(out.Pem))
+	if block == nil {
+		return nil, errors.New("failed to decode PEM public key")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func (k *GCPKMS) Sign(ctx context.Context, digest []byte, hash crypto.Hash) ([]byte, error) {
+	encoded := base64.StdEncoding.EncodeToString(digest)
+	d := &cloudkms.Digest{}
+	switch hash {
+	case crypto.SHA256:
+		d.Sha256 = encoded
+	case crypto.SHA384:
+		d.Sha384 = encoded
+	case crypto.SHA512:
+		d.Sha512 = encoded
+	default:
+		return nil, fmt.Errorf("unsupported hash function %s", hash)
+	}
+
+	out, err := k.service.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.AsymmetricSign(k.name, &cloudkms.AsymmetricSignRequest{Digest: d}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out.Signature)
+}
+
+// NewGCPKMS returns a KeyManagementService for the Google Cloud KMS key version with the given resource name.
+// The credentials are resolved through Application Default Credentials.
+func NewGCPKMS(ctx context.Context, name string) (*GCPKMS, error) {
+	service, err := cloudkms.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cloud KMS client: %w", err)
+	}
+
+	return &GCPKMS{
+		service: service,
+		name:    name,
+	}, nil
+}
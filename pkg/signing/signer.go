@@ -0,0 +1,184 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+const (
+	// keyIdentityName is the name of the OpenPGP user ID attached to KMS-backed keys
+	keyIdentityName = "boring-registry"
+
+	// keySource is used as the source of the published core.GPGPublicKey
+	keySource = "boring-registry KMS"
+)
+
+// keyCreationTime is the fixed creation time of the OpenPGP key wrapping a KMS key.
+// The creation time is part of the OpenPGP fingerprint, so it has to stay stable for the key ID to be reproducible.
+var keyCreationTime = time.Unix(0, 0)
+
+// Signer creates detached OpenPGP signatures for *_SHA256SUMS files
+type Signer interface {
+	// Sign returns a binary detached signature of the given message
+	Sign(ctx context.Context, message []byte) ([]byte, error)
+
+	// PublicKey returns the public key that can be used to verify the signatures created by Sign
+	PublicKey() core.GPGPublicKey
+}
+
+// KeyManagementService is a remote key that never leaves the key management service.
+// Only RSA keys with PKCS #1 v1.5 signatures are supported.
+type KeyManagementService interface {
+	// PublicKey returns the public part of the key
+	PublicKey(ctx context.Context) (crypto.PublicKey, error)
+
+	// Sign signs the digest, which was created with the given hash function
+	Sign(ctx context.Context, digest []byte, hash crypto.Hash) ([]byte, error)
+}
+
+type kmsSigner struct {
+	kms       KeyManagementService
+	rsaPub    *rsa.PublicKey
+	entity    *openpgp.Entity
+	publicKey core.GPGPublicKey
+}
+
+func (s *kmsSigner) Sign(ctx context.Context, message []byte) ([]byte, error) {
+	config := &packet.Config{DefaultHash: crypto.SHA256}
+	pub := s.entity.PrimaryKey
+	sig := &packet.Signature{
+		Version:           pub.Version,
+		SigType:           packet.SigTypeBinary,
+		PubKeyAlgo:        pub.PubKeyAlgo,
+		Hash:              config.Hash(),
+		CreationTime:      time.Now(),
+		IssuerKeyId:       &pub.KeyId,
+		IssuerFingerprint: pub.Fingerprint,
+	}
+
+	h, err := sig.PrepareSign(config)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := h.Write(message); err != nil {
+		return nil, err
+	}
+
+	priv, cs := newPrivateKey(ctx, s.kms, s.rsaPub)
+	if err := sig.Sign(h, priv, config); err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	} else if cs.err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", cs.err)
+	}
+
+	var buf bytes.Buffer
+	if err := sig.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *kmsSigner) PublicKey() core.GPGPublicKey {
+	return s.publicKey
+}
+
+// NewKMSSigner creates a Signer whose private key is held by the given KeyManagementService.
+// The OpenPGP public key is derived from the public part of the KMS key.
+func NewKMSSigner(ctx context.Context, kms KeyManagementService) (Signer, error) {
+	pub, err := kms.PublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve public key: %w", err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T, only RSA keys are supported", pub)
+	}
+
+	config := &packet.Config{DefaultHash: crypto.SHA256, Time: func() time.Time { return keyCreationTime }}
+	entity := &openpgp.Entity{
+		PrimaryKey: packet.NewRSAPublicKey(keyCreationTime, rsaPub),
+		Identities: make(map[string]*openpgp.Identity),
+	}
+	priv, cs := newPrivateKey(ctx, kms, rsaPub)
+	entity.PrivateKey = priv
+	if err := entity.AddUserId(keyIdentityName, "", "", config); err != nil {
+		return nil, fmt.Errorf("failed to self-sign public key: %w", err)
+	} else if cs.err != nil {
+		return nil, fmt.Errorf("failed to self-sign public key: %w", cs.err)
+	}
+
+	armored, err := armorPublicKey(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsSigner{
+		kms:    kms,
+		rsaPub: rsaPub,
+		entity: entity,
+		publicKey: core.GPGPublicKey{
+			KeyID:      fmt.Sprintf("%016X", entity.PrimaryKey.KeyId),
+			ASCIIArmor: armored,
+			Source:     keySource,
+		},
+	}, nil
+}
+
+func armorPublicKey(entity *openpgp.Entity) (string, error) {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := entity.Serialize(w); err != nil {
+		return "", fmt.Errorf("failed to serialize public key: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// newPrivateKey wraps the KeyManagementService into an OpenPGP private key.
+// The given context is used for all signing requests to the KMS.
+func newPrivateKey(ctx context.Context, kms KeyManagementService, pub *rsa.PublicKey) (*packet.PrivateKey, *cryptoSigner) {
+	cs := &cryptoSigner{
+		ctx: ctx,
+		kms: kms,
+		pub: pub,
+	}
+	return &packet.PrivateKey{
+		PublicKey:  *packet.NewRSAPublicKey(keyCreationTime, pub),
+		PrivateKey: cs,
+	}, cs
+}
+
+// cryptoSigner implements crypto.Signer by delegating to a KeyManagementService.
+// go-crypto discards errors returned by a crypto.Signer for RSA keys, so the last error is kept in err.
+type cryptoSigner struct {
+	ctx context.Context
+	kms KeyManagementService
+	pub crypto.PublicKey
+	err error
+}
+
+func (s *cryptoSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *cryptoSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	sig, err := s.kms.Sign(s.ctx, digest, opts.HashFunc())
+	s.err = err
+	return sig, err
+}
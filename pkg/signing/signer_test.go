@@ -0,0 +1,80 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockKMS struct {
+	key crypto.Signer
+}
+
+func (m *mockKMS) PublicKey(_ context.Context) (crypto.PublicKey, error) {
+	return m.key.Public(), nil
+}
+
+func (m *mockKMS) Sign(_ context.Context, digest []byte, hash crypto.Hash) ([]byte, error) {
+	return m.key.Sign(rand.Reader, digest, hash)
+}
+
+type failingKMS struct {
+	mockKMS
+}
+
+func (m *failingKMS) Sign(_ context.Context, _ []byte, _ crypto.Hash) ([]byte, error) {
+	return nil, errors.New("access denied")
+}
+
+func TestKMSSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums := []byte("0f0f0f0f  terraform-provider-dummy_0.1.0_linux_amd64.zip\n")
+
+	t.Run("signature verifies against published key", func(t *testing.T) {
+		kms := &mockKMS{key: key}
+		signer, err := NewKMSSigner(context.Background(), kms)
+		assert.NoError(t, err)
+
+		sig, err := signer.Sign(context.Background(), sums)
+		assert.NoError(t, err)
+
+		keys := &core.SigningKeys{GPGPublicKeys: []core.GPGPublicKey{signer.PublicKey()}}
+		assert.NoError(t, keys.IsValidSha256Sums(sums, sig))
+		assert.Error(t, keys.IsValidSha256Sums([]byte("tampered"), sig))
+		assert.Len(t, signer.PublicKey().KeyID, 16)
+	})
+
+	t.Run("public key is stable", func(t *testing.T) {
+		first, err := NewKMSSigner(context.Background(), &mockKMS{key: key})
+		assert.NoError(t, err)
+		second, err := NewKMSSigner(context.Background(), &mockKMS{key: key})
+		assert.NoError(t, err)
+		assert.Equal(t, first.PublicKey().KeyID, second.PublicKey().KeyID)
+	})
+
+	t.Run("unsupported key type", func(t *testing.T) {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewKMSSigner(context.Background(), &mockKMS{key: ecKey})
+		assert.ErrorContains(t, err, "only RSA keys are supported")
+	})
+
+	t.Run("KMS error is returned", func(t *testing.T) {
+		_, err := NewKMSSigner(context.Background(), &failingKMS{mockKMS{key: key}})
+		assert.ErrorContains(t, err, "access denied")
+	})
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/boring-registry/boring-registry/pkg/module"
+)
+
+// compareModuleArchive consumes the module archive that is about to be uploaded and compares its checksum to the stored archive.
+// Uploading identical content for an existing version succeeds, so that re-runs of a release pipeline don't fail.
+func compareModuleArchive(key string, body io.Reader, stored []byte) error {
+	storedSum := sha256.Sum256(stored)
+	return compareModuleChecksum(key, body, hex.EncodeToString(storedSum[:]))
+}
+
+// compareModuleChecksum is like compareModuleArchive, but compares to the hex-encoded checksum that was stored during the upload
+func compareModuleChecksum(key string, body io.Reader, checksum string) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return fmt.Errorf("%v: %w", module.ErrModuleUploadFailed, err)
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != checksum {
+		return fmt.Errorf("%w: %s", module.ErrModuleContentMismatch, key)
+	}
+	return nil
+}
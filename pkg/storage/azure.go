@@ -7,19 +7,25 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
 	"github.com/boring-registry/boring-registry/pkg/module"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // AzureStorage is a Storage implementation backed by Azure Blob Storage.
@@ -31,13 +37,19 @@ type AzureStorage struct {
 	prefix              string
 	moduleArchiveFormat string
 	signedURLExpiry     time.Duration
+	signedURLHeadroom   signedURLHeadroom
+	existsCache         *existenceCache
+	retry               retryConfig
+	signingKeysFallback string
+	pageSize            int
+	locks               uploadLocks
 }
 
 // GetModule retrieves information about a module from the Azure Storage.
 func (s *AzureStorage) GetModule(ctx context.Context, namespace, name, provider, version string) (core.Module, error) {
-	key := modulePath(s.prefix, namespace, name, provider, version, s.moduleArchiveFormat)
+	key := modulePath(scopedPrefix(ctx, s.prefix), namespace, name, provider, version, s.moduleArchiveFormat)
 
-	exists, err := s.objectExists(ctx, key)
+	checksum, exists, err := s.objectChecksum(ctx, key)
 	if err != nil {
 		return core.Module{}, err
 	} else if !exists {
@@ -55,15 +67,22 @@ func (s *AzureStorage) GetModule(ctx context.Context, namespace, name, provider,
 		Provider:    provider,
 		Version:     version,
 		DownloadURL: presigned,
+		Checksum:    checksum,
 	}, nil
 }
 
+// ModuleExists reports whether the archive of a module version exists
+func (s *AzureStorage) ModuleExists(ctx context.Context, namespace, name, provider, version string) (bool, error) {
+	return s.objectExists(ctx, modulePath(scopedPrefix(ctx, s.prefix), namespace, name, provider, version, s.moduleArchiveFormat))
+}
+
 func (s *AzureStorage) ListModuleVersions(ctx context.Context, namespace, name, provider string) ([]core.Module, error) {
-	prefix := modulePathPrefix(s.prefix, namespace, name, provider)
+	prefix := modulePathPrefix(scopedPrefix(ctx, s.prefix), namespace, name, provider)
 
 	var modules []core.Module
 	pager := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{
-		Prefix: &prefix,
+		Prefix:     &prefix,
+		MaxResults: s.listMaxResults(),
 	})
 	for pager.More() {
 		page, err := pager.NextPage(ctx)
@@ -108,15 +127,30 @@ func (s *AzureStorage) UploadModule(ctx context.Context, namespace, name, provid
 		return core.Module{}, errors.New("version not defined")
 	}
 
-	key := modulePath(s.prefix, namespace, name, provider, version, DefaultModuleArchiveFormat)
+	key := modulePath(scopedPrefix(ctx, s.prefix), namespace, name, provider, version, s.moduleArchiveFormat)
 
-	if _, err := s.GetModule(ctx, namespace, name, provider, version); err == nil {
-		return core.Module{}, fmt.Errorf("%w: %s", module.ErrModuleAlreadyExists, key)
+	if m, err := s.GetModule(ctx, namespace, name, provider, version); err == nil {
+		if m.Checksum != "" {
+			if err := compareModuleChecksum(key, body, m.Checksum); err != nil {
+				return core.Module{}, err
+			}
+			return m, nil
+		}
+		stored, err := s.download(ctx, key)
+		if err != nil {
+			return core.Module{}, err
+		}
+		if err := compareModuleArchive(key, body, stored); err != nil {
+			return core.Module{}, err
+		}
+		return m, nil
 	}
 
-	if _, err := s.client.UploadStream(ctx, s.container, key, body, nil); err != nil {
+	cr := newChecksumReader(body)
+	if _, err := s.client.UploadStream(ctx, s.container, key, cr, nil); err != nil {
 		return core.Module{}, fmt.Errorf("%v: %w", module.ErrModuleUploadFailed, err)
 	}
+	s.storeChecksum(ctx, key, cr.Sum())
 
 	return s.GetModule(ctx, namespace, name, provider, version)
 }
@@ -125,9 +159,9 @@ func (s *AzureStorage) UploadModule(ctx context.Context, namespace, name, provid
 func (s *AzureStorage) getProvider(ctx context.Context, pt providerType, provider *core.Provider) (*core.Provider, error) {
 	var archivePath, shasumPath, shasumSigPath string
 	if pt == internalProviderType {
-		archivePath, shasumPath, shasumSigPath = internalProviderPath(s.prefix, provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
+		archivePath, shasumPath, shasumSigPath = internalProviderPath(scopedPrefix(ctx, s.prefix), provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
 	} else if pt == mirrorProviderType {
-		archivePath, shasumPath, shasumSigPath = mirrorProviderPath(s.prefix, provider.Hostname, provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
+		archivePath, shasumPath, shasumSigPath = mirrorProviderPath(scopedPrefix(ctx, s.prefix), provider.Hostname, provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
 	}
 
 	if exists, err := s.objectExists(ctx, archivePath); err != nil {
@@ -162,7 +196,9 @@ func (s *AzureStorage) getProvider(ctx context.Context, pt providerType, provide
 
 	var signingKeys *core.SigningKeys
 	if pt == internalProviderType {
-		signingKeys, err = s.SigningKeys(ctx, provider.Namespace)
+		signingKeys, err = signingKeysWithFallback(ctx, provider.Namespace, s.signingKeysFallback, func(ctx context.Context) (*core.SigningKeys, error) {
+			return s.ProviderSigningKeys(ctx, provider.Namespace, provider.Name, provider.Version)
+		}, s.SigningKeys)
 	} else if pt == mirrorProviderType {
 		signingKeys, err = s.MirroredSigningKeys(ctx, provider.Hostname, provider.Namespace)
 	}
@@ -191,11 +227,15 @@ func (s *AzureStorage) GetMirroredProvider(ctx context.Context, provider *core.P
 }
 
 func (s *AzureStorage) listProviderVersions(ctx context.Context, pt providerType, provider *core.Provider) ([]*core.Provider, error) {
-	prefix := providerStoragePrefix(s.prefix, pt, provider.Hostname, provider.Namespace, provider.Name)
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.prefix), pt, provider.Hostname, provider.Namespace, provider.Name)
+	if provider.Version != "" {
+		prefix = providerVersionPrefix(scopedPrefix(ctx, s.prefix), pt, provider.Hostname, provider.Namespace, provider.Name, provider.Version)
+	}
 
 	var providers []*core.Provider
 	pager := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{
-		Prefix: &prefix,
+		Prefix:     &prefix,
+		MaxResults: s.listMaxResults(),
 	})
 	for pager.More() {
 		page, err := pager.NextPage(ctx)
@@ -241,10 +281,174 @@ func (s *AzureStorage) ListProviderVersions(ctx context.Context, namespace, name
 	return collection.List(), nil
 }
 
+// ListProviderPlatforms lists the archives of an internal provider version, without listing the files of the other versions
+func (s *AzureStorage) ListProviderPlatforms(ctx context.Context, namespace, name, version string) ([]core.Platform, error) {
+	prefix := providerVersionPrefix(scopedPrefix(ctx, s.prefix), internalProviderType, "", namespace, name, version)
+	pager := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{
+		Prefix:     &prefix,
+		MaxResults: s.listMaxResults(),
+	})
+
+	var keys []string
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to page next page: %w", err)
+		}
+		for _, obj := range page.Segment.BlobItems {
+			keys = append(keys, *obj.Name)
+		}
+	}
+
+	return providerPlatforms(&core.Provider{Namespace: namespace, Name: name, Version: version}, keys)
+}
+
+// ListProviderVersionsPage returns a page of the versions of an internal provider, which is resumed with the Azure Storage marker
+func (s *AzureStorage) ListProviderVersionsPage(ctx context.Context, namespace, name string, limit int, token string) (*core.ProviderVersions, string, error) {
+	prefix := fmt.Sprintf("%s/", providerStoragePrefix(scopedPrefix(ctx, s.prefix), internalProviderType, "", namespace, name))
+	return listProviderVersionsPage(ctx, &core.Provider{Namespace: namespace, Name: name}, limit, token, func(ctx context.Context, continuation string) ([]string, string, error) {
+		options := &azblob.ListBlobsFlatOptions{
+			Prefix:     &prefix,
+			MaxResults: s.listMaxResults(),
+		}
+		if continuation != "" {
+			options.Marker = &continuation
+		}
+
+		page, err := s.client.NewListBlobsFlatPager(s.container, options).NextPage(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to page next page: %w", err)
+		}
+
+		keys := make([]string, 0, len(page.Segment.BlobItems))
+		for _, obj := range page.Segment.BlobItems {
+			keys = append(keys, *obj.Name)
+		}
+		var next string
+		if page.NextMarker != nil {
+			next = *page.NextMarker
+		}
+		return keys, next, nil
+	})
+}
+
 func (s *AzureStorage) ListMirroredProviders(ctx context.Context, provider *core.Provider) ([]*core.Provider, error) {
 	return s.listProviderVersions(ctx, mirrorProviderType, provider)
 }
 
+func (s *AzureStorage) ListAllMirroredProviders(ctx context.Context) ([]*core.Provider, error) {
+	prefix := mirrorStoragePrefix(scopedPrefix(ctx, s.prefix))
+
+	var providers []*core.Provider
+	pager := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{
+		Prefix:     &prefix,
+		MaxResults: s.listMaxResults(),
+	})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to page next page: %w", err)
+		}
+
+		for _, obj := range page.Segment.BlobItems {
+			p, err := mirroredProviderFromObject(prefix, *obj.Name)
+			if err != nil {
+				continue
+			}
+			providers = append(providers, p)
+		}
+	}
+
+	return providers, nil
+}
+
+// ListAllModules returns all versions of all modules with a single listing of the modules prefix
+func (s *AzureStorage) ListAllModules(ctx context.Context) ([]core.Module, error) {
+	prefix := moduleStoragePrefix(scopedPrefix(ctx, s.prefix))
+
+	var modules []core.Module
+	pager := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{
+		Prefix:     &prefix,
+		MaxResults: s.listMaxResults(),
+	})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", module.ErrModuleListFailed, err)
+		}
+
+		for _, obj := range page.Segment.BlobItems {
+			m, err := moduleFromObject(*obj.Name, s.moduleArchiveFormat)
+			if err != nil {
+				continue
+			}
+			modules = append(modules, *m)
+		}
+	}
+
+	return modules, nil
+}
+
+// ListModulesByProvider lists the namespaces and module names with the delimiter and checks the provider of every module with a single blob
+func (s *AzureStorage) ListModulesByProvider(ctx context.Context, provider string, limit int, token string) ([]core.Module, string, error) {
+	list := func(ctx context.Context, prefix string) ([]string, error) {
+		pager := s.client.ServiceClient().NewContainerClient(s.container).NewListBlobsHierarchyPager("/", &container.ListBlobsHierarchyOptions{
+			Prefix:     &prefix,
+			MaxResults: s.listMaxResults(),
+		})
+
+		var prefixes []string
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range page.Segment.BlobPrefixes {
+				prefixes = append(prefixes, *p.Name)
+			}
+		}
+		return prefixes, nil
+	}
+	exists := func(ctx context.Context, prefix string) (bool, error) {
+		page, err := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{
+			Prefix:     &prefix,
+			MaxResults: to.Ptr(int32(1)),
+		}).NextPage(ctx)
+		if err != nil {
+			return false, err
+		}
+		return len(page.Segment.BlobItems) > 0, nil
+	}
+	return listModulesByProvider(ctx, moduleStoragePrefix(scopedPrefix(ctx, s.prefix)), provider, limit, token, list, exists)
+}
+
+// ListAllProviders returns all platforms of all internal providers with a single listing of the providers prefix
+func (s *AzureStorage) ListAllProviders(ctx context.Context) ([]*core.Provider, error) {
+	prefix := internalStoragePrefix(scopedPrefix(ctx, s.prefix))
+
+	var providers []*core.Provider
+	pager := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{
+		Prefix:     &prefix,
+		MaxResults: s.listMaxResults(),
+	})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to page next page: %w", err)
+		}
+
+		for _, obj := range page.Segment.BlobItems {
+			p, err := internalProviderFromObject(prefix, *obj.Name)
+			if err != nil {
+				continue
+			}
+			providers = append(providers, p)
+		}
+	}
+
+	return providers, nil
+}
+
 func (s *AzureStorage) UploadProviderReleaseFiles(ctx context.Context, namespace, name, filename string, file io.Reader) error {
 	if namespace == "" {
 		return fmt.Errorf("namespace argument is empty")
@@ -258,16 +462,183 @@ func (s *AzureStorage) UploadProviderReleaseFiles(ctx context.Context, namespace
 		return fmt.Errorf("filename argument is empty")
 	}
 
-	prefix := providerStoragePrefix(s.prefix, internalProviderType, "", namespace, name)
+	if err := validateReleaseFileName(name, filename); err != nil {
+		return err
+	}
+
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.prefix), internalProviderType, "", namespace, name)
+	key := path.Join(prefix, filename)
+	cr := newChecksumReader(file)
+	if err := s.upload(ctx, key, cr, false); err != nil {
+		return err
+	}
+	s.storeChecksum(ctx, key, cr.Sum())
+	return nil
+}
+
+// ProviderReleaseFileChecksum returns the checksum of a file of an internal provider release, which was computed during its upload
+func (s *AzureStorage) ProviderReleaseFileChecksum(ctx context.Context, namespace, name, filename string) ([]byte, error) {
+	key := path.Join(providerStoragePrefix(scopedPrefix(ctx, s.prefix), internalProviderType, "", namespace, name), filename)
+	checksum, exists, err := s.objectChecksum(ctx, key)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, core.ErrObjectNotFound
+	}
+	return decodeChecksum(key, checksum)
+}
+
+// LockProviderVersion creates the lock blob of an internal provider version, unless it already exists
+func (s *AzureStorage) LockProviderVersion(ctx context.Context, namespace, name, version string) error {
+	key := internalProviderLockPath(scopedPrefix(ctx, s.prefix), namespace, name, version)
+	create := func(ctx context.Context, content []byte) error {
+		options := &azblob.UploadStreamOptions{
+			AccessConditions: &blob.AccessConditions{
+				ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: to.Ptr(azcore.ETagAny)},
+			},
+		}
+		if _, err := s.client.UploadStream(ctx, s.container, key, bytes.NewReader(content), options); err != nil {
+			if bloberror.HasCode(err, bloberror.BlobAlreadyExists, bloberror.ConditionNotMet) {
+				return fmt.Errorf("failed to lock %s: %w", key, core.ErrUploadInProgress)
+			}
+			return fmt.Errorf("failed to lock %s: %w", key, err)
+		}
+		return nil
+	}
+	return s.locks.acquire(ctx, key, create, s.readLock(key), s.removeLock(key))
+}
+
+// UnlockProviderVersion deletes the lock blob of an internal provider version, if it's still held by this upload
+func (s *AzureStorage) UnlockProviderVersion(ctx context.Context, namespace, name, version string) error {
+	key := internalProviderLockPath(scopedPrefix(ctx, s.prefix), namespace, name, version)
+	return s.locks.release(ctx, key, s.readLock(key), s.removeLock(key))
+}
+
+// readLock returns the content and the ETag of a lock blob, which are part of the same response
+func (s *AzureStorage) readLock(key string) readUploadLock {
+	return func(ctx context.Context) ([]byte, string, error) {
+		r, err := s.client.DownloadStream(ctx, s.container, key, nil)
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, "", core.ErrObjectNotFound
+		} else if err != nil {
+			return nil, "", fmt.Errorf("failed to download %s: %w", key, err)
+		}
+		defer r.Body.Close()
+
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, "", err
+		}
+		var etag azcore.ETag
+		if r.ETag != nil {
+			etag = *r.ETag
+		}
+		return content, string(etag), nil
+	}
+}
+
+// removeLock deletes a lock blob only if it still has the ETag
+func (s *AzureStorage) removeLock(key string) removeUploadLock {
+	return func(ctx context.Context, etag string) error {
+		options := &azblob.DeleteBlobOptions{
+			AccessConditions: &blob.AccessConditions{
+				ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: to.Ptr(azcore.ETag(etag))},
+			},
+		}
+		if _, err := s.client.DeleteBlob(ctx, s.container, key, options); err != nil {
+			if bloberror.HasCode(err, bloberror.ConditionNotMet) {
+				return fmt.Errorf("the lock %s was replaced: %w", key, core.ErrUploadInProgress)
+			}
+			return err
+		}
+		s.existsCache.invalidate(key)
+		return nil
+	}
+}
+
+// DownloadProviderReleaseFile returns a file of an internal provider release, which was uploaded with UploadProviderReleaseFiles
+func (s *AzureStorage) DownloadProviderReleaseFile(ctx context.Context, namespace, name, filename string) ([]byte, error) {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.prefix), internalProviderType, "", namespace, name)
 	key := filepath.Join(prefix, filename)
-	return s.upload(ctx, key, file, false)
+	return s.download(ctx, key)
+}
+
+// StreamProviderReleaseFile writes a file of an internal provider release to w
+func (s *AzureStorage) StreamProviderReleaseFile(ctx context.Context, namespace, name, filename string, w io.Writer) error {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.prefix), internalProviderType, "", namespace, name)
+	key := path.Join(prefix, filename)
+	r, err := s.client.DownloadStream(ctx, s.container, key, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", key, err)
+	}
+
+	// Interrupted downloads are resumed from the last received byte
+	body := r.Body
+	if retries := s.retry.azureReadRetries(); retries > 0 {
+		body = r.NewRetryReader(ctx, &blob.RetryReaderOptions{MaxRetries: retries})
+	}
+	defer body.Close()
+
+	_, err = io.Copy(w, body)
+	return err
+}
+
+// DeleteProviderReleaseFile deletes a file of an internal provider release
+func (s *AzureStorage) DeleteProviderReleaseFile(ctx context.Context, namespace, name, filename string) error {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.prefix), internalProviderType, "", namespace, name)
+	key := path.Join(prefix, filename)
+	if _, err := s.client.DeleteBlob(ctx, s.container, key, nil); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	s.existsCache.invalidate(key)
+	return nil
+}
+
+// ProviderSha256Sums returns the SHA256SUMS file of an internal provider version
+func (s *AzureStorage) ProviderSha256Sums(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	key := internalProviderShasumPath(scopedPrefix(ctx, s.prefix), namespace, name, version)
+	exists, err := s.objectExists(ctx, key)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, core.ErrObjectNotFound
+	}
+	return s.download(ctx, key)
+}
+
+// ProviderDocs returns the metadata.json document of an internal provider version
+func (s *AzureStorage) ProviderDocs(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	key := internalProviderDocsPath(scopedPrefix(ctx, s.prefix), namespace, name, version)
+	exists, err := s.objectExists(ctx, key)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, core.ErrObjectNotFound
+	}
+	return s.download(ctx, key)
+}
+
+// ProviderExists reports whether the archive of an internal provider version exists for the platform
+func (s *AzureStorage) ProviderExists(ctx context.Context, namespace, name, version, os, arch string) (bool, error) {
+	archivePath, _, _ := internalProviderPath(scopedPrefix(ctx, s.prefix), namespace, name, version, os, arch)
+	return s.objectExists(ctx, archivePath)
+}
+
+// ProviderDocsExist reports whether a metadata.json document exists for an internal provider version
+func (s *AzureStorage) ProviderDocsExist(ctx context.Context, namespace, name, version string) (bool, error) {
+	return s.objectExists(ctx, internalProviderDocsPath(scopedPrefix(ctx, s.prefix), namespace, name, version))
 }
 
 func (s *AzureStorage) signingKeys(ctx context.Context, pt providerType, hostname, namespace string) (*core.SigningKeys, error) {
 	if namespace == "" {
 		return nil, fmt.Errorf("namespace argument is empty")
 	}
-	key := signingKeysPath(s.prefix, pt, hostname, namespace)
+	return s.signingKeysObject(ctx, signingKeysPath(scopedPrefix(ctx, s.prefix), pt, hostname, namespace))
+}
+
+// signingKeysObject downloads and unmarshals the signing keys stored under key.
+// It returns core.ErrObjectNotFound if the object doesn't exist.
+func (s *AzureStorage) signingKeysObject(ctx context.Context, key string) (*core.SigningKeys, error) {
 	exists, err := s.objectExists(ctx, key)
 	if err != nil {
 		return nil, err
@@ -277,12 +648,17 @@ func (s *AzureStorage) signingKeys(ctx context.Context, pt providerType, hostnam
 
 	signingKeysRaw, err := s.download(ctx, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download signing_keys.json for namespace %s: %w", namespace, err)
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
 	}
 
 	return unmarshalSigningKeys(signingKeysRaw)
 }
 
+// ProviderSigningKeys returns the signing keys of the provider version, of the provider or of the namespace, whichever are the most specific
+func (s *AzureStorage) ProviderSigningKeys(ctx context.Context, namespace, name, version string) (*core.SigningKeys, error) {
+	return mostSpecificSigningKeys(ctx, providerSigningKeysPaths(scopedPrefix(ctx, s.prefix), namespace, name, version), s.signingKeysObject)
+}
+
 // SigningKeys downloads the JSON placed in the namespace in Azure Blob Storage and unmarshals it into a core.SigningKeys
 func (s *AzureStorage) SigningKeys(ctx context.Context, namespace string) (*core.SigningKeys, error) {
 	return s.signingKeys(ctx, internalProviderType, "", namespace)
@@ -297,16 +673,21 @@ func (s *AzureStorage) uploadSigningKeys(ctx context.Context, pt providerType, h
 	if err != nil {
 		return err
 	}
-	key := signingKeysPath(s.prefix, pt, hostname, namespace)
+	key := signingKeysPath(scopedPrefix(ctx, s.prefix), pt, hostname, namespace)
 	return s.upload(ctx, key, bytes.NewReader(b), true)
 }
 
+// UploadSigningKeys replaces the signing keys of an internal provider namespace
+func (s *AzureStorage) UploadSigningKeys(ctx context.Context, namespace string, signingKeys *core.SigningKeys) error {
+	return s.uploadSigningKeys(ctx, internalProviderType, "", namespace, signingKeys)
+}
+
 func (s *AzureStorage) UploadMirroredSigningKeys(ctx context.Context, hostname, namespace string, signingKeys *core.SigningKeys) error {
 	return s.uploadSigningKeys(ctx, mirrorProviderType, hostname, namespace, signingKeys)
 }
 
 func (s *AzureStorage) MirroredSha256Sum(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
-	prefix := providerStoragePrefix(s.prefix, mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.prefix), mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
 	key := filepath.Join(prefix, provider.ShasumFileName())
 	shaSumBytes, err := s.download(ctx, key)
 	if err != nil {
@@ -317,11 +698,47 @@ func (s *AzureStorage) MirroredSha256Sum(ctx context.Context, provider *core.Pro
 }
 
 func (s *AzureStorage) UploadMirroredFile(ctx context.Context, provider *core.Provider, fileName string, reader io.Reader) error {
-	prefix := providerStoragePrefix(s.prefix, mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.prefix), mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
 	key := filepath.Join(prefix, fileName)
 	return s.upload(ctx, key, reader, true)
 }
 
+func (s *AzureStorage) DownloadMirroredFile(ctx context.Context, provider *core.Provider, fileName string) ([]byte, error) {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.prefix), mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
+	key := filepath.Join(prefix, fileName)
+	return s.download(ctx, key)
+}
+
+func (s *AzureStorage) ListMirroredFiles(ctx context.Context) ([]string, error) {
+	prefix := mirrorStoragePrefix(scopedPrefix(ctx, s.prefix))
+
+	var keys []string
+	pager := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{
+		Prefix:     &prefix,
+		MaxResults: s.listMaxResults(),
+	})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to page next page: %w", err)
+		}
+		for _, obj := range page.Segment.BlobItems {
+			keys = append(keys, strings.TrimPrefix(*obj.Name, prefix))
+		}
+	}
+	return keys, nil
+}
+
+func (s *AzureStorage) DeleteMirroredFile(ctx context.Context, provider *core.Provider, fileName string) error {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.prefix), mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
+	key := path.Join(prefix, fileName)
+	if _, err := s.client.DeleteBlob(ctx, s.container, key, nil); err != nil {
+		return err
+	}
+	s.existsCache.invalidate(key)
+	return nil
+}
+
 func (s *AzureStorage) presignedURL(ctx context.Context, key string) (string, error) {
 	info := service.KeyInfo{
 		Start:  to.Ptr(time.Now().UTC().Format(sas.TimeFormat)),
@@ -335,7 +752,7 @@ func (s *AzureStorage) presignedURL(ctx context.Context, key string) (string, er
 
 	params, err := sas.BlobSignatureValues{
 		Protocol:      sas.ProtocolHTTPS,
-		ExpiryTime:    time.Now().Add(s.signedURLExpiry),
+		ExpiryTime:    time.Now().Add(s.signedURLHeadroom.expiry(ctx, s.signedURLExpiry)),
 		Permissions:   to.Ptr(sas.BlobPermissions{Read: true}).String(),
 		ContainerName: s.container,
 		BlobName:      key,
@@ -349,17 +766,170 @@ func (s *AzureStorage) presignedURL(ctx context.Context, key string) (string, er
 	return url, nil
 }
 
+// InvalidateCache forgets the existence of the objects starting with the prefix, relative to the container prefix
+func (s *AzureStorage) InvalidateCache(ctx context.Context, prefix string) int {
+	return s.existsCache.invalidate(keyPrefix(scopedPrefix(ctx, s.prefix), prefix))
+}
+
+// ListKeys returns up to limit blob names of the container under the prefix
+func (s *AzureStorage) ListKeys(ctx context.Context, prefix string, limit int) ([]string, error) {
+	p := keyPrefix(scopedPrefix(ctx, s.prefix), prefix)
+	pager := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{
+		Prefix:     &p,
+		MaxResults: to.Ptr(int32(limit)),
+	})
+
+	var keys []string
+	for pager.More() && len(keys) < limit {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Segment.BlobItems {
+			keys = append(keys, *obj.Name)
+		}
+	}
+
+	return truncateKeys(keys, limit), nil
+}
+
+// ListAllKeys returns the names of all blobs under the prefix, relative to the prefix
+func (s *AzureStorage) ListAllKeys(ctx context.Context) ([]string, error) {
+	prefix := keyPrefix(s.prefix, "")
+	pager := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{
+		Prefix:     &prefix,
+		MaxResults: s.listMaxResults(),
+	})
+
+	var keys []string
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Segment.BlobItems {
+			keys = append(keys, strings.TrimPrefix(*obj.Name, prefix))
+		}
+	}
+	return keys, nil
+}
+
+// CopyToPrefix copies the blob with an asynchronous server-side copy and waits until the copy has completed.
+// Azure doesn't compute checksums of the copy, so the copy is bound to the ETag of the source instead,
+// and a copy that doesn't succeed, e.g. because the source changed, is reported as an error.
+func (s *AzureStorage) CopyToPrefix(ctx context.Context, key, targetPrefix string) error {
+	src, dst, err := relocationKeys(s.prefix, targetPrefix, key)
+	if err != nil {
+		return err
+	}
+
+	container := s.client.ServiceClient().NewContainerClient(s.container)
+	srcClient := container.NewBlobClient(src)
+	dstClient := container.NewBlobClient(dst)
+	srcProps, err := srcClient.GetProperties(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := dstClient.StartCopyFromURL(ctx, srcClient.URL(), &blob.StartCopyFromURLOptions{
+		SourceModifiedAccessConditions: &blob.SourceModifiedAccessConditions{SourceIfMatch: srcProps.ETag},
+	}); err != nil {
+		return err
+	}
+
+	// The copy completes asynchronously, e.g. for large blobs
+	for {
+		props, err := dstClient.GetProperties(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if props.CopyStatus != nil && *props.CopyStatus == blob.CopyStatusTypePending {
+			select {
+			case <-time.After(time.Second):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if props.CopyStatus == nil || *props.CopyStatus != blob.CopyStatusTypeSuccess {
+			return fmt.Errorf("the copy of %s to %s didn't succeed: %s", src, dst, copyStatus(props.CopyStatus, props.CopyStatusDescription))
+		}
+		return nil
+	}
+}
+
+func copyStatus(status *blob.CopyStatusType, description *string) string {
+	if status == nil {
+		return "the copy status is missing"
+	}
+	if description == nil {
+		return string(*status)
+	}
+	return fmt.Sprintf("%s: %s", *status, *description)
+}
+
+// DeleteKey deletes the blob with the name relative to the prefix
+func (s *AzureStorage) DeleteKey(ctx context.Context, key string) error {
+	_, err := s.client.DeleteBlob(ctx, s.container, keyPrefix(s.prefix, key), nil)
+	return err
+}
+
+// HealthCheck verifies that the Azure Storage container is reachable with the configured credentials.
+// A missing object is not an error, only failing requests are reported.
+func (s *AzureStorage) HealthCheck(ctx context.Context) error {
+	_, err := s.objectExists(ctx, path.Join(s.prefix, healthCheckKey))
+	return err
+}
+
+func (s *AzureStorage) String() string { return "azure" }
+
+// listMaxResults returns the MaxResults of listings, nil keeps the default of Azure
+func (s *AzureStorage) listMaxResults() *int32 {
+	if s.pageSize <= 0 {
+		return nil
+	}
+	return to.Ptr(int32(s.pageSize))
+}
+
 func (s *AzureStorage) objectExists(ctx context.Context, key string) (bool, error) {
+	_, exists, err := s.objectChecksum(ctx, key)
+	return exists, err
+}
+
+// objectChecksum reports whether the blob exists and returns the checksum from its metadata, which is empty if it has none
+func (s *AzureStorage) objectChecksum(ctx context.Context, key string) (string, bool, error) {
+	if checksum, ok := s.existsCache.lookup(key); ok {
+		return checksum, true, nil
+	}
+
 	o := s.client.ServiceClient().NewContainerClient(s.container).NewBlobClient(key)
-	_, err := o.GetProperties(ctx, nil)
+	props, err := o.GetProperties(ctx, nil)
 
 	if bloberror.HasCode(err, bloberror.BlobNotFound) {
-		return false, nil
+		return "", false, nil
 	} else if err != nil {
-		return false, err
+		return "", false, err
 	}
 
-	return true, nil
+	// The metadata keys are canonicalized like HTTP headers
+	var checksum string
+	for k, v := range props.Metadata {
+		if strings.EqualFold(k, checksumMetadataKey) && v != nil {
+			checksum = *v
+		}
+	}
+	s.existsCache.add(key, checksum)
+	return checksum, true, nil
+}
+
+// storeChecksum adds the checksum to the metadata of an uploaded blob.
+// A failure is only logged, as the blob is complete and verifications fall back to downloading it.
+func (s *AzureStorage) storeChecksum(ctx context.Context, key, checksum string) {
+	o := s.client.ServiceClient().NewContainerClient(s.container).NewBlobClient(key)
+	if _, err := o.SetMetadata(ctx, map[string]*string{checksumMetadataKey: to.Ptr(checksum)}, nil); err != nil {
+		slog.Warn("failed to store the checksum of the uploaded object", slog.String("key", key), slog.String("err", err.Error()))
+		return
+	}
+	s.existsCache.add(key, checksum)
 }
 
 func (s *AzureStorage) upload(ctx context.Context, key string, reader io.Reader, overwrite bool) error {
@@ -385,7 +955,14 @@ func (s *AzureStorage) download(ctx context.Context, key string) ([]byte, error)
 		return nil, fmt.Errorf("failed to download %s: %w", key, err)
 	}
 
-	data, err := io.ReadAll(r.Body)
+	// Interrupted downloads are resumed from the last received byte
+	body := r.Body
+	if retries := s.retry.azureReadRetries(); retries > 0 {
+		body = r.NewRetryReader(ctx, &blob.RetryReaderOptions{MaxRetries: retries})
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
 	if err != nil {
 		return nil, err
 	}
@@ -393,10 +970,22 @@ func (s *AzureStorage) download(ctx context.Context, key string) ([]byte, error)
 	return data, nil
 }
 
+// GetDownloadUrl resolves a proxied URL against the URL of the storage account, the container is part of the path
 func (s *AzureStorage) GetDownloadUrl(ctx context.Context, url string) (string, error) {
+	if !strings.HasPrefix(url, s.container+"/") {
+		return "", fmt.Errorf("url %s is not located in container %s", url, s.container)
+	}
 	return fmt.Sprintf("%s%s", s.client.URL(), url), nil
 }
 
+// WithAzureStorageSignedURLHeadroom configures the minimum expiry of the signed urls of proxied downloads.
+// The nearExpiry counter is incremented whenever a shorter expiry is extended, it can be nil.
+func WithAzureStorageSignedURLHeadroom(headroom time.Duration, nearExpiry prometheus.Counter) AzureStorageOption {
+	return func(s *AzureStorage) {
+		s.signedURLHeadroom = signedURLHeadroom{min: headroom, nearExpiry: nearExpiry}
+	}
+}
+
 // AzureStorageOption provides additional options for the AzureStorage.
 type AzureStorageOption func(*AzureStorage)
 
@@ -421,11 +1010,41 @@ func WithAzureStorageSignedUrlExpiry(t time.Duration) AzureStorageOption {
 	}
 }
 
+// WithAzureStorageExistenceCacheTTL configures how long the existence of an object is cached. A zero TTL disables the cache
+func WithAzureStorageExistenceCacheTTL(ttl time.Duration) AzureStorageOption {
+	return func(s *AzureStorage) {
+		s.existsCache = newExistenceCache(ttl)
+	}
+}
+
+// WithAzureStorageRetryMaxAttempts configures the number of attempts for requests failing with transient errors
+func WithAzureStorageRetryMaxAttempts(attempts int) AzureStorageOption {
+	return func(s *AzureStorage) {
+		s.retry.maxAttempts = attempts
+	}
+}
+
+// WithAzureStorageListPageSize configures the MaxResults of the listings, which aren't limited otherwise. A zero page size keeps the default of Azure
+func WithAzureStorageListPageSize(size int) AzureStorageOption {
+	return func(s *AzureStorage) {
+		s.pageSize = size
+	}
+}
+
+// WithAzureStorageDefaultSigningKeysNamespace configures the namespace whose signing keys are served for providers of namespaces without signing keys
+func WithAzureStorageDefaultSigningKeysNamespace(namespace string) AzureStorageOption {
+	return func(s *AzureStorage) {
+		s.signingKeysFallback = namespace
+	}
+}
+
 // NewAzureStorage returns a fully initialized Azure Storage.
 func NewAzureStorage(account string, container string, options ...AzureStorageOption) (Storage, error) {
 	s := &AzureStorage{
-		account:   account,
-		container: container,
+		account:     account,
+		container:   container,
+		existsCache: newExistenceCache(DefaultExistenceCacheTTL),
+		retry:       defaultRetryConfig(),
 	}
 
 	for _, option := range options {
@@ -439,7 +1058,7 @@ func NewAzureStorage(account string, container string, options ...AzureStorageOp
 		return nil, err
 	}
 
-	client, err := azblob.NewClient(url, cred, nil)
+	client, err := azblob.NewClient(url, cred, s.retry.azureClientOptions())
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultExistenceCacheTTL is the duration for which a storage backend remembers that an object exists
+const DefaultExistenceCacheTTL = 30 * time.Second
+
+// existenceCacheSweepSize is the number of entries after which expired entries are removed on insertion
+const existenceCacheSweepSize = 1024
+
+// existenceCache remembers keys of objects that are known to exist, together with their checksum metadata.
+// Uploaded objects are immutable, so a positive result can be reused until the TTL expires.
+// Negative results are never cached, so that newly uploaded objects become visible immediately.
+// A nil *existenceCache is valid and caches nothing.
+type existenceCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]existenceEntry
+}
+
+type existenceEntry struct {
+	expiry time.Time
+	// checksum is the hex-encoded SHA-256 checksum of the object, it's empty if the object has none
+	checksum string
+}
+
+// newExistenceCache returns a cache with the given TTL, or nil if the TTL is not positive
+func newExistenceCache(ttl time.Duration) *existenceCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &existenceCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]existenceEntry),
+	}
+}
+
+// contains reports whether the key has been seen to exist within the TTL
+func (c *existenceCache) contains(key string) bool {
+	_, ok := c.lookup(key)
+	return ok
+}
+
+// lookup returns the checksum of the key and reports whether the key has been seen to exist within the TTL
+func (c *existenceCache) lookup(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if c.now().After(entry.expiry) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.checksum, true
+}
+
+// add records that the key exists with the checksum, which can be empty
+func (c *existenceCache) add(key, checksum string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= existenceCacheSweepSize {
+		for k, entry := range c.entries {
+			if now.After(entry.expiry) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = existenceEntry{expiry: now.Add(c.ttl), checksum: checksum}
+}
+
+// invalidate removes the keys starting with the prefix and returns the number of removed keys
+func (c *existenceCache) invalidate(prefix string) int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for k := range c.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.entries, k)
+			removed++
+		}
+	}
+	return removed
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExistenceCache(t *testing.T) {
+	now := time.Now()
+	c := newExistenceCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	assert.False(t, c.contains("a"))
+	c.add("a", "")
+	assert.True(t, c.contains("a"))
+	c.add("b", "9f86d081")
+	checksum, ok := c.lookup("b")
+	assert.True(t, ok)
+	assert.Equal(t, "9f86d081", checksum)
+
+	now = now.Add(2 * time.Minute)
+	assert.False(t, c.contains("a"), "expired entries must not be reported")
+	_, ok = c.lookup("b")
+	assert.False(t, ok)
+	assert.Empty(t, c.entries)
+
+	assert.Nil(t, newExistenceCache(0))
+	var disabled *existenceCache
+	disabled.add("a", "")
+	assert.False(t, disabled.contains("a"))
+}
+
+func TestExistenceCache_invalidate(t *testing.T) {
+	c := newExistenceCache(time.Minute)
+	c.add("providers/acme/dummy/terraform-provider-dummy_1.0.0_linux_amd64.zip", "")
+	c.add("providers/acme/dummy/terraform-provider-dummy_1.0.0_SHA256SUMS", "")
+	c.add("modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz", "")
+
+	assert.Equal(t, 2, c.invalidate("providers/acme/"))
+	assert.False(t, c.contains("providers/acme/dummy/terraform-provider-dummy_1.0.0_linux_amd64.zip"))
+	assert.True(t, c.contains("modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz"))
+
+	assert.Equal(t, 1, c.invalidate(""))
+	assert.Empty(t, c.entries)
+
+	var disabled *existenceCache
+	assert.Zero(t, disabled.invalidate(""))
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// checksumMetadataKey is the object metadata key of the hex-encoded SHA-256 checksum, which is computed while an object is uploaded
+const checksumMetadataKey = "sha256"
+
+// checksumReader computes the SHA-256 checksum of everything that is read through it,
+// so that the checksum of an upload is known without downloading the object again
+type checksumReader struct {
+	r io.Reader
+	h hash.Hash
+}
+
+func newChecksumReader(r io.Reader) *checksumReader {
+	h := sha256.New()
+	return &checksumReader{r: io.TeeReader(r, h), h: h}
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// Sum returns the hex-encoded checksum of the bytes that have been read so far
+func (c *checksumReader) Sum() string {
+	return hex.EncodeToString(c.h.Sum(nil))
+}
+
+// readSeekerChecksum returns the hex-encoded checksum of the remaining bytes of r and seeks back to the current offset,
+// so that the checksum can be sent with the upload of r
+func readSeekerChecksum(r io.ReadSeeker) (string, error) {
+	offset, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// decodeChecksum decodes a hex-encoded checksum, an empty checksum is returned as nil
+func decodeChecksum(key, checksum string) ([]byte, error) {
+	if checksum == "" {
+		return nil, nil
+	}
+	b, err := hex.DecodeString(checksum)
+	if err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("invalid checksum metadata of %s: %q", key, checksum)
+	}
+	return b, nil
+}
@@ -2,10 +2,29 @@ package storage
 
 import (
 	"fmt"
+	"path"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
 )
 
+// providerPlatforms returns the platforms of the archives of the provider version among the keys,
+// other files of the version, like the SHA256SUMS file, are skipped
+func providerPlatforms(provider *core.Provider, keys []string) ([]core.Platform, error) {
+	var platforms []core.Platform
+	for _, key := range keys {
+		p, err := core.NewProviderFromArchive(path.Base(key))
+		if err != nil || p.Version != provider.Version {
+			continue
+		}
+		platforms = append(platforms, core.Platform{OS: p.OS, Arch: p.Arch})
+	}
+
+	if len(platforms) == 0 {
+		return nil, noMatchingProviderFound(provider)
+	}
+	return platforms, nil
+}
+
 type Collection struct {
 	m map[string]core.ProviderVersion
 }
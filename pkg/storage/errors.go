@@ -1,9 +1,17 @@
 package storage
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"syscall"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"google.golang.org/api/googleapi"
 )
 
 func noMatchingProviderFound(provider *core.Provider) error {
@@ -13,3 +21,29 @@ func noMatchingProviderFound(provider *core.Provider) error {
 		StatusCode: http.StatusNotFound,
 	}
 }
+
+// IsTransientError reports whether an operation that failed with err might succeed when it's retried.
+// Only timeouts, dropped connections, throttling and 5xx responses of the storage backends are transient.
+func IsTransientError(err error) bool {
+	if errors.Is(err, core.ErrStorageTimeout) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var status int
+	var awsErr *awshttp.ResponseError
+	var gcsErr *googleapi.Error
+	var azureErr *azcore.ResponseError
+	switch {
+	case errors.As(err, &awsErr):
+		status = awsErr.HTTPStatusCode()
+	case errors.As(err, &gcsErr):
+		status = gcsErr.Code
+	case errors.As(err, &azureErr):
+		status = azureErr.StatusCode
+	}
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
@@ -7,8 +7,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
@@ -17,7 +21,9 @@ import (
 	credentials "cloud.google.com/go/iam/credentials/apiv1"
 	"cloud.google.com/go/iam/credentials/apiv1/credentialspb"
 	"cloud.google.com/go/storage"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 )
 
@@ -28,41 +34,56 @@ type GCSStorage struct {
 	bucket              string
 	bucketPrefix        string
 	signedURLExpiry     time.Duration
+	signedURLHeadroom   signedURLHeadroom
 	serviceAccount      string
 	moduleArchiveFormat string
+	existsCache         *existenceCache
+	retry               retryConfig
+	objectACL           string
+	signingKeysFallback string
+	pageSize            int
+	locks               uploadLocks
 }
 
 func (s *GCSStorage) GetModule(ctx context.Context, namespace, name, provider, version string) (core.Module, error) {
-	o := s.sc.Bucket(s.bucket).Object(modulePath(s.bucketPrefix, namespace, name, provider, version, s.moduleArchiveFormat))
-	attrs, err := o.Attrs(ctx)
+	key := modulePath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, provider, version, s.moduleArchiveFormat)
+	checksum, exists, err := s.objectChecksum(ctx, key)
 	if err != nil {
 		return core.Module{}, fmt.Errorf("%v: %w", module.ErrModuleNotFound, err)
+	} else if !exists {
+		return core.Module{}, module.ErrModuleNotFound
 	}
-	url, err := s.presignedURL(ctx, attrs.Name)
+	url, err := s.presignedURL(ctx, key)
 	if err != nil {
 		return core.Module{}, fmt.Errorf("%v: %w", module.ErrModuleNotFound, err)
 	}
 	return core.Module{
 		Namespace: namespace,
-		Name:      attrs.Name,
+		Name:      key,
 		Provider:  provider,
 		Version:   version,
 		/* https://www.terraform.io/docs/internals/module-registry-protocol.html#sample-response-1
 		e.g. "gcs::https://www.googleapis.com/storage/v1/modules/foomodule.zip
 		*/
 		DownloadURL: url,
+		Checksum:    checksum,
 	}, nil
 }
 
+// ModuleExists reports whether the archive of a module version exists
+func (s *GCSStorage) ModuleExists(ctx context.Context, namespace, name, provider, version string) (bool, error) {
+	return s.objectExists(ctx, modulePath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, provider, version, s.moduleArchiveFormat))
+}
+
 func (s *GCSStorage) ListModuleVersions(ctx context.Context, namespace, name, provider string) ([]core.Module, error) {
-	prefix := modulePathPrefix(s.bucketPrefix, namespace, name, provider)
+	prefix := modulePathPrefix(scopedPrefix(ctx, s.bucketPrefix), namespace, name, provider)
 
 	query := &storage.Query{
 		Prefix: prefix,
 	}
 
 	var modules []core.Module
-	it := s.sc.Bucket(s.bucket).Objects(ctx, query)
+	it := s.objects(ctx, query)
 	for {
 		attrs, err := it.Next()
 		if errors.Is(err, iterator.Done) {
@@ -98,18 +119,33 @@ func (s *GCSStorage) UploadModule(ctx context.Context, namespace, name, provider
 		return core.Module{}, errors.New("version not defined")
 	}
 
-	key := modulePath(s.bucketPrefix, namespace, name, provider, version, s.moduleArchiveFormat)
-	if _, err := s.GetModule(ctx, namespace, name, provider, version); err == nil {
-		return core.Module{}, fmt.Errorf("%w: %s", module.ErrModuleAlreadyExists, key)
+	key := modulePath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, provider, version, s.moduleArchiveFormat)
+	if m, err := s.GetModule(ctx, namespace, name, provider, version); err == nil {
+		if m.Checksum != "" {
+			if err := compareModuleChecksum(key, body, m.Checksum); err != nil {
+				return core.Module{}, err
+			}
+			return m, nil
+		}
+		stored, err := s.download(ctx, modulePath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, provider, version, s.moduleArchiveFormat))
+		if err != nil {
+			return core.Module{}, err
+		}
+		if err := compareModuleArchive(key, body, stored); err != nil {
+			return core.Module{}, err
+		}
+		return m, nil
 	}
 
-	wc := s.sc.Bucket(s.bucket).Object(key).NewWriter(ctx)
-	if _, err := io.Copy(wc, body); err != nil {
+	cr := newChecksumReader(body)
+	wc := s.newWriter(ctx, s.sc.Bucket(s.bucket).Object(key))
+	if _, err := io.Copy(wc, cr); err != nil {
 		return core.Module{}, fmt.Errorf("%v: %w", module.ErrModuleUploadFailed, err)
 	}
 	if err := wc.Close(); err != nil {
 		return core.Module{}, fmt.Errorf("%v: %w", module.ErrModuleUploadFailed, err)
 	}
+	s.storeChecksum(ctx, key, cr.Sum())
 
 	return s.GetModule(ctx, namespace, name, provider, version)
 }
@@ -118,9 +154,9 @@ func (s *GCSStorage) UploadModule(ctx context.Context, namespace, name, provider
 func (s *GCSStorage) getProvider(ctx context.Context, pt providerType, provider *core.Provider) (*core.Provider, error) {
 	var archivePath, shasumPath, shasumSigPath string
 	if pt == internalProviderType {
-		archivePath, shasumPath, shasumSigPath = internalProviderPath(s.bucketPrefix, provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
+		archivePath, shasumPath, shasumSigPath = internalProviderPath(scopedPrefix(ctx, s.bucketPrefix), provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
 	} else if pt == mirrorProviderType {
-		archivePath, shasumPath, shasumSigPath = mirrorProviderPath(s.bucketPrefix, provider.Hostname, provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
+		archivePath, shasumPath, shasumSigPath = mirrorProviderPath(scopedPrefix(ctx, s.bucketPrefix), provider.Hostname, provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
 	}
 
 	if exists, err := s.objectExists(ctx, archivePath); err != nil {
@@ -155,7 +191,9 @@ func (s *GCSStorage) getProvider(ctx context.Context, pt providerType, provider
 
 	var signingKeys *core.SigningKeys
 	if pt == internalProviderType {
-		signingKeys, err = s.SigningKeys(ctx, provider.Namespace)
+		signingKeys, err = signingKeysWithFallback(ctx, provider.Namespace, s.signingKeysFallback, func(ctx context.Context) (*core.SigningKeys, error) {
+			return s.ProviderSigningKeys(ctx, provider.Namespace, provider.Name, provider.Version)
+		}, s.SigningKeys)
 	} else if pt == mirrorProviderType {
 		signingKeys, err = s.MirroredSigningKeys(ctx, provider.Hostname, provider.Namespace)
 	}
@@ -184,12 +222,15 @@ func (s *GCSStorage) GetMirroredProvider(ctx context.Context, provider *core.Pro
 }
 
 func (s *GCSStorage) listProviderVersions(ctx context.Context, pt providerType, provider *core.Provider) ([]*core.Provider, error) {
-	prefix := providerStoragePrefix(s.bucketPrefix, pt, provider.Hostname, provider.Namespace, provider.Name)
+	prefix := fmt.Sprintf("%s/", providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), pt, provider.Hostname, provider.Namespace, provider.Name))
+	if provider.Version != "" {
+		prefix = providerVersionPrefix(scopedPrefix(ctx, s.bucketPrefix), pt, provider.Hostname, provider.Namespace, provider.Name, provider.Version)
+	}
 	query := &storage.Query{
-		Prefix: fmt.Sprintf("%s/", prefix),
+		Prefix: prefix,
 	}
 
-	it := s.sc.Bucket(s.bucket).Objects(ctx, query)
+	it := s.objects(ctx, query)
 
 	var providers []*core.Provider
 	for {
@@ -248,10 +289,163 @@ func (s *GCSStorage) ListProviderVersions(ctx context.Context, namespace, name s
 	return collection.List(), nil
 }
 
+// ListProviderPlatforms lists the archives of an internal provider version, without listing the files of the other versions
+func (s *GCSStorage) ListProviderPlatforms(ctx context.Context, namespace, name, version string) ([]core.Platform, error) {
+	query := &storage.Query{
+		Prefix: providerVersionPrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name, version),
+	}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	it := s.objects(ctx, query)
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, attrs.Name)
+	}
+
+	return providerPlatforms(&core.Provider{Namespace: namespace, Name: name, Version: version}, keys)
+}
+
+// ListProviderVersionsPage returns a page of the versions of an internal provider, which is resumed with the GCS page token
+func (s *GCSStorage) ListProviderVersionsPage(ctx context.Context, namespace, name string, limit int, token string) (*core.ProviderVersions, string, error) {
+	query := &storage.Query{
+		Prefix: fmt.Sprintf("%s/", providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name)),
+	}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return nil, "", err
+	}
+
+	return listProviderVersionsPage(ctx, &core.Provider{Namespace: namespace, Name: name}, limit, token, func(ctx context.Context, continuation string) ([]string, string, error) {
+		var attrs []*storage.ObjectAttrs
+		next, err := iterator.NewPager(s.sc.Bucket(s.bucket).Objects(ctx, query), s.pagerSize(), continuation).NextPage(&attrs)
+		if err != nil {
+			return nil, "", err
+		}
+
+		keys := make([]string, 0, len(attrs))
+		for _, a := range attrs {
+			keys = append(keys, a.Name)
+		}
+		return keys, next, nil
+	})
+}
+
 func (s *GCSStorage) ListMirroredProviders(ctx context.Context, provider *core.Provider) ([]*core.Provider, error) {
 	return s.listProviderVersions(ctx, mirrorProviderType, provider)
 }
 
+func (s *GCSStorage) ListAllMirroredProviders(ctx context.Context) ([]*core.Provider, error) {
+	prefix := mirrorStoragePrefix(scopedPrefix(ctx, s.bucketPrefix))
+	it := s.objects(ctx, &storage.Query{Prefix: prefix})
+
+	var providers []*core.Provider
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := mirroredProviderFromObject(prefix, attrs.Name)
+		if err != nil {
+			continue
+		}
+		providers = append(providers, p)
+	}
+
+	return providers, nil
+}
+
+// ListAllModules returns all versions of all modules with a single listing of the modules prefix
+func (s *GCSStorage) ListAllModules(ctx context.Context) ([]core.Module, error) {
+	it := s.objects(ctx, &storage.Query{Prefix: moduleStoragePrefix(scopedPrefix(ctx, s.bucketPrefix))})
+
+	var modules []core.Module
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", module.ErrModuleListFailed, err)
+		}
+
+		m, err := moduleFromObject(attrs.Name, s.moduleArchiveFormat)
+		if err != nil {
+			continue
+		}
+		modules = append(modules, *m)
+	}
+
+	return modules, nil
+}
+
+// ListModulesByProvider lists the namespaces and module names with the delimiter and checks the provider of every module with a single object
+func (s *GCSStorage) ListModulesByProvider(ctx context.Context, provider string, limit int, token string) ([]core.Module, string, error) {
+	list := func(ctx context.Context, prefix string) ([]string, error) {
+		it := s.objects(ctx, &storage.Query{Prefix: prefix, Delimiter: "/"})
+
+		var prefixes []string
+		for {
+			attrs, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			// Objects directly below the prefix are returned as well, only the synthetic entries of the common prefixes have a Prefix
+			if attrs.Prefix != "" {
+				prefixes = append(prefixes, attrs.Prefix)
+			}
+		}
+		return prefixes, nil
+	}
+	exists := func(ctx context.Context, prefix string) (bool, error) {
+		_, err := s.sc.Bucket(s.bucket).Objects(ctx, &storage.Query{Prefix: prefix}).Next()
+		if errors.Is(err, iterator.Done) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	return listModulesByProvider(ctx, moduleStoragePrefix(scopedPrefix(ctx, s.bucketPrefix)), provider, limit, token, list, exists)
+}
+
+// ListAllProviders returns all platforms of all internal providers with a single listing of the providers prefix
+func (s *GCSStorage) ListAllProviders(ctx context.Context) ([]*core.Provider, error) {
+	prefix := internalStoragePrefix(scopedPrefix(ctx, s.bucketPrefix))
+	it := s.objects(ctx, &storage.Query{Prefix: prefix})
+
+	var providers []*core.Provider
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := internalProviderFromObject(prefix, attrs.Name)
+		if err != nil {
+			continue
+		}
+		providers = append(providers, p)
+	}
+
+	return providers, nil
+}
+
 func (s *GCSStorage) UploadProviderReleaseFiles(ctx context.Context, namespace, name, filename string, file io.Reader) error {
 	if namespace == "" {
 		return fmt.Errorf("namespace argument is empty")
@@ -265,37 +459,243 @@ func (s *GCSStorage) UploadProviderReleaseFiles(ctx context.Context, namespace,
 		return fmt.Errorf("filename argument is empty")
 	}
 
-	prefix := providerStoragePrefix(s.bucketPrefix, internalProviderType, "", namespace, name)
+	if err := validateReleaseFileName(name, filename); err != nil {
+		return err
+	}
+
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name)
+	key := path.Join(prefix, filename)
+	cr := newChecksumReader(file)
+	if err := s.upload(ctx, key, cr, false); err != nil {
+		return err
+	}
+	s.storeChecksum(ctx, key, cr.Sum())
+	return nil
+}
+
+// ProviderReleaseFileChecksum returns the checksum of a file of an internal provider release, which was computed during its upload
+func (s *GCSStorage) ProviderReleaseFileChecksum(ctx context.Context, namespace, name, filename string) ([]byte, error) {
+	key := path.Join(providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name), filename)
+	checksum, exists, err := s.objectChecksum(ctx, key)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, core.ErrObjectNotFound
+	}
+	return decodeChecksum(key, checksum)
+}
+
+// LockProviderVersion creates the lock object of an internal provider version with a precondition that it doesn't exist yet
+func (s *GCSStorage) LockProviderVersion(ctx context.Context, namespace, name, version string) error {
+	key := internalProviderLockPath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version)
+	create := func(ctx context.Context, content []byte) error {
+		err := s.upload(ctx, key, bytes.NewReader(content), false)
+		if errors.Is(err, core.ErrObjectAlreadyExists) {
+			return fmt.Errorf("failed to lock %s: %w", key, core.ErrUploadInProgress)
+		}
+		return err
+	}
+	return s.locks.acquire(ctx, key, create, s.readLock(key), s.removeLock(key))
+}
+
+// UnlockProviderVersion deletes the lock object of an internal provider version, if it's still held by this upload
+func (s *GCSStorage) UnlockProviderVersion(ctx context.Context, namespace, name, version string) error {
+	key := internalProviderLockPath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version)
+	return s.locks.release(ctx, key, s.readLock(key), s.removeLock(key))
+}
+
+// readLock returns the content and the generation of a lock object, the content is read from exactly that generation
+func (s *GCSStorage) readLock(key string) readUploadLock {
+	return func(ctx context.Context) ([]byte, string, error) {
+		obj := s.sc.Bucket(s.bucket).Object(key)
+		attrs, err := obj.Attrs(ctx)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, "", core.ErrObjectNotFound
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		r, err := obj.Generation(attrs.Generation).NewReader(ctx)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, "", fmt.Errorf("the lock %s changed while it was read: %w", key, core.ErrUploadInProgress)
+		} else if err != nil {
+			return nil, "", err
+		}
+		defer r.Close()
+
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, "", err
+		}
+		return content, strconv.FormatInt(attrs.Generation, 10), nil
+	}
+}
+
+// removeLock deletes a lock object only if it still has the generation
+func (s *GCSStorage) removeLock(key string) removeUploadLock {
+	return func(ctx context.Context, version string) error {
+		generation, err := strconv.ParseInt(version, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid generation %q of the lock %s: %w", version, key, err)
+		}
+
+		obj := s.sc.Bucket(s.bucket).Object(key).If(storage.Conditions{GenerationMatch: generation})
+		if err := obj.Delete(ctx); err != nil {
+			var apiErr *googleapi.Error
+			if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+				return fmt.Errorf("the lock %s was replaced: %w", key, core.ErrUploadInProgress)
+			}
+			return err
+		}
+		s.existsCache.invalidate(key)
+		return nil
+	}
+}
+
+// DownloadProviderReleaseFile returns a file of an internal provider release, which was uploaded with UploadProviderReleaseFiles
+func (s *GCSStorage) DownloadProviderReleaseFile(ctx context.Context, namespace, name, filename string) ([]byte, error) {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name)
 	key := filepath.Join(prefix, filename)
-	return s.upload(ctx, key, file, false)
+	return s.download(ctx, key)
+}
+
+// StreamProviderReleaseFile writes a file of an internal provider release to w
+func (s *GCSStorage) StreamProviderReleaseFile(ctx context.Context, namespace, name, filename string, w io.Writer) error {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name)
+	key := path.Join(prefix, filename)
+	r, err := s.sc.Bucket(s.bucket).Object(key).NewReader(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer func(r *storage.Reader) {
+		_ = r.Close()
+	}(r)
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// DeleteProviderReleaseFile deletes a file of an internal provider release
+func (s *GCSStorage) DeleteProviderReleaseFile(ctx context.Context, namespace, name, filename string) error {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name)
+	key := path.Join(prefix, filename)
+	if err := s.sc.Bucket(s.bucket).Object(key).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	s.existsCache.invalidate(key)
+	return nil
+}
+
+// ProviderSha256Sums returns the SHA256SUMS file of an internal provider version
+func (s *GCSStorage) ProviderSha256Sums(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	key := internalProviderShasumPath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version)
+	exists, err := s.objectExists(ctx, key)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, core.ErrObjectNotFound
+	}
+	return s.download(ctx, key)
+}
+
+// ProviderDocs returns the metadata.json document of an internal provider version
+func (s *GCSStorage) ProviderDocs(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	key := internalProviderDocsPath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version)
+	exists, err := s.objectExists(ctx, key)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, core.ErrObjectNotFound
+	}
+	return s.download(ctx, key)
+}
+
+// ProviderExists reports whether the archive of an internal provider version exists for the platform
+func (s *GCSStorage) ProviderExists(ctx context.Context, namespace, name, version, os, arch string) (bool, error) {
+	archivePath, _, _ := internalProviderPath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version, os, arch)
+	return s.objectExists(ctx, archivePath)
+}
+
+// ProviderDocsExist reports whether a metadata.json document exists for an internal provider version
+func (s *GCSStorage) ProviderDocsExist(ctx context.Context, namespace, name, version string) (bool, error) {
+	return s.objectExists(ctx, internalProviderDocsPath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version))
 }
 
 func (s *GCSStorage) UploadMirroredFile(ctx context.Context, provider *core.Provider, fileName string, reader io.Reader) error {
-	prefix := providerStoragePrefix(s.bucketPrefix, mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
 
 	key := filepath.Join(prefix, fileName)
 	return s.upload(ctx, key, reader, true)
 }
 
+func (s *GCSStorage) DownloadMirroredFile(ctx context.Context, provider *core.Provider, fileName string) ([]byte, error) {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
+	key := filepath.Join(prefix, fileName)
+	return s.download(ctx, key)
+}
+
+func (s *GCSStorage) ListMirroredFiles(ctx context.Context) ([]string, error) {
+	prefix := mirrorStoragePrefix(scopedPrefix(ctx, s.bucketPrefix))
+	query := &storage.Query{Prefix: prefix}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	it := s.objects(ctx, query)
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, strings.TrimPrefix(attrs.Name, prefix))
+	}
+	return keys, nil
+}
+
+func (s *GCSStorage) DeleteMirroredFile(ctx context.Context, provider *core.Provider, fileName string) error {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
+	key := path.Join(prefix, fileName)
+	if err := s.sc.Bucket(s.bucket).Object(key).Delete(ctx); err != nil {
+		return err
+	}
+	s.existsCache.invalidate(key)
+	return nil
+}
+
 func (s *GCSStorage) signingKeys(ctx context.Context, pt providerType, hostname, namespace string) (*core.SigningKeys, error) {
 	if namespace == "" {
 		return nil, fmt.Errorf("namespace argument is empty")
 	}
-	key := signingKeysPath(s.bucketPrefix, pt, hostname, namespace)
+	return s.signingKeysObject(ctx, signingKeysPath(scopedPrefix(ctx, s.bucketPrefix), pt, hostname, namespace))
+}
+
+// signingKeysObject downloads and unmarshals the signing keys stored under key.
+// It returns core.ErrObjectNotFound if the object doesn't exist.
+func (s *GCSStorage) signingKeysObject(ctx context.Context, key string) (*core.SigningKeys, error) {
 	exists, err := s.objectExists(ctx, key)
 	if err != nil {
 		return nil, err
 	} else if !exists {
 		return nil, core.ErrObjectNotFound
 	}
+
 	signingKeysRaw, err := s.download(ctx, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download signing_keys for namespace %s: %w", namespace, err)
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
 	}
 
 	return unmarshalSigningKeys(signingKeysRaw)
 }
 
+// ProviderSigningKeys returns the signing keys of the provider version, of the provider or of the namespace, whichever are the most specific
+func (s *GCSStorage) ProviderSigningKeys(ctx context.Context, namespace, name, version string) (*core.SigningKeys, error) {
+	return mostSpecificSigningKeys(ctx, providerSigningKeysPaths(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version), s.signingKeysObject)
+}
+
 // SigningKeys downloads the JSON placed in the namespace in GCS and unmarshals it into a core.SigningKeys
 func (s *GCSStorage) SigningKeys(ctx context.Context, namespace string) (*core.SigningKeys, error) {
 	return s.signingKeys(ctx, internalProviderType, "", namespace)
@@ -310,16 +710,21 @@ func (s *GCSStorage) uploadSigningKeys(ctx context.Context, pt providerType, hos
 	if err != nil {
 		return err
 	}
-	key := signingKeysPath(s.bucketPrefix, pt, hostname, namespace)
+	key := signingKeysPath(scopedPrefix(ctx, s.bucketPrefix), pt, hostname, namespace)
 	return s.upload(ctx, key, bytes.NewReader(b), true)
 }
 
+// UploadSigningKeys replaces the signing keys of an internal provider namespace
+func (s *GCSStorage) UploadSigningKeys(ctx context.Context, namespace string, signingKeys *core.SigningKeys) error {
+	return s.uploadSigningKeys(ctx, internalProviderType, "", namespace, signingKeys)
+}
+
 func (s *GCSStorage) UploadMirroredSigningKeys(ctx context.Context, hostname, namespace string, signingKeys *core.SigningKeys) error {
 	return s.uploadSigningKeys(ctx, mirrorProviderType, hostname, namespace, signingKeys)
 }
 
 func (s *GCSStorage) MirroredSha256Sum(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
-	prefix := providerStoragePrefix(s.bucketPrefix, mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
 	key := filepath.Join(prefix, provider.ShasumFileName())
 	shaSumBytes, err := s.download(ctx, key)
 	if err != nil {
@@ -328,6 +733,16 @@ func (s *GCSStorage) MirroredSha256Sum(ctx context.Context, provider *core.Provi
 	return core.NewSha256Sums(provider.ShasumFileName(), bytes.NewReader(shaSumBytes))
 }
 
+// newWriter returns a writer of the object, which applies the predefined ACL of uploaded objects.
+// The bucket default ACL applies to private objects, as buckets with uniform bucket-level access reject object ACLs
+func (s *GCSStorage) newWriter(ctx context.Context, o *storage.ObjectHandle) *storage.Writer {
+	wc := o.NewWriter(ctx)
+	if s.objectACL == ObjectACLPublicRead {
+		wc.PredefinedACL = "publicRead"
+	}
+	return wc
+}
+
 func (s *GCSStorage) upload(ctx context.Context, key string, reader io.Reader, overwrite bool) error {
 	if !overwrite {
 		exists, err := s.objectExists(ctx, key)
@@ -338,11 +753,24 @@ func (s *GCSStorage) upload(ctx context.Context, key string, reader io.Reader, o
 		}
 	}
 
-	wc := s.sc.Bucket(s.bucket).Object(key).NewWriter(ctx)
+	// The client only retries idempotent uploads. Uploads of new objects are made idempotent with a precondition,
+	// while overwriting an object with the same content can be repeated safely
+	o := s.sc.Bucket(s.bucket).Object(key)
+	if overwrite {
+		o = o.Retryer(storage.WithPolicy(storage.RetryAlways))
+	} else {
+		o = o.If(storage.Conditions{DoesNotExist: true})
+	}
+
+	wc := s.newWriter(ctx, o)
 	if _, err := io.Copy(wc, reader); err != nil {
 		return fmt.Errorf("failed to upload object: %w", err)
 	}
 	if err := wc.Close(); err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+			return fmt.Errorf("failed to upload key %s: %w", key, core.ErrObjectAlreadyExists)
+		}
 		return fmt.Errorf("failed to upload object: %w", err)
 	}
 
@@ -375,6 +803,7 @@ func (s *GCSStorage) presignedURL(ctx context.Context, object string) (string, e
 		return "", fmt.Errorf("google.FindDefaultCredentials: %v", err)
 	}
 
+	expiry := s.signedURLHeadroom.expiry(ctx, s.signedURLExpiry)
 	var url string
 	if s.serviceAccount != "" {
 		// needs Service Account Token Creator role
@@ -387,7 +816,7 @@ func (s *GCSStorage) presignedURL(ctx context.Context, object string) (string, e
 			Scheme:         storage.SigningSchemeV4,
 			Method:         "GET",
 			GoogleAccessID: s.serviceAccount,
-			Expires:        time.Now().Add(s.signedURLExpiry),
+			Expires:        time.Now().Add(expiry),
 			SignBytes: func(b []byte) ([]byte, error) {
 				req := &credentialspb.SignBlobRequest{
 					Payload: b,
@@ -413,7 +842,7 @@ func (s *GCSStorage) presignedURL(ctx context.Context, object string) (string, e
 			Method:         "GET",
 			GoogleAccessID: conf.Email,
 			PrivateKey:     conf.PrivateKey,
-			Expires:        time.Now().Add(s.signedURLExpiry),
+			Expires:        time.Now().Add(expiry),
 		}
 		url, err = storage.SignedURL(s.bucket, object, opts)
 		if err != nil {
@@ -424,21 +853,167 @@ func (s *GCSStorage) presignedURL(ctx context.Context, object string) (string, e
 	return url, nil
 }
 
+// InvalidateCache forgets the existence of the objects starting with the prefix, relative to the bucket prefix
+func (s *GCSStorage) InvalidateCache(ctx context.Context, prefix string) int {
+	return s.existsCache.invalidate(keyPrefix(scopedPrefix(ctx, s.bucketPrefix), prefix))
+}
+
+// ListKeys returns up to limit keys of the bucket under the prefix
+func (s *GCSStorage) ListKeys(ctx context.Context, prefix string, limit int) ([]string, error) {
+	query := &storage.Query{
+		Prefix: keyPrefix(scopedPrefix(ctx, s.bucketPrefix), prefix),
+	}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	it := s.objects(ctx, query)
+	for len(keys) < limit {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, attrs.Name)
+	}
+
+	return keys, nil
+}
+
+// ListAllKeys returns the keys of all objects under the bucket prefix, relative to the bucket prefix
+func (s *GCSStorage) ListAllKeys(ctx context.Context) ([]string, error) {
+	prefix := keyPrefix(s.bucketPrefix, "")
+	query := &storage.Query{
+		Prefix: prefix,
+	}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	it := s.objects(ctx, query)
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, strings.TrimPrefix(attrs.Name, prefix))
+	}
+	return keys, nil
+}
+
+// CopyToPrefix copies the object with a Copier, so that the object isn't downloaded.
+// The copy is bound to the generation of the source and verified with the CRC32C checksum, which GCS keeps for every object.
+func (s *GCSStorage) CopyToPrefix(ctx context.Context, key, targetPrefix string) error {
+	src, dst, err := relocationKeys(s.bucketPrefix, targetPrefix, key)
+	if err != nil {
+		return err
+	}
+
+	bucket := s.sc.Bucket(s.bucket)
+	srcAttrs, err := bucket.Object(src).Attrs(ctx)
+	if err != nil {
+		return err
+	}
+
+	copier := bucket.Object(dst).CopierFrom(bucket.Object(src).Generation(srcAttrs.Generation))
+	if s.objectACL == ObjectACLPublicRead {
+		copier.PredefinedACL = "publicRead"
+	}
+	dstAttrs, err := copier.Run(ctx)
+	if err != nil {
+		return err
+	}
+	return verifyCopy(src, dst, "CRC32C checksum", strconv.FormatUint(uint64(srcAttrs.CRC32C), 16), strconv.FormatUint(uint64(dstAttrs.CRC32C), 16))
+}
+
+// DeleteKey deletes the object with the key relative to the bucket prefix
+func (s *GCSStorage) DeleteKey(ctx context.Context, key string) error {
+	return s.sc.Bucket(s.bucket).Object(keyPrefix(s.bucketPrefix, key)).Delete(ctx)
+}
+
+// HealthCheck verifies that the GCS bucket is reachable with the configured credentials.
+// A missing object is not an error, only failing requests are reported.
+func (s *GCSStorage) HealthCheck(ctx context.Context) error {
+	_, err := s.objectExists(ctx, path.Join(s.bucketPrefix, healthCheckKey))
+	return err
+}
+
+func (s *GCSStorage) String() string { return "gcs" }
+
+// objects returns an iterator over the objects of the query, which requests pages of the configured page size
+func (s *GCSStorage) objects(ctx context.Context, query *storage.Query) *storage.ObjectIterator {
+	it := s.sc.Bucket(s.bucket).Objects(ctx, query)
+	if s.pageSize > 0 {
+		it.PageInfo().MaxSize = s.pageSize
+	}
+	return it
+}
+
+// pagerSize returns the page size of paginated listings, which require a page size
+func (s *GCSStorage) pagerSize() int {
+	if s.pageSize > 0 {
+		return s.pageSize
+	}
+	return listPageSize
+}
+
 func (s *GCSStorage) objectExists(ctx context.Context, key string) (bool, error) {
+	_, exists, err := s.objectChecksum(ctx, key)
+	return exists, err
+}
+
+// objectChecksum reports whether the object exists and returns the checksum from its metadata, which is empty if it has none
+func (s *GCSStorage) objectChecksum(ctx context.Context, key string) (string, bool, error) {
+	if checksum, ok := s.existsCache.lookup(key); ok {
+		return checksum, true, nil
+	}
+
 	o := s.sc.Bucket(s.bucket).Object(key)
-	_, err := o.Attrs(ctx)
+	attrs, err := o.Attrs(ctx)
 	if errors.Is(err, storage.ErrObjectNotExist) {
-		return false, nil
+		return "", false, nil
 	} else if err != nil {
-		return false, err
+		return "", false, err
+	}
+	checksum := attrs.Metadata[checksumMetadataKey]
+	s.existsCache.add(key, checksum)
+	return checksum, true, nil
+}
+
+// storeChecksum adds the checksum to the metadata of an uploaded object.
+// A failure is only logged, as the object is complete and verifications fall back to downloading it.
+func (s *GCSStorage) storeChecksum(ctx context.Context, key, checksum string) {
+	o := s.sc.Bucket(s.bucket).Object(key)
+	if _, err := o.Update(ctx, storage.ObjectAttrsToUpdate{Metadata: map[string]string{checksumMetadataKey: checksum}}); err != nil {
+		slog.Warn("failed to store the checksum of the uploaded object", slog.String("key", key), slog.String("err", err.Error()))
+		return
 	}
-	return true, nil
+	s.existsCache.add(key, checksum)
 }
 
+// GetDownloadUrl resolves a proxied URL against the host of the pre-signed URLs, which contain the bucket in the path
 func (s *GCSStorage) GetDownloadUrl(ctx context.Context, url string) (string, error) {
+	if !strings.HasPrefix(url, s.bucket+"/") {
+		return "", fmt.Errorf("url %s is not located in bucket %s", url, s.bucket)
+	}
 	return fmt.Sprintf("https://storage.googleapis.com/%s", url), nil
 }
 
+// WithGCSSignedURLHeadroom configures the minimum expiry of the signed urls of proxied downloads.
+// The nearExpiry counter is incremented whenever a shorter expiry is extended, it can be nil.
+func WithGCSSignedURLHeadroom(headroom time.Duration, nearExpiry prometheus.Counter) GCSStorageOption {
+	return func(s *GCSStorage) {
+		s.signedURLHeadroom = signedURLHeadroom{min: headroom, nearExpiry: nearExpiry}
+	}
+}
+
 // GCSStorageOption provides additional options for the GCSStorage.
 type GCSStorageOption func(*GCSStorage)
 
@@ -470,20 +1045,62 @@ func WithGCSArchiveFormat(archiveFormat string) GCSStorageOption {
 	}
 }
 
+// WithGCSExistenceCacheTTL configures how long the existence of an object is cached. A zero TTL disables the cache
+func WithGCSExistenceCacheTTL(ttl time.Duration) GCSStorageOption {
+	return func(s *GCSStorage) {
+		s.existsCache = newExistenceCache(ttl)
+	}
+}
+
+// WithGCSObjectACL configures the ACL of uploaded objects, either private or public-read
+func WithGCSObjectACL(acl string) GCSStorageOption {
+	return func(s *GCSStorage) {
+		s.objectACL = acl
+	}
+}
+
+// WithGCSDefaultSigningKeysNamespace configures the namespace whose signing keys are served for providers of namespaces without signing keys
+func WithGCSDefaultSigningKeysNamespace(namespace string) GCSStorageOption {
+	return func(s *GCSStorage) {
+		s.signingKeysFallback = namespace
+	}
+}
+
+// WithGCSRetryMaxAttempts configures the number of attempts for requests failing with transient errors
+func WithGCSRetryMaxAttempts(attempts int) GCSStorageOption {
+	return func(s *GCSStorage) {
+		s.retry.maxAttempts = attempts
+	}
+}
+
+// WithGCSListPageSize configures the page size of the listings, which aren't limited otherwise. A zero page size keeps the default of GCS
+func WithGCSListPageSize(size int) GCSStorageOption {
+	return func(s *GCSStorage) {
+		s.pageSize = size
+	}
+}
+
 func NewGCSStorage(bucket string, options ...GCSStorageOption) (*GCSStorage, error) {
 	ctx := context.Background()
 	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return newGCSStorage(client, bucket, options...), nil
+}
+
+func newGCSStorage(client *storage.Client, bucket string, options ...GCSStorageOption) *GCSStorage {
 	s := &GCSStorage{
-		sc:     client,
-		bucket: bucket,
+		sc:          client,
+		bucket:      bucket,
+		existsCache: newExistenceCache(DefaultExistenceCacheTTL),
+		retry:       defaultRetryConfig(),
 	}
 
 	for _, option := range options {
 		option(s)
 	}
 
-	return s, nil
+	client.SetRetry(s.retry.gcsOptions()...)
+	return s
 }
@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/module"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+	"github.com/boring-registry/boring-registry/pkg/provider"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// instrumentedStorage records the outcome and the duration of every operation of the wrapped Storage
+type instrumentedStorage struct {
+	next    Storage
+	backend string
+	metrics *o11y.StorageMetrics
+}
+
+// NewInstrumentedStorage wraps the Storage to record the operations with the backend label set to the name of the Storage.
+// Missing objects are recorded with the not_found outcome, so that they can be told apart from failures of the backend.
+func NewInstrumentedStorage(s Storage, metrics *o11y.StorageMetrics) Storage {
+	return &instrumentedStorage{
+		next:    s,
+		backend: s.String(),
+		metrics: metrics,
+	}
+}
+
+func (s *instrumentedStorage) observe(operation string, start time.Time, err *error) {
+	labels := prometheus.Labels{
+		o11y.BackendLabel:   s.backend,
+		o11y.OperationLabel: operation,
+		o11y.OutcomeLabel:   outcome(*err),
+	}
+	s.metrics.Operations.With(labels).Inc()
+	s.metrics.Duration.With(labels).Observe(time.Since(start).Seconds())
+}
+
+// outcome classifies the error of an operation
+func outcome(err error) string {
+	if err == nil {
+		return o11y.OutcomeSuccess
+	}
+
+	var providerError *core.ProviderError
+	if errors.Is(err, core.ErrObjectNotFound) ||
+		errors.Is(err, module.ErrModuleNotFound) ||
+		errors.Is(err, provider.ErrProviderNotFound) ||
+		(errors.As(err, &providerError) && providerError.StatusCode == http.StatusNotFound) {
+		return o11y.OutcomeNotFound
+	}
+	return o11y.OutcomeError
+}
+
+func (s *instrumentedStorage) GetModule(ctx context.Context, namespace, name, provider, version string) (m core.Module, err error) {
+	defer s.observe("get_module", time.Now(), &err)
+	return s.next.GetModule(ctx, namespace, name, provider, version)
+}
+
+func (s *instrumentedStorage) ListModuleVersions(ctx context.Context, namespace, name, provider string) (m []core.Module, err error) {
+	defer s.observe("list_module_versions", time.Now(), &err)
+	return s.next.ListModuleVersions(ctx, namespace, name, provider)
+}
+
+func (s *instrumentedStorage) ModuleExists(ctx context.Context, namespace, name, provider, version string) (exists bool, err error) {
+	defer s.observe("module_exists", time.Now(), &err)
+	return s.next.ModuleExists(ctx, namespace, name, provider, version)
+}
+
+func (s *instrumentedStorage) ListModulesByProvider(ctx context.Context, provider string, limit int, token string) (m []core.Module, next string, err error) {
+	defer s.observe("list_modules_by_provider", time.Now(), &err)
+	return s.next.ListModulesByProvider(ctx, provider, limit, token)
+}
+
+func (s *instrumentedStorage) UploadModule(ctx context.Context, namespace, name, provider, version string, body io.Reader) (m core.Module, err error) {
+	defer s.observe("upload_module", time.Now(), &err)
+	return s.next.UploadModule(ctx, namespace, name, provider, version, body)
+}
+
+func (s *instrumentedStorage) GetProvider(ctx context.Context, namespace, name, version, os, arch string) (p *core.Provider, err error) {
+	defer s.observe("get_provider", time.Now(), &err)
+	return s.next.GetProvider(ctx, namespace, name, version, os, arch)
+}
+
+func (s *instrumentedStorage) ListProviderVersions(ctx context.Context, namespace, name string) (v *core.ProviderVersions, err error) {
+	defer s.observe("list_provider_versions", time.Now(), &err)
+	return s.next.ListProviderVersions(ctx, namespace, name)
+}
+
+func (s *instrumentedStorage) ListProviderPlatforms(ctx context.Context, namespace, name, version string) (p []core.Platform, err error) {
+	defer s.observe("list_provider_platforms", time.Now(), &err)
+	return s.next.ListProviderPlatforms(ctx, namespace, name, version)
+}
+
+func (s *instrumentedStorage) ListProviderVersionsPage(ctx context.Context, namespace, name string, limit int, token string) (v *core.ProviderVersions, next string, err error) {
+	defer s.observe("list_provider_versions_page", time.Now(), &err)
+	return s.next.ListProviderVersionsPage(ctx, namespace, name, limit, token)
+}
+
+func (s *instrumentedStorage) UploadProviderReleaseFiles(ctx context.Context, namespace, name, filename string, file io.Reader) (err error) {
+	defer s.observe("upload_provider_release_files", time.Now(), &err)
+	return s.next.UploadProviderReleaseFiles(ctx, namespace, name, filename, file)
+}
+
+func (s *instrumentedStorage) LockProviderVersion(ctx context.Context, namespace, name, version string) (err error) {
+	defer s.observe("lock_provider_version", time.Now(), &err)
+	return s.next.LockProviderVersion(ctx, namespace, name, version)
+}
+
+func (s *instrumentedStorage) UnlockProviderVersion(ctx context.Context, namespace, name, version string) (err error) {
+	defer s.observe("unlock_provider_version", time.Now(), &err)
+	return s.next.UnlockProviderVersion(ctx, namespace, name, version)
+}
+
+func (s *instrumentedStorage) DownloadProviderReleaseFile(ctx context.Context, namespace, name, filename string) (b []byte, err error) {
+	defer s.observe("download_provider_release_file", time.Now(), &err)
+	return s.next.DownloadProviderReleaseFile(ctx, namespace, name, filename)
+}
+
+func (s *instrumentedStorage) StreamProviderReleaseFile(ctx context.Context, namespace, name, filename string, w io.Writer) (err error) {
+	defer s.observe("stream_provider_release_file", time.Now(), &err)
+	return s.next.StreamProviderReleaseFile(ctx, namespace, name, filename, w)
+}
+
+func (s *instrumentedStorage) DeleteProviderReleaseFile(ctx context.Context, namespace, name, filename string) (err error) {
+	defer s.observe("delete_provider_release_file", time.Now(), &err)
+	return s.next.DeleteProviderReleaseFile(ctx, namespace, name, filename)
+}
+
+func (s *instrumentedStorage) ProviderReleaseFileChecksum(ctx context.Context, namespace, name, filename string) (b []byte, err error) {
+	defer s.observe("provider_release_file_checksum", time.Now(), &err)
+	return s.next.ProviderReleaseFileChecksum(ctx, namespace, name, filename)
+}
+
+func (s *instrumentedStorage) ProviderSha256Sums(ctx context.Context, namespace, name, version string) (b []byte, err error) {
+	defer s.observe("provider_sha256_sums", time.Now(), &err)
+	return s.next.ProviderSha256Sums(ctx, namespace, name, version)
+}
+
+func (s *instrumentedStorage) ProviderDocs(ctx context.Context, namespace, name, version string) (b []byte, err error) {
+	defer s.observe("provider_docs", time.Now(), &err)
+	return s.next.ProviderDocs(ctx, namespace, name, version)
+}
+
+func (s *instrumentedStorage) ProviderExists(ctx context.Context, namespace, name, version, os, arch string) (exists bool, err error) {
+	defer s.observe("provider_exists", time.Now(), &err)
+	return s.next.ProviderExists(ctx, namespace, name, version, os, arch)
+}
+
+func (s *instrumentedStorage) ProviderDocsExist(ctx context.Context, namespace, name, version string) (exists bool, err error) {
+	defer s.observe("provider_docs_exist", time.Now(), &err)
+	return s.next.ProviderDocsExist(ctx, namespace, name, version)
+}
+
+func (s *instrumentedStorage) SigningKeys(ctx context.Context, namespace string) (k *core.SigningKeys, err error) {
+	defer s.observe("signing_keys", time.Now(), &err)
+	return s.next.SigningKeys(ctx, namespace)
+}
+
+func (s *instrumentedStorage) ProviderSigningKeys(ctx context.Context, namespace, name, version string) (k *core.SigningKeys, err error) {
+	defer s.observe("provider_signing_keys", time.Now(), &err)
+	return s.next.ProviderSigningKeys(ctx, namespace, name, version)
+}
+
+func (s *instrumentedStorage) UploadSigningKeys(ctx context.Context, namespace string, signingKeys *core.SigningKeys) (err error) {
+	defer s.observe("upload_signing_keys", time.Now(), &err)
+	return s.next.UploadSigningKeys(ctx, namespace, signingKeys)
+}
+
+func (s *instrumentedStorage) ListMirroredProviders(ctx context.Context, provider *core.Provider) (p []*core.Provider, err error) {
+	defer s.observe("list_mirrored_providers", time.Now(), &err)
+	return s.next.ListMirroredProviders(ctx, provider)
+}
+
+func (s *instrumentedStorage) ListAllMirroredProviders(ctx context.Context) (p []*core.Provider, err error) {
+	defer s.observe("list_all_mirrored_providers", time.Now(), &err)
+	return s.next.ListAllMirroredProviders(ctx)
+}
+
+func (s *instrumentedStorage) GetMirroredProvider(ctx context.Context, provider *core.Provider) (p *core.Provider, err error) {
+	defer s.observe("get_mirrored_provider", time.Now(), &err)
+	return s.next.GetMirroredProvider(ctx, provider)
+}
+
+func (s *instrumentedStorage) UploadMirroredFile(ctx context.Context, provider *core.Provider, fileName string, reader io.Reader) (err error) {
+	defer s.observe("upload_mirrored_file", time.Now(), &err)
+	return s.next.UploadMirroredFile(ctx, provider, fileName, reader)
+}
+
+func (s *instrumentedStorage) DownloadMirroredFile(ctx context.Context, provider *core.Provider, fileName string) (b []byte, err error) {
+	defer s.observe("download_mirrored_file", time.Now(), &err)
+	return s.next.DownloadMirroredFile(ctx, provider, fileName)
+}
+
+func (s *instrumentedStorage) ListMirroredFiles(ctx context.Context) (keys []string, err error) {
+	defer s.observe("list_mirrored_files", time.Now(), &err)
+	return s.next.ListMirroredFiles(ctx)
+}
+
+func (s *instrumentedStorage) DeleteMirroredFile(ctx context.Context, provider *core.Provider, fileName string) (err error) {
+	defer s.observe("delete_mirrored_file", time.Now(), &err)
+	return s.next.DeleteMirroredFile(ctx, provider, fileName)
+}
+
+func (s *instrumentedStorage) MirroredSigningKeys(ctx context.Context, hostname, namespace string) (k *core.SigningKeys, err error) {
+	defer s.observe("mirrored_signing_keys", time.Now(), &err)
+	return s.next.MirroredSigningKeys(ctx, hostname, namespace)
+}
+
+func (s *instrumentedStorage) UploadMirroredSigningKeys(ctx context.Context, hostname, namespace string, signingKeys *core.SigningKeys) (err error) {
+	defer s.observe("upload_mirrored_signing_keys", time.Now(), &err)
+	return s.next.UploadMirroredSigningKeys(ctx, hostname, namespace, signingKeys)
+}
+
+func (s *instrumentedStorage) MirroredSha256Sum(ctx context.Context, provider *core.Provider) (sums *core.Sha256Sums, err error) {
+	defer s.observe("mirrored_sha256_sum", time.Now(), &err)
+	return s.next.MirroredSha256Sum(ctx, provider)
+}
+
+func (s *instrumentedStorage) GetDownloadUrl(ctx context.Context, url string) (u string, err error) {
+	defer s.observe("get_download_url", time.Now(), &err)
+	return s.next.GetDownloadUrl(ctx, url)
+}
+
+func (s *instrumentedStorage) ListAllModules(ctx context.Context) (m []core.Module, err error) {
+	defer s.observe("list_all_modules", time.Now(), &err)
+	return s.next.ListAllModules(ctx)
+}
+
+func (s *instrumentedStorage) ListAllProviders(ctx context.Context) (p []*core.Provider, err error) {
+	defer s.observe("list_all_providers", time.Now(), &err)
+	return s.next.ListAllProviders(ctx)
+}
+
+func (s *instrumentedStorage) ListKeys(ctx context.Context, prefix string, limit int) (keys []string, err error) {
+	defer s.observe("list_keys", time.Now(), &err)
+	return s.next.ListKeys(ctx, prefix, limit)
+}
+
+func (s *instrumentedStorage) ListAllKeys(ctx context.Context) (keys []string, err error) {
+	defer s.observe("list_all_keys", time.Now(), &err)
+	return s.next.ListAllKeys(ctx)
+}
+
+func (s *instrumentedStorage) CopyToPrefix(ctx context.Context, key, targetPrefix string) (err error) {
+	defer s.observe("copy_to_prefix", time.Now(), &err)
+	return s.next.CopyToPrefix(ctx, key, targetPrefix)
+}
+
+func (s *instrumentedStorage) DeleteKey(ctx context.Context, key string) (err error) {
+	defer s.observe("delete_key", time.Now(), &err)
+	return s.next.DeleteKey(ctx, key)
+}
+
+// InvalidateCache isn't recorded, as it doesn't reach the storage backend
+func (s *instrumentedStorage) InvalidateCache(ctx context.Context, prefix string) int {
+	return s.next.InvalidateCache(ctx, prefix)
+}
+
+func (s *instrumentedStorage) HealthCheck(ctx context.Context) (err error) {
+	defer s.observe("health_check", time.Now(), &err)
+	return s.next.HealthCheck(ctx)
+}
+
+func (s *instrumentedStorage) String() string {
+	return s.next.String()
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/module"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	assertion "github.com/stretchr/testify/assert"
+)
+
+type erroringStorage struct {
+	Storage
+	err error
+}
+
+func (s *erroringStorage) GetModule(_ context.Context, _, _, _, _ string) (core.Module, error) {
+	return core.Module{}, s.err
+}
+
+func (s *erroringStorage) GetProvider(_ context.Context, _, _, _, _, _ string) (*core.Provider, error) {
+	return nil, s.err
+}
+
+func (s *erroringStorage) String() string { return "s3" }
+
+func testStorageMetrics() *o11y.StorageMetrics {
+	labels := []string{o11y.BackendLabel, o11y.OperationLabel, o11y.OutcomeLabel}
+	return &o11y.StorageMetrics{
+		Operations: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "operations_total"}, labels),
+		Duration:   prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "operation_duration_seconds"}, labels),
+	}
+}
+
+func TestInstrumentedStorage_outcome(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		call        func(s Storage) error
+		operation   string
+		wantOutcome string
+	}{
+		{
+			name: "success",
+			call: func(s Storage) error {
+				_, err := s.GetModule(context.Background(), "acme", "vpc", "aws", "1.0.0")
+				return err
+			},
+			operation:   "get_module",
+			wantOutcome: o11y.OutcomeSuccess,
+		},
+		{
+			name: "module not found",
+			err:  module.ErrModuleNotFound,
+			call: func(s Storage) error {
+				_, err := s.GetModule(context.Background(), "acme", "vpc", "aws", "1.0.0")
+				return err
+			},
+			operation:   "get_module",
+			wantOutcome: o11y.OutcomeNotFound,
+		},
+		{
+			name: "provider not found",
+			err:  noMatchingProviderFound(&core.Provider{Namespace: "acme", Name: "dummy"}),
+			call: func(s Storage) error {
+				_, err := s.GetProvider(context.Background(), "acme", "dummy", "1.0.0", "linux", "amd64")
+				return err
+			},
+			operation:   "get_provider",
+			wantOutcome: o11y.OutcomeNotFound,
+		},
+		{
+			name: "hard error",
+			err:  errors.New("connection reset by peer"),
+			call: func(s Storage) error {
+				_, err := s.GetProvider(context.Background(), "acme", "dummy", "1.0.0", "linux", "amd64")
+				return err
+			},
+			operation:   "get_provider",
+			wantOutcome: o11y.OutcomeError,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := testStorageMetrics()
+			s := NewInstrumentedStorage(&erroringStorage{err: tc.err}, metrics)
+
+			err := tc.call(s)
+			assertion.ErrorIs(t, err, tc.err)
+
+			assertion.Equal(t, 1, testutil.CollectAndCount(metrics.Operations))
+			assertion.Equal(t, 1.0, testutil.ToFloat64(metrics.Operations.WithLabelValues("s3", tc.operation, tc.wantOutcome)))
+			assertion.Equal(t, 1, testutil.CollectAndCount(metrics.Duration))
+		})
+	}
+}
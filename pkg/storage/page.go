@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/boring-registry/boring-registry/pkg/catalog"
+	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/module"
+)
+
+// listPageSize is the number of keys requested per page from the storage backends that require a page size
+const listPageSize = 1000
+
+// MaxListPageSize is the largest number of keys that S3 and GCS return per page
+const MaxListPageSize = 1000
+
+// ValidateListPageSize returns an error if the page size of listings is out of bounds.
+// A page size of 0 keeps the default page size of the storage backend.
+func ValidateListPageSize(size int) error {
+	if size < 0 || size > MaxListPageSize {
+		return fmt.Errorf("the list page size %d must be between 0 and %d", size, MaxListPageSize)
+	}
+	return nil
+}
+
+// listObjectsPage returns a single page of keys of the storage backend, starting at the continuation token of the backend.
+// The returned continuation token is empty on the last page.
+type listObjectsPage func(ctx context.Context, continuation string) (keys []string, next string, err error)
+
+// providerVersionsToken resumes a paginated listing of provider versions.
+// The listing of the storage backend is resumed at the page that contains the first version of the next page,
+// the keys up to and including After have already been returned.
+type providerVersionsToken struct {
+	Continuation string `json:"c,omitempty"`
+	After        string `json:"a"`
+}
+
+func (t providerVersionsToken) encode() string {
+	b, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeProviderVersionsToken(token string) (providerVersionsToken, error) {
+	var t providerVersionsToken
+	if token == "" {
+		return t, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return t, catalog.ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &t); err != nil || t.After == "" {
+		return t, catalog.ErrInvalidCursor
+	}
+	return t, nil
+}
+
+// listProviderVersionsPage returns up to limit versions in the order of the keys, with all platforms of each version.
+// A page never ends within the platforms of a version, so that the pages don't overlap.
+func listProviderVersionsPage(ctx context.Context, provider *core.Provider, limit int, token string, list listObjectsPage) (*core.ProviderVersions, string, error) {
+	t, err := decodeProviderVersionsToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	versions := &core.ProviderVersions{Versions: []core.ProviderVersion{}}
+	index := make(map[string]int)
+	continuation := t.Continuation
+	last := t.After
+	for {
+		keys, next, err := list(ctx, continuation)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, key := range keys {
+			if key <= t.After {
+				continue
+			}
+
+			p, err := core.NewProviderFromArchive(path.Base(key))
+			if err == nil {
+				i, ok := index[p.Version]
+				if !ok && len(versions.Versions) == limit {
+					// The listing is resumed at the current page of the backend, as it contains the first version of the next page
+					return versions, providerVersionsToken{Continuation: continuation, After: last}.encode(), nil
+				}
+				if !ok {
+					i = len(versions.Versions)
+					index[p.Version] = i
+					versions.Versions = append(versions.Versions, core.ProviderVersion{
+						Namespace: provider.Namespace,
+						Name:      provider.Name,
+						Version:   p.Version,
+					})
+				}
+				versions.Versions[i].Platforms = append(versions.Versions[i].Platforms, core.Platform{OS: p.OS, Arch: p.Arch})
+			}
+			last = key
+		}
+
+		if next == "" {
+			break
+		}
+		continuation = next
+	}
+
+	if token == "" && len(versions.Versions) == 0 {
+		return nil, "", noMatchingProviderFound(provider)
+	}
+	return versions, "", nil
+}
+
+// listCommonPrefixes returns the common prefixes directly below the prefix, as listed with the "/" delimiter
+type listCommonPrefixes func(ctx context.Context, prefix string) ([]string, error)
+
+// prefixExists reports whether at least one object exists below the prefix
+type prefixExists func(ctx context.Context, prefix string) (bool, error)
+
+// maxModuleProbes is the maximum number of requests to the storage backend for a page of modules of a provider,
+// so that a provider with few modules doesn't make a single request scan the whole storage backend
+const maxModuleProbes = 500
+
+// listModulesByProvider returns up to limit modules of the provider, which are ordered by namespace and name.
+// Only the namespaces and module names are listed with the delimiter, the versions are never listed.
+// A page ends early after maxModuleProbes requests, so pages can contain fewer modules than the limit, or none, and still have a next page.
+// The token is the base64 encoded <namespace>/<name> of the last module that was checked for the previous page.
+func listModulesByProvider(ctx context.Context, modulesPrefix, provider string, limit int, token string, list listCommonPrefixes, exists prefixExists) ([]core.Module, string, error) {
+	after, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: cursor", module.ErrInvalidQuery)
+	}
+	afterNamespace, afterName, _ := strings.Cut(string(after), "/")
+
+	dirs := func(prefix string) ([]string, error) {
+		prefixes, err := list(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", module.ErrModuleListFailed, err)
+		}
+		names := make([]string, 0, len(prefixes))
+		for _, p := range prefixes {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/"))
+		}
+		slices.Sort(names)
+		return names, nil
+	}
+
+	namespaces, err := dirs(modulesPrefix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	modules := []core.Module{}
+	probes := 1
+	for _, namespace := range namespaces {
+		if namespace < afterNamespace {
+			continue
+		}
+		if probes >= maxModuleProbes {
+			return modules, moduleCursor(namespace, ""), nil
+		}
+		names, err := dirs(modulesPrefix + namespace + "/")
+		if err != nil {
+			return nil, "", err
+		}
+		probes++
+
+		checked := ""
+		for _, name := range names {
+			if namespace == afterNamespace && name <= afterName {
+				checked = name
+				continue
+			}
+			if probes >= maxModuleProbes {
+				return modules, moduleCursor(namespace, checked), nil
+			}
+			probes++
+			checked = name
+			ok, err := exists(ctx, fmt.Sprintf("%s%s/%s/%s/", modulesPrefix, namespace, name, provider))
+			if err != nil {
+				return nil, "", fmt.Errorf("%v: %w", module.ErrModuleListFailed, err)
+			}
+			if !ok {
+				continue
+			}
+
+			if len(modules) == limit {
+				last := modules[len(modules)-1]
+				return modules, moduleCursor(last.Namespace, last.Name), nil
+			}
+			modules = append(modules, core.Module{Namespace: namespace, Name: name, Provider: provider})
+		}
+	}
+	return modules, "", nil
+}
+
+// moduleCursor returns the token that resumes the listing after the module name of the namespace.
+// An empty name resumes the listing at the first module of the namespace.
+func moduleCursor(namespace, name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(namespace + "/" + name))
+}
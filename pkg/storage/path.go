@@ -2,12 +2,14 @@ package storage
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"path"
 	"strings"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/provider"
 )
 
 const (
@@ -40,6 +42,12 @@ func providerStoragePrefix(prefix string, t providerType, hostname, namespace, n
 	return path.Clean(path.Join(prefix, string(t), hostname, namespace, name))
 }
 
+// providerVersionPrefix returns the prefix of the files of a single provider version,
+// e.g. <prefix>/providers/<namespace>/<name>/terraform-provider-<name>_<version>_
+func providerVersionPrefix(prefix string, t providerType, hostname, namespace, name, version string) string {
+	return path.Join(providerStoragePrefix(prefix, t, hostname, namespace, name), fmt.Sprintf("%s%s_%s_", core.ProviderPrefix, name, version))
+}
+
 // internal function
 func providerPath(prefix string, t providerType, hostname, namespace, name, version, os, arch string) (string, string, string) {
 	provider := core.Provider{
@@ -58,11 +66,60 @@ func internalProviderPath(prefix, namespace, name, version, os, arch string) (st
 	return providerPath(prefix, internalProviderType, "", namespace, name, version, os, arch)
 }
 
+// internalProviderShasumPath returns a full path to the SHA256SUMS file of an internal provider version
+func internalProviderShasumPath(prefix, namespace, name, version string) string {
+	_, shasumPath, _ := internalProviderPath(prefix, namespace, name, version, "", "")
+	return shasumPath
+}
+
+// internalProviderLockPath returns a full path to the upload lock of an internal provider version
+func internalProviderLockPath(prefix, namespace, name, version string) string {
+	return providerVersionPrefix(prefix, internalProviderType, "", namespace, name, version) + "upload.lock"
+}
+
+// internalProviderDocsPath returns a full path to the metadata.json document of an internal provider version
+func internalProviderDocsPath(prefix, namespace, name, version string) string {
+	provider := core.Provider{
+		Name:    name,
+		Version: version,
+	}
+	return path.Join(providerStoragePrefix(prefix, internalProviderType, "", namespace, name), provider.DocsFileName())
+}
+
 // mirrorProviderPath returns a full path to a mirrored provider archive
 func mirrorProviderPath(prefix, hostname, namespace, name, version, os, arch string) (string, string, string) {
 	return providerPath(prefix, mirrorProviderType, hostname, namespace, name, version, os, arch)
 }
 
+// releaseFileSuffixes are the suffixes of the files of a provider release besides the archives,
+// which are named terraform-provider-<name>_<version><suffix>
+var releaseFileSuffixes = []string{"_SHA256SUMS", "_SHA256SUMS.sig", "_metadata.json", "_manifest.json"}
+
+// validateReleaseFileName rejects file names of a provider release that would leave the directory of the provider,
+// e.g. ../signing-keys.json, and names that don't follow the naming convention of the provider
+func validateReleaseFileName(name, filename string) error {
+	if filename == "" || filename == "." || filename == ".." || strings.ContainsAny(filename, `/\`) || strings.Contains(filename, "..") {
+		return fmt.Errorf("%w: %q must be a plain file name", provider.ErrInvalidFileName, filename)
+	}
+
+	if p, err := core.NewProviderFromArchive(filename); err == nil {
+		if p.Name != name || p.Version == "" || p.OS == "" || p.Arch == "" {
+			return fmt.Errorf("%w: %s isn't an archive of the provider %s", provider.ErrInvalidFileName, filename, name)
+		}
+		return nil
+	}
+
+	rest, ok := strings.CutPrefix(filename, core.ProviderPrefix+name+"_")
+	if ok {
+		for _, suffix := range releaseFileSuffixes {
+			if version, ok := strings.CutSuffix(rest, suffix); ok && version != "" && !strings.Contains(version, "_") {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: %s doesn't follow the terraform-provider-%s_<version> naming convention", provider.ErrInvalidFileName, filename, name)
+}
+
 // modulePathPrefix returns a <prefix>/modules/<namespace>/<name>/<provider> prefix
 func modulePathPrefix(prefix, namespace, name, provider string) string {
 	return path.Join(prefix, string(internalModuleType), namespace, name, provider)
@@ -73,6 +130,77 @@ func modulePath(prefix, namespace, name, provider, version, archiveFormat string
 	return path.Join(modulePathPrefix(prefix, namespace, name, provider), f)
 }
 
+// moduleStoragePrefix returns the <prefix>/modules/ prefix under which all modules are stored
+func moduleStoragePrefix(prefix string) string {
+	return fmt.Sprintf("%s/", path.Join(prefix, string(internalModuleType)))
+}
+
+// keyPrefix returns the prefix relative to the bucket prefix.
+// It's not cleaned like the other paths, so that a trailing slash is kept and ".." can't leave the bucket prefix.
+func keyPrefix(bucketPrefix, prefix string) string {
+	if bucketPrefix == "" {
+		return prefix
+	}
+	return strings.TrimSuffix(bucketPrefix, "/") + "/" + strings.TrimPrefix(prefix, "/")
+}
+
+// truncateKeys returns at most limit keys
+func truncateKeys(keys []string, limit int) []string {
+	if len(keys) > limit {
+		return keys[:limit]
+	}
+	return keys
+}
+
+// internalStoragePrefix returns the <prefix>/providers/ prefix under which all internal providers are stored
+func internalStoragePrefix(prefix string) string {
+	return fmt.Sprintf("%s/", path.Join(prefix, string(internalProviderType)))
+}
+
+// internalProviderFromObject parses a key in the form of <internal_prefix><namespace>/<name>/<archive> into a core.Provider
+func internalProviderFromObject(internalPrefix, key string) (*core.Provider, error) {
+	parts := strings.Split(strings.TrimPrefix(key, internalPrefix), "/")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("provider key is invalid: expected 3 parts, but was %d", len(parts))
+	}
+
+	p, err := core.NewProviderFromArchive(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	if p.Name != parts[1] {
+		return nil, fmt.Errorf("provider key is invalid: provider name %s doesn't match directory %s", p.Name, parts[1])
+	}
+
+	p.Namespace = parts[0]
+	return &p, nil
+}
+
+// mirrorStoragePrefix returns the <prefix>/mirror/providers/ prefix under which all mirrored providers are stored
+func mirrorStoragePrefix(prefix string) string {
+	return fmt.Sprintf("%s/", path.Join(prefix, string(mirrorProviderType)))
+}
+
+// mirroredProviderFromObject parses a key in the form of <mirror_prefix><hostname>/<namespace>/<name>/<archive> into a core.Provider
+func mirroredProviderFromObject(mirrorPrefix, key string) (*core.Provider, error) {
+	parts := strings.Split(strings.TrimPrefix(key, mirrorPrefix), "/")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("mirrored provider key is invalid: expected 4 parts, but was %d", len(parts))
+	}
+
+	p, err := core.NewProviderFromArchive(parts[3])
+	if err != nil {
+		return nil, err
+	}
+	if p.Name != parts[2] {
+		return nil, fmt.Errorf("mirrored provider key is invalid: provider name %s doesn't match directory %s", p.Name, parts[2])
+	}
+
+	p.Hostname = parts[0]
+	p.Namespace = parts[1]
+	return &p, nil
+}
+
 func signingKeysPath(prefix string, pt providerType, hostname, namespace string) string {
 	return path.Join(
 		prefix,
@@ -83,6 +211,17 @@ func signingKeysPath(prefix string, pt providerType, hostname, namespace string)
 	)
 }
 
+// providerSigningKeysPaths returns the paths of the signing keys of an internal provider version from the most to the least specific,
+// <prefix>/providers/<namespace>/<name>/terraform-provider-<name>_<version>_signing-keys.json,
+// <prefix>/providers/<namespace>/<name>/signing-keys.json and <prefix>/providers/<namespace>/signing-keys.json
+func providerSigningKeysPaths(prefix, namespace, name, version string) []string {
+	return []string{
+		providerVersionPrefix(prefix, internalProviderType, "", namespace, name, version) + "signing-keys.json",
+		path.Join(providerStoragePrefix(prefix, internalProviderType, "", namespace, name), "signing-keys.json"),
+		signingKeysPath(prefix, internalProviderType, "", namespace),
+	}
+}
+
 func readSHASums(r io.Reader, name string) (string, error) {
 	scanner := bufio.NewScanner(r)
 
@@ -142,3 +281,11 @@ func moduleFromObject(key string, fileExtension string) (*core.Module, error) {
 		Version:   version,
 	}, nil
 }
+
+// scopedPrefix returns the prefix of the storage backend, followed by the prefix of the virtual registry of the request
+func scopedPrefix(ctx context.Context, prefix string) string {
+	if p := core.StoragePrefix(ctx); p != "" {
+		return path.Join(prefix, p)
+	}
+	return prefix
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/provider"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -103,6 +104,11 @@ func TestProviderPath(t *testing.T) {
 	}
 }
 
+func TestProviderVersionPrefix(t *testing.T) {
+	assert.Equal(t, "providers/hashicorp/aws/terraform-provider-aws_5.0.0_", providerVersionPrefix("", internalProviderType, "", "hashicorp", "aws", "5.0.0"))
+	assert.Equal(t, "registry/mirror/providers/registry.terraform.io/hashicorp/aws/terraform-provider-aws_5.0.0_", providerVersionPrefix("registry", mirrorProviderType, "registry.terraform.io", "hashicorp", "aws", "5.0.0"))
+}
+
 func TestSigningKeysPath(t *testing.T) {
 	t.Parallel()
 
@@ -140,6 +146,42 @@ func TestSigningKeysPath(t *testing.T) {
 	}
 }
 
+func TestValidateReleaseFileName(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		filename string
+		wantErr  bool
+	}{
+		{filename: "terraform-provider-random_2.0.0_linux_amd64.zip"},
+		{filename: "terraform-provider-random_2.0.0_SHA256SUMS"},
+		{filename: "terraform-provider-random_2.0.0_SHA256SUMS.sig"},
+		{filename: "terraform-provider-random_2.0.0_metadata.json"},
+		{filename: "terraform-provider-random_2.0.0_manifest.json"},
+		{filename: "", wantErr: true},
+		{filename: "..", wantErr: true},
+		{filename: "../../signing-keys.json", wantErr: true},
+		{filename: "/terraform-provider-random_2.0.0_linux_amd64.zip", wantErr: true},
+		{filename: "linux/terraform-provider-random_2.0.0_linux_amd64.zip", wantErr: true},
+		{filename: `..\terraform-provider-random_2.0.0_SHA256SUMS`, wantErr: true},
+		{filename: "terraform-provider-random_2.0.0..zip", wantErr: true},
+		{filename: "terraform-provider-aws_5.0.0_linux_amd64.zip", wantErr: true},
+		{filename: "signing-keys.json", wantErr: true},
+		{filename: "terraform-provider-random__SHA256SUMS", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.filename, func(t *testing.T) {
+			err := validateReleaseFileName("random", tc.filename)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, provider.ErrInvalidFileName)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
 func TestReadSHASums(t *testing.T) {
 	t.Parallel()
 
@@ -281,6 +323,24 @@ func TestModuleFromObject(t *testing.T) {
 			fileExtension: "tar.gz",
 			expectedError: true,
 		},
+		{
+			annotation:    "valid key with zstd archive",
+			key:           "/boring-registry/modules/hashicorp/consul/aws/hashicorp-consul-aws-0.11.0.tar.zst",
+			fileExtension: "tar.zst",
+			expectedError: false,
+			result: core.Module{
+				Namespace: "hashicorp",
+				Name:      "consul",
+				Provider:  "aws",
+				Version:   "0.11.0",
+			},
+		},
+		{
+			annotation:    "gzip archive listed with the zstd file extension",
+			key:           "/boring-registry/modules/hashicorp/consul/aws/hashicorp-consul-aws-0.11.0.tar.gz",
+			fileExtension: "tar.zst",
+			expectedError: true,
+		},
 		{
 			annotation:    "key with 4 hyphens in the file",
 			key:           "/boring-registry/test/modules/hashicorp/consul/aws/hashicorp-consul-hashicorp-aws-0.11.0-beta1.tar.gz",
@@ -328,3 +388,143 @@ func TestModuleFromObject(t *testing.T) {
 		})
 	}
 }
+
+func TestMirroredProviderFromObject(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		annotation    string
+		prefix        string
+		key           string
+		expectedError bool
+		result        *core.Provider
+	}{
+		{
+			annotation: "archive without bucket prefix",
+			prefix:     mirrorStoragePrefix(""),
+			key:        "mirror/providers/registry.terraform.io/hashicorp/random/terraform-provider-random_3.6.0_linux_amd64.zip",
+			result: &core.Provider{
+				Hostname:  "registry.terraform.io",
+				Namespace: "hashicorp",
+				Name:      "random",
+				Version:   "3.6.0",
+				OS:        "linux",
+				Arch:      "amd64",
+				Filename:  "terraform-provider-random_3.6.0_linux_amd64.zip",
+			},
+		},
+		{
+			annotation: "archive with bucket prefix",
+			prefix:     mirrorStoragePrefix("boring-registry"),
+			key:        "boring-registry/mirror/providers/terraform.example.com/acme/dummy/terraform-provider-dummy_0.1.0_darwin_arm64.zip",
+			result: &core.Provider{
+				Hostname:  "terraform.example.com",
+				Namespace: "acme",
+				Name:      "dummy",
+				Version:   "0.1.0",
+				OS:        "darwin",
+				Arch:      "arm64",
+				Filename:  "terraform-provider-dummy_0.1.0_darwin_arm64.zip",
+			},
+		},
+		{
+			annotation:    "SHA256SUMS file",
+			prefix:        mirrorStoragePrefix(""),
+			key:           "mirror/providers/registry.terraform.io/hashicorp/random/terraform-provider-random_3.6.0_SHA256SUMS",
+			expectedError: true,
+		},
+		{
+			annotation:    "signing keys",
+			prefix:        mirrorStoragePrefix(""),
+			key:           "mirror/providers/registry.terraform.io/hashicorp/signing-keys.json",
+			expectedError: true,
+		},
+		{
+			annotation:    "archive in the wrong directory",
+			prefix:        mirrorStoragePrefix(""),
+			key:           "mirror/providers/registry.terraform.io/hashicorp/aws/terraform-provider-random_3.6.0_linux_amd64.zip",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.annotation, func(t *testing.T) {
+			p, err := mirroredProviderFromObject(tc.prefix, tc.key)
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.result, p)
+		})
+	}
+}
+
+func TestInternalProviderFromObject(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		annotation    string
+		prefix        string
+		key           string
+		expectedError bool
+		result        *core.Provider
+	}{
+		{
+			annotation: "archive without bucket prefix",
+			prefix:     internalStoragePrefix(""),
+			key:        "providers/hashicorp/random/terraform-provider-random_3.6.0_linux_amd64.zip",
+			result: &core.Provider{
+				Namespace: "hashicorp",
+				Name:      "random",
+				Version:   "3.6.0",
+				OS:        "linux",
+				Arch:      "amd64",
+				Filename:  "terraform-provider-random_3.6.0_linux_amd64.zip",
+			},
+		},
+		{
+			annotation: "archive with bucket prefix",
+			prefix:     internalStoragePrefix("boring-registry"),
+			key:        "boring-registry/providers/acme/dummy/terraform-provider-dummy_0.1.0_darwin_arm64.zip",
+			result: &core.Provider{
+				Namespace: "acme",
+				Name:      "dummy",
+				Version:   "0.1.0",
+				OS:        "darwin",
+				Arch:      "arm64",
+				Filename:  "terraform-provider-dummy_0.1.0_darwin_arm64.zip",
+			},
+		},
+		{
+			annotation:    "SHA256SUMS file",
+			prefix:        internalStoragePrefix(""),
+			key:           "providers/hashicorp/random/terraform-provider-random_3.6.0_SHA256SUMS",
+			expectedError: true,
+		},
+		{
+			annotation:    "signing keys",
+			prefix:        internalStoragePrefix(""),
+			key:           "providers/hashicorp/signing-keys.json",
+			expectedError: true,
+		},
+		{
+			annotation:    "archive in the wrong directory",
+			prefix:        internalStoragePrefix(""),
+			key:           "providers/hashicorp/aws/terraform-provider-random_3.6.0_linux_amd64.zip",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.annotation, func(t *testing.T) {
+			p, err := internalProviderFromObject(tc.prefix, tc.key)
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.result, p)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultSignedURLHeadroom is the minimum expiry of the presigned URLs of proxied downloads
+const DefaultSignedURLHeadroom = time.Minute
+
+// signedURLHeadroom extends the expiry of the presigned URLs of proxied downloads.
+// The proxy only starts the download when the client requests the proxy URL,
+// so a short expiry can run out before or during the transfer and the storage backend responds with 403 Forbidden.
+type signedURLHeadroom struct {
+	min time.Duration
+	// nearExpiry counts the presigned URLs whose expiry was extended, it's optional
+	nearExpiry prometheus.Counter
+}
+
+// expiry returns the expiry of a presigned URL, which is at least the minimum headroom for proxied downloads
+func (h signedURLHeadroom) expiry(ctx context.Context, expiry time.Duration) time.Duration {
+	if expiry >= h.min || !core.IsProxiedDownload(ctx) {
+		return expiry
+	}
+	if h.nearExpiry != nil {
+		h.nearExpiry.Inc()
+	}
+	return h.min
+}
+
+// DefaultPresignConcurrency is the number of URLs that are presigned concurrently when listing objects
+const DefaultPresignConcurrency = 8
+
+// presignConcurrently calls presign for the indices 0 to n-1 with at most concurrency calls at a time.
+// The calls write their result to the index, so that the order of the listing is preserved.
+// The first error cancels the context of the remaining calls and is returned.
+func presignConcurrently(ctx context.Context, n, concurrency int, presign func(ctx context.Context, i int) error) error {
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(max(concurrency, 1))
+	for i := range n {
+		group.Go(func() error {
+			return presign(ctx, i)
+		})
+	}
+	return group.Wait()
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testProxyPrefix = "/v1/proxy"
+
+// resolveProxyUrl rewrites the object URL to the proxy and resolves it back like the proxy handler
+func resolveProxyUrl(t *testing.T, s Storage, objectUrl string) string {
+	t.Helper()
+
+	proxyUrl, err := core.NewProxyUrlService(true, testProxyPrefix).GetProxyUrl(context.Background(), objectUrl)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(proxyUrl, testProxyPrefix+"/"), "%s doesn't point at the proxy", proxyUrl)
+
+	downloadUrl, err := s.GetDownloadUrl(context.Background(), strings.TrimPrefix(proxyUrl, testProxyPrefix+"/"))
+	require.NoError(t, err)
+	return downloadUrl
+}
+
+func TestS3Storage_GetDownloadUrl(t *testing.T) {
+	key := modulePath("", "acme", "vpc", "aws", "1.0.0", DefaultModuleArchiveFormat)
+
+	testCases := []struct {
+		description string
+		endpoint    string
+		pathStyle   bool
+	}{
+		{description: "virtual-hosted style"},
+		{description: "path style", pathStyle: true},
+		{description: "custom endpoint", endpoint: "http://minio.example.com:9000", pathStyle: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			options := s3.Options{
+				Region:       "eu-central-1",
+				Credentials:  credentials.NewStaticCredentialsProvider("id", "secret", ""),
+				UsePathStyle: tc.pathStyle,
+			}
+			if tc.endpoint != "" {
+				options.BaseEndpoint = aws.String(tc.endpoint)
+			}
+			s := &S3Storage{
+				presignClient:   s3.NewPresignClient(s3.New(options)),
+				bucket:          "boring-registry",
+				bucketRegion:    "eu-central-1",
+				bucketEndpoint:  tc.endpoint,
+				forcePathStyle:  tc.pathStyle,
+				signedURLExpiry: time.Minute,
+			}
+
+			presigned, err := s.presignedURL(context.Background(), key)
+			require.NoError(t, err)
+			assert.Equal(t, presigned, resolveProxyUrl(t, s, presigned))
+		})
+	}
+
+	s := &S3Storage{bucket: "boring-registry", bucketEndpoint: "http://minio.example.com:9000"}
+	_, err := s.GetDownloadUrl(context.Background(), "other-bucket/"+key)
+	assert.Error(t, err)
+}
+
+func TestGCSStorage_GetDownloadUrl(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	key := modulePath("", "acme", "vpc", "aws", "1.0.0", DefaultModuleArchiveFormat)
+	signed, err := storage.SignedURL("boring-registry", key, &storage.SignedURLOptions{
+		Scheme:         storage.SigningSchemeV4,
+		Method:         "GET",
+		GoogleAccessID: "boring-registry@example.iam.gserviceaccount.com",
+		PrivateKey:     pemKey,
+		Expires:        time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+
+	s := &GCSStorage{bucket: "boring-registry"}
+	assert.Equal(t, signed, resolveProxyUrl(t, s, signed))
+
+	_, err = s.GetDownloadUrl(context.Background(), "other-bucket/"+key)
+	assert.Error(t, err)
+}
+
+func TestAzureStorage_GetDownloadUrl(t *testing.T) {
+	client, err := azblob.NewClientWithNoCredential("https://account.blob.core.windows.net/", nil)
+	require.NoError(t, err)
+
+	key := modulePath("", "acme", "vpc", "aws", "1.0.0", DefaultModuleArchiveFormat)
+	s := &AzureStorage{client: client, container: "boring-registry"}
+	signed := client.ServiceClient().NewContainerClient(s.container).NewBlobClient(key).URL() + "?sv=2023-11-03&sig=signature"
+	assert.Equal(t, signed, resolveProxyUrl(t, s, signed))
+
+	_, err = s.GetDownloadUrl(context.Background(), "other-container/"+key)
+	assert.Error(t, err)
+}
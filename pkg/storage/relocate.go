@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Relocator copies the objects of a storage backend to another bucket prefix server-side
+type Relocator interface {
+	// ListAllKeys returns the keys of all objects under the bucket prefix, relative to the bucket prefix
+	ListAllKeys(ctx context.Context) ([]string, error)
+
+	// CopyToPrefix copies the object with the key relative to the bucket prefix to the same key under the target prefix.
+	// The copy is verified by comparing the checksums or ETags of both objects.
+	CopyToPrefix(ctx context.Context, key, targetPrefix string) error
+
+	// DeleteKey deletes the object with the key relative to the bucket prefix
+	DeleteKey(ctx context.Context, key string) error
+}
+
+// RelocateOptions configures Relocate
+type RelocateOptions struct {
+	// DeleteSource deletes every object after it has been copied successfully
+	DeleteSource bool
+	// DryRun only logs the objects that would be copied
+	DryRun bool
+}
+
+// Relocate copies all objects under the bucket prefix of the storage backend to the target prefix and returns the number of copied objects.
+// The objects are listed before the first copy, so that copies below the bucket prefix are never copied again.
+func Relocate(ctx context.Context, r Relocator, targetPrefix string, opts RelocateOptions) (int, error) {
+	keys, err := r.ListAllKeys(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	copied := 0
+	for _, key := range keys {
+		logger := slog.Default().With(slog.String("key", key), slog.String("target_prefix", targetPrefix))
+		if opts.DryRun {
+			logger.Info("would relocate object")
+			copied++
+			continue
+		}
+
+		if err := r.CopyToPrefix(ctx, key, targetPrefix); err != nil {
+			return copied, fmt.Errorf("failed to copy %s: %w", key, err)
+		}
+		copied++
+
+		if opts.DeleteSource {
+			if err := r.DeleteKey(ctx, key); err != nil {
+				return copied, fmt.Errorf("failed to delete %s: %w", key, err)
+			}
+		}
+		logger.Info("relocated object", slog.Bool("deleted_source", opts.DeleteSource))
+	}
+	return copied, nil
+}
+
+// relocationKeys returns the source and the target key of an object relative to the bucket prefix
+func relocationKeys(bucketPrefix, targetPrefix, key string) (string, string, error) {
+	src, dst := keyPrefix(bucketPrefix, key), keyPrefix(targetPrefix, key)
+	if src == dst {
+		return "", "", fmt.Errorf("the target prefix %q is the bucket prefix", targetPrefix)
+	}
+	return src, dst, nil
+}
+
+// verifyCopy returns an error if the checksum of the copy differs from the checksum of the source object
+func verifyCopy(src, dst, kind, srcChecksum, dstChecksum string) error {
+	if srcChecksum != dstChecksum {
+		return fmt.Errorf("the %s %q of the copy %s doesn't match the %s %q of %s", kind, dstChecksum, dst, kind, srcChecksum, src)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/googleapis/gax-go/v2"
+)
+
+const (
+	// DefaultRetryMaxAttempts is the number of attempts for an operation against the storage backend, including the first one
+	DefaultRetryMaxAttempts = 3
+
+	defaultRetryBaseDelay = 250 * time.Millisecond
+	defaultRetryMaxDelay  = 5 * time.Second
+)
+
+// retryConfig configures the retries of transient errors like 429, 5xx responses and timeouts.
+// The maximum attempts are passed to the AWS SDK, the GCS and Azure clients are configured with the complete settings.
+// The delay doubles with every attempt up to maxDelay, the clients randomize it to spread out the retries.
+type retryConfig struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+func defaultRetryConfig() retryConfig {
+	return retryConfig{
+		maxAttempts: DefaultRetryMaxAttempts,
+		baseDelay:   defaultRetryBaseDelay,
+		maxDelay:    defaultRetryMaxDelay,
+	}
+}
+
+// gcsOptions returns the retry options of a GCS client.
+// Only idempotent operations are retried, which is why uploads are made idempotent with preconditions
+func (c retryConfig) gcsOptions() []storage.RetryOption {
+	if c.maxAttempts <= 1 {
+		return []storage.RetryOption{storage.WithPolicy(storage.RetryNever)}
+	}
+
+	return []storage.RetryOption{
+		storage.WithMaxAttempts(c.maxAttempts),
+		storage.WithBackoff(gax.Backoff{
+			Initial:    c.baseDelay,
+			Max:        c.maxDelay,
+			Multiplier: 2,
+		}),
+	}
+}
+
+// azureClientOptions returns the options of an Azure client, which retries requests in its pipeline
+func (c retryConfig) azureClientOptions() *azblob.ClientOptions {
+	// Zero retries would be replaced with the default, a negative value disables the retries
+	retries := int32(c.maxAttempts - 1)
+	if retries <= 0 {
+		retries = -1
+	}
+
+	return &azblob.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Retry: policy.RetryOptions{
+				MaxRetries:    retries,
+				RetryDelay:    c.baseDelay,
+				MaxRetryDelay: c.maxDelay,
+			},
+		},
+	}
+}
+
+// azureReadRetries returns the number of times an interrupted download is resumed, zero disables resuming
+func (c retryConfig) azureReadRetries() int32 {
+	return int32(max(c.maxAttempts-1, 0))
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// flakyHandler fails the first request of every method and path with 503 Service Unavailable
+type flakyHandler struct {
+	next http.Handler
+
+	mu       sync.Mutex
+	failed   map[string]bool
+	requests int
+}
+
+func newFlakyHandler(next http.HandlerFunc) *flakyHandler {
+	return &flakyHandler{next: next, failed: map[string]bool{}}
+}
+
+func (h *flakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.requests++
+	key := r.Method + " " + r.URL.Path
+	failed := h.failed[key]
+	h.failed[key] = true
+	h.mu.Unlock()
+
+	if !failed {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+func fastRetries(c *retryConfig) {
+	c.baseDelay = time.Millisecond
+	c.maxDelay = 10 * time.Millisecond
+}
+
+func TestGCSStorage_retry(t *testing.T) {
+	var uploaded []byte
+	h := newFlakyHandler(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/boring-registry/data":
+			_, _ = w.Write([]byte("content"))
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/boring-registry/o"):
+			uploaded, _ = io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprint(w, `{"bucket": "boring-registry", "name": "data"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(srv.URL+"/storage/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	s := newGCSStorage(client, "boring-registry", func(s *GCSStorage) { fastRetries(&s.retry) })
+
+	data, err := s.download(context.Background(), "data")
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(data))
+
+	assert.NoError(t, s.upload(context.Background(), "data", bytes.NewReader([]byte("content")), true))
+	assert.Contains(t, string(uploaded), "content")
+	assert.Equal(t, 4, h.requests)
+}
+
+func TestAzureStorage_retry(t *testing.T) {
+	var uploaded []byte
+	h := newFlakyHandler(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/boring-registry/data":
+			w.Header().Set("Content-Length", "7")
+			_, _ = w.Write([]byte("content"))
+		case r.Method == http.MethodPut && r.URL.Path == "/boring-registry/data":
+			uploaded, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	s := &AzureStorage{container: "boring-registry", retry: defaultRetryConfig()}
+	fastRetries(&s.retry)
+	client, err := azblob.NewClientWithNoCredential(srv.URL+"/", s.retry.azureClientOptions())
+	require.NoError(t, err)
+	s.client = client
+
+	data, err := s.download(context.Background(), "data")
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(data))
+
+	assert.NoError(t, s.upload(context.Background(), "data", bytes.NewReader([]byte("content")), true))
+	assert.Equal(t, "content", string(uploaded))
+	assert.Equal(t, 4, h.requests)
+}
+
+func TestRetryConfig_disabled(t *testing.T) {
+	c := retryConfig{maxAttempts: 1}
+	assert.Equal(t, int32(-1), c.azureClientOptions().Retry.MaxRetries)
+	assert.Zero(t, c.azureReadRetries())
+}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "timeout", err: fmt.Errorf("upload: %w", core.ErrStorageTimeout), want: true},
+		{name: "connection reset", err: fmt.Errorf("upload: %w", syscall.ECONNRESET), want: true},
+		{name: "gcs throttling", err: &googleapi.Error{Code: http.StatusTooManyRequests}, want: true},
+		{name: "azure server error", err: &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}, want: true},
+		{name: "gcs forbidden", err: &googleapi.Error{Code: http.StatusForbidden}},
+		{name: "unknown error", err: errors.New("access denied")},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, IsTransientError(tc.err))
+		})
+	}
+}
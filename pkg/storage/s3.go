@@ -3,13 +3,19 @@ package storage
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/boring-registry/boring-registry/pkg/core"
@@ -21,6 +27,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // s3ClientAPI is used to mock the AWS APIs
@@ -29,6 +37,7 @@ type s3ClientAPI interface {
 	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
 	ListObjectsV2(ctx context.Context, input *s3.ListObjectsV2Input, f ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
 	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
 }
 
 // s3UploaderAPI is used to mock the AWS APIs
@@ -63,13 +72,21 @@ type S3Storage struct {
 	moduleArchiveFormat string
 	forcePathStyle      bool
 	signedURLExpiry     time.Duration
+	signedURLHeadroom   signedURLHeadroom
+	existsCache         *existenceCache
+	retryMaxAttempts    int
+	presignConcurrency  int
+	objectACL           string
+	signingKeysFallback string
+	pageSize            int
+	locks               uploadLocks
 }
 
 // GetModule retrieves information about a module from the S3 storage.
 func (s *S3Storage) GetModule(ctx context.Context, namespace, name, provider, version string) (core.Module, error) {
-	key := modulePath(s.bucketPrefix, namespace, name, provider, version, s.moduleArchiveFormat)
+	key := modulePath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, provider, version, s.moduleArchiveFormat)
 
-	exists, err := s.objectExists(ctx, key)
+	checksum, exists, err := s.objectChecksum(ctx, key)
 	if err != nil {
 		return core.Module{}, err
 	} else if !exists {
@@ -87,13 +104,20 @@ func (s *S3Storage) GetModule(ctx context.Context, namespace, name, provider, ve
 		Provider:    provider,
 		Version:     version,
 		DownloadURL: presigned,
+		Checksum:    checksum,
 	}, nil
 }
 
+// ModuleExists reports whether the archive of a module version exists
+func (s *S3Storage) ModuleExists(ctx context.Context, namespace, name, provider, version string) (bool, error) {
+	return s.objectExists(ctx, modulePath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, provider, version, s.moduleArchiveFormat))
+}
+
 func (s *S3Storage) ListModuleVersions(ctx context.Context, namespace, name, provider string) ([]core.Module, error) {
 	input := &s3.ListObjectsV2Input{
-		Bucket: aws.String(s.bucket),
-		Prefix: aws.String(modulePathPrefix(s.bucketPrefix, namespace, name, provider)),
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(modulePathPrefix(scopedPrefix(ctx, s.bucketPrefix), namespace, name, provider)),
+		MaxKeys: s.listMaxKeys(),
 	}
 
 	var modules []core.Module
@@ -110,17 +134,21 @@ func (s *S3Storage) ListModuleVersions(ctx context.Context, namespace, name, pro
 				// TODO: we're skipping possible failures silently
 				continue
 			}
-
-			// The download URL is probably not necessary for ListModules
-			m.DownloadURL, err = s.presignedURL(ctx, modulePath(s.bucketPrefix, m.Namespace, m.Name, m.Provider, m.Version, s.moduleArchiveFormat))
-			if err != nil {
-				return []core.Module{}, err
-			}
-
 			modules = append(modules, *m)
 		}
 	}
 
+	// The download URL is probably not necessary for ListModules
+	err := presignConcurrently(ctx, len(modules), s.presignConcurrency, func(ctx context.Context, i int) error {
+		m := &modules[i]
+		var err error
+		m.DownloadURL, err = s.presignedURL(ctx, modulePath(scopedPrefix(ctx, s.bucketPrefix), m.Namespace, m.Name, m.Provider, m.Version, s.moduleArchiveFormat))
+		return err
+	})
+	if err != nil {
+		return []core.Module{}, err
+	}
+
 	return modules, nil
 }
 
@@ -142,19 +170,33 @@ func (s *S3Storage) UploadModule(ctx context.Context, namespace, name, provider,
 		return core.Module{}, errors.New("version not defined")
 	}
 
-	key := modulePath(s.bucketPrefix, namespace, name, provider, version, DefaultModuleArchiveFormat)
+	key := modulePath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, provider, version, s.moduleArchiveFormat)
 
-	if _, err := s.GetModule(ctx, namespace, name, provider, version); err == nil {
-		return core.Module{}, fmt.Errorf("%w: %s", module.ErrModuleAlreadyExists, key)
+	if m, err := s.GetModule(ctx, namespace, name, provider, version); err == nil {
+		if m.Checksum != "" {
+			if err := compareModuleChecksum(key, body, m.Checksum); err != nil {
+				return core.Module{}, err
+			}
+			return m, nil
+		}
+		stored, err := s.download(ctx, key)
+		if err != nil {
+			return core.Module{}, err
+		}
+		if err := compareModuleArchive(key, body, stored); err != nil {
+			return core.Module{}, err
+		}
+		return m, nil
 	}
 
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 		Body:   body,
+		ACL:    s.cannedACL(),
 	}
 
-	if _, err := s.uploader.Upload(ctx, input); err != nil {
+	if err := s.putObject(ctx, input); err != nil {
 		return core.Module{}, fmt.Errorf("%v: %w", module.ErrModuleUploadFailed, err)
 	}
 
@@ -165,9 +207,9 @@ func (s *S3Storage) UploadModule(ctx context.Context, namespace, name, provider,
 func (s *S3Storage) getProvider(ctx context.Context, pt providerType, provider *core.Provider) (*core.Provider, error) {
 	var archivePath, shasumPath, shasumSigPath string
 	if pt == internalProviderType {
-		archivePath, shasumPath, shasumSigPath = internalProviderPath(s.bucketPrefix, provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
+		archivePath, shasumPath, shasumSigPath = internalProviderPath(scopedPrefix(ctx, s.bucketPrefix), provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
 	} else if pt == mirrorProviderType {
-		archivePath, shasumPath, shasumSigPath = mirrorProviderPath(s.bucketPrefix, provider.Hostname, provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
+		archivePath, shasumPath, shasumSigPath = mirrorProviderPath(scopedPrefix(ctx, s.bucketPrefix), provider.Hostname, provider.Namespace, provider.Name, provider.Version, provider.OS, provider.Arch)
 	}
 
 	if exists, err := s.objectExists(ctx, archivePath); err != nil {
@@ -202,7 +244,9 @@ func (s *S3Storage) getProvider(ctx context.Context, pt providerType, provider *
 
 	var signingKeys *core.SigningKeys
 	if pt == internalProviderType {
-		signingKeys, err = s.SigningKeys(ctx, provider.Namespace)
+		signingKeys, err = signingKeysWithFallback(ctx, provider.Namespace, s.signingKeysFallback, func(ctx context.Context) (*core.SigningKeys, error) {
+			return s.ProviderSigningKeys(ctx, provider.Namespace, provider.Name, provider.Version)
+		}, s.SigningKeys)
 	} else if pt == mirrorProviderType {
 		signingKeys, err = s.MirroredSigningKeys(ctx, provider.Hostname, provider.Namespace)
 	}
@@ -232,15 +276,20 @@ func (s *S3Storage) GetMirroredProvider(ctx context.Context, provider *core.Prov
 }
 
 func (s *S3Storage) listProviderVersions(ctx context.Context, pt providerType, provider *core.Provider) ([]*core.Provider, error) {
-	prefix := providerStoragePrefix(s.bucketPrefix, pt, provider.Hostname, provider.Namespace, provider.Name)
+	prefix := fmt.Sprintf("%s/", providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), pt, provider.Hostname, provider.Namespace, provider.Name))
+	if provider.Version != "" {
+		prefix = providerVersionPrefix(scopedPrefix(ctx, s.bucketPrefix), pt, provider.Hostname, provider.Namespace, provider.Name, provider.Version)
+	}
 	input := &s3.ListObjectsV2Input{
-		Bucket: aws.String(s.bucket),
-		Prefix: aws.String(fmt.Sprintf("%s/", prefix)),
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: s.listMaxKeys(),
 	}
 
 	paginator := s3.NewListObjectsV2Paginator(s.client, input)
 
 	var providers []*core.Provider
+	var keys []string
 	for paginator.HasMorePages() {
 		resp, err := paginator.NextPage(ctx)
 		if err != nil {
@@ -260,13 +309,8 @@ func (s *S3Storage) listProviderVersions(ctx context.Context, pt providerType, p
 
 			p.Hostname = provider.Hostname
 			p.Namespace = provider.Namespace
-			archiveUrl, err := s.presignedURL(ctx, *obj.Key)
-			if err != nil {
-				return nil, err
-			}
-			p.DownloadURL = archiveUrl
-
 			providers = append(providers, &p)
+			keys = append(keys, *obj.Key)
 		}
 	}
 
@@ -274,6 +318,15 @@ func (s *S3Storage) listProviderVersions(ctx context.Context, pt providerType, p
 		return nil, noMatchingProviderFound(provider)
 	}
 
+	err := presignConcurrently(ctx, len(providers), s.presignConcurrency, func(ctx context.Context, i int) error {
+		var err error
+		providers[i].DownloadURL, err = s.presignedURL(ctx, keys[i])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return providers, nil
 }
 
@@ -290,10 +343,181 @@ func (s *S3Storage) ListProviderVersions(ctx context.Context, namespace, name st
 	return collection.List(), nil
 }
 
+// ListProviderPlatforms lists the archives of an internal provider version, without listing the files of the other versions
+func (s *S3Storage) ListProviderPlatforms(ctx context.Context, namespace, name, version string) ([]core.Platform, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(providerVersionPrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name, version)),
+		MaxKeys: s.listMaxKeys(),
+	}
+
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to page next page: %w", err)
+		}
+		for _, obj := range resp.Contents {
+			keys = append(keys, *obj.Key)
+		}
+	}
+
+	return providerPlatforms(&core.Provider{Namespace: namespace, Name: name, Version: version}, keys)
+}
+
+// ListProviderVersionsPage returns a page of the versions of an internal provider, which is resumed with the S3 continuation token
+func (s *S3Storage) ListProviderVersionsPage(ctx context.Context, namespace, name string, limit int, token string) (*core.ProviderVersions, string, error) {
+	prefix := fmt.Sprintf("%s/", providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name))
+	return listProviderVersionsPage(ctx, &core.Provider{Namespace: namespace, Name: name}, limit, token, func(ctx context.Context, continuation string) ([]string, string, error) {
+		input := &s3.ListObjectsV2Input{
+			Bucket:  aws.String(s.bucket),
+			Prefix:  aws.String(prefix),
+			MaxKeys: s.listMaxKeys(),
+		}
+		if continuation != "" {
+			input.ContinuationToken = aws.String(continuation)
+		}
+
+		resp, err := s.client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to page next page: %w", err)
+		}
+
+		keys := make([]string, 0, len(resp.Contents))
+		for _, obj := range resp.Contents {
+			keys = append(keys, *obj.Key)
+		}
+		return keys, aws.ToString(resp.NextContinuationToken), nil
+	})
+}
+
 func (s *S3Storage) ListMirroredProviders(ctx context.Context, provider *core.Provider) ([]*core.Provider, error) {
 	return s.listProviderVersions(ctx, mirrorProviderType, provider)
 }
 
+func (s *S3Storage) ListAllMirroredProviders(ctx context.Context) ([]*core.Provider, error) {
+	prefix := mirrorStoragePrefix(scopedPrefix(ctx, s.bucketPrefix))
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: s.listMaxKeys(),
+	}
+
+	var providers []*core.Provider
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to page next page: %w", err)
+		}
+
+		for _, obj := range resp.Contents {
+			p, err := mirroredProviderFromObject(prefix, *obj.Key)
+			if err != nil {
+				continue
+			}
+			providers = append(providers, p)
+		}
+	}
+
+	return providers, nil
+}
+
+// ListAllModules returns all versions of all modules with a single listing of the modules prefix
+func (s *S3Storage) ListAllModules(ctx context.Context) ([]core.Module, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(moduleStoragePrefix(scopedPrefix(ctx, s.bucketPrefix))),
+		MaxKeys: s.listMaxKeys(),
+	}
+
+	var modules []core.Module
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", module.ErrModuleListFailed, err)
+		}
+
+		for _, obj := range resp.Contents {
+			m, err := moduleFromObject(*obj.Key, s.moduleArchiveFormat)
+			if err != nil {
+				continue
+			}
+			modules = append(modules, *m)
+		}
+	}
+
+	return modules, nil
+}
+
+// ListModulesByProvider lists the namespaces and module names with the delimiter and checks the provider of every module with a single key
+func (s *S3Storage) ListModulesByProvider(ctx context.Context, provider string, limit int, token string) ([]core.Module, string, error) {
+	list := func(ctx context.Context, prefix string) ([]string, error) {
+		input := &s3.ListObjectsV2Input{
+			Bucket:    aws.String(s.bucket),
+			Prefix:    aws.String(prefix),
+			Delimiter: aws.String("/"),
+			MaxKeys:   s.listMaxKeys(),
+		}
+
+		var prefixes []string
+		paginator := s3.NewListObjectsV2Paginator(s.client, input)
+		for paginator.HasMorePages() {
+			resp, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range resp.CommonPrefixes {
+				prefixes = append(prefixes, aws.ToString(p.Prefix))
+			}
+		}
+		return prefixes, nil
+	}
+	exists := func(ctx context.Context, prefix string) (bool, error) {
+		resp, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:  aws.String(s.bucket),
+			Prefix:  aws.String(prefix),
+			MaxKeys: aws.Int32(1),
+		})
+		if err != nil {
+			return false, err
+		}
+		return len(resp.Contents) > 0, nil
+	}
+	return listModulesByProvider(ctx, moduleStoragePrefix(scopedPrefix(ctx, s.bucketPrefix)), provider, limit, token, list, exists)
+}
+
+// ListAllProviders returns all platforms of all internal providers with a single listing of the providers prefix
+func (s *S3Storage) ListAllProviders(ctx context.Context) ([]*core.Provider, error) {
+	prefix := internalStoragePrefix(scopedPrefix(ctx, s.bucketPrefix))
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: s.listMaxKeys(),
+	}
+
+	var providers []*core.Provider
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to page next page: %w", err)
+		}
+
+		for _, obj := range resp.Contents {
+			p, err := internalProviderFromObject(prefix, *obj.Key)
+			if err != nil {
+				continue
+			}
+			providers = append(providers, p)
+		}
+	}
+
+	return providers, nil
+}
+
 func (s *S3Storage) UploadProviderReleaseFiles(ctx context.Context, namespace, name, filename string, file io.Reader) error {
 	if namespace == "" {
 		return fmt.Errorf("namespace argument is empty")
@@ -307,16 +531,191 @@ func (s *S3Storage) UploadProviderReleaseFiles(ctx context.Context, namespace, n
 		return fmt.Errorf("filename argument is empty")
 	}
 
-	prefix := providerStoragePrefix(s.bucketPrefix, internalProviderType, "", namespace, name)
-	key := filepath.Join(prefix, filename)
+	if err := validateReleaseFileName(name, filename); err != nil {
+		return err
+	}
+
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name)
+	key := path.Join(prefix, filename)
 	return s.upload(ctx, key, file, false)
 }
 
+// ProviderReleaseFileChecksum returns the checksum of a file of an internal provider release, which was computed during its upload
+func (s *S3Storage) ProviderReleaseFileChecksum(ctx context.Context, namespace, name, filename string) ([]byte, error) {
+	key := path.Join(providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name), filename)
+	checksum, exists, err := s.objectChecksum(ctx, key)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, core.ErrObjectNotFound
+	}
+	return decodeChecksum(key, checksum)
+}
+
+// LockProviderVersion creates the lock object of an internal provider version, unless it already exists
+func (s *S3Storage) LockProviderVersion(ctx context.Context, namespace, name, version string) error {
+	key := internalProviderLockPath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version)
+	create := func(ctx context.Context, content []byte) error {
+		input := &s3.PutObjectInput{
+			Bucket:      aws.String(s.bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(content),
+			IfNoneMatch: aws.String("*"),
+		}
+		if _, err := s.uploader.Upload(ctx, input); err != nil {
+			var responseError *awshttp.ResponseError
+			if errors.As(err, &responseError) &&
+				(responseError.HTTPStatusCode() == http.StatusPreconditionFailed || responseError.HTTPStatusCode() == http.StatusConflict) {
+				return fmt.Errorf("failed to lock %s: %w", key, core.ErrUploadInProgress)
+			}
+			return fmt.Errorf("failed to lock %s: %w", key, err)
+		}
+		return nil
+	}
+	return s.locks.acquire(ctx, key, create, s.readLock(key), s.removeLock(key))
+}
+
+// UnlockProviderVersion deletes the lock object of an internal provider version, if it's still held by this upload
+func (s *S3Storage) UnlockProviderVersion(ctx context.Context, namespace, name, version string) error {
+	key := internalProviderLockPath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version)
+	return s.locks.release(ctx, key, s.readLock(key), s.removeLock(key))
+}
+
+// readLock returns the content and the ETag of a lock object, the content is only downloaded if it still has the ETag
+func (s *S3Storage) readLock(key string) readUploadLock {
+	return func(ctx context.Context) ([]byte, string, error) {
+		out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+		if err != nil {
+			var responseError *awshttp.ResponseError
+			if errors.As(err, &responseError) && responseError.HTTPStatusCode() == http.StatusNotFound {
+				return nil, "", core.ErrObjectNotFound
+			}
+			return nil, "", err
+		}
+
+		buf := s3manager.NewWriteAtBuffer([]byte{})
+		input := &s3.GetObjectInput{
+			Bucket:  aws.String(s.bucket),
+			Key:     aws.String(key),
+			IfMatch: out.ETag,
+		}
+		if _, err := s.downloader.Download(ctx, buf, input); err != nil {
+			if isPreconditionFailed(err) {
+				return nil, "", fmt.Errorf("the lock %s changed while it was read: %w", key, core.ErrUploadInProgress)
+			}
+			return nil, "", fmt.Errorf("failed to download %s: %w", key, err)
+		}
+		return buf.Bytes(), aws.ToString(out.ETag), nil
+	}
+}
+
+// removeLock deletes a lock object only if it still has the ETag
+func (s *S3Storage) removeLock(key string) removeUploadLock {
+	return func(ctx context.Context, etag string) error {
+		input := &s3.DeleteObjectInput{
+			Bucket:  aws.String(s.bucket),
+			Key:     aws.String(key),
+			IfMatch: aws.String(etag),
+		}
+		if _, err := s.client.DeleteObject(ctx, input); err != nil {
+			if isPreconditionFailed(err) {
+				return fmt.Errorf("the lock %s was replaced: %w", key, core.ErrUploadInProgress)
+			}
+			return err
+		}
+		s.existsCache.invalidate(key)
+		return nil
+	}
+}
+
+// isPreconditionFailed reports whether S3 rejected a conditional request, because the object changed
+func isPreconditionFailed(err error) bool {
+	var responseError *awshttp.ResponseError
+	return errors.As(err, &responseError) && responseError.HTTPStatusCode() == http.StatusPreconditionFailed
+}
+
+// DownloadProviderReleaseFile returns a file of an internal provider release, which was uploaded with UploadProviderReleaseFiles
+func (s *S3Storage) DownloadProviderReleaseFile(ctx context.Context, namespace, name, filename string) ([]byte, error) {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name)
+	key := filepath.Join(prefix, filename)
+	return s.download(ctx, key)
+}
+
+// StreamProviderReleaseFile writes a file of an internal provider release to w
+func (s *S3Storage) StreamProviderReleaseFile(ctx context.Context, namespace, name, filename string, w io.Writer) error {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name)
+	key := path.Join(prefix, filename)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+
+	// The parts are only written in order if they are downloaded one after the other
+	if _, err := s.downloader.Download(ctx, sequentialWriterAt{w}, input, func(d *s3manager.Downloader) { d.Concurrency = 1 }); err != nil {
+		return fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return nil
+}
+
+// DeleteProviderReleaseFile deletes a file of an internal provider release
+func (s *S3Storage) DeleteProviderReleaseFile(ctx context.Context, namespace, name, filename string) error {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), internalProviderType, "", namespace, name)
+	key := path.Join(prefix, filename)
+	if _, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	s.existsCache.invalidate(key)
+	return nil
+}
+
+// ProviderSha256Sums returns the SHA256SUMS file of an internal provider version
+func (s *S3Storage) ProviderSha256Sums(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	key := internalProviderShasumPath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version)
+	exists, err := s.objectExists(ctx, key)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, core.ErrObjectNotFound
+	}
+	return s.download(ctx, key)
+}
+
+// ProviderDocs returns the metadata.json document of an internal provider version
+func (s *S3Storage) ProviderDocs(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	key := internalProviderDocsPath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version)
+	exists, err := s.objectExists(ctx, key)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, core.ErrObjectNotFound
+	}
+	return s.download(ctx, key)
+}
+
+// ProviderExists reports whether the archive of an internal provider version exists for the platform
+func (s *S3Storage) ProviderExists(ctx context.Context, namespace, name, version, os, arch string) (bool, error) {
+	archivePath, _, _ := internalProviderPath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version, os, arch)
+	return s.objectExists(ctx, archivePath)
+}
+
+// ProviderDocsExist reports whether a metadata.json document exists for an internal provider version
+func (s *S3Storage) ProviderDocsExist(ctx context.Context, namespace, name, version string) (bool, error) {
+	return s.objectExists(ctx, internalProviderDocsPath(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version))
+}
+
 func (s *S3Storage) signingKeys(ctx context.Context, pt providerType, hostname, namespace string) (*core.SigningKeys, error) {
 	if namespace == "" {
 		return nil, fmt.Errorf("namespace argument is empty")
 	}
-	key := signingKeysPath(s.bucketPrefix, pt, hostname, namespace)
+	return s.signingKeysObject(ctx, signingKeysPath(scopedPrefix(ctx, s.bucketPrefix), pt, hostname, namespace))
+}
+
+// signingKeysObject downloads and unmarshals the signing keys stored under key.
+// It returns core.ErrObjectNotFound if the object doesn't exist.
+func (s *S3Storage) signingKeysObject(ctx context.Context, key string) (*core.SigningKeys, error) {
 	exists, err := s.objectExists(ctx, key)
 	if err != nil {
 		return nil, err
@@ -326,12 +725,17 @@ func (s *S3Storage) signingKeys(ctx context.Context, pt providerType, hostname,
 
 	signingKeysRaw, err := s.download(ctx, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download signing_keys.json for namespace %s: %w", namespace, err)
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
 	}
 
 	return unmarshalSigningKeys(signingKeysRaw)
 }
 
+// ProviderSigningKeys returns the signing keys of the provider version, of the provider or of the namespace, whichever are the most specific
+func (s *S3Storage) ProviderSigningKeys(ctx context.Context, namespace, name, version string) (*core.SigningKeys, error) {
+	return mostSpecificSigningKeys(ctx, providerSigningKeysPaths(scopedPrefix(ctx, s.bucketPrefix), namespace, name, version), s.signingKeysObject)
+}
+
 // SigningKeys downloads the JSON placed in the namespace in S3 and unmarshals it into a core.SigningKeys
 func (s *S3Storage) SigningKeys(ctx context.Context, namespace string) (*core.SigningKeys, error) {
 	return s.signingKeys(ctx, internalProviderType, "", namespace)
@@ -346,16 +750,21 @@ func (s *S3Storage) uploadSigningKeys(ctx context.Context, pt providerType, host
 	if err != nil {
 		return err
 	}
-	key := signingKeysPath(s.bucketPrefix, pt, hostname, namespace)
+	key := signingKeysPath(scopedPrefix(ctx, s.bucketPrefix), pt, hostname, namespace)
 	return s.upload(ctx, key, bytes.NewReader(b), true)
 }
 
+// UploadSigningKeys replaces the signing keys of an internal provider namespace
+func (s *S3Storage) UploadSigningKeys(ctx context.Context, namespace string, signingKeys *core.SigningKeys) error {
+	return s.uploadSigningKeys(ctx, internalProviderType, "", namespace, signingKeys)
+}
+
 func (s *S3Storage) UploadMirroredSigningKeys(ctx context.Context, hostname, namespace string, signingKeys *core.SigningKeys) error {
 	return s.uploadSigningKeys(ctx, mirrorProviderType, hostname, namespace, signingKeys)
 }
 
 func (s *S3Storage) MirroredSha256Sum(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
-	prefix := providerStoragePrefix(s.bucketPrefix, mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
 	key := filepath.Join(prefix, provider.ShasumFileName())
 	shaSumBytes, err := s.download(ctx, key)
 	if err != nil {
@@ -366,38 +775,251 @@ func (s *S3Storage) MirroredSha256Sum(ctx context.Context, provider *core.Provid
 }
 
 func (s *S3Storage) UploadMirroredFile(ctx context.Context, provider *core.Provider, fileName string, reader io.Reader) error {
-	prefix := providerStoragePrefix(s.bucketPrefix, mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
 	key := filepath.Join(prefix, fileName)
 	return s.upload(ctx, key, reader, true)
 }
 
+func (s *S3Storage) DownloadMirroredFile(ctx context.Context, provider *core.Provider, fileName string) ([]byte, error) {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
+	key := filepath.Join(prefix, fileName)
+	return s.download(ctx, key)
+}
+
+func (s *S3Storage) ListMirroredFiles(ctx context.Context) ([]string, error) {
+	prefix := mirrorStoragePrefix(scopedPrefix(ctx, s.bucketPrefix))
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: s.listMaxKeys(),
+	}
+
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to page next page: %w", err)
+		}
+		for _, obj := range resp.Contents {
+			keys = append(keys, strings.TrimPrefix(*obj.Key, prefix))
+		}
+	}
+	return keys, nil
+}
+
+func (s *S3Storage) DeleteMirroredFile(ctx context.Context, provider *core.Provider, fileName string) error {
+	prefix := providerStoragePrefix(scopedPrefix(ctx, s.bucketPrefix), mirrorProviderType, provider.Hostname, provider.Namespace, provider.Name)
+	key := path.Join(prefix, fileName)
+	if _, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return err
+	}
+	s.existsCache.invalidate(key)
+	return nil
+}
+
 func (s *S3Storage) presignedURL(ctx context.Context, key string) (string, error) {
 	presignResult, err := s.presignClient.PresignGetObject(ctx,
 		&s3.GetObjectInput{
 			Bucket: aws.String(s.bucket),
 			Key:    aws.String(key),
 		},
-		s3.WithPresignExpires(s.signedURLExpiry),
+		s3.WithPresignExpires(s.signedURLHeadroom.expiry(ctx, s.signedURLExpiry)),
 	)
 
 	return presignResult.URL, err
 }
 
+// InvalidateCache forgets the existence of the objects starting with the prefix, relative to the bucket prefix
+func (s *S3Storage) InvalidateCache(ctx context.Context, prefix string) int {
+	return s.existsCache.invalidate(keyPrefix(scopedPrefix(ctx, s.bucketPrefix), prefix))
+}
+
+// ListKeys returns up to limit keys of the bucket under the prefix
+func (s *S3Storage) ListKeys(ctx context.Context, prefix string, limit int) ([]string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(keyPrefix(scopedPrefix(ctx, s.bucketPrefix), prefix)),
+		MaxKeys: aws.Int32(int32(limit)),
+	}
+
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() && len(keys) < limit {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range resp.Contents {
+			keys = append(keys, *obj.Key)
+		}
+	}
+
+	return truncateKeys(keys, limit), nil
+}
+
+// ListAllKeys returns the keys of all objects under the bucket prefix, relative to the bucket prefix
+func (s *S3Storage) ListAllKeys(ctx context.Context) ([]string, error) {
+	prefix := keyPrefix(s.bucketPrefix, "")
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: s.listMaxKeys(),
+	}
+
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to page next page: %w", err)
+		}
+		for _, obj := range resp.Contents {
+			keys = append(keys, strings.TrimPrefix(*obj.Key, prefix))
+		}
+	}
+	return keys, nil
+}
+
+// CopyToPrefix copies the object with CopyObject, so that the object isn't downloaded.
+// The copy is bound to the ETag of the source and S3 computes its SHA256 checksum.
+// It's compared with the full-object SHA256 checksum of the source if there is one, otherwise with the ETag,
+// which is the MD5 digest of objects that weren't uploaded in parts or encrypted with KMS.
+func (s *S3Storage) CopyToPrefix(ctx context.Context, key, targetPrefix string) error {
+	src, dst, err := relocationKeys(s.bucketPrefix, targetPrefix, key)
+	if err != nil {
+		return err
+	}
+
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(src),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return err
+	}
+
+	out, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(dst),
+		CopySource:        aws.String((&url.URL{Path: s.bucket + "/" + src}).EscapedPath()),
+		CopySourceIfMatch: head.ETag,
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+		ACL:               s.cannedACL(),
+	})
+	if err != nil {
+		return err
+	}
+	if out.CopyObjectResult == nil {
+		return fmt.Errorf("the copy of %s to %s returned no result", src, dst)
+	}
+
+	// Composite checksums and ETags of multipart uploads end with the number of parts
+	if sum := aws.ToString(head.ChecksumSHA256); sum != "" && !strings.Contains(sum, "-") {
+		return verifyCopy(src, dst, "SHA256 checksum", sum, aws.ToString(out.CopyObjectResult.ChecksumSHA256))
+	}
+	if etag := aws.ToString(head.ETag); !strings.Contains(etag, "-") && head.ServerSideEncryption != types.ServerSideEncryptionAwsKms {
+		return verifyCopy(src, dst, "ETag", etag, aws.ToString(out.CopyObjectResult.ETag))
+	}
+	slog.Debug("the copy is only verified by the ETag precondition", slog.String("key", src), slog.String("etag", aws.ToString(head.ETag)))
+	return nil
+}
+
+// DeleteKey deletes the object with the key relative to the bucket prefix
+func (s *S3Storage) DeleteKey(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(keyPrefix(s.bucketPrefix, key)),
+	})
+	return err
+}
+
+// HealthCheck verifies that the S3 bucket is reachable with the configured credentials.
+// A missing object is not an error, only failing requests are reported.
+func (s *S3Storage) HealthCheck(ctx context.Context) error {
+	_, err := s.objectExists(ctx, path.Join(s.bucketPrefix, healthCheckKey))
+	return err
+}
+
+func (s *S3Storage) String() string { return "s3" }
+
 func (s *S3Storage) objectExists(ctx context.Context, key string) (bool, error) {
+	_, exists, err := s.objectChecksum(ctx, key)
+	return exists, err
+}
+
+// objectChecksum reports whether the object exists and returns the checksum from its metadata, which is empty if it has none
+func (s *S3Storage) objectChecksum(ctx context.Context, key string) (string, bool, error) {
+	if checksum, ok := s.existsCache.lookup(key); ok {
+		return checksum, true, nil
+	}
+
 	input := &s3.HeadObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
 	}
 
-	if _, err := s.client.HeadObject(ctx, input); err != nil {
+	out, err := s.client.HeadObject(ctx, input)
+	if err != nil {
 		var responseError *awshttp.ResponseError
 		if errors.As(err, &responseError) && responseError.ResponseError.HTTPStatusCode() == http.StatusNotFound {
-			return false, nil
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	// S3 returns the metadata keys in lower case
+	checksum := out.Metadata[checksumMetadataKey]
+	if checksum == "" {
+		checksum = nativeChecksum(out.ChecksumSHA256)
+	}
+	s.existsCache.add(key, checksum)
+	return checksum, true, nil
+}
+
+// putObject uploads the object with its SHA256 checksum, so that the checksum is known without downloading the object again.
+// Seekable bodies, like the files of the upload command, are hashed before the upload and the checksum is stored in the sha256 metadata.
+// Other bodies are streamed with the native SHA256 checksum of S3 instead, which is only a checksum of the object if it's uploaded in a single part.
+func (s *S3Storage) putObject(ctx context.Context, input *s3.PutObjectInput) error {
+	var checksum string
+	if rs, ok := input.Body.(io.ReadSeeker); ok {
+		var err error
+		if checksum, err = readSeekerChecksum(rs); err != nil {
+			return err
 		}
-		return false, err
+		input.Metadata = map[string]string{checksumMetadataKey: checksum}
+	} else {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
 	}
 
-	return true, nil
+	out, err := s.uploader.Upload(ctx, input)
+	if err != nil {
+		return err
+	}
+	if checksum == "" && out != nil {
+		checksum = nativeChecksum(out.ChecksumSHA256)
+	}
+	s.existsCache.add(aws.ToString(input.Key), checksum)
+	return nil
+}
+
+// nativeChecksum returns the hex-encoded native SHA256 checksum of an object.
+// Composite checksums of multipart uploads end with the number of parts and aren't checksums of the object, they're returned as empty.
+func nativeChecksum(checksum *string) string {
+	sum := aws.ToString(checksum)
+	if sum == "" || strings.Contains(sum, "-") {
+		return ""
+	}
+	b, err := base64.StdEncoding.DecodeString(sum)
+	if err != nil || len(b) != sha256.Size {
+		return ""
+	}
+	return hex.EncodeToString(b)
 }
 
 func (s *S3Storage) upload(ctx context.Context, key string, reader io.Reader, overwrite bool) error {
@@ -415,15 +1037,33 @@ func (s *S3Storage) upload(ctx context.Context, key string, reader io.Reader, ov
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 		Body:   reader,
+		ACL:    s.cannedACL(),
 	}
 
-	if _, err := s.uploader.Upload(ctx, input); err != nil {
+	if err := s.putObject(ctx, input); err != nil {
 		return fmt.Errorf("failed to upload: %w", err)
 	}
 
 	return nil
 }
 
+// listMaxKeys returns the MaxKeys of listings, nil keeps the default of S3
+func (s *S3Storage) listMaxKeys() *int32 {
+	if s.pageSize <= 0 {
+		return nil
+	}
+	return aws.Int32(int32(s.pageSize))
+}
+
+// cannedACL returns the ACL of uploaded objects. No ACL is sent for private objects,
+// as buckets with the bucket owner enforced object ownership reject requests with ACLs
+func (s *S3Storage) cannedACL() types.ObjectCannedACL {
+	if s.objectACL == ObjectACLPublicRead {
+		return types.ObjectCannedACLPublicRead
+	}
+	return ""
+}
+
 func (s *S3Storage) download(ctx context.Context, key string) ([]byte, error) {
 	buf := s3manager.NewWriteAtBuffer([]byte{})
 
@@ -439,8 +1079,46 @@ func (s *S3Storage) download(ctx context.Context, key string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func (s *S3Storage) GetDownloadUrl(ctx context.Context, url string) (string, error) {
-	return fmt.Sprintf("%s/%s", s.bucketEndpoint, url), nil
+// sequentialWriterAt adapts an io.Writer to the io.WriterAt of the downloader, it requires the parts to be written in order
+type sequentialWriterAt struct {
+	w io.Writer
+}
+
+func (w sequentialWriterAt) WriteAt(p []byte, _ int64) (int, error) {
+	return w.w.Write(p)
+}
+
+// GetDownloadUrl resolves a proxied URL against the host of the pre-signed URLs.
+// Without a custom endpoint, the pre-signed URLs use the virtual-hosted style of AWS S3,
+// unless path style is forced, which places the bucket in the path instead.
+func (s *S3Storage) GetDownloadUrl(ctx context.Context, u string) (string, error) {
+	var base string
+	switch {
+	case s.bucketEndpoint != "":
+		endpoint, err := url.Parse(s.bucketEndpoint)
+		if err != nil || endpoint.Host == "" {
+			return "", fmt.Errorf("invalid bucket endpoint %s", s.bucketEndpoint)
+		}
+		base = fmt.Sprintf("%s://%s/", endpoint.Scheme, endpoint.Host)
+	case s.forcePathStyle:
+		base = fmt.Sprintf("https://s3.%s.amazonaws.com/", s.bucketRegion)
+	default:
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.bucketRegion, u), nil
+	}
+
+	// The MinIO endpoint and the path style place the bucket in the path
+	if !strings.HasPrefix(u, s.bucket+"/") {
+		return "", fmt.Errorf("url %s is not located in bucket %s", u, s.bucket)
+	}
+	return base + u, nil
+}
+
+// WithS3StorageSignedURLHeadroom configures the minimum expiry of the signed urls of proxied downloads.
+// The nearExpiry counter is incremented whenever a shorter expiry is extended, it can be nil.
+func WithS3StorageSignedURLHeadroom(headroom time.Duration, nearExpiry prometheus.Counter) S3StorageOption {
+	return func(s *S3Storage) {
+		s.signedURLHeadroom = signedURLHeadroom{min: headroom, nearExpiry: nearExpiry}
+	}
 }
 
 // S3StorageOption provides additional options for the S3Storage.
@@ -489,11 +1167,56 @@ func WithS3StorageSignedUrlExpiry(t time.Duration) S3StorageOption {
 	}
 }
 
+// WithS3StorageExistenceCacheTTL configures how long the existence of an object is cached. A zero TTL disables the cache
+func WithS3StorageExistenceCacheTTL(ttl time.Duration) S3StorageOption {
+	return func(s *S3Storage) {
+		s.existsCache = newExistenceCache(ttl)
+	}
+}
+
+// WithS3StorageRetryMaxAttempts configures the number of attempts of the AWS SDK for requests failing with transient errors
+func WithS3StorageRetryMaxAttempts(attempts int) S3StorageOption {
+	return func(s *S3Storage) {
+		s.retryMaxAttempts = attempts
+	}
+}
+
+// WithS3StoragePresignConcurrency configures the number of download URLs that are presigned concurrently when listing versions
+func WithS3StoragePresignConcurrency(concurrency int) S3StorageOption {
+	return func(s *S3Storage) {
+		s.presignConcurrency = concurrency
+	}
+}
+
+// WithS3StorageListPageSize configures the MaxKeys of the listings, which aren't limited otherwise. A zero page size keeps the default of S3
+func WithS3StorageListPageSize(size int) S3StorageOption {
+	return func(s *S3Storage) {
+		s.pageSize = size
+	}
+}
+
+// WithS3StorageObjectACL configures the canned ACL of uploaded objects, either private or public-read
+func WithS3StorageObjectACL(acl string) S3StorageOption {
+	return func(s *S3Storage) {
+		s.objectACL = acl
+	}
+}
+
+// WithS3StorageDefaultSigningKeysNamespace configures the namespace whose signing keys are served for providers of namespaces without signing keys
+func WithS3StorageDefaultSigningKeysNamespace(namespace string) S3StorageOption {
+	return func(s *S3Storage) {
+		s.signingKeysFallback = namespace
+	}
+}
+
 // NewS3Storage returns a fully initialized S3 storage.
 func NewS3Storage(ctx context.Context, bucket string, options ...S3StorageOption) (Storage, error) {
 	// Required- and default-values should be set here
 	s := &S3Storage{
-		bucket: bucket,
+		bucket:             bucket,
+		existsCache:        newExistenceCache(DefaultExistenceCacheTTL),
+		retryMaxAttempts:   DefaultRetryMaxAttempts,
+		presignConcurrency: DefaultPresignConcurrency,
 	}
 
 	for _, option := range options {
@@ -515,7 +1238,11 @@ func NewS3Storage(ctx context.Context, bucket string, options ...S3StorageOption
 	})
 
 	// Create the S3 client
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(s.bucketRegion), config.WithEndpointResolverWithOptions(customResolver))
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(s.bucketRegion),
+		config.WithEndpointResolverWithOptions(customResolver),
+		config.WithRetryMaxAttempts(s.retryMaxAttempts),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -3,27 +3,43 @@ package storage
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/boring-registry/boring-registry/pkg/catalog"
 	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/module"
+	"github.com/boring-registry/boring-registry/pkg/provider"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	signer "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	assertion "github.com/stretchr/testify/assert"
 )
 
 type mockS3Client struct {
-	headObject func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	headObject    func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	listObjectsV2 func(ctx context.Context, input *s3.ListObjectsV2Input, f ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	deleteObject  func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	copyObject    func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
 }
 
 func (m *mockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
@@ -31,19 +47,34 @@ func (m *mockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInpu
 }
 
 func (m *mockS3Client) ListObjectsV2(ctx context.Context, input *s3.ListObjectsV2Input, f ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
-	panic("not yet implemented, as we don't have tests using it")
+	if m.listObjectsV2 == nil {
+		panic("not yet implemented, as we don't have tests using it")
+	}
+	return m.listObjectsV2(ctx, input, f...)
 }
 
 func (m *mockS3Client) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
-	panic("not yet implemented, as we don't have tests using it")
+	if m.copyObject == nil {
+		panic("not yet implemented, as we don't have tests using it")
+	}
+	return m.copyObject(ctx, params, optFns...)
+}
+
+func (m *mockS3Client) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if m.deleteObject == nil {
+		panic("not yet implemented, as we don't have tests using it")
+	}
+	return m.deleteObject(ctx, params, optFns...)
 }
 
 type mockS3Uploader struct {
-	b   *bytes.Buffer
-	err error
+	b     *bytes.Buffer
+	input *s3.PutObjectInput
+	err   error
 }
 
 func (m *mockS3Uploader) Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	m.input = input
 	m.b = new(bytes.Buffer)
 	if _, err := io.Copy(m.b, input.Body); err != nil {
 		return nil, err
@@ -92,10 +123,34 @@ func (m *mockS3PresignClient) PresignGetObject(ctx context.Context, params *s3.G
 	}, nil
 }
 
+// expiryRecordingPresignClient records the expiry of the presigned URLs
+type expiryRecordingPresignClient struct {
+	expires time.Duration
+}
+
+func (m *expiryRecordingPresignClient) PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*signer.PresignedHTTPRequest, error) {
+	var opts s3.PresignOptions
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	m.expires = opts.Expires
+	return &signer.PresignedHTTPRequest{URL: *params.Key}, nil
+}
+
 func headExistingObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
 	return &s3.HeadObjectOutput{}, nil
 }
 
+// headExistingObjectExcept reports all objects as existing, except for the missing keys
+func headExistingObjectExcept(missing ...string) func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+		if slices.Contains(missing, *params.Key) {
+			return headNonExistingObject(ctx, params, optFns...)
+		}
+		return headExistingObject(ctx, params, optFns...)
+	}
+}
+
 func headNonExistingObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
 	return nil, &awshttp.ResponseError{
 		ResponseError: &smithyhttp.ResponseError{
@@ -145,6 +200,19 @@ func TestS3Storage_UploadProviderReleaseFiles(t *testing.T) {
 				return !assertion.NoError(t, err)
 			},
 		},
+		{
+			description: "file name leaves the provider directory",
+			namespace:   "hashicorp",
+			name:        "random",
+			filename:    "../../signing-keys.json",
+			content:     "test",
+			client: &mockS3Client{
+				headObject: headNonExistingObject,
+			},
+			wantErr: func(t assertion.TestingT, err error, i ...interface{}) bool {
+				return assertion.ErrorIs(t, err, provider.ErrInvalidFileName)
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -310,7 +378,10 @@ func TestS3Storage_getProvider(t *testing.T) {
 			name: "internal provider exists",
 			fields: fields{
 				client: &mockS3Client{
-					headObject: headExistingObject,
+					headObject: headExistingObjectExcept(
+						"providers/example/dummy/terraform-provider-dummy_1.0.0_signing-keys.json",
+						"providers/example/dummy/signing-keys.json",
+					),
 				},
 				downloader: &mockS3Downloader{
 					data: map[string][]byte{
@@ -415,3 +486,1311 @@ func TestS3Storage_getProvider(t *testing.T) {
 		})
 	}
 }
+
+func TestS3Storage_getProvider_signingKeysFallback(t *testing.T) {
+	const (
+		namespaceKeys = `{"gpg_public_keys":[{"key_id":"47422B4AA9FA381B","ascii_armor":"namespace"}]}`
+		defaultKeys   = `{"gpg_public_keys":[{"key_id":"51852D87348FFC4C","ascii_armor":"default"}]}`
+		providerKeys  = `{"gpg_public_keys":[{"key_id":"34365D9472D7468F","ascii_armor":"provider"}]}`
+		versionKeys   = `{"gpg_public_keys":[{"key_id":"72D7468F34365D94","ascii_armor":"version"}]}`
+	)
+
+	tests := []struct {
+		name             string
+		files            map[string]string
+		defaultNamespace string
+		wantKeyID        string
+		wantErr          error
+	}{
+		{
+			name: "namespace keys are used if present",
+			files: map[string]string{
+				"providers/example/signing-keys.json": namespaceKeys,
+				"providers/acme/signing-keys.json":    defaultKeys,
+			},
+			defaultNamespace: "acme",
+			wantKeyID:        "47422B4AA9FA381B",
+		},
+		{
+			name: "default namespace keys are used if the namespace doesn't have any",
+			files: map[string]string{
+				"providers/acme/signing-keys.json": defaultKeys,
+			},
+			defaultNamespace: "acme",
+			wantKeyID:        "51852D87348FFC4C",
+		},
+		{
+			name: "no fallback without a default namespace",
+			files: map[string]string{
+				"providers/acme/signing-keys.json": defaultKeys,
+			},
+			wantErr: core.ErrObjectNotFound,
+		},
+		{
+			name:             "default namespace without keys",
+			defaultNamespace: "acme",
+			wantErr:          core.ErrObjectNotFound,
+		},
+		{
+			name: "provider keys override the namespace keys",
+			files: map[string]string{
+				"providers/example/signing-keys.json":       namespaceKeys,
+				"providers/example/dummy/signing-keys.json": providerKeys,
+			},
+			wantKeyID: "34365D9472D7468F",
+		},
+		{
+			name: "version keys override the provider and namespace keys",
+			files: map[string]string{
+				"providers/example/signing-keys.json":                                      namespaceKeys,
+				"providers/example/dummy/signing-keys.json":                                providerKeys,
+				"providers/example/dummy/terraform-provider-dummy_1.0.0_signing-keys.json": versionKeys,
+			},
+			wantKeyID: "72D7468F34365D94",
+		},
+		{
+			name: "version keys take precedence over the default namespace",
+			files: map[string]string{
+				"providers/example/dummy/terraform-provider-dummy_1.0.0_signing-keys.json": versionKeys,
+				"providers/acme/signing-keys.json":                                         defaultKeys,
+			},
+			defaultNamespace: "acme",
+			wantKeyID:        "72D7468F34365D94",
+		},
+		{
+			name: "keys of other versions are ignored",
+			files: map[string]string{
+				"providers/example/signing-keys.json":                                      namespaceKeys,
+				"providers/example/dummy/terraform-provider-dummy_2.0.0_signing-keys.json": versionKeys,
+			},
+			wantKeyID: "47422B4AA9FA381B",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string][]byte{
+				"providers/example/dummy/terraform-provider-dummy_1.0.0_SHA256SUMS": []byte("10488a12525ed674359585f83e3ee5e74818b5c98e033798351678b21b2f7d89  terraform-provider-dummy_1.0.0_linux_amd64.zip"),
+			}
+			for k, v := range tt.files {
+				data[k] = []byte(v)
+			}
+			headObject := func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+				if _, ok := data[*params.Key]; ok || strings.HasSuffix(*params.Key, ".zip") || strings.HasSuffix(*params.Key, ".sig") {
+					return headExistingObject(ctx, params, optFns...)
+				}
+				return headNonExistingObject(ctx, params, optFns...)
+			}
+			s := &S3Storage{
+				client:        &mockS3Client{headObject: headObject},
+				presignClient: &mockS3PresignClient{},
+				downloader:    &mockS3Downloader{data: data},
+			}
+			WithS3StorageDefaultSigningKeysNamespace(tt.defaultNamespace)(s)
+
+			p, err := s.GetProvider(context.Background(), "example", "dummy", "1.0.0", "linux", "amd64")
+			if tt.wantErr != nil {
+				assertion.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assertion.NoError(t, err)
+			assertion.Equal(t, tt.wantKeyID, p.SigningKeys.GPGPublicKeys[0].KeyID)
+
+			// Signing keys of the namespace itself are never replaced by the fallback
+			_, err = s.SigningKeys(context.Background(), "example")
+			if _, ok := tt.files["providers/example/signing-keys.json"]; !ok {
+				assertion.ErrorIs(t, err, core.ErrObjectNotFound)
+			}
+		})
+	}
+}
+
+func TestS3Storage_HealthCheck(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		description string
+		client      s3ClientAPI
+		wantErr     bool
+	}{
+		{
+			description: "health check object exists",
+			client:      &mockS3Client{headObject: headExistingObject},
+		},
+		{
+			description: "health check object doesn't exist",
+			client:      &mockS3Client{headObject: headNonExistingObject},
+		},
+		{
+			description: "bucket is not accessible",
+			client: &mockS3Client{
+				headObject: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+					return nil, errors.New("access denied")
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			s := &S3Storage{client: tc.client}
+			err := s.HealthCheck(context.Background())
+			if tc.wantErr {
+				assertion.Error(t, err)
+			} else {
+				assertion.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestS3Storage_objectACL(t *testing.T) {
+	uploads := map[string]func(s *S3Storage) error{
+		"module": func(s *S3Storage) error {
+			_, err := s.UploadModule(context.Background(), "acme", "vpc", "aws", "1.0.0", strings.NewReader("archive"))
+			return err
+		},
+		"provider": func(s *S3Storage) error {
+			return s.UploadProviderReleaseFiles(context.Background(), "hashicorp", "random", "terraform-provider-random_2.0.0_linux_amd64.zip", strings.NewReader("archive"))
+		},
+		"mirrored file": func(s *S3Storage) error {
+			p := &core.Provider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random"}
+			return s.UploadMirroredFile(context.Background(), p, "terraform-provider-random_2.0.0_linux_amd64.zip", strings.NewReader("archive"))
+		},
+	}
+
+	for name, upload := range uploads {
+		for acl, want := range map[string]types.ObjectCannedACL{
+			"":                  "",
+			ObjectACLPrivate:    "",
+			ObjectACLPublicRead: types.ObjectCannedACLPublicRead,
+		} {
+			t.Run(name+" "+acl, func(t *testing.T) {
+				u := &mockS3Uploader{}
+				headObject := func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+					if u.b != nil {
+						return headExistingObject(ctx, params, optFns...)
+					}
+					return headNonExistingObject(ctx, params, optFns...)
+				}
+				s := &S3Storage{
+					client:              &mockS3Client{headObject: headObject},
+					uploader:            u,
+					presignClient:       &mockS3PresignClient{},
+					moduleArchiveFormat: DefaultModuleArchiveFormat,
+				}
+				WithS3StorageObjectACL(acl)(s)
+
+				assertion.NoError(t, upload(s))
+				assertion.Equal(t, want, u.input.ACL)
+			})
+		}
+	}
+}
+
+func TestS3Storage_UploadModule(t *testing.T) {
+	t.Parallel()
+
+	stored := []byte("stored archive")
+	key := modulePath("", "acme", "vpc", "aws", "1.0.0", DefaultModuleArchiveFormat)
+
+	testCases := []struct {
+		description  string
+		content      string
+		exists       bool
+		wantErr      error
+		wantUploaded bool
+	}{
+		{
+			description:  "new version",
+			content:      "new archive",
+			wantUploaded: true,
+		},
+		{
+			description: "existing version with identical content",
+			content:     string(stored),
+			exists:      true,
+		},
+		{
+			description: "existing version with different content",
+			content:     "changed archive",
+			exists:      true,
+			wantErr:     module.ErrModuleContentMismatch,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			u := &mockS3Uploader{}
+			headObject := func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+				if tc.exists || u.b != nil {
+					return headExistingObject(ctx, params, optFns...)
+				}
+				return headNonExistingObject(ctx, params, optFns...)
+			}
+			s := S3Storage{
+				client:              &mockS3Client{headObject: headObject},
+				uploader:            u,
+				downloader:          &mockS3Downloader{data: map[string][]byte{key: stored}},
+				presignClient:       &mockS3PresignClient{},
+				moduleArchiveFormat: DefaultModuleArchiveFormat,
+			}
+
+			m, err := s.UploadModule(context.Background(), "acme", "vpc", "aws", "1.0.0", strings.NewReader(tc.content))
+			if tc.wantErr != nil {
+				assertion.ErrorIs(t, err, tc.wantErr)
+				assertion.Nil(t, u.b)
+				return
+			}
+			assertion.NoError(t, err)
+			assertion.Equal(t, "1.0.0", m.Version)
+			if tc.wantUploaded {
+				assertion.Equal(t, tc.content, u.b.String())
+			} else {
+				assertion.Nil(t, u.b, "an identical archive must not be uploaded again")
+			}
+		})
+	}
+}
+
+// objectsS3Uploader keeps the inputs of the uploads per key and computes the native SHA256 checksum if it's requested, like S3 for single part uploads
+type objectsS3Uploader struct {
+	objects map[string]*s3.PutObjectInput
+}
+
+func (u *objectsS3Uploader) Upload(_ context.Context, input *s3.PutObjectInput, _ ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	b, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	u.objects[*input.Key] = input
+	out := &s3manager.UploadOutput{}
+	if input.ChecksumAlgorithm == types.ChecksumAlgorithmSha256 {
+		sum := sha256.Sum256(b)
+		out.ChecksumSHA256 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	return out, nil
+}
+
+func TestS3Storage_uploadChecksum(t *testing.T) {
+	t.Parallel()
+
+	// SHA-256 of "test"
+	const checksum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	moduleKey := modulePath("", "acme", "vpc", "aws", "1.0.0", DefaultModuleArchiveFormat)
+	providerKey := "providers/hashicorp/random/terraform-provider-random_2.0.0_linux_amd64.zip"
+
+	u := &objectsS3Uploader{objects: make(map[string]*s3.PutObjectInput)}
+	newStorage := func() *S3Storage {
+		return &S3Storage{
+			client: &mockS3Client{
+				headObject: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+					assertion.Equal(t, types.ChecksumModeEnabled, params.ChecksumMode)
+					input, ok := u.objects[*params.Key]
+					if !ok {
+						return headNonExistingObject(ctx, params, optFns...)
+					}
+					out := &s3.HeadObjectOutput{Metadata: input.Metadata}
+					if input.ChecksumAlgorithm == types.ChecksumAlgorithmSha256 {
+						out.ChecksumSHA256 = aws.String("n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=")
+					}
+					return out, nil
+				},
+			},
+			uploader:            u,
+			downloader:          &mockS3Downloader{error: true},
+			presignClient:       &mockS3PresignClient{},
+			bucket:              "bucket",
+			moduleArchiveFormat: DefaultModuleArchiveFormat,
+		}
+	}
+	s := newStorage()
+
+	// Seekable bodies are hashed before the upload, so the checksum is sent as metadata of the upload
+	m, err := s.UploadModule(context.Background(), "acme", "vpc", "aws", "1.0.0", strings.NewReader("test"))
+	assertion.NoError(t, err)
+	assertion.Equal(t, map[string]string{checksumMetadataKey: checksum}, u.objects[moduleKey].Metadata)
+	assertion.Empty(t, u.objects[moduleKey].ChecksumAlgorithm)
+	assertion.Equal(t, checksum, m.Checksum)
+
+	// An identical archive is compared to the stored checksum instead of being downloaded
+	_, err = s.UploadModule(context.Background(), "acme", "vpc", "aws", "1.0.0", strings.NewReader("test"))
+	assertion.NoError(t, err)
+	_, err = s.UploadModule(context.Background(), "acme", "vpc", "aws", "1.0.0", strings.NewReader("changed"))
+	assertion.ErrorIs(t, err, module.ErrModuleContentMismatch)
+
+	// Streamed bodies are uploaded with the native checksum of S3
+	streamed := struct{ io.Reader }{strings.NewReader("test")}
+	assertion.NoError(t, s.UploadProviderReleaseFiles(context.Background(), "hashicorp", "random", "terraform-provider-random_2.0.0_linux_amd64.zip", streamed))
+	assertion.Nil(t, u.objects[providerKey].Metadata)
+	assertion.Equal(t, types.ChecksumAlgorithmSha256, u.objects[providerKey].ChecksumAlgorithm)
+
+	for _, s := range []*S3Storage{s, newStorage()} {
+		sum, err := s.ProviderReleaseFileChecksum(context.Background(), "hashicorp", "random", "terraform-provider-random_2.0.0_linux_amd64.zip")
+		assertion.NoError(t, err)
+		assertion.Equal(t, checksum, hex.EncodeToString(sum))
+	}
+
+	_, err = s.ProviderReleaseFileChecksum(context.Background(), "hashicorp", "random", "terraform-provider-random_2.0.0_darwin_arm64.zip")
+	assertion.ErrorIs(t, err, core.ErrObjectNotFound)
+
+	// Composite checksums of multipart uploads aren't checksums of the object
+	assertion.Empty(t, nativeChecksum(aws.String("n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=-3")))
+}
+
+func TestS3Storage_zstdModuleArchive(t *testing.T) {
+	t.Parallel()
+
+	key := modulePath("registry", "acme", "vpc", "aws", "1.0.0", "tar.zst")
+	u := &mockS3Uploader{}
+	s := S3Storage{
+		client: &mockS3Client{
+			headObject: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+				if u.b != nil && *params.Key == key {
+					return headExistingObject(ctx, params, optFns...)
+				}
+				return headNonExistingObject(ctx, params, optFns...)
+			},
+			listObjectsV2: func(ctx context.Context, input *s3.ListObjectsV2Input, f ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+				return &s3.ListObjectsV2Output{
+					Contents: []types.Object{
+						{Key: aws.String(key)},
+						// Archives in other formats aren't served
+						{Key: aws.String(modulePath("registry", "acme", "vpc", "aws", "0.9.0", DefaultModuleArchiveFormat))},
+					},
+				}, nil
+			},
+		},
+		uploader:            u,
+		presignClient:       &mockS3PresignClient{},
+		bucketPrefix:        "registry",
+		moduleArchiveFormat: "tar.zst",
+	}
+
+	uploaded, err := s.UploadModule(context.Background(), "acme", "vpc", "aws", "1.0.0", strings.NewReader("zstd archive"))
+	assertion.NoError(t, err)
+	assertion.Equal(t, "zstd archive", u.b.String())
+	assertion.Equal(t, key+"?presigned=true", uploaded.DownloadURL)
+
+	m, err := s.GetModule(context.Background(), "acme", "vpc", "aws", "1.0.0")
+	assertion.NoError(t, err)
+	assertion.Equal(t, key+"?presigned=true", m.DownloadURL)
+
+	versions, err := s.ListModuleVersions(context.Background(), "acme", "vpc", "aws")
+	assertion.NoError(t, err)
+	assertion.Equal(t, []core.Module{
+		{Namespace: "acme", Name: "vpc", Provider: "aws", Version: "1.0.0", DownloadURL: key + "?presigned=true"},
+	}, versions)
+}
+
+func TestS3Storage_GetModule_existenceCache(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		description string
+		cache       *existenceCache
+		exists      bool
+		wantHeads   int
+	}{
+		{
+			description: "cached existing module",
+			cache:       newExistenceCache(time.Minute),
+			exists:      true,
+			wantHeads:   1,
+		},
+		{
+			description: "disabled cache",
+			exists:      true,
+			wantHeads:   2,
+		},
+		{
+			description: "missing module is not cached",
+			cache:       newExistenceCache(time.Minute),
+			wantHeads:   2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			heads := 0
+			headObject := func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+				heads++
+				if tc.exists {
+					return headExistingObject(ctx, params, optFns...)
+				}
+				return headNonExistingObject(ctx, params, optFns...)
+			}
+			s := S3Storage{
+				client:              &mockS3Client{headObject: headObject},
+				presignClient:       &mockS3PresignClient{},
+				moduleArchiveFormat: DefaultModuleArchiveFormat,
+				existsCache:         tc.cache,
+			}
+
+			for i := 0; i < 2; i++ {
+				_, err := s.GetModule(context.Background(), "acme", "vpc", "aws", "1.0.0")
+				if tc.exists {
+					assertion.NoError(t, err)
+				} else {
+					assertion.ErrorIs(t, err, module.ErrModuleNotFound)
+				}
+			}
+			assertion.Equal(t, tc.wantHeads, heads)
+		})
+	}
+}
+
+func TestS3Storage_ProviderDocs(t *testing.T) {
+	t.Parallel()
+
+	docs := []byte(`{"readme":"# random"}`)
+	key := "providers/hashicorp/random/terraform-provider-random_3.6.0_metadata.json"
+
+	testCases := []struct {
+		description string
+		client      s3ClientAPI
+		wantExists  bool
+		wantDocs    []byte
+		wantErr     error
+	}{
+		{
+			description: "docs exist",
+			client:      &mockS3Client{headObject: headExistingObject},
+			wantExists:  true,
+			wantDocs:    docs,
+		},
+		{
+			description: "docs don't exist",
+			client:      &mockS3Client{headObject: headNonExistingObject},
+			wantErr:     core.ErrObjectNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			s := &S3Storage{
+				client:     tc.client,
+				downloader: &mockS3Downloader{data: map[string][]byte{key: docs}},
+			}
+
+			exists, err := s.ProviderDocsExist(context.Background(), "hashicorp", "random", "3.6.0")
+			assertion.NoError(t, err)
+			assertion.Equal(t, tc.wantExists, exists)
+
+			got, err := s.ProviderDocs(context.Background(), "hashicorp", "random", "3.6.0")
+			assertion.ErrorIs(t, err, tc.wantErr)
+			assertion.Equal(t, tc.wantDocs, got)
+		})
+	}
+}
+
+func TestS3Storage_ListKeys(t *testing.T) {
+	assert := assertion.New(t)
+
+	// Two pages of keys, the second page must not be requested once the limit is reached
+	pages := map[string]*s3.ListObjectsV2Output{
+		"": {
+			Contents: []types.Object{
+				{Key: aws.String("team/providers/acme/dummy/terraform-provider-dummy_1.0.0_SHA256SUMS")},
+				{Key: aws.String("team/providers/acme/dummy/terraform-provider-dummy_1.0.0_linux_amd64.zip")},
+			},
+			IsTruncated:           aws.Bool(true),
+			NextContinuationToken: aws.String("page-2"),
+		},
+		"page-2": {
+			Contents: []types.Object{
+				{Key: aws.String("team/providers/acme/dummy/terraform-provider-dummy_1.0.0_darwin_arm64.zip")},
+			},
+		},
+	}
+	var prefixes []string
+	s := &S3Storage{
+		bucketPrefix: "team",
+		client: &mockS3Client{
+			listObjectsV2: func(_ context.Context, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+				prefixes = append(prefixes, *input.Prefix)
+				return pages[aws.ToString(input.ContinuationToken)], nil
+			},
+		},
+	}
+
+	keys, err := s.ListKeys(context.Background(), "providers/acme/", 3)
+	assert.NoError(err)
+	assert.Len(keys, 3)
+	assert.Equal([]string{"team/providers/acme/", "team/providers/acme/"}, prefixes)
+
+	prefixes = nil
+	keys, err = s.ListKeys(context.Background(), "providers/acme/", 1)
+	assert.NoError(err)
+	assert.Equal([]string{"team/providers/acme/dummy/terraform-provider-dummy_1.0.0_SHA256SUMS"}, keys)
+	assert.Len(prefixes, 1)
+}
+
+func TestS3Storage_ListProviderVersionsPage(t *testing.T) {
+	assert := assertion.New(t)
+
+	// The keys of the versions are split across native pages of three keys, so that versions span multiple pages
+	prefix := "providers/acme/dummy/"
+	var keys []string
+	var wantVersions []string
+	for _, version := range []string{"1.0.0", "1.1.0", "1.2.0", "2.0.0", "2.1.0"} {
+		wantVersions = append(wantVersions, version)
+		keys = append(keys,
+			fmt.Sprintf("%sterraform-provider-dummy_%s_SHA256SUMS", prefix, version),
+			fmt.Sprintf("%sterraform-provider-dummy_%s_SHA256SUMS.sig", prefix, version),
+			fmt.Sprintf("%sterraform-provider-dummy_%s_darwin_arm64.zip", prefix, version),
+			fmt.Sprintf("%sterraform-provider-dummy_%s_linux_amd64.zip", prefix, version),
+		)
+	}
+	s := &S3Storage{
+		client: &mockS3Client{
+			listObjectsV2: func(_ context.Context, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+				start := 0
+				if input.ContinuationToken != nil {
+					fmt.Sscanf(*input.ContinuationToken, "page-%d", &start)
+				}
+				end := min(start+3, len(keys))
+				out := &s3.ListObjectsV2Output{}
+				for _, key := range keys[start:end] {
+					out.Contents = append(out.Contents, types.Object{Key: aws.String(key)})
+				}
+				if end < len(keys) {
+					out.NextContinuationToken = aws.String(fmt.Sprintf("page-%d", end))
+				}
+				return out, nil
+			},
+		},
+	}
+
+	iterate := func() ([]string, []string) {
+		var versions, tokens []string
+		token := ""
+		for {
+			page, next, err := s.ListProviderVersionsPage(context.Background(), "acme", "dummy", 2, token)
+			assert.NoError(err)
+			assert.LessOrEqual(len(page.Versions), 2)
+			for _, v := range page.Versions {
+				assert.Equal([]core.Platform{{OS: "darwin", Arch: "arm64"}, {OS: "linux", Arch: "amd64"}}, v.Platforms)
+				versions = append(versions, v.Version)
+			}
+			if next == "" {
+				return versions, tokens
+			}
+			tokens = append(tokens, next)
+			token = next
+		}
+	}
+
+	versions, tokens := iterate()
+	assert.Equal(wantVersions, versions)
+	assert.Len(tokens, 2)
+
+	// The pages are stable across iterations
+	versions, secondTokens := iterate()
+	assert.Equal(wantVersions, versions)
+	assert.Equal(tokens, secondTokens)
+
+	_, _, err := s.ListProviderVersionsPage(context.Background(), "acme", "dummy", 2, "not-a-token")
+	assert.ErrorIs(err, catalog.ErrInvalidCursor)
+}
+
+func TestS3Storage_ListModulesByProvider(t *testing.T) {
+	assert := assertion.New(t)
+
+	keys := []string{
+		"team/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz",
+		"team/modules/acme/vpc/aws/acme-vpc-aws-1.1.0.tar.gz",
+		"team/modules/acme/vpc/google/acme-vpc-google-1.0.0.tar.gz",
+		"team/modules/acme/dns/azurerm/acme-dns-azurerm-1.0.0.tar.gz",
+		"team/modules/acme/eks/aws/acme-eks-aws-2.0.0.tar.gz",
+		"team/modules/beta/network/aws/beta-network-aws-0.1.0.tar.gz",
+		"team/modules/gamma/bucket/google/gamma-bucket-google-1.0.0.tar.gz",
+		"team/modules/zeta/awsx/awscc/zeta-awsx-awscc-1.0.0.tar.gz",
+		"team/modules/zeta/vpc/aws/zeta-vpc-aws-3.0.0.tar.gz",
+		"team/providers/acme/aws/terraform-provider-aws_1.0.0_linux_amd64.zip",
+	}
+	var listings int
+	s := &S3Storage{
+		bucketPrefix: "team",
+		client: &mockS3Client{
+			listObjectsV2: func(_ context.Context, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+				listings++
+				out := &s3.ListObjectsV2Output{}
+				seen := make(map[string]bool)
+				for _, key := range keys {
+					rest, ok := strings.CutPrefix(key, *input.Prefix)
+					if !ok {
+						continue
+					}
+					if input.Delimiter != nil {
+						if dir, _, ok := strings.Cut(rest, *input.Delimiter); ok {
+							if !seen[dir] {
+								seen[dir] = true
+								out.CommonPrefixes = append(out.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(*input.Prefix + dir + "/")})
+							}
+							continue
+						}
+					}
+					out.Contents = append(out.Contents, types.Object{Key: aws.String(key)})
+				}
+				return out, nil
+			},
+		},
+	}
+
+	var got []string
+	var tokens []string
+	token := ""
+	for {
+		modules, next, err := s.ListModulesByProvider(context.Background(), "aws", 2, token)
+		assert.NoError(err)
+		assert.LessOrEqual(len(modules), 2)
+		for _, m := range modules {
+			assert.Equal("aws", m.Provider)
+			assert.Empty(m.Version)
+			got = append(got, m.ID(false))
+		}
+		if next == "" {
+			break
+		}
+		tokens = append(tokens, next)
+		token = next
+	}
+	assert.Equal([]string{"acme/eks/aws", "acme/vpc/aws", "beta/network/aws", "zeta/vpc/aws"}, got)
+	assert.Len(tokens, 1)
+
+	listings = 0
+	modules, next, err := s.ListModulesByProvider(context.Background(), "google", 1, "")
+	assert.NoError(err)
+	assert.Equal([]core.Module{{Namespace: "acme", Name: "vpc", Provider: "google"}}, modules)
+	assert.NotEmpty(next)
+	// The namespaces and the module names of acme are listed, the second match ends the page in the gamma namespace
+	assert.Equal(9, listings)
+
+	_, _, err = s.ListModulesByProvider(context.Background(), "aws", 2, "not a token")
+	assert.ErrorIs(err, module.ErrInvalidQuery)
+}
+
+func Test_listModulesByProvider_maxProbes(t *testing.T) {
+	assert := assertion.New(t)
+
+	// Only the last of the modules of the namespace is a module of the provider
+	names := make([]string, 2*maxModuleProbes)
+	for i := range names {
+		names[i] = fmt.Sprintf("modules/acme/module-%04d/", i)
+	}
+	list := func(_ context.Context, prefix string) ([]string, error) {
+		if prefix == "modules/" {
+			return []string{"modules/acme/"}, nil
+		}
+		return names, nil
+	}
+	var probes int
+	exists := func(_ context.Context, prefix string) (bool, error) {
+		probes++
+		return prefix == names[len(names)-1]+"aws/", nil
+	}
+
+	var pages int
+	var got []core.Module
+	token := ""
+	for {
+		modules, next, err := listModulesByProvider(context.Background(), "modules/", "aws", 10, token, list, exists)
+		assert.NoError(err)
+		pages++
+		got = append(got, modules...)
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	assert.Equal([]core.Module{{Namespace: "acme", Name: fmt.Sprintf("module-%04d", len(names)-1), Provider: "aws"}}, got)
+	// Every module is checked once, even though the pages end early
+	assert.Equal(len(names), probes)
+	assert.Equal(3, pages)
+}
+
+func TestS3Storage_listPageSize(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		description string
+		pageSize    int
+		want        *int32
+	}{
+		{
+			description: "default of S3",
+		},
+		{
+			description: "configured page size",
+			pageSize:    250,
+			want:        aws.Int32(250),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var inputs []*s3.ListObjectsV2Input
+			s := &S3Storage{
+				client: &mockS3Client{
+					listObjectsV2: func(ctx context.Context, input *s3.ListObjectsV2Input, f ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+						inputs = append(inputs, input)
+						return &s3.ListObjectsV2Output{}, nil
+					},
+				},
+				moduleArchiveFormat: DefaultModuleArchiveFormat,
+			}
+			WithS3StorageListPageSize(tc.pageSize)(s)
+
+			_, err := s.ListModuleVersions(context.Background(), "acme", "vpc", "aws")
+			assertion.NoError(t, err)
+			_, err = s.ListProviderPlatforms(context.Background(), "hashicorp", "random", "2.0.0")
+			assertion.Error(t, err, "a version without archives isn't found")
+			_, err = s.ListAllKeys(context.Background())
+			assertion.NoError(t, err)
+
+			assertion.Len(t, inputs, 3)
+			for _, input := range inputs {
+				assertion.Equal(t, tc.want, input.MaxKeys)
+			}
+		})
+	}
+}
+
+func TestS3Storage_storagePrefixOfContext(t *testing.T) {
+	assert := assertion.New(t)
+
+	var keys []string
+	s := S3Storage{
+		bucketPrefix: "team",
+		client: &mockS3Client{headObject: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			keys = append(keys, *params.Key)
+			return headNonExistingObject(ctx, params, optFns...)
+		}},
+		moduleArchiveFormat: DefaultModuleArchiveFormat,
+	}
+
+	for _, ctx := range []context.Context{
+		context.Background(),
+		core.ContextWithStoragePrefix(context.Background(), "terraform"),
+		core.ContextWithStoragePrefix(context.Background(), "tofu"),
+	} {
+		_, err := s.GetModule(ctx, "acme", "vpc", "aws", "1.0.0")
+		assert.ErrorIs(err, module.ErrModuleNotFound)
+	}
+	assert.Equal([]string{
+		"team/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz",
+		"team/terraform/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz",
+		"team/tofu/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz",
+	}, keys)
+}
+
+func TestS3Storage_ListProviderPlatforms(t *testing.T) {
+	assert := assertion.New(t)
+
+	prefix := "providers/acme/dummy/"
+	var keys []string
+	for _, file := range []string{
+		"terraform-provider-dummy_1.0.0_SHA256SUMS",
+		"terraform-provider-dummy_1.0.0_SHA256SUMS.sig",
+		"terraform-provider-dummy_1.0.0_darwin_arm64.zip",
+		"terraform-provider-dummy_1.0.0_linux_amd64.zip",
+		"terraform-provider-dummy_1.0.0_windows_amd64.zip",
+		"terraform-provider-dummy_1.0.0-beta_linux_arm64.zip",
+		"terraform-provider-dummy_1.0.1_linux_arm64.zip",
+	} {
+		keys = append(keys, prefix+file)
+	}
+
+	var listed []string
+	s := &S3Storage{
+		client: &mockS3Client{
+			listObjectsV2: func(_ context.Context, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+				listed = append(listed, *input.Prefix)
+				out := &s3.ListObjectsV2Output{}
+				for _, key := range keys {
+					if strings.HasPrefix(key, *input.Prefix) {
+						out.Contents = append(out.Contents, types.Object{Key: aws.String(key)})
+					}
+				}
+				return out, nil
+			},
+		},
+	}
+
+	platforms, err := s.ListProviderPlatforms(context.Background(), "acme", "dummy", "1.0.0")
+	assert.NoError(err)
+	assert.Equal([]core.Platform{
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64"},
+		{OS: "windows", Arch: "amd64"},
+	}, platforms)
+	// Only the files of the version are listed
+	assert.Equal([]string{prefix + "terraform-provider-dummy_1.0.0_"}, listed)
+
+	platforms, err = s.ListProviderPlatforms(context.Background(), "acme", "dummy", "1.0.0-beta")
+	assert.NoError(err)
+	assert.Equal([]core.Platform{{OS: "linux", Arch: "arm64"}}, platforms)
+
+	_, err = s.ListProviderPlatforms(context.Background(), "acme", "dummy", "2.0.0")
+	var providerError *core.ProviderError
+	assert.ErrorAs(err, &providerError)
+	assert.Equal(http.StatusNotFound, providerError.StatusCode)
+}
+
+// slowPresignClient takes delay for every presigned URL, like a presign client that has to refresh its credentials
+type slowPresignClient struct {
+	delay time.Duration
+}
+
+func (c *slowPresignClient) PresignGetObject(ctx context.Context, params *s3.GetObjectInput, _ ...func(*s3.PresignOptions)) (*signer.PresignedHTTPRequest, error) {
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &signer.PresignedHTTPRequest{URL: fmt.Sprintf("%s?presigned=true", *params.Key)}, nil
+}
+
+func TestS3Storage_concurrentPresigning(t *testing.T) {
+	assert := assertion.New(t)
+
+	const (
+		versions = 32
+		delay    = 20 * time.Millisecond
+	)
+
+	var moduleKeys, providerKeys []string
+	for i := range versions {
+		moduleKeys = append(moduleKeys, fmt.Sprintf("modules/acme/vpc/aws/acme-vpc-aws-1.%d.0.tar.gz", i))
+		providerKeys = append(providerKeys, fmt.Sprintf("providers/acme/dummy/terraform-provider-dummy_1.%d.0_linux_amd64.zip", i))
+	}
+	s := &S3Storage{
+		client: &mockS3Client{
+			listObjectsV2: func(_ context.Context, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+				keys := providerKeys
+				if strings.HasPrefix(*input.Prefix, "modules/") {
+					keys = moduleKeys
+				}
+				out := &s3.ListObjectsV2Output{}
+				for _, key := range keys {
+					out.Contents = append(out.Contents, types.Object{Key: aws.String(key)})
+				}
+				return out, nil
+			},
+		},
+		presignClient:       &slowPresignClient{delay: delay},
+		moduleArchiveFormat: "tar.gz",
+		presignConcurrency:  DefaultPresignConcurrency,
+	}
+
+	start := time.Now()
+	modules, err := s.ListModuleVersions(context.Background(), "acme", "vpc", "aws")
+	assert.NoError(err)
+	// Presigning sequentially takes versions*delay, the workers need about versions/concurrency*delay
+	assert.Less(time.Since(start), versions*delay/2)
+	assert.Len(modules, versions)
+	for i, m := range modules {
+		assert.Equal(moduleKeys[i]+"?presigned=true", m.DownloadURL)
+	}
+
+	start = time.Now()
+	providers, err := s.ListMirroredProviders(context.Background(), &core.Provider{Hostname: "registry.example.com", Namespace: "acme", Name: "dummy"})
+	assert.NoError(err)
+	assert.Less(time.Since(start), versions*delay/2)
+	assert.Len(providers, versions)
+	for i, p := range providers {
+		assert.Equal(fmt.Sprintf("1.%d.0", i), p.Version)
+		assert.Equal(providerKeys[i]+"?presigned=true", p.DownloadURL)
+	}
+}
+
+// conditionalS3Uploader keeps the uploaded objects and rejects uploads with If-None-Match: * of existing objects like S3
+type conditionalS3Uploader struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	// lostResponse stores the next upload but fails it, like a retry of an upload whose response was lost
+	lostResponse bool
+}
+
+// conditionalETag returns the ETag of an object of the conditionalS3Uploader
+func conditionalETag(b []byte) string {
+	return fmt.Sprintf("%q", fmt.Sprintf("%x", sha256.Sum256(b)))
+}
+
+func conditionalS3Error(statusCode int) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}},
+		},
+	}
+}
+
+func (u *conditionalS3Uploader) HeadObject(_ context.Context, params *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	b, ok := u.objects[*params.Key]
+	if !ok {
+		return nil, conditionalS3Error(http.StatusNotFound)
+	}
+	return &s3.HeadObjectOutput{ETag: aws.String(conditionalETag(b))}, nil
+}
+
+func (u *conditionalS3Uploader) Download(_ context.Context, w io.WriterAt, input *s3.GetObjectInput, _ ...func(*s3manager.Downloader)) (int64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	b, ok := u.objects[*input.Key]
+	if !ok {
+		return 0, &types.NoSuchKey{}
+	}
+	if input.IfMatch != nil && *input.IfMatch != conditionalETag(b) {
+		return 0, conditionalS3Error(http.StatusPreconditionFailed)
+	}
+	n, err := w.WriteAt(b, 0)
+	return int64(n), err
+}
+
+func (u *conditionalS3Uploader) Upload(_ context.Context, input *s3.PutObjectInput, _ ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	b, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.objects[*input.Key]; ok && aws.ToString(input.IfNoneMatch) == "*" {
+		return nil, &awshttp.ResponseError{
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusPreconditionFailed}},
+			},
+		}
+	}
+	u.objects[*input.Key] = b
+	if u.lostResponse {
+		u.lostResponse = false
+		return nil, &awshttp.ResponseError{
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusPreconditionFailed}},
+			},
+		}
+	}
+	return &s3manager.UploadOutput{}, nil
+}
+
+func (u *conditionalS3Uploader) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if b, ok := u.objects[*params.Key]; ok && params.IfMatch != nil && *params.IfMatch != conditionalETag(b) {
+		return nil, conditionalS3Error(http.StatusPreconditionFailed)
+	}
+	delete(u.objects, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestS3Storage_LockProviderVersion(t *testing.T) {
+	assert := assertion.New(t)
+
+	uploader := &conditionalS3Uploader{objects: make(map[string][]byte)}
+	newStorage := func() *S3Storage {
+		return &S3Storage{
+			client:     &mockS3Client{headObject: uploader.HeadObject, deleteObject: uploader.DeleteObject},
+			uploader:   uploader,
+			downloader: uploader,
+			bucket:     "boring-registry",
+		}
+	}
+	s := newStorage()
+	ctx := context.Background()
+
+	// Only one of the concurrent uploads acquires the lock
+	const uploads = 10
+	errs := make([]error, uploads)
+	var wg sync.WaitGroup
+	for i := range uploads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.LockProviderVersion(ctx, "acme", "dummy", "1.0.0")
+		}()
+	}
+	wg.Wait()
+
+	acquired := 0
+	for _, err := range errs {
+		if err == nil {
+			acquired++
+		} else {
+			assert.ErrorIs(err, core.ErrUploadInProgress)
+		}
+	}
+	assert.Equal(1, acquired)
+	assert.Contains(uploader.objects, "providers/acme/dummy/terraform-provider-dummy_1.0.0_upload.lock")
+
+	// Other versions aren't locked
+	assert.NoError(s.LockProviderVersion(ctx, "acme", "dummy", "1.1.0"))
+
+	// The lock can be acquired again once it's released
+	assert.NoError(s.UnlockProviderVersion(ctx, "acme", "dummy", "1.0.0"))
+	assert.NoError(s.LockProviderVersion(ctx, "acme", "dummy", "1.0.0"))
+
+	// A retried upload of the lock finds its own lock
+	uploader.lostResponse = true
+	assert.NoError(s.LockProviderVersion(ctx, "acme", "dummy", "2.0.0"))
+
+	// Expired locks are taken over
+	key := "providers/acme/dummy/terraform-provider-dummy_1.0.0_upload.lock"
+	uploader.objects[key] = fmt.Appendf(nil, `{"created":%q}`, time.Now().Add(-uploadLockTTL-time.Minute).UTC().Format(time.RFC3339))
+	assert.NoError(s.LockProviderVersion(ctx, "acme", "dummy", "1.0.0"))
+	assert.ErrorIs(s.LockProviderVersion(ctx, "acme", "dummy", "1.0.0"), core.ErrUploadInProgress)
+
+	// An upload can't release the lock after another upload took it over
+	uploader.objects[key] = fmt.Appendf(nil, `{"created":%q}`, time.Now().Add(-uploadLockTTL-time.Minute).UTC().Format(time.RFC3339))
+	other := newStorage()
+	assert.NoError(other.LockProviderVersion(ctx, "acme", "dummy", "1.0.0"))
+	assert.ErrorIs(s.UnlockProviderVersion(ctx, "acme", "dummy", "1.0.0"), core.ErrUploadInProgress)
+	assert.Contains(uploader.objects, key)
+	assert.NoError(other.UnlockProviderVersion(ctx, "acme", "dummy", "1.0.0"))
+	assert.NotContains(uploader.objects, key)
+
+	// Only one of the concurrent uploads takes over an expired lock
+	uploader.objects[key] = fmt.Appendf(nil, `{"created":%q}`, time.Now().Add(-uploadLockTTL-time.Minute).UTC().Format(time.RFC3339))
+	for i := range uploads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = newStorage().LockProviderVersion(ctx, "acme", "dummy", "1.0.0")
+		}()
+	}
+	wg.Wait()
+
+	acquired = 0
+	for _, err := range errs {
+		if err == nil {
+			acquired++
+		} else {
+			assert.ErrorIs(err, core.ErrUploadInProgress)
+		}
+	}
+	assert.Equal(1, acquired)
+}
+
+func TestS3Storage_signedURLHeadroom(t *testing.T) {
+	assert := assertion.New(t)
+
+	tests := []struct {
+		name           string
+		expiry         time.Duration
+		proxied        bool
+		wantExpiry     time.Duration
+		wantNearExpiry float64
+	}{
+		{name: "redirected download", expiry: 30 * time.Second, wantExpiry: 30 * time.Second},
+		{name: "proxied download near expiry", expiry: 30 * time.Second, proxied: true, wantExpiry: time.Minute, wantNearExpiry: 1},
+		{name: "proxied download with enough headroom", expiry: 5 * time.Minute, proxied: true, wantExpiry: 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &expiryRecordingPresignClient{}
+			nearExpiry := prometheus.NewCounter(prometheus.CounterOpts{Name: "near_expiry_presigns_total"})
+			s := &S3Storage{presignClient: client, signedURLExpiry: tt.expiry}
+			WithS3StorageSignedURLHeadroom(time.Minute, nearExpiry)(s)
+
+			ctx := context.Background()
+			if tt.proxied {
+				ctx = core.ContextWithProxiedDownload(ctx)
+			}
+			_, err := s.presignedURL(ctx, "providers/hashicorp/random/terraform-provider-random_3.6.0_linux_amd64.zip")
+			assert.NoError(err)
+			assert.Equal(tt.wantExpiry, client.expires)
+			assert.Equal(tt.wantNearExpiry, testutil.ToFloat64(nearExpiry))
+		})
+	}
+}
+
+func TestS3Storage_Relocate(t *testing.T) {
+	assert := assertion.New(t)
+
+	tests := []struct {
+		name          string
+		bucketPrefix  string
+		targetPrefix  string
+		opts          RelocateOptions
+		etags         map[string]string
+		wantCopies    []string
+		wantDeletions []string
+		wantErr       bool
+	}{
+		{
+			name:         "copy to a new prefix",
+			bucketPrefix: "registry",
+			targetPrefix: "tenants/acme",
+			etags: map[string]string{
+				"registry/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz": "etag10",
+				"registry/providers/acme/dummy/signing-keys.json":         "etag20",
+			},
+			wantCopies: []string{
+				"bucket/registry/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz -> tenants/acme/modules/acme/vpc/aws/acme-vpc-aws-1.0.0.tar.gz",
+				"bucket/registry/providers/acme/dummy/signing-keys.json -> tenants/acme/providers/acme/dummy/signing-keys.json",
+			},
+		},
+		{
+			name:         "copy to the root of the bucket and delete the source",
+			bucketPrefix: "registry/",
+			opts:         RelocateOptions{DeleteSource: true},
+			etags: map[string]string{
+				"registry/providers/acme/dummy/terraform-provider-dummy_0.1.0_linux_amd64.zip": "etag30",
+			},
+			wantCopies: []string{
+				"bucket/registry/providers/acme/dummy/terraform-provider-dummy_0.1.0_linux_amd64.zip -> providers/acme/dummy/terraform-provider-dummy_0.1.0_linux_amd64.zip",
+			},
+			wantDeletions: []string{"registry/providers/acme/dummy/terraform-provider-dummy_0.1.0_linux_amd64.zip"},
+		},
+		{
+			name:         "dry run",
+			bucketPrefix: "registry",
+			targetPrefix: "tenants/acme",
+			opts:         RelocateOptions{DeleteSource: true, DryRun: true},
+			etags: map[string]string{
+				"registry/providers/acme/dummy/signing-keys.json": "etag20",
+			},
+		},
+		{
+			name:         "target prefix is the bucket prefix",
+			bucketPrefix: "registry",
+			targetPrefix: "registry/",
+			etags: map[string]string{
+				"registry/providers/acme/dummy/signing-keys.json": "etag20",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// etags contains the objects of the bucket, the copies are added during the test
+			etags := make(map[string]string, len(tt.etags))
+			var keys []string
+			for k, v := range tt.etags {
+				etags[k] = v
+				keys = append(keys, k)
+			}
+			slices.Sort(keys)
+
+			var copies, deletions []string
+			client := &mockS3Client{
+				listObjectsV2: func(ctx context.Context, input *s3.ListObjectsV2Input, f ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+					var contents []types.Object
+					for _, k := range keys {
+						if strings.HasPrefix(k, *input.Prefix) {
+							contents = append(contents, types.Object{Key: aws.String(k)})
+						}
+					}
+					return &s3.ListObjectsV2Output{Contents: contents}, nil
+				},
+				copyObject: func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+					copies = append(copies, *params.CopySource+" -> "+*params.Key)
+					etag := etags[strings.TrimPrefix(*params.CopySource, "bucket/")]
+					// The copy is bound to the source that was checked
+					assert.Equal(etag, aws.ToString(params.CopySourceIfMatch))
+					assert.Equal(types.ChecksumAlgorithmSha256, params.ChecksumAlgorithm)
+					etags[*params.Key] = etag
+					return &s3.CopyObjectOutput{CopyObjectResult: &types.CopyObjectResult{ETag: aws.String(etag)}}, nil
+				},
+				headObject: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+					return &s3.HeadObjectOutput{ETag: aws.String(etags[*params.Key])}, nil
+				},
+				deleteObject: func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+					deletions = append(deletions, *params.Key)
+					return &s3.DeleteObjectOutput{}, nil
+				},
+			}
+			s := &S3Storage{client: client, bucket: "bucket", bucketPrefix: tt.bucketPrefix}
+
+			relocated, err := Relocate(context.Background(), s, tt.targetPrefix, tt.opts)
+			if tt.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(len(tt.etags), relocated)
+			assert.Equal(tt.wantCopies, copies)
+			assert.Equal(tt.wantDeletions, deletions)
+		})
+	}
+}
+
+func TestS3Storage_CopyToPrefix_checksumMismatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  s3.HeadObjectOutput
+		result  types.CopyObjectResult
+		wantErr bool
+	}{
+		{
+			name:   "matching SHA256 checksum",
+			source: s3.HeadObjectOutput{ETag: aws.String("etag-1-2"), ChecksumSHA256: aws.String("sha256")},
+			result: types.CopyObjectResult{ETag: aws.String("etag-2"), ChecksumSHA256: aws.String("sha256")},
+		},
+		{
+			name:    "different SHA256 checksum",
+			source:  s3.HeadObjectOutput{ETag: aws.String("etag"), ChecksumSHA256: aws.String("sha256")},
+			result:  types.CopyObjectResult{ETag: aws.String("etag"), ChecksumSHA256: aws.String("other")},
+			wantErr: true,
+		},
+		{
+			name:    "different ETag",
+			source:  s3.HeadObjectOutput{ETag: aws.String("etag")},
+			result:  types.CopyObjectResult{ETag: aws.String("other"), ChecksumSHA256: aws.String("sha256")},
+			wantErr: true,
+		},
+		{
+			name:   "multipart upload without a full-object checksum",
+			source: s3.HeadObjectOutput{ETag: aws.String("etag-3"), ChecksumSHA256: aws.String("sha256-3")},
+			result: types.CopyObjectResult{ETag: aws.String("other"), ChecksumSHA256: aws.String("sha256")},
+		},
+		{
+			name:   "encrypted with KMS",
+			source: s3.HeadObjectOutput{ETag: aws.String("etag"), ServerSideEncryption: types.ServerSideEncryptionAwsKms},
+			result: types.CopyObjectResult{ETag: aws.String("other"), ChecksumSHA256: aws.String("sha256")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3Client{
+				copyObject: func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+					return &s3.CopyObjectOutput{CopyObjectResult: &tt.result}, nil
+				},
+				headObject: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+					assertion.Equal(t, types.ChecksumModeEnabled, params.ChecksumMode)
+					return &tt.source, nil
+				},
+			}
+			s := &S3Storage{client: client, bucket: "bucket"}
+
+			err := s.CopyToPrefix(context.Background(), "providers/acme/dummy/signing-keys.json", "target")
+			if tt.wantErr {
+				assertion.Error(t, err)
+				return
+			}
+			assertion.NoError(t, err)
+		})
+	}
+}
+
+func TestS3Storage_DeleteMirroredFile(t *testing.T) {
+	key := "mirror/providers/registry.terraform.io/hashicorp/random/terraform-provider-random_3.6.0_linux_amd64.zip"
+	cache := newExistenceCache(time.Hour)
+	cache.add(key, "")
+	client := &mockS3Client{
+		deleteObject: func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+			assertion.Equal(t, key, *params.Key)
+			return &s3.DeleteObjectOutput{}, nil
+		},
+	}
+	s := &S3Storage{client: client, bucket: "bucket", existsCache: cache}
+
+	provider := &core.Provider{Hostname: "registry.terraform.io", Namespace: "hashicorp", Name: "random", Version: "3.6.0", OS: "linux", Arch: "amd64"}
+	assertion.NoError(t, s.DeleteMirroredFile(context.Background(), provider, provider.ArchiveFileName()))
+
+	// The deleted archive isn't reported as existing by the cache anymore
+	assertion.False(t, cache.contains(key))
+}
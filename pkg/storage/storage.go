@@ -1,25 +1,236 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/boring-registry/boring-registry/pkg/admin"
+	"github.com/boring-registry/boring-registry/pkg/catalog"
 	"github.com/boring-registry/boring-registry/pkg/core"
+	"github.com/boring-registry/boring-registry/pkg/debug"
 	"github.com/boring-registry/boring-registry/pkg/mirror"
 	"github.com/boring-registry/boring-registry/pkg/module"
 	"github.com/boring-registry/boring-registry/pkg/provider"
 	"github.com/boring-registry/boring-registry/pkg/proxy"
+
+	"github.com/google/uuid"
 )
 
 const (
 	DefaultModuleArchiveFormat = "tar.gz"
+
+	// healthCheckKey is the object that is looked up by the health checks of the storage backends
+	healthCheckKey = ".healthz"
+)
+
+const (
+	// ObjectACLPrivate keeps uploaded objects private, access is only granted through the presigned download URLs
+	ObjectACLPrivate = "private"
+	// ObjectACLPublicRead allows anonymous reads of uploaded objects, e.g. by a CDN in front of the bucket
+	ObjectACLPublicRead = "public-read"
 )
 
+// ObjectACLs are the supported access controls of uploaded objects
+var ObjectACLs = []string{ObjectACLPrivate, ObjectACLPublicRead}
+
+// ValidateObjectACL returns an error if the object ACL isn't supported
+func ValidateObjectACL(acl string) error {
+	if !slices.Contains(ObjectACLs, acl) {
+		return fmt.Errorf("unsupported object ACL %q, expected one of: %s", acl, strings.Join(ObjectACLs, ", "))
+	}
+	return nil
+}
+
+// ModuleArchiveFormats are the module archive formats that Terraform and OpenTofu can extract,
+// they derive the decompression from the file extension of the download URL.
+var ModuleArchiveFormats = []string{"tar.gz", "tgz", "tar.bz2", "tar.tbz2", "tar.xz", "txz", "zip"}
+
+// GoGetterModuleArchiveFormats are the module archive formats that Terraform and OpenTofu can't extract,
+// as they only register a subset of the go-getter decompressors. Only clients using go-getter directly can install them.
+var GoGetterModuleArchiveFormats = []string{"tar.zst"}
+
+// ValidateModuleArchiveFormat returns an error if the module archive format isn't supported.
+// The GoGetterModuleArchiveFormats are only accepted with allowGoGetter
+func ValidateModuleArchiveFormat(format string, allowGoGetter bool) error {
+	if slices.Contains(GoGetterModuleArchiveFormats, format) {
+		if !allowGoGetter {
+			return fmt.Errorf("module archives in the %s format can't be extracted by Terraform and OpenTofu", format)
+		}
+		return nil
+	}
+	if !slices.Contains(ModuleArchiveFormats, format) {
+		return fmt.Errorf("unsupported module archive format %q, expected one of: %s", format, strings.Join(ModuleArchiveFormats, ", "))
+	}
+	return nil
+}
+
 type Storage interface {
 	provider.Storage
 	module.Storage
 	mirror.Storage
+	mirror.GCStorage
 	proxy.Storage
+	catalog.Storage
+	debug.Storage
+	admin.Cache
+	Relocator
+
+	// HealthCheck returns an error if the storage backend can't be reached
+	HealthCheck(ctx context.Context) error
+
+	// String returns the name of the storage backend
+	String() string
+}
+
+// uploadLockTTL is the age after which an upload lock is considered abandoned by an upload that was killed before it could release it
+const uploadLockTTL = time.Hour
+
+// uploadLock is the content of an upload lock, which records who acquired the lock and when
+type uploadLock struct {
+	Owner   string    `json:"owner,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// readUploadLock returns the content of an upload lock and its version, e.g. the ETag or generation of the lock object.
+// It returns core.ErrObjectNotFound if the lock doesn't exist
+type readUploadLock func(ctx context.Context) (content []byte, version string, err error)
+
+// removeUploadLock deletes the upload lock only if it still has the version, otherwise it fails with core.ErrUploadInProgress
+type removeUploadLock func(ctx context.Context, version string) error
+
+// uploadLocks records the content of the upload locks that were acquired through the storage backend,
+// so that a lock is only released by the upload holding it. The zero value is ready to use
+type uploadLocks struct {
+	mu   sync.Mutex
+	held map[string][]byte
+}
+
+// acquire creates the lock object with create, which has to fail with core.ErrUploadInProgress if the lock object exists.
+// An existing lock that carries the owner of this call is acquired, as the client of the storage backend retries creates whose response was lost.
+// Locks that are older than the uploadLockTTL are deleted with remove and acquired again.
+// Only one of the uploads that find the same expired lock deletes it, as remove is conditioned on the version that was read
+func (l *uploadLocks) acquire(ctx context.Context, key string, create func(ctx context.Context, content []byte) error, read readUploadLock, remove removeUploadLock) error {
+	content, err := json.Marshal(uploadLock{Owner: uuid.NewString(), Created: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	err = create(ctx, content)
+	if err == nil {
+		l.hold(key, content)
+		return nil
+	} else if !errors.Is(err, core.ErrUploadInProgress) {
+		return err
+	}
+
+	// The lock might have been released in the meantime, in which case the upload can simply be retried
+	raw, version, readErr := read(ctx)
+	if readErr != nil {
+		return err
+	}
+	if bytes.Equal(raw, content) {
+		l.hold(key, content)
+		return nil
+	}
+	var existing uploadLock
+	if json.Unmarshal(raw, &existing) != nil || existing.Created.IsZero() || time.Since(existing.Created) < uploadLockTTL {
+		return err
+	}
+
+	slog.Warn("taking over an expired upload lock", slog.String("key", key), slog.Time("created", existing.Created))
+	if err := remove(ctx, version); err != nil {
+		return fmt.Errorf("failed to delete the expired lock %s: %w", key, err)
+	}
+	if err := create(ctx, content); err != nil {
+		return err
+	}
+	l.hold(key, content)
+	return nil
+}
+
+// release deletes the lock object if it's still held by this upload.
+// A lock that was taken over by another upload after it expired is left in place
+func (l *uploadLocks) release(ctx context.Context, key string, read readUploadLock, remove removeUploadLock) error {
+	l.mu.Lock()
+	content, ok := l.held[key]
+	l.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("the upload lock %s isn't held by this upload", key)
+	}
+
+	raw, version, err := read(ctx)
+	if errors.Is(err, core.ErrObjectNotFound) {
+		l.drop(key)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read the lock %s: %w", key, err)
+	}
+	if !bytes.Equal(raw, content) {
+		l.drop(key)
+		return fmt.Errorf("the upload lock %s was taken over by another upload: %w", key, core.ErrUploadInProgress)
+	}
+
+	if err := remove(ctx, version); err != nil {
+		return fmt.Errorf("failed to delete the lock %s: %w", key, err)
+	}
+	l.drop(key)
+	return nil
+}
+
+func (l *uploadLocks) hold(key string, content []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held == nil {
+		l.held = make(map[string][]byte)
+	}
+	l.held[key] = content
+}
+
+func (l *uploadLocks) drop(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.held, key)
+}
+
+// signingKeysWithFallback returns the signing keys of lookup, or the keys of the default namespace if lookup doesn't find any keys of the namespace.
+// It's only used to serve providers, so that commands adding keys to a namespace never copy the keys of the default namespace
+func signingKeysWithFallback(ctx context.Context, namespace, defaultNamespace string, lookup func(ctx context.Context) (*core.SigningKeys, error), fallback func(ctx context.Context, namespace string) (*core.SigningKeys, error)) (*core.SigningKeys, error) {
+	if defaultNamespace == "" || defaultNamespace == namespace {
+		return lookup(ctx)
+	}
+
+	slog.DebugContext(ctx, "looking up signing keys", slog.String("namespace", namespace), slog.String("default_namespace", defaultNamespace))
+	signingKeys, err := lookup(ctx)
+	if !errors.Is(err, core.ErrObjectNotFound) {
+		return signingKeys, err
+	}
+
+	slog.DebugContext(ctx, "namespace doesn't have signing keys, falling back to the default namespace", slog.String("namespace", namespace), slog.String("default_namespace", defaultNamespace))
+	return fallback(ctx, defaultNamespace)
+}
+
+// mostSpecificSigningKeys returns the signing keys of the first of the keys that exists.
+// It returns core.ErrObjectNotFound if none of them exists.
+func mostSpecificSigningKeys(ctx context.Context, keys []string, lookup func(ctx context.Context, key string) (*core.SigningKeys, error)) (*core.SigningKeys, error) {
+	for _, key := range keys {
+		signingKeys, err := lookup(ctx, key)
+		if errors.Is(err, core.ErrObjectNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		slog.DebugContext(ctx, "found signing keys", slog.String("key", key))
+		return signingKeys, nil
+	}
+	return nil, core.ErrObjectNotFound
 }
 
 // unmarshalSigningKeys tries to unmarshal the byte-array into core.SigningKeys, and if that fails into core.GPGPublicKey.
@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+)
+
+// DefaultOperationTimeout is the duration after which an operation against the storage backend is aborted
+const DefaultOperationTimeout = 30 * time.Second
+
+// timeoutStorage bounds every operation of the wrapped Storage with a child context of the request context.
+// Uploads and downloads of mirrored files are excluded, their duration depends on the size of the archive and is bounded by the caller.
+// Listings of the whole storage are excluded as well, their duration grows with the number of objects.
+type timeoutStorage struct {
+	next    Storage
+	timeout time.Duration
+}
+
+// NewTimeoutStorage wraps the Storage to abort operations that take longer than the timeout with a core.ErrStorageTimeout.
+// The Storage is returned as is if the timeout is not positive.
+func NewTimeoutStorage(s Storage, timeout time.Duration) Storage {
+	if timeout <= 0 {
+		return s
+	}
+	return &timeoutStorage{
+		next:    s,
+		timeout: timeout,
+	}
+}
+
+// withTimeout calls f with a context that expires after the timeout.
+// Only an expiry of the operation context is reported as core.ErrStorageTimeout, a canceled request context is returned as is.
+func withTimeout[T any](ctx context.Context, timeout time.Duration, operation string, f func(context.Context) (T, error)) (T, error) {
+	opCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	v, err := f(opCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(opCtx.Err(), context.DeadlineExceeded) {
+		return v, fmt.Errorf("%w: %s didn't complete within %s: %w", core.ErrStorageTimeout, operation, timeout, err)
+	}
+	return v, err
+}
+
+func (s *timeoutStorage) run(ctx context.Context, operation string, f func(context.Context) error) error {
+	_, err := withTimeout(ctx, s.timeout, operation, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, f(ctx)
+	})
+	return err
+}
+
+func (s *timeoutStorage) GetModule(ctx context.Context, namespace, name, provider, version string) (core.Module, error) {
+	return withTimeout(ctx, s.timeout, "GetModule", func(ctx context.Context) (core.Module, error) {
+		return s.next.GetModule(ctx, namespace, name, provider, version)
+	})
+}
+
+func (s *timeoutStorage) ListModuleVersions(ctx context.Context, namespace, name, provider string) ([]core.Module, error) {
+	return withTimeout(ctx, s.timeout, "ListModuleVersions", func(ctx context.Context) ([]core.Module, error) {
+		return s.next.ListModuleVersions(ctx, namespace, name, provider)
+	})
+}
+
+func (s *timeoutStorage) ModuleExists(ctx context.Context, namespace, name, provider, version string) (bool, error) {
+	return withTimeout(ctx, s.timeout, "ModuleExists", func(ctx context.Context) (bool, error) {
+		return s.next.ModuleExists(ctx, namespace, name, provider, version)
+	})
+}
+
+func (s *timeoutStorage) ListModulesByProvider(ctx context.Context, provider string, limit int, token string) ([]core.Module, string, error) {
+	var next string
+	modules, err := withTimeout(ctx, s.timeout, "ListModulesByProvider", func(ctx context.Context) ([]core.Module, error) {
+		var err error
+		var modules []core.Module
+		modules, next, err = s.next.ListModulesByProvider(ctx, provider, limit, token)
+		return modules, err
+	})
+	return modules, next, err
+}
+
+func (s *timeoutStorage) UploadModule(ctx context.Context, namespace, name, provider, version string, body io.Reader) (core.Module, error) {
+	return s.next.UploadModule(ctx, namespace, name, provider, version, body)
+}
+
+func (s *timeoutStorage) GetProvider(ctx context.Context, namespace, name, version, os, arch string) (*core.Provider, error) {
+	return withTimeout(ctx, s.timeout, "GetProvider", func(ctx context.Context) (*core.Provider, error) {
+		return s.next.GetProvider(ctx, namespace, name, version, os, arch)
+	})
+}
+
+func (s *timeoutStorage) ListProviderVersions(ctx context.Context, namespace, name string) (*core.ProviderVersions, error) {
+	return withTimeout(ctx, s.timeout, "ListProviderVersions", func(ctx context.Context) (*core.ProviderVersions, error) {
+		return s.next.ListProviderVersions(ctx, namespace, name)
+	})
+}
+
+func (s *timeoutStorage) ListProviderPlatforms(ctx context.Context, namespace, name, version string) ([]core.Platform, error) {
+	return withTimeout(ctx, s.timeout, "ListProviderPlatforms", func(ctx context.Context) ([]core.Platform, error) {
+		return s.next.ListProviderPlatforms(ctx, namespace, name, version)
+	})
+}
+
+func (s *timeoutStorage) ListProviderVersionsPage(ctx context.Context, namespace, name string, limit int, token string) (*core.ProviderVersions, string, error) {
+	var next string
+	versions, err := withTimeout(ctx, s.timeout, "ListProviderVersionsPage", func(ctx context.Context) (*core.ProviderVersions, error) {
+		var err error
+		var versions *core.ProviderVersions
+		versions, next, err = s.next.ListProviderVersionsPage(ctx, namespace, name, limit, token)
+		return versions, err
+	})
+	return versions, next, err
+}
+
+func (s *timeoutStorage) UploadProviderReleaseFiles(ctx context.Context, namespace, name, filename string, file io.Reader) error {
+	return s.next.UploadProviderReleaseFiles(ctx, namespace, name, filename, file)
+}
+
+func (s *timeoutStorage) LockProviderVersion(ctx context.Context, namespace, name, version string) error {
+	return s.run(ctx, "LockProviderVersion", func(ctx context.Context) error {
+		return s.next.LockProviderVersion(ctx, namespace, name, version)
+	})
+}
+
+func (s *timeoutStorage) UnlockProviderVersion(ctx context.Context, namespace, name, version string) error {
+	return s.run(ctx, "UnlockProviderVersion", func(ctx context.Context) error {
+		return s.next.UnlockProviderVersion(ctx, namespace, name, version)
+	})
+}
+
+func (s *timeoutStorage) DownloadProviderReleaseFile(ctx context.Context, namespace, name, filename string) ([]byte, error) {
+	return withTimeout(ctx, s.timeout, "DownloadProviderReleaseFile", func(ctx context.Context) ([]byte, error) {
+		return s.next.DownloadProviderReleaseFile(ctx, namespace, name, filename)
+	})
+}
+
+func (s *timeoutStorage) StreamProviderReleaseFile(ctx context.Context, namespace, name, filename string, w io.Writer) error {
+	return s.next.StreamProviderReleaseFile(ctx, namespace, name, filename, w)
+}
+
+func (s *timeoutStorage) DeleteProviderReleaseFile(ctx context.Context, namespace, name, filename string) error {
+	return s.run(ctx, "DeleteProviderReleaseFile", func(ctx context.Context) error {
+		return s.next.DeleteProviderReleaseFile(ctx, namespace, name, filename)
+	})
+}
+
+func (s *timeoutStorage) ProviderReleaseFileChecksum(ctx context.Context, namespace, name, filename string) ([]byte, error) {
+	return withTimeout(ctx, s.timeout, "ProviderReleaseFileChecksum", func(ctx context.Context) ([]byte, error) {
+		return s.next.ProviderReleaseFileChecksum(ctx, namespace, name, filename)
+	})
+}
+
+func (s *timeoutStorage) ProviderSha256Sums(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	return withTimeout(ctx, s.timeout, "ProviderSha256Sums", func(ctx context.Context) ([]byte, error) {
+		return s.next.ProviderSha256Sums(ctx, namespace, name, version)
+	})
+}
+
+func (s *timeoutStorage) ProviderDocs(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	return withTimeout(ctx, s.timeout, "ProviderDocs", func(ctx context.Context) ([]byte, error) {
+		return s.next.ProviderDocs(ctx, namespace, name, version)
+	})
+}
+
+func (s *timeoutStorage) ProviderExists(ctx context.Context, namespace, name, version, os, arch string) (bool, error) {
+	return withTimeout(ctx, s.timeout, "ProviderExists", func(ctx context.Context) (bool, error) {
+		return s.next.ProviderExists(ctx, namespace, name, version, os, arch)
+	})
+}
+
+func (s *timeoutStorage) ProviderDocsExist(ctx context.Context, namespace, name, version string) (bool, error) {
+	return withTimeout(ctx, s.timeout, "ProviderDocsExist", func(ctx context.Context) (bool, error) {
+		return s.next.ProviderDocsExist(ctx, namespace, name, version)
+	})
+}
+
+func (s *timeoutStorage) SigningKeys(ctx context.Context, namespace string) (*core.SigningKeys, error) {
+	return withTimeout(ctx, s.timeout, "SigningKeys", func(ctx context.Context) (*core.SigningKeys, error) {
+		return s.next.SigningKeys(ctx, namespace)
+	})
+}
+
+func (s *timeoutStorage) ProviderSigningKeys(ctx context.Context, namespace, name, version string) (*core.SigningKeys, error) {
+	return withTimeout(ctx, s.timeout, "ProviderSigningKeys", func(ctx context.Context) (*core.SigningKeys, error) {
+		return s.next.ProviderSigningKeys(ctx, namespace, name, version)
+	})
+}
+
+func (s *timeoutStorage) UploadSigningKeys(ctx context.Context, namespace string, signingKeys *core.SigningKeys) error {
+	return s.run(ctx, "UploadSigningKeys", func(ctx context.Context) error {
+		return s.next.UploadSigningKeys(ctx, namespace, signingKeys)
+	})
+}
+
+func (s *timeoutStorage) ListMirroredProviders(ctx context.Context, provider *core.Provider) ([]*core.Provider, error) {
+	return withTimeout(ctx, s.timeout, "ListMirroredProviders", func(ctx context.Context) ([]*core.Provider, error) {
+		return s.next.ListMirroredProviders(ctx, provider)
+	})
+}
+
+func (s *timeoutStorage) ListAllMirroredProviders(ctx context.Context) ([]*core.Provider, error) {
+	return s.next.ListAllMirroredProviders(ctx)
+}
+
+func (s *timeoutStorage) GetMirroredProvider(ctx context.Context, provider *core.Provider) (*core.Provider, error) {
+	return withTimeout(ctx, s.timeout, "GetMirroredProvider", func(ctx context.Context) (*core.Provider, error) {
+		return s.next.GetMirroredProvider(ctx, provider)
+	})
+}
+
+func (s *timeoutStorage) UploadMirroredFile(ctx context.Context, provider *core.Provider, fileName string, reader io.Reader) error {
+	return s.next.UploadMirroredFile(ctx, provider, fileName, reader)
+}
+
+func (s *timeoutStorage) DownloadMirroredFile(ctx context.Context, provider *core.Provider, fileName string) ([]byte, error) {
+	return s.next.DownloadMirroredFile(ctx, provider, fileName)
+}
+
+func (s *timeoutStorage) ListMirroredFiles(ctx context.Context) ([]string, error) {
+	return s.next.ListMirroredFiles(ctx)
+}
+
+func (s *timeoutStorage) DeleteMirroredFile(ctx context.Context, provider *core.Provider, fileName string) error {
+	return s.run(ctx, "DeleteMirroredFile", func(ctx context.Context) error {
+		return s.next.DeleteMirroredFile(ctx, provider, fileName)
+	})
+}
+
+func (s *timeoutStorage) MirroredSigningKeys(ctx context.Context, hostname, namespace string) (*core.SigningKeys, error) {
+	return withTimeout(ctx, s.timeout, "MirroredSigningKeys", func(ctx context.Context) (*core.SigningKeys, error) {
+		return s.next.MirroredSigningKeys(ctx, hostname, namespace)
+	})
+}
+
+func (s *timeoutStorage) UploadMirroredSigningKeys(ctx context.Context, hostname, namespace string, signingKeys *core.SigningKeys) error {
+	return s.run(ctx, "UploadMirroredSigningKeys", func(ctx context.Context) error {
+		return s.next.UploadMirroredSigningKeys(ctx, hostname, namespace, signingKeys)
+	})
+}
+
+func (s *timeoutStorage) MirroredSha256Sum(ctx context.Context, provider *core.Provider) (*core.Sha256Sums, error) {
+	return withTimeout(ctx, s.timeout, "MirroredSha256Sum", func(ctx context.Context) (*core.Sha256Sums, error) {
+		return s.next.MirroredSha256Sum(ctx, provider)
+	})
+}
+
+func (s *timeoutStorage) GetDownloadUrl(ctx context.Context, url string) (string, error) {
+	return withTimeout(ctx, s.timeout, "GetDownloadUrl", func(ctx context.Context) (string, error) {
+		return s.next.GetDownloadUrl(ctx, url)
+	})
+}
+
+func (s *timeoutStorage) ListAllModules(ctx context.Context) ([]core.Module, error) {
+	return s.next.ListAllModules(ctx)
+}
+
+func (s *timeoutStorage) ListAllProviders(ctx context.Context) ([]*core.Provider, error) {
+	return s.next.ListAllProviders(ctx)
+}
+
+func (s *timeoutStorage) ListKeys(ctx context.Context, prefix string, limit int) ([]string, error) {
+	return withTimeout(ctx, s.timeout, "ListKeys", func(ctx context.Context) ([]string, error) {
+		return s.next.ListKeys(ctx, prefix, limit)
+	})
+}
+
+func (s *timeoutStorage) ListAllKeys(ctx context.Context) ([]string, error) {
+	return s.next.ListAllKeys(ctx)
+}
+
+// CopyToPrefix isn't limited by the timeout, as server-side copies of large objects can take longer
+func (s *timeoutStorage) CopyToPrefix(ctx context.Context, key, targetPrefix string) error {
+	return s.next.CopyToPrefix(ctx, key, targetPrefix)
+}
+
+func (s *timeoutStorage) DeleteKey(ctx context.Context, key string) error {
+	return s.run(ctx, "DeleteKey", func(ctx context.Context) error {
+		return s.next.DeleteKey(ctx, key)
+	})
+}
+
+// InvalidateCache doesn't reach the storage backend, so it isn't limited by the timeout
+func (s *timeoutStorage) InvalidateCache(ctx context.Context, prefix string) int {
+	return s.next.InvalidateCache(ctx, prefix)
+}
+
+func (s *timeoutStorage) HealthCheck(ctx context.Context) error {
+	return s.run(ctx, "HealthCheck", s.next.HealthCheck)
+}
+
+func (s *timeoutStorage) String() string {
+	return s.next.String()
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boring-registry/boring-registry/pkg/core"
+	o11y "github.com/boring-registry/boring-registry/pkg/observability"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// blockingStorage blocks every operation until the context is done
+type blockingStorage struct {
+	Storage
+	uploadDeadline  bool
+	listingDeadline bool
+}
+
+func (s *blockingStorage) GetModule(ctx context.Context, _, _, _, _ string) (core.Module, error) {
+	<-ctx.Done()
+	return core.Module{}, ctx.Err()
+}
+
+func (s *blockingStorage) HealthCheck(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *blockingStorage) UploadModule(ctx context.Context, _, _, _, _ string, _ io.Reader) (core.Module, error) {
+	_, s.uploadDeadline = ctx.Deadline()
+	return core.Module{}, nil
+}
+
+func (s *blockingStorage) ListAllModules(ctx context.Context) ([]core.Module, error) {
+	_, s.listingDeadline = ctx.Deadline()
+	return nil, nil
+}
+
+func TestTimeoutStorage(t *testing.T) {
+	t.Run("operation times out", func(t *testing.T) {
+		s := NewTimeoutStorage(&blockingStorage{}, 10*time.Millisecond)
+
+		_, err := s.GetModule(context.Background(), "acme", "vpc", "aws", "1.0.0")
+		assertion.ErrorIs(t, err, core.ErrStorageTimeout)
+		assertion.ErrorIs(t, err, context.DeadlineExceeded)
+		assertion.NotErrorIs(t, err, core.ErrObjectNotFound)
+		assertion.ErrorContains(t, err, "GetModule")
+		assertion.Equal(t, o11y.OutcomeError, outcome(err))
+
+		err = s.HealthCheck(context.Background())
+		assertion.ErrorIs(t, err, core.ErrStorageTimeout)
+	})
+
+	t.Run("canceled request isn't a timeout", func(t *testing.T) {
+		s := NewTimeoutStorage(&blockingStorage{}, time.Minute)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := s.GetModule(ctx, "acme", "vpc", "aws", "1.0.0")
+		assertion.ErrorIs(t, err, context.Canceled)
+		assertion.NotErrorIs(t, err, core.ErrStorageTimeout)
+	})
+
+	t.Run("uploads aren't limited", func(t *testing.T) {
+		b := &blockingStorage{}
+		s := NewTimeoutStorage(b, time.Minute)
+
+		_, err := s.UploadModule(context.Background(), "acme", "vpc", "aws", "1.0.0", strings.NewReader(""))
+		assertion.NoError(t, err)
+		assertion.False(t, b.uploadDeadline)
+	})
+
+	t.Run("listings of the whole storage aren't limited", func(t *testing.T) {
+		b := &blockingStorage{}
+		s := NewTimeoutStorage(b, time.Minute)
+
+		_, err := s.ListAllModules(context.Background())
+		assertion.NoError(t, err)
+		assertion.False(t, b.listingDeadline)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		b := &blockingStorage{}
+		assertion.Same(t, b, NewTimeoutStorage(b, 0))
+	})
+}